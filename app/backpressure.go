@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// openPool limits number of log streams opening at once. The event loop takes a slot before opening a stream and
+// waits for a free one, not reading events meanwhile, so discovery paced by collection instead of piling up streams.
+// The slot returned once stream delivered its first line, or after timeout for quiet containers and ones waiting
+// to become healthy. Disabled pool, with zero limit, never waits.
+type openPool struct {
+	slots   chan struct{}
+	timeout time.Duration
+}
+
+// newOpenPool makes openPool with limit of opening streams, disabled if limit is 0
+func newOpenPool(limit int, timeout time.Duration) *openPool {
+	res := &openPool{timeout: timeout}
+	if limit > 0 {
+		res.slots = make(chan struct{}, limit)
+	}
+	return res
+}
+
+// acquire takes a slot, waiting for a free one. Returns release func, safe to call multiple times,
+// and false if ctx canceled while waiting.
+func (p *openPool) acquire(ctx context.Context) (release func(), ok bool) {
+	if p.slots == nil {
+		return func() {}, true
+	}
+	select {
+	case p.slots <- struct{}{}:
+	default:
+		log.Printf("[DEBUG] %d log streams opening, wait for a free slot", cap(p.slots))
+		select {
+		case p.slots <- struct{}{}:
+		case <-ctx.Done():
+			return func() {}, false
+		}
+	}
+
+	var once sync.Once
+	release = func() { once.Do(func() { <-p.slots }) }
+	time.AfterFunc(p.timeout, release) // no-op if released already
+	return release, true
+}
+
+// openedWriter releases slot of opening stream on the first write or close
+type openedWriter struct {
+	io.WriteCloser
+	release func()
+}
+
+// Write releases the slot and passes p to the wrapped writer
+func (w openedWriter) Write(p []byte) (int, error) {
+	w.release()
+	return w.WriteCloser.Write(p)
+}
+
+// Close releases the slot, as stream of stopped container won't write anymore, and closes the wrapped writer
+func (w openedWriter) Close() error {
+	w.release()
+	return w.WriteCloser.Close()
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_openPool(t *testing.T) {
+	p := newOpenPool(2, time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	release1, ok := p.acquire(ctx)
+	require.True(t, ok)
+	release2, ok := p.acquire(ctx)
+	require.True(t, ok)
+
+	acquired := make(chan struct{})
+	go func() {
+		_, ok := p.acquire(ctx)
+		assert.True(t, ok)
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("acquired over the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	wr := openedWriter{WriteCloser: &wrMock{}, release: release1}
+	_, err := wr.Write([]byte("first line\n"))
+	require.NoError(t, err)
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("slot not released by the first write")
+	}
+
+	_, err = wr.Write([]byte("second line\n"))
+	require.NoError(t, err)
+	release1()
+	assert.Len(t, p.slots, 2, "released once only")
+
+	require.NoError(t, openedWriter{WriteCloser: &wrMock{}, release: release2}.Close())
+	assert.Len(t, p.slots, 1, "released by close")
+
+	_, ok = p.acquire(ctx)
+	require.True(t, ok)
+	cancel()
+	_, ok = p.acquire(ctx)
+	assert.False(t, ok, "canceled while waiting")
+}
+
+func Test_openPoolTimeout(t *testing.T) {
+	p := newOpenPool(1, 20*time.Millisecond)
+	_, ok := p.acquire(context.Background())
+	require.True(t, ok)
+	st := time.Now()
+	_, ok = p.acquire(context.Background())
+	require.True(t, ok)
+	assert.GreaterOrEqual(t, time.Since(st), 20*time.Millisecond, "quiet stream released by timeout")
+}
+
+func Test_openPoolDisabled(t *testing.T) {
+	p := newOpenPool(0, time.Hour)
+	for i := 0; i < 100; i++ {
+		release, ok := p.acquire(context.Background())
+		require.True(t, ok)
+		release()
+	}
+	assert.Nil(t, p.slots)
+}
+
+// Test_openPoolStress opens many streams concurrently, each delivering the first line after a delay,
+// and checks the number of opening streams never exceeds the limit
+func Test_openPoolStress(t *testing.T) {
+	if testing.Short() {
+		t.Skip("stress test")
+	}
+	const limit, total = 8, 1000
+	p := newOpenPool(limit, time.Minute)
+	var opening, peak int32
+	var wg sync.WaitGroup
+	for i := 0; i < total; i++ {
+		release, ok := p.acquire(context.Background())
+		require.True(t, ok)
+		n := atomic.AddInt32(&opening, 1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if n <= old || atomic.CompareAndSwapInt32(&peak, old, n) {
+				break
+			}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			time.Sleep(time.Millisecond) // stream attaching
+			atomic.AddInt32(&opening, -1)
+			wr := openedWriter{WriteCloser: &wrMock{}, release: release}
+			_, err := wr.Write([]byte("line\n"))
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, atomic.LoadInt32(&peak), int32(limit))
+	assert.Empty(t, p.slots, "all released")
+}
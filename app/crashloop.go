@@ -0,0 +1,146 @@
+package main
+
+import (
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/docker-logger/app/discovery"
+)
+
+// crashBreaker is a circuit breaker of crash looping containers, i.e. with restart policy "always", keyed by
+// container id. Container started more than maxStarts times within window is suppressed, its log stream
+// not reopened on next starts, until it stays up for cooldown. Then the fired timer, sent to timers channel, makes
+// resume return container's last up event to start collection again. Suppressed container forgotten once
+// removed, or stopped for window, as its destroy may never come, i.e. coalesced with die. Not safe for concurrent
+// use, called by the event loop only.
+type crashBreaker struct {
+	maxStarts int
+	window    time.Duration
+	cooldown  time.Duration
+	done      <-chan struct{}
+
+	starts     map[string][]time.Time // recent starts by container id, within window
+	suppressed map[string]*suppression
+	timers     chan resumeTimer // fired cooldown timers, sent from timer goroutines
+}
+
+// suppression is state of suppressed container
+type suppression struct {
+	up      discovery.Event // the last up event, used to resume collection
+	running bool
+	stopped time.Time // time of the last stop, if not running
+	gen     int       // generation of cooldown timer, to ignore timers fired after reset
+	timer   *time.Timer
+}
+
+// resumeTimer is fired cooldown timer of suppressed container
+type resumeTimer struct {
+	containerID string
+	gen         int
+}
+
+// newCrashBreaker makes crashBreaker, disabled if maxStarts is 0. Fired timers dropped once done closed.
+func newCrashBreaker(maxStarts int, window, cooldown time.Duration, done <-chan struct{}) *crashBreaker {
+	res := &crashBreaker{maxStarts: maxStarts, window: window, cooldown: cooldown, done: done,
+		starts: map[string][]time.Time{}, suppressed: map[string]*suppression{}}
+	if maxStarts > 0 {
+		res.timers = make(chan resumeTimer)
+	}
+	return res
+}
+
+// started records container's start, returns collect=false if collection suppressed due to crash loop,
+// and suppressed=true if suppressed by this start
+func (b *crashBreaker) started(event discovery.Event) (collect, suppressed bool) {
+	if b.maxStarts <= 0 {
+		return true, false
+	}
+	now := time.Now()
+	b.prune(now)
+	if s, ok := b.suppressed[event.ContainerID]; ok {
+		log.Printf("[DEBUG] container %s still crash looping, collection suppressed", event.ContainerName)
+		s.up, s.running = event, true
+		b.schedule(event.ContainerID, s)
+		return false, false
+	}
+
+	b.starts[event.ContainerID] = append(b.starts[event.ContainerID], now)
+	if n := len(b.starts[event.ContainerID]); n > b.maxStarts {
+		log.Printf("[WARN] container %s suppressed due to crash loop, %d starts within %v, resumed after %v up",
+			event.ContainerName, n, b.window, b.cooldown)
+		s := &suppression{up: event, running: true}
+		b.suppressed[event.ContainerID] = s
+		b.schedule(event.ContainerID, s)
+		return false, true
+	}
+	return true, false
+}
+
+// stopped records container's stop, cancels resume of suppressed container. Removed container forgotten.
+func (b *crashBreaker) stopped(event discovery.Event) {
+	if s, ok := b.suppressed[event.ContainerID]; ok {
+		s.running, s.stopped = false, time.Now()
+		s.gen++
+		s.timer.Stop()
+	}
+	if event.Reason == discovery.ReasonRemoved {
+		delete(b.suppressed, event.ContainerID)
+		delete(b.starts, event.ContainerID)
+	}
+}
+
+// suppressing returns true if collection of container suppressed due to crash loop
+func (b *crashBreaker) suppressing(containerID string) bool {
+	_, ok := b.suppressed[containerID]
+	return ok
+}
+
+// resume returns up event of suppressed container stable for cooldown, false for outdated timer
+func (b *crashBreaker) resume(t resumeTimer) (discovery.Event, bool) {
+	s, ok := b.suppressed[t.containerID]
+	if !ok || !s.running || s.gen != t.gen {
+		return discovery.Event{}, false
+	}
+	delete(b.suppressed, t.containerID)
+	delete(b.starts, t.containerID) // stable now, crash loop starts forgotten
+	log.Printf("[INFO] container %s stable for %v, collection resumed", s.up.ContainerName, b.cooldown)
+	return s.up, true
+}
+
+// schedule (re)starts cooldown timer of suppressed container
+func (b *crashBreaker) schedule(containerID string, s *suppression) {
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.gen++
+	t := resumeTimer{containerID: containerID, gen: s.gen}
+	s.timer = time.AfterFunc(b.cooldown, func() {
+		select {
+		case b.timers <- t:
+		case <-b.done:
+		}
+	})
+}
+
+// prune drops starts older than window, containers without recent starts and suppressed containers stopped
+// for window
+func (b *crashBreaker) prune(now time.Time) {
+	for id, s := range b.suppressed {
+		if !s.running && now.Sub(s.stopped) > b.window {
+			log.Printf("[DEBUG] container %s stopped for %v, crash loop suppression forgotten", s.up.ContainerName, b.window)
+			delete(b.suppressed, id)
+		}
+	}
+	for id, starts := range b.starts {
+		i := 0
+		for i < len(starts) && now.Sub(starts[i]) > b.window {
+			i++
+		}
+		if i == len(starts) {
+			delete(b.starts, id)
+			continue
+		}
+		b.starts[id] = starts[i:]
+	}
+}
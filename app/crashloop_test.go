@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/docker-logger/app/discovery"
+)
+
+func Test_crashBreaker(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	b := newCrashBreaker(2, time.Minute, 50*time.Millisecond, done)
+	up := discovery.Event{ContainerID: "id1", ContainerName: "c1", Status: true}
+	down := discovery.Event{ContainerID: "id1", ContainerName: "c1", Reason: discovery.ReasonCrashed}
+
+	assert.True(t, collects(b, up))
+	b.stopped(down)
+	assert.True(t, collects(b, up))
+	b.stopped(down)
+	assert.True(t, collects(b, discovery.Event{ContainerID: "id2", Status: true}), "other container not affected")
+	collect, suppressed := b.started(up)
+	assert.False(t, collect, "third start within window suppressed")
+	assert.True(t, suppressed, "suppressed by this start")
+	b.stopped(down)
+
+	select {
+	case tm := <-b.timers:
+		t.Fatalf("stopped container resumed, %+v", tm)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	up.TS = time.Now()
+	collect, suppressed = b.started(up)
+	assert.False(t, collect, "still suppressed")
+	assert.False(t, suppressed, "suppressed already")
+	select {
+	case tm := <-b.timers:
+		ev, ok := b.resume(tm)
+		require.True(t, ok)
+		assert.Equal(t, up, ev, "last up event resumed")
+	case <-time.After(time.Second):
+		t.Fatal("not resumed")
+	}
+	assert.Empty(t, b.suppressed)
+	assert.True(t, collects(b, up), "starts forgotten after resume")
+	assert.True(t, collects(b, up))
+}
+
+func Test_crashBreakerOutdatedTimer(t *testing.T) {
+	b := newCrashBreaker(1, time.Minute, time.Hour, nil)
+	up := discovery.Event{ContainerID: "id1", Status: true}
+	assert.True(t, collects(b, up))
+	assert.False(t, collects(b, up))
+	_, ok := b.resume(resumeTimer{containerID: "id1", gen: 0})
+	assert.False(t, ok, "outdated timer ignored")
+	_, ok = b.resume(resumeTimer{containerID: "id2", gen: 1})
+	assert.False(t, ok, "unknown container")
+	_, ok = b.resume(resumeTimer{containerID: "id1", gen: b.suppressed["id1"].gen})
+	assert.True(t, ok)
+
+	assert.True(t, collects(b, up), "starts forgotten after resume")
+	assert.False(t, collects(b, up), "suppressed again")
+	b.stopped(discovery.Event{ContainerID: "id1", Reason: discovery.ReasonRemoved})
+	assert.Empty(t, b.suppressed, "removed container forgotten")
+	assert.Empty(t, b.starts)
+}
+
+func Test_crashBreakerWindow(t *testing.T) {
+	b := newCrashBreaker(1, 20*time.Millisecond, time.Hour, nil)
+	up := discovery.Event{ContainerID: "id1", Status: true}
+	assert.True(t, collects(b, up))
+	time.Sleep(30 * time.Millisecond)
+	assert.True(t, collects(b, up), "previous start out of window")
+	assert.True(t, collects(b, discovery.Event{ContainerID: "id2", Status: true}))
+	time.Sleep(30 * time.Millisecond)
+	assert.True(t, collects(b, discovery.Event{ContainerID: "id3", Status: true}))
+	assert.Len(t, b.starts, 1, "old containers pruned")
+}
+
+func Test_crashBreakerDisabled(t *testing.T) {
+	b := newCrashBreaker(0, time.Minute, time.Minute, nil)
+	for i := 0; i < 10; i++ {
+		assert.True(t, collects(b, discovery.Event{ContainerID: "id1", Status: true}))
+	}
+	assert.Nil(t, b.timers)
+}
+
+func Test_crashBreakerStoppedForgotten(t *testing.T) {
+	b := newCrashBreaker(1, 20*time.Millisecond, time.Hour, nil)
+	up := discovery.Event{ContainerID: "id1", Status: true}
+	assert.True(t, collects(b, up))
+	assert.False(t, collects(b, up))
+	b.stopped(discovery.Event{ContainerID: "id1", Reason: discovery.ReasonCrashed})
+	assert.True(t, b.suppressing("id1"), "stopped, destroy not seen")
+
+	time.Sleep(30 * time.Millisecond)
+	assert.True(t, collects(b, up), "stopped for window, forgotten")
+	assert.False(t, b.suppressing("id1"))
+}
+
+// collects returns true if breaker lets container's start collected
+func collects(b *crashBreaker, event discovery.Event) bool {
+	res, _ := b.started(event)
+	return res
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/umputun/docker-logger/app/discovery"
+	"github.com/umputun/docker-logger/app/gelf"
+	"github.com/umputun/docker-logger/app/syslog"
+)
+
+// diagnostics collects results of diagnose checks, printing each to out
+type diagnostics struct {
+	out            io.Writer
+	checks, failed int
+}
+
+// diagnose checks docker hosts, containers collected under current filters, log destinations and sinks,
+// printing report to out. Nothing collected, returns error if any check failed.
+func diagnose(ctx context.Context, opts *cliOpts, filters filterSpec, out io.Writer) error {
+	d := &diagnostics{out: out}
+	if err := setupCollection(opts); err != nil {
+		d.report("options", err, "")
+		return d.summary()
+	}
+	d.docker(opts, filters)
+	if !opts.EnableFiles && !opts.EnableSyslog && !opts.EnableGELF {
+		d.report("logs", errors.New("either files, syslog or gelf has to be enabled"), "")
+	}
+	if opts.EnableFiles {
+		for _, loc := range fileLocations(opts) {
+			d.report("files "+loc, checkWritable(loc), "writable")
+		}
+	}
+	if opts.EnableSyslog {
+		d.report("syslog "+opts.SyslogHost, checkSyslog(opts), "connected, udp delivery not confirmed")
+	}
+	if opts.EnableGELF {
+		details := "connected"
+		if opts.GELFProtocol != "tcp" {
+			details = "connected, udp delivery not confirmed"
+		}
+		d.report("gelf "+opts.GELFHost, checkGELF(opts), details)
+	}
+	d.sinks(ctx, opts)
+	return d.summary()
+}
+
+// docker checks connectivity of each docker host and reports its running containers checked against filters
+func (d *diagnostics) docker(opts *cliOpts, filters filterSpec) {
+	targets, fromContext := opts.DockerHosts, len(opts.Contexts) > 0
+	if fromContext {
+		targets = opts.Contexts
+	}
+	for _, target := range targets {
+		client, host, err := dockerClient(target, fromContext, len(targets) > 1, clientParams(opts))
+		if err != nil {
+			d.report("docker "+target, err, "")
+			continue
+		}
+		env, err := client.Version()
+		if err != nil {
+			d.report("docker "+target, errors.Wrap(err, "can't connect"), "")
+			continue
+		}
+		d.report("docker "+target, nil, fmt.Sprintf("version %s, api %s", env.Get("Version"), env.Get("ApiVersion")))
+
+		notifOpts, err := notifOptions(opts, host)
+		if err != nil {
+			d.report("filters", err, "")
+			continue
+		}
+		res, err := discovery.Diagnose(client, filters.Excludes, filters.Includes, filters.IncludesPattern,
+			filters.ExcludesPattern, notifOpts...)
+		if err != nil {
+			d.report("containers of "+target, err, "")
+			continue
+		}
+		included := res.Included()
+		d.report("containers of "+target, nil, fmt.Sprintf("%d running, %d collected, %d excluded",
+			len(res.Containers), included, len(res.Containers)-included))
+		for _, c := range res.Containers {
+			if c.ExcludedBy != "" {
+				fmt.Fprintf(d.out, "  - %s, excluded by %s\n", c.Name, c.ExcludedBy)
+				continue
+			}
+			fmt.Fprintf(d.out, "  + %s, group %q\n", c.Name, c.Group)
+		}
+	}
+}
+
+// sinks makes enabled event sinks, validating their options, and checks their endpoints accept connections
+func (d *diagnostics) sinks(ctx context.Context, opts *cliOpts) {
+	if opts.OTelEndpoint == "" && opts.WebhookURL == "" && opts.GRPCAddress == "" && opts.SocketPath == "" &&
+		opts.StateDir == "" {
+		return
+	}
+	sinkOpts := *opts
+	sinkOpts.SocketPath = "" // socket sink would replace socket of running collector
+	sinkOpts.StateDir = ""   // state files sink would remove state files of running collector
+	sinks, err := makeEventSinks(ctx, &sinkOpts)
+	if err != nil {
+		d.report("sinks", err, "")
+		return
+	}
+	closeSinks(sinks)
+
+	if opts.OTelEndpoint != "" {
+		d.report("otel "+opts.OTelEndpoint, checkURL(opts.OTelEndpoint), "reachable")
+	}
+	if opts.WebhookURL != "" {
+		d.report("webhook "+opts.WebhookURL, checkURL(opts.WebhookURL), "reachable")
+	}
+	if opts.GRPCAddress != "" {
+		d.report("grpc "+opts.GRPCAddress, checkDial(opts.GRPCAddress), "reachable")
+	}
+	if opts.SocketPath != "" {
+		d.report("socket "+opts.SocketPath, checkWritable(filepath.Dir(opts.SocketPath)), "directory writable")
+	}
+	if opts.StateDir != "" {
+		d.report("state files "+opts.StateDir, checkWritable(opts.StateDir), "writable")
+	}
+}
+
+// report prints result of a single check
+func (d *diagnostics) report(check string, err error, details string) {
+	d.checks++
+	if err != nil {
+		d.failed++
+		fmt.Fprintf(d.out, "%s: failed, %v\n", check, err)
+		return
+	}
+	fmt.Fprintf(d.out, "%s: ok, %s\n", check, details)
+}
+
+// summary prints number of failed checks and returns error if any failed
+func (d *diagnostics) summary() error {
+	if d.failed > 0 {
+		fmt.Fprintf(d.out, "diagnostics: %d of %d checks failed\n", d.failed, d.checks)
+		return errors.Errorf("%d of %d diagnostics checks failed", d.failed, d.checks)
+	}
+	fmt.Fprintf(d.out, "diagnostics: all %d checks passed\n", d.checks)
+	return nil
+}
+
+// checkSyslog connects to syslog host
+func checkSyslog(opts *cliOpts) error {
+	if !syslog.IsSupported() {
+		return errors.New("syslog not supported on this platform")
+	}
+	wr, err := syslog.GetWriter(opts.SyslogHost, opts.SyslogPrefix, "docker-logger")
+	if err != nil {
+		return errors.Wrap(err, "can't connect")
+	}
+	return wr.Close()
+}
+
+// checkGELF checks gelf options and connects to gelf input. Tcp input dialed explicitly, as gelf writer
+// connects on the first message.
+func checkGELF(opts *cliOpts) error {
+	wr, err := gelf.NewWriter(gelf.Params{Address: opts.GELFHost, Protocol: opts.GELFProtocol, Compress: opts.GELFCompress,
+		ChunkSize: opts.GELFChunk}, nil)
+	if err != nil {
+		return err
+	}
+	if err := wr.Close(); err != nil {
+		return err
+	}
+	if opts.GELFProtocol == "tcp" {
+		return checkDial(opts.GELFHost)
+	}
+	return nil
+}
+
+// checkURL checks host of http url accepts connections
+func checkURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return errors.Wrap(err, "invalid url")
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return checkDial(net.JoinHostPort(u.Hostname(), port))
+}
+
+// checkDial checks tcp address accepts connections
+func checkDial(address string) error {
+	conn, err := net.DialTimeout("tcp", address, 5*time.Second)
+	if err != nil {
+		return errors.Wrap(err, "can't connect")
+	}
+	return conn.Close()
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/jessevdk/go-flags"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_diagnose(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/version":
+			_ = json.NewEncoder(w).Encode(map[string]string{"Version": "24.0.7", "ApiVersion": "1.43"})
+		case "/containers/json":
+			_ = json.NewEncoder(w).Encode([]dockerclient.APIContainers{
+				{ID: "id1", Names: []string{"/web"}, Image: "umputun/system/web"},
+				{ID: "id2", Names: []string{"/db"}, Image: "postgres"},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	opts := diagnoseOpts(t, "--docker=tcp://"+ts.Listener.Addr().String(), "--files", "--loc="+filepath.Join(dir, "logs"),
+		"--webhook-url="+ts.URL+"/hook", "--socket-path="+filepath.Join(dir, "events.sock"))
+	out := &bytes.Buffer{}
+	require.NoError(t, diagnose(context.Background(), opts, filterSpec{Excludes: []string{"db"}}, out))
+	assert.Equal(t, "docker "+opts.DockerHosts[0]+": ok, version 24.0.7, api 1.43\n"+
+		"containers of "+opts.DockerHosts[0]+": ok, 2 running, 1 collected, 1 excluded\n"+
+		"  + web, group \"system\"\n"+
+		"  - db, excluded by name filter\n"+
+		"files "+opts.FilesLocation+": ok, writable\n"+
+		"webhook "+opts.WebhookURL+": ok, reachable\n"+
+		"socket "+opts.SocketPath+": ok, directory writable\n"+
+		"diagnostics: all 5 checks passed\n", out.String())
+	_, err := os.Stat(opts.SocketPath)
+	assert.True(t, os.IsNotExist(err), "socket not made")
+}
+
+func Test_diagnoseFailed(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closed := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	require.NoError(t, os.WriteFile(file, []byte("data"), 0o600))
+	opts := diagnoseOpts(t, "--docker=tcp://"+closed, "--files", "--loc="+filepath.Join(file, "logs"),
+		"--grpc-address="+closed, "--grpc-plaintext")
+	out := &bytes.Buffer{}
+	err = diagnose(context.Background(), opts, filterSpec{}, out)
+	assert.EqualError(t, err, "3 of 3 diagnostics checks failed")
+	assert.Contains(t, out.String(), "docker tcp://"+closed+": failed, can't connect")
+	assert.Contains(t, out.String(), "files "+opts.FilesLocation+": failed, can't make directory")
+	assert.Contains(t, out.String(), "grpc "+closed+": failed, can't connect")
+
+	out.Reset()
+	err = diagnose(context.Background(), diagnoseOpts(t, "--files", "--group-files=bad"), filterSpec{}, out)
+	assert.EqualError(t, err, "1 of 1 diagnostics checks failed")
+	assert.Contains(t, out.String(), "options: failed, could not parse group files")
+
+	out.Reset()
+	err = diagnose(context.Background(), diagnoseOpts(t, "--docker="), filterSpec{}, out)
+	assert.EqualError(t, err, "2 of 2 diagnostics checks failed")
+	assert.Equal(t, "docker : failed, invalid endpoint\nlogs: failed, either files, syslog or gelf has to be enabled\n"+
+		"diagnostics: 2 of 2 checks failed\n", out.String())
+}
+
+// diagnoseOpts makes options with defaults, as parsed from command line
+func diagnoseOpts(t *testing.T, args ...string) *cliOpts {
+	opts := &cliOpts{}
+	_, err := flags.ParseArgs(opts, args)
+	require.NoError(t, err)
+	return opts
+}
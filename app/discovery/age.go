@@ -0,0 +1,49 @@
+package discovery
+
+import (
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// WithMaxEventAge makes docker events older than age, by event's time, dropped and counted as stale. Applied to
+// events of Replay, so a long recording doesn't produce a deluge of ancient starts and stops, and to live events
+// too if live set, i.e. delivered late after daemon stall. Initial scan and resync not affected, as those report
+// current state of containers. Events with no time never dropped. Disabled by default.
+func WithMaxEventAge(age time.Duration, live bool) Option {
+	return func(e *EventNotif) {
+		e.maxEventAge = age
+		e.ageLive = live
+	}
+}
+
+// isStale checks if docker event is older than max event age, for replayed events or live ones with ageLive
+func (e *EventNotif) isStale(dockerEvent *docker.APIEvents) bool {
+	if e.maxEventAge <= 0 || (!e.replaying && !e.ageLive) {
+		return false
+	}
+	ts, ok := eventTime(dockerEvent)
+	if !ok {
+		return false // no time, can't tell
+	}
+	if age := time.Since(ts); age > e.maxEventAge {
+		e.log().Logf("[DEBUG] %s %s event of %s dropped, %v old", dockerEvent.Type, dockerEvent.Status, dockerEvent.Actor.ID,
+			age.Truncate(time.Second))
+		e.trackLock.Lock()
+		e.stats.stale++
+		e.trackLock.Unlock()
+		return true
+	}
+	return false
+}
+
+// eventTime returns time of docker event, false if event has no time
+func eventTime(dockerEvent *docker.APIEvents) (time.Time, bool) {
+	switch {
+	case dockerEvent.TimeNano > 0:
+		return time.Unix(0, dockerEvent.TimeNano), true
+	case dockerEvent.Time > 0:
+		return time.Unix(dockerEvent.Time, 0), true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,83 @@
+package discovery
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxEventAgeReplay(t *testing.T) {
+	now := time.Now()
+	buf := bytes.Buffer{}
+	rec := NewRawEventRecorder(&buf)
+	for _, ev := range []*dockerclient.APIEvents{
+		{Type: "container", Status: "start", TimeNano: now.Add(-48 * time.Hour).UnixNano(),
+			Actor: dockerclient.APIActor{ID: "id1", Attributes: map[string]string{"name": "old-nano"}}},
+		{Type: "container", Status: "start", Time: now.Add(-2 * time.Hour).Unix(),
+			Actor: dockerclient.APIActor{ID: "id2", Attributes: map[string]string{"name": "old-sec"}}},
+		{Type: "container", Status: "start", TimeNano: now.Add(-time.Minute).UnixNano(),
+			Actor: dockerclient.APIActor{ID: "id3", Attributes: map[string]string{"name": "recent"}}},
+		{Type: "container", Status: "start", Actor: dockerclient.APIActor{ID: "id4", Attributes: map[string]string{"name": "no-time"}}},
+	} {
+		require.NoError(t, rec.Record(ev))
+	}
+
+	replayed := func(opts ...Option) (names []string, st Stats) {
+		replay, err := Replay(bytes.NewReader(buf.Bytes()), nil, nil, "", "", opts...)
+		require.NoError(t, err)
+		for ev := range replay.Channel() {
+			names = append(names, ev.ContainerName)
+		}
+		return names, replay.Stats()
+	}
+
+	names, st := replayed()
+	assert.Equal(t, []string{"old-nano", "old-sec", "recent", "no-time"}, names, "disabled by default")
+	assert.Equal(t, 0, st.Stale)
+
+	names, st = replayed(WithMaxEventAge(time.Hour, false))
+	assert.Equal(t, []string{"recent", "no-time"}, names)
+	assert.Equal(t, 2, st.Stale)
+	assert.Equal(t, 2, st.Up)
+
+	names, st = replayed(WithMaxEventAge(72*time.Hour, false))
+	assert.Len(t, names, 4, "all within age")
+	assert.Equal(t, 0, st.Stale)
+}
+
+func TestMaxEventAgeLive(t *testing.T) {
+	send := func(client *mockDockerClient) {
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "start", TimeNano: time.Now().Add(-time.Hour).UnixNano(),
+			Actor: dockerclient.APIActor{ID: "id1", Attributes: map[string]string{"name": "late"}}})
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "start", TimeNano: time.Now().UnixNano(),
+			Actor: dockerclient.APIActor{ID: "id2", Attributes: map[string]string{"name": "fresh"}}})
+	}
+
+	client := &mockDockerClient{}
+	events, err := NewEventNotif(client, nil, nil, "", "", WithMaxEventAge(time.Minute, false))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, 5*time.Millisecond)
+	go send(client)
+	assert.Equal(t, "late", (<-events.Channel()).ContainerName, "live events not affected by default")
+	assert.Equal(t, "fresh", (<-events.Channel()).ContainerName)
+
+	client = &mockDockerClient{}
+	events, err = NewEventNotif(client, nil, nil, "", "", WithMaxEventAge(time.Minute, true))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, 5*time.Millisecond)
+	go send(client)
+	assert.Equal(t, "fresh", (<-events.Channel()).ContainerName, "late live event dropped")
+	assert.Equal(t, 1, events.Stats().Stale)
+}
+
+func TestMaxEventAgeScan(t *testing.T) {
+	client := &mockDockerClient{containers: []dockerclient.APIContainers{
+		{ID: "id1", Names: []string{"/web"}, Created: time.Now().Add(-48 * time.Hour).Unix()}}}
+	events, err := NewEventNotif(client, nil, nil, "", "", WithMaxEventAge(time.Minute, true))
+	require.NoError(t, err)
+	assert.Equal(t, "web", (<-events.Channel()).ContainerName, "initial scan reports current state, never stale")
+}
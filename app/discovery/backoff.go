@@ -0,0 +1,59 @@
+package discovery
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Jitter defines how random spread applied to backoff delays
+type Jitter int
+
+// enum of all supported jitter modes
+const (
+	NoJitter           Jitter = iota // plain exponential delays, deterministic
+	FullJitter                       // random delay between 0 and exponential delay
+	DecorrelatedJitter               // random delay between Min and 3x of the previous delay
+)
+
+// Backoff defines delays between reconnection attempts to docker events api
+type Backoff struct {
+	Min    time.Duration // initial delay
+	Max    time.Duration // upper bound for delay
+	Jitter Jitter        // jitter mode, spreads reconnects of many instances hitting the same daemon
+}
+
+// delay returns duration to wait before the given attempt (starting from 0). prev is the delay returned for previous
+// attempt, used by decorrelated jitter only.
+func (b Backoff) delay(attempt int, prev time.Duration) time.Duration {
+	if b.Min <= 0 {
+		return 0
+	}
+	maxDelay := b.Max
+	if maxDelay < b.Min {
+		maxDelay = b.Min
+	}
+
+	exp := b.Min
+	for i := 0; i < attempt && exp < maxDelay; i++ {
+		exp *= 2
+	}
+	if exp > maxDelay {
+		exp = maxDelay
+	}
+
+	switch b.Jitter {
+	case FullJitter:
+		return time.Duration(rand.Int63n(int64(exp) + 1)) //nolint:gosec // no need for crypto rand here
+	case DecorrelatedJitter:
+		if prev < b.Min {
+			prev = b.Min
+		}
+		upper := prev * 3
+		if upper > maxDelay {
+			upper = maxDelay
+		}
+		return b.Min + time.Duration(rand.Int63n(int64(upper-b.Min)+1)) //nolint:gosec // no need for crypto rand here
+	default:
+		return exp
+	}
+}
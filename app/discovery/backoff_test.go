@@ -0,0 +1,49 @@
+package discovery
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff_NoJitter(t *testing.T) {
+	b := Backoff{Min: time.Second, Max: 10 * time.Second, Jitter: NoJitter}
+	var prev time.Duration
+	res := []time.Duration{}
+	for i := 0; i < 6; i++ {
+		prev = b.delay(i, prev)
+		res = append(res, prev)
+	}
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second,
+		10 * time.Second, 10 * time.Second}, res)
+
+	assert.Equal(t, time.Duration(0), Backoff{}.delay(5, 0), "zero backoff")
+}
+
+func TestBackoff_FullJitter(t *testing.T) {
+	b := Backoff{Min: time.Second, Max: 10 * time.Second, Jitter: FullJitter}
+	for i := 0; i < 100; i++ {
+		d := b.delay(2, 0)
+		assert.True(t, d >= 0 && d <= 4*time.Second, d)
+		d = b.delay(20, 0)
+		assert.True(t, d >= 0 && d <= 10*time.Second, d)
+	}
+}
+
+func TestBackoff_DecorrelatedJitter(t *testing.T) {
+	b := Backoff{Min: time.Second, Max: 10 * time.Second, Jitter: DecorrelatedJitter}
+	var prev time.Duration
+	for i := 0; i < 100; i++ {
+		d := b.delay(i, prev)
+		upper := 3 * prev
+		if upper < time.Second {
+			upper = 3 * time.Second
+		}
+		if upper > 10*time.Second {
+			upper = 10 * time.Second
+		}
+		assert.True(t, d >= time.Second && d <= upper, "delay %v, prev %v", d, prev)
+		prev = d
+	}
+}
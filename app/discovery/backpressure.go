@@ -0,0 +1,49 @@
+package discovery
+
+import (
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// listenerBuffer is the size of docker events listener buffer. Docker client drops events the listener not ready
+// to receive right away, so the buffer absorbs bursts while emit waits for a slow consumer.
+const listenerBuffer = 1000
+
+// send delivers event to subscriptions and eventsCh, waiting for the consumer if the channel is full. This way
+// a consumer not reading the channel, i.e. busy opening log streams, paces discovery instead of events being
+// dropped. Sends serialized, so with WithSequence events delivered in order of assigned Seq.
+func (e *EventNotif) send(event Event) {
+	e.sendLock.Lock()
+	defer e.sendLock.Unlock()
+	if e.withSeq {
+		e.seq++
+		event.Seq = e.seq
+	}
+	e.publish(event)
+	select {
+	case e.eventsCh <- event:
+		return
+	default:
+	}
+	e.trackLock.Lock()
+	e.stats.stalls++
+	e.trackLock.Unlock()
+	e.log().Logf("[DEBUG] events channel full, waiting for consumer")
+	e.waitConsumer(event)
+}
+
+// overflowed checks if listener buffer is full, i.e. docker client might have dropped events sent meanwhile
+func overflowed(dockerEventsCh <-chan *docker.APIEvents) bool {
+	return cap(dockerEventsCh) > 0 && len(dockerEventsCh) == cap(dockerEventsCh)
+}
+
+// recoverOverflow resyncs containers state after listener buffer overflow, to catch up with events dropped
+// by docker client. Called by listener once the buffer drained.
+func (e *EventNotif) recoverOverflow() {
+	e.trackLock.Lock()
+	e.stats.overflows++
+	e.trackLock.Unlock()
+	e.log().Logf("[WARN] docker events listener overflowed, consumer too slow, resync")
+	if err := e.resync(); err != nil {
+		e.log().Logf("[WARN] resync failed, %v", err)
+	}
+}
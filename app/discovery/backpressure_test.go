@@ -0,0 +1,94 @@
+package discovery
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendWaitsForConsumer(t *testing.T) {
+	client := &mockDockerClient{}
+	events, err := NewEventNotif(client, nil, nil, "", "")
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, 5*time.Millisecond)
+
+	go func() {
+		for i := 0; i < eventsBuffer+10; i++ {
+			client.add(fmt.Sprintf("id%d", i), fmt.Sprintf("name%d", i))
+		}
+	}()
+	require.Eventually(t, func() bool { return events.Stats().Stalls == 1 }, time.Second, 5*time.Millisecond,
+		"emit waits on full channel")
+	assert.Len(t, events.Channel(), eventsBuffer)
+
+	for i := 0; i < eventsBuffer+10; i++ {
+		ev := <-events.Channel()
+		assert.Equal(t, fmt.Sprintf("id%d", i), ev.ContainerID, "nothing dropped")
+	}
+	assert.GreaterOrEqual(t, events.Stats().Stalls, 1)
+	assert.Equal(t, 0, events.Stats().Overflows)
+}
+
+// TestBackpressureStress pushes more events than listener buffer can hold to a stalled consumer, with docker
+// client dropping events the listener can't take, and checks the consumer catches up with all containers.
+func TestBackpressureStress(t *testing.T) {
+	if testing.Short() {
+		t.Skip("stress test")
+	}
+	const total = 3 * listenerBuffer
+	client := &mockDockerClient{}
+	events, err := NewEventNotif(client, nil, nil, "", "")
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, 5*time.Millisecond)
+
+	var dropped int
+	for i := 0; i < total; i++ {
+		if !client.trySend(fmt.Sprintf("id%04d", i), fmt.Sprintf("name%04d", i)) {
+			dropped++
+		}
+	}
+	require.Positive(t, dropped, "docker client dropped events of stalled listener")
+	t.Logf("dropped %d of %d events", dropped, total)
+
+	up := map[string]bool{}
+	timeout := time.After(30 * time.Second)
+	for len(up) < total {
+		select {
+		case ev := <-events.Channel():
+			require.True(t, ev.Status)
+			assert.False(t, up[ev.ContainerID], "no duplicates for %s", ev.ContainerID)
+			up[ev.ContainerID] = true
+			if len(up)%100 == 0 {
+				time.Sleep(time.Millisecond) // slow consumer
+			}
+		case <-timeout:
+			t.Fatalf("only %d of %d containers received", len(up), total)
+		}
+	}
+
+	st := events.Stats()
+	assert.Equal(t, total, st.Tracked)
+	assert.Equal(t, total, st.Up)
+	assert.GreaterOrEqual(t, st.Stalls, 1)
+	assert.GreaterOrEqual(t, st.Overflows, 1)
+}
+
+// trySend adds running container and sends its start event without waiting, as docker client does,
+// returns false if listener wasn't ready and the event dropped
+func (m *mockDockerClient) trySend(id, name string) bool {
+	m.Lock()
+	defer m.Unlock()
+	m.containers = append(m.containers, dockerclient.APIContainers{ID: id, Names: []string{"/" + name}})
+	ev := &dockerclient.APIEvents{Type: "container", Status: "start",
+		Actor: dockerclient.APIActor{ID: id, Attributes: map[string]string{"name": name}}}
+	select {
+	case m.events <- ev:
+		return true
+	default:
+		return false
+	}
+}
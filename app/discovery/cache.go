@@ -0,0 +1,71 @@
+package discovery
+
+import (
+	"container/list"
+	"sync"
+)
+
+// WithDecisionCache enables LRU cache of allow/deny decisions by container name, bounded by size.
+// Saves regexp matching on hosts with high events rate. Cache invalidated by UpdateFilters.
+func WithDecisionCache(size int) Option {
+	return func(e *EventNotif) {
+		if size > 0 {
+			e.decisions = newDecisionCache(size)
+		}
+	}
+}
+
+// decisionCache is LRU cache of filter decisions, entries made for other filters version treated as missing
+type decisionCache struct {
+	lock  sync.Mutex
+	size  int
+	order *list.List // front is the most recently used
+	items map[string]*list.Element
+}
+
+type decision struct {
+	name    string
+	version int
+	allowed bool
+}
+
+func newDecisionCache(size int) *decisionCache {
+	return &decisionCache{size: size, order: list.New(), items: make(map[string]*list.Element, size)}
+}
+
+func (c *decisionCache) get(name string, version int) (allowed, ok bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	elem, found := c.items[name]
+	if !found {
+		return false, false
+	}
+	d := elem.Value.(*decision)
+	if d.version != version {
+		return false, false
+	}
+	c.order.MoveToFront(elem)
+	return d.allowed, true
+}
+
+func (c *decisionCache) put(name string, version int, allowed bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if elem, found := c.items[name]; found {
+		elem.Value = &decision{name: name, version: version, allowed: allowed}
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.items[name] = c.order.PushFront(&decision{name: name, version: version, allowed: allowed})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*decision).name)
+	}
+}
+
+func (c *decisionCache) len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.order.Len()
+}
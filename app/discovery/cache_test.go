@@ -0,0 +1,68 @@
+package discovery
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecisionCache(t *testing.T) {
+	c := newDecisionCache(2)
+	_, ok := c.get("c1", 0)
+	assert.False(t, ok)
+
+	c.put("c1", 0, true)
+	c.put("c2", 0, false)
+	res, ok := c.get("c1", 0)
+	assert.True(t, ok)
+	assert.True(t, res)
+
+	c.put("c3", 0, true) // evicts c2, c1 used recently
+	assert.Equal(t, 2, c.len())
+	_, ok = c.get("c2", 0)
+	assert.False(t, ok)
+	_, ok = c.get("c1", 0)
+	assert.True(t, ok)
+
+	_, ok = c.get("c1", 1)
+	assert.False(t, ok, "other filters version")
+	c.put("c1", 1, false)
+	res, ok = c.get("c1", 1)
+	assert.True(t, ok)
+	assert.False(t, res)
+	assert.Equal(t, 2, c.len())
+}
+
+func TestWithDecisionCacheDisabled(t *testing.T) {
+	e, err := NewEventNotif(&mockDockerClient{}, nil, nil, "", "", WithDecisionCache(0))
+	assert.NoError(t, err)
+	assert.Nil(t, e.decisions)
+	assert.True(t, e.isAllowed("c1"))
+}
+
+func BenchmarkIsAllowed(b *testing.B) {
+	names := make([]string, 200) // synthetic high-rate stream over a set of containers
+	for i := range names {
+		names[i] = fmt.Sprintf("service-%d-worker-%d", i%20, i)
+	}
+	pattern := `^(service-1[0-9]|service-[2-5])-worker-\d+$`
+
+	b.Run("no cache", func(b *testing.B) {
+		e, err := NewEventNotif(&mockDockerClient{}, nil, nil, pattern, "")
+		assert.NoError(b, err)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			e.isAllowed(names[i%len(names)])
+		}
+	})
+
+	b.Run("cache", func(b *testing.B) {
+		e, err := NewEventNotif(&mockDockerClient{}, nil, nil, pattern, "", WithDecisionCache(1000))
+		assert.NoError(b, err)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			e.isAllowed(names[i%len(names)])
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package discovery
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/pkg/errors"
+)
+
+// ClientParams tune http client of docker api. Two kinds of calls go through it: control calls, i.e. list, inspect,
+// version and non-follow logs, short by nature and limited by Timeout, and streaming calls, follow of logs, events,
+// attach and wait, which last as long as container runs and never limited by Timeout, as any limit would tear down
+// healthy streams. Stuck streams handled by read timeout of log streamer instead.
+// Zero params keep go-dockerclient defaults: no timeout, no connections limit and no keep-alive.
+type ClientParams struct {
+	Timeout time.Duration // limit of each control call, 0 for none
+
+	// MaxConns limits connections per docker host, 0 for unlimited. Over tcp each follow of logs holds a connection
+	// for its lifetime, so the limit should be above number of followed containers, otherwise new follows wait for
+	// a free connection. Follows over unix socket dial own connections and limited by nothing.
+	MaxConns int
+
+	// IdleConns is number of idle connections kept for reuse by control calls, 0 disables keep-alive
+	IdleConns int
+}
+
+// Validate checks params are not negative and idle connections within connections limit
+func (p ClientParams) Validate() error {
+	if p.Timeout < 0 {
+		return errors.Errorf("invalid docker client timeout %v", p.Timeout)
+	}
+	if p.MaxConns < 0 {
+		return errors.Errorf("invalid docker client max connections %d", p.MaxConns)
+	}
+	if p.IdleConns < 0 {
+		return errors.Errorf("invalid docker client idle connections %d", p.IdleConns)
+	}
+	if p.MaxConns > 0 && p.IdleConns > p.MaxConns {
+		return errors.Errorf("docker client idle connections %d above max connections %d", p.IdleConns, p.MaxConns)
+	}
+	return nil
+}
+
+// NewDockerClient makes docker client of endpoint, i.e. unix:///var/run/docker.sock, with http client tuned by params
+func NewDockerClient(endpoint string, params ClientParams) (*docker.Client, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	client, err := docker.NewClient(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if err = params.apply(client); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// apply sets connection limits and control calls timeout to client's transport
+func (p ClientParams) apply(client *docker.Client) error {
+	if p == (ClientParams{}) {
+		return nil
+	}
+	tr, ok := client.HTTPClient.Transport.(*http.Transport)
+	if !ok {
+		return errors.Errorf("unsupported transport %T of docker client", client.HTTPClient.Transport)
+	}
+	tr.MaxConnsPerHost = p.MaxConns
+	if p.IdleConns > 0 {
+		tr.DisableKeepAlives, tr.MaxIdleConnsPerHost = false, p.IdleConns
+	}
+	if p.Timeout > 0 {
+		client.HTTPClient.Transport = &controlTransport{next: tr, timeout: p.Timeout}
+	}
+	return nil
+}
+
+// controlTransport limits control calls by timeout, passing streaming calls as is.
+// Can't be done with http.Client.Timeout, as go-dockerclient streams logs over tcp with the same http client.
+type controlTransport struct {
+	next    http.RoundTripper
+	timeout time.Duration
+}
+
+// RoundTrip makes request with timeout covering reading of response body, unless request is streaming
+func (t *controlTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if isStreaming(req) {
+		return t.next.RoundTrip(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// isStreaming checks if request is long-lived api call, i.e. follow of logs or events
+func isStreaming(req *http.Request) bool {
+	query := req.URL.Query()
+	for _, key := range []string{"follow", "stream"} {
+		if v := query.Get(key); v == "1" || v == "true" {
+			return true
+		}
+	}
+	for _, suffix := range []string{"/events", "/attach", "/wait"} {
+		if strings.HasSuffix(req.URL.Path, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// cancelBody releases timeout context of control call once its response body closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the body and cancels the context
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,113 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientParamsValidate(t *testing.T) {
+	tbl := []struct {
+		params ClientParams
+		err    string
+	}{
+		{params: ClientParams{}},
+		{params: ClientParams{Timeout: time.Second, MaxConns: 10, IdleConns: 10}},
+		{params: ClientParams{IdleConns: 10}},
+		{params: ClientParams{Timeout: -time.Second}, err: "invalid docker client timeout -1s"},
+		{params: ClientParams{MaxConns: -1}, err: "invalid docker client max connections -1"},
+		{params: ClientParams{IdleConns: -1}, err: "invalid docker client idle connections -1"},
+		{params: ClientParams{MaxConns: 2, IdleConns: 3}, err: "docker client idle connections 3 above max connections 2"},
+	}
+	for _, tt := range tbl {
+		err := tt.params.Validate()
+		if tt.err == "" {
+			assert.NoError(t, err, "%+v", tt.params)
+			continue
+		}
+		assert.EqualError(t, err, tt.err)
+	}
+}
+
+func TestNewDockerClient(t *testing.T) {
+	client, err := NewDockerClient("tcp://10.0.0.1:2375", ClientParams{MaxConns: 50, IdleConns: 4})
+	require.NoError(t, err)
+	tr, ok := client.HTTPClient.Transport.(*http.Transport)
+	require.True(t, ok, "no control transport without timeout")
+	assert.Equal(t, 50, tr.MaxConnsPerHost)
+	assert.Equal(t, 4, tr.MaxIdleConnsPerHost)
+	assert.False(t, tr.DisableKeepAlives)
+
+	client, err = NewDockerClient("unix:///var/run/docker.sock", ClientParams{Timeout: time.Second})
+	require.NoError(t, err)
+	assert.IsType(t, &controlTransport{}, client.HTTPClient.Transport)
+
+	client, err = NewDockerClient("tcp://10.0.0.1:2375", ClientParams{})
+	require.NoError(t, err)
+	tr, ok = client.HTTPClient.Transport.(*http.Transport)
+	require.True(t, ok)
+	assert.True(t, tr.DisableKeepAlives, "defaults kept")
+
+	_, err = NewDockerClient("tcp://10.0.0.1:2375", ClientParams{MaxConns: -1})
+	require.Error(t, err)
+	_, err = NewDockerClient("://bad", ClientParams{})
+	assert.EqualError(t, err, "invalid endpoint")
+}
+
+func TestNewDockerClientTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		if strings.HasSuffix(r.URL.Path, "/logs") {
+			_, _ = w.Write([]byte("line\n"))
+			return
+		}
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+
+	client, err := NewDockerClient(strings.Replace(srv.URL, "http://", "tcp://", 1), ClientParams{Timeout: 50 * time.Millisecond})
+	require.NoError(t, err)
+	_, err = client.ListContainers(docker.ListContainersOptions{})
+	require.Error(t, err, "control call limited")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	buf := bytes.Buffer{}
+	err = client.Logs(docker.LogsOptions{Container: "c1", Follow: true, Stdout: true, RawTerminal: true, OutputStream: &buf})
+	require.NoError(t, err, "streaming call not limited")
+	assert.Equal(t, "line\n", buf.String())
+
+	client, err = NewDockerClient(strings.Replace(srv.URL, "http://", "tcp://", 1), ClientParams{Timeout: time.Second})
+	require.NoError(t, err)
+	containers, err := client.ListContainers(docker.ListContainersOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, containers)
+}
+
+func TestIsStreaming(t *testing.T) {
+	tbl := []struct {
+		url  string
+		want bool
+	}{
+		{"/containers/json", false},
+		{"/containers/c1/json", false},
+		{"/containers/c1/logs?stdout=1&tail=10", false},
+		{"/containers/c1/logs?follow=1&stdout=1", true},
+		{"/containers/c1/stats?stream=true", true},
+		{"/containers/c1/stats?stream=false", false},
+		{"/events?since=1", true},
+		{"/containers/c1/attach?stream=1", true},
+		{"/containers/c1/wait", true},
+	}
+	for _, tt := range tbl {
+		req := httptest.NewRequest(http.MethodGet, tt.url, http.NoBody)
+		assert.Equal(t, tt.want, isStreaming(req), tt.url)
+	}
+}
@@ -0,0 +1,78 @@
+package discovery
+
+import (
+	"time"
+)
+
+// coalescePrune is the number of tracked bursts triggering removal of expired ones
+const coalescePrune = 1000
+
+// WithCoalesce sets windows coalescing bursts of live up and down events of a container, separately for each class.
+// Within window since the first event of a class, later events of the same class dropped, so die and stop burst
+// makes a single down event, the die one with exit reason. Destroy never dropped, as consumers forget removed
+// container on its ReasonRemoved, and ends container's bursts. Event of the other class always passes and starts
+// coalescing over, so quick restart never lost. I.e. long down window dedups teardown bursts aggressively while
+// zero up window keeps starts untouched. Windows measured by docker's time of events. Initial scan and resync not
+// affected. Zero window disables coalescing of the class, default for both.
+func WithCoalesce(up, down time.Duration) Option {
+	return func(e *EventNotif) {
+		e.coalesceUp, e.coalesceDown = up, down
+	}
+}
+
+// coalesceKey identifies burst of container's events of the same class
+type coalesceKey struct {
+	containerID string
+	up          bool
+}
+
+// coalesced checks if container's event of up or down class falls into the window of the class since its first
+// event, i.e. should be dropped. Event passed starts the burst of its class and ends the burst of the other one.
+// Called by listener only.
+func (e *EventNotif) coalesced(containerID string, up bool, ts time.Time) bool {
+	if e.coalesceUp <= 0 && e.coalesceDown <= 0 {
+		return false
+	}
+	if e.bursts == nil {
+		e.bursts = map[coalesceKey]time.Time{}
+	}
+	window := e.coalesceDown
+	if up {
+		window = e.coalesceUp
+	}
+	key := coalesceKey{containerID: containerID, up: up}
+	if started, ok := e.bursts[key]; ok && window > 0 && ts.Sub(started) < window {
+		e.trackLock.Lock()
+		e.stats.coalesced++
+		e.trackLock.Unlock()
+		return true
+	}
+	delete(e.bursts, coalesceKey{containerID: containerID, up: !up})
+	if window <= 0 {
+		return false
+	}
+	if len(e.bursts) >= coalescePrune {
+		e.pruneBursts(ts)
+	}
+	e.bursts[key] = ts
+	return false
+}
+
+// forgetBursts removes bursts of removed container
+func (e *EventNotif) forgetBursts(containerID string) {
+	delete(e.bursts, coalesceKey{containerID: containerID, up: true})
+	delete(e.bursts, coalesceKey{containerID: containerID, up: false})
+}
+
+// pruneBursts removes bursts with expired windows
+func (e *EventNotif) pruneBursts(now time.Time) {
+	for key, started := range e.bursts {
+		window := e.coalesceDown
+		if key.up {
+			window = e.coalesceUp
+		}
+		if now.Sub(started) >= window {
+			delete(e.bursts, key)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package discovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoalesceMixedBursts(t *testing.T) {
+	t0 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	type rec struct {
+		id, status string
+		at         time.Duration
+	}
+	events := []rec{
+		{"c1", "die", 0}, {"c2", "start", 5 * time.Millisecond}, {"c1", "stop", 10 * time.Millisecond},
+		{"c1", "destroy", 20 * time.Millisecond}, {"c2", "restart", 25 * time.Millisecond},
+		{"c1", "start", 30 * time.Millisecond}, {"c1", "die", 40 * time.Millisecond}, {"c2", "die", 50 * time.Millisecond},
+		{"c1", "destroy", 2 * time.Second}, {"c2", "start", 3 * time.Second},
+	}
+	var lines []string
+	for _, ev := range events {
+		data, err := json.Marshal(dockerclient.APIEvents{Type: "container", Status: ev.status, TimeNano: t0.Add(ev.at).UnixNano(),
+			Actor: dockerclient.APIActor{ID: ev.id, Attributes: map[string]string{"name": ev.id}}})
+		require.NoError(t, err)
+		lines = append(lines, string(data))
+	}
+
+	tbl := []struct {
+		name      string
+		up, down  time.Duration
+		split     bool
+		want      []string
+		coalesced int
+	}{
+		{name: "disabled", want: []string{"c1 down", "c2 up", "c1 down", "c1 down", "c2 up", "c1 up", "c1 down", "c2 down",
+			"c1 down", "c2 up"}},
+		{name: "down only", down: time.Second,
+			want: []string{"c1 down", "c2 up", "c1 down", "c2 up", "c1 up", "c1 down", "c2 down", "c1 down", "c2 up"}, coalesced: 1},
+		{name: "up and down", up: time.Second, down: time.Second,
+			want: []string{"c1 down", "c2 up", "c1 down", "c1 up", "c1 down", "c2 down", "c1 down", "c2 up"}, coalesced: 2},
+		{name: "long down", down: time.Hour,
+			want: []string{"c1 down", "c2 up", "c1 down", "c2 up", "c1 up", "c1 down", "c2 down", "c1 down", "c2 up"}, coalesced: 1},
+		{name: "up with split restart", up: time.Second, split: true,
+			want:      []string{"c1 down", "c2 up", "c1 down", "c1 down", "c1 up", "c1 down", "c2 down", "c1 down", "c2 up"},
+			coalesced: 1},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []Option{WithCoalesce(tt.up, tt.down)}
+			if tt.split {
+				opts = append(opts, WithSplitRestart())
+			}
+			replay, err := Replay(strings.NewReader(strings.Join(lines, "\n")), nil, nil, "", "", opts...)
+			require.NoError(t, err)
+			var res []string
+			for ev := range replay.Channel() {
+				status := "down"
+				if ev.Status {
+					status = "up"
+				}
+				res = append(res, ev.ContainerName+" "+status)
+			}
+			assert.Equal(t, tt.want, res)
+			assert.Equal(t, tt.coalesced, replay.Stats().Coalesced)
+		})
+	}
+}
+
+func TestCoalesceDestroyDelivered(t *testing.T) {
+	t0 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	var lines []string
+	for i, status := range []string{"die", "stop", "destroy", "die"} {
+		data, err := json.Marshal(dockerclient.APIEvents{Type: "container", Status: status,
+			TimeNano: t0.Add(time.Duration(i) * time.Millisecond).UnixNano(),
+			Actor:    dockerclient.APIActor{ID: "c1", Attributes: map[string]string{"name": "c1", "exitCode": "0"}}})
+		require.NoError(t, err)
+		lines = append(lines, string(data))
+	}
+	replay, err := Replay(strings.NewReader(strings.Join(lines, "\n")), nil, nil, "", "", WithCoalesce(0, time.Hour))
+	require.NoError(t, err)
+	var res []Reason
+	for ev := range replay.Channel() {
+		res = append(res, ev.Reason)
+	}
+	assert.Equal(t, []Reason{ReasonStopped, ReasonRemoved, ReasonStopped}, res, "removal passed, burst started over after it")
+	assert.Equal(t, 1, replay.Stats().Coalesced)
+}
+
+func TestCoalescePrune(t *testing.T) {
+	e := EventNotif{coalesceDown: time.Second}
+	t0 := time.Now()
+	for i := 0; i < coalescePrune; i++ {
+		assert.False(t, e.coalesced(fmt.Sprintf("id%d", i), false, t0))
+	}
+	assert.True(t, e.coalesced("id1", false, t0.Add(time.Millisecond)))
+	assert.Len(t, e.bursts, coalescePrune)
+	assert.False(t, e.coalesced("new", false, t0.Add(2*time.Second)), "expired ones pruned")
+	assert.Len(t, e.bursts, 1)
+	assert.False(t, e.coalesced("new", true, t0.Add(2*time.Second)), "up not coalesced")
+	assert.Empty(t, e.bursts, "down burst ended by up")
+}
@@ -0,0 +1,24 @@
+package discovery
+
+import (
+	"time"
+)
+
+// CollectionEvent makes EventCollect typed event of container's logs collection started or stopped.
+// Made by log collection layer, not EventNotif, as collection may start later than container, i.e. waiting
+// for it to become healthy. Container's details taken from its up event, Seq cleared as the event is not a part
+// of EventNotif's stream.
+func CollectionEvent(up Event, started bool) Event {
+	res := up
+	res.Type, res.Status, res.Reason, res.TS, res.Raw = EventCollect, started, ReasonNone, time.Now(), nil
+	res.Seq = 0
+	return res
+}
+
+// SuppressionEvent makes EventSuppress typed event of crash looping container's logs collection suppressed,
+// or resumed once container stable. Made by log collection layer, like CollectionEvent.
+func SuppressionEvent(up Event, suppressed bool) Event {
+	res := CollectionEvent(up, suppressed)
+	res.Type = EventSuppress
+	return res
+}
@@ -0,0 +1,46 @@
+package discovery
+
+import (
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectionEvent(t *testing.T) {
+	up := Event{ContainerID: "id1", ContainerName: "c1", Group: "g1", Image: "img1", Status: true, Host: "h1",
+		TS: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), Labels: map[string]string{"k": "v"}, Raw: &docker.APIEvents{}, Seq: 5}
+
+	res := CollectionEvent(up, true)
+	assert.Equal(t, EventCollect, res.Type)
+	assert.True(t, res.Status)
+	assert.Equal(t, "c1", res.ContainerName)
+	assert.Equal(t, "g1", res.Group)
+	assert.Equal(t, "h1", res.Host)
+	assert.Equal(t, map[string]string{"k": "v"}, res.Labels)
+	assert.Nil(t, res.Raw)
+	assert.Zero(t, res.Seq, "not a part of events stream")
+	assert.WithinDuration(t, time.Now(), res.TS, time.Second, "collection time, not container's")
+
+	res = CollectionEvent(up, false)
+	assert.Equal(t, EventCollect, res.Type)
+	assert.False(t, res.Status)
+	assert.Equal(t, ReasonNone, res.Reason)
+	assert.Equal(t, EventLifecycle, up.Type, "up event not changed")
+}
+
+func TestSuppressionEvent(t *testing.T) {
+	up := Event{ContainerID: "id1", ContainerName: "c1", Group: "g1", Status: true, Seq: 5,
+		TS: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}
+	res := SuppressionEvent(up, true)
+	assert.Equal(t, EventSuppress, res.Type)
+	assert.True(t, res.Status)
+	assert.Equal(t, "c1", res.ContainerName)
+	assert.Zero(t, res.Seq)
+	assert.WithinDuration(t, time.Now(), res.TS, time.Second)
+
+	res = SuppressionEvent(up, false)
+	assert.Equal(t, EventSuppress, res.Type)
+	assert.False(t, res.Status, "resumed")
+}
@@ -0,0 +1,70 @@
+package discovery
+
+import (
+	"regexp"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// WithCommandFilter sets include and exclude regexps matched against container's command line.
+// Plain substring works as a regexp too. Any of them can be nil.
+//
+// Docker events don't carry the command, so live events matched against the command cached by the initial scan.
+// Containers not seen by the scan looked up once with ListContainers and cached as well.
+func WithCommandFilter(include, exclude *regexp.Regexp) Option {
+	return func(e *EventNotif) {
+		e.includeCmd = include
+		e.excludeCmd = exclude
+	}
+}
+
+// isCommandAllowed checks container's command against command filters, exclude wins unless PrecedenceIncludeWins set
+func (e *EventNotif) isCommandAllowed(command string) bool {
+	included := e.includeCmd != nil && e.includeCmd.MatchString(command)
+	excluded := e.excludeCmd != nil && e.excludeCmd.MatchString(command)
+	if e.precedence == PrecedenceIncludeWins {
+		return PrecedenceIncludeWins.allow(e.includeCmd != nil, included, excluded)
+	}
+	return PrecedenceExcludeWins.allow(e.includeCmd != nil, included, excluded)
+}
+
+// cacheCommand keeps container's command for matching live events
+func (e *EventNotif) cacheCommand(containerID, command string) {
+	if e.includeCmd == nil && e.excludeCmd == nil {
+		return
+	}
+	e.cmdLock.Lock()
+	defer e.cmdLock.Unlock()
+	e.commands[containerID] = command
+}
+
+// command returns cached container's command, looks it up in docker on cache miss
+func (e *EventNotif) command(containerID string) string {
+	e.cmdLock.Lock()
+	cmd, ok := e.commands[containerID]
+	e.cmdLock.Unlock()
+	if ok {
+		return cmd
+	}
+
+	containers, err := e.dockerClient.ListContainers(docker.ListContainersOptions{All: true,
+		Filters: map[string][]string{"id": {containerID}}})
+	if err != nil {
+		e.log().Logf("[WARN] can't get command for %s, %v", containerID, err)
+		return ""
+	}
+	for _, c := range containers {
+		if c.ID == containerID {
+			e.cacheCommand(containerID, c.Command)
+			return c.Command
+		}
+	}
+	return ""
+}
+
+// forgetCommand removes container's command from cache
+func (e *EventNotif) forgetCommand(containerID string) {
+	e.cmdLock.Lock()
+	defer e.cmdLock.Unlock()
+	delete(e.commands, containerID)
+}
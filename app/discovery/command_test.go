@@ -0,0 +1,84 @@
+package discovery
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmitCommandFilter(t *testing.T) {
+	client := &mockDockerClient{}
+	client.addWithCommand("id1", "name1", "/srv/app --port 8080")
+	client.addWithCommand("id2", "pause1", "sleep infinity")
+	client.addWithCommand("id3", "name3", "nginx -g daemon off;")
+
+	events, err := NewEventNotif(client, nil, nil, "", "", WithCommandFilter(nil, regexp.MustCompile("sleep infinity")))
+	require.NoError(t, err)
+
+	ev := <-events.Channel()
+	assert.Equal(t, "name1", ev.ContainerName)
+	ev = <-events.Channel()
+	assert.Equal(t, "name3", ev.ContainerName)
+	assert.Equal(t, map[string]string{"id1": "/srv/app --port 8080", "id2": "sleep infinity",
+		"id3": "nginx -g daemon off;"}, events.commands)
+}
+
+func TestEventsCommandFilter(t *testing.T) {
+	client := &mockDockerClient{}
+	client.addWithCommand("id1", "pause1", "sleep infinity")
+	events, err := NewEventNotif(client, nil, nil, "", "", WithCommandFilter(regexp.MustCompile("^/srv/"), nil))
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+
+	go client.remove("id1") // cached by the scan, excluded
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		client.addWithCommand("id2", "name2", "/srv/app") // not cached, looked up
+	}()
+	ev := <-events.Channel()
+	assert.Equal(t, "name2", ev.ContainerName)
+	assert.Equal(t, true, ev.Status)
+
+	events.cmdLock.Lock()
+	assert.Equal(t, "/srv/app", events.commands["id2"], "cached after lookup")
+	events.cmdLock.Unlock()
+}
+
+func TestIsCommandAllowed(t *testing.T) {
+	tbl := []struct {
+		include, exclude string
+		cmd              string
+		res              bool
+	}{
+		{"", "", "anything", true},
+		{"nginx", "", "nginx -g daemon", true},
+		{"nginx", "", "sleep infinity", false},
+		{"", "^sleep", "sleep infinity", false},
+		{"", "^sleep", "/bin/sh -c sleep 1", true},
+		{"sh", "sleep", "/bin/sh -c sleep 1", false},
+	}
+
+	for i, tt := range tbl {
+		e := EventNotif{}
+		if tt.include != "" {
+			e.includeCmd = regexp.MustCompile(tt.include)
+		}
+		if tt.exclude != "" {
+			e.excludeCmd = regexp.MustCompile(tt.exclude)
+		}
+		assert.Equal(t, tt.res, e.isCommandAllowed(tt.cmd), "case #%d", i)
+	}
+}
+
+func TestEventsCommandForgetFiltered(t *testing.T) {
+	events := &EventNotif{eventsCh: make(chan Event, 1), selfID: "id1", excludeCmd: regexp.MustCompile("^sleep"),
+		commands: map[string]string{"id1": "sleep infinity"}}
+	events.processEvent(&dockerclient.APIEvents{Type: "container", Status: "destroy", Time: time.Now().Unix(),
+		Actor: dockerclient.APIActor{ID: "id1", Attributes: map[string]string{"name": "self", "image": "img"}}})
+	assert.Empty(t, events.eventsCh)
+	assert.Empty(t, events.commands, "destroyed container forgotten, even if filtered out before command check")
+}
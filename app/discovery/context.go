@@ -0,0 +1,157 @@
+package discovery
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/pkg/errors"
+)
+
+// defaultContext is docker cli context of DOCKER_HOST, or local socket, not stored in contexts dir
+const defaultContext = "default"
+
+// contextMeta is docker cli context metadata, stored in contexts/meta/<digest of name>/meta.json of docker config dir
+type contextMeta struct {
+	Name      string `json:"Name"`
+	Endpoints map[string]struct {
+		Host          string `json:"Host"`
+		SkipTLSVerify bool   `json:"SkipTLSVerify"`
+	} `json:"Endpoints"`
+}
+
+// NewDockerClientFromContext makes docker client for docker cli context, with context's endpoint and TLS material.
+// Empty name means the current context, from DOCKER_CONTEXT env or docker cli config, default one if not set.
+// The default context made from DOCKER_HOST, DOCKER_TLS_VERIFY and DOCKER_CERT_PATH env, as docker cli does.
+// Contexts read from DOCKER_CONFIG dir, ~/.docker by default. Returns error if the context doesn't exist.
+// Http client tuned by params, see NewDockerClient.
+func NewDockerClientFromContext(name string, params ClientParams) (*docker.Client, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	client, err := contextClient(name)
+	if err != nil {
+		return nil, err
+	}
+	if err = params.apply(client); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// contextClient makes docker client for docker cli context with default http client
+func contextClient(name string) (*docker.Client, error) {
+	dir, err := dockerConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		if name, err = currentContext(dir); err != nil {
+			return nil, err
+		}
+	}
+	if name == defaultContext {
+		return docker.NewClientFromEnv()
+	}
+
+	meta, err := readContextMeta(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	ep, ok := meta.Endpoints["docker"]
+	if !ok || ep.Host == "" {
+		return nil, errors.Errorf("docker context %s has no docker endpoint", name)
+	}
+	if strings.HasPrefix(ep.Host, "ssh://") {
+		return nil, errors.Errorf("ssh endpoint %s of docker context %s not supported", ep.Host, name)
+	}
+
+	tlsDir := filepath.Join(dir, "contexts", "tls", contextDigest(name), "docker")
+	ca, cert, key := readOptional(tlsDir, "ca.pem"), readOptional(tlsDir, "cert.pem"), readOptional(tlsDir, "key.pem")
+	if ca == nil && cert == nil && key == nil && !ep.SkipTLSVerify {
+		client, err := docker.NewClient(ep.Host)
+		return client, errors.Wrapf(err, "failed to make docker client of context %s", name)
+	}
+	client, err := docker.NewTLSClientFromBytes(ep.Host, cert, key, ca)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to make tls docker client of context %s", name)
+	}
+	// go-dockerclient skips verification without CA, docker cli verifies with system roots unless told to skip
+	client.TLSConfig.InsecureSkipVerify = ep.SkipTLSVerify
+	return client, nil
+}
+
+// dockerConfigDir returns docker cli config dir, from DOCKER_CONFIG env or ~/.docker
+func dockerConfigDir() (string, error) {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.Wrap(err, "can't locate docker config dir")
+	}
+	return filepath.Join(home, ".docker"), nil
+}
+
+// currentContext returns context selected by DOCKER_CONTEXT env or currentContext of config.json.
+// DOCKER_HOST env selects the default context, as it overrides the current one in docker cli.
+func currentContext(dir string) (string, error) {
+	if name := os.Getenv("DOCKER_CONTEXT"); name != "" {
+		return name, nil
+	}
+	if os.Getenv("DOCKER_HOST") != "" {
+		return defaultContext, nil
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "config.json")) //nolint:gosec // docker cli config file
+	if os.IsNotExist(err) {
+		return defaultContext, nil
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "can't read docker config")
+	}
+	var cfg struct {
+		CurrentContext string `json:"currentContext"`
+	}
+	if err = json.Unmarshal(data, &cfg); err != nil {
+		return "", errors.Wrap(err, "can't parse docker config")
+	}
+	if cfg.CurrentContext == "" {
+		return defaultContext, nil
+	}
+	return cfg.CurrentContext, nil
+}
+
+// readContextMeta reads metadata of named context, fails if context doesn't exist
+func readContextMeta(dir, name string) (contextMeta, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "contexts", "meta", contextDigest(name), "meta.json")) //nolint:gosec // context file
+	if os.IsNotExist(err) {
+		return contextMeta{}, errors.Errorf("docker context %s not found", name)
+	}
+	if err != nil {
+		return contextMeta{}, errors.Wrapf(err, "can't read docker context %s", name)
+	}
+	var meta contextMeta
+	if err = json.Unmarshal(data, &meta); err != nil {
+		return contextMeta{}, errors.Wrapf(err, "can't parse docker context %s", name)
+	}
+	return meta, nil
+}
+
+// contextDigest returns dir name of context in docker cli contexts store, sha256 of context name
+func contextDigest(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:])
+}
+
+// readOptional returns content of file in dir, nil if it's missing or unreadable
+func readOptional(dir, file string) []byte {
+	data, err := os.ReadFile(filepath.Join(dir, file)) //nolint:gosec // context tls file
+	if err != nil {
+		return nil
+	}
+	return data
+}
@@ -0,0 +1,119 @@
+package discovery
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDockerClientFromContext(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", dir)
+	t.Setenv("DOCKER_CONTEXT", "")
+	t.Setenv("DOCKER_HOST", "")
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("OK"))
+	}))
+	defer srv.Close()
+	tlsHost := "tcp://" + srv.Listener.Addr().String()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	rawKey, err := x509.MarshalPKCS8PrivateKey(srv.TLS.Certificates[0].PrivateKey)
+	require.NoError(t, err)
+	cert, key := ca, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: rawKey}) // server's pair as client certificate
+
+	writeContext(t, dir, "plain", `{"Name":"plain","Endpoints":{"docker":{"Host":"tcp://10.0.0.1:2375"}}}`, nil)
+	writeContext(t, dir, "secure", fmt.Sprintf(`{"Name":"secure","Endpoints":{"docker":{"Host":%q}}}`, tlsHost),
+		map[string][]byte{"ca.pem": ca, "cert.pem": cert, "key.pem": key})
+	writeContext(t, dir, "no-ca", fmt.Sprintf(`{"Name":"no-ca","Endpoints":{"docker":{"Host":%q}}}`, tlsHost),
+		map[string][]byte{"cert.pem": cert, "key.pem": key})
+	writeContext(t, dir, "skip", fmt.Sprintf(`{"Name":"skip","Endpoints":{"docker":{"Host":%q,"SkipTLSVerify":true}}}`, tlsHost), nil)
+	writeContext(t, dir, "ssh", `{"Name":"ssh","Endpoints":{"docker":{"Host":"ssh://user@host"}}}`, nil)
+	writeContext(t, dir, "empty", `{"Name":"empty","Endpoints":{}}`, nil)
+	writeContext(t, dir, "broken", `{"Name":`, nil)
+
+	t.Run("plain", func(t *testing.T) {
+		client, err := NewDockerClientFromContext("plain", ClientParams{})
+		require.NoError(t, err)
+		assert.Equal(t, "tcp://10.0.0.1:2375", client.Endpoint())
+		assert.Nil(t, client.TLSConfig)
+	})
+
+	t.Run("tls with ca", func(t *testing.T) {
+		client, err := NewDockerClientFromContext("secure", ClientParams{})
+		require.NoError(t, err)
+		assert.False(t, client.TLSConfig.InsecureSkipVerify)
+		assert.Len(t, client.TLSConfig.Certificates, 1, "client certificate")
+		assert.NoError(t, client.Ping(), "server verified with context's ca")
+	})
+
+	t.Run("tls without ca verified", func(t *testing.T) {
+		client, err := NewDockerClientFromContext("no-ca", ClientParams{})
+		require.NoError(t, err)
+		assert.False(t, client.TLSConfig.InsecureSkipVerify)
+		assert.Error(t, client.Ping(), "self-signed server not trusted by system roots")
+	})
+
+	t.Run("skip tls verify", func(t *testing.T) {
+		client, err := NewDockerClientFromContext("skip", ClientParams{})
+		require.NoError(t, err)
+		assert.True(t, client.TLSConfig.InsecureSkipVerify)
+		assert.NoError(t, client.Ping())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewDockerClientFromContext("nope", ClientParams{})
+		assert.EqualError(t, err, "docker context nope not found")
+		_, err = NewDockerClientFromContext("ssh", ClientParams{})
+		assert.EqualError(t, err, "ssh endpoint ssh://user@host of docker context ssh not supported")
+		_, err = NewDockerClientFromContext("empty", ClientParams{})
+		assert.EqualError(t, err, "docker context empty has no docker endpoint")
+		_, err = NewDockerClientFromContext("broken", ClientParams{})
+		assert.ErrorContains(t, err, "can't parse docker context broken")
+	})
+
+	t.Run("current", func(t *testing.T) {
+		client, err := NewDockerClientFromContext("", ClientParams{})
+		require.NoError(t, err, "default without config")
+		assert.Equal(t, "unix:///var/run/docker.sock", client.Endpoint())
+
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"currentContext":"plain"}`), 0o600))
+		client, err = NewDockerClientFromContext("", ClientParams{})
+		require.NoError(t, err)
+		assert.Equal(t, "tcp://10.0.0.1:2375", client.Endpoint(), "from config")
+
+		t.Setenv("DOCKER_CONTEXT", "nope")
+		_, err = NewDockerClientFromContext("", ClientParams{})
+		assert.EqualError(t, err, "docker context nope not found", "env wins over config")
+
+		t.Setenv("DOCKER_CONTEXT", "")
+		t.Setenv("DOCKER_HOST", "tcp://10.0.0.2:2375")
+		client, err = NewDockerClientFromContext("", ClientParams{})
+		require.NoError(t, err)
+		assert.Equal(t, "tcp://10.0.0.2:2375", client.Endpoint(), "docker host selects default context")
+
+		client, err = NewDockerClientFromContext("plain", ClientParams{})
+		require.NoError(t, err)
+		assert.Equal(t, "tcp://10.0.0.1:2375", client.Endpoint(), "named context wins over docker host")
+	})
+}
+
+// writeContext makes docker cli context in config dir with tls files
+func writeContext(t *testing.T, dir, name, meta string, tlsFiles map[string][]byte) {
+	metaDir := filepath.Join(dir, "contexts", "meta", contextDigest(name))
+	require.NoError(t, os.MkdirAll(metaDir, 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(metaDir, "meta.json"), []byte(meta), 0o600))
+	tlsDir := filepath.Join(dir, "contexts", "tls", contextDigest(name), "docker")
+	for file, data := range tlsFiles {
+		require.NoError(t, os.MkdirAll(tlsDir, 0o750))
+		require.NoError(t, os.WriteFile(filepath.Join(tlsDir, file), data, 0o600))
+	}
+}
@@ -0,0 +1,23 @@
+package discovery
+
+import (
+	"time"
+)
+
+// markCreated remembers creation time of the container from its create event, for Event.Created of up events
+func (e *EventNotif) markCreated(containerID string, ts time.Time) {
+	e.trackLock.Lock()
+	defer e.trackLock.Unlock()
+	e.created[containerID] = ts
+}
+
+// createdAt returns creation time of the container, zero if create event not seen. Forgets it on destroy.
+func (e *EventNotif) createdAt(containerID string, destroyed bool) time.Time {
+	e.trackLock.Lock()
+	defer e.trackLock.Unlock()
+	res := e.created[containerID]
+	if destroyed {
+		delete(e.created, containerID)
+	}
+	return res
+}
@@ -0,0 +1,72 @@
+package discovery
+
+import (
+	"strings"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/pkg/errors"
+)
+
+// daemonEventTypes are non-container docker event types supported by WithDaemonEvents.
+// Image events are not here, as those reported per container with WithImageEvents.
+var daemonEventTypes = []string{"network", "volume", "daemon", "plugin", "node", "service", "secret", "config"}
+
+// DaemonEvent is non-container docker event, i.e. network disconnect or volume unmount
+type DaemonEvent struct {
+	Type       string            // docker event type, i.e. network or volume
+	Action     string            // i.e. connect, disconnect, create, destroy, mount or unmount
+	ActorID    string            // id of network, volume or other object of the event
+	Attributes map[string]string // actor's attributes, i.e. network name and type
+}
+
+// WithDaemonEvents makes non-container docker events of given types, i.e. "network" or "volume", emitted as
+// EventDaemon typed events with Event.Daemon set. Events referencing a container, like network connect and
+// disconnect, have ContainerID set, and name and group too if container tracked. Container events only by default.
+func WithDaemonEvents(types ...string) Option {
+	return func(e *EventNotif) {
+		e.daemonTypes = map[string]bool{}
+		for _, t := range types {
+			e.daemonTypes[strings.TrimSpace(t)] = true
+		}
+	}
+}
+
+// validateDaemonTypes checks types of WithDaemonEvents are supported
+func (e *EventNotif) validateDaemonTypes() error {
+	for t := range e.daemonTypes {
+		if !contains(t, daemonEventTypes) {
+			return errors.Errorf("unsupported daemon event type %q, allowed %s", t, strings.Join(daemonEventTypes, ", "))
+		}
+	}
+	return nil
+}
+
+// processDaemonEvent emits EventDaemon for non-container docker event, not tracked
+func (e *EventNotif) processDaemonEvent(dockerEvent *docker.APIEvents) {
+	action := dockerEvent.Action
+	if action == "" {
+		action = dockerEvent.Status
+	}
+	event := Event{
+		Type:        EventDaemon,
+		ContainerID: dockerEvent.Actor.Attributes["container"],
+		TS:          time.Unix(0, dockerEvent.TimeNano),
+		Host:        e.host,
+		Source:      e.source,
+		Daemon: &DaemonEvent{Type: dockerEvent.Type, Action: action, ActorID: dockerEvent.Actor.ID,
+			Attributes: dockerEvent.Actor.Attributes},
+	}
+	if c, ok := e.tracked.get(event.ContainerID); ok {
+		event.ContainerName, event.RawName, event.Group, event.Image = c.ContainerName, c.RawName, c.Group, c.Image
+	}
+	if e.withRaw {
+		event.Raw = dockerEvent
+	}
+
+	e.trackLock.Lock()
+	e.countEmitted(event)
+	e.trackLock.Unlock()
+	e.log().Logf("[INFO] new daemon event %+v", event)
+	e.send(event) // not tracked, sent directly
+}
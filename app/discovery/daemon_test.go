@@ -0,0 +1,72 @@
+package discovery
+
+import (
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventsDaemon(t *testing.T) {
+	client := &mockDockerClient{containers: []dockerclient.APIContainers{{ID: "id1", Names: []string{"/web"}, Image: "nginx"}}}
+	events, err := NewEventNotif(client, nil, nil, "", "", WithDaemonEvents("network", " volume"))
+	require.NoError(t, err)
+	assert.Equal(t, "web", (<-events.Channel()).ContainerName)
+
+	time.Sleep(10 * time.Millisecond)
+	go func() {
+		client.send(&dockerclient.APIEvents{Type: "plugin", Action: "enable", Actor: dockerclient.APIActor{ID: "p1"}})
+		client.send(&dockerclient.APIEvents{Type: "network", Action: "disconnect", TimeNano: 100,
+			Actor: dockerclient.APIActor{ID: "net1", Attributes: map[string]string{"name": "bridge", "container": "id1"}}})
+		client.send(&dockerclient.APIEvents{Type: "volume", Status: "unmount", Actor: dockerclient.APIActor{ID: "vol1"}})
+		client.send(&dockerclient.APIEvents{Type: "network", Action: "connect",
+			Actor: dockerclient.APIActor{ID: "net1", Attributes: map[string]string{"container": "id2"}}})
+	}()
+
+	ev := <-events.Channel()
+	assert.Equal(t, EventDaemon, ev.Type)
+	assert.Equal(t, &DaemonEvent{Type: "network", Action: "disconnect", ActorID: "net1",
+		Attributes: map[string]string{"name": "bridge", "container": "id1"}}, ev.Daemon)
+	assert.Equal(t, "id1", ev.ContainerID)
+	assert.Equal(t, "web", ev.ContainerName, "tracked container details set")
+	assert.Equal(t, time.Unix(0, 100), ev.TS)
+
+	ev = <-events.Channel()
+	assert.Equal(t, EventDaemon, ev.Type)
+	assert.Equal(t, &DaemonEvent{Type: "volume", Action: "unmount", ActorID: "vol1"}, ev.Daemon, "action from status")
+	assert.Empty(t, ev.ContainerID)
+
+	ev = <-events.Channel()
+	assert.Equal(t, "id2", ev.ContainerID)
+	assert.Empty(t, ev.ContainerName, "container not tracked")
+
+	st := events.Stats()
+	assert.Equal(t, 3, st.Daemon)
+	assert.Equal(t, 1, st.Up, "daemon events not counted as lifecycle")
+	assert.Equal(t, 1, st.Tracked, "daemon events don't change tracking")
+}
+
+func TestEventsDaemonDisabled(t *testing.T) {
+	client := &mockDockerClient{containers: []dockerclient.APIContainers{{ID: "id1", Names: []string{"/web"}, Image: "nginx"}}}
+	events, err := NewEventNotif(client, nil, nil, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "web", (<-events.Channel()).ContainerName)
+
+	time.Sleep(10 * time.Millisecond)
+	go func() {
+		client.send(&dockerclient.APIEvents{Type: "network", Action: "disconnect", Actor: dockerclient.APIActor{ID: "net1"}})
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "stop",
+			Actor: dockerclient.APIActor{ID: "id1", Attributes: map[string]string{"name": "web"}}})
+	}()
+	ev := <-events.Channel()
+	assert.Equal(t, EventLifecycle, ev.Type, "container events only by default")
+	assert.False(t, ev.Status)
+}
+
+func TestWithDaemonEventsUnsupported(t *testing.T) {
+	_, err := NewEventNotif(&mockDockerClient{}, nil, nil, "", "", WithDaemonEvents("network", "image"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unsupported daemon event type "image"`)
+}
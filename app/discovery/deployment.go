@@ -0,0 +1,141 @@
+package discovery
+
+import (
+	"sort"
+	"time"
+)
+
+// composeProjectLabel and composeServiceLabel are set by docker compose on containers of a project
+const (
+	composeProjectLabel = "com.docker.compose.project"
+	composeServiceLabel = "com.docker.compose.service"
+)
+
+// Deployment is a group of containers of a compose project started together, set for EventDeploy typed events
+type Deployment struct {
+	Project    string                `json:"project"`    // compose project, from com.docker.compose.project label
+	Containers []DeploymentContainer `json:"containers"` // started containers, in order of their up events
+}
+
+// DeploymentContainer is a container started by deployment
+type DeploymentContainer struct {
+	ID      string `json:"container_id"`
+	Name    string `json:"container_name"`    // resolved container name, as in its up event
+	Service string `json:"service,omitempty"` // compose service, from com.docker.compose.service label
+}
+
+// deploymentBurst collects up events of a project till its window passed
+type deploymentBurst struct {
+	first      time.Time // event time of the first up event
+	due        time.Time // wall clock time the burst reported
+	containers []DeploymentContainer
+}
+
+// WithDeployments makes starts of compose project's containers within window grouped to a single EventDeploy
+// typed event with Event.Deployment listing the containers, i.e. for "docker compose up" of N services. The event
+// sent once window passed since the first start of the project, after up events of containers, which emitted as
+// usual. Live start events of containers with com.docker.compose.project label only, the initial scan and resyncs
+// not grouped. Disabled if window is 0.
+func WithDeployments(window time.Duration) Option {
+	return func(e *EventNotif) {
+		e.deployWindow = window
+	}
+}
+
+// addDeployment adds started container to its project's burst, reports the burst first if event came after
+// its window. Called by listener for emitted live start events.
+func (e *EventNotif) addDeployment(event Event, ts time.Time) {
+	project := event.Labels[composeProjectLabel]
+	if e.deployWindow <= 0 || project == "" {
+		return
+	}
+	if b, ok := e.deployments[project]; ok && ts.Sub(b.first) > e.deployWindow {
+		e.emitDeployment(project, b)
+	}
+	if e.deployments == nil {
+		e.deployments = map[string]*deploymentBurst{}
+	}
+	b, ok := e.deployments[project]
+	if !ok {
+		b = &deploymentBurst{first: ts, due: time.Now().Add(e.deployWindow)}
+		e.deployments[project] = b
+	}
+	for _, c := range b.containers {
+		if c.ID == event.ContainerID {
+			return // started again within window
+		}
+	}
+	b.containers = append(b.containers, DeploymentContainer{ID: event.ContainerID, Name: event.ContainerName,
+		Service: event.Labels[composeServiceLabel]})
+}
+
+// deployTimer fires once the earliest pending burst due, a single timer re-armed by listener
+type deployTimer struct {
+	timer *time.Timer
+	armed time.Time // due time the timer set for, zero if not set or fired
+}
+
+// newDeployTimer makes stopped deployTimer
+func newDeployTimer() *deployTimer {
+	res := &deployTimer{timer: time.NewTimer(time.Hour)}
+	res.timer.Stop()
+	return res
+}
+
+// fired marks the timer's value received
+func (t *deployTimer) fired() {
+	t.armed = time.Time{}
+}
+
+// stop stops the timer
+func (t *deployTimer) stop() {
+	t.timer.Stop()
+}
+
+// deploymentDue returns channel of the timer fired once the earliest pending burst due, re-arming it only if
+// the earliest due time changed. Nil if none pending.
+func (e *EventNotif) deploymentDue(t *deployTimer) <-chan time.Time {
+	var earliest time.Time
+	for _, b := range e.deployments {
+		if earliest.IsZero() || b.due.Before(earliest) {
+			earliest = b.due
+		}
+	}
+	if earliest.IsZero() {
+		return nil
+	}
+	if !earliest.Equal(t.armed) {
+		if !t.timer.Stop() {
+			select {
+			case <-t.timer.C: // fired with stale due time, not received
+			default:
+			}
+		}
+		t.timer.Reset(time.Until(earliest))
+		t.armed = earliest
+	}
+	return t.timer.C
+}
+
+// flushDeployments reports bursts due by now, or all pending bursts if all set, in order of projects
+func (e *EventNotif) flushDeployments(all bool) {
+	projects := make([]string, 0, len(e.deployments))
+	for project, b := range e.deployments {
+		if all || !time.Now().Before(b.due) {
+			projects = append(projects, project)
+		}
+	}
+	sort.Strings(projects)
+	for _, project := range projects {
+		e.emitDeployment(project, e.deployments[project])
+	}
+}
+
+// emitDeployment sends EventDeploy of project's burst and removes the burst, not tracked
+func (e *EventNotif) emitDeployment(project string, b *deploymentBurst) {
+	delete(e.deployments, project)
+	event := Event{Type: EventDeploy, TS: b.first, Host: e.host, Source: e.source,
+		Deployment: &Deployment{Project: project, Containers: b.containers}}
+	e.log().Logf("[INFO] deployment of %s, %d containers", project, len(b.containers))
+	e.send(event)
+}
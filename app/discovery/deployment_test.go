@@ -0,0 +1,162 @@
+package discovery
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeploymentsReplay(t *testing.T) {
+	t0 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	type rec struct {
+		id, status, project, service string
+		at                           time.Duration
+	}
+	records := []rec{
+		{"c1", "start", "shop", "web", 0}, {"c2", "start", "shop", "db", 100 * time.Millisecond},
+		{"c3", "start", "", "", 200 * time.Millisecond}, {"c4", "start", "blog", "app", 300 * time.Millisecond},
+		{"c2", "restart", "shop", "db", 400 * time.Millisecond}, {"c1", "start", "shop", "web", 500 * time.Millisecond},
+		{"c5", "start", "shop", "cache", 3 * time.Second}, // after window, the next deployment of shop
+	}
+	var lines []string
+	for _, r := range records {
+		attrs := map[string]string{"name": r.id}
+		if r.project != "" {
+			attrs[composeProjectLabel], attrs[composeServiceLabel] = r.project, r.service
+		}
+		data, err := json.Marshal(dockerclient.APIEvents{Type: "container", Status: r.status, TimeNano: t0.Add(r.at).UnixNano(),
+			Actor: dockerclient.APIActor{ID: r.id, Attributes: attrs}})
+		require.NoError(t, err)
+		lines = append(lines, string(data))
+	}
+
+	replay, err := Replay(strings.NewReader(strings.Join(lines, "\n")), nil, nil, "", "", WithDeployments(time.Second),
+		WithHost("h1"))
+	require.NoError(t, err)
+	var ups []string
+	var deployments []Event
+	for ev := range replay.Channel() {
+		if ev.Type == EventDeploy {
+			deployments = append(deployments, ev)
+			continue
+		}
+		ups = append(ups, ev.ContainerName)
+	}
+	assert.Equal(t, []string{"c1", "c2", "c3", "c4", "c2", "c1", "c5"}, ups, "individual events emitted")
+
+	require.Len(t, deployments, 3)
+	assert.Equal(t, &Deployment{Project: "shop", Containers: []DeploymentContainer{
+		{ID: "c1", Name: "c1", Service: "web"}, {ID: "c2", Name: "c2", Service: "db"}}}, deployments[0].Deployment,
+		"restart not grouped, repeated start listed once")
+	assert.Equal(t, t0, deployments[0].TS.UTC(), "time of the first start")
+	assert.Equal(t, "h1", deployments[0].Host)
+	assert.Equal(t, &Deployment{Project: "blog", Containers: []DeploymentContainer{{ID: "c4", Name: "c4", Service: "app"}}},
+		deployments[1].Deployment, "pending reported at the end of replay")
+	assert.Equal(t, &Deployment{Project: "shop", Containers: []DeploymentContainer{{ID: "c5", Name: "c5", Service: "cache"}}},
+		deployments[2].Deployment)
+	assert.Zero(t, replay.Stats().Daemon+replay.Stats().Image, "not counted")
+}
+
+func TestDeploymentsLive(t *testing.T) {
+	client := &mockDockerClient{containers: []dockerclient.APIContainers{
+		{ID: "id0", Names: []string{"/old"}, Labels: map[string]string{composeProjectLabel: "shop"}},
+	}}
+	events, err := NewEventNotif(client, nil, nil, "", "", WithDeployments(50*time.Millisecond))
+	require.NoError(t, err)
+	ev := <-events.Channel()
+	assert.Equal(t, "old", ev.ContainerName, "scan not grouped")
+	require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, 5*time.Millisecond)
+
+	for _, id := range []string{"id1", "id2"} {
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "start", Actor: dockerclient.APIActor{ID: id,
+			Attributes: map[string]string{"name": "web-" + id, composeProjectLabel: "shop", composeServiceLabel: "web"}}})
+	}
+	var got []Event
+	for len(got) < 3 {
+		select {
+		case ev := <-events.Channel():
+			got = append(got, ev)
+		case <-time.After(time.Second):
+			t.Fatalf("got %d events only", len(got))
+		}
+	}
+	assert.Equal(t, "web-id1", got[0].ContainerName)
+	assert.Equal(t, "web-id2", got[1].ContainerName)
+	assert.Equal(t, EventDeploy, got[2].Type, "sent once window passed")
+	assert.Equal(t, &Deployment{Project: "shop", Containers: []DeploymentContainer{
+		{ID: "id1", Name: "web-id1", Service: "web"}, {ID: "id2", Name: "web-id2", Service: "web"}}}, got[2].Deployment)
+
+	select {
+	case ev := <-events.Channel():
+		t.Fatalf("unexpected event %+v", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestDeploymentsDisabled(t *testing.T) {
+	data, err := json.Marshal(dockerclient.APIEvents{Type: "container", Status: "start", Actor: dockerclient.APIActor{ID: "c1",
+		Attributes: map[string]string{"name": "c1", composeProjectLabel: "shop"}}})
+	require.NoError(t, err)
+	replay, err := Replay(strings.NewReader(string(data)), nil, nil, "", "")
+	require.NoError(t, err)
+	var types []EventType
+	for ev := range replay.Channel() {
+		types = append(types, ev.Type)
+	}
+	assert.Equal(t, []EventType{EventLifecycle}, types)
+}
+
+func TestDeploymentsListenerClosed(t *testing.T) {
+	client := &mockDockerClient{}
+	events, err := NewEventNotif(client, nil, nil, "", "", WithDeployments(time.Hour))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, 5*time.Millisecond)
+
+	client.send(&dockerclient.APIEvents{Type: "container", Status: "start", Actor: dockerclient.APIActor{ID: "id1",
+		Attributes: map[string]string{"name": "web", composeProjectLabel: "shop"}}})
+	ev := <-events.Channel()
+	assert.Equal(t, "web", ev.ContainerName)
+	client.disconnect()
+
+	select {
+	case ev = <-events.Channel():
+		assert.Equal(t, EventDeploy, ev.Type, "pending deployment reported once listener closed")
+		assert.Equal(t, "shop", ev.Deployment.Project)
+	case <-time.After(time.Second):
+		t.Fatal("no deployment event")
+	}
+}
+
+func Test_deploymentDue(t *testing.T) {
+	e := &EventNotif{eventsCh: make(chan Event, 1)}
+	timer := newDeployTimer()
+	defer timer.stop()
+	assert.Nil(t, e.deploymentDue(timer), "none pending")
+
+	now := time.Now()
+	e.deployments = map[string]*deploymentBurst{"shop": {due: now.Add(time.Hour)}}
+	ch := e.deploymentDue(timer)
+	require.NotNil(t, ch)
+	assert.Equal(t, now.Add(time.Hour), timer.armed)
+	assert.Equal(t, ch, e.deploymentDue(timer), "the same timer")
+	assert.Equal(t, now.Add(time.Hour), timer.armed, "not re-armed")
+
+	e.deployments["blog"] = &deploymentBurst{due: now.Add(10 * time.Millisecond)}
+	ch = e.deploymentDue(timer)
+	assert.Equal(t, now.Add(10*time.Millisecond), timer.armed, "re-armed for the earliest")
+	select {
+	case <-ch:
+		timer.fired()
+	case <-time.After(time.Second):
+		t.Fatal("timer not fired")
+	}
+	e.flushDeployments(false)
+	assert.Len(t, e.deployments, 1, "due burst reported")
+	e.deploymentDue(timer)
+	assert.Equal(t, now.Add(time.Hour), timer.armed, "re-armed for the next one")
+}
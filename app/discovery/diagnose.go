@@ -0,0 +1,92 @@
+package discovery
+
+import (
+	"strings"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/pkg/errors"
+)
+
+// exclusion reasons of excludedBy with own log messages
+const (
+	exclusionSelf = "own container"
+	exclusionName = "name filter"
+)
+
+// Diagnosis is a report of running containers of docker host checked against filters, made by Diagnose
+type Diagnosis struct {
+	Containers []ContainerDiagnosis
+}
+
+// ContainerDiagnosis is a running container with the reason it's excluded, empty if collected
+type ContainerDiagnosis struct {
+	ID         string
+	Name       string
+	Group      string
+	ExcludedBy string // i.e. "name filter", "label logger.skip" or "tty"
+}
+
+// Included returns number of collected containers
+func (d Diagnosis) Included() (res int) {
+	for _, c := range d.Containers {
+		if c.ExcludedBy == "" {
+			res++
+		}
+	}
+	return res
+}
+
+// Diagnose lists running containers and checks them against filters and options the same way as the initial
+// scan of NewEventNotif does, but without subscribing to docker events, so nothing collected.
+// Max containers limit not applied, as it depends on containers collected before.
+func Diagnose(dockerClient DockerClient, excludes, includes []string, includesPattern, excludesPattern string,
+	opts ...Option) (Diagnosis, error) {
+	e, err := newEventNotif(dockerClient, excludes, includes, includesPattern, excludesPattern, opts...)
+	if err != nil {
+		return Diagnosis{}, err
+	}
+	containers, err := dockerClient.ListContainers(docker.ListContainersOptions{All: false})
+	if err != nil {
+		return Diagnosis{}, errors.Wrap(err, "can't list containers")
+	}
+	e.sortByPriority(containers)
+	res := Diagnosis{Containers: make([]ContainerDiagnosis, 0, len(containers))}
+	for _, c := range containers {
+		containerName := buildContainerName(c.Labels, strings.TrimPrefix(c.Names[0], "/"))
+		res.Containers = append(res.Containers, ContainerDiagnosis{ID: c.ID, Name: containerName,
+			Group: e.groupName(c.Labels, c.Image), ExcludedBy: e.excludedBy(c, containerName)})
+	}
+	return res, nil
+}
+
+// excludedBy returns the filter excluding running container, empty if container collected.
+// Caches container's command for command filter of its future events.
+func (e *EventNotif) excludedBy(c docker.APIContainers, containerName string) string {
+	if e.isSelf(c.ID, c.Labels) {
+		return exclusionSelf
+	}
+	if l := e.skipLabel(c.Labels); l != "" {
+		return "label " + l
+	}
+	if !e.inShard(containerName) {
+		return "shard"
+	}
+	if !e.isAllowed(containerName) {
+		if e.isInfra(containerName) {
+			return exclusionInfra
+		}
+		return exclusionName
+	}
+	if !e.exprAllowed(exprEnv{ID: c.ID, Name: containerName, RawName: strings.TrimPrefix(c.Names[0], "/"),
+		Group: e.groupName(c.Labels, c.Image), Image: c.Image, Host: e.host, Label: c.Labels}) {
+		return exclusionExpr
+	}
+	if !e.isReplicaAllowed(strings.TrimPrefix(c.Names[0], "/")) {
+		return "replica"
+	}
+	e.cacheCommand(c.ID, c.Command)
+	if !e.isCommandAllowed(c.Command) {
+		return "command"
+	}
+	return e.configFilter(c.ID)
+}
@@ -0,0 +1,53 @@
+package discovery
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiagnose(t *testing.T) {
+	client := &mockInspectClient{
+		mockDockerClient: mockDockerClient{containers: []dockerclient.APIContainers{
+			{ID: "id1", Names: []string{"/web"}, Image: "umputun/system/web:latest"},
+			{ID: "id2", Names: []string{"/db"}, Image: "postgres"},
+			{ID: "self1", Names: []string{"/logger"}},
+			{ID: "id3", Names: []string{"/nested"}, Labels: map[string]string{"parent": "x"}},
+			{ID: "id4", Names: []string{"/job"}, Command: "cron -f"},
+			{ID: "id5", Names: []string{"/shell"}},
+		}},
+		inspected: map[string]*dockerclient.Container{
+			"id1": {Config: &dockerclient.Config{}}, "id5": {Config: &dockerclient.Config{Tty: true}},
+		},
+	}
+	d, err := Diagnose(client, []string{"db"}, nil, "", "", WithSelfID("self1"), WithSkipLabels("parent"),
+		WithCommandFilter(nil, regexp.MustCompile("^cron")), WithTTYFilter(false, true))
+	require.NoError(t, err)
+	assert.Equal(t, []ContainerDiagnosis{
+		{ID: "id1", Name: "web", Group: "system"},
+		{ID: "id2", Name: "db", ExcludedBy: "name filter"},
+		{ID: "self1", Name: "logger", ExcludedBy: "own container"},
+		{ID: "id3", Name: "nested", ExcludedBy: "label parent"},
+		{ID: "id4", Name: "job", ExcludedBy: "command"},
+		{ID: "id5", Name: "shell", ExcludedBy: "tty"},
+	}, d.Containers)
+	assert.Equal(t, 1, d.Included())
+	assert.Equal(t, 0, client.subscriptions(), "not subscribed to events")
+
+	_, err = Diagnose(client, nil, nil, "[", "")
+	assert.Error(t, err, "invalid filters")
+	_, err = Diagnose(&failingListClient{}, nil, nil, "", "")
+	assert.EqualError(t, err, "can't list containers: list failed")
+}
+
+type failingListClient struct {
+	mockDockerClient
+}
+
+func (*failingListClient) ListContainers(dockerclient.ListContainersOptions) ([]dockerclient.APIContainers, error) {
+	return nil, errors.New("list failed")
+}
@@ -0,0 +1,97 @@
+package discovery
+
+import (
+	"strings"
+	"sync"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// WithEnvAllowlist makes events carry container's environment variables with allowed keys in Event.EnvVars,
+// i.e. APP_VERSION or DEPLOY_ENV, for correlating logs with config. Key ending with * allows all keys with
+// the prefix, i.e. APP_*. Environment often holds secrets, so only listed keys exposed and nothing by default.
+// Variables got by container inspect on up events, cached until container destroyed, down events use the cache.
+// Docker client should implement ContainerInspector, otherwise events have no variables.
+func WithEnvAllowlist(keys ...string) Option {
+	return func(e *EventNotif) {
+		if len(keys) == 0 {
+			return
+		}
+		e.envs = &envCache{keys: keys, items: map[string]map[string]string{}}
+	}
+}
+
+// envCache keeps allowed environment variables of inspected containers by id
+type envCache struct {
+	sync.Mutex
+	keys  []string
+	items map[string]map[string]string
+}
+
+// containerEnv returns allowed environment variables of container, inspected on up events and cached till
+// forgotten by forgetEnv. Nil if disabled, nothing allowed or inspect failed.
+func (e *EventNotif) containerEnv(containerID, status string) map[string]string {
+	if e.envs == nil {
+		return nil
+	}
+	e.envs.Lock()
+	defer e.envs.Unlock()
+	env, ok := e.envs.items[containerID]
+	if ok || (status != "start" && status != "restart" && status != "unpause") {
+		return env
+	}
+
+	inspector, ok := e.dockerClient.(ContainerInspector)
+	if !ok {
+		e.log().Logf("[WARN] docker client can't inspect containers, no environment for %s", containerID)
+		return nil
+	}
+	c, err := inspector.InspectContainerWithOptions(docker.InspectContainerOptions{ID: containerID})
+	if err != nil {
+		e.log().Logf("[WARN] can't inspect environment of %s, %v", containerID, err)
+		return nil
+	}
+	if c.Config != nil {
+		env = e.envs.allowed(c.Config.Env)
+	}
+	e.envs.items[containerID] = env
+	return env
+}
+
+// forgetEnv removes variables of destroyed container from cache, returning them. Nil if disabled or not cached.
+func (e *EventNotif) forgetEnv(containerID string) map[string]string {
+	if e.envs == nil {
+		return nil
+	}
+	e.envs.Lock()
+	defer e.envs.Unlock()
+	env := e.envs.items[containerID]
+	delete(e.envs.items, containerID)
+	return env
+}
+
+// allowed returns variables of KEY=VALUE list with allowed keys, nil if none
+func (c *envCache) allowed(vars []string) map[string]string {
+	var res map[string]string
+	for _, v := range vars {
+		key, val, _ := strings.Cut(v, "=")
+		if !c.isAllowed(key) {
+			continue
+		}
+		if res == nil {
+			res = map[string]string{}
+		}
+		res[key] = val
+	}
+	return res
+}
+
+// isAllowed checks key is listed, or has prefix of a key ending with *
+func (c *envCache) isAllowed(key string) bool {
+	for _, k := range c.keys {
+		if k == key || (strings.HasSuffix(k, "*") && strings.HasPrefix(key, strings.TrimSuffix(k, "*"))) {
+			return true
+		}
+	}
+	return false
+}
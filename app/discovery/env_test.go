@@ -0,0 +1,100 @@
+package discovery
+
+import (
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventsEnvAllowlist(t *testing.T) {
+	client := &mockInspectClient{
+		mockDockerClient: mockDockerClient{containers: []dockerclient.APIContainers{{ID: "id1", Names: []string{"/web"}}}},
+		inspected: map[string]*dockerclient.Container{
+			"id1": {Config: &dockerclient.Config{Env: []string{"APP_VERSION=1.2", "DB_PASSWORD=secret", "PATH=/bin"}}},
+			"id2": {Config: &dockerclient.Config{Env: []string{"DEPLOY_ENV=prod", "DEPLOY_REGION=eu=1", "DEPLOY=x", "TOKEN=t"}}},
+			"id3": {Config: &dockerclient.Config{Env: []string{"DB_PASSWORD=secret"}}},
+		},
+	}
+	events, err := NewEventNotif(client, nil, nil, "", "", WithEnvAllowlist("APP_VERSION", "DEPLOY_*"))
+	require.NoError(t, err)
+	ev := <-events.Channel()
+	assert.Equal(t, map[string]string{"APP_VERSION": "1.2"}, ev.EnvVars, "scan")
+	require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, 5*time.Millisecond)
+
+	send := func(id, status string) {
+		client.send(&dockerclient.APIEvents{Type: "container", Status: status,
+			Actor: dockerclient.APIActor{ID: id, Attributes: map[string]string{"name": "name-" + id}}})
+	}
+	go func() {
+		send("id2", "start")
+		send("id2", "die")
+		send("id2", "start")
+		send("id3", "start")
+		send("id2", "destroy")
+		send("id2", "start")
+	}()
+
+	ev = <-events.Channel()
+	assert.Equal(t, map[string]string{"DEPLOY_ENV": "prod", "DEPLOY_REGION": "eu=1"}, ev.EnvVars, "prefix allowed")
+	ev = <-events.Channel()
+	assert.False(t, ev.Status)
+	assert.Equal(t, map[string]string{"DEPLOY_ENV": "prod", "DEPLOY_REGION": "eu=1"}, ev.EnvVars, "down event from cache")
+	ev = <-events.Channel()
+	assert.Equal(t, map[string]string{"DEPLOY_ENV": "prod", "DEPLOY_REGION": "eu=1"}, ev.EnvVars)
+	ev = <-events.Channel()
+	assert.Equal(t, "name-id3", ev.ContainerName)
+	assert.Nil(t, ev.EnvVars, "nothing allowed")
+	ev = <-events.Channel()
+	assert.Equal(t, ReasonRemoved, ev.Reason)
+	assert.Equal(t, map[string]string{"DEPLOY_ENV": "prod", "DEPLOY_REGION": "eu=1"}, ev.EnvVars, "destroy event from cache")
+	ev = <-events.Channel()
+	assert.True(t, ev.Status, "started again after destroy")
+	assert.Equal(t, map[string]string{"DEPLOY_ENV": "prod", "DEPLOY_REGION": "eu=1"}, ev.EnvVars)
+
+	assert.Equal(t, map[string]int{"id1": 1, "id2": 2, "id3": 1}, client.inspectCalls(), "cached until destroyed")
+}
+
+func TestEventsEnvForgottenFiltered(t *testing.T) {
+	client := &mockInspectClient{
+		mockDockerClient: mockDockerClient{containers: []dockerclient.APIContainers{{ID: "id1", Names: []string{"/web"}}}},
+		inspected:        map[string]*dockerclient.Container{"id1": {Config: &dockerclient.Config{Env: []string{"APP_VERSION=1.2"}}}},
+	}
+	events, err := NewEventNotif(client, nil, nil, "", "", WithEnvAllowlist("APP_VERSION"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"APP_VERSION": "1.2"}, (<-events.Channel()).EnvVars)
+	require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, events.UpdateFilters([]string{"web"}, nil, "", ""))
+	client.send(&dockerclient.APIEvents{Type: "container", Status: "destroy",
+		Actor: dockerclient.APIActor{ID: "id1", Attributes: map[string]string{"name": "web"}}})
+	require.Eventually(t, func() bool {
+		events.envs.Lock()
+		defer events.envs.Unlock()
+		return len(events.envs.items) == 0
+	}, time.Second, 5*time.Millisecond, "destroyed container forgotten, even if filtered out")
+}
+
+func TestEventsEnvDisabled(t *testing.T) {
+	client := &mockInspectClient{
+		mockDockerClient: mockDockerClient{containers: []dockerclient.APIContainers{{ID: "id1", Names: []string{"/web"}}}},
+		inspected:        map[string]*dockerclient.Container{"id1": {Config: &dockerclient.Config{Env: []string{"APP_VERSION=1.2"}}}},
+	}
+	events, err := NewEventNotif(client, nil, nil, "", "", WithEnvAllowlist())
+	require.NoError(t, err)
+	ev := <-events.Channel()
+	assert.Nil(t, ev.EnvVars)
+	assert.Empty(t, client.inspectCalls(), "no inspect without allowlist")
+}
+
+func TestEnvCacheIsAllowed(t *testing.T) {
+	c := envCache{keys: []string{"APP_VERSION", "DEPLOY_*"}}
+	assert.True(t, c.isAllowed("APP_VERSION"))
+	assert.False(t, c.isAllowed("APP_VERSION_2"))
+	assert.False(t, c.isAllowed("app_version"))
+	assert.True(t, c.isAllowed("DEPLOY_ENV"))
+	assert.True(t, c.isAllowed("DEPLOY_"))
+	assert.False(t, c.isAllowed("DEPLOY"))
+}
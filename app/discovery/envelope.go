@@ -0,0 +1,251 @@
+package discovery
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// EventSchemaVersion is the version of json envelope made by MarshalEvent.
+//
+// Compatibility: new optional payload fields can be added within the same version, so consumers should ignore
+// unknown fields. Renamed or removed fields, or changed meaning of existing ones, bump the version.
+// UnmarshalEvent accepts envelopes of this and older versions only.
+const EventSchemaVersion = 1
+
+// envelope types
+const (
+	EventTypeUp    = "container.up"
+	EventTypeDown  = "container.down"
+	EventTypeImage = "container.image" // image of running container pulled or tagged
+
+	EventTypeCollectionStarted = "collection.started" // docker-logger started collecting container's logs
+	EventTypeCollectionStopped = "collection.stopped" // docker-logger stopped collecting container's logs
+
+	EventTypeCollectionSuppressed = "collection.suppressed" // collection of crash looping container's logs suppressed
+	EventTypeCollectionResumed    = "collection.resumed"    // collection of suppressed container resumed, as it's stable
+
+	EventTypeDaemon = "daemon.event" // non-container docker event, details in payload's daemon field
+
+	EventTypeScanDone = "scan.done" // initial scan of running containers completed, no container in payload
+
+	EventTypeDeployment = "compose.deployment" // compose project's containers started together, in payload's deployment field
+
+	EventTypeKeepalive = "container.keepalive" // tracked container still running, payload as of its up event
+)
+
+// envelope is a versioned json representation of Event, decoupled from Event struct layout
+type envelope struct {
+	SchemaVersion int          `json:"schema_version"`
+	Type          string       `json:"type"`
+	Payload       eventPayload `json:"payload"`
+}
+
+type eventPayload struct {
+	ContainerID   string            `json:"container_id"`
+	ContainerName string            `json:"container_name"`
+	RawName       string            `json:"raw_name,omitempty"`
+	Group         string            `json:"group,omitempty"`
+	Image         string            `json:"image,omitempty"`
+	TS            time.Time         `json:"ts"`
+	Host          string            `json:"host,omitempty"`
+	Source        string            `json:"source,omitempty"`
+	Reason        string            `json:"reason,omitempty"`
+	NodeID        string            `json:"node_id,omitempty"`
+	Seq           uint64            `json:"seq,omitempty"`
+	FromScan      bool              `json:"from_scan,omitempty"`
+	LogFilePath   string            `json:"log_file,omitempty"`
+	ErrFilePath   string            `json:"err_file,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	Env           map[string]string `json:"env,omitempty"`
+	K8s           *k8sPayload       `json:"k8s,omitempty"`
+	Network       *networkPayload   `json:"network,omitempty"`
+	Daemon        *daemonPayload    `json:"daemon,omitempty"`
+	Deployment    *deployPayload    `json:"deployment,omitempty"`
+}
+
+type deployPayload struct {
+	Project    string            `json:"project"`
+	Containers []deployedPayload `json:"containers"`
+}
+
+type deployedPayload struct {
+	ContainerID   string `json:"container_id"`
+	ContainerName string `json:"container_name"`
+	Service       string `json:"service,omitempty"`
+}
+
+type daemonPayload struct {
+	Type       string            `json:"type"`
+	Action     string            `json:"action"`
+	ActorID    string            `json:"actor_id,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+type k8sPayload struct {
+	Pod       string `json:"pod,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	PodUID    string `json:"pod_uid,omitempty"`
+	Container string `json:"container,omitempty"`
+}
+
+type networkPayload struct {
+	IP    string            `json:"ip,omitempty"`
+	IPs   map[string]string `json:"ips,omitempty"`
+	Ports []portPayload     `json:"ports,omitempty"`
+}
+
+type portPayload struct {
+	Private int    `json:"private"`
+	Public  int    `json:"public,omitempty"`
+	Proto   string `json:"proto,omitempty"`
+	HostIP  string `json:"host_ip,omitempty"`
+}
+
+// MarshalEvent makes versioned json envelope of the event, i.e.
+// {"schema_version":1,"type":"container.up","payload":{"container_id":"...","container_name":"...",...}}.
+// Raw docker event is not included.
+func MarshalEvent(event Event) ([]byte, error) {
+	env := envelope{SchemaVersion: EventSchemaVersion, Type: EventTypeDown, Payload: eventPayload{
+		ContainerID:   event.ContainerID,
+		ContainerName: event.ContainerName,
+		RawName:       event.RawName,
+		Group:         event.Group,
+		Image:         event.Image,
+		TS:            event.TS,
+		Host:          event.Host,
+		Source:        event.Source,
+		Reason:        event.Reason.String(),
+		NodeID:        event.NodeID,
+		Seq:           event.Seq,
+		FromScan:      event.FromScan,
+		LogFilePath:   event.LogFilePath,
+		ErrFilePath:   event.ErrFilePath,
+		Labels:        event.Labels,
+		Env:           event.EnvVars,
+	}}
+	switch {
+	case event.Type == EventImage:
+		env.Type = EventTypeImage
+	case event.Type == EventCollect && event.Status:
+		env.Type = EventTypeCollectionStarted
+	case event.Type == EventCollect:
+		env.Type = EventTypeCollectionStopped
+	case event.Type == EventSuppress && event.Status:
+		env.Type = EventTypeCollectionSuppressed
+	case event.Type == EventSuppress:
+		env.Type = EventTypeCollectionResumed
+	case event.Type == EventDaemon:
+		env.Type = EventTypeDaemon
+	case event.Type == EventScanDone:
+		env.Type = EventTypeScanDone
+	case event.Type == EventDeploy:
+		env.Type = EventTypeDeployment
+	case event.Type == EventKeepalive:
+		env.Type = EventTypeKeepalive
+	case event.Status:
+		env.Type = EventTypeUp
+	}
+	if event.K8s != nil {
+		env.Payload.K8s = &k8sPayload{Pod: event.K8s.Pod, Namespace: event.K8s.Namespace, PodUID: event.K8s.PodUID,
+			Container: event.K8s.Container}
+	}
+	if event.Daemon != nil {
+		env.Payload.Daemon = &daemonPayload{Type: event.Daemon.Type, Action: event.Daemon.Action, ActorID: event.Daemon.ActorID,
+			Attributes: event.Daemon.Attributes}
+	}
+	if event.Deployment != nil {
+		env.Payload.Deployment = &deployPayload{Project: event.Deployment.Project, Containers: []deployedPayload{}}
+		for _, c := range event.Deployment.Containers {
+			env.Payload.Deployment.Containers = append(env.Payload.Deployment.Containers,
+				deployedPayload{ContainerID: c.ID, ContainerName: c.Name, Service: c.Service})
+		}
+	}
+	if event.Network != nil {
+		env.Payload.Network = &networkPayload{IP: event.Network.IP, IPs: event.Network.IPs}
+		for _, p := range event.Network.Ports {
+			env.Payload.Network.Ports = append(env.Payload.Network.Ports,
+				portPayload{Private: p.Private, Public: p.Public, Proto: p.Proto, HostIP: p.HostIP})
+		}
+	}
+	return json.Marshal(env)
+}
+
+// UnmarshalEvent parses json envelope made by MarshalEvent
+func UnmarshalEvent(data []byte) (Event, error) {
+	env := envelope{}
+	if err := json.Unmarshal(data, &env); err != nil {
+		return Event{}, errors.Wrap(err, "can't unmarshal event envelope")
+	}
+	if env.SchemaVersion < 1 || env.SchemaVersion > EventSchemaVersion {
+		return Event{}, errors.Errorf("unsupported event schema version %d", env.SchemaVersion)
+	}
+	switch env.Type {
+	case EventTypeUp, EventTypeDown, EventTypeImage, EventTypeCollectionStarted, EventTypeCollectionStopped, EventTypeDaemon,
+		EventTypeScanDone, EventTypeDeployment, EventTypeKeepalive, EventTypeCollectionSuppressed, EventTypeCollectionResumed:
+	default:
+		return Event{}, errors.Errorf("unknown event type %q", env.Type)
+	}
+
+	p := env.Payload
+	status := env.Type == EventTypeUp || env.Type == EventTypeCollectionStarted || env.Type == EventTypeKeepalive ||
+		env.Type == EventTypeCollectionSuppressed
+	res := Event{
+		ContainerID:   p.ContainerID,
+		ContainerName: p.ContainerName,
+		RawName:       p.RawName,
+		Group:         p.Group,
+		Image:         p.Image,
+		TS:            p.TS,
+		Status:        status,
+		Host:          p.Host,
+		Source:        p.Source,
+		Reason:        parseReason(p.Reason),
+		NodeID:        p.NodeID,
+		Seq:           p.Seq,
+		FromScan:      p.FromScan,
+		LogFilePath:   p.LogFilePath,
+		ErrFilePath:   p.ErrFilePath,
+		Labels:        p.Labels,
+		EnvVars:       p.Env,
+	}
+	switch env.Type {
+	case EventTypeImage:
+		res.Type = EventImage
+	case EventTypeCollectionStarted, EventTypeCollectionStopped:
+		res.Type = EventCollect
+	case EventTypeCollectionSuppressed, EventTypeCollectionResumed:
+		res.Type = EventSuppress
+	case EventTypeDaemon:
+		res.Type = EventDaemon
+	case EventTypeScanDone:
+		res.Type = EventScanDone
+	case EventTypeDeployment:
+		res.Type = EventDeploy
+	case EventTypeKeepalive:
+		res.Type = EventKeepalive
+	}
+	if p.Deployment != nil {
+		res.Deployment = &Deployment{Project: p.Deployment.Project}
+		for _, c := range p.Deployment.Containers {
+			res.Deployment.Containers = append(res.Deployment.Containers,
+				DeploymentContainer{ID: c.ContainerID, Name: c.ContainerName, Service: c.Service})
+		}
+	}
+	if p.Daemon != nil {
+		res.Daemon = &DaemonEvent{Type: p.Daemon.Type, Action: p.Daemon.Action, ActorID: p.Daemon.ActorID,
+			Attributes: p.Daemon.Attributes}
+	}
+	if p.K8s != nil {
+		res.K8s = &K8sMeta{Pod: p.K8s.Pod, Namespace: p.K8s.Namespace, PodUID: p.K8s.PodUID, Container: p.K8s.Container}
+	}
+	if p.Network != nil {
+		res.Network = &Network{IP: p.Network.IP, IPs: p.Network.IPs}
+		for _, port := range p.Network.Ports {
+			res.Network.Ports = append(res.Network.Ports,
+				Port{Private: port.Private, Public: port.Public, Proto: port.Proto, HostIP: port.HostIP})
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,120 @@
+package discovery
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshalEvent(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 123, time.UTC)
+	data, err := MarshalEvent(Event{ContainerID: "id1", ContainerName: "c1", RawName: "raw1", Group: "g1", Image: "img1", TS: ts,
+		Status: true, Host: "h1", Source: "s1", NodeID: "node1", Labels: map[string]string{"k": "v"}})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"schema_version":1,"type":"container.up","payload":{"container_id":"id1","container_name":"c1",
+		"raw_name":"raw1","group":"g1","image":"img1","ts":"2024-05-01T10:00:00.000000123Z","host":"h1","source":"s1","node_id":"node1",
+		"labels":{"k":"v"}}}`,
+		string(data))
+
+	data, err = MarshalEvent(Event{ContainerID: "id1", ContainerName: "c1", TS: ts, Reason: ReasonOOMKilled,
+		K8s: &K8sMeta{Pod: "web-1", Namespace: "ns1"}})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"schema_version":1,"type":"container.down","payload":{"container_id":"id1","container_name":"c1",
+		"ts":"2024-05-01T10:00:00.000000123Z","reason":"oom-killed","k8s":{"pod":"web-1","namespace":"ns1"}}}`, string(data))
+
+	data, err = MarshalEvent(Event{ContainerID: "id1", ContainerName: "c1", TS: ts, Status: true, Type: EventCollect})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"schema_version":1,"type":"collection.started","payload":{"container_id":"id1","container_name":"c1",
+		"ts":"2024-05-01T10:00:00.000000123Z"}}`, string(data))
+
+	data, err = MarshalEvent(Event{ContainerID: "id1", ContainerName: "c1", TS: ts, Status: true, Type: EventSuppress})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"schema_version":1,"type":"collection.suppressed","payload":{"container_id":"id1","container_name":"c1",
+		"ts":"2024-05-01T10:00:00.000000123Z"}}`, string(data))
+
+	data, err = MarshalEvent(Event{TS: ts, Type: EventDaemon, Daemon: &DaemonEvent{Type: "volume", Action: "unmount", ActorID: "vol1"}})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"schema_version":1,"type":"daemon.event","payload":{"container_id":"","container_name":"",
+		"ts":"2024-05-01T10:00:00.000000123Z","daemon":{"type":"volume","action":"unmount","actor_id":"vol1"}}}`, string(data))
+
+	data, err = MarshalEvent(Event{ContainerID: "id1", ContainerName: "c1", TS: ts, Status: true, Seq: 7})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"schema_version":1,"type":"container.up","payload":{"container_id":"id1","container_name":"c1",
+		"ts":"2024-05-01T10:00:00.000000123Z","seq":7}}`, string(data))
+
+	data, err = MarshalEvent(Event{ContainerID: "id1", ContainerName: "c1", TS: ts, Status: true, FromScan: true})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"schema_version":1,"type":"container.up","payload":{"container_id":"id1","container_name":"c1",
+		"ts":"2024-05-01T10:00:00.000000123Z","from_scan":true}}`, string(data))
+
+	data, err = MarshalEvent(Event{TS: ts, Type: EventDeploy, Deployment: &Deployment{Project: "shop",
+		Containers: []DeploymentContainer{{ID: "id1", Name: "shop-web-1", Service: "web"}}}})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"schema_version":1,"type":"compose.deployment","payload":{"container_id":"","container_name":"",
+		"ts":"2024-05-01T10:00:00.000000123Z","deployment":{"project":"shop","containers":[{"container_id":"id1",
+		"container_name":"shop-web-1","service":"web"}]}}}`, string(data))
+
+	data, err = MarshalEvent(Event{TS: ts, Host: "h1", Type: EventScanDone})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"schema_version":1,"type":"scan.done","payload":{"container_id":"","container_name":"",
+		"ts":"2024-05-01T10:00:00.000000123Z","host":"h1"}}`, string(data))
+}
+
+func TestMarshalEventRoundTrip(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 123, time.UTC)
+	tbl := []Event{
+		{ContainerID: "id1", ContainerName: "c1", TS: ts, Status: true},
+		{ContainerID: "id1", ContainerName: "c1", Group: "g1", Image: "img1", TS: ts, Host: "h1", Source: "s1",
+			Reason: ReasonCrashed, Labels: map[string]string{"k": "v"}},
+		{ContainerID: "id2", ContainerName: "c2", TS: ts, Status: true,
+			K8s: &K8sMeta{Pod: "web-1", Namespace: "ns1", PodUID: "uid1", Container: "web"}},
+		{ContainerID: "id3", ContainerName: "c3", TS: ts, Reason: ReasonRemoved},
+		{ContainerID: "id8", ContainerName: "web-1", RawName: "web.1.abc", TS: ts, Status: true, NodeID: "node1"},
+		{ContainerID: "id10", ContainerName: "c10", TS: ts, Status: true, Seq: 42},
+		{ContainerID: "id11", ContainerName: "c11", TS: ts, Status: true, FromScan: true},
+		{ContainerID: "id12", ContainerName: "c12", TS: ts, Status: true, EnvVars: map[string]string{"APP_VERSION": "1.2"}},
+		{ContainerID: "id9", ContainerName: "c9", TS: ts, Status: true, LogFilePath: "logs/c9.log", ErrFilePath: "logs/c9.err"},
+		{ContainerID: "id4", ContainerName: "c4", Image: "nginx:1.25", TS: ts, Type: EventImage},
+		{ContainerID: "id6", ContainerName: "c6", TS: ts, Status: true, Type: EventCollect},
+		{ContainerID: "id6", ContainerName: "c6", TS: ts, Type: EventCollect},
+		{ContainerID: "id6", ContainerName: "c6", TS: ts, Status: true, Type: EventSuppress},
+		{ContainerID: "id6", ContainerName: "c6", TS: ts, Type: EventSuppress},
+		{ContainerID: "id7", TS: ts, Type: EventDaemon, Daemon: &DaemonEvent{Type: "network", Action: "disconnect", ActorID: "net1",
+			Attributes: map[string]string{"name": "bridge", "container": "id7"}}},
+		{TS: ts, Host: "h1", Source: "s1", Type: EventScanDone},
+		{ContainerID: "id1", ContainerName: "web", Image: "nginx", TS: ts, Status: true, Type: EventKeepalive},
+		{TS: ts, Host: "h1", Type: EventDeploy, Deployment: &Deployment{Project: "shop",
+			Containers: []DeploymentContainer{{ID: "id1", Name: "shop-web-1", Service: "web"}, {ID: "id2", Name: "db"}}}},
+		{ContainerID: "id5", ContainerName: "c5", TS: ts, Status: true, Network: &Network{IP: "172.17.0.2",
+			IPs: map[string]string{"bridge": "172.17.0.2"}, Ports: []Port{{Private: 80, Public: 8080, Proto: "tcp", HostIP: "0.0.0.0"}}}},
+	}
+	for i, event := range tbl {
+		data, err := MarshalEvent(event)
+		require.NoError(t, err, "case #%d", i)
+		res, err := UnmarshalEvent(data)
+		require.NoError(t, err, "case #%d", i)
+		assert.Equal(t, event, res, "case #%d", i)
+	}
+}
+
+func TestUnmarshalEventErrors(t *testing.T) {
+	tbl := []struct {
+		data string
+		err  string
+	}{
+		{`not json`, "can't unmarshal event envelope"},
+		{`{"type":"container.up","payload":{}}`, "unsupported event schema version 0"},
+		{`{"schema_version":2,"type":"container.up","payload":{}}`, "unsupported event schema version 2"},
+		{`{"schema_version":1,"type":"other","payload":{}}`, `unknown event type "other"`},
+	}
+	for i, tt := range tbl {
+		_, err := UnmarshalEvent([]byte(tt.data))
+		assert.ErrorContains(t, err, tt.err, "case #%d", i)
+	}
+
+	res, err := UnmarshalEvent([]byte(`{"schema_version":1,"type":"container.up","payload":{"container_id":"id1","new":1}}`))
+	require.NoError(t, err, "unknown fields ignored")
+	assert.Equal(t, "id1", res.ContainerID)
+}
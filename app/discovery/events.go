@@ -1,12 +1,15 @@
 package discovery
 
 import (
+	"os"
 	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/expr-lang/expr/vm"
 	docker "github.com/fsouza/go-dockerclient"
-	log "github.com/go-pkgz/lgr"
 	"github.com/pkg/errors"
 )
 
@@ -18,15 +21,140 @@ type EventNotif struct {
 	includesRegexp *regexp.Regexp
 	excludesRegexp *regexp.Regexp
 	eventsCh       chan Event
+	host           string
+	source         string
+	backoff        Backoff
+	includeCmd     *regexp.Regexp
+	excludeCmd     *regexp.Regexp
+	commands       map[string]string // container id to command, for live events matching
+	cmdLock        sync.Mutex
+	withRaw        bool
+	watchdog       time.Duration
+	tracked        *registry       // running containers by id, as emitted
+	ooms           map[string]bool // containers with oom event waiting for die
+	created        map[string]time.Time
+	trackLock      sync.Mutex
+	stats          counters // guarded by trackLock
+	strictFilters  bool
+	precedence     Precedence
+	anchorPatterns bool
+	maxContainers  int
+	priorityGroups []string
+	skipped        map[string]bool // containers skipped due to max containers limit, not admitted since
+	waiting        []Event         // start events of running skipped containers, in order skipped
+	paused         map[string]bool // containers marked paused, with PauseMarkPaused
+	groupLabels    []string        // labels checked for group name, in priority order
+	pauseBehavior  PauseBehavior
+	splitRestart   bool
+	withK8s        bool
+	normGroups     bool
+	inspects       *inspectCache // nil if inspect fallback disabled
+	networks       *networkCache // nil if network info disabled
+	envs           *envCache     // nil if environment variables disabled
+	imageEvents    bool
+	daemonTypes    map[string]bool
+	scanMarker     bool
+	scanRetries    int
+	scanProceed    bool
+	connectBackoff *Backoff // backoff of initial scan retries, nil for reconnect backoff
+	reconnectLimit int
+	reconnectLog   time.Duration
+	failed         chan struct{} // closed once reconnects exhausted or consumer stalled, see fail
+	failErr        error         // reason of failure, set before failed closed
+	failOnce       sync.Once
+	stallTimeout   time.Duration
+	stallAction    StallAction
+	resyncCh       chan struct{} // resync requests, see Resync
+	stripRegistry  bool
+	selfLogs       bool
+	selfID         string // own container id, prefix match as hostname has short id
+	selfLabel      string
+	skipLabels     []string
+	infraExcludes  []*regexp.Regexp
+	filterExprSrc  string
+	filterExpr     *vm.Program
+	minReplica     int // swarm replica range, zero for no bound
+	maxReplica     int
+	shardCount     int // shards of containers, disabled if 0 or 1
+	shardIndex     int
+	includeTTY     bool
+	excludeTTY     bool
+	configs        *configCache // nil if tty and runtime filters disabled
+	incRuntimes    []string
+	excRuntimes    []string
+	incPlatforms   []string
+	excPlatforms   []string
+	filterLock     sync.RWMutex // protects name filters changed by UpdateFilters
+	filterVersion  int
+	active         activeFilters  // name filters defined, guarded by filterLock
+	allowAll       atomic.Bool    // no name filters defined, fast path of isAllowed
+	decisions      *decisionCache // nil if disabled
+	recorder       *RawEventRecorder
+	replaying      bool // events fed by Replay
+	maxEventAge    time.Duration
+	coalesceUp     time.Duration
+	coalesceDown   time.Duration
+	bursts         map[coalesceKey]time.Time // first events of coalesced bursts, used by listener only
+	ageLive        bool
+	deployWindow   time.Duration
+	deployments    map[string]*deploymentBurst // pending deployments by project, used by listener only
+	keepalive      time.Duration
+	subs           subscriptions
+	sendLock       sync.Mutex // serializes send, so events delivered in Seq order
+	withSeq        bool
+	seq            uint64 // last assigned Seq, guarded by sendLock
+	logger         Logger
 }
 
 // Event is simplified docker.APIEvents for containers only, exposed to caller
 type Event struct {
 	ContainerID   string
-	ContainerName string
+	ContainerName string // resolved name, i.e. service-replica of swarm task or from logger.container.name label
+	RawName       string // docker's name of the container, without leading slash
 	Group         string // group is the "path" part of the image tag, i.e. for umputun/system/logger:latest it will be "system"
+	Image         string // image the container made from
 	TS            time.Time
 	Status        bool
+	Host          string // host identifier of docker daemon, set with WithHost option
+	Source        string // identifier of docker-logger instance, os hostname by default
+	Reason        Reason // why container went down, ReasonNone for up events
+	NodeID        string // swarm node running the task, from com.docker.swarm.node.id label, empty for non-swarm containers
+	Seq           uint64 // position in the stream of EventNotif, from 1, set with WithSequence option only
+	FromScan      bool   // set for up events of the initial scan of running containers, not set for live events and resyncs
+
+	// Created is container's creation time, from the initial scan or container's create event, zero if unknown.
+	// The same for all starts of the container, differs for a new container with the same name.
+	Created time.Time
+
+	// Type of the event, lifecycle by default. Image events emitted with WithImageEvents option only.
+	Type EventType
+
+	// Labels of the container. For live events these are all actor's attributes, including labels.
+	Labels map[string]string
+
+	// K8s is kubernetes pod metadata, set with WithK8sMeta option for containers with io.kubernetes.* labels only
+	K8s *K8sMeta
+
+	// Network is container's addresses and ports, set with WithNetwork option for up events only
+	Network *Network
+
+	// EnvVars is container's environment variables allowed by WithEnvAllowlist option, nil if none allowed
+	EnvVars map[string]string
+
+	// LogFilePath and ErrFilePath are files collector writes container's stdout and stderr to, the same file
+	// if mixed. Set by collector with SetLogFiles, empty if not written to files.
+	LogFilePath string
+	ErrFilePath string
+
+	// Daemon is non-container docker event, set for EventDaemon typed events only
+	Daemon *DaemonEvent
+
+	// Deployment is compose project's containers started together, set for EventDeploy typed events only
+	Deployment *Deployment
+
+	// Raw is the original docker event, set with WithRawEvents option only.
+	// Always nil for events emitted by the initial scan, as those made from ListContainers and not from events.
+	Raw *docker.APIEvents
 }
 
 // DockerClient defines interface listing containers and subscribing to events
@@ -35,49 +163,90 @@ type DockerClient interface {
 	AddEventListener(listener chan<- *docker.APIEvents) error
 }
 
-var reGroup = regexp.MustCompile(`/(.*?)/`)
-var reSwarm = regexp.MustCompile(`(?m)(.*)\.(\d+)\.(.*)`)
-
-// NewEventNotif makes EventNotif publishing all changes to eventsCh
-func NewEventNotif(dockerClient DockerClient, excludes, includes []string, includesPattern, excludesPattern string) (*EventNotif, error) {
-	log.Printf("[DEBUG] create events notif, excludes: %+v, includes: %+v, includesPattern: %+v, excludesPattern: %+v",
-		excludes, includes, includesPattern, excludesPattern)
+// eventsBuffer is the default size of events channel buffer
+const eventsBuffer = 100
 
-	var err error
-	var includesRe *regexp.Regexp
-	if includesPattern != "" {
-		includesRe, err = regexp.Compile(includesPattern)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to compile includesPattern")
-		}
-	}
+var reGroup = regexp.MustCompile(`/(.*?)/`)
 
-	var excludesRe *regexp.Regexp
-	if excludesPattern != "" {
-		excludesRe, err = regexp.Compile(excludesPattern)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to compile excludesPattern")
-		}
-	}
+// swarmNodeLabel is set by swarm on task containers, id of the node running the task
+const swarmNodeLabel = "com.docker.swarm.node.id"
 
-	res := EventNotif{
-		dockerClient:   dockerClient,
-		excludes:       excludes,
-		includes:       includes,
-		includesRegexp: includesRe,
-		excludesRegexp: excludesRe,
-		eventsCh:       make(chan Event, 100),
+// NewEventNotif makes EventNotif publishing all changes to eventsCh
+func NewEventNotif(dockerClient DockerClient, excludes, includes []string, includesPattern, excludesPattern string,
+	opts ...Option) (*EventNotif, error) {
+	res, err := newEventNotif(dockerClient, excludes, includes, includesPattern, excludesPattern, opts...)
+	if err != nil {
+		return nil, err
 	}
 
 	// first get all currently running containers
 	if err := res.emitRunningContainers(); err != nil {
-		return nil, errors.Wrap(err, "failed to emit containers")
+		if !res.scanProceed {
+			return nil, errors.Wrap(err, "failed to emit containers")
+		}
+		res.log().Logf("[WARN] initial scan failed, proceed with live events only, %v", err)
 	}
 
 	go func() {
 		res.activate(dockerClient) // activate listener for new container events
 	}()
 
+	return res, nil
+}
+
+// newEventNotif makes configured EventNotif, not started
+func newEventNotif(dockerClient DockerClient, excludes, includes []string, includesPattern, excludesPattern string,
+	opts ...Option) (*EventNotif, error) {
+	res := EventNotif{
+		dockerClient: dockerClient,
+		excludes:     excludes,
+		includes:     includes,
+		eventsCh:     make(chan Event, eventsBuffer),
+		failed:       make(chan struct{}),
+		resyncCh:     make(chan struct{}, 1),
+		backoff:      Backoff{Min: time.Second, Max: time.Minute, Jitter: FullJitter},
+		commands:     map[string]string{},
+		tracked:      newRegistry(),
+		skipped:      map[string]bool{},
+		paused:       map[string]bool{},
+		ooms:         map[string]bool{},
+		created:      map[string]time.Time{},
+		groupLabels:  []string{"logger.group.name"},
+		selfID:       detectSelfID(),
+		selfLabel:    "logger.self",
+	}
+	for _, opt := range opts {
+		opt(&res)
+	}
+	res.log().Logf("[DEBUG] create events notif, excludes: %+v, includes: %+v, includesPattern: %+v, excludesPattern: %+v",
+		excludes, includes, includesPattern, excludesPattern)
+	if res.selfID != "" {
+		res.log().Logf("[DEBUG] own container id %s", res.selfID)
+	}
+	includesRe, excludesRe, err := compilePatterns(includesPattern, excludesPattern, res.anchorPatterns)
+	if err != nil {
+		return nil, err
+	}
+	res.includesRegexp, res.excludesRegexp = includesRe, excludesRe
+	if res.filterExpr, err = compileFilterExpr(res.filterExprSrc); err != nil {
+		return nil, err
+	}
+	if err := res.validateFilters(); err != nil {
+		return nil, err
+	}
+	res.setActiveFilters()
+	if err := res.validateDaemonTypes(); err != nil {
+		return nil, err
+	}
+	if err := res.validateShard(); err != nil {
+		return nil, err
+	}
+	if res.source == "" {
+		res.source = "unknown"
+		if h, err := os.Hostname(); err == nil {
+			res.source = h
+		}
+	}
 	return &res, nil
 }
 
@@ -87,98 +256,398 @@ func (e *EventNotif) Channel() (res <-chan Event) {
 }
 
 // activate starts blocking listener for all docker events
-// filters everything except "container" type, detects stop/start events and publishes to eventsCh
+// filters everything except "container" type, detects stop/start events and publishes to eventsCh.
+// Reconnects with backoff if listener can't be added or closed by docker client, up to reconnect limit if set.
+// Until the first listener added, retries made with connect backoff and limited as the initial connect.
+// Re-subscribes and resyncs containers state if watchdog detects listener went quiet.
 func (e *EventNotif) activate(client DockerClient) {
-	dockerEventsCh := make(chan *docker.APIEvents)
-	if err := client.AddEventListener(dockerEventsCh); err != nil {
-		log.Fatalf("[ERROR] can't add even listener, %v", err)
+	var attempt int
+	var delay time.Duration
+	var down outage
+	var subscribed bool
+	for {
+		dockerEventsCh := make(chan *docker.APIEvents, listenerBuffer)
+		if err := client.AddEventListener(dockerEventsCh); err != nil {
+			backoff := e.backoff
+			if !subscribed {
+				backoff = e.scanBackoff()
+			}
+			if (!subscribed && e.subscribeGiveUp(attempt)) || (subscribed && e.giveUp(attempt)) {
+				return
+			}
+			delay = backoff.delay(attempt, delay)
+			attempt++
+			e.reconnectFailed(&down, "can't add event listener, "+err.Error(), attempt, delay)
+			time.Sleep(delay)
+			continue
+		}
+		if !subscribed {
+			subscribed = true
+			attempt, delay = 0, 0 // the initial connect done, reconnects counted from scratch
+		}
+
+		e.setConnected(true)
+		delivered, stale := e.listen(dockerEventsCh, &down)
+		e.setConnected(false)
+		if e.Err() != nil {
+			e.unsubscribe(client, dockerEventsCh) // given up, i.e. stalled consumer, nothing emitted anymore
+			return
+		}
+		if delivered {
+			attempt, delay = 0, 0 // listener was functional, start backoff from scratch
+		}
+		if stale {
+			e.unsubscribe(client, dockerEventsCh)
+			// resync in background, as it may block on eventsCh and listener should be re-added right away
+			go func() {
+				if err := e.resync(); err != nil {
+					e.log().Logf("[WARN] resync failed, %v", err)
+				}
+			}()
+			continue
+		}
+		if e.giveUp(attempt) {
+			return
+		}
+		delay = e.backoff.delay(attempt, delay)
+		attempt++
+		e.reconnectFailed(&down, "event listener closed", attempt, delay)
+		time.Sleep(delay)
 	}
+}
 
-	upStatuses := []string{"start", "restart"}
+// listen reads docker events until channel closed and publishes container events to eventsCh.
+// Returns delivered=true if at least one event was received and stale=true if watchdog interval passed with no events.
+// Resyncs containers once the buffer drained after overflow, as docker client drops events not received right away.
+// Pending deployments reported on return, as the next listener may never see the rest of their starts.
+// Returns right away once given up, with Failed channel closed. Outage of failed reconnects ends on the first event.
+func (e *EventNotif) listen(dockerEventsCh <-chan *docker.APIEvents, down *outage) (delivered, stale bool) {
+	var overflow bool // set if listener buffer got full, resync once drained
+	keepalive, stopKeepalive := e.keepaliveTicker()
+	defer stopKeepalive()
+	deploy := newDeployTimer()
+	defer deploy.stop()
+	watchdog := e.newWatchdogTimer() // reset by docker events only, so keepalives and resyncs don't postpone it
+	defer watchdog.stop()
+	defer func() {
+		if e.Err() == nil {
+			e.flushDeployments(true)
+		}
+	}()
+	for {
+		if e.Err() != nil {
+			return delivered, false
+		}
+		switch {
+		case overflowed(dockerEventsCh):
+			overflow = true
+		case overflow && len(dockerEventsCh) == 0:
+			overflow = false
+			e.recoverOverflow()
+		}
+		select {
+		case dockerEvent, ok := <-dockerEventsCh:
+			if !ok {
+				return delivered, false
+			}
+			if !delivered {
+				e.reconnected(down)
+			}
+			watchdog.reset()
+			delivered = true
+			e.record(dockerEvent)
+			e.processEvent(dockerEvent)
+		case <-watchdog.C():
+			e.log().Logf("[WARN] no docker events for %v, re-subscribe", e.watchdog)
+			return delivered, true
+		case <-e.resyncCh:
+			if err := e.resync(); err != nil {
+				e.log().Logf("[WARN] requested resync failed, %v", err)
+			}
+		case <-e.deploymentDue(deploy):
+			deploy.fired()
+			e.flushDeployments(false)
+		case <-keepalive:
+			e.emitKeepalives()
+		case <-e.failed:
+			return delivered, false
+		}
+	}
+}
+
+// processEvent filters docker event and publishes allowed container's start/stop to eventsCh
+func (e *EventNotif) processEvent(dockerEvent *docker.APIEvents) {
+	upStatuses := []string{"start", "restart", "unpause"}
 	downStatuses := []string{"die", "destroy", "stop", "pause"}
 
-	for dockerEvent := range dockerEventsCh {
-		if dockerEvent.Type != "container" {
-			continue
-		}
+	if dockerEvent.Type == "container" && dockerEvent.Status == "destroy" {
+		// forgotten on any return, even if stale or filtered out, cached values used by filters meanwhile
+		defer e.forgetCommand(dockerEvent.Actor.ID)
+		defer e.forgetConfig(dockerEvent.Actor.ID)
+		defer e.forgetInspect(dockerEvent.Actor.ID)
+	}
+	if dockerEvent.Type == "image" {
+		e.forgetPlatform(dockerEvent) // forgotten even if stale
+	}
 
-		if !contains(dockerEvent.Status, upStatuses) && !contains(dockerEvent.Status, downStatuses) {
-			continue
+	if e.isStale(dockerEvent) {
+		return
+	}
+
+	if dockerEvent.Type == "image" && e.imageEvents {
+		e.processImageEvent(dockerEvent)
+		return
+	}
+
+	if e.daemonTypes[dockerEvent.Type] {
+		e.processDaemonEvent(dockerEvent)
+		return
+	}
+
+	if dockerEvent.Type != "container" {
+		return
+	}
+
+	if dockerEvent.Status == "oom" {
+		e.markOOM(dockerEvent.Actor.ID) // not an event on its own, makes the following die oom-killed
+		return
+	}
+
+	if dockerEvent.Status == "create" {
+		if ts, ok := eventTime(dockerEvent); ok {
+			e.markCreated(dockerEvent.Actor.ID, ts) // not an event on its own, sets Created of following ones
 		}
+		return
+	}
 
-		log.Printf("[DEBUG] api event %+v", dockerEvent)
-		containerName := buildContainerName(dockerEvent.Actor.Attributes, strings.TrimPrefix(dockerEvent.Actor.Attributes["name"], "/"))
-		groupName := buildGroupName(dockerEvent.Actor.Attributes, e.group(dockerEvent.From))
-		if !e.isAllowed(containerName) {
-			log.Printf("[INFO] container %s excluded", containerName)
-			continue
+	if !contains(dockerEvent.Status, upStatuses) && !contains(dockerEvent.Status, downStatuses) {
+		return
+	}
+
+	e.log().Logf("[DEBUG] api event %+v", dockerEvent)
+	created := e.createdAt(dockerEvent.Actor.ID, dockerEvent.Status == "destroy") // forgotten even if filtered out
+	var envVars map[string]string
+	if dockerEvent.Status == "destroy" {
+		envVars = e.forgetEnv(dockerEvent.Actor.ID) // forgotten even if filtered out
+	}
+	attrs, image := e.eventAttrs(dockerEvent)
+	containerName := buildContainerName(attrs, strings.TrimPrefix(attrs["name"], "/"))
+	groupName := e.groupName(attrs, image)
+	if e.isSelf(dockerEvent.Actor.ID, attrs) {
+		e.log().Logf("[DEBUG] own container %s excluded", containerName)
+		e.countFiltered()
+		return
+	}
+	if l := e.skipLabel(attrs); l != "" {
+		e.log().Logf("[INFO] container %s excluded by label %s", containerName, l)
+		e.countFiltered()
+		return
+	}
+	if !e.isAllowed(containerName) {
+		e.log().Logf("[INFO] container %s excluded", containerName)
+		e.countFiltered()
+		return
+	}
+	if !e.exprAllowed(exprEnv{ID: dockerEvent.Actor.ID, Name: containerName, RawName: strings.TrimPrefix(attrs["name"], "/"),
+		Group: groupName, Image: image, Host: e.host, Label: attrs}) {
+		e.log().Logf("[INFO] container %s excluded by %s", containerName, exclusionExpr)
+		e.countFiltered()
+		return
+	}
+	if !e.isReplicaAllowed(strings.TrimPrefix(attrs["name"], "/")) {
+		e.log().Logf("[INFO] container %s excluded by replica", containerName)
+		e.countFiltered()
+		return
+	}
+	if e.includeCmd != nil || e.excludeCmd != nil {
+		if !e.isCommandAllowed(e.command(dockerEvent.Actor.ID)) {
+			e.log().Logf("[INFO] container %s excluded by command", containerName)
+			e.countFiltered()
+			return
+		}
+	}
+	if e.configs != nil {
+		if excludedBy := e.configFilter(dockerEvent.Actor.ID); excludedBy != "" {
+			e.log().Logf("[INFO] container %s excluded by %s", containerName, excludedBy)
+			e.countFiltered()
+			return
 		}
+	}
 
-		event := Event{
-			ContainerID:   dockerEvent.Actor.ID,
-			ContainerName: containerName,
-			Status:        contains(dockerEvent.Status, upStatuses),
-			TS:            time.Unix(dockerEvent.Time/1000, dockerEvent.TimeNano),
-			Group:         groupName,
+	if e.markPaused(dockerEvent.Actor.ID, containerName, dockerEvent.Status) {
+		return
+	}
+
+	if dockerEvent.Status != "destroy" {
+		envVars = e.containerEnv(dockerEvent.Actor.ID, dockerEvent.Status)
+	}
+	event := Event{
+		ContainerID:   dockerEvent.Actor.ID,
+		ContainerName: containerName,
+		RawName:       strings.TrimPrefix(attrs["name"], "/"),
+		Status:        contains(dockerEvent.Status, upStatuses),
+		TS:            time.Unix(dockerEvent.Time/1000, dockerEvent.TimeNano),
+		Group:         groupName,
+		Image:         image,
+		Labels:        attrs,
+		Host:          e.host,
+		Source:        e.source,
+		Network:       e.eventNetwork(dockerEvent.Actor.ID, contains(dockerEvent.Status, upStatuses)),
+		EnvVars:       envVars,
+		Created:       created,
+	}
+	if !event.Status {
+		event.Reason = downReason(dockerEvent.Status, attrs,
+			dockerEvent.Status == "die" && e.takeOOM(dockerEvent.Actor.ID))
+	}
+	if e.withRaw {
+		event.Raw = dockerEvent
+	}
+	ts, ok := eventTime(dockerEvent)
+	if !ok {
+		ts = time.Now()
+	}
+	if dockerEvent.Status == "destroy" {
+		e.forgetBursts(event.ContainerID) // removal always passed
+	} else if e.coalesced(event.ContainerID, event.Status, ts) {
+		e.log().Logf("[DEBUG] %s event of %s coalesced", dockerEvent.Status, containerName)
+		return
+	}
+	if e.splitRestart && dockerEvent.Status == "restart" {
+		down := event
+		down.Status, down.Network = false, nil
+		e.log().Logf("[INFO] new event %+v, split restart", down)
+		e.emit(down)
+	}
+	e.log().Logf("[INFO] new event %+v", event)
+	e.emit(event)
+	if _, tracked := e.tracked.get(event.ContainerID); tracked && dockerEvent.Status == "start" {
+		e.addDeployment(event, ts)
+	}
+}
+
+// emit publishes event to eventsCh and keeps track of running containers
+func (e *EventNotif) emit(event Event) {
+	if e.withK8s && event.K8s == nil {
+		event.K8s = k8sMeta(event.Labels)
+	}
+	if event.NodeID == "" {
+		event.NodeID = event.Labels[swarmNodeLabel]
+	}
+	e.trackLock.Lock()
+	if !e.admit(event) {
+		e.trackLock.Unlock()
+		return
+	}
+	_, wasTracked := e.tracked.get(event.ContainerID)
+	e.tracked.update(event)
+	var admitted []Event
+	if !event.Status {
+		delete(e.paused, event.ContainerID)
+		if wasTracked {
+			admitted = e.admitWaiting() // slot freed
 		}
-		log.Printf("[INFO] new event %+v", event)
-		e.eventsCh <- event
 	}
-	log.Fatalf("[ERROR] event listener failed")
+	e.countEmitted(event)
+	e.trackLock.Unlock()
+	e.send(event)
+	for _, ev := range admitted {
+		e.send(ev)
+	}
 }
 
 // emitRunningContainers gets all currently running containers and publishes them as "Status=true" (started) events
 func (e *EventNotif) emitRunningContainers() error {
+	events, err := e.scanContainers()
+	if err != nil {
+		return err
+	}
+	if len(events) >= eventsBuffer {
+		// make room for all scanned containers and scan marker, so construction doesn't wait for consumer.
+		// safe to replace as called by constructor only, before channel exposed.
+		e.eventsCh = make(chan Event, len(events)+eventsBuffer)
+	}
+	for _, event := range events {
+		event.FromScan = true
+		e.log().Logf("[DEBUG] running container added, %+v", event)
+		e.emit(event)
+	}
+	e.log().Logf("[DEBUG] completed initial emit")
+	if e.scanMarker {
+		e.emitScanMarker()
+	}
+	return nil
+}
+
+// runningContainers gets all currently running and allowed containers as "Status=true" (started) events
+func (e *EventNotif) runningContainers() ([]Event, error) {
 	containers, err := e.dockerClient.ListContainers(docker.ListContainersOptions{All: false})
 	if err != nil {
-		return errors.Wrap(err, "can't list containers")
+		return nil, errors.Wrap(err, "can't list containers")
 	}
-	log.Printf("[DEBUG] total containers = %d", len(containers))
+	e.log().Logf("[DEBUG] total containers = %d", len(containers))
+	e.sortByPriority(containers)
 
+	res := make([]Event, 0, len(containers))
 	for _, c := range containers {
 		containerName := buildContainerName(c.Labels, strings.TrimPrefix(c.Names[0], "/"))
-		groupName := buildGroupName(c.Labels, e.group(c.Image))
-		if !e.isAllowed(containerName) {
-			log.Printf("[INFO] container %s excluded", containerName)
+		groupName := e.groupName(c.Labels, c.Image)
+		if by := e.excludedBy(c, containerName); by != "" {
+			switch by {
+			case exclusionSelf:
+				e.log().Logf("[INFO] own container %s excluded", containerName)
+			case exclusionName:
+				e.log().Logf("[INFO] container %s excluded", containerName)
+			default:
+				e.log().Logf("[INFO] container %s excluded by %s", containerName, by)
+			}
 			continue
 		}
-		event := Event{
+		res = append(res, Event{
 			Status:        true,
 			ContainerName: containerName,
+			RawName:       strings.TrimPrefix(c.Names[0], "/"),
 			ContainerID:   c.ID,
 			TS:            time.Unix(c.Created/1000, 0),
+			Created:       time.Unix(c.Created, 0),
 			Group:         groupName,
-		}
-		log.Printf("[DEBUG] running container added, %+v", event)
-		e.eventsCh <- event
+			Image:         c.Image,
+			Labels:        c.Labels,
+			Host:          e.host,
+			Source:        e.source,
+			Network:       e.scanNetwork(c),
+			EnvVars:       e.containerEnv(c.ID, "start"),
+		})
 	}
-	log.Print("[DEBUG] completed initial emit")
-	return nil
+	return res, nil
 }
 
 func (e *EventNotif) group(image string) string {
+	if e.stripRegistry {
+		res := repoGroup(image)
+		if res == "" {
+			e.log().Logf("[DEBUG] no group for %s", image)
+		}
+		return res
+	}
 	if r := reGroup.FindStringSubmatch(image); len(r) == 2 {
 		return r[1]
 	}
-	log.Printf("[DEBUG] no group for %s", image)
+	e.log().Logf("[DEBUG] no group for %s", image)
 	return ""
 }
 
-func (e *EventNotif) isAllowed(containerName string) bool {
-	if e.includesRegexp != nil {
-		return e.includesRegexp.MatchString(containerName)
-	}
-	if e.excludesRegexp != nil {
-		return !e.excludesRegexp.MatchString(containerName)
-	}
-	if len(e.includes) > 0 {
-		return contains(containerName, e.includes)
+// repoGroup returns the first path segment of image repository, ignoring registry host,
+// i.e. "team" for both "registry-a.com/team/app" and "team/app:latest". Empty for single segment repositories.
+func repoGroup(image string) string {
+	segments := strings.Split(image, "/")
+	if len(segments) > 1 && (strings.ContainsAny(segments[0], ".:") || segments[0] == "localhost") {
+		segments = segments[1:] // registry host, with a dot or port
 	}
-	if contains(containerName, e.excludes) {
-		return false
+	if len(segments) < 2 {
+		return ""
 	}
-
-	return true
+	return segments[0]
 }
 
 func contains(e string, s []string) bool {
@@ -191,22 +660,35 @@ func contains(e string, s []string) bool {
 }
 
 func buildContainerName(labels map[string]string, containerName string) string {
-	result := []string{}
-	if r := reSwarm.FindStringSubmatch(containerName); len(r) == 4 {
-		result = append(result, r[1]) // service name
-		result = append(result, r[2]) // replica number
-	} else if labelName, ok := labels["logger.container.name"]; ok && labelName != "" {
-		result = append(result, labelName)
+	if n := ParseContainerName(containerName); n.Kind == NameSwarm {
+		return n.Service + "-" + n.Replica // swarm task named by service and replica, without task id
 	}
-	if len(result) > 0 {
-		return strings.Join(result, "-")
+	if labelName, ok := labels["logger.container.name"]; ok && labelName != "" {
+		return labelName
 	}
 	return containerName
 }
 
-func buildGroupName(labels map[string]string, defaultValue string) string {
-	if labelGroup, ok := labels["logger.group.name"]; ok && labelGroup != "" {
-		return labelGroup
+// groupName makes group from labels or image, normalized if enabled
+func (e *EventNotif) groupName(labels map[string]string, image string) string {
+	res := buildGroupName(labels, e.groupLabels, e.group(image))
+	if e.normGroups {
+		res = normalizeGroup(res)
+	}
+	return res
+}
+
+// normalizeGroup trims and lowercases group name, replaces internal whitespace runs with a single dash
+func normalizeGroup(group string) string {
+	return strings.Join(strings.Fields(strings.ToLower(group)), "-")
+}
+
+// buildGroupName returns value of the first non-empty label from groupLabels, in order, or defaultValue
+func buildGroupName(labels map[string]string, groupLabels []string, defaultValue string) string {
+	for _, key := range groupLabels {
+		if labelGroup, ok := labels[key]; ok && labelGroup != "" {
+			return labelGroup
+		}
 	}
 
 	return defaultValue
@@ -1,6 +1,9 @@
 package discovery
 
 import (
+	"errors"
+	"fmt"
+	"os"
 	"sync"
 	"testing"
 	"time"
@@ -45,6 +48,119 @@ func TestEventsIncludes(t *testing.T) {
 	assert.Equal(t, false, ev.Status, "stopped")
 }
 
+func TestEventsRaw(t *testing.T) {
+	client := &mockDockerClient{}
+	client.add("id1", "name1")
+	events, err := NewEventNotif(client, nil, nil, "", "", WithRawEvents())
+	require.NoError(t, err)
+	ev := <-events.Channel()
+	assert.Nil(t, ev.Raw, "no raw event for initial scan")
+
+	time.Sleep(10 * time.Millisecond)
+	go client.add("id2", "name2")
+	ev = <-events.Channel()
+	require.NotNil(t, ev.Raw)
+	assert.Equal(t, "start", ev.Raw.Status)
+	assert.Equal(t, "name2", ev.Raw.Actor.Attributes["name"])
+
+	client2 := &mockDockerClient{}
+	events, err = NewEventNotif(client2, nil, nil, "", "")
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	go client2.add("id3", "name3")
+	ev = <-events.Channel()
+	assert.Nil(t, ev.Raw, "no raw event by default")
+}
+
+func TestEventsFromScan(t *testing.T) {
+	client := &mockDockerClient{}
+	client.add("id1", "name1")
+	events, err := NewEventNotif(client, nil, nil, "", "")
+	require.NoError(t, err)
+	ev := <-events.Channel()
+	assert.Equal(t, "name1", ev.ContainerName)
+	assert.True(t, ev.FromScan, "initial scan")
+	require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, 5*time.Millisecond)
+
+	go client.add("id2", "name2")
+	ev = <-events.Channel()
+	assert.Equal(t, "name2", ev.ContainerName)
+	assert.False(t, ev.FromScan, "live start")
+
+	client.Lock()
+	client.containers = []dockerclient.APIContainers{{ID: "id2", Names: []string{"name2"}}, {ID: "id3", Names: []string{"name3"}}}
+	client.Unlock()
+	events.Resync()
+	for _, name := range []string{"name1", "name3"} {
+		ev = <-events.Channel()
+		assert.Equal(t, name, ev.ContainerName)
+		assert.False(t, ev.FromScan, "resync of %s", name)
+	}
+
+	go client.remove("id2")
+	ev = <-events.Channel()
+	assert.Equal(t, "id2", ev.ContainerID)
+	assert.False(t, ev.FromScan, "live stop")
+}
+
+func TestEventsSplitRestart(t *testing.T) {
+	client := &mockDockerClient{}
+	events, err := NewEventNotif(client, nil, nil, "", "", WithSplitRestart())
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	go client.send(&dockerclient.APIEvents{Type: "container", Status: "restart",
+		Actor: dockerclient.APIActor{ID: "id1", Attributes: map[string]string{"name": "name1"}}})
+
+	ev := <-events.Channel()
+	assert.Equal(t, "id1", ev.ContainerID)
+	assert.False(t, ev.Status, "down first")
+	ev = <-events.Channel()
+	assert.Equal(t, "id1", ev.ContainerID)
+	assert.True(t, ev.Status, "up next")
+}
+
+func TestEventsRestart(t *testing.T) {
+	client := &mockDockerClient{}
+	events, err := NewEventNotif(client, nil, nil, "", "")
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	go func() {
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "restart",
+			Actor: dockerclient.APIActor{ID: "id1", Attributes: map[string]string{"name": "name1"}}})
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "stop",
+			Actor: dockerclient.APIActor{ID: "id1", Attributes: map[string]string{"name": "name1"}}})
+	}()
+
+	ev := <-events.Channel()
+	assert.True(t, ev.Status, "restart is up only")
+	ev = <-events.Channel()
+	assert.False(t, ev.Status, "stop")
+}
+
+func TestEventsReconnect(t *testing.T) {
+	client := &mockDockerClient{listenerErr: errors.New("failed")}
+	events, err := NewEventNotif(client, nil, nil, "", "",
+		WithBackoff(Backoff{Min: time.Millisecond, Max: 5 * time.Millisecond, Jitter: NoJitter}))
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, 0, client.subscriptions(), "listener failed")
+
+	client.Lock()
+	client.listenerErr = nil
+	client.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, 1, client.subscriptions(), "subscribed after failures")
+
+	client.disconnect()
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, 2, client.subscriptions(), "re-subscribed after disconnect")
+
+	go client.add("id1", "name1")
+	ev := <-events.Channel()
+	assert.Equal(t, "name1", ev.ContainerName)
+	assert.Equal(t, true, ev.Status, "started")
+}
+
 func TestEmit(t *testing.T) {
 	client := &mockDockerClient{}
 	time.Sleep(10 * time.Millisecond)
@@ -65,6 +181,59 @@ func TestEmit(t *testing.T) {
 	assert.Equal(t, true, ev.Status, "started")
 }
 
+func TestEmitManyContainers(t *testing.T) {
+	client := &mockDockerClient{}
+	for i := 0; i < 250; i++ {
+		client.add(fmt.Sprintf("id%d", i), fmt.Sprintf("name%d", i))
+	}
+
+	created := make(chan *EventNotif)
+	go func() {
+		events, err := NewEventNotif(client, nil, nil, "", "")
+		assert.NoError(t, err)
+		created <- events
+	}()
+	var events *EventNotif
+	select {
+	case events = <-created:
+	case <-time.After(time.Second):
+		t.Fatal("construction blocked without consumer")
+	}
+
+	time.Sleep(50 * time.Millisecond) // delayed consumer
+	go client.send(&dockerclient.APIEvents{Type: "container", Status: "start",
+		Actor: dockerclient.APIActor{ID: "id-live", Attributes: map[string]string{"name": "live"}}})
+	for i := 0; i < 250; i++ {
+		ev := <-events.Channel()
+		assert.Equal(t, fmt.Sprintf("name%d", i), ev.ContainerName, "scan events in order")
+	}
+	assert.Equal(t, "live", (<-events.Channel()).ContainerName, "live event after scan")
+}
+
+func TestEmitSource(t *testing.T) {
+	client := &mockDockerClient{}
+	client.add("id1", "name1")
+	events, err := NewEventNotif(client, nil, nil, "", "", WithSource("src1"))
+	require.NoError(t, err)
+	ev := <-events.Channel()
+	assert.Equal(t, "src1", ev.Source)
+
+	hname, err := os.Hostname()
+	require.NoError(t, err)
+	client2 := &mockDockerClient{}
+	client2.add("id1", "name1")
+	events, err = NewEventNotif(client2, nil, nil, "", "")
+	require.NoError(t, err)
+	ev = <-events.Channel()
+	assert.Equal(t, hname, ev.Source, "default source")
+
+	time.Sleep(10 * time.Millisecond)
+	go client2.add("id2", "name2")
+	ev = <-events.Channel()
+	assert.Equal(t, "name2", ev.ContainerName)
+	assert.Equal(t, hname, ev.Source, "live event source")
+}
+
 func TestEmitIncludes(t *testing.T) {
 	client := &mockDockerClient{}
 	time.Sleep(10 * time.Millisecond)
@@ -158,16 +327,112 @@ func TestGroup(t *testing.T) {
 	}
 }
 
+func TestGroupStripRegistry(t *testing.T) {
+	d := EventNotif{stripRegistry: true}
+	tbl := []struct {
+		inp string
+		out string
+	}{
+		{"registry-a.com/team/app", "team"},
+		{"registry-b.com/team/app:latest", "team"},
+		{"registry-c.com:5000/team/app:v1", "team"},
+		{"localhost:5000/team/app", "team"},
+		{"localhost/team/app", "team"},
+		{"registry:5000/team/sub/app", "team"},
+		{"team/app", "team"},
+		{"team/sub/app:v1", "team"},
+		{"registry.example.com/app", ""},
+		{"app:latest", ""},
+		{"", ""},
+	}
+	for _, tt := range tbl {
+		assert.Equal(t, tt.out, d.group(tt.inp), tt.inp)
+	}
+}
+
+func TestBuildGroupName(t *testing.T) {
+	groupLabels := []string{"logger.group.name", "com.docker.stack.namespace", "com.docker.compose.project"}
+	tbl := []struct {
+		labels map[string]string
+		res    string
+	}{
+		{nil, "default"},
+		{map[string]string{"other": "blah"}, "default"},
+		{map[string]string{"com.docker.compose.project": "proj"}, "proj"},
+		{map[string]string{"com.docker.compose.project": "proj", "com.docker.stack.namespace": "stack"}, "stack"},
+		{map[string]string{"com.docker.compose.project": "proj", "logger.group.name": "custom", "com.docker.stack.namespace": "stack"},
+			"custom"},
+		{map[string]string{"com.docker.compose.project": "proj", "logger.group.name": ""}, "proj"},
+	}
+	for i, tt := range tbl {
+		assert.Equal(t, tt.res, buildGroupName(tt.labels, groupLabels, "default"), "case #%d", i)
+	}
+	assert.Equal(t, "default", buildGroupName(map[string]string{"logger.group.name": "custom"}, nil, "default"), "no labels")
+}
+
+func TestEmitGroupLabels(t *testing.T) {
+	client := &mockDockerClient{containers: []dockerclient.APIContainers{
+		{ID: "id1", Names: []string{"/name1"}, Image: "reg.example.com/img/app", Labels: map[string]string{"com.docker.compose.project": "proj"}},
+		{ID: "id2", Names: []string{"/name2"}, Image: "reg.example.com/img/app", Labels: map[string]string{"logger.group.name": "custom"}},
+	}}
+	events, err := NewEventNotif(client, nil, nil, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "img", (<-events.Channel()).Group, "compose label ignored by default")
+	assert.Equal(t, "custom", (<-events.Channel()).Group)
+
+	events, err = NewEventNotif(client, nil, nil, "", "", WithGroupLabels("logger.group.name", "com.docker.compose.project"))
+	require.NoError(t, err)
+	assert.Equal(t, "proj", (<-events.Channel()).Group)
+	assert.Equal(t, "custom", (<-events.Channel()).Group)
+}
+
+func TestNormalizeGroup(t *testing.T) {
+	tbl := []struct {
+		inp, out string
+	}{
+		{"system", "system"},
+		{"System", "system"},
+		{"  System  ", "system"},
+		{"My  Cool\tGroup", "my-cool-group"},
+		{"", ""},
+	}
+	for i, tt := range tbl {
+		assert.Equal(t, tt.out, normalizeGroup(tt.inp), "case #%d", i)
+	}
+}
+
+func TestEmitNormalizeGroups(t *testing.T) {
+	client := &mockDockerClient{containers: []dockerclient.APIContainers{
+		{ID: "id1", Names: []string{"/name1"}, Image: "reg.example.com/System/app"},
+		{ID: "id2", Names: []string{"/name2"}, Image: "reg.example.com/img/app", Labels: map[string]string{"logger.group.name": " Web Apps "}},
+	}}
+	events, err := NewEventNotif(client, nil, nil, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "System", (<-events.Channel()).Group, "raw by default")
+	assert.Equal(t, " Web Apps ", (<-events.Channel()).Group, "raw by default")
+
+	events, err = NewEventNotif(client, nil, nil, "", "", WithNormalizeGroups())
+	require.NoError(t, err)
+	assert.Equal(t, "system", (<-events.Channel()).Group)
+	assert.Equal(t, "web-apps", (<-events.Channel()).Group)
+}
+
 type mockDockerClient struct {
-	containers []dockerclient.APIContainers
-	events     chan<- *dockerclient.APIEvents
+	containers  []dockerclient.APIContainers
+	events      chan<- *dockerclient.APIEvents
+	subscribed  int
+	listenerErr error
 	sync.Mutex
 }
 
 func (m *mockDockerClient) add(id, name string) {
+	m.addWithCommand(id, name, "")
+}
+
+func (m *mockDockerClient) addWithCommand(id, name, command string) {
 	m.Lock()
 	defer m.Unlock()
-	m.containers = append(m.containers, dockerclient.APIContainers{ID: id, Names: []string{name}})
+	m.containers = append(m.containers, dockerclient.APIContainers{ID: id, Names: []string{name}, Command: command})
 	ev := dockerclient.APIEvents{Type: "container", ID: id, Status: "start"}
 	ev.Actor.Attributes = map[string]string{}
 	ev.Actor.Attributes["name"] = name
@@ -210,10 +475,39 @@ func (m *mockDockerClient) ListContainers(dockerclient.ListContainersOptions) ([
 func (m *mockDockerClient) AddEventListener(listener chan<- *dockerclient.APIEvents) error {
 	m.Lock()
 	defer m.Unlock()
+	if m.listenerErr != nil {
+		return m.listenerErr
+	}
 	m.events = listener
+	m.subscribed++
 	return nil
 }
 
+// send delivers given event to the listener
+func (m *mockDockerClient) send(ev *dockerclient.APIEvents) {
+	m.Lock()
+	defer m.Unlock()
+	if m.events != nil {
+		m.events <- ev
+	}
+}
+
+// disconnect closes listener channel the same way docker client does on failed connection
+func (m *mockDockerClient) disconnect() {
+	m.Lock()
+	defer m.Unlock()
+	if m.events != nil {
+		close(m.events)
+		m.events = nil
+	}
+}
+
+func (m *mockDockerClient) subscriptions() int {
+	m.Lock()
+	defer m.Unlock()
+	return m.subscribed
+}
+
 func (m *mockDockerClient) getContainerName(id string) string {
 	for _, c := range m.containers {
 		if id == c.ID {
@@ -223,3 +517,57 @@ func (m *mockDockerClient) getContainerName(id string) string {
 
 	panic("Can't find container with specified id")
 }
+
+func TestEventsCreated(t *testing.T) {
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	client := &mockDockerClient{containers: []dockerclient.APIContainers{{ID: "id0", Names: []string{"/running"},
+		Created: created.Unix()}}}
+	events, err := NewEventNotif(client, nil, nil, "", "")
+	require.NoError(t, err)
+	ev := <-events.Channel()
+	assert.Equal(t, created, ev.Created.UTC(), "from initial scan")
+
+	require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, 5*time.Millisecond)
+	attrs := map[string]string{"name": "web"}
+	go func() {
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "create", TimeNano: created.UnixNano(),
+			Actor: dockerclient.APIActor{ID: "id1", Attributes: attrs}})
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "start", Actor: dockerclient.APIActor{ID: "id1", Attributes: attrs}})
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "die", Actor: dockerclient.APIActor{ID: "id1", Attributes: attrs}})
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "start", Actor: dockerclient.APIActor{ID: "id1", Attributes: attrs}})
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "destroy", Actor: dockerclient.APIActor{ID: "id1", Attributes: attrs}})
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "start", Actor: dockerclient.APIActor{ID: "id2", Attributes: attrs}})
+	}()
+
+	ev = <-events.Channel()
+	assert.True(t, ev.Status)
+	assert.Equal(t, created, ev.Created.UTC(), "from create event")
+	assert.Equal(t, created, (<-events.Channel()).Created.UTC(), "down event")
+	assert.Equal(t, created, (<-events.Channel()).Created.UTC(), "restart of the same container")
+	assert.Equal(t, created, (<-events.Channel()).Created.UTC(), "destroy event")
+	ev = <-events.Channel()
+	assert.Equal(t, "id2", ev.ContainerID)
+	assert.True(t, ev.Created.IsZero(), "create event not seen")
+	events.trackLock.Lock()
+	assert.Empty(t, events.created, "forgotten on destroy")
+	events.trackLock.Unlock()
+}
+
+func TestEventsCreatedExcluded(t *testing.T) {
+	client := &mockDockerClient{}
+	events, err := NewEventNotif(client, []string{"db"}, nil, "", "")
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, 5*time.Millisecond)
+
+	attrs := map[string]string{"name": "db"}
+	go func() {
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "create", TimeNano: time.Now().UnixNano(),
+			Actor: dockerclient.APIActor{ID: "id1", Attributes: attrs}})
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "destroy", Actor: dockerclient.APIActor{ID: "id1", Attributes: attrs}})
+		client.add("id2", "web")
+	}()
+	assert.Equal(t, "id2", (<-events.Channel()).ContainerID)
+	events.trackLock.Lock()
+	assert.Empty(t, events.created, "excluded container forgotten on destroy")
+	events.trackLock.Unlock()
+}
@@ -0,0 +1,99 @@
+package discovery
+
+import (
+	"strings"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/pkg/errors"
+)
+
+// exclusionExpr is exclusion reason of excludedBy for containers not matching filter expression
+const exclusionExpr = "expression"
+
+// exprEnv is the context filter expression evaluated against, one per container
+type exprEnv struct {
+	ID      string            `expr:"id"`
+	Name    string            `expr:"name"`     // resolved name, as ContainerName of events
+	RawName string            `expr:"raw_name"` // docker's name
+	Group   string            `expr:"group"`
+	Image   string            `expr:"image"`
+	Host    string            `expr:"host"`
+	Label   map[string]string `expr:"label"` // empty string for missing labels
+}
+
+// WithFilterExpr collects containers matching boolean expression only, i.e.
+// `label.env == "prod" && name =~ "^web-" && group != "test"`. Expression may use id, name, raw_name, group, image,
+// host and label map of the container, `label["com.docker.compose.project"]` for labels with dots, operators and
+// functions of expr language (https://expr-lang.org), and `=~`, `!~` as aliases of `matches` and `not matches`.
+// Evaluated in addition to other filters, container collected if allowed by all of them. Compiled by NewEventNotif,
+// which fails on invalid expression. Empty expression matches all.
+func WithFilterExpr(expression string) Option {
+	return func(e *EventNotif) {
+		e.filterExprSrc = expression
+	}
+}
+
+// compileFilterExpr compiles filter expression, nil for empty one
+func compileFilterExpr(expression string) (*vm.Program, error) {
+	if strings.TrimSpace(expression) == "" {
+		return nil, nil
+	}
+	program, err := expr.Compile(rewriteMatchOps(expression), expr.Env(exprEnv{}), expr.AsBool())
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid filter expression %q", expression)
+	}
+	return program, nil
+}
+
+// exprAllowed checks container matches filter expression, true if no expression set.
+// Evaluation errors, i.e. invalid regex made of label value, exclude the container.
+func (e *EventNotif) exprAllowed(env exprEnv) bool {
+	if e.filterExpr == nil {
+		return true
+	}
+	if env.Label == nil {
+		env.Label = map[string]string{}
+	}
+	res, err := expr.Run(e.filterExpr, env)
+	if err != nil {
+		e.log().Logf("[WARN] can't evaluate filter expression for %s, %v", env.Name, err)
+		return false
+	}
+	allowed, ok := res.(bool)
+	return ok && allowed
+}
+
+// rewriteMatchOps replaces =~ and !~ operators outside of string literals with expr's matches and not matches
+func rewriteMatchOps(expression string) string {
+	var res strings.Builder
+	var quote rune // opening quote of the current literal, 0 outside of literals
+	runes := []rune(expression)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			res.WriteRune(r)
+			if r == '\\' && quote != '`' && i+1 < len(runes) {
+				i++
+				res.WriteRune(runes[i])
+				continue
+			}
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'' || r == '`':
+			quote = r
+			res.WriteRune(r)
+		case r == '=' && i+1 < len(runes) && runes[i+1] == '~':
+			res.WriteString(" matches ")
+			i++
+		case r == '!' && i+1 < len(runes) && runes[i+1] == '~':
+			res.WriteString(" not matches ")
+			i++
+		default:
+			res.WriteRune(r)
+		}
+	}
+	return res.String()
+}
@@ -0,0 +1,101 @@
+package discovery
+
+import (
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExprAllowed(t *testing.T) {
+	web := exprEnv{ID: "id1", Name: "web-1", RawName: "shop_web.1.abc", Group: "shop", Image: "nginx:1.25", Host: "h1",
+		Label: map[string]string{"env": "prod", "com.docker.compose.project": "shop"}}
+	test := exprEnv{ID: "id2", Name: "web-2", Group: "test", Image: "nginx:1.25", Label: map[string]string{"env": "prod"}}
+	db := exprEnv{ID: "id3", Name: "db", Group: "shop", Image: "postgres:16"}
+
+	tbl := []struct {
+		expression    string
+		web, test, db bool
+	}{
+		{`label.env == "prod" && name =~ "web-.*" && group != "test"`, true, false, false},
+		{`label["com.docker.compose.project"] == "shop"`, true, false, false},
+		{`name !~ "^web"`, false, false, true},
+		{`image startsWith "nginx"`, true, true, false},
+		{`group in ["shop", "billing"]`, true, false, true},
+		{`label.env == ""`, false, false, true},
+		{`not (name matches "^db$") && host == "h1"`, true, false, false},
+		{`id == "id2" || raw_name contains "shop_"`, true, true, false},
+		{`name == "=~" || label.env =~ "^pr"`, true, true, false},
+		{``, true, true, true},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.expression, func(t *testing.T) {
+			e, err := newEventNotif(&mockDockerClient{}, nil, nil, "", "", WithFilterExpr(tt.expression))
+			require.NoError(t, err)
+			assert.Equal(t, tt.web, e.exprAllowed(web), "web")
+			assert.Equal(t, tt.test, e.exprAllowed(test), "test")
+			assert.Equal(t, tt.db, e.exprAllowed(db), "db")
+		})
+	}
+}
+
+func TestExprAllowedRuntimeError(t *testing.T) {
+	e, err := newEventNotif(&mockDockerClient{}, nil, nil, "", "", WithFilterExpr(`name matches label.re`))
+	require.NoError(t, err)
+	assert.True(t, e.exprAllowed(exprEnv{Name: "web", Label: map[string]string{"re": "^w"}}))
+	assert.False(t, e.exprAllowed(exprEnv{Name: "web", Label: map[string]string{"re": "("}}), "invalid regex excludes")
+}
+
+func TestCompileFilterExpr(t *testing.T) {
+	tbl := []struct {
+		expression, err string
+	}{
+		{`name ==`, `invalid filter expression "name =="`},
+		{`name + 1`, `invalid filter expression "name + 1"`},
+		{`name`, `expected bool`},
+		{`unknown == "x"`, `unknown name unknown`},
+		{`name =~ "("`, `invalid filter expression`},
+	}
+	for _, tt := range tbl {
+		_, err := newEventNotif(&mockDockerClient{}, nil, nil, "", "", WithFilterExpr(tt.expression))
+		require.Error(t, err, tt.expression)
+		assert.Contains(t, err.Error(), tt.err, tt.expression)
+	}
+}
+
+func Test_rewriteMatchOps(t *testing.T) {
+	assert.Equal(t, `name  matches  "^web"`, rewriteMatchOps(`name =~ "^web"`))
+	assert.Equal(t, `name  not matches  '^web'`, rewriteMatchOps(`name !~ '^web'`))
+	quoted := `name == "=~" && image == '!~\'=~' && x == ` + "`=~`"
+	assert.Equal(t, quoted, rewriteMatchOps(quoted), "literals kept")
+	assert.Equal(t, `name != "a"`, rewriteMatchOps(`name != "a"`))
+}
+
+func TestEventsFilterExpr(t *testing.T) {
+	client := &mockDockerClient{containers: []dockerclient.APIContainers{
+		{ID: "id1", Names: []string{"/web-1"}, Image: "nginx", Labels: map[string]string{"env": "prod"}},
+		{ID: "id2", Names: []string{"/web-2"}, Image: "nginx", Labels: map[string]string{"env": "dev"}},
+	}}
+	events, err := NewEventNotif(client, nil, nil, "", "", WithFilterExpr(`label.env == "prod"`))
+	require.NoError(t, err)
+	ev := <-events.Channel()
+	assert.Equal(t, "web-1", ev.ContainerName, "scan")
+	require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, 5*time.Millisecond)
+
+	for id, env := range map[string]string{"id3": "dev", "id4": "prod"} {
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "start",
+			Actor: dockerclient.APIActor{ID: id, Attributes: map[string]string{"name": "api-" + env, "env": env}}})
+	}
+	ev = <-events.Channel()
+	assert.Equal(t, "api-prod", ev.ContainerName, "live")
+	assert.Equal(t, `label.env == "prod"`, events.Filters().FilterExpr)
+	assert.Equal(t, 1, events.Stats().Filtered, "live event excluded")
+
+	diag, err := Diagnose(client, nil, nil, "", "", WithFilterExpr(`label.env == "prod"`))
+	require.NoError(t, err)
+	require.Len(t, diag.Containers, 2)
+	assert.Equal(t, "", diag.Containers[0].ExcludedBy)
+	assert.Equal(t, exclusionExpr, diag.Containers[1].ExcludedBy)
+}
@@ -0,0 +1,184 @@
+package discovery
+
+import (
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// UpdateFilters replaces name filters of running EventNotif atomically. Filters validated the same way as
+// by NewEventNotif and old filters kept on error. Affects upcoming events only, already emitted containers unchanged.
+func (e *EventNotif) UpdateFilters(excludes, includes []string, includesPattern, excludesPattern string) error {
+	includesRe, excludesRe, err := compilePatterns(includesPattern, excludesPattern, e.anchorPatterns)
+	if err != nil {
+		return err
+	}
+
+	candidate := EventNotif{excludes: excludes, includes: includes, includesRegexp: includesRe, excludesRegexp: excludesRe,
+		strictFilters: e.strictFilters, precedence: e.precedence}
+	if err = candidate.validateFilters(); err != nil {
+		return err
+	}
+
+	e.filterLock.Lock()
+	defer e.filterLock.Unlock()
+	e.excludes, e.includes, e.includesRegexp, e.excludesRegexp = excludes, includes, includesRe, excludesRe
+	e.filterVersion++
+	e.setActiveFilters()
+	e.log().Logf("[INFO] filters updated, excludes: %+v, includes: %+v, includesPattern: %+v, excludesPattern: %+v",
+		excludes, includes, includesPattern, excludesPattern)
+	return nil
+}
+
+// FilterConfig is effective filter configuration of EventNotif, with name filters as set by the last UpdateFilters
+type FilterConfig struct {
+	Includes         []string `json:"includes,omitempty"`
+	Excludes         []string `json:"excludes,omitempty"`
+	IncludesPattern  string   `json:"includes_pattern,omitempty"` // compiled regexp source, anchored if WithAnchorPatterns
+	ExcludesPattern  string   `json:"excludes_pattern,omitempty"`
+	Precedence       string   `json:"precedence,omitempty"` // "first", "exclude-wins" or "include-wins"
+	IncludeCommand   string   `json:"include_command,omitempty"`
+	ExcludeCommand   string   `json:"exclude_command,omitempty"`
+	SkipLabels       []string `json:"skip_labels,omitempty"`
+	ShardCount       int      `json:"shard_count,omitempty"` // zero if sharding disabled
+	ShardIndex       int      `json:"shard_index,omitempty"`
+	MinReplica       int      `json:"min_replica,omitempty"` // swarm replica range, zero for no bound
+	MaxReplica       int      `json:"max_replica,omitempty"`
+	IncludeTTY       bool     `json:"include_tty,omitempty"`
+	ExcludeTTY       bool     `json:"exclude_tty,omitempty"`
+	IncludeRuntimes  []string `json:"include_runtimes,omitempty"`
+	ExcludeRuntimes  []string `json:"exclude_runtimes,omitempty"`
+	IncludePlatforms []string `json:"include_platforms,omitempty"`
+	ExcludePlatforms []string `json:"exclude_platforms,omitempty"`
+	InfraExcludes    []string `json:"infra_excludes,omitempty"`
+	FilterExpr       string   `json:"filter_expr,omitempty"`
+	MaxContainers    int      `json:"max_containers,omitempty"`
+	PriorityGroups   []string `json:"priority_groups,omitempty"`
+}
+
+// Filters returns effective filter configuration, safe for concurrent use with UpdateFilters.
+// Slices are copies, changing them doesn't affect EventNotif.
+func (e *EventNotif) Filters() FilterConfig {
+	regexpSource := func(re *regexp.Regexp) string {
+		if re == nil {
+			return ""
+		}
+		return re.String()
+	}
+	clone := func(s []string) []string {
+		if len(s) == 0 {
+			return nil
+		}
+		return append([]string(nil), s...)
+	}
+	res := FilterConfig{Precedence: e.precedence.String(), IncludeCommand: regexpSource(e.includeCmd),
+		ExcludeCommand: regexpSource(e.excludeCmd), SkipLabels: clone(e.skipLabels), MinReplica: e.minReplica,
+		MaxReplica: e.maxReplica, IncludeTTY: e.includeTTY, ExcludeTTY: e.excludeTTY, IncludeRuntimes: clone(e.incRuntimes),
+		ExcludeRuntimes: clone(e.excRuntimes), IncludePlatforms: clone(e.incPlatforms), ExcludePlatforms: clone(e.excPlatforms),
+		MaxContainers: e.maxContainers, PriorityGroups: clone(e.priorityGroups), FilterExpr: e.filterExprSrc}
+	for _, re := range e.infraExcludes {
+		res.InfraExcludes = append(res.InfraExcludes, re.String())
+	}
+	if e.shardCount > 1 {
+		res.ShardCount, res.ShardIndex = e.shardCount, e.shardIndex
+	}
+
+	e.filterLock.RLock()
+	defer e.filterLock.RUnlock()
+	res.Includes, res.Excludes = clone(e.includes), clone(e.excludes)
+	res.IncludesPattern, res.ExcludesPattern = regexpSource(e.includesRegexp), regexpSource(e.excludesRegexp)
+	return res
+}
+
+// WithAnchorPatterns makes include and exclude patterns match whole container names, i.e. "web" matches "web"
+// but not "webhook-test". Patterns are unanchored regexps by default, matching any part of the name.
+func WithAnchorPatterns() Option {
+	return func(e *EventNotif) {
+		e.anchorPatterns = true
+	}
+}
+
+// compilePatterns compiles include and exclude patterns, empty pattern makes nil regexp.
+// With anchored patterns wrapped as ^(?:pattern)$, so alternations like "web|api" anchored as a whole.
+func compilePatterns(includesPattern, excludesPattern string, anchored bool) (includesRe, excludesRe *regexp.Regexp, err error) {
+	anchor := func(pattern string) string {
+		if anchored {
+			return "^(?:" + pattern + ")$"
+		}
+		return pattern
+	}
+	if includesPattern != "" {
+		if includesRe, err = regexp.Compile(anchor(includesPattern)); err != nil {
+			return nil, nil, errors.Wrap(err, "failed to compile includesPattern")
+		}
+	}
+	if excludesPattern != "" {
+		if excludesRe, err = regexp.Compile(anchor(excludesPattern)); err != nil {
+			return nil, nil, errors.Wrap(err, "failed to compile excludesPattern")
+		}
+	}
+	return includesRe, excludesRe, nil
+}
+
+// activeFilters are name filters defined, precomputed so matching skips dormant ones
+type activeFilters struct {
+	includes, excludes     bool
+	includesRe, excludesRe bool
+	infra                  bool
+}
+
+// setActiveFilters precomputes active name filters and allow-all fast path, should be called with filterLock held
+// or before EventNotif started
+func (e *EventNotif) setActiveFilters() {
+	e.active = activeFilters{includes: len(e.includes) > 0, excludes: len(e.excludes) > 0,
+		includesRe: e.includesRegexp != nil, excludesRe: e.excludesRegexp != nil, infra: len(e.infraExcludes) > 0}
+	e.allowAll.Store(e.active == activeFilters{})
+}
+
+// isAllowed checks container name against shard and filters, using decisions cache if enabled.
+// Returns true right away if in shard and no name filters defined, without locking.
+func (e *EventNotif) isAllowed(containerName string) bool {
+	if !e.inShard(containerName) {
+		return false
+	}
+	if e.allowAll.Load() {
+		return true
+	}
+	e.filterLock.RLock()
+	defer e.filterLock.RUnlock()
+	if e.decisions != nil {
+		if res, ok := e.decisions.get(containerName, e.filterVersion); ok {
+			return res
+		}
+	}
+	res := e.matchFilters(containerName) && e.infraAllowed(containerName)
+	if e.decisions != nil {
+		e.decisions.put(containerName, e.filterVersion, res)
+	}
+	return res
+}
+
+// matchFilters checks container name against filters, should be called with filterLock held
+func (e *EventNotif) matchFilters(containerName string) bool {
+	if e.precedence != PrecedenceFirst {
+		included := (e.active.includes && contains(containerName, e.includes)) ||
+			(e.active.includesRe && e.includesRegexp.MatchString(containerName))
+		excluded := (e.active.excludes && contains(containerName, e.excludes)) ||
+			(e.active.excludesRe && e.excludesRegexp.MatchString(containerName))
+		return e.precedence.allow(e.active.includes || e.active.includesRe, included, excluded)
+	}
+	if e.active.includesRe {
+		return e.includesRegexp.MatchString(containerName)
+	}
+	if e.active.excludesRe {
+		return !e.excludesRegexp.MatchString(containerName)
+	}
+	if e.active.includes {
+		return contains(containerName, e.includes)
+	}
+	if e.active.excludes && contains(containerName, e.excludes) {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,202 @@
+package discovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateFilters(t *testing.T) {
+	e, err := NewEventNotif(&mockDockerClient{}, []string{"tst_exclude"}, nil, "", "", WithStrictFilters())
+	require.NoError(t, err)
+	assert.False(t, e.isAllowed("tst_exclude"))
+	assert.True(t, e.isAllowed("tst_other"))
+
+	require.NoError(t, e.UpdateFilters(nil, []string{"tst_include"}, "", ""))
+	assert.True(t, e.isAllowed("tst_include"))
+	assert.False(t, e.isAllowed("tst_other"))
+
+	require.NoError(t, e.UpdateFilters(nil, nil, "^web", ""))
+	assert.True(t, e.isAllowed("web1"))
+	assert.False(t, e.isAllowed("tst_include"))
+
+	err = e.UpdateFilters(nil, nil, "[", "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to compile includesPattern")
+	assert.True(t, e.isAllowed("web1"), "old filters kept")
+
+	err = e.UpdateFilters([]string{"c1"}, []string{"c1"}, "", "")
+	require.Error(t, err, "strict filters applied to updates")
+	assert.True(t, e.isAllowed("web1"), "old filters kept")
+}
+
+func TestUpdateFiltersWithDecisionCache(t *testing.T) {
+	e, err := NewEventNotif(&mockDockerClient{}, []string{"tst_exclude"}, nil, "", "", WithDecisionCache(10))
+	require.NoError(t, err)
+	assert.False(t, e.isAllowed("tst_exclude"))
+	assert.True(t, e.isAllowed("tst_other"))
+	assert.Equal(t, 2, e.decisions.len())
+
+	require.NoError(t, e.UpdateFilters([]string{"tst_other"}, nil, "", ""))
+	assert.True(t, e.isAllowed("tst_exclude"), "cached decision invalidated")
+	assert.False(t, e.isAllowed("tst_other"), "cached decision invalidated")
+}
+
+func TestAnchorPatterns(t *testing.T) {
+	names := []string{"web", "webhook-test", "old-web", "api", "db"}
+	tbl := []struct {
+		includesPattern, excludesPattern string
+		unanchored, anchored             []bool
+	}{
+		{"web", "", []bool{true, true, true, false, false}, []bool{true, false, false, false, false}},
+		{"web|api", "", []bool{true, true, true, true, false}, []bool{true, false, false, true, false}},
+		{"^web", "", []bool{true, true, false, false, false}, []bool{true, false, false, false, false}},
+		{"web.*", "", []bool{true, true, true, false, false}, []bool{true, true, false, false, false}},
+		{"", "web", []bool{false, false, false, true, true}, []bool{false, true, true, true, true}},
+		{"", "^web$", []bool{false, true, true, true, true}, []bool{false, true, true, true, true}},
+	}
+	allowed := func(e *EventNotif) (res []bool) {
+		for _, name := range names {
+			res = append(res, e.isAllowed(name))
+		}
+		return res
+	}
+	for _, tt := range tbl {
+		t.Run(tt.includesPattern+"/"+tt.excludesPattern, func(t *testing.T) {
+			e, err := NewEventNotif(&mockDockerClient{}, nil, nil, tt.includesPattern, tt.excludesPattern)
+			require.NoError(t, err)
+			assert.Equal(t, tt.unanchored, allowed(e), "unanchored by default")
+
+			e, err = NewEventNotif(&mockDockerClient{}, nil, nil, tt.includesPattern, tt.excludesPattern, WithAnchorPatterns())
+			require.NoError(t, err)
+			assert.Equal(t, tt.anchored, allowed(e))
+		})
+	}
+
+	e, err := NewEventNotif(&mockDockerClient{}, nil, nil, "web", "", WithAnchorPatterns())
+	require.NoError(t, err)
+	require.NoError(t, e.UpdateFilters(nil, nil, "api", ""))
+	assert.True(t, e.isAllowed("api"))
+	assert.False(t, e.isAllowed("api-gw"), "anchored on update")
+
+	_, err = NewEventNotif(&mockDockerClient{}, nil, nil, "[", "", WithAnchorPatterns())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to compile includesPattern")
+}
+
+func TestIsAllowedFastPath(t *testing.T) {
+	e, err := NewEventNotif(&mockDockerClient{}, nil, nil, "", "")
+	require.NoError(t, err)
+	assert.True(t, e.allowAll.Load(), "no filters")
+	assert.True(t, e.isAllowed("c1"))
+
+	require.NoError(t, e.UpdateFilters([]string{"c1"}, nil, "", ""))
+	assert.False(t, e.allowAll.Load(), "excludes defined")
+	assert.Equal(t, activeFilters{excludes: true}, e.active)
+	assert.False(t, e.isAllowed("c1"))
+	assert.True(t, e.isAllowed("c2"))
+
+	require.NoError(t, e.UpdateFilters(nil, nil, "", ""))
+	assert.True(t, e.allowAll.Load(), "filters removed")
+	assert.True(t, e.isAllowed("c1"))
+
+	e, err = NewEventNotif(&mockDockerClient{}, nil, nil, "^web", "", WithPrecedence(PrecedenceExcludeWins))
+	require.NoError(t, err)
+	assert.Equal(t, activeFilters{includesRe: true}, e.active)
+	assert.True(t, e.isAllowed("web1"))
+	assert.False(t, e.isAllowed("db1"))
+}
+
+func BenchmarkIsAllowedNoFilters(b *testing.B) {
+	names := make([]string, 200) // synthetic high-rate stream over a set of containers
+	for i := range names {
+		names[i] = fmt.Sprintf("service-%d-worker-%d", i%20, i)
+	}
+	e, err := NewEventNotif(&mockDockerClient{}, nil, nil, "", "")
+	require.NoError(b, err)
+
+	b.Run("fast path", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			e.isAllowed(names[i%len(names)])
+		}
+	})
+
+	b.Run("full match", func(b *testing.B) { // isAllowed without fast path, as before
+		for i := 0; i < b.N; i++ {
+			e.filterLock.RLock()
+			e.matchFilters(names[i%len(names)])
+			e.filterLock.RUnlock()
+		}
+	})
+
+	b.Run("fast path parallel", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				e.isAllowed(names[i%len(names)])
+			}
+		})
+	})
+
+	b.Run("full match parallel", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				e.filterLock.RLock()
+				e.matchFilters(names[i%len(names)])
+				e.filterLock.RUnlock()
+			}
+		})
+	})
+}
+
+func TestFilters(t *testing.T) {
+	e, err := NewEventNotif(&mockDockerClient{}, []string{"tst_exclude"}, nil, "", "^db", WithAnchorPatterns(),
+		WithPrecedence(PrecedenceExcludeWins), WithSkipLabels("logger.skip"), WithShard(3, 1), WithTTYFilter(false, true),
+		WithCommandFilter(nil, regexp.MustCompile("sleep")), WithMaxContainers(5, "system"))
+	require.NoError(t, err)
+	want := FilterConfig{Excludes: []string{"tst_exclude"}, ExcludesPattern: "^(?:^db)$", Precedence: "exclude-wins",
+		ExcludeCommand: "sleep", SkipLabels: []string{"logger.skip"}, ShardCount: 3, ShardIndex: 1, ExcludeTTY: true,
+		MaxContainers: 5, PriorityGroups: []string{"system"}}
+	assert.Equal(t, want, e.Filters())
+	assert.Equal(t, want, e.Stats().Filters)
+
+	require.NoError(t, e.UpdateFilters(nil, []string{"web"}, "api|app", ""))
+	want.Excludes, want.Includes, want.ExcludesPattern, want.IncludesPattern = nil, []string{"web"}, "", "^(?:api|app)$"
+	assert.Equal(t, want, e.Filters(), "updated name filters reported")
+
+	filters := e.Filters()
+	filters.Includes[0] = "changed"
+	assert.Equal(t, []string{"web"}, e.Filters().Includes, "copy returned")
+
+	data, err := json.Marshal(e.Filters())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"includes":["web"],"includes_pattern":"^(?:api|app)$","precedence":"exclude-wins",
+		"exclude_command":"sleep","skip_labels":["logger.skip"],"shard_count":3,"shard_index":1,"exclude_tty":true,
+		"max_containers":5,"priority_groups":["system"]}`, string(data))
+}
+
+func TestFiltersConcurrentUpdates(t *testing.T) {
+	e, err := NewEventNotif(&mockDockerClient{}, nil, nil, "", "")
+	require.NoError(t, err)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			name := fmt.Sprintf("c%d", i)
+			assert.NoError(t, e.UpdateFilters([]string{name}, nil, "", name))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		f := e.Filters()
+		if len(f.Excludes) > 0 {
+			require.Equal(t, f.Excludes[0], f.ExcludesPattern, "consistent snapshot")
+		}
+	}
+	wg.Wait()
+	assert.Equal(t, []string{"c99"}, e.Filters().Excludes)
+}
@@ -0,0 +1,94 @@
+package discovery
+
+import (
+	"strings"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// EventType defines kind of Event
+type EventType int
+
+// enum of all event types
+const (
+	EventLifecycle EventType = iota // container started or stopped, Status tells which one
+	EventImage                      // image of running container pulled or tagged, Status is not used
+	EventCollect                    // docker-logger started or stopped collecting container's logs, Status tells which one
+	EventDaemon                     // non-container docker event, with WithDaemonEvents only, Daemon tells which one
+	EventScanDone                   // initial scan of running containers completed, with WithScanMarker only
+	EventDeploy                     // compose project's containers started together, with WithDeployments only
+	EventKeepalive                  // tracked container still running, with WithKeepalive only, Status is always set
+	EventSuppress                   // docker-logger suppressed collection of crash looping container, or resumed it if Status not set
+)
+
+// WithImageEvents makes image pull and tag events emitted for running containers using that image,
+// as EventImage typed events, i.e. to mark logs following a deployment. Lifecycle consumers should ignore them.
+func WithImageEvents() Option {
+	return func(e *EventNotif) {
+		e.imageEvents = true
+	}
+}
+
+// processImageEvent emits EventImage for each tracked container using pulled or tagged image
+func (e *EventNotif) processImageEvent(dockerEvent *docker.APIEvents) {
+	action := dockerEvent.Action
+	if action == "" {
+		action = dockerEvent.Status
+	}
+	if action != "pull" && action != "tag" {
+		return
+	}
+	ref := dockerEvent.Actor.Attributes["name"]
+	if ref == "" {
+		ref = dockerEvent.Actor.ID
+	}
+	e.log().Logf("[DEBUG] image event %s %s", action, ref)
+
+	var events []Event
+	for _, c := range e.tracked.snapshot(func(c Event) bool { return sameImage(c.Image, ref) }) {
+		events = append(events, Event{
+			Type:          EventImage,
+			ContainerID:   c.ContainerID,
+			ContainerName: c.ContainerName,
+			RawName:       c.RawName,
+			Group:         c.Group,
+			Image:         ref,
+			TS:            time.Unix(0, dockerEvent.TimeNano),
+			Host:          e.host,
+			Source:        e.source,
+			Labels:        c.Labels,
+			K8s:           c.K8s,
+			NodeID:        c.NodeID,
+			LogFilePath:   c.LogFilePath,
+			ErrFilePath:   c.ErrFilePath,
+		})
+	}
+	e.trackLock.Lock()
+	for _, event := range events {
+		e.countEmitted(event)
+	}
+	e.trackLock.Unlock()
+
+	for _, event := range events {
+		e.log().Logf("[INFO] new image event %+v", event)
+		e.send(event) // not tracked, sent directly
+	}
+}
+
+// sameImage compares image references, "nginx", "nginx:latest" and "docker.io/library/nginx:latest" are the same
+func sameImage(a, b string) bool {
+	return normalizeImage(a) == normalizeImage(b)
+}
+
+func normalizeImage(ref string) string {
+	ref = strings.TrimPrefix(ref, "docker.io/")
+	ref = strings.TrimPrefix(ref, "library/")
+	if strings.Contains(ref, "@") {
+		return ref // digest reference
+	}
+	if i := strings.LastIndex(ref, ":"); i < 0 || strings.Contains(ref[i:], "/") {
+		ref += ":latest" // no tag, colon is a registry port only
+	}
+	return ref
+}
@@ -0,0 +1,82 @@
+package discovery
+
+import (
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventsImage(t *testing.T) {
+	client := &mockDockerClient{containers: []dockerclient.APIContainers{
+		{ID: "id1", Names: []string{"/web"}, Image: "nginx"},
+		{ID: "id2", Names: []string{"/api"}, Image: "reg.example.com:5000/grp/api:v1"},
+	}}
+	events, err := NewEventNotif(client, nil, nil, "", "", WithImageEvents())
+	require.NoError(t, err)
+	assert.Equal(t, "web", (<-events.Channel()).ContainerName)
+	assert.Equal(t, "api", (<-events.Channel()).ContainerName)
+
+	time.Sleep(10 * time.Millisecond)
+	go func() {
+		client.send(&dockerclient.APIEvents{Type: "image", Action: "pull",
+			Actor: dockerclient.APIActor{ID: "redis:latest", Attributes: map[string]string{"name": "redis:latest"}}})
+		client.send(&dockerclient.APIEvents{Type: "image", Action: "delete", Actor: dockerclient.APIActor{ID: "nginx:latest"}})
+		client.send(&dockerclient.APIEvents{Type: "image", Action: "pull", TimeNano: 100,
+			Actor: dockerclient.APIActor{ID: "nginx:latest", Attributes: map[string]string{"name": "nginx:latest"}}})
+		client.send(&dockerclient.APIEvents{Type: "image", Status: "tag",
+			Actor: dockerclient.APIActor{ID: "sha256:123", Attributes: map[string]string{"name": "reg.example.com:5000/grp/api:v1"}}})
+	}()
+
+	ev := <-events.Channel()
+	assert.Equal(t, EventImage, ev.Type)
+	assert.Equal(t, "id1", ev.ContainerID)
+	assert.Equal(t, "web", ev.ContainerName)
+	assert.Equal(t, "nginx:latest", ev.Image)
+	assert.Equal(t, time.Unix(0, 100), ev.TS)
+
+	ev = <-events.Channel()
+	assert.Equal(t, EventImage, ev.Type)
+	assert.Equal(t, "api", ev.ContainerName)
+
+	events.trackLock.Lock()
+	assert.Equal(t, 2, events.tracked.len(), "image events don't change tracking")
+	events.trackLock.Unlock()
+}
+
+func TestEventsImageDisabled(t *testing.T) {
+	client := &mockDockerClient{containers: []dockerclient.APIContainers{{ID: "id1", Names: []string{"/web"}, Image: "nginx"}}}
+	events, err := NewEventNotif(client, nil, nil, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "web", (<-events.Channel()).ContainerName)
+
+	time.Sleep(10 * time.Millisecond)
+	go func() {
+		client.send(&dockerclient.APIEvents{Type: "image", Action: "pull", Actor: dockerclient.APIActor{ID: "nginx:latest"}})
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "stop",
+			Actor: dockerclient.APIActor{ID: "id1", Attributes: map[string]string{"name": "web"}}})
+	}()
+	ev := <-events.Channel()
+	assert.Equal(t, EventLifecycle, ev.Type)
+	assert.False(t, ev.Status)
+}
+
+func TestSameImage(t *testing.T) {
+	tbl := []struct {
+		a, b string
+		res  bool
+	}{
+		{"nginx", "nginx:latest", true},
+		{"nginx", "docker.io/library/nginx:latest", true},
+		{"nginx:1.25", "nginx:1.26", false},
+		{"reg.example.com:5000/app", "reg.example.com:5000/app:latest", true},
+		{"reg.example.com:5000/app:v1", "reg.example.com:5000/app", false},
+		{"umputun/app", "docker.io/umputun/app:latest", true},
+		{"app@sha256:123", "app@sha256:123", true},
+	}
+	for i, tt := range tbl {
+		assert.Equal(t, tt.res, sameImage(tt.a, tt.b), "case #%d", i)
+	}
+}
@@ -0,0 +1,52 @@
+package discovery
+
+import (
+	"regexp"
+)
+
+// exclusionInfra is exclusion reason of excludedBy for infrastructure containers
+const exclusionInfra = "infra pattern"
+
+// DefaultInfraPatterns are name patterns of infrastructure containers, rarely wanted in logs,
+// suggested for WithInfraExcludes
+var DefaultInfraPatterns = []string{
+	`^k8s_POD_`,                 // kubernetes pause containers, with dockershim
+	`^ecs-.+-internalecspause-`, // ecs task pause containers
+	`^ecs-agent$`,
+	`^portainer[_-]agent`,
+	`^rancher-agent`,
+	`^buildx_buildkit_`, // buildx builders
+}
+
+// WithInfraExcludes excludes infrastructure containers with names matching any of patterns, i.e. compiled
+// DefaultInfraPatterns, in addition to name filters. Container included explicitly, by includes or includesPattern,
+// collected anyway unless PrecedenceExcludeWins set, as it excludes containers matching both include and exclude.
+// Patterns not changed by UpdateFilters.
+func WithInfraExcludes(patterns ...*regexp.Regexp) Option {
+	return func(e *EventNotif) {
+		e.infraExcludes = patterns
+	}
+}
+
+// isInfra checks if container name matches any of infra patterns
+func (e *EventNotif) isInfra(containerName string) bool {
+	for _, re := range e.infraExcludes {
+		if re.MatchString(containerName) {
+			return true
+		}
+	}
+	return false
+}
+
+// infraAllowed checks container name against infra patterns, container matching them allowed only if included
+// explicitly and exclude doesn't win. Should be called with filterLock held.
+func (e *EventNotif) infraAllowed(containerName string) bool {
+	if !e.active.infra || !e.isInfra(containerName) {
+		return true
+	}
+	if e.precedence == PrecedenceExcludeWins {
+		return false
+	}
+	return (e.active.includes && contains(containerName, e.includes)) ||
+		(e.active.includesRe && e.includesRegexp.MatchString(containerName))
+}
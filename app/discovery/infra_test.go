@@ -0,0 +1,92 @@
+package discovery
+
+import (
+	"regexp"
+	"testing"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func defaultInfra(t *testing.T) []*regexp.Regexp {
+	res := make([]*regexp.Regexp, 0, len(DefaultInfraPatterns))
+	for _, p := range DefaultInfraPatterns {
+		re, err := regexp.Compile(p)
+		require.NoError(t, err)
+		res = append(res, re)
+	}
+	return res
+}
+
+func TestDefaultInfraPatterns(t *testing.T) {
+	e, err := newEventNotif(&mockDockerClient{}, nil, nil, "", "", WithInfraExcludes(defaultInfra(t)...))
+	require.NoError(t, err)
+	for _, name := range []string{"k8s_POD_web-0_default_1234_0", "ecs-web-3-internalecspause-a1b2", "ecs-agent",
+		"portainer_agent.1.xyz", "portainer-agent", "rancher-agent", "buildx_buildkit_builder0"} {
+		assert.False(t, e.isAllowed(name), name)
+	}
+	for _, name := range []string{"web", "k8s_web_web-0_default_1234_0", "ecs-agent-test", "portainer", "mybuildx_buildkit"} {
+		assert.True(t, e.isAllowed(name), name)
+	}
+	assert.False(t, e.allowAll.Load(), "no fast path with infra patterns")
+}
+
+func TestInfraExcludesPrecedence(t *testing.T) {
+	infra := WithInfraExcludes(regexp.MustCompile("^portainer"))
+	tbl := []struct {
+		name             string
+		excludes         []string
+		includes         []string
+		includesPattern  string
+		precedence       Precedence
+		portainer, other bool
+	}{
+		{name: "infra only", portainer: false, other: true},
+		{name: "with excludes", excludes: []string{"db"}, portainer: false, other: true},
+		{name: "included by list", includes: []string{"portainer_agent", "web"}, portainer: true, other: false},
+		{name: "included by pattern", includesPattern: "^(portainer|web)", portainer: true, other: false},
+		{name: "include not matching infra", includes: []string{"web"}, portainer: false, other: false},
+		{name: "include wins", includes: []string{"portainer_agent"}, precedence: PrecedenceIncludeWins,
+			portainer: true, other: false},
+		{name: "exclude wins", includes: []string{"portainer_agent"}, precedence: PrecedenceExcludeWins,
+			portainer: false, other: false},
+		{name: "exclude wins without includes", excludes: []string{"db"}, precedence: PrecedenceExcludeWins,
+			portainer: false, other: true},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := newEventNotif(&mockDockerClient{}, tt.excludes, tt.includes, tt.includesPattern, "", infra,
+				WithPrecedence(tt.precedence))
+			require.NoError(t, err)
+			assert.Equal(t, tt.portainer, e.isAllowed("portainer_agent"))
+			assert.Equal(t, tt.other, e.isAllowed("cache"))
+			assert.Equal(t, tt.other && len(tt.excludes) == 0, e.isAllowed("db"), "user filters applied")
+		})
+	}
+}
+
+func TestInfraExcludesUpdateFilters(t *testing.T) {
+	e, err := newEventNotif(&mockDockerClient{}, nil, nil, "", "", WithInfraExcludes(regexp.MustCompile("^portainer")),
+		WithDecisionCache(10))
+	require.NoError(t, err)
+	assert.False(t, e.isAllowed("portainer_agent"))
+	require.NoError(t, e.UpdateFilters(nil, []string{"portainer_agent"}, "", ""))
+	assert.True(t, e.isAllowed("portainer_agent"), "included explicitly by updated filters")
+	require.NoError(t, e.UpdateFilters(nil, nil, "", ""))
+	assert.False(t, e.isAllowed("portainer_agent"), "infra patterns kept by update")
+	assert.Equal(t, []string{"^portainer"}, e.Filters().InfraExcludes)
+}
+
+func TestDiagnoseInfra(t *testing.T) {
+	client := &mockDockerClient{containers: []dockerclient.APIContainers{
+		{ID: "id1", Names: []string{"/web"}}, {ID: "id2", Names: []string{"/k8s_POD_web"}}, {ID: "id3", Names: []string{"/db"}},
+	}}
+	d, err := Diagnose(client, []string{"db"}, nil, "", "", WithInfraExcludes(defaultInfra(t)...))
+	require.NoError(t, err)
+	assert.Equal(t, []ContainerDiagnosis{
+		{ID: "id1", Name: "web"},
+		{ID: "id2", Name: "k8s_POD_web", ExcludedBy: "infra pattern"},
+		{ID: "id3", Name: "db", ExcludedBy: "name filter"},
+	}, d.Containers)
+}
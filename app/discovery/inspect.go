@@ -0,0 +1,197 @@
+package discovery
+
+import (
+	"strings"
+	"sync"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// ContainerInspector inspects container, implemented by *docker.Client
+type ContainerInspector interface {
+	InspectContainerWithOptions(opts docker.InspectContainerOptions) (*docker.Container, error)
+}
+
+// WithInspectFallback makes events with missing name or image attributes completed by container inspect,
+// so name and group built from real values. Inspect results cached by container id, until container destroyed.
+// Docker client should implement ContainerInspector, otherwise ignored.
+func WithInspectFallback() Option {
+	return func(e *EventNotif) {
+		e.inspects = &inspectCache{items: map[string]inspected{}}
+	}
+}
+
+// inspectCache keeps attributes of inspected containers by id
+type inspectCache struct {
+	sync.Mutex
+	items map[string]inspected
+}
+
+type inspected struct {
+	name   string
+	image  string
+	labels map[string]string
+}
+
+// eventAttrs returns actor's attributes and image of the event, completed by inspect if enabled and
+// name or image missing. Attributes returned as is if inspect disabled or failed.
+func (e *EventNotif) eventAttrs(dockerEvent *docker.APIEvents) (attrs map[string]string, image string) {
+	attrs, image = dockerEvent.Actor.Attributes, dockerEvent.From
+	if image == "" {
+		image = attrs["image"]
+	}
+	if e.inspects == nil || (attrs["name"] != "" && image != "") {
+		return attrs, image
+	}
+
+	info, ok := e.inspect(dockerEvent.Actor.ID)
+	if !ok {
+		return attrs, image
+	}
+
+	res := make(map[string]string, len(info.labels)+len(attrs)+1)
+	for k, v := range info.labels {
+		res[k] = v
+	}
+	for k, v := range attrs {
+		if v != "" {
+			res[k] = v // event's own attributes win
+		}
+	}
+	if res["name"] == "" {
+		res["name"] = info.name
+	}
+	if image == "" {
+		image = info.image
+	}
+	return res, image
+}
+
+// inspect returns cached container's attributes, inspects container on cache miss
+func (e *EventNotif) inspect(containerID string) (inspected, bool) {
+	e.inspects.Lock()
+	info, ok := e.inspects.items[containerID]
+	e.inspects.Unlock()
+	if ok {
+		return info, true
+	}
+
+	inspector, ok := e.dockerClient.(ContainerInspector)
+	if !ok {
+		e.log().Logf("[WARN] docker client can't inspect containers, inspect fallback ignored")
+		return inspected{}, false
+	}
+	c, err := inspector.InspectContainerWithOptions(docker.InspectContainerOptions{ID: containerID})
+	if err != nil {
+		e.log().Logf("[WARN] can't inspect %s, %v", containerID, err)
+		return inspected{}, false
+	}
+	info = inspected{name: strings.TrimPrefix(c.Name, "/")}
+	if c.Config != nil {
+		info.image, info.labels = c.Config.Image, c.Config.Labels
+	}
+	e.log().Logf("[DEBUG] inspected %s, %+v", containerID, info)
+
+	e.inspects.Lock()
+	e.inspects.items[containerID] = info
+	e.inspects.Unlock()
+	return info, true
+}
+
+// forgetInspect removes container's inspected attributes from cache
+func (e *EventNotif) forgetInspect(containerID string) {
+	if e.inspects == nil {
+		return
+	}
+	e.inspects.Lock()
+	defer e.inspects.Unlock()
+	delete(e.inspects.items, containerID)
+}
+
+// configCache keeps inspected configs of containers by id, for filters by values missing in events and list
+type configCache struct {
+	sync.Mutex
+	items     map[string]containerConfig
+	platforms map[string]string // platforms of inspected images by id
+}
+
+// containerConfig is a part of inspected container config used by filters
+type containerConfig struct {
+	tty      bool
+	runtime  string
+	platform string // os/arch of container's image, resolved with platform filter only
+}
+
+// enableConfigs makes configs cache, if not made yet by another filter
+func (e *EventNotif) enableConfigs() {
+	if e.configs == nil {
+		e.configs = &configCache{items: map[string]containerConfig{}, platforms: map[string]string{}}
+	}
+}
+
+// configFilter checks container against TTY, runtime and platform filters, inspecting it once for all.
+// Returns the filter excluded container, empty if allowed or filters disabled.
+func (e *EventNotif) configFilter(containerID string) string {
+	if e.configs == nil {
+		return ""
+	}
+	cfg, ok := e.config(containerID)
+	if !ok {
+		return ""
+	}
+	if !e.isTTYAllowed(cfg) {
+		return "tty"
+	}
+	if !e.isRuntimeAllowed(cfg) {
+		return "runtime"
+	}
+	if !e.isPlatformAllowed(cfg) {
+		return "platform"
+	}
+	return ""
+}
+
+// config returns cached container's config, inspects container on cache miss. Returns false if inspect failed.
+func (e *EventNotif) config(containerID string) (containerConfig, bool) {
+	e.configs.Lock()
+	cfg, ok := e.configs.items[containerID]
+	e.configs.Unlock()
+	if ok {
+		return cfg, true
+	}
+
+	inspector, ok := e.dockerClient.(ContainerInspector)
+	if !ok {
+		e.log().Logf("[WARN] docker client can't inspect containers, tty, runtime and platform filters ignored")
+		return containerConfig{}, false
+	}
+	c, err := inspector.InspectContainerWithOptions(docker.InspectContainerOptions{ID: containerID})
+	if err != nil {
+		e.log().Logf("[WARN] can't inspect %s for filters, %v", containerID, err)
+		return containerConfig{}, false
+	}
+	if c.Config != nil {
+		cfg.tty = c.Config.Tty
+	}
+	if c.HostConfig != nil {
+		cfg.runtime = c.HostConfig.Runtime
+	}
+	if (len(e.incPlatforms) > 0 || len(e.excPlatforms) > 0) && c.Image != "" {
+		cfg.platform = e.imagePlatform(c.Image)
+	}
+
+	e.configs.Lock()
+	e.configs.items[containerID] = cfg
+	e.configs.Unlock()
+	return cfg, true
+}
+
+// forgetConfig removes container's config from cache
+func (e *EventNotif) forgetConfig(containerID string) {
+	if e.configs == nil {
+		return
+	}
+	e.configs.Lock()
+	defer e.configs.Unlock()
+	delete(e.configs.items, containerID)
+}
@@ -0,0 +1,105 @@
+package discovery
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventsInspectFallback(t *testing.T) {
+	client := &mockInspectClient{inspected: map[string]*dockerclient.Container{
+		"id1": {Name: "/name1", Config: &dockerclient.Config{Image: "reg.example.com/grp/app:latest",
+			Labels: map[string]string{"logger.group.name": "custom", "k1": "v1"}}},
+	}}
+	events, err := NewEventNotif(client, nil, nil, "", "", WithInspectFallback())
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	go func() {
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "start", Actor: dockerclient.APIActor{ID: "id1"}})
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "die",
+			Actor: dockerclient.APIActor{ID: "id1", Attributes: map[string]string{"exitCode": "1", "k1": "v2"}}})
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "destroy", Actor: dockerclient.APIActor{ID: "id1"}})
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "start", Actor: dockerclient.APIActor{ID: "id2"}})
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "start", From: "reg.example.com/other/app",
+			Actor: dockerclient.APIActor{ID: "id3", Attributes: map[string]string{"name": "name3"}}})
+	}()
+
+	ev := <-events.Channel()
+	assert.Equal(t, "name1", ev.ContainerName, "name from inspect")
+	assert.Equal(t, "reg.example.com/grp/app:latest", ev.Image)
+	assert.Equal(t, "custom", ev.Group, "group from inspected labels")
+	assert.Equal(t, "v1", ev.Labels["k1"])
+
+	ev = <-events.Channel()
+	assert.Equal(t, "name1", ev.ContainerName, "cached")
+	assert.Equal(t, "v2", ev.Labels["k1"], "event attributes win")
+	assert.Equal(t, ReasonCrashed, ev.Reason)
+
+	ev = <-events.Channel()
+	assert.Equal(t, "name1", ev.ContainerName, "destroyed container resolved from cache")
+
+	ev = <-events.Channel()
+	assert.Equal(t, "id2", ev.ContainerID, "inspect failed, attributes as is")
+	assert.Equal(t, "", ev.ContainerName)
+
+	ev = <-events.Channel()
+	assert.Equal(t, "name3", ev.ContainerName, "complete attributes not inspected")
+	assert.Equal(t, "other", ev.Group)
+
+	assert.Equal(t, map[string]int{"id1": 1, "id2": 1}, client.inspectCalls())
+	assert.Empty(t, events.inspects.items, "destroyed container forgotten, failed one not cached")
+}
+
+func TestEventsNoInspectFallback(t *testing.T) {
+	client := &mockInspectClient{inspected: map[string]*dockerclient.Container{"id1": {Name: "/name1"}}}
+	events, err := NewEventNotif(client, nil, nil, "", "")
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	go client.send(&dockerclient.APIEvents{Type: "container", Status: "start", Actor: dockerclient.APIActor{ID: "id1"}})
+	ev := <-events.Channel()
+	assert.Equal(t, "", ev.ContainerName, "disabled by default")
+	assert.Empty(t, client.inspectCalls())
+}
+
+type mockInspectClient struct {
+	mockDockerClient
+	inspected map[string]*dockerclient.Container
+	calls     map[string]int
+	lock      sync.Mutex
+}
+
+func (m *mockInspectClient) InspectContainerWithOptions(opts dockerclient.InspectContainerOptions) (*dockerclient.Container, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.calls == nil {
+		m.calls = map[string]int{}
+	}
+	m.calls[opts.ID]++
+	c, ok := m.inspected[opts.ID]
+	if !ok {
+		return nil, errors.New("no such container")
+	}
+	return c, nil
+}
+
+func (m *mockInspectClient) inspectCalls() map[string]int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.calls
+}
+
+func TestEventsInspectForgetDestroyed(t *testing.T) {
+	events := &EventNotif{tracked: newRegistry(), eventsCh: make(chan Event, 1), inspects: &inspectCache{items: map[string]inspected{
+		"id1": {name: "name1", image: "img1"}, "id2": {name: "name2", image: "img2"}}}}
+	events.processEvent(&dockerclient.APIEvents{Type: "container", Status: "destroy", Time: time.Now().Unix(),
+		Actor: dockerclient.APIActor{ID: "id1", Attributes: map[string]string{"name": "name1", "image": "img1"}}})
+	ev := <-events.eventsCh
+	assert.Equal(t, "name1", ev.ContainerName)
+	assert.Equal(t, map[string]inspected{"id2": {name: "name2", image: "img2"}}, events.inspects.items,
+		"destroyed container forgotten, even if event attributes complete")
+}
@@ -0,0 +1,36 @@
+package discovery
+
+import (
+	"time"
+)
+
+// WithKeepalive makes EventKeepalive typed event re-emitted for each tracked container every interval, so consumers
+// expiring container state on inactivity can refresh it for long-running quiet containers. Keepalive is a copy of
+// container's up event with Status set and TS of the keepalive, tracked state and stats not changed. Sent by the
+// listener between docker events, not sent while disconnected, as tracked state is stale till resynced.
+// Zero interval disables keepalives.
+func WithKeepalive(interval time.Duration) Option {
+	return func(e *EventNotif) {
+		e.keepalive = interval
+	}
+}
+
+// keepaliveTicker returns channel fired every keepalive interval and func stopping it, nil channel if disabled
+func (e *EventNotif) keepaliveTicker() (tick <-chan time.Time, stop func()) {
+	if e.keepalive <= 0 {
+		return nil, func() {}
+	}
+	ticker := time.NewTicker(e.keepalive)
+	return ticker.C, ticker.Stop
+}
+
+// emitKeepalives sends EventKeepalive for each tracked container, in order of names
+func (e *EventNotif) emitKeepalives() {
+	tracked := e.tracked.snapshot(nil)
+	ts := time.Now()
+	for _, c := range tracked {
+		c.Type, c.Status, c.TS, c.Seq, c.Raw, c.FromScan = EventKeepalive, true, ts, 0, nil, false
+		e.send(c)
+	}
+	e.log().Logf("[DEBUG] keepalive of %d containers", len(tracked))
+}
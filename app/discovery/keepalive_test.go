@@ -0,0 +1,78 @@
+package discovery
+
+import (
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeepalive(t *testing.T) {
+	client := &mockDockerClient{containers: []dockerclient.APIContainers{
+		{ID: "id1", Names: []string{"/web"}, Image: "nginx"}, {ID: "id2", Names: []string{"/db"}, Image: "postgres"},
+	}}
+	events, err := NewEventNotif(client, nil, nil, "", "", WithKeepalive(50*time.Millisecond), WithSequence())
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		ev := <-events.Channel()
+		assert.Equal(t, EventLifecycle, ev.Type)
+	}
+	require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, 5*time.Millisecond)
+
+	next := func() Event {
+		select {
+		case ev := <-events.Channel():
+			return ev
+		case <-time.After(time.Second):
+			t.Fatal("no event")
+		}
+		return Event{}
+	}
+	var lastTS time.Time
+	for round := 0; round < 2; round++ {
+		db, web := next(), next()
+		assert.Equal(t, EventKeepalive, db.Type)
+		assert.Equal(t, EventKeepalive, web.Type)
+		assert.Equal(t, "db", db.ContainerName, "ordered by name")
+		assert.Equal(t, "web", web.ContainerName)
+		assert.Equal(t, "nginx", web.Image)
+		assert.False(t, web.FromScan, "scanned container's keepalive")
+		assert.True(t, web.Status)
+		assert.Equal(t, db.Seq+1, web.Seq, "keepalives sequenced")
+		assert.True(t, web.TS.After(lastTS), "ts of keepalive")
+		lastTS = web.TS
+	}
+
+	client.remove("id1")
+	down := next()
+	for down.Type == EventKeepalive { // keepalive of the round fired before removal
+		down = next()
+	}
+	assert.Equal(t, "web", down.ContainerName)
+	assert.False(t, down.Status)
+	ev := next()
+	assert.Equal(t, EventKeepalive, ev.Type)
+	assert.Equal(t, "db", ev.ContainerName, "removed container not kept alive")
+
+	st := events.Stats()
+	assert.Equal(t, 2, st.Up, "keepalives not counted")
+	assert.Equal(t, 1, st.Tracked)
+	tracked, ok := events.tracked.get("id2")
+	require.True(t, ok)
+	assert.Equal(t, EventLifecycle, tracked.Type, "tracked state not changed")
+}
+
+func TestKeepaliveDisabled(t *testing.T) {
+	client := &mockDockerClient{containers: []dockerclient.APIContainers{{ID: "id1", Names: []string{"/web"}, Image: "nginx"}}}
+	events, err := NewEventNotif(client, nil, nil, "", "")
+	require.NoError(t, err)
+	ev := <-events.Channel()
+	assert.Equal(t, "web", ev.ContainerName)
+	select {
+	case ev := <-events.Channel():
+		t.Fatalf("unexpected event %+v", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,30 @@
+package discovery
+
+// K8sMeta is kubernetes pod metadata of the container, parsed from labels set by kubelet with docker runtime
+type K8sMeta struct {
+	Pod       string // io.kubernetes.pod.name
+	Namespace string // io.kubernetes.pod.namespace
+	PodUID    string // io.kubernetes.pod.uid
+	Container string // io.kubernetes.container.name
+}
+
+// WithK8sMeta makes events carry kubernetes pod metadata in Event.K8s, for containers with io.kubernetes.* labels
+func WithK8sMeta() Option {
+	return func(e *EventNotif) {
+		e.withK8s = true
+	}
+}
+
+// k8sMeta returns kubernetes metadata from labels, nil if container isn't a kubernetes pod's one
+func k8sMeta(labels map[string]string) *K8sMeta {
+	pod := labels["io.kubernetes.pod.name"]
+	if pod == "" {
+		return nil
+	}
+	return &K8sMeta{
+		Pod:       pod,
+		Namespace: labels["io.kubernetes.pod.namespace"],
+		PodUID:    labels["io.kubernetes.pod.uid"],
+		Container: labels["io.kubernetes.container.name"],
+	}
+}
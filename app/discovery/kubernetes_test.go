@@ -0,0 +1,46 @@
+package discovery
+
+import (
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestK8sMeta(t *testing.T) {
+	assert.Nil(t, k8sMeta(nil))
+	assert.Nil(t, k8sMeta(map[string]string{"io.kubernetes.pod.namespace": "ns1"}), "no pod name")
+	assert.Equal(t, &K8sMeta{Pod: "web-1", Namespace: "ns1", PodUID: "uid1", Container: "app"},
+		k8sMeta(map[string]string{"io.kubernetes.pod.name": "web-1", "io.kubernetes.pod.namespace": "ns1",
+			"io.kubernetes.pod.uid": "uid1", "io.kubernetes.container.name": "app", "other": "blah"}))
+}
+
+func TestEventsK8sMeta(t *testing.T) {
+	labels := map[string]string{"io.kubernetes.pod.name": "web-1", "io.kubernetes.pod.namespace": "ns1",
+		"io.kubernetes.container.name": "app"}
+	client := &mockDockerClient{containers: []dockerclient.APIContainers{{ID: "id1", Names: []string{"/k8s_app_web-1"}, Labels: labels}}}
+	events, err := NewEventNotif(client, nil, nil, "", "", WithK8sMeta())
+	require.NoError(t, err)
+	ev := <-events.Channel()
+	assert.Equal(t, &K8sMeta{Pod: "web-1", Namespace: "ns1", Container: "app"}, ev.K8s)
+
+	time.Sleep(10 * time.Millisecond)
+	attrs := map[string]string{"name": "k8s_app_web-2", "io.kubernetes.pod.name": "web-2", "io.kubernetes.pod.namespace": "ns1"}
+	go client.send(&dockerclient.APIEvents{Type: "container", Status: "start", Actor: dockerclient.APIActor{ID: "id2", Attributes: attrs}})
+	ev = <-events.Channel()
+	assert.Equal(t, &K8sMeta{Pod: "web-2", Namespace: "ns1"}, ev.K8s)
+
+	go client.add("id3", "plain")
+	ev = <-events.Channel()
+	assert.Nil(t, ev.K8s, "not a k8s container")
+}
+
+func TestEventsK8sMetaDisabled(t *testing.T) {
+	client := &mockDockerClient{containers: []dockerclient.APIContainers{{ID: "id1", Names: []string{"/c1"},
+		Labels: map[string]string{"io.kubernetes.pod.name": "web-1"}}}}
+	events, err := NewEventNotif(client, nil, nil, "", "")
+	require.NoError(t, err)
+	assert.Nil(t, (<-events.Channel()).K8s)
+}
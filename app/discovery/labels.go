@@ -0,0 +1,26 @@
+package discovery
+
+import (
+	"strings"
+)
+
+// WithSkipLabels excludes containers having any of the labels, i.e. to skip nested containers in docker-in-docker
+// setups, marked with a "parent" label by the tooling starting them. Label given as "key" matches on presence,
+// as "key=value" on the exact value.
+func WithSkipLabels(labels ...string) Option {
+	return func(e *EventNotif) {
+		e.skipLabels = labels
+	}
+}
+
+// skipLabel returns the first skip label matching container's labels, empty if none matched
+func (e *EventNotif) skipLabel(labels map[string]string) string {
+	for _, l := range e.skipLabels {
+		key, val, withValue := strings.Cut(l, "=")
+		v, ok := labels[key]
+		if ok && (!withValue || v == val) {
+			return l
+		}
+	}
+	return ""
+}
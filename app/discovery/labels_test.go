@@ -0,0 +1,41 @@
+package discovery
+
+import (
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSkipLabel(t *testing.T) {
+	e := EventNotif{skipLabels: []string{"parent", "runner=nested"}}
+	assert.Equal(t, "parent", e.skipLabel(map[string]string{"parent": "abc"}), "presence")
+	assert.Equal(t, "parent", e.skipLabel(map[string]string{"parent": ""}), "presence, empty value")
+	assert.Equal(t, "runner=nested", e.skipLabel(map[string]string{"runner": "nested"}), "exact value")
+	assert.Equal(t, "", e.skipLabel(map[string]string{"runner": "top"}), "other value")
+	assert.Equal(t, "", e.skipLabel(map[string]string{"other": "abc"}))
+	assert.Equal(t, "", e.skipLabel(nil))
+	assert.Equal(t, "", (&EventNotif{}).skipLabel(map[string]string{"parent": "abc"}), "disabled by default")
+}
+
+func TestEmitSkipLabels(t *testing.T) {
+	client := &mockDockerClient{containers: []dockerclient.APIContainers{
+		{ID: "id1", Names: []string{"/nested"}, Labels: map[string]string{"parent": "dind"}},
+		{ID: "id2", Names: []string{"/top"}},
+	}}
+	events, err := NewEventNotif(client, nil, nil, "", "", WithSkipLabels("parent"))
+	require.NoError(t, err)
+	assert.Equal(t, "top", (<-events.Channel()).ContainerName)
+
+	time.Sleep(10 * time.Millisecond)
+	go func() {
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "start",
+			Actor: dockerclient.APIActor{ID: "id3", Attributes: map[string]string{"name": "nested2", "parent": "dind"}}})
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "start",
+			Actor: dockerclient.APIActor{ID: "id4", Attributes: map[string]string{"name": "top2"}}})
+	}()
+	assert.Equal(t, "top2", (<-events.Channel()).ContainerName, "nested live event skipped")
+	assert.Equal(t, 1, events.Stats().Filtered)
+}
@@ -0,0 +1,142 @@
+package discovery
+
+import (
+	"sort"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// WithMaxContainers limits number of tracked (started) containers, a safety valve for runaway environments.
+// Start events beyond the limit are not emitted, so no new streams opened. The initial scan picks containers
+// with "logger.priority" label or in one of priorityGroups first. Skipped containers wait in order they were
+// skipped and admitted, with their start event, as soon as tracked ones go down. Events of skipped containers
+// never admitted are not emitted, including their stop and removal.
+func WithMaxContainers(limit int, priorityGroups ...string) Option {
+	return func(e *EventNotif) {
+		e.maxContainers = limit
+		e.priorityGroups = priorityGroups
+	}
+}
+
+// LimitStatus returns number of tracked containers and flag set if some running containers skipped due to the limit
+func (e *EventNotif) LimitStatus() (count int, limitHit bool) {
+	e.trackLock.Lock()
+	defer e.trackLock.Unlock()
+	return e.tracked.len(), len(e.waiting) > 0
+}
+
+// admit checks if container of event fits the limit, returns false if event should not be emitted: start of
+// container over the limit, queued as waiting, and any event of skipped container not admitted since.
+// Should be called with trackLock held.
+func (e *EventNotif) admit(event Event) bool {
+	if e.maxContainers <= 0 {
+		return true
+	}
+	if !event.Status {
+		if !e.skipped[event.ContainerID] {
+			return true
+		}
+		e.unqueue(event.ContainerID)
+		if event.Reason == ReasonRemoved {
+			delete(e.skipped, event.ContainerID)
+		}
+		return false
+	}
+	if _, ok := e.tracked.get(event.ContainerID); ok || e.tracked.len() < e.maxContainers {
+		e.unqueue(event.ContainerID)
+		delete(e.skipped, event.ContainerID)
+		return true
+	}
+	if !e.queue(event) {
+		e.log().Logf("[WARN] max containers limit %d reached, container %s skipped", e.maxContainers, event.ContainerName)
+	}
+	e.skipped[event.ContainerID] = true
+	return false
+}
+
+// admitWaiting takes waiting containers fitting the limit, oldest first, and tracks them.
+// Returns their start events to be sent. Should be called with trackLock held.
+func (e *EventNotif) admitWaiting() []Event {
+	var res []Event
+	for len(e.waiting) > 0 && e.tracked.len() < e.maxContainers {
+		event := e.waiting[0]
+		e.waiting = e.waiting[1:]
+		delete(e.skipped, event.ContainerID)
+		e.tracked.update(event)
+		e.countEmitted(event)
+		e.log().Logf("[INFO] container %s admitted, below max containers limit %d", event.ContainerName, e.maxContainers)
+		res = append(res, event)
+	}
+	return res
+}
+
+// queue adds start event of skipped container to the end of waiting ones, or replaces its event keeping the order.
+// Returns true if container was waiting already.
+func (e *EventNotif) queue(event Event) bool {
+	for i := range e.waiting {
+		if e.waiting[i].ContainerID == event.ContainerID {
+			e.waiting[i] = event
+			return true
+		}
+	}
+	e.waiting = append(e.waiting, event)
+	return false
+}
+
+// unqueue removes container from waiting ones
+func (e *EventNotif) unqueue(containerID string) {
+	for i := range e.waiting {
+		if e.waiting[i].ContainerID == containerID {
+			e.waiting = append(e.waiting[:i], e.waiting[i+1:]...)
+			return
+		}
+	}
+}
+
+// pruneWaiting drops waiting containers not running anymore, gone while events missed
+func (e *EventNotif) pruneWaiting(running []Event) {
+	seen := map[string]bool{}
+	for _, ev := range running {
+		seen[ev.ContainerID] = true
+	}
+	e.trackLock.Lock()
+	defer e.trackLock.Unlock()
+	for _, ev := range append([]Event(nil), e.waiting...) {
+		if !seen[ev.ContainerID] {
+			e.unqueue(ev.ContainerID)
+			delete(e.skipped, ev.ContainerID)
+		}
+	}
+}
+
+// dropWaiting removes waiting containers from ones found by resync, as reported skipped already,
+// refreshing their waiting events
+func (e *EventNotif) dropWaiting(added []Event) []Event {
+	e.trackLock.Lock()
+	defer e.trackLock.Unlock()
+	res := added[:0]
+	for _, ev := range added {
+		if e.skipped[ev.ContainerID] {
+			e.queue(ev)
+			continue
+		}
+		res = append(res, ev)
+	}
+	return res
+}
+
+// sortByPriority orders containers with priority label or group first, keeping docker order otherwise
+func (e *EventNotif) sortByPriority(containers []docker.APIContainers) {
+	if e.maxContainers <= 0 {
+		return
+	}
+	priority := func(c docker.APIContainers) bool {
+		if _, ok := c.Labels["logger.priority"]; ok {
+			return true
+		}
+		return contains(e.groupName(c.Labels, c.Image), e.priorityGroups)
+	}
+	sort.SliceStable(containers, func(i, j int) bool {
+		return priority(containers[i]) && !priority(containers[j])
+	})
+}
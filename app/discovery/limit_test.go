@@ -0,0 +1,154 @@
+package discovery
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxContainers(t *testing.T) {
+	client := &mockDockerClient{}
+	client.add("id1", "name1")
+	client.add("id2", "name2")
+	client.add("id3", "name3")
+	events, err := NewEventNotif(client, nil, nil, "", "", WithMaxContainers(2))
+	require.NoError(t, err)
+
+	assert.Equal(t, "name1", (<-events.Channel()).ContainerName)
+	assert.Equal(t, "name2", (<-events.Channel()).ContainerName)
+	count, hit := events.LimitStatus()
+	assert.Equal(t, 2, count)
+	assert.True(t, hit)
+
+	time.Sleep(10 * time.Millisecond)
+	client.add("id4", "name4") // over the limit, waits after id3
+	client.remove("id1")
+	ev := <-events.Channel()
+	assert.Equal(t, "id1", ev.ContainerID)
+	assert.False(t, ev.Status)
+	ev = <-events.Channel()
+	assert.Equal(t, "name3", ev.ContainerName, "the first skipped admitted once slot freed")
+	assert.True(t, ev.Status)
+	count, hit = events.LimitStatus()
+	assert.Equal(t, 2, count)
+	assert.True(t, hit, "id4 still waiting")
+
+	client.remove("id4") // never admitted, stop not emitted
+	client.remove("id2")
+	ev = <-events.Channel()
+	assert.Equal(t, "id2", ev.ContainerID)
+	assert.False(t, ev.Status)
+	client.add("id5", "name5")
+	ev = <-events.Channel()
+	assert.Equal(t, "name5", ev.ContainerName, "slot of id2 free, nothing waiting")
+	assert.True(t, ev.Status)
+	count, hit = events.LimitStatus()
+	assert.Equal(t, 2, count)
+	assert.False(t, hit)
+	assert.Empty(t, events.Channel())
+}
+
+func TestMaxContainersSkippedEvents(t *testing.T) {
+	e := &EventNotif{tracked: newRegistry(), skipped: map[string]bool{}, maxContainers: 1, eventsCh: make(chan Event, 10)}
+	e.emit(Event{ContainerID: "id1", ContainerName: "name1", Status: true})
+	e.emit(Event{ContainerID: "id2", ContainerName: "name2", Status: true})
+	e.emit(Event{ContainerID: "id2", ContainerName: "name2", Status: false, Reason: ReasonStopped})
+	e.emit(Event{ContainerID: "id2", ContainerName: "name2", Status: false, Reason: ReasonRemoved})
+	e.emit(Event{ContainerID: "id3", ContainerName: "name3", Status: true})
+	e.emit(Event{ContainerID: "id1", ContainerName: "name1", Status: false, Reason: ReasonStopped})
+	e.emit(Event{ContainerID: "id2", ContainerName: "name2", Status: false, Reason: ReasonRemoved})
+
+	var res []string
+	for len(e.eventsCh) > 0 {
+		ev := <-e.eventsCh
+		res = append(res, fmt.Sprintf("%s:%v", ev.ContainerID, ev.Status))
+	}
+	assert.Equal(t, []string{"id1:true", "id1:false", "id3:true", "id2:false"}, res,
+		"events of skipped id2 not emitted, removal after forgotten emitted as usual")
+	assert.Empty(t, e.skipped)
+	assert.Empty(t, e.waiting)
+}
+
+func TestMaxContainersResyncPrunesWaiting(t *testing.T) {
+	e := &EventNotif{tracked: newRegistry(), skipped: map[string]bool{}, maxContainers: 1, eventsCh: make(chan Event, 10)}
+	e.emit(Event{ContainerID: "id1", Status: true})
+	e.emit(Event{ContainerID: "id2", Status: true})
+	e.emit(Event{ContainerID: "id3", Status: true})
+	e.pruneWaiting([]Event{{ContainerID: "id1"}, {ContainerID: "id3"}}) // id2 gone while events missed
+	require.Len(t, e.waiting, 1)
+	assert.Equal(t, "id3", e.waiting[0].ContainerID)
+	assert.Equal(t, map[string]bool{"id3": true}, e.skipped)
+}
+
+func TestMaxContainersResyncWaiting(t *testing.T) {
+	client := &mockDockerClient{}
+	client.add("id1", "name1")
+	client.add("id2", "name2")
+	var lock sync.Mutex
+	var lines []string
+	logger := LoggerFunc(func(format string, args ...any) {
+		lock.Lock()
+		defer lock.Unlock()
+		lines = append(lines, fmt.Sprintf(format, args...))
+	})
+	events, err := NewEventNotif(client, nil, nil, "", "", WithMaxContainers(1), WithLogger(logger))
+	require.NoError(t, err)
+	require.Equal(t, "id1", (<-events.Channel()).ContainerID)
+	require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, 5*time.Millisecond)
+
+	events.Resync()
+	events.Resync()
+	select {
+	case ev := <-events.Channel():
+		t.Fatalf("reported container emitted again, %+v", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+	lock.Lock()
+	assert.NotContains(t, lines, "[INFO] resync, container name2 added")
+	assert.Contains(t, lines, "[DEBUG] resync completed, added 0, removed 0")
+	lock.Unlock()
+	events.trackLock.Lock()
+	require.Len(t, events.waiting, 1)
+	assert.Equal(t, "id2", events.waiting[0].ContainerID)
+	events.trackLock.Unlock()
+
+	client.remove("id1")
+	assert.False(t, (<-events.Channel()).Status)
+	ev := <-events.Channel()
+	assert.Equal(t, "id2", ev.ContainerID, "waiting container admitted once")
+	assert.True(t, ev.Status)
+	assert.Empty(t, events.Channel())
+}
+
+func TestMaxContainersPriority(t *testing.T) {
+	client := &mockDockerClient{containers: []dockerclient.APIContainers{
+		{ID: "id1", Names: []string{"/name1"}, Image: "reg.example.com/dev/app"},
+		{ID: "id2", Names: []string{"/name2"}, Image: "reg.example.com/prod/app"},
+		{ID: "id3", Names: []string{"/name3"}, Image: "reg.example.com/dev/app", Labels: map[string]string{"logger.priority": "true"}},
+		{ID: "id4", Names: []string{"/name4"}, Image: "reg.example.com/dev/app"},
+	}}
+	events, err := NewEventNotif(client, nil, nil, "", "", WithMaxContainers(2, "prod"))
+	require.NoError(t, err)
+	assert.Equal(t, "name2", (<-events.Channel()).ContainerName)
+	assert.Equal(t, "name3", (<-events.Channel()).ContainerName)
+
+	count, hit := events.LimitStatus()
+	assert.Equal(t, 2, count)
+	assert.True(t, hit)
+}
+
+func TestMaxContainersUnlimited(t *testing.T) {
+	client := &mockDockerClient{}
+	client.add("id1", "name1")
+	events, err := NewEventNotif(client, nil, nil, "", "")
+	require.NoError(t, err)
+	<-events.Channel()
+	count, hit := events.LimitStatus()
+	assert.Equal(t, 1, count)
+	assert.False(t, hit)
+}
@@ -0,0 +1,34 @@
+package discovery
+
+import (
+	log "github.com/go-pkgz/lgr"
+)
+
+// Logger is used by EventNotif for own logs, level passed as a prefix of format, i.e. "[WARN] can't inspect".
+// Implemented by go-pkgz/lgr loggers, other backends, i.e. slog or zap, can be adapted with LoggerFunc.
+type Logger interface {
+	Logf(format string, args ...any)
+}
+
+// LoggerFunc is an adapter to use ordinary function as Logger
+type LoggerFunc func(format string, args ...any)
+
+// Logf calls f(format, args...)
+func (f LoggerFunc) Logf(format string, args ...any) { f(format, args...) }
+
+// WithLogger sets logger of EventNotif, default lgr logger used if not set or nil
+func WithLogger(l Logger) Option {
+	return func(e *EventNotif) {
+		if l != nil {
+			e.logger = l
+		}
+	}
+}
+
+// log returns logger set by WithLogger, or default lgr logger
+func (e *EventNotif) log() Logger {
+	if e.logger == nil {
+		return log.Default()
+	}
+	return e.logger
+}
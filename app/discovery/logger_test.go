@@ -0,0 +1,46 @@
+package discovery
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithLogger(t *testing.T) {
+	var lock sync.Mutex
+	var lines []string
+	logger := LoggerFunc(func(format string, args ...any) {
+		lock.Lock()
+		defer lock.Unlock()
+		lines = append(lines, fmt.Sprintf(format, args...))
+	})
+	client := &mockDockerClient{}
+	client.add("id1", "name1")
+	_, err := NewEventNotif(client, []string{"name1"}, nil, "", "", WithLogger(logger))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, 5*time.Millisecond)
+
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Contains(t, lines, "[INFO] container name1 excluded", "own logs routed to logger")
+}
+
+func TestWithLoggerCaller(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := log.New(log.Out(buf), log.Debug, log.CallerFunc)
+	e := &EventNotif{}
+	WithLogger(l)(e)
+	assert.Equal(t, "", e.group("app"))
+	assert.Contains(t, buf.String(), "{discovery.(*EventNotif).group} no group for app",
+		"caller is the logging func, not logger wrapper")
+
+	WithLogger(nil)(e)
+	assert.Equal(t, l, e.logger, "nil ignored")
+	assert.Equal(t, log.Default(), (&EventNotif{}).log(), "default lgr logger")
+}
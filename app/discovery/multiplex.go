@@ -0,0 +1,44 @@
+package discovery
+
+import (
+	"context"
+	"sync"
+)
+
+// Multiplex fans events from multiple EventNotif (usually one per docker host) into a single channel.
+// Each EventNotif keeps its own filters, so filters can be shared by passing the same values to all of them
+// or made host-specific by constructing each EventNotif with different ones.
+// The returned channel is closed when ctx is canceled.
+func Multiplex(ctx context.Context, notifs ...*EventNotif) <-chan Event {
+	res := make(chan Event, 100)
+
+	var wg sync.WaitGroup
+	for _, n := range notifs {
+		wg.Add(1)
+		go func(ch <-chan Event) {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case ev, ok := <-ch:
+					if !ok {
+						return
+					}
+					select {
+					case res <- ev:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}(n.Channel())
+	}
+
+	go func() {
+		wg.Wait()
+		close(res)
+	}()
+
+	return res
+}
@@ -0,0 +1,42 @@
+package discovery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiplex(t *testing.T) {
+	client1, client2 := &mockDockerClient{}, &mockDockerClient{}
+	client1.add("id1", "name1")
+	client2.add("id2", "name2")
+
+	events1, err := NewEventNotif(client1, nil, nil, "", "", WithHost("host1"))
+	require.NoError(t, err)
+	events2, err := NewEventNotif(client2, []string{"name3"}, nil, "", "", WithHost("host2"))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := Multiplex(ctx, events1, events2)
+
+	received := map[string]string{}
+	for i := 0; i < 2; i++ {
+		ev := <-ch
+		received[ev.ContainerName] = ev.Host
+	}
+	assert.Equal(t, map[string]string{"name1": "host1", "name2": "host2"}, received)
+
+	time.Sleep(10 * time.Millisecond)
+	go client2.add("id3", "name3") // excluded by host-specific filter
+	go client1.add("id4", "name4")
+	ev := <-ch
+	assert.Equal(t, "name4", ev.ContainerName)
+	assert.Equal(t, "host1", ev.Host)
+
+	cancel()
+	_, ok := <-ch
+	assert.False(t, ok, "closed on cancel")
+}
@@ -0,0 +1,44 @@
+package discovery
+
+import (
+	"regexp"
+)
+
+// NameKind is a kind of container name recognized by ParseContainerName
+type NameKind int
+
+// enum of all name kinds
+const (
+	NamePlain   NameKind = iota // name of no known scheme
+	NameSwarm                   // swarm task, service.replica.task
+	NameCompose                 // compose container, project-service-index or project_service_index
+)
+
+// ContainerName is a container name split into components. Components not used by the kind are empty.
+type ContainerName struct {
+	Kind    NameKind
+	Name    string // the whole name, as given
+	Service string // swarm or compose service
+	Replica string // swarm replica number
+	Task    string // swarm task id
+	Project string // compose project
+	Index   string // compose container number
+}
+
+var reSwarm = regexp.MustCompile(`(?m)(.*)\.(\d+)\.(.*)`)
+var reCompose = regexp.MustCompile(`^([^-_]+)[-_](.+)[-_](\d+)$`)
+
+// ParseContainerName splits container name, without leading slash, into swarm or compose components.
+// Swarm task names checked first, compose names are project, service and index joined by "-" (compose v2)
+// or "_" (compose v1). Name alone can't tell project's separator from service's one, so the project is
+// the first segment, and a plain name like "my-app-1" parsed as compose. Prefer com.docker.compose.* labels
+// if available. Names of no known scheme returned as NamePlain with Name only.
+func ParseContainerName(name string) ContainerName {
+	if r := reSwarm.FindStringSubmatch(name); len(r) == 4 {
+		return ContainerName{Kind: NameSwarm, Name: name, Service: r[1], Replica: r[2], Task: r[3]}
+	}
+	if r := reCompose.FindStringSubmatch(name); len(r) == 4 {
+		return ContainerName{Kind: NameCompose, Name: name, Project: r[1], Service: r[2], Index: r[3]}
+	}
+	return ContainerName{Kind: NamePlain, Name: name}
+}
@@ -0,0 +1,42 @@
+package discovery
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseContainerName(t *testing.T) {
+	tbl := []struct {
+		name string
+		res  ContainerName
+	}{
+		{"web.1.abcdef123", ContainerName{Kind: NameSwarm, Name: "web.1.abcdef123", Service: "web", Replica: "1", Task: "abcdef123"}},
+		{"stack_api.12.x9y8z7", ContainerName{Kind: NameSwarm, Name: "stack_api.12.x9y8z7", Service: "stack_api", Replica: "12",
+			Task: "x9y8z7"}},
+		{"my.svc.3.t1", ContainerName{Kind: NameSwarm, Name: "my.svc.3.t1", Service: "my.svc", Replica: "3", Task: "t1"}},
+		{"proj-web-1", ContainerName{Kind: NameCompose, Name: "proj-web-1", Project: "proj", Service: "web", Index: "1"}},
+		{"proj_db_2", ContainerName{Kind: NameCompose, Name: "proj_db_2", Project: "proj", Service: "db", Index: "2"}},
+		{"app-redis-cache-10", ContainerName{Kind: NameCompose, Name: "app-redis-cache-10", Project: "app", Service: "redis-cache",
+			Index: "10"}},
+		{"nginx", ContainerName{Kind: NamePlain, Name: "nginx"}},
+		{"web-1", ContainerName{Kind: NamePlain, Name: "web-1"}},
+		{"proj-web-latest", ContainerName{Kind: NamePlain, Name: "proj-web-latest"}},
+		{"svc.global.t1", ContainerName{Kind: NamePlain, Name: "svc.global.t1"}},
+		{"", ContainerName{Kind: NamePlain}},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.res, ParseContainerName(tt.name))
+		})
+	}
+}
+
+func TestBuildContainerName(t *testing.T) {
+	assert.Equal(t, "web-1", buildContainerName(nil, "web.1.abcdef123"), "swarm task")
+	assert.Equal(t, "web-1", buildContainerName(map[string]string{"logger.container.name": "custom"}, "web.1.abcdef123"),
+		"swarm name wins over label")
+	assert.Equal(t, "custom", buildContainerName(map[string]string{"logger.container.name": "custom"}, "proj-web-1"))
+	assert.Equal(t, "proj-web-1", buildContainerName(nil, "proj-web-1"), "compose name kept")
+	assert.Equal(t, "nginx", buildContainerName(map[string]string{"logger.container.name": ""}, "nginx"))
+}
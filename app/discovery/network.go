@@ -0,0 +1,143 @@
+package discovery
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// Network is container's addresses and ports, for correlating logs with network flows
+type Network struct {
+	IP    string            // primary address, on "bridge" network if attached, otherwise on the first network by name
+	IPs   map[string]string // addresses by network name, for multi-network containers
+	Ports []Port            // exposed ports, ordered by container's port
+}
+
+// Port is exposed container's port, published or not
+type Port struct {
+	Private int    // container's port
+	Public  int    // host port, zero if not published
+	Proto   string // tcp, udp or sctp
+	HostIP  string // host address the port published on
+}
+
+// WithNetwork makes up events carry container's addresses and ports in Event.Network. Initial scan gets them
+// from containers list, live events by container inspect, cached until container goes down.
+// Docker client should implement ContainerInspector, otherwise live events have no network.
+func WithNetwork() Option {
+	return func(e *EventNotif) {
+		e.networks = &networkCache{items: map[string]*Network{}}
+	}
+}
+
+// networkCache keeps network of inspected containers by id
+type networkCache struct {
+	sync.Mutex
+	items map[string]*Network
+}
+
+// scanNetwork returns network of listed container, nil if disabled
+func (e *EventNotif) scanNetwork(c docker.APIContainers) *Network {
+	if e.networks == nil {
+		return nil
+	}
+	res := &Network{IPs: map[string]string{}}
+	for name, n := range c.Networks.Networks {
+		res.IPs[name] = address(n)
+	}
+	for _, p := range c.Ports {
+		res.Ports = append(res.Ports, Port{Private: int(p.PrivatePort), Public: int(p.PublicPort), Proto: p.Type, HostIP: p.IP})
+	}
+	return res.complete()
+}
+
+// eventNetwork returns network of live event's container, inspected on up and forgotten on down events.
+// Nil if disabled, for down events or if inspect failed.
+func (e *EventNotif) eventNetwork(containerID string, up bool) *Network {
+	if e.networks == nil {
+		return nil
+	}
+	if !up {
+		e.forgetNetwork(containerID) // addresses change on the next start
+		return nil
+	}
+	e.networks.Lock()
+	defer e.networks.Unlock()
+	if n, ok := e.networks.items[containerID]; ok {
+		return n
+	}
+
+	inspector, ok := e.dockerClient.(ContainerInspector)
+	if !ok {
+		e.log().Logf("[WARN] docker client can't inspect containers, no network for %s", containerID)
+		return nil
+	}
+	c, err := inspector.InspectContainerWithOptions(docker.InspectContainerOptions{ID: containerID})
+	if err != nil {
+		e.log().Logf("[WARN] can't inspect network of %s, %v", containerID, err)
+		return nil
+	}
+	res := &Network{IPs: map[string]string{}}
+	if c.NetworkSettings != nil {
+		for name, n := range c.NetworkSettings.Networks {
+			res.IPs[name] = address(n)
+		}
+		for port, bindings := range c.NetworkSettings.Ports {
+			private, _ := strconv.Atoi(port.Port())
+			if len(bindings) == 0 {
+				res.Ports = append(res.Ports, Port{Private: private, Proto: port.Proto()})
+			}
+			for _, b := range bindings {
+				public, _ := strconv.Atoi(b.HostPort)
+				res.Ports = append(res.Ports, Port{Private: private, Public: public, Proto: port.Proto(), HostIP: b.HostIP})
+			}
+		}
+	}
+	e.networks.items[containerID] = res.complete()
+	return e.networks.items[containerID]
+}
+
+// forgetNetwork removes container's network from cache
+func (e *EventNotif) forgetNetwork(containerID string) {
+	if e.networks == nil {
+		return
+	}
+	e.networks.Lock()
+	delete(e.networks.items, containerID)
+	e.networks.Unlock()
+}
+
+// complete picks primary address and orders ports
+func (n *Network) complete() *Network {
+	names := make([]string, 0, len(n.IPs))
+	for name := range n.IPs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if n.IPs[name] != "" && (n.IP == "" || name == "bridge") {
+			n.IP = n.IPs[name]
+		}
+	}
+	sort.Slice(n.Ports, func(i, j int) bool {
+		a, b := n.Ports[i], n.Ports[j]
+		if a.Private != b.Private {
+			return a.Private < b.Private
+		}
+		if a.Proto != b.Proto {
+			return a.Proto < b.Proto
+		}
+		return a.HostIP < b.HostIP
+	})
+	return n
+}
+
+// address returns network's ipv4 address, or ipv6 one for ipv6-only networks
+func address(n docker.ContainerNetwork) string {
+	if n.IPAddress != "" {
+		return n.IPAddress
+	}
+	return n.GlobalIPv6Address
+}
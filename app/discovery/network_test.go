@@ -0,0 +1,104 @@
+package discovery
+
+import (
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmitNetwork(t *testing.T) {
+	client := &mockInspectClient{mockDockerClient: mockDockerClient{containers: []dockerclient.APIContainers{
+		{ID: "id1", Names: []string{"/web"},
+			Ports: []dockerclient.APIPort{
+				{PrivatePort: 443, PublicPort: 8443, Type: "tcp", IP: "0.0.0.0"},
+				{PrivatePort: 80, PublicPort: 8080, Type: "tcp", IP: "0.0.0.0"},
+				{PrivatePort: 53, Type: "udp"},
+			},
+			Networks: dockerclient.NetworkList{Networks: map[string]dockerclient.ContainerNetwork{
+				"front": {IPAddress: "172.18.0.5"},
+				"back":  {IPAddress: "172.19.0.5"},
+			}}},
+		{ID: "id2", Names: []string{"/host"}},
+	}}}
+	events, err := NewEventNotif(client, nil, nil, "", "", WithNetwork())
+	require.NoError(t, err)
+
+	ev := <-events.Channel()
+	require.NotNil(t, ev.Network)
+	assert.Equal(t, "172.19.0.5", ev.Network.IP, "first network by name")
+	assert.Equal(t, map[string]string{"front": "172.18.0.5", "back": "172.19.0.5"}, ev.Network.IPs)
+	assert.Equal(t, []Port{{Private: 53, Proto: "udp"}, {Private: 80, Public: 8080, Proto: "tcp", HostIP: "0.0.0.0"},
+		{Private: 443, Public: 8443, Proto: "tcp", HostIP: "0.0.0.0"}}, ev.Network.Ports)
+
+	ev = <-events.Channel()
+	require.NotNil(t, ev.Network)
+	assert.Equal(t, "", ev.Network.IP, "no networks")
+	assert.Empty(t, ev.Network.Ports)
+}
+
+func TestEventsNetwork(t *testing.T) {
+	client := &mockInspectClient{inspected: map[string]*dockerclient.Container{
+		"id1": {NetworkSettings: &dockerclient.NetworkSettings{
+			Networks: map[string]dockerclient.ContainerNetwork{
+				"bridge": {IPAddress: "172.17.0.2"},
+				"app":    {IPAddress: "172.20.0.2"},
+				"v6":     {GlobalIPv6Address: "fd00::2"},
+			},
+			Ports: map[dockerclient.Port][]dockerclient.PortBinding{
+				"8080/tcp": {{HostIP: "0.0.0.0", HostPort: "80"}, {HostIP: "::", HostPort: "80"}},
+				"9090/tcp": nil,
+			},
+		}},
+	}}
+	events, err := NewEventNotif(client, nil, nil, "", "", WithNetwork())
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	start := &dockerclient.APIEvents{Type: "container", Status: "start",
+		Actor: dockerclient.APIActor{ID: "id1", Attributes: map[string]string{"name": "name1"}}}
+	go func() {
+		client.send(start)
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "restart",
+			Actor: dockerclient.APIActor{ID: "id1", Attributes: map[string]string{"name": "name1"}}})
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "die",
+			Actor: dockerclient.APIActor{ID: "id1", Attributes: map[string]string{"name": "name1", "exitCode": "0"}}})
+		client.send(start)
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "start",
+			Actor: dockerclient.APIActor{ID: "id2", Attributes: map[string]string{"name": "name2"}}})
+	}()
+
+	ev := <-events.Channel()
+	require.NotNil(t, ev.Network)
+	assert.Equal(t, "172.17.0.2", ev.Network.IP, "bridge is primary")
+	assert.Equal(t, map[string]string{"bridge": "172.17.0.2", "app": "172.20.0.2", "v6": "fd00::2"}, ev.Network.IPs)
+	assert.Equal(t, []Port{{Private: 8080, Public: 80, Proto: "tcp", HostIP: "0.0.0.0"},
+		{Private: 8080, Public: 80, Proto: "tcp", HostIP: "::"}, {Private: 9090, Proto: "tcp"}}, ev.Network.Ports)
+
+	ev = <-events.Channel()
+	assert.NotNil(t, ev.Network, "restart, from cache")
+	ev = <-events.Channel()
+	assert.False(t, ev.Status)
+	assert.Nil(t, ev.Network, "no network for down events")
+	ev = <-events.Channel()
+	assert.NotNil(t, ev.Network, "inspected again after down")
+	ev = <-events.Channel()
+	assert.Equal(t, "id2", ev.ContainerID)
+	assert.Nil(t, ev.Network, "inspect failed")
+
+	assert.Equal(t, map[string]int{"id1": 2, "id2": 1}, client.inspectCalls())
+}
+
+func TestEventsNoNetwork(t *testing.T) {
+	client := &mockInspectClient{mockDockerClient: mockDockerClient{containers: []dockerclient.APIContainers{
+		{ID: "id1", Names: []string{"/web"}, Ports: []dockerclient.APIPort{{PrivatePort: 80, Type: "tcp"}}},
+	}}}
+	events, err := NewEventNotif(client, nil, nil, "", "")
+	require.NoError(t, err)
+	assert.Nil(t, (<-events.Channel()).Network, "disabled by default")
+	time.Sleep(10 * time.Millisecond)
+	go client.send(&dockerclient.APIEvents{Type: "container", Status: "start", Actor: dockerclient.APIActor{ID: "id1"}})
+	assert.Nil(t, (<-events.Channel()).Network)
+	assert.Empty(t, client.inspectCalls())
+}
@@ -0,0 +1,67 @@
+package discovery
+
+// Option func type to set optional EventNotif parameters
+type Option func(e *EventNotif)
+
+// WithHost sets host identifier stamped on every Event, used to tell apart events from multiple docker hosts
+func WithHost(host string) Option {
+	return func(e *EventNotif) {
+		e.host = host
+	}
+}
+
+// WithBackoff sets reconnection backoff policy used when docker events listener fails or closed
+func WithBackoff(b Backoff) Option {
+	return func(e *EventNotif) {
+		e.backoff = b
+	}
+}
+
+// WithSource sets identifier of this docker-logger instance stamped on every Event, defaults to os hostname.
+// Useful for environments where os hostname isn't meaningful, i.e. inside a container.
+func WithSource(source string) Option {
+	return func(e *EventNotif) {
+		e.source = source
+	}
+}
+
+// WithRawEvents makes live events carry the original docker event in Event.Raw, for fields not mapped to Event
+func WithRawEvents() Option {
+	return func(e *EventNotif) {
+		e.withRaw = true
+	}
+}
+
+// WithGroupLabels sets ordered list of labels used for group name, the first non-empty wins.
+// I.e. "logger.group.name", "com.docker.stack.namespace", "com.docker.compose.project" unifies grouping across
+// custom, swarm and compose setups. Group derived from image if none of labels set. Default is "logger.group.name" only.
+func WithGroupLabels(labels ...string) Option {
+	return func(e *EventNotif) {
+		e.groupLabels = labels
+	}
+}
+
+// WithNormalizeGroups makes group names lowercased and trimmed, with whitespace replaced by dash,
+// so "System" and " system" from different sources end up in the same group. Raw group names used by default.
+func WithNormalizeGroups() Option {
+	return func(e *EventNotif) {
+		e.normGroups = true
+	}
+}
+
+// WithStripRegistry makes group derived from image registry-agnostic, the first path segment after registry host.
+// I.e. "team" for "registry-a.com/team/app", "registry-b.com:5000/team/app" and "team/app". By default group is
+// the segment between the first two slashes, which is the part after registry host only for images with registry.
+func WithStripRegistry() Option {
+	return func(e *EventNotif) {
+		e.stripRegistry = true
+	}
+}
+
+// WithSplitRestart makes "restart" emitted as a down event immediately followed by an up event,
+// so consumers cycle container's log stream. By default restart emitted as up event only.
+func WithSplitRestart() Option {
+	return func(e *EventNotif) {
+		e.splitRestart = true
+	}
+}
@@ -0,0 +1,43 @@
+package discovery
+
+// PauseBehavior defines how pause and unpause docker events handled
+type PauseBehavior int
+
+// enum of all pause behaviors
+const (
+	PauseTreatAsDown PauseBehavior = iota // pause emitted as down event, unpause as up event
+	PauseMarkPaused                       // pause and unpause only mark container, no events emitted
+)
+
+// WithPauseBehavior sets handling of paused containers. By default pause is a down event, closing log stream,
+// and unpause is an up event reopening it. With PauseMarkPaused container stays tracked and its stream open,
+// as paused container keeps its logs and resumes writing on unpause.
+func WithPauseBehavior(b PauseBehavior) Option {
+	return func(e *EventNotif) {
+		e.pauseBehavior = b
+	}
+}
+
+// markPaused handles pause and unpause with PauseMarkPaused, only tracked containers marked.
+// Returns false for other statuses or behavior.
+func (e *EventNotif) markPaused(containerID, containerName, status string) bool {
+	if e.pauseBehavior != PauseMarkPaused || (status != "pause" && status != "unpause") {
+		return false
+	}
+	e.trackLock.Lock()
+	defer e.trackLock.Unlock()
+	if _, ok := e.tracked.get(containerID); ok && status == "pause" {
+		e.paused[containerID] = true
+	} else {
+		delete(e.paused, containerID)
+	}
+	e.log().Logf("[INFO] container %s %sd", containerName, status)
+	return true
+}
+
+// IsPaused checks if container marked paused, always false unless PauseMarkPaused set
+func (e *EventNotif) IsPaused(containerID string) bool {
+	e.trackLock.Lock()
+	defer e.trackLock.Unlock()
+	return e.paused[containerID]
+}
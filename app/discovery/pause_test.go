@@ -0,0 +1,72 @@
+package discovery
+
+import (
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventsPauseAsDown(t *testing.T) {
+	client := &mockDockerClient{}
+	client.add("id1", "name1")
+	events, err := NewEventNotif(client, nil, nil, "", "")
+	require.NoError(t, err)
+	assert.True(t, (<-events.Channel()).Status)
+
+	time.Sleep(10 * time.Millisecond)
+	go func() {
+		for _, status := range []string{"pause", "unpause", "pause", "unpause"} {
+			client.send(&dockerclient.APIEvents{Type: "container", Status: status,
+				Actor: dockerclient.APIActor{ID: "id1", Attributes: map[string]string{"name": "name1"}}})
+		}
+	}()
+	for i := 0; i < 2; i++ {
+		ev := <-events.Channel()
+		assert.False(t, ev.Status, "paused, cycle #%d", i)
+		assert.Equal(t, ReasonStopped, ev.Reason)
+
+		ev = <-events.Channel()
+		assert.True(t, ev.Status, "unpaused, cycle #%d", i)
+		assert.Equal(t, "name1", ev.ContainerName)
+	}
+	assert.False(t, events.IsPaused("id1"))
+	assert.Equal(t, 0, events.Stats().Paused)
+}
+
+func TestEventsPauseMarkPaused(t *testing.T) {
+	client := &mockDockerClient{}
+	client.add("id1", "name1")
+	events, err := NewEventNotif(client, nil, nil, "", "", WithPauseBehavior(PauseMarkPaused))
+	require.NoError(t, err)
+	assert.True(t, (<-events.Channel()).Status)
+
+	send := func(id, status string) {
+		client.send(&dockerclient.APIEvents{Type: "container", Status: status,
+			Actor: dockerclient.APIActor{ID: id, Attributes: map[string]string{"name": "name-" + id}}})
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		send("id1", "pause")
+		assert.Eventually(t, func() bool { return events.IsPaused("id1") }, time.Second, time.Millisecond, "cycle #%d", i)
+		assert.Equal(t, 1, events.Stats().Paused)
+		count, _ := events.LimitStatus()
+		assert.Equal(t, 1, count, "still tracked")
+
+		send("id1", "unpause")
+		assert.Eventually(t, func() bool { return !events.IsPaused("id1") }, time.Second, time.Millisecond, "cycle #%d", i)
+	}
+	assert.Empty(t, events.Channel(), "no events for pause cycles")
+
+	send("id2", "pause") // not tracked, not marked
+	send("id1", "pause")
+	go send("id1", "die")
+	ev := <-events.Channel()
+	assert.False(t, ev.Status)
+	assert.False(t, events.IsPaused("id1"), "down container unmarked")
+	assert.False(t, events.IsPaused("id2"))
+	assert.Equal(t, 0, events.Stats().Paused)
+}
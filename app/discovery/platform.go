@@ -0,0 +1,93 @@
+package discovery
+
+import (
+	"strings"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// ImageInspector inspects image, implemented by *docker.Client
+type ImageInspector interface {
+	InspectImage(name string) (*docker.Image, error)
+}
+
+// WithPlatformFilter limits containers by platform of their image, as "os/arch", i.e. linux/arm64. Entry without
+// slash matches architecture only, so "arm64" selects arm64 containers of any os. Include keeps only containers of
+// listed platforms, exclude drops containers of listed ones, all platforms kept if both empty.
+//
+// Platform resolved by container inspect followed by inspect of its image, two API calls per container. Container
+// results cached until container destroyed and shared with TTY and runtime filters, image ones cached by image id
+// until image deleted or untagged, so containers of the same image cost a single image inspect. Docker client should
+// implement ContainerInspector and ImageInspector, otherwise filter ignored. Containers failed to inspect allowed.
+func WithPlatformFilter(include, exclude []string) Option {
+	return func(e *EventNotif) {
+		e.incPlatforms, e.excPlatforms = include, exclude
+		if len(include) > 0 || len(exclude) > 0 {
+			e.enableConfigs()
+		}
+	}
+}
+
+// isPlatformAllowed checks platform of container config against platform filter, always true if filter disabled
+// or platform unknown, as image inspect failed
+func (e *EventNotif) isPlatformAllowed(cfg containerConfig) bool {
+	if cfg.platform == "" {
+		return true
+	}
+	if len(e.incPlatforms) > 0 && !matchPlatform(cfg.platform, e.incPlatforms) {
+		return false
+	}
+	return !matchPlatform(cfg.platform, e.excPlatforms)
+}
+
+// matchPlatform checks if "os/arch" platform matches any of platforms, os/arch or arch only
+func matchPlatform(platform string, platforms []string) bool {
+	_, arch, _ := strings.Cut(platform, "/")
+	for _, p := range platforms {
+		if p == platform || (!strings.Contains(p, "/") && p == arch) {
+			return true
+		}
+	}
+	return false
+}
+
+// imagePlatform returns "os/arch" platform of image, inspects image on cache miss. Empty if inspect failed.
+func (e *EventNotif) imagePlatform(imageID string) string {
+	e.configs.Lock()
+	platform, ok := e.configs.platforms[imageID]
+	e.configs.Unlock()
+	if ok {
+		return platform
+	}
+
+	inspector, ok := e.dockerClient.(ImageInspector)
+	if !ok {
+		e.log().Logf("[WARN] docker client can't inspect images, platform filter ignored")
+		return ""
+	}
+	img, err := inspector.InspectImage(imageID)
+	if err != nil {
+		e.log().Logf("[WARN] can't inspect image %s for platform filter, %v", imageID, err)
+		return ""
+	}
+	platform = img.OS + "/" + img.Architecture
+
+	e.configs.Lock()
+	e.configs.platforms[imageID] = platform
+	e.configs.Unlock()
+	return platform
+}
+
+// forgetPlatform removes platform of deleted or untagged image from cache, ignores other events
+func (e *EventNotif) forgetPlatform(dockerEvent *docker.APIEvents) {
+	action := dockerEvent.Action
+	if action == "" {
+		action = dockerEvent.Status
+	}
+	if e.configs == nil || (action != "delete" && action != "untag") {
+		return
+	}
+	e.configs.Lock()
+	defer e.configs.Unlock()
+	delete(e.configs.platforms, dockerEvent.Actor.ID)
+}
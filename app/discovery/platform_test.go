@@ -0,0 +1,148 @@
+package discovery
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchPlatform(t *testing.T) {
+	tbl := []struct {
+		platform  string
+		platforms []string
+		want      bool
+	}{
+		{"linux/arm64", []string{"linux/arm64"}, true},
+		{"linux/arm64", []string{"linux/amd64", "arm64"}, true},
+		{"windows/arm64", []string{"arm64"}, true},
+		{"linux/amd64", []string{"arm64", "windows/amd64"}, false},
+		{"linux/arm", []string{"linux/arm64"}, false},
+		{"linux/arm64", []string{"linux"}, false},
+		{"linux/arm64", nil, false},
+	}
+	for _, tt := range tbl {
+		assert.Equal(t, tt.want, matchPlatform(tt.platform, tt.platforms), "%s in %v", tt.platform, tt.platforms)
+	}
+}
+
+func TestEventsPlatformFilter(t *testing.T) {
+	newClient := func() *mockImageClient {
+		return &mockImageClient{
+			mockInspectClient: mockInspectClient{
+				mockDockerClient: mockDockerClient{containers: []dockerclient.APIContainers{
+					{ID: "id1", Names: []string{"/web"}}, {ID: "id2", Names: []string{"/web-arm"}},
+				}},
+				inspected: map[string]*dockerclient.Container{
+					"id1": {Image: "sha256:amd"}, "id2": {Image: "sha256:arm"},
+					"id3": {Image: "sha256:arm"}, "id4": {Image: "sha256:win"}, "id5": {Image: "sha256:missing"},
+				},
+			},
+			images: map[string]*dockerclient.Image{
+				"sha256:amd": {OS: "linux", Architecture: "amd64"},
+				"sha256:arm": {OS: "linux", Architecture: "arm64"},
+				"sha256:win": {OS: "windows", Architecture: "amd64"},
+			},
+		}
+	}
+
+	tbl := []struct {
+		name             string
+		include, exclude []string
+		want             []string
+	}{
+		{name: "all by default", want: []string{"web", "web-arm", "worker-arm", "win", "unknown"}},
+		{name: "include arch", include: []string{"arm64"}, want: []string{"web-arm", "worker-arm", "unknown"}},
+		{name: "include os/arch", include: []string{"linux/amd64"}, want: []string{"web", "unknown"}},
+		{name: "exclude", exclude: []string{"windows/amd64", "arm64"}, want: []string{"web", "unknown"}},
+		{name: "include and exclude", include: []string{"amd64"}, exclude: []string{"windows/amd64"},
+			want: []string{"web", "unknown"}},
+	}
+
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newClient()
+			events, err := NewEventNotif(client, nil, nil, "", "", WithPlatformFilter(tt.include, tt.exclude))
+			require.NoError(t, err)
+			require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, 5*time.Millisecond)
+			go func() {
+				client.add("id3", "worker-arm")
+				client.add("id4", "win")
+				client.add("id5", "unknown") // image inspect fails, allowed
+			}()
+
+			var names []string
+			for range tt.want {
+				select {
+				case ev := <-events.Channel():
+					names = append(names, ev.ContainerName)
+				case <-time.After(time.Second):
+					t.Fatalf("got %v only", names)
+				}
+			}
+			assert.Equal(t, tt.want, names)
+
+			if tt.include == nil && tt.exclude == nil {
+				assert.Empty(t, client.inspectCalls(), "no inspect if disabled")
+				assert.Empty(t, client.imageCalls(), "no image inspect if disabled")
+				return
+			}
+			assert.Equal(t, map[string]int{"sha256:amd": 1, "sha256:arm": 1, "sha256:win": 1, "sha256:missing": 1},
+				client.imageCalls(), "image inspected once, shared by containers")
+		})
+	}
+}
+
+func TestEventsPlatformFilterNoImageInspect(t *testing.T) {
+	client := &mockInspectClient{
+		mockDockerClient: mockDockerClient{containers: []dockerclient.APIContainers{{ID: "id1", Names: []string{"/web"}}}},
+		inspected:        map[string]*dockerclient.Container{"id1": {Image: "sha256:amd"}},
+	}
+	events, err := NewEventNotif(client, nil, nil, "", "", WithPlatformFilter([]string{"arm64"}, nil))
+	require.NoError(t, err)
+	assert.Equal(t, "web", (<-events.Channel()).ContainerName, "filter ignored")
+}
+
+func TestForgetPlatform(t *testing.T) {
+	e := &EventNotif{eventsCh: make(chan Event, 1)}
+	e.enableConfigs()
+	e.configs.platforms = map[string]string{"sha256:a": "linux/amd64", "sha256:b": "linux/arm64", "sha256:c": "linux/amd64"}
+	e.processEvent(&dockerclient.APIEvents{Type: "image", Action: "delete", Actor: dockerclient.APIActor{ID: "sha256:a"}})
+	e.processEvent(&dockerclient.APIEvents{Type: "image", Status: "untag", Actor: dockerclient.APIActor{ID: "sha256:b"}})
+	e.processEvent(&dockerclient.APIEvents{Type: "image", Action: "pull", Actor: dockerclient.APIActor{ID: "sha256:c"}})
+	assert.Equal(t, map[string]string{"sha256:c": "linux/amd64"}, e.configs.platforms, "deleted and untagged forgotten")
+	assert.Empty(t, e.eventsCh)
+
+	(&EventNotif{}).forgetPlatform(&dockerclient.APIEvents{Type: "image", Action: "delete"}) // no panic if disabled
+}
+
+type mockImageClient struct {
+	mockInspectClient
+	images     map[string]*dockerclient.Image
+	imageLock  sync.Mutex
+	imageCount map[string]int
+}
+
+func (m *mockImageClient) InspectImage(name string) (*dockerclient.Image, error) {
+	m.imageLock.Lock()
+	defer m.imageLock.Unlock()
+	if m.imageCount == nil {
+		m.imageCount = map[string]int{}
+	}
+	m.imageCount[name]++
+	img, ok := m.images[name]
+	if !ok {
+		return nil, errors.New("no such image")
+	}
+	return img, nil
+}
+
+func (m *mockImageClient) imageCalls() map[string]int {
+	m.imageLock.Lock()
+	defer m.imageLock.Unlock()
+	return m.imageCount
+}
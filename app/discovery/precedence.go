@@ -0,0 +1,51 @@
+package discovery
+
+// Precedence defines how container matching both include and exclude filters handled
+type Precedence int
+
+// enum of all precedences
+const (
+	PrecedenceFirst       Precedence = iota // the first defined name filter applies, others ignored, see WithPrecedence
+	PrecedenceExcludeWins                   // all filters apply, container matching both include and exclude excluded
+	PrecedenceIncludeWins                   // all filters apply, container matching both include and exclude included
+)
+
+// WithPrecedence sets precedence of include and exclude filters. By default, PrecedenceFirst, the first defined of
+// includesPattern, excludesPattern, includes and excludes applies and all others ignored, while command filters
+// work as exclude-wins. With PrecedenceExcludeWins or PrecedenceIncludeWins all name filters apply: includes and
+// includesPattern make the include rules, excludes and excludesPattern the exclude ones. Container matching no
+// include rule is excluded if any defined, and conflicts, matching both include and exclude rules, resolved
+// by precedence. Command filters follow the same precedence. Each filter dimension, i.e. name or command, resolved
+// on its own, container should be allowed by all of them.
+func WithPrecedence(p Precedence) Option {
+	return func(e *EventNotif) {
+		e.precedence = p
+	}
+}
+
+// String returns precedence as set by --precedence flag, i.e. "exclude-wins"
+func (p Precedence) String() string {
+	switch p {
+	case PrecedenceExcludeWins:
+		return "exclude-wins"
+	case PrecedenceIncludeWins:
+		return "include-wins"
+	default:
+		return "first"
+	}
+}
+
+// allow resolves filters of a single dimension. hasIncludes tells if any include rule defined, with included
+// and excluded telling which rules container matches.
+func (p Precedence) allow(hasIncludes, included, excluded bool) bool {
+	switch {
+	case p == PrecedenceIncludeWins && included:
+		return true
+	case excluded:
+		return false
+	case hasIncludes:
+		return included
+	default:
+		return true
+	}
+}
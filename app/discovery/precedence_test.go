@@ -0,0 +1,106 @@
+package discovery
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrecedence_allow(t *testing.T) {
+	// hasIncludes, included, excluded -> first (not used by allow), exclude-wins, include-wins
+	tbl := []struct {
+		hasIncludes, included, excluded bool
+		excludeWins, includeWins        bool
+	}{
+		{false, false, false, true, true},
+		{false, false, true, false, false},
+		{true, false, false, false, false},
+		{true, true, false, true, true},
+		{true, false, true, false, false},
+		{true, true, true, false, true}, // the conflict
+	}
+	for i, tt := range tbl {
+		assert.Equal(t, tt.excludeWins, PrecedenceExcludeWins.allow(tt.hasIncludes, tt.included, tt.excluded), "case #%d", i)
+		assert.Equal(t, tt.includeWins, PrecedenceIncludeWins.allow(tt.hasIncludes, tt.included, tt.excluded), "case #%d", i)
+	}
+}
+
+func TestPrecedence_NameFilters(t *testing.T) {
+	type filters struct {
+		excludes, includes               []string
+		includesPattern, excludesPattern string
+	}
+	// expected results for containers "web-1" (matches both), "web-2" (include only), "db-1" (exclude only), "app" (none)
+	type results struct {
+		web1, web2, db1, app bool
+	}
+	tbl := []struct {
+		name                       string
+		filters                    filters
+		first, excludeWins, inWins results
+	}{
+		{"no filters", filters{},
+			results{true, true, true, true}, results{true, true, true, true}, results{true, true, true, true}},
+		{"include pattern and exclude pattern", filters{includesPattern: "^web", excludesPattern: "-1$"},
+			results{true, true, false, false}, results{false, true, false, false}, results{true, true, false, false}},
+		{"include pattern and excludes", filters{includesPattern: "^web", excludes: []string{"web-1", "db-1"}},
+			results{true, true, false, false}, results{false, true, false, false}, results{true, true, false, false}},
+		{"includes and exclude pattern", filters{includes: []string{"web-1", "web-2"}, excludesPattern: "-1$"},
+			results{false, true, false, true}, results{false, true, false, false}, results{true, true, false, false}},
+		{"includes and excludes", filters{includes: []string{"web-1", "web-2"}, excludes: []string{"web-1", "db-1"}},
+			results{true, true, false, false}, results{false, true, false, false}, results{true, true, false, false}},
+		{"exclude pattern only", filters{excludesPattern: "-1$"},
+			results{false, true, false, true}, results{false, true, false, true}, results{false, true, false, true}},
+		{"include and exclude pattern, same container", filters{includesPattern: "^web-1$", excludesPattern: "^web-1$"},
+			results{true, false, false, false}, results{false, false, false, false}, results{true, false, false, false}},
+	}
+
+	for _, tt := range tbl {
+		for _, p := range []struct {
+			precedence Precedence
+			exp        results
+		}{{PrecedenceFirst, tt.first}, {PrecedenceExcludeWins, tt.excludeWins}, {PrecedenceIncludeWins, tt.inWins}} {
+			t.Run(fmt.Sprintf("%s/%d", tt.name, p.precedence), func(t *testing.T) {
+				e, err := newEventNotif(&mockDockerClient{}, tt.filters.excludes, tt.filters.includes, tt.filters.includesPattern,
+					tt.filters.excludesPattern, WithPrecedence(p.precedence))
+				require.NoError(t, err)
+				res := results{e.isAllowed("web-1"), e.isAllowed("web-2"), e.isAllowed("db-1"), e.isAllowed("app")}
+				assert.Equal(t, p.exp, res)
+			})
+		}
+	}
+}
+
+func TestPrecedence_CommandFilters(t *testing.T) {
+	inc, exc := regexp.MustCompile("nginx"), regexp.MustCompile("debug")
+	tbl := []struct {
+		command                    string
+		first, excludeWins, inWins bool
+	}{
+		{"nginx -g daemon off", true, true, true},
+		{"nginx -g debug", false, false, true},
+		{"app --debug", false, false, false},
+		{"app", false, false, false},
+	}
+	for _, tt := range tbl {
+		for _, p := range []struct {
+			precedence Precedence
+			exp        bool
+		}{{PrecedenceFirst, tt.first}, {PrecedenceExcludeWins, tt.excludeWins}, {PrecedenceIncludeWins, tt.inWins}} {
+			e := &EventNotif{includeCmd: inc, excludeCmd: exc, precedence: p.precedence}
+			assert.Equal(t, p.exp, e.isCommandAllowed(tt.command), "%q with precedence %d", tt.command, p.precedence)
+		}
+	}
+}
+
+func TestPrecedence_NoConflicts(t *testing.T) {
+	_, err := newEventNotif(&mockDockerClient{}, []string{"web-1"}, []string{"web-1"}, "", "", WithStrictFilters())
+	require.Error(t, err, "conflict with first defined precedence")
+
+	_, err = newEventNotif(&mockDockerClient{}, []string{"web-1"}, []string{"web-1"}, "", "", WithStrictFilters(),
+		WithPrecedence(PrecedenceExcludeWins))
+	require.NoError(t, err, "resolved by precedence")
+}
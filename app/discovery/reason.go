@@ -0,0 +1,104 @@
+package discovery
+
+import (
+	"strconv"
+)
+
+// Reason defines why container went down, synthesized from docker event status and actor's attributes
+type Reason int
+
+// enum of all down reasons. Mapping of docker events:
+//
+//	die with exitCode 0           -> ReasonStopped
+//	die with exitCode 143         -> ReasonStopped, terminated by SIGTERM, graceful stop
+//	die with signal attribute     -> ReasonKilled
+//	die with other exitCode > 128 -> ReasonKilled, terminated by signal 128+n, i.e. 137 for SIGKILL
+//	die with other exitCode       -> ReasonCrashed
+//	die following oom event       -> ReasonOOMKilled
+//	stop, pause                   -> ReasonStopped, pause with PauseTreatAsDown only
+//	destroy                       -> ReasonRemoved
+const (
+	ReasonNone      Reason = iota // up events and down events without docker event, i.e. found by resync
+	ReasonStopped                 // stopped normally, exit code 0 or 143 for SIGTERM
+	ReasonCrashed                 // exited with non-zero code
+	ReasonOOMKilled               // killed by out-of-memory killer
+	ReasonKilled                  // terminated by signal
+	ReasonRemoved                 // container removed
+)
+
+// String returns reason name, empty for ReasonNone
+func (r Reason) String() string {
+	switch r {
+	case ReasonStopped:
+		return "stopped"
+	case ReasonCrashed:
+		return "crashed"
+	case ReasonOOMKilled:
+		return "oom-killed"
+	case ReasonKilled:
+		return "killed"
+	case ReasonRemoved:
+		return "removed"
+	default:
+		return ""
+	}
+}
+
+// parseReason makes reason from its name, ReasonNone for unknown names
+func parseReason(name string) Reason {
+	for r := ReasonStopped; r <= ReasonRemoved; r++ {
+		if r.String() == name {
+			return r
+		}
+	}
+	return ReasonNone
+}
+
+// exitSIGTERM is exit code of container terminated by SIGTERM, sent by docker stop
+const exitSIGTERM = 128 + 15
+
+// downReason makes reason for down status and actor's attributes. oomed set if oom event was seen for the container.
+func downReason(status string, attrs map[string]string, oomed bool) Reason {
+	switch status {
+	case "destroy":
+		return ReasonRemoved
+	case "stop", "pause":
+		return ReasonStopped
+	case "die":
+		if oomed {
+			return ReasonOOMKilled
+		}
+		if attrs["signal"] != "" {
+			return ReasonKilled
+		}
+		code, err := strconv.Atoi(attrs["exitCode"])
+		switch {
+		case err != nil:
+			return ReasonCrashed // die without exit code is not a normal stop
+		case code == 0, code == exitSIGTERM:
+			return ReasonStopped
+		case code > 128:
+			return ReasonKilled
+		default:
+			return ReasonCrashed
+		}
+	default:
+		return ReasonNone
+	}
+}
+
+// markOOM remembers oom event of the container, docker sends it before die
+func (e *EventNotif) markOOM(containerID string) {
+	e.trackLock.Lock()
+	defer e.trackLock.Unlock()
+	e.ooms[containerID] = true
+}
+
+// takeOOM reports if oom event was seen for the container and forgets it
+func (e *EventNotif) takeOOM(containerID string) bool {
+	e.trackLock.Lock()
+	defer e.trackLock.Unlock()
+	oomed := e.ooms[containerID]
+	delete(e.ooms, containerID)
+	return oomed
+}
@@ -0,0 +1,76 @@
+package discovery
+
+import (
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownReason(t *testing.T) {
+	tbl := []struct {
+		status string
+		attrs  map[string]string
+		oomed  bool
+		res    Reason
+	}{
+		{"die", map[string]string{"exitCode": "0"}, false, ReasonStopped},
+		{"die", map[string]string{"exitCode": "1"}, false, ReasonCrashed},
+		{"die", map[string]string{"exitCode": "128"}, false, ReasonCrashed},
+		{"die", map[string]string{"exitCode": "137"}, false, ReasonKilled},
+		{"die", map[string]string{"exitCode": "143"}, false, ReasonStopped},
+		{"die", map[string]string{"exitCode": "130"}, false, ReasonKilled},
+		{"die", map[string]string{"exitCode": "143", "signal": "15"}, false, ReasonKilled},
+		{"die", map[string]string{"exitCode": "143"}, true, ReasonOOMKilled},
+		{"die", map[string]string{"exitCode": "0", "signal": "9"}, false, ReasonKilled},
+		{"die", map[string]string{"exitCode": "137"}, true, ReasonOOMKilled},
+		{"die", map[string]string{}, false, ReasonCrashed},
+		{"die", map[string]string{"exitCode": "bad"}, false, ReasonCrashed},
+		{"stop", map[string]string{}, false, ReasonStopped},
+		{"pause", map[string]string{}, false, ReasonStopped},
+		{"destroy", map[string]string{"exitCode": "1"}, false, ReasonRemoved},
+		{"start", map[string]string{}, false, ReasonNone},
+	}
+	for i, tt := range tbl {
+		assert.Equal(t, tt.res, downReason(tt.status, tt.attrs, tt.oomed), "case #%d", i)
+	}
+}
+
+func TestReasonString(t *testing.T) {
+	assert.Equal(t, "", ReasonNone.String())
+	assert.Equal(t, "stopped", ReasonStopped.String())
+	assert.Equal(t, "crashed", ReasonCrashed.String())
+	assert.Equal(t, "oom-killed", ReasonOOMKilled.String())
+	assert.Equal(t, "killed", ReasonKilled.String())
+	assert.Equal(t, "removed", ReasonRemoved.String())
+}
+
+func TestEventsReason(t *testing.T) {
+	client := &mockDockerClient{}
+	events, err := NewEventNotif(client, nil, nil, "", "")
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	actor := func(exitCode string) dockerclient.APIActor {
+		return dockerclient.APIActor{ID: "id1", Attributes: map[string]string{"name": "name1", "exitCode": exitCode}}
+	}
+	go func() {
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "start", Actor: actor("")})
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "oom", Actor: actor("")})
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "die", Actor: actor("137")})
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "die", Actor: actor("137")})
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "destroy", Actor: actor("")})
+	}()
+
+	ev := <-events.Channel()
+	assert.True(t, ev.Status)
+	assert.Equal(t, ReasonNone, ev.Reason)
+	ev = <-events.Channel()
+	assert.False(t, ev.Status)
+	assert.Equal(t, ReasonOOMKilled, ev.Reason, "die after oom")
+	ev = <-events.Channel()
+	assert.Equal(t, ReasonKilled, ev.Reason, "oom consumed by the first die")
+	ev = <-events.Channel()
+	assert.Equal(t, ReasonRemoved, ev.Reason)
+}
@@ -0,0 +1,137 @@
+package discovery
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WithConnectBackoff sets delays between retries of initial connect, the scan of running containers made by
+// constructor and the first subscription to docker events, up to WithScanRetries times. Kept apart from reconnect
+// backoff of WithBackoff, as failing initial connect is likely misconfiguration and should fail fast, while a mid-run
+// disconnect is likely transient. Reconnect backoff used if not set.
+func WithConnectBackoff(b Backoff) Option {
+	return func(e *EventNotif) {
+		e.connectBackoff = &b
+	}
+}
+
+// WithReconnectLimit makes listener give up after retries consecutive failed reconnects mid-run, instead of
+// retrying forever. Failed channel closed once given up. Zero, the default, for unlimited reconnects.
+func WithReconnectLimit(retries int) Option {
+	return func(e *EventNotif) {
+		e.reconnectLimit = retries
+	}
+}
+
+// Failed returns channel closed once listener gave up reconnecting to docker, with WithReconnectLimit, or
+// consumer of Channel stalled, with WithStallDetector and StallFail action. No events emitted after that.
+func (e *EventNotif) Failed() <-chan struct{} {
+	return e.failed
+}
+
+// giveUp checks if failed reconnect attempts, counted from 0, exhausted reconnect limit, closes failed channel if so
+func (e *EventNotif) giveUp(attempt int) bool {
+	if e.reconnectLimit <= 0 || attempt < e.reconnectLimit {
+		return false
+	}
+	e.log().Logf("[ERROR] can't reconnect to docker events after %d retries, give up", attempt)
+	e.fail(errors.Errorf("reconnects exhausted after %d retries", attempt))
+	return true
+}
+
+// subscribeGiveUp checks if failed attempts of the first subscription to docker events, counted from 0, exhausted
+// retries of the initial connect, WithScanRetries or reconnect limit if not set, closes failed channel if so
+func (e *EventNotif) subscribeGiveUp(attempt int) bool {
+	limit := e.scanRetries
+	if limit <= 0 {
+		limit = e.reconnectLimit
+	}
+	if limit <= 0 || attempt < limit {
+		return false
+	}
+	e.log().Logf("[ERROR] can't subscribe to docker events after %d retries, give up", attempt)
+	e.fail(errors.Errorf("subscription to docker events failed after %d retries", attempt))
+	return true
+}
+
+// WithReconnectLogInterval throttles logs of failed reconnects during docker outage. The first failure logged
+// as is, later ones summarized once per interval, i.e. "still reconnecting, 12 attempts over 5m0s", and restored
+// connection logged as "reconnected" with outage's duration on the first event received. Zero interval, the default, logs every attempt.
+func WithReconnectLogInterval(interval time.Duration) Option {
+	return func(e *EventNotif) {
+		e.reconnectLog = interval
+	}
+}
+
+// outage tracks failed reconnects to docker events for throttled logs, used by listener only
+type outage struct {
+	start    time.Time // first failure, zero if connected
+	reported time.Time // last logged failure or summary
+	attempts int
+	now      func() time.Time // clock, time.Now if not set
+}
+
+// time returns current time of outage's clock
+func (o *outage) time() time.Time {
+	if o.now == nil {
+		return time.Now()
+	}
+	return o.now()
+}
+
+// reconnectFailed logs failed reconnect attempt with failure message. With WithReconnectLogInterval logs the first
+// failure of outage and then a summary once per interval, other attempts skipped.
+func (e *EventNotif) reconnectFailed(o *outage, msg string, attempt int, delay time.Duration) {
+	now := o.time()
+	o.attempts++
+	switch {
+	case e.reconnectLog <= 0 || o.start.IsZero():
+		if o.start.IsZero() {
+			o.start = now
+		}
+		o.reported = now
+		e.log().Logf("[WARN] %s, reconnect #%d in %v", msg, attempt, delay)
+	case now.Sub(o.reported) >= e.reconnectLog:
+		o.reported = now
+		e.log().Logf("[WARN] still reconnecting, %d attempts over %v, %s", o.attempts,
+			now.Sub(o.start).Round(time.Second), msg)
+	}
+}
+
+// reconnected logs restored connection after failed reconnects and resets outage. Called on the first event
+// delivered by new listener, as the one closed right after added, i.e. by flapping daemon, is a part of outage.
+func (e *EventNotif) reconnected(o *outage) {
+	if o.start.IsZero() {
+		return
+	}
+	e.log().Logf("[INFO] reconnected to docker events after %d attempts over %v", o.attempts,
+		o.time().Sub(o.start).Round(time.Millisecond))
+	*o = outage{now: o.now}
+}
+
+// Err returns the reason Failed channel closed, nil if not failed
+func (e *EventNotif) Err() error {
+	select {
+	case <-e.failed:
+		return e.failErr
+	default:
+		return nil
+	}
+}
+
+// fail closes failed channel with the reason, once
+func (e *EventNotif) fail(err error) {
+	e.failOnce.Do(func() {
+		e.failErr = err
+		close(e.failed)
+	})
+}
+
+// scanBackoff returns backoff of initial connect retries
+func (e *EventNotif) scanBackoff() Backoff {
+	if e.connectBackoff != nil {
+		return *e.connectBackoff
+	}
+	return e.backoff
+}
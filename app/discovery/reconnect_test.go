@@ -0,0 +1,242 @@
+package discovery
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventsConnectBackoff(t *testing.T) {
+	client := &flakyListClient{failures: 10}
+	st := time.Now()
+	_, err := NewEventNotif(client, nil, nil, "", "", WithScanRetries(3),
+		WithConnectBackoff(Backoff{Min: time.Millisecond, Max: time.Millisecond}),
+		WithBackoff(Backoff{Min: time.Hour, Max: time.Hour}))
+	require.Error(t, err, "initial connect failed fast")
+	assert.Less(t, time.Since(st), time.Second, "connect backoff used, not reconnect one")
+	assert.Equal(t, 4, client.listCalls())
+
+	client = &flakyListClient{failures: 1, mockDockerClient: mockDockerClient{
+		containers: []dockerclient.APIContainers{{ID: "id1", Names: []string{"/web"}}}}}
+	events, err := NewEventNotif(client, nil, nil, "", "", WithScanRetries(1),
+		WithBackoff(Backoff{Min: time.Millisecond, Max: time.Millisecond}))
+	require.NoError(t, err, "reconnect backoff used without connect backoff")
+	assert.Equal(t, "web", (<-events.Channel()).ContainerName)
+}
+
+func TestEventsConnectBackoffSubscribe(t *testing.T) {
+	client := &mockDockerClient{listenerErr: errors.New("failed")}
+	st := time.Now()
+	events, err := NewEventNotif(client, nil, nil, "", "", WithScanRetries(2),
+		WithConnectBackoff(Backoff{Min: time.Millisecond, Max: time.Millisecond}),
+		WithBackoff(Backoff{Min: time.Hour, Max: time.Hour}))
+	require.NoError(t, err, "scan succeeded")
+	select {
+	case <-events.Failed():
+	case <-time.After(time.Second):
+		t.Fatal("not given up")
+	}
+	assert.Less(t, time.Since(st), time.Second, "connect backoff used, not reconnect one")
+	require.Error(t, events.Err())
+	assert.Contains(t, events.Err().Error(), "subscription to docker events failed after 2 retries")
+	assert.Equal(t, 0, client.subscriptions())
+
+	client = &mockDockerClient{listenerErr: errors.New("failed")}
+	events, err = NewEventNotif(client, nil, nil, "", "", WithScanRetries(100), WithReconnectLimit(1),
+		WithConnectBackoff(Backoff{Min: time.Millisecond, Max: time.Millisecond}),
+		WithBackoff(Backoff{Min: time.Millisecond, Max: time.Millisecond}))
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond) // beyond reconnect limit, initial connect retries still left
+	client.Lock()
+	client.listenerErr = nil
+	client.Unlock()
+	require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, time.Millisecond)
+
+	client.Lock()
+	client.listenerErr = errors.New("failed")
+	client.Unlock()
+	client.disconnect()
+	select {
+	case <-events.Failed():
+	case <-time.After(time.Second):
+		t.Fatal("not given up")
+	}
+	assert.Contains(t, events.Err().Error(), "reconnects exhausted after 1 retries", "reconnect limit once subscribed")
+}
+
+func TestEventsReconnectLimit(t *testing.T) {
+	client := &mockDockerClient{}
+	events, err := NewEventNotif(client, nil, nil, "", "", WithReconnectLimit(2),
+		WithBackoff(Backoff{Min: time.Millisecond, Max: time.Millisecond}))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, time.Millisecond)
+
+	client.disconnect() // delivered events, so attempts start from scratch
+	require.Eventually(t, func() bool { return client.subscriptions() == 2 }, time.Second, time.Millisecond,
+		"reconnected after mid-run drop")
+	go client.add("id1", "name1")
+	assert.Equal(t, "name1", (<-events.Channel()).ContainerName)
+
+	client.Lock()
+	client.listenerErr = errors.New("failed")
+	client.Unlock()
+	client.disconnect()
+	select {
+	case <-events.Failed():
+	case <-time.After(time.Second):
+		t.Fatal("not given up")
+	}
+	assert.Equal(t, 2, client.subscriptions())
+	assert.False(t, events.Stats().Connected)
+}
+
+func TestEventsReconnectUnlimited(t *testing.T) {
+	client := &mockDockerClient{}
+	events, err := NewEventNotif(client, nil, nil, "", "", WithBackoff(Backoff{Min: time.Millisecond, Max: time.Millisecond}))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, time.Millisecond)
+
+	client.Lock()
+	client.listenerErr = errors.New("failed")
+	client.Unlock()
+	client.disconnect()
+	time.Sleep(50 * time.Millisecond) // dozens of failed reconnects
+	client.Lock()
+	client.listenerErr = nil
+	client.Unlock()
+	require.Eventually(t, func() bool { return client.subscriptions() == 2 }, time.Second, time.Millisecond)
+	select {
+	case <-events.Failed():
+		t.Fatal("gave up with unlimited reconnects")
+	default:
+	}
+}
+
+func TestReconnectLogThrottled(t *testing.T) {
+	var lines []string
+	logger := LoggerFunc(func(format string, args ...any) { lines = append(lines, fmt.Sprintf(format, args...)) })
+	e, err := newEventNotif(&mockDockerClient{}, nil, nil, "", "", WithLogger(logger),
+		WithReconnectLogInterval(50*time.Millisecond))
+	require.NoError(t, err)
+	lines = nil
+
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	down := outage{now: func() time.Time { return ts }}
+	for i := 1; i <= 1000; i++ {
+		e.reconnectFailed(&down, "event listener closed", i, time.Millisecond)
+	}
+	assert.Equal(t, []string{"[WARN] event listener closed, reconnect #1 in 1ms"}, lines, "first failure only")
+	ts = ts.Add(60 * time.Millisecond)
+	for i := 1001; i <= 2000; i++ {
+		e.reconnectFailed(&down, "can't add event listener, failed", i, time.Millisecond)
+	}
+	require.Len(t, lines, 2, "one summary per interval")
+	assert.Equal(t, "[WARN] still reconnecting, 1001 attempts over 0s, can't add event listener, failed", lines[1])
+
+	ts = ts.Add(5 * time.Second)
+	e.reconnected(&down)
+	require.Len(t, lines, 3)
+	assert.Equal(t, "[INFO] reconnected to docker events after 2000 attempts over 5.06s", lines[2])
+	e.reconnected(&down)
+	assert.Len(t, lines, 3, "nothing to report once connected")
+
+	e.reconnectFailed(&down, "event listener closed", 1, time.Millisecond)
+	require.Len(t, lines, 4, "new outage logged from the first failure")
+	assert.Equal(t, "[WARN] event listener closed, reconnect #1 in 1ms", lines[3])
+}
+
+func TestReconnectLogUnthrottled(t *testing.T) {
+	var lines []string
+	logger := LoggerFunc(func(format string, args ...any) { lines = append(lines, fmt.Sprintf(format, args...)) })
+	e, err := newEventNotif(&mockDockerClient{}, nil, nil, "", "", WithLogger(logger))
+	require.NoError(t, err)
+	lines = nil
+	var down outage
+	for i := 1; i <= 100; i++ {
+		e.reconnectFailed(&down, "event listener closed", i, time.Millisecond)
+	}
+	assert.Len(t, lines, 100, "every attempt logged by default")
+	assert.Equal(t, "[WARN] event listener closed, reconnect #100 in 1ms", lines[99])
+}
+
+func TestEventsReconnectLogInterval(t *testing.T) {
+	var lock sync.Mutex
+	var warns, infos []string
+	logger := LoggerFunc(func(format string, args ...any) {
+		lock.Lock()
+		defer lock.Unlock()
+		line := fmt.Sprintf(format, args...)
+		switch {
+		case strings.Contains(line, "listener"):
+			warns = append(warns, line)
+		case strings.Contains(line, "reconnected"):
+			infos = append(infos, line)
+		}
+	})
+	client := &mockDockerClient{listenerErr: errors.New("failed")}
+	_, err := NewEventNotif(client, nil, nil, "", "", WithLogger(logger), WithReconnectLogInterval(time.Hour),
+		WithBackoff(Backoff{Min: time.Millisecond, Max: time.Millisecond}))
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond) // dozens of retries
+
+	client.Lock()
+	client.listenerErr = nil
+	client.Unlock()
+	require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	lock.Lock()
+	assert.Empty(t, infos, "no events over restored connection yet")
+	lock.Unlock()
+
+	client.add("id1", "name1")
+	require.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(infos) == 1
+	}, time.Second, time.Millisecond)
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, []string{"[WARN] can't add event listener, failed, reconnect #1 in 1ms"}, warns)
+	assert.Contains(t, infos[0], "[INFO] reconnected to docker events after ")
+}
+
+func TestEventsReconnectFlapping(t *testing.T) {
+	var lock sync.Mutex
+	var infos []string
+	logger := LoggerFunc(func(format string, args ...any) {
+		lock.Lock()
+		defer lock.Unlock()
+		if line := fmt.Sprintf(format, args...); strings.Contains(line, "reconnected") {
+			infos = append(infos, line)
+		}
+	})
+	client := &mockDockerClient{}
+	_, err := NewEventNotif(client, nil, nil, "", "", WithLogger(logger), WithReconnectLogInterval(time.Hour),
+		WithBackoff(Backoff{Min: time.Millisecond, Max: time.Millisecond}))
+	require.NoError(t, err)
+	for i := 1; i <= 3; i++ { // listener closed right after added
+		require.Eventually(t, func() bool { return client.subscriptions() == i }, time.Second, time.Millisecond)
+		client.disconnect()
+	}
+	require.Eventually(t, func() bool { return client.subscriptions() == 4 }, time.Second, time.Millisecond)
+	lock.Lock()
+	assert.Empty(t, infos, "flapping listener is a part of outage")
+	lock.Unlock()
+
+	client.add("id1", "name1")
+	require.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(infos) == 1
+	}, time.Second, time.Millisecond)
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Contains(t, infos[0], "[INFO] reconnected to docker events after 3 attempts over ")
+}
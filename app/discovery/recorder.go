@@ -0,0 +1,96 @@
+package discovery
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sync"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/pkg/errors"
+)
+
+// RawEventRecorder writes docker events as json lines, one event per line, for replay with Replay.
+// Safe for concurrent use, can be shared by notifiers of multiple hosts.
+type RawEventRecorder struct {
+	wr   io.Writer
+	lock sync.Mutex
+}
+
+// NewRawEventRecorder makes recorder writing to wr. Writer should take care of size limits, i.e. rotate.
+func NewRawEventRecorder(wr io.Writer) *RawEventRecorder {
+	return &RawEventRecorder{wr: wr}
+}
+
+// Record writes the event as a json line
+func (r *RawEventRecorder) Record(event *docker.APIEvents) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "can't marshal docker event")
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	_, err = r.wr.Write(append(data, '\n'))
+	return errors.Wrap(err, "can't write docker event")
+}
+
+// WithRecorder makes every docker event received by listener recorded, before any filtering
+func WithRecorder(recorder *RawEventRecorder) Option {
+	return func(e *EventNotif) {
+		e.recorder = recorder
+	}
+}
+
+// record writes docker event to recorder, if enabled
+func (e *EventNotif) record(event *docker.APIEvents) {
+	if e.recorder == nil {
+		return
+	}
+	if err := e.recorder.Record(event); err != nil {
+		e.log().Logf("[WARN] can't record event, %v", err)
+	}
+}
+
+// Replay makes EventNotif processing docker events recorded by RawEventRecorder instead of docker daemon,
+// with the same filters and options as live events. No initial scan, container lookups, i.e. for command filter
+// or inspect, find nothing. Events channel closed after the last record.
+func Replay(rd io.Reader, excludes, includes []string, includesPattern, excludesPattern string,
+	opts ...Option) (*EventNotif, error) {
+	res, err := newEventNotif(replayClient{}, excludes, includes, includesPattern, excludesPattern, opts...)
+	if err != nil {
+		return nil, err
+	}
+	res.replaying = true
+	go func() {
+		defer close(res.eventsCh)
+		scanner := bufio.NewScanner(rd)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		var line int
+		for scanner.Scan() {
+			line++
+			event := docker.APIEvents{}
+			if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+				res.log().Logf("[WARN] can't parse recorded event at line %d, %v", line, err)
+				continue
+			}
+			res.processEvent(&event)
+		}
+		if err := scanner.Err(); err != nil {
+			res.log().Logf("[WARN] can't read recorded events after line %d, %v", line, err)
+		}
+		res.flushDeployments(true)
+		res.log().Logf("[DEBUG] replayed %d recorded events", line)
+	}()
+	return res, nil
+}
+
+// replayClient is a docker client of replay, with no containers and no events
+type replayClient struct{}
+
+func (replayClient) ListContainers(docker.ListContainersOptions) ([]docker.APIContainers, error) {
+	return nil, nil
+}
+
+func (replayClient) AddEventListener(chan<- *docker.APIEvents) error {
+	return errors.New("no events listener in replay")
+}
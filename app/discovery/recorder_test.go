@@ -0,0 +1,66 @@
+package discovery
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	client := &mockDockerClient{}
+	client.add("id0", "running")
+	buf := bytes.Buffer{}
+	events, err := NewEventNotif(client, nil, nil, "", "", WithRecorder(NewRawEventRecorder(&buf)))
+	require.NoError(t, err)
+	assert.Equal(t, "running", (<-events.Channel()).ContainerName)
+
+	time.Sleep(10 * time.Millisecond)
+	go func() {
+		client.send(&dockerclient.APIEvents{Type: "network", Status: "connect"})
+		client.add("id1", "name1")
+		client.add("id2", "excluded")
+		client.remove("id1")
+	}()
+	assert.Equal(t, "name1", (<-events.Channel()).ContainerName)
+	assert.Equal(t, "excluded", (<-events.Channel()).ContainerName)
+	ev := <-events.Channel()
+	assert.Equal(t, "id1", ev.ContainerID)
+	assert.False(t, ev.Status)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 4, "all received events recorded, scan is not")
+	assert.Contains(t, lines[0], `"type":"network"`, "non-container events recorded too")
+
+	replay, err := Replay(strings.NewReader(buf.String()+"bad line\n"), []string{"excluded"}, nil, "", "")
+	require.NoError(t, err)
+	var replayed []Event
+	for ev := range replay.Channel() {
+		replayed = append(replayed, ev)
+	}
+	require.Len(t, replayed, 2, "excluded filtered by replay, bad line skipped")
+	assert.Equal(t, "name1", replayed[0].ContainerName)
+	assert.True(t, replayed[0].Status)
+	assert.Equal(t, "id1", replayed[1].ContainerID)
+	assert.False(t, replayed[1].Status)
+	assert.Equal(t, 1, replay.Stats().Filtered)
+}
+
+func TestReplayBadFilters(t *testing.T) {
+	_, err := Replay(strings.NewReader(""), nil, nil, "[", "")
+	assert.Error(t, err)
+}
+
+func TestRawEventRecorderError(t *testing.T) {
+	r := NewRawEventRecorder(failWriter{})
+	assert.EqualError(t, r.Record(&dockerclient.APIEvents{}), "can't write docker event: write failed")
+}
+
+type failWriter struct{}
+
+func (failWriter) Write([]byte) (int, error) { return 0, errors.New("write failed") }
@@ -0,0 +1,114 @@
+package discovery
+
+import (
+	"sort"
+	"sync"
+)
+
+// registry keeps tracked, i.e. running and emitted, containers by id with their last up event,
+// including metadata like labels, k8s and network. Safe for concurrent use. Updated by emit only, with trackLock
+// held to keep max containers admission consistent. Resync, stats, max containers count and image events read
+// tracked containers from it. State of containers not tracked, or not emitted as events, is not here: skipped and
+// waiting containers of max containers limit, paused marks, pending oom and creation times kept by their features
+// under trackLock, network and environment caches have own locks.
+type registry struct {
+	lock  sync.RWMutex
+	items map[string]Event
+}
+
+func newRegistry() *registry {
+	return &registry{items: map[string]Event{}}
+}
+
+// update adds container of up event or replaces its event, removes container of down event.
+// Log files of replaced event kept, as set by collector once.
+func (r *registry) update(event Event) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if event.Status {
+		if prev, ok := r.items[event.ContainerID]; ok && event.LogFilePath == "" && event.ErrFilePath == "" {
+			event.LogFilePath, event.ErrFilePath = prev.LogFilePath, prev.ErrFilePath
+		}
+		r.items[event.ContainerID] = event
+		return
+	}
+	delete(r.items, event.ContainerID)
+}
+
+// setLogFiles sets log files of tracked container, returns false if not tracked
+func (r *registry) setLogFiles(containerID, logFile, errFile string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	ev, ok := r.items[containerID]
+	if !ok {
+		return false
+	}
+	ev.LogFilePath, ev.ErrFilePath = logFile, errFile
+	r.items[containerID] = ev
+	return true
+}
+
+// get returns the last up event of tracked container
+func (r *registry) get(containerID string) (Event, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	ev, ok := r.items[containerID]
+	return ev, ok
+}
+
+// len returns number of tracked containers
+func (r *registry) len() int {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return len(r.items)
+}
+
+// snapshot returns tracked containers accepted by filter, all if filter is nil, ordered by name and id
+func (r *registry) snapshot(filter func(Event) bool) []Event {
+	r.lock.RLock()
+	res := make([]Event, 0, len(r.items))
+	for _, ev := range r.items {
+		if filter == nil || filter(ev) {
+			res = append(res, ev)
+		}
+	}
+	r.lock.RUnlock()
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].ContainerName != res[j].ContainerName {
+			return res[i].ContainerName < res[j].ContainerName
+		}
+		return res[i].ContainerID < res[j].ContainerID
+	})
+	return res
+}
+
+// diff compares running containers with tracked ones, returns running not tracked and tracked not running
+func (r *registry) diff(running []Event) (added, removed []Event) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	seen := map[string]bool{}
+	for _, ev := range running {
+		seen[ev.ContainerID] = true
+		if _, ok := r.items[ev.ContainerID]; !ok {
+			added = append(added, ev)
+		}
+	}
+	for id, ev := range r.items {
+		if !seen[id] {
+			removed = append(removed, ev)
+		}
+	}
+	return added, removed
+}
+
+// SetLogFiles records files collector writes container's logs to, reported by ListCurrent until container stopped.
+// Returns false if container not tracked.
+func (e *EventNotif) SetLogFiles(containerID, logFile, errFile string) bool {
+	return e.tracked.setLogFiles(containerID, logFile, errFile)
+}
+
+// ListCurrent returns snapshot of tracked containers, as their last up events, ordered by name.
+// Events are copies, but their Labels, K8s and Network are shared and should not be modified.
+func (e *EventNotif) ListCurrent() []Event {
+	return e.tracked.snapshot(nil)
+}
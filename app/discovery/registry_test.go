@@ -0,0 +1,118 @@
+package discovery
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	r := newRegistry()
+	r.update(Event{ContainerID: "id2", ContainerName: "b", Status: true})
+	r.update(Event{ContainerID: "id1", ContainerName: "a", Status: true, Image: "img1"})
+	r.update(Event{ContainerID: "id3", ContainerName: "a", Status: true})
+	assert.Equal(t, 3, r.len())
+
+	ev, ok := r.get("id1")
+	require.True(t, ok)
+	assert.Equal(t, "img1", ev.Image)
+	r.update(Event{ContainerID: "id1", ContainerName: "a", Status: true, Image: "img2"})
+	ev, _ = r.get("id1")
+	assert.Equal(t, "img2", ev.Image, "replaced by the last up event")
+
+	ids := func(events []Event) (res []string) {
+		for _, ev := range events {
+			res = append(res, ev.ContainerID)
+		}
+		return res
+	}
+	assert.Equal(t, []string{"id1", "id3", "id2"}, ids(r.snapshot(nil)), "ordered by name and id")
+	assert.Equal(t, []string{"id1"}, ids(r.snapshot(func(ev Event) bool { return ev.Image == "img2" })))
+
+	added, removed := r.diff([]Event{{ContainerID: "id1"}, {ContainerID: "id4"}})
+	assert.Equal(t, []string{"id4"}, ids(added))
+	assert.ElementsMatch(t, []string{"id2", "id3"}, ids(removed))
+
+	r.update(Event{ContainerID: "id2", ContainerName: "b"})
+	_, ok = r.get("id2")
+	assert.False(t, ok, "removed by down event")
+	assert.Equal(t, 2, r.len())
+}
+
+func TestRegistry_Concurrent(t *testing.T) {
+	r := newRegistry()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				id := fmt.Sprintf("id%d-%d", i, j%10)
+				r.update(Event{ContainerID: id, ContainerName: id, Status: j < 90})
+			}
+		}(i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				for _, ev := range r.snapshot(nil) {
+					assert.True(t, ev.Status, "only up events kept")
+				}
+				_, _ = r.diff([]Event{{ContainerID: "id1-1"}})
+				_ = r.len()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 0, r.len(), "all containers went down at the end")
+}
+
+func TestEventNotif_ListCurrent(t *testing.T) {
+	client := &mockDockerClient{}
+	client.add("id2", "name2")
+	client.add("id1", "name1")
+	events, err := NewEventNotif(client, nil, nil, "", "")
+	require.NoError(t, err)
+	<-events.Channel()
+	<-events.Channel()
+
+	current := events.ListCurrent()
+	require.Len(t, current, 2)
+	assert.Equal(t, "name1", current[0].ContainerName)
+	assert.Equal(t, "name2", current[1].ContainerName)
+
+	require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, 5*time.Millisecond)
+	go client.remove("id1")
+	ev := <-events.Channel()
+	assert.False(t, ev.Status)
+	current = events.ListCurrent()
+	require.Len(t, current, 1)
+	assert.Equal(t, "id2", current[0].ContainerID)
+	assert.Eventually(t, func() bool { return events.Stats().Tracked == 1 }, time.Second, 5*time.Millisecond)
+}
+
+func TestEventNotif_SetLogFiles(t *testing.T) {
+	client := &mockDockerClient{}
+	client.add("id1", "name1")
+	events, err := NewEventNotif(client, nil, nil, "", "")
+	require.NoError(t, err)
+	<-events.Channel()
+
+	assert.True(t, events.SetLogFiles("id1", "logs/name1.log", "logs/name1.err"))
+	assert.False(t, events.SetLogFiles("id2", "logs/name2.log", "logs/name2.err"), "not tracked")
+	current := events.ListCurrent()
+	require.Len(t, current, 1)
+	assert.Equal(t, "logs/name1.log", current[0].LogFilePath)
+	assert.Equal(t, "logs/name1.err", current[0].ErrFilePath)
+
+	events.tracked.update(Event{ContainerID: "id1", ContainerName: "name1", Status: true})
+	assert.Equal(t, "logs/name1.log", events.ListCurrent()[0].LogFilePath, "kept on replaced up event")
+
+	events.tracked.update(Event{ContainerID: "id1", ContainerName: "name1"})
+	events.tracked.update(Event{ContainerID: "id1", ContainerName: "name1", Status: true})
+	assert.Empty(t, events.ListCurrent()[0].LogFilePath, "forgotten once stopped")
+}
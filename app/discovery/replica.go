@@ -0,0 +1,32 @@
+package discovery
+
+import (
+	"strconv"
+)
+
+// WithReplicaRange limits swarm tasks to replica numbers from minReplica to maxReplica, inclusive, zero for no bound.
+// The replica is the task slot parsed from swarm container name, service.replica.task, not service's replica count,
+// i.e. maxReplica of 1 keeps a single task of each service and minReplica of 2 keeps scaled-out tasks only.
+// Containers with names of other kinds, including global service tasks named by node id, bypass the filter.
+func WithReplicaRange(minReplica, maxReplica int) Option {
+	return func(e *EventNotif) {
+		e.minReplica = minReplica
+		e.maxReplica = maxReplica
+	}
+}
+
+// isReplicaAllowed checks replica of swarm task against replica range, non-swarm names always allowed
+func (e *EventNotif) isReplicaAllowed(name string) bool {
+	if e.minReplica <= 0 && e.maxReplica <= 0 {
+		return true
+	}
+	cn := ParseContainerName(name)
+	if cn.Kind != NameSwarm {
+		return true
+	}
+	replica, err := strconv.Atoi(cn.Replica)
+	if err != nil {
+		return true
+	}
+	return (e.minReplica <= 0 || replica >= e.minReplica) && (e.maxReplica <= 0 || replica <= e.maxReplica)
+}
@@ -0,0 +1,63 @@
+package discovery
+
+import (
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsReplicaAllowed(t *testing.T) {
+	tbl := []struct {
+		name     string
+		min, max int
+		allowed  bool
+	}{
+		{"web.1.abc", 0, 0, true},
+		{"web.1.abc", 2, 0, false},
+		{"web.2.abc", 2, 0, true},
+		{"web.10.abc", 2, 0, true},
+		{"web.1.abc", 0, 1, true},
+		{"web.2.abc", 0, 1, false},
+		{"web.3.abc", 2, 4, true},
+		{"web.5.abc", 2, 4, false},
+		{"web.0.abc", 1, 0, false},
+		{"web.4.abc", 4, 4, true},
+		{"plain", 2, 4, true},
+		{"proj-web-1", 2, 4, true},
+		{"agent.ksqbw0yrk8kmyc3ppkbu3oh5w.xyz", 2, 4, true},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			e := EventNotif{}
+			WithReplicaRange(tt.min, tt.max)(&e)
+			assert.Equal(t, tt.allowed, e.isReplicaAllowed(tt.name), "range %d..%d", tt.min, tt.max)
+		})
+	}
+}
+
+func TestEventsReplicaRange(t *testing.T) {
+	client := &mockDockerClient{containers: []dockerclient.APIContainers{
+		{ID: "id1", Names: []string{"/web.1.abc"}},
+		{ID: "id2", Names: []string{"/web.2.def"}},
+		{ID: "id3", Names: []string{"/web.3.ghi"}},
+		{ID: "id4", Names: []string{"/plain"}},
+	}}
+	events, err := NewEventNotif(client, nil, nil, "", "", WithReplicaRange(2, 2))
+	require.NoError(t, err)
+	assert.Equal(t, "web-2", (<-events.Channel()).ContainerName)
+	assert.Equal(t, "plain", (<-events.Channel()).ContainerName, "non-swarm bypass")
+
+	require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, time.Millisecond)
+	go func() {
+		for _, name := range []string{"api.1.xyz", "api.3.xyz", "api.2.xyz"} {
+			client.send(&dockerclient.APIEvents{Type: "container", Status: "start",
+				Actor: dockerclient.APIActor{ID: name, Attributes: map[string]string{"name": name}}})
+		}
+	}()
+	ev := <-events.Channel()
+	assert.Equal(t, "api-2", ev.ContainerName, "live events filtered")
+	assert.Equal(t, 2, events.Stats().Filtered)
+}
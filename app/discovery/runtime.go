@@ -0,0 +1,25 @@
+package discovery
+
+// WithRuntimeFilter limits containers by OCI runtime, i.e. runc, kata or runsc of gVisor, matched by exact name.
+// Include keeps only containers of listed runtimes, exclude drops containers of listed ones, all runtimes kept
+// if both empty.
+//
+// Runtime, HostConfig.Runtime of container, resolved by container inspect, one API call per container, cached
+// until container destroyed and shared with TTY filter. Docker client should implement ContainerInspector,
+// otherwise filter ignored. Containers failed to inspect allowed.
+func WithRuntimeFilter(include, exclude []string) Option {
+	return func(e *EventNotif) {
+		e.incRuntimes, e.excRuntimes = include, exclude
+		if len(include) > 0 || len(exclude) > 0 {
+			e.enableConfigs()
+		}
+	}
+}
+
+// isRuntimeAllowed checks runtime of container config against runtime filter, always true if filter disabled
+func (e *EventNotif) isRuntimeAllowed(cfg containerConfig) bool {
+	if len(e.incRuntimes) > 0 && !contains(cfg.runtime, e.incRuntimes) {
+		return false
+	}
+	return !contains(cfg.runtime, e.excRuntimes)
+}
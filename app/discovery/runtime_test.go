@@ -0,0 +1,75 @@
+package discovery
+
+import (
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventsRuntimeFilter(t *testing.T) {
+	newClient := func() *mockInspectClient {
+		return &mockInspectClient{
+			mockDockerClient: mockDockerClient{containers: []dockerclient.APIContainers{
+				{ID: "id1", Names: []string{"/plain"}}, {ID: "id2", Names: []string{"/sandboxed"}},
+			}},
+			inspected: map[string]*dockerclient.Container{
+				"id1": {HostConfig: &dockerclient.HostConfig{Runtime: "runc"}},
+				"id2": {HostConfig: &dockerclient.HostConfig{Runtime: "runsc"}},
+				"id3": {HostConfig: &dockerclient.HostConfig{Runtime: "kata"}},
+				"id4": {Config: &dockerclient.Config{Tty: true}, HostConfig: &dockerclient.HostConfig{Runtime: "runc"}},
+			},
+		}
+	}
+
+	tbl := []struct {
+		name             string
+		include, exclude []string
+		tty              bool
+		want             []string
+	}{
+		{name: "all by default", want: []string{"plain", "sandboxed", "kata", "shell", "unknown"}},
+		{name: "include", include: []string{"runsc", "kata"}, want: []string{"sandboxed", "kata", "unknown"}},
+		{name: "exclude", exclude: []string{"runc"}, want: []string{"sandboxed", "kata", "unknown"}},
+		{name: "include and exclude", include: []string{"runc", "kata"}, exclude: []string{"kata"},
+			want: []string{"plain", "shell", "unknown"}},
+		{name: "with tty filter", include: []string{"runc"}, tty: true, want: []string{"shell", "unknown"}},
+	}
+
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newClient()
+			events, err := NewEventNotif(client, nil, nil, "", "", WithRuntimeFilter(tt.include, tt.exclude),
+				WithTTYFilter(tt.tty, false))
+			require.NoError(t, err)
+			require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, 5*time.Millisecond)
+			go func() {
+				client.add("id3", "kata")
+				client.add("id4", "shell")
+				client.add("id5", "unknown") // inspect fails, allowed
+			}()
+
+			var names []string
+			for range tt.want {
+				select {
+				case ev := <-events.Channel():
+					names = append(names, ev.ContainerName)
+				case <-time.After(time.Second):
+					t.Fatalf("got %v only", names)
+				}
+			}
+			assert.Equal(t, tt.want, names)
+
+			calls := client.inspectCalls()
+			if tt.include == nil && tt.exclude == nil {
+				assert.Empty(t, calls, "no inspect if disabled")
+				return
+			}
+			for id, n := range calls {
+				assert.Equal(t, 1, n, "%s inspected once, shared by filters", id)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package discovery
+
+import (
+	"time"
+)
+
+// WithScanMarker makes EventScanDone typed event emitted once, after all up events of the initial scan of
+// running containers and before any live event. Consumers reconciling state on startup, i.e. marking containers
+// not reported by the scan as stopped, can do it on the marker. Watchdog resync and Replay don't emit it.
+func WithScanMarker() Option {
+	return func(e *EventNotif) {
+		e.scanMarker = true
+	}
+}
+
+// WithScanRetries makes the initial scan of running containers retried up to retries times, with connect backoff,
+// if listing containers fails, i.e. transiently on a busy daemon. Constructor fails if all attempts failed,
+// unless WithScanProceed set.
+func WithScanRetries(retries int) Option {
+	return func(e *EventNotif) {
+		e.scanRetries = retries
+	}
+}
+
+// WithScanProceed makes constructor proceed to live events with a warning if the initial scan failed, instead of
+// returning error. Containers running already are not reported until resynced by the watchdog, if enabled,
+// or restarted. Scan marker not emitted for failed scan.
+func WithScanProceed() Option {
+	return func(e *EventNotif) {
+		e.scanProceed = true
+	}
+}
+
+// scanContainers gets running containers for the initial scan, retried with backoff up to scanRetries times
+func (e *EventNotif) scanContainers() ([]Event, error) {
+	var delay time.Duration
+	for attempt := 0; ; attempt++ {
+		events, err := e.runningContainers()
+		if err == nil || attempt >= e.scanRetries {
+			return events, err
+		}
+		delay = e.scanBackoff().delay(attempt, delay)
+		e.log().Logf("[WARN] initial scan failed, %v, retry #%d in %v", err, attempt+1, delay)
+		time.Sleep(delay)
+	}
+}
+
+// emitScanMarker sends EventScanDone after scanned containers, called by constructor only, before
+// listener activated. Channel has room for it, so it's buffered right after the scan events. Not counted in stats.
+func (e *EventNotif) emitScanMarker() {
+	event := Event{Type: EventScanDone, TS: time.Now(), Host: e.host, Source: e.source}
+	e.log().Logf("[INFO] initial scan completed, %d containers tracked", e.tracked.len())
+	e.send(event)
+}
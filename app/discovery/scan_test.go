@@ -0,0 +1,136 @@
+package discovery
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventsScanMarker(t *testing.T) {
+	for _, n := range []int{0, 2, eventsBuffer, 150} {
+		t.Run(fmt.Sprintf("%d containers", n), func(t *testing.T) {
+			client := &mockDockerClient{}
+			for i := 0; i < n; i++ {
+				client.containers = append(client.containers, dockerclient.APIContainers{ID: fmt.Sprintf("id%d", i),
+					Names: []string{fmt.Sprintf("/name%d", i)}, Image: "nginx"})
+			}
+
+			created := make(chan *EventNotif)
+			go func() {
+				events, err := NewEventNotif(client, nil, nil, "", "", WithScanMarker(), WithHost("h1"))
+				assert.NoError(t, err)
+				created <- events
+			}()
+			var events *EventNotif
+			select {
+			case events = <-created:
+			case <-time.After(time.Second):
+				t.Fatal("construction blocked by scan marker")
+			}
+
+			require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, time.Millisecond)
+			go client.send(&dockerclient.APIEvents{Type: "container", Status: "start",
+				Actor: dockerclient.APIActor{ID: "id-live", Attributes: map[string]string{"name": "live"}}})
+
+			for i := 0; i < n; i++ {
+				ev := <-events.Channel()
+				assert.Equal(t, EventLifecycle, ev.Type)
+				assert.Equal(t, fmt.Sprintf("name%d", i), ev.ContainerName)
+			}
+			ev := <-events.Channel()
+			assert.Equal(t, EventScanDone, ev.Type, "marker after scan events")
+			assert.Equal(t, "h1", ev.Host)
+			assert.Empty(t, ev.ContainerID)
+			assert.False(t, ev.TS.IsZero())
+
+			ev = <-events.Channel()
+			assert.Equal(t, "live", ev.ContainerName, "live event after marker")
+			assert.Equal(t, n+1, events.Stats().Up, "marker not counted")
+		})
+	}
+}
+
+func TestEventsScanMarkerDisabled(t *testing.T) {
+	client := &mockDockerClient{containers: []dockerclient.APIContainers{{ID: "id1", Names: []string{"/web"}, Image: "nginx"}}}
+	events, err := NewEventNotif(client, nil, nil, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "web", (<-events.Channel()).ContainerName)
+
+	require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, time.Millisecond)
+	go client.send(&dockerclient.APIEvents{Type: "container", Status: "start",
+		Actor: dockerclient.APIActor{ID: "id2", Attributes: map[string]string{"name": "live"}}})
+	ev := <-events.Channel()
+	assert.Equal(t, EventLifecycle, ev.Type, "no marker by default")
+	assert.Equal(t, "live", ev.ContainerName)
+}
+
+func TestEventsScanRetries(t *testing.T) {
+	noWait := WithBackoff(Backoff{Min: time.Millisecond, Max: time.Millisecond})
+	newClient := func(failures int) *flakyListClient {
+		return &flakyListClient{failures: failures, mockDockerClient: mockDockerClient{
+			containers: []dockerclient.APIContainers{{ID: "id1", Names: []string{"/web"}}}}}
+	}
+
+	t.Run("recovered", func(t *testing.T) {
+		client := newClient(2)
+		events, err := NewEventNotif(client, nil, nil, "", "", noWait, WithScanRetries(2))
+		require.NoError(t, err)
+		assert.Equal(t, "web", (<-events.Channel()).ContainerName)
+		assert.Equal(t, 3, client.listCalls())
+	})
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		client := newClient(3)
+		_, err := NewEventNotif(client, nil, nil, "", "", noWait, WithScanRetries(2))
+		require.ErrorContains(t, err, "failed to emit containers")
+		assert.Equal(t, 3, client.listCalls())
+	})
+
+	t.Run("no retries by default", func(t *testing.T) {
+		client := newClient(1)
+		_, err := NewEventNotif(client, nil, nil, "", "", noWait)
+		require.ErrorContains(t, err, "daemon busy")
+		assert.Equal(t, 1, client.listCalls())
+	})
+
+	t.Run("proceed to live events", func(t *testing.T) {
+		client := newClient(10)
+		events, err := NewEventNotif(client, nil, nil, "", "", noWait, WithScanRetries(1), WithScanProceed(), WithScanMarker())
+		require.NoError(t, err)
+		assert.Equal(t, 2, client.listCalls())
+		require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, time.Millisecond)
+		go client.send(&dockerclient.APIEvents{Type: "container", Status: "start",
+			Actor: dockerclient.APIActor{ID: "id2", Attributes: map[string]string{"name": "api"}}})
+		ev := <-events.Channel()
+		assert.Equal(t, "api", ev.ContainerName, "live event, no scan marker")
+		assert.Equal(t, 1, events.Stats().Tracked)
+	})
+}
+
+// flakyListClient fails ListContainers for the first failures calls
+type flakyListClient struct {
+	mockDockerClient
+	failures int
+	calls    int
+}
+
+func (m *flakyListClient) ListContainers(opts dockerclient.ListContainersOptions) ([]dockerclient.APIContainers, error) {
+	m.Lock()
+	m.calls++
+	fail := m.calls <= m.failures
+	m.Unlock()
+	if fail {
+		return nil, fmt.Errorf("daemon busy")
+	}
+	return m.mockDockerClient.ListContainers(opts)
+}
+
+func (m *flakyListClient) listCalls() int {
+	m.Lock()
+	defer m.Unlock()
+	return m.calls
+}
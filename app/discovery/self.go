@@ -0,0 +1,53 @@
+package discovery
+
+import (
+	"os"
+	"regexp"
+	"strings"
+)
+
+var reContainerID = regexp.MustCompile(`^[0-9a-f]{12,64}$`)
+
+// WithSelfLogs makes docker-logger's own container logged. By default it's excluded to prevent feedback loop
+// of docker-logger logging its own output.
+func WithSelfLogs() Option {
+	return func(e *EventNotif) {
+		e.selfLogs = true
+	}
+}
+
+// WithSelfLabel sets label marking docker-logger's own container, with "true" value. Default is "logger.self".
+// Label is the fallback for setups where own container can't be detected by hostname, i.e. with custom hostname.
+func WithSelfLabel(label string) Option {
+	return func(e *EventNotif) {
+		e.selfLabel = label
+	}
+}
+
+// WithSelfID sets docker-logger's own container id, detected from hostname by default.
+func WithSelfID(id string) Option {
+	return func(e *EventNotif) {
+		e.selfID = id
+	}
+}
+
+// detectSelfID returns own container id if running in container, empty otherwise.
+// Docker sets container's hostname to the short container id unless hostname set explicitly.
+func detectSelfID() string {
+	h, err := os.Hostname()
+	if err != nil || !reContainerID.MatchString(h) {
+		return ""
+	}
+	return h
+}
+
+// isSelf checks if container is docker-logger's own one, by id or label
+func (e *EventNotif) isSelf(containerID string, labels map[string]string) bool {
+	if e.selfLogs {
+		return false
+	}
+	if e.selfID != "" && strings.HasPrefix(containerID, e.selfID) {
+		return true
+	}
+	return e.selfLabel != "" && labels[e.selfLabel] == "true"
+}
@@ -0,0 +1,51 @@
+package discovery
+
+import (
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsSelf(t *testing.T) {
+	e := EventNotif{selfID: "0123456789ab", selfLabel: "logger.self"}
+	assert.True(t, e.isSelf("0123456789abcdef", nil), "id prefix")
+	assert.True(t, e.isSelf("0123456789ab", nil))
+	assert.False(t, e.isSelf("ba9876543210", nil))
+	assert.True(t, e.isSelf("ba9876543210", map[string]string{"logger.self": "true"}), "label")
+	assert.False(t, e.isSelf("ba9876543210", map[string]string{"logger.self": "false"}))
+
+	e.selfLogs = true
+	assert.False(t, e.isSelf("0123456789abcdef", map[string]string{"logger.self": "true"}), "self logs enabled")
+
+	e = EventNotif{}
+	assert.False(t, e.isSelf("0123456789abcdef", map[string]string{"logger.self": "true"}), "nothing to detect")
+}
+
+func TestEmitExcludesSelf(t *testing.T) {
+	client := &mockDockerClient{containers: []dockerclient.APIContainers{
+		{ID: "0123456789abcdef", Names: []string{"/logger"}},
+		{ID: "id2", Names: []string{"/labeled"}, Labels: map[string]string{"my.self": "true"}},
+		{ID: "id3", Names: []string{"/name3"}},
+	}}
+	events, err := NewEventNotif(client, nil, nil, "", "", WithSelfID("0123456789ab"), WithSelfLabel("my.self"))
+	require.NoError(t, err)
+	assert.Equal(t, "name3", (<-events.Channel()).ContainerName)
+
+	time.Sleep(10 * time.Millisecond)
+	go func() {
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "start",
+			Actor: dockerclient.APIActor{ID: "0123456789abcdef", Attributes: map[string]string{"name": "logger"}}})
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "start",
+			Actor: dockerclient.APIActor{ID: "id4", Attributes: map[string]string{"name": "name4"}}})
+	}()
+	assert.Equal(t, "name4", (<-events.Channel()).ContainerName, "own live event skipped")
+
+	events, err = NewEventNotif(client, nil, nil, "", "", WithSelfID("0123456789ab"), WithSelfLabel("my.self"), WithSelfLogs())
+	require.NoError(t, err)
+	assert.Equal(t, "logger", (<-events.Channel()).ContainerName)
+	assert.Equal(t, "labeled", (<-events.Channel()).ContainerName)
+	assert.Equal(t, "name3", (<-events.Channel()).ContainerName)
+}
@@ -0,0 +1,14 @@
+package discovery
+
+// WithSequence stamps each emitted event with Seq, increasing by one for every event of both the initial scan
+// and live events, including scan marker, image and daemon events. A gap in Seq means consumer missed events,
+// i.e. dropped by a full subscription buffer, and Seq orders events of EventNotif deterministically.
+//
+// Sequence is not persisted, it starts from 1 with each EventNotif, so Seq going back to 1 means docker-logger
+// restarted and the initial scan follows. Each EventNotif has own sequence, events of multiple docker hosts
+// ordered by Seq within the same Host only.
+func WithSequence() Option {
+	return func(e *EventNotif) {
+		e.withSeq = true
+	}
+}
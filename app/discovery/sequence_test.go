@@ -0,0 +1,86 @@
+package discovery
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventsSequence(t *testing.T) {
+	client := &mockDockerClient{containers: []dockerclient.APIContainers{
+		{ID: "id1", Names: []string{"/web"}, Image: "nginx"}, {ID: "id2", Names: []string{"/db"}, Image: "postgres"},
+	}}
+	events, err := NewEventNotif(client, nil, nil, "", "", WithSequence(), WithScanMarker())
+	require.NoError(t, err)
+	sub := events.Subscribe("test", 10)
+	require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, 5*time.Millisecond)
+	go func() {
+		client.add("id3", "live")
+		client.remove("id1")
+	}()
+
+	var got []string
+	for i := uint64(1); i <= 5; i++ {
+		select {
+		case ev := <-events.Channel():
+			assert.Equal(t, i, ev.Seq, "event #%d", i)
+			got = append(got, fmt.Sprintf("%s:%v", ev.ContainerName, ev.Status))
+		case <-time.After(time.Second):
+			t.Fatalf("got %v only", got)
+		}
+	}
+	assert.Equal(t, []string{"web:true", "db:true", ":false", "live:true", "web:false"}, got)
+
+	for i := uint64(4); i <= 5; i++ {
+		ev := <-sub.Events()
+		assert.Equal(t, i, ev.Seq, "subscriber gets the same seq")
+	}
+	tracked, ok := events.tracked.get("id3")
+	require.True(t, ok)
+	assert.Zero(t, tracked.Seq, "tracked state has no seq")
+}
+
+func TestEventsSequenceDisabled(t *testing.T) {
+	client := &mockDockerClient{containers: []dockerclient.APIContainers{{ID: "id1", Names: []string{"/web"}, Image: "nginx"}}}
+	events, err := NewEventNotif(client, nil, nil, "", "")
+	require.NoError(t, err)
+	ev := <-events.Channel()
+	assert.Equal(t, "web", ev.ContainerName)
+	assert.Zero(t, ev.Seq)
+}
+
+func TestEventsSequenceConcurrent(t *testing.T) {
+	const emitters, perEmitter = 8, 200
+	events, err := newEventNotif(&mockDockerClient{}, nil, nil, "", "", WithSequence())
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < emitters; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < perEmitter; j++ {
+				id := fmt.Sprintf("id%d-%d", i, j)
+				events.emit(Event{ContainerID: id, ContainerName: id, Status: true, TS: time.Now()})
+			}
+		}(i)
+	}
+	go func() {
+		wg.Wait()
+		close(events.eventsCh)
+	}()
+
+	var last uint64
+	var count int
+	for ev := range events.Channel() {
+		require.Equal(t, last+1, ev.Seq, "strictly increasing without gaps")
+		last = ev.Seq
+		count++
+	}
+	assert.Equal(t, emitters*perEmitter, count)
+}
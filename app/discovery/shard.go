@@ -0,0 +1,43 @@
+package discovery
+
+import (
+	"hash/fnv"
+
+	"github.com/pkg/errors"
+)
+
+// WithShard limits containers to a shard of count shards, the one with index from 0 to count-1, so a fleet of
+// count instances with different indexes divides containers among themselves without overlap or gaps.
+// Container belongs to the shard of FNV-1a hash of its resolved name modulo count, stable across restarts and
+// instances, so a container recreated with the same name stays in its shard. Count of 0 or 1 disables sharding.
+func WithShard(count, index int) Option {
+	return func(e *EventNotif) {
+		e.shardCount, e.shardIndex = count, index
+	}
+}
+
+// validateShard checks shard index is within shard count
+func (e *EventNotif) validateShard() error {
+	if e.shardCount < 0 {
+		return errors.Errorf("invalid shard count %d", e.shardCount)
+	}
+	if e.shardCount > 1 && (e.shardIndex < 0 || e.shardIndex >= e.shardCount) {
+		return errors.Errorf("invalid shard index %d, expected 0 to %d", e.shardIndex, e.shardCount-1)
+	}
+	return nil
+}
+
+// inShard checks container belongs to the shard, always true if sharding disabled
+func (e *EventNotif) inShard(containerName string) bool {
+	if e.shardCount <= 1 {
+		return true
+	}
+	return shardOf(containerName, e.shardCount) == e.shardIndex
+}
+
+// shardOf returns shard of container name, FNV-1a hash of the name modulo count
+func shardOf(containerName string, count int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(containerName))
+	return int(h.Sum32() % uint32(count)) //nolint:gosec // count checked positive
+}
@@ -0,0 +1,95 @@
+package discovery
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardPartitioning(t *testing.T) {
+	names := make([]string, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		names = append(names, fmt.Sprintf("service-%d", i))
+	}
+	for _, count := range []int{2, 3, 7} {
+		t.Run(fmt.Sprintf("%d shards", count), func(t *testing.T) {
+			owners := map[string][]int{}
+			for index := 0; index < count; index++ {
+				e, err := newEventNotif(&mockDockerClient{}, nil, nil, "", "", WithShard(count, index))
+				require.NoError(t, err)
+				var size int
+				for _, name := range names {
+					if e.isAllowed(name) {
+						owners[name] = append(owners[name], index)
+						size++
+					}
+				}
+				assert.Greater(t, size, len(names)/count/2, "shard %d roughly balanced", index)
+			}
+			for _, name := range names {
+				assert.Len(t, owners[name], 1, "%s in exactly one shard", name)
+			}
+		})
+	}
+}
+
+func TestShardStable(t *testing.T) {
+	assert.Equal(t, shardOf("web", 5), shardOf("web", 5))
+	// fixed values, shard must not change across versions and platforms
+	assert.Equal(t, 1, shardOf("web", 2))
+	assert.Equal(t, 0, shardOf("app", 2))
+	assert.Equal(t, 2, shardOf("api", 3))
+}
+
+func TestShardDisabled(t *testing.T) {
+	for _, count := range []int{0, 1} {
+		e, err := newEventNotif(&mockDockerClient{}, nil, nil, "", "", WithShard(count, 5))
+		require.NoError(t, err)
+		assert.True(t, e.isAllowed("web"), "count %d", count)
+	}
+}
+
+func TestShardValidation(t *testing.T) {
+	for _, tt := range []struct{ count, index int }{{-1, 0}, {3, 3}, {3, -1}} {
+		_, err := newEventNotif(&mockDockerClient{}, nil, nil, "", "", WithShard(tt.count, tt.index))
+		assert.Error(t, err, "%d/%d", tt.count, tt.index)
+	}
+}
+
+func TestEventsShard(t *testing.T) {
+	// names of different shards of 2, checked by TestShardStable
+	client := &mockDockerClient{containers: []dockerclient.APIContainers{
+		{ID: "id1", Names: []string{"/web"}}, {ID: "id2", Names: []string{"/app"}},
+	}}
+	events, err := NewEventNotif(client, nil, []string{"web", "app", "api"}, "", "", WithShard(2, 1))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, 5*time.Millisecond)
+	go func() {
+		client.add("id3", "web")
+		client.add("id4", "app")
+	}()
+
+	var names []string
+	for i := 0; i < 2; i++ {
+		select {
+		case ev := <-events.Channel():
+			names = append(names, ev.ContainerName+" "+ev.ContainerID)
+		case <-time.After(time.Second):
+			t.Fatalf("got %v only", names)
+		}
+	}
+	assert.Equal(t, []string{"web id1", "web id3"}, names, "other shard excluded, with include filter too")
+
+	res, err := Diagnose(client, nil, nil, "", "", WithShard(2, 1))
+	require.NoError(t, err)
+	excluded := map[string]string{}
+	for _, c := range res.Containers {
+		excluded[c.Name] = c.ExcludedBy
+	}
+	assert.Empty(t, excluded["web"])
+	assert.Equal(t, "shard", excluded["app"])
+}
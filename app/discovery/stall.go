@@ -0,0 +1,72 @@
+package discovery
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// StallAction is what consumer stall detector does, see WithStallDetector
+type StallAction int
+
+// enum of stall actions
+const (
+	StallLog  StallAction = iota // log error while consumer stalled and keep waiting for it
+	StallFail                    // give up as with exhausted reconnects, Failed channel closed
+)
+
+// WithStallDetector makes consumer of Channel reported as stalled once the channel stayed full for longer than
+// timeout, i.e. consumer deadlocked or its goroutine died on recovered panic. Discovery waits for a slow consumer,
+// so without the detector such a consumer silently blocks it forever. StallLog logs error every timeout till
+// consumer reads again, StallFail gives up, closing Failed channel with Err reporting the stall, so the caller can
+// exit and get restarted by supervisor. Stalled consumer reported by Stats.Stalled. Zero timeout disables detector.
+func WithStallDetector(timeout time.Duration, action StallAction) Option {
+	return func(e *EventNotif) {
+		e.stallTimeout = timeout
+		e.stallAction = action
+	}
+}
+
+// waitConsumer sends event to full eventsCh, waiting for consumer to read it. With stall detector reports
+// consumer stalled every stall timeout of waiting. Drops the event if given up meanwhile.
+func (e *EventNotif) waitConsumer(event Event) {
+	var stall <-chan time.Time
+	if e.stallTimeout > 0 {
+		ticker := time.NewTicker(e.stallTimeout)
+		defer ticker.Stop()
+		stall = ticker.C
+	}
+	start := time.Now()
+	for {
+		select {
+		case e.eventsCh <- event:
+			if e.setStalled(false) {
+				e.log().Logf("[INFO] events consumer resumed after %v", time.Since(start))
+			}
+			return
+		case <-stall:
+			e.consumerStalled(time.Since(start))
+		case <-e.failed:
+			e.log().Logf("[DEBUG] event of %s dropped, given up", event.ContainerName)
+			return
+		}
+	}
+}
+
+// consumerStalled reports consumer not reading full channel for the time waited, and gives up with StallFail
+func (e *EventNotif) consumerStalled(waited time.Duration) {
+	e.setStalled(true)
+	e.log().Logf("[ERROR] events consumer stalled, channel full for %v", waited.Round(time.Millisecond))
+	if e.stallAction == StallFail {
+		e.fail(errors.Errorf("events consumer stalled for %v", waited.Round(time.Millisecond)))
+	}
+}
+
+// setStalled sets consumer state, returns previous one
+func (e *EventNotif) setStalled(stalled bool) bool {
+	e.trackLock.Lock()
+	defer e.trackLock.Unlock()
+	prev := e.stats.stalled
+	e.stats.stalled = stalled
+	return prev
+}
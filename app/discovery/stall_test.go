@@ -0,0 +1,94 @@
+package discovery
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStallDetectorLog(t *testing.T) {
+	e, err := newEventNotif(&mockDockerClient{}, nil, nil, "", "", WithStallDetector(10*time.Millisecond, StallLog))
+	require.NoError(t, err)
+	e.eventsCh = make(chan Event, 1)
+	e.send(Event{ContainerName: "c1"})
+
+	sent := make(chan struct{})
+	go func() {
+		e.send(Event{ContainerName: "c2"})
+		close(sent)
+	}()
+	require.Eventually(t, func() bool { return e.Stats().Stalled }, time.Second, time.Millisecond, "stall detected")
+	time.Sleep(30 * time.Millisecond) // reported while stalled, not given up
+	assert.Nil(t, e.Err())
+
+	assert.Equal(t, "c1", (<-e.eventsCh).ContainerName)
+	<-sent
+	assert.Equal(t, "c2", (<-e.eventsCh).ContainerName, "delivered once consumer resumed")
+	assert.False(t, e.Stats().Stalled)
+	assert.Equal(t, 1, e.Stats().Stalls)
+	select {
+	case <-e.Failed():
+		t.Fatal("failed with log action")
+	default:
+	}
+}
+
+func TestStallDetectorFail(t *testing.T) {
+	e, err := newEventNotif(&mockDockerClient{}, nil, nil, "", "", WithStallDetector(10*time.Millisecond, StallFail))
+	require.NoError(t, err)
+	e.eventsCh = make(chan Event, 1)
+	e.send(Event{ContainerName: "c1"})
+
+	sent := make(chan struct{})
+	go func() {
+		e.send(Event{ContainerName: "c2"})
+		close(sent)
+	}()
+	select {
+	case <-e.Failed():
+	case <-time.After(time.Second):
+		t.Fatal("stall not detected")
+	}
+	require.Error(t, e.Err())
+	assert.Contains(t, e.Err().Error(), "events consumer stalled for")
+	<-sent // event dropped once given up
+	assert.True(t, e.Stats().Stalled)
+	assert.Len(t, e.eventsCh, 1)
+}
+
+func TestFailedStopsListener(t *testing.T) {
+	client := &mockRemoverClient{}
+	client.add("id1", "name1")
+	e, err := NewEventNotif(client, nil, nil, "", "", WithWatchdog(20*time.Millisecond))
+	require.NoError(t, err)
+	require.Equal(t, "id1", (<-e.Channel()).ContainerID)
+	require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, 5*time.Millisecond)
+
+	e.fail(errors.New("test failure"))
+	require.Eventually(t, func() bool {
+		client.Lock()
+		defer client.Unlock()
+		return client.removed == 1
+	}, time.Second, 5*time.Millisecond, "listener removed once given up")
+	client.add("id2", "name2")
+	time.Sleep(50 * time.Millisecond) // a few watchdog intervals
+	assert.Equal(t, 1, client.subscriptions(), "not re-subscribed")
+	assert.Empty(t, e.Channel())
+	assert.False(t, e.Stats().Connected)
+}
+
+func TestStallDetectorDisabled(t *testing.T) {
+	e, err := newEventNotif(&mockDockerClient{}, nil, nil, "", "")
+	require.NoError(t, err)
+	e.eventsCh = make(chan Event, 1)
+	e.send(Event{ContainerName: "c1"})
+	go e.send(Event{ContainerName: "c2"})
+	require.Eventually(t, func() bool { return e.Stats().Stalls == 1 }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.False(t, e.Stats().Stalled)
+	<-e.eventsCh
+	assert.Equal(t, "c2", (<-e.eventsCh).ContainerName)
+}
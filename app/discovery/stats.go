@@ -0,0 +1,99 @@
+package discovery
+
+import (
+	"time"
+)
+
+// Stats is a snapshot of EventNotif activity, for debugging and status reporting
+type Stats struct {
+	Tracked      int       `json:"tracked"`       // containers currently tracked as running
+	Paused       int       `json:"paused"`        // tracked containers marked paused, with PauseMarkPaused only
+	Up           int       `json:"up"`            // up events emitted
+	Down         int       `json:"down"`          // down events emitted
+	Image        int       `json:"image"`         // image events emitted, with WithImageEvents only
+	Daemon       int       `json:"daemon"`        // daemon events emitted, with WithDaemonEvents only
+	Filtered     int       `json:"filtered"`      // live container events dropped by filters
+	Stale        int       `json:"stale"`         // docker events dropped as older than WithMaxEventAge
+	Coalesced    int       `json:"coalesced"`     // live container events dropped by WithCoalesce
+	Stalls       int       `json:"stalls"`        // events waited for consumer as the channel was full
+	Stalled      bool      `json:"stalled"`       // consumer not reading the channel, with WithStallDetector only
+	Overflows    int       `json:"overflows"`     // listener buffer overflows, caught up by resync
+	ChannelDepth int       `json:"channel_depth"` // events waiting in the channel for consumer
+	LastEvent    time.Time `json:"last_event"`    // time the last event emitted, zero if none
+	Connected    bool      `json:"connected"`     // docker events listener is subscribed
+
+	// Subscribers are active subscriptions with their lag, made by Subscribe
+	Subscribers []SubscriberStats `json:"subscribers,omitempty"`
+
+	// Filters is effective filter configuration, including name filters changed by UpdateFilters
+	Filters FilterConfig `json:"filters"`
+}
+
+// counters collects EventNotif activity for Stats, guarded by trackLock
+type counters struct {
+	up, down, image int
+	daemon          int
+	filtered        int
+	stale           int
+	coalesced       int
+	stalls          int
+	stalled         bool
+	overflows       int
+	lastEvent       time.Time
+	connected       bool
+}
+
+// Stats returns current activity snapshot
+func (e *EventNotif) Stats() Stats {
+	subscribers, filters := e.Subscribers(), e.Filters()
+	e.trackLock.Lock()
+	defer e.trackLock.Unlock()
+	return Stats{
+		Tracked:      e.tracked.len(),
+		Paused:       len(e.paused),
+		Up:           e.stats.up,
+		Down:         e.stats.down,
+		Image:        e.stats.image,
+		Daemon:       e.stats.daemon,
+		Filtered:     e.stats.filtered,
+		Stale:        e.stats.stale,
+		Coalesced:    e.stats.coalesced,
+		Stalls:       e.stats.stalls,
+		Stalled:      e.stats.stalled,
+		Overflows:    e.stats.overflows,
+		ChannelDepth: len(e.eventsCh),
+		LastEvent:    e.stats.lastEvent,
+		Connected:    e.stats.connected,
+		Subscribers:  subscribers,
+		Filters:      filters,
+	}
+}
+
+// countEmitted accounts emitted event. Should be called with trackLock held.
+func (e *EventNotif) countEmitted(event Event) {
+	switch {
+	case event.Type == EventImage:
+		e.stats.image++
+	case event.Type == EventDaemon:
+		e.stats.daemon++
+	case event.Status:
+		e.stats.up++
+	default:
+		e.stats.down++
+	}
+	e.stats.lastEvent = time.Now()
+}
+
+// countFiltered accounts event dropped by filters
+func (e *EventNotif) countFiltered() {
+	e.trackLock.Lock()
+	e.stats.filtered++
+	e.trackLock.Unlock()
+}
+
+// setConnected sets listener state
+func (e *EventNotif) setConnected(connected bool) {
+	e.trackLock.Lock()
+	e.stats.connected = connected
+	e.trackLock.Unlock()
+}
@@ -0,0 +1,57 @@
+package discovery
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	client := &mockDockerClient{}
+	client.add("id1", "name1")
+	client.add("id2", "name2")
+	events, err := NewEventNotif(client, []string{"excluded"}, nil, "", "")
+	require.NoError(t, err)
+
+	st := events.Stats()
+	assert.Equal(t, 2, st.Tracked)
+	assert.Equal(t, 2, st.Up)
+	assert.Equal(t, 2, st.ChannelDepth, "nothing consumed yet")
+	assert.False(t, st.LastEvent.IsZero())
+
+	<-events.Channel()
+	<-events.Channel()
+	assert.Eventually(t, func() bool { return events.Stats().Connected }, time.Second, 5*time.Millisecond)
+
+	go func() {
+		client.add("id3", "excluded")
+		client.remove("id1")
+	}()
+	ev := <-events.Channel()
+	assert.Equal(t, "id1", ev.ContainerID)
+
+	st = events.Stats()
+	assert.Equal(t, 1, st.Tracked)
+	assert.Equal(t, 2, st.Up)
+	assert.Equal(t, 1, st.Down)
+	assert.Equal(t, 0, st.Image)
+	assert.Equal(t, 1, st.Filtered)
+	assert.Equal(t, 0, st.ChannelDepth)
+	assert.True(t, st.Connected)
+
+	client.disconnect()
+	assert.Eventually(t, func() bool { return !events.Stats().Connected }, time.Second, 5*time.Millisecond)
+}
+
+func TestStatsJSON(t *testing.T) {
+	st := Stats{Tracked: 1, Up: 2, Down: 1, Filtered: 3, ChannelDepth: 4, Connected: true,
+		LastEvent: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	data, err := json.Marshal(st)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"tracked":1,"paused":0,"up":2,"down":1,"image":0,"daemon":0,"filtered":3,"stale":0,"coalesced":0,"stalls":0,
+		"stalled":false,"overflows":0,"channel_depth":4,"last_event":"2024-01-02T03:04:05Z","connected":true,
+		"filters":{}}`, string(data))
+}
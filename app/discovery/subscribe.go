@@ -0,0 +1,107 @@
+package discovery
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Subscription receives a copy of every event emitted by EventNotif, in addition to Channel.
+// Each subscription has its own buffer, events not fitting it dropped and counted, so a slow
+// subscriber never blocks EventNotif or other subscribers.
+type Subscription struct {
+	ID   int    // unique within EventNotif
+	Name string // set by subscriber, for stats only
+
+	ch            chan Event
+	notif         *EventNotif
+	delivered     int // guarded by notif.subs.lock, as all fields below
+	dropped       int
+	lastDelivered time.Time
+}
+
+// SubscriberStats is a snapshot of subscription's lag
+type SubscriberStats struct {
+	ID            int       `json:"id"`
+	Name          string    `json:"name"`
+	QueueDepth    int       `json:"queue_depth"`    // events waiting for subscriber
+	Delivered     int       `json:"delivered"`      // events queued to subscriber
+	Dropped       int       `json:"dropped"`        // events dropped as subscriber's buffer full
+	LastDelivered time.Time `json:"last_delivered"` // time the last event queued, zero if none
+}
+
+// Subscribe adds subscription with buffer of events, eventsBuffer if buffer <= 0.
+// Subscriber should read Events until closed and call Close when not interested anymore.
+func (e *EventNotif) Subscribe(name string, buffer int) *Subscription {
+	if buffer <= 0 {
+		buffer = eventsBuffer
+	}
+	e.subs.lock.Lock()
+	defer e.subs.lock.Unlock()
+	e.subs.seq++
+	res := &Subscription{ID: e.subs.seq, Name: name, ch: make(chan Event, buffer), notif: e}
+	if e.subs.byID == nil {
+		e.subs.byID = map[int]*Subscription{}
+	}
+	e.subs.byID[res.ID] = res
+	return res
+}
+
+// Events returns channel of subscription's events, closed on unsubscribe
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Close unsubscribes and closes events channel, safe to call multiple times
+func (s *Subscription) Close() {
+	s.notif.CloseSubscriber(s.ID)
+}
+
+// Subscribers returns stats of active subscriptions, ordered by id
+func (e *EventNotif) Subscribers() []SubscriberStats {
+	e.subs.lock.Lock()
+	defer e.subs.lock.Unlock()
+	res := make([]SubscriberStats, 0, len(e.subs.byID))
+	for _, s := range e.subs.byID {
+		res = append(res, SubscriberStats{ID: s.ID, Name: s.Name, QueueDepth: len(s.ch), Delivered: s.delivered,
+			Dropped: s.dropped, LastDelivered: s.lastDelivered})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res
+}
+
+// CloseSubscriber forcibly unsubscribes, i.e. a stuck one, and closes its channel. Events queued already
+// can still be read by subscriber. Returns false if no such active subscription.
+func (e *EventNotif) CloseSubscriber(id int) bool {
+	e.subs.lock.Lock()
+	defer e.subs.lock.Unlock()
+	s, ok := e.subs.byID[id]
+	if !ok {
+		return false
+	}
+	delete(e.subs.byID, id)
+	close(s.ch)
+	return true
+}
+
+// publish queues event to all subscriptions, never blocks
+func (e *EventNotif) publish(event Event) {
+	e.subs.lock.Lock()
+	defer e.subs.lock.Unlock()
+	for _, s := range e.subs.byID {
+		select {
+		case s.ch <- event:
+			s.delivered++
+			s.lastDelivered = time.Now()
+		default:
+			s.dropped++
+		}
+	}
+}
+
+// subscriptions are active subscriptions of EventNotif
+type subscriptions struct {
+	lock sync.Mutex
+	byID map[int]*Subscription
+	seq  int // last subscription id
+}
@@ -0,0 +1,91 @@
+package discovery
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscribe(t *testing.T) {
+	client := &mockDockerClient{}
+	events, err := NewEventNotif(client, nil, nil, "", "")
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool { return events.Stats().Connected }, time.Second, 5*time.Millisecond)
+
+	fast := events.Subscribe("fast", 10)
+	slow := events.Subscribe("slow", 1)
+	assert.Equal(t, 1, fast.ID)
+	assert.Equal(t, 2, slow.ID)
+
+	client.add("id1", "name1")
+	client.add("id2", "name2")
+	for _, id := range []string{"id1", "id2"} {
+		assert.Equal(t, id, (<-events.Channel()).ContainerID)
+		assert.Equal(t, id, (<-fast.Events()).ContainerID)
+	}
+
+	st := events.Subscribers()
+	require.Len(t, st, 2)
+	assert.Equal(t, "fast", st[0].Name)
+	assert.Equal(t, 0, st[0].QueueDepth)
+	assert.Equal(t, 2, st[0].Delivered)
+	assert.Equal(t, 0, st[0].Dropped)
+	assert.False(t, st[0].LastDelivered.IsZero())
+	assert.Equal(t, "slow", st[1].Name)
+	assert.Equal(t, 1, st[1].QueueDepth, "slow subscriber lags")
+	assert.Equal(t, 1, st[1].Delivered)
+	assert.Equal(t, 1, st[1].Dropped, "not fitting buffer dropped")
+	assert.Equal(t, st, events.Stats().Subscribers)
+
+	assert.True(t, events.CloseSubscriber(slow.ID), "stuck subscriber closed")
+	assert.False(t, events.CloseSubscriber(slow.ID), "closed already")
+	ev, ok := <-slow.Events()
+	assert.True(t, ok, "queued event still readable")
+	assert.Equal(t, "id1", ev.ContainerID)
+	_, ok = <-slow.Events()
+	assert.False(t, ok, "channel closed")
+	slow.Close() // no-op for closed
+
+	fast.Close()
+	assert.Empty(t, events.Subscribers())
+	assert.Empty(t, events.Stats().Subscribers)
+
+	client.add("id3", "name3")
+	assert.Equal(t, "id3", (<-events.Channel()).ContainerID, "main channel not affected")
+}
+
+func TestSubscribeConcurrent(t *testing.T) {
+	events, err := newEventNotif(&mockDockerClient{}, nil, nil, "", "")
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				sub := events.Subscribe("s", 2)
+				_ = events.Subscribers()
+				sub.Close()
+			}
+		}()
+	}
+	for i := 0; i < eventsBuffer; i++ { // fits events channel, no consumer needed
+		events.emit(Event{ContainerID: "id1", Status: i%2 == 0})
+	}
+	wg.Wait()
+	assert.Empty(t, events.Subscribers())
+}
+
+func TestSubscriberStatsJSON(t *testing.T) {
+	st := SubscriberStats{ID: 1, Name: "s1", QueueDepth: 2, Delivered: 3, Dropped: 4,
+		LastDelivered: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	data, err := json.Marshal(st)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":1,"name":"s1","queue_depth":2,"delivered":3,"dropped":4,"last_delivered":"2024-01-02T03:04:05Z"}`,
+		string(data))
+}
@@ -0,0 +1,99 @@
+package discovery
+
+import (
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventsSwarmNodeID(t *testing.T) {
+	client := &mockDockerClient{containers: []dockerclient.APIContainers{
+		{ID: "id1", Names: []string{"/web.1.abcdef"}, Image: "reg.example.com/grp/web",
+			Labels: map[string]string{"com.docker.swarm.service.name": "web", swarmNodeLabel: "node1"}},
+		{ID: "id2", Names: []string{"/plain"}, Image: "nginx"},
+	}}
+	events, err := NewEventNotif(client, nil, nil, "", "", WithImageEvents())
+	require.NoError(t, err)
+
+	ev := <-events.Channel()
+	assert.Equal(t, "web-1", ev.ContainerName)
+	assert.Equal(t, "node1", ev.NodeID, "scanned swarm task")
+	ev = <-events.Channel()
+	assert.Equal(t, "plain", ev.ContainerName)
+	assert.Empty(t, ev.NodeID, "not a swarm container")
+
+	require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, time.Millisecond)
+	go func() {
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "start", From: "reg.example.com/grp/api",
+			Actor: dockerclient.APIActor{ID: "id3", Attributes: map[string]string{"name": "api.2.xyz", swarmNodeLabel: "node2"}}})
+		client.send(&dockerclient.APIEvents{Type: "image", Action: "pull", Actor: dockerclient.APIActor{ID: "reg.example.com/grp/web",
+			Attributes: map[string]string{"name": "reg.example.com/grp/web"}}})
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "die", From: "reg.example.com/grp/api",
+			Actor: dockerclient.APIActor{ID: "id3", Attributes: map[string]string{"name": "api.2.xyz", swarmNodeLabel: "node2",
+				"exitCode": "0"}}})
+	}()
+
+	ev = <-events.Channel()
+	assert.Equal(t, "api-2", ev.ContainerName)
+	assert.Equal(t, "node2", ev.NodeID, "live swarm task")
+	ev = <-events.Channel()
+	assert.Equal(t, EventImage, ev.Type)
+	assert.Equal(t, "node1", ev.NodeID, "image event of tracked task")
+	ev = <-events.Channel()
+	assert.False(t, ev.Status)
+	assert.Equal(t, "node2", ev.NodeID, "down event")
+	assert.Equal(t, []string{"", "node1"}, nodeIDs(events.ListCurrent()), "tracked plain and web-1")
+}
+
+func TestEventsSwarmNodeIDInspect(t *testing.T) {
+	client := &mockInspectClient{inspected: map[string]*dockerclient.Container{
+		"id1": {Name: "/web.1.abcdef", Config: &dockerclient.Config{Image: "reg.example.com/grp/web",
+			Labels: map[string]string{swarmNodeLabel: "node1"}}},
+	}}
+	events, err := NewEventNotif(client, nil, nil, "", "", WithInspectFallback())
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, time.Millisecond)
+	go client.send(&dockerclient.APIEvents{Type: "container", Status: "start", Actor: dockerclient.APIActor{ID: "id1"}})
+
+	ev := <-events.Channel()
+	assert.Equal(t, "web-1", ev.ContainerName)
+	assert.Equal(t, "node1", ev.NodeID, "from inspected labels")
+}
+
+func nodeIDs(events []Event) (res []string) {
+	for _, ev := range events {
+		res = append(res, ev.NodeID)
+	}
+	return res
+}
+
+func TestEventsRawName(t *testing.T) {
+	client := &mockDockerClient{containers: []dockerclient.APIContainers{
+		{ID: "id1", Names: []string{"/web.1.abcdef"}},
+		{ID: "id2", Names: []string{"/proj-api-1"}, Labels: map[string]string{"logger.container.name": "api"}},
+		{ID: "id3", Names: []string{"/plain"}},
+	}}
+	events, err := NewEventNotif(client, nil, nil, "", "", WithDaemonEvents("network"))
+	require.NoError(t, err)
+	for _, want := range [][2]string{{"web-1", "web.1.abcdef"}, {"api", "proj-api-1"}, {"plain", "plain"}} {
+		ev := <-events.Channel()
+		assert.Equal(t, want, [2]string{ev.ContainerName, ev.RawName}, "scanned")
+	}
+
+	require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, time.Millisecond)
+	go func() {
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "start", Actor: dockerclient.APIActor{ID: "id4",
+			Attributes: map[string]string{"name": "db.3.xyz"}}})
+		client.send(&dockerclient.APIEvents{Type: "container", Status: "start", Actor: dockerclient.APIActor{ID: "id5",
+			Attributes: map[string]string{"name": "cache", "logger.container.name": "redis"}}})
+		client.send(&dockerclient.APIEvents{Type: "network", Action: "connect", Actor: dockerclient.APIActor{ID: "net1",
+			Attributes: map[string]string{"container": "id4"}}})
+	}()
+	for _, want := range [][2]string{{"db-3", "db.3.xyz"}, {"redis", "cache"}, {"db-3", "db.3.xyz"}} {
+		ev := <-events.Channel()
+		assert.Equal(t, want, [2]string{ev.ContainerName, ev.RawName}, "live")
+	}
+}
@@ -0,0 +1,24 @@
+package discovery
+
+// WithTTYFilter limits containers by TTY, include keeps only containers with TTY, i.e. interactive ones,
+// exclude drops them keeping only non-TTY service containers. Both kept by default.
+//
+// Neither docker events nor containers list carry TTY flag, so it's resolved by container inspect and cached
+// until container destroyed. Docker client should implement ContainerInspector, otherwise filter ignored.
+// Containers failed to inspect allowed, so none lost due to transient inspect failures.
+func WithTTYFilter(include, exclude bool) Option {
+	return func(e *EventNotif) {
+		e.includeTTY, e.excludeTTY = include, exclude
+		if include || exclude {
+			e.enableConfigs()
+		}
+	}
+}
+
+// isTTYAllowed checks TTY flag of container config against TTY filter, always true if filter disabled
+func (e *EventNotif) isTTYAllowed(cfg containerConfig) bool {
+	if e.includeTTY && !cfg.tty {
+		return false
+	}
+	return !(e.excludeTTY && cfg.tty)
+}
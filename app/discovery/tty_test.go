@@ -0,0 +1,90 @@
+package discovery
+
+import (
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventsTTYFilter(t *testing.T) {
+	newClient := func() *mockInspectClient {
+		return &mockInspectClient{
+			mockDockerClient: mockDockerClient{containers: []dockerclient.APIContainers{
+				{ID: "id1", Names: []string{"/shell"}}, {ID: "id2", Names: []string{"/web"}},
+			}},
+			inspected: map[string]*dockerclient.Container{
+				"id1": {Config: &dockerclient.Config{Tty: true}},
+				"id2": {Config: &dockerclient.Config{}},
+				"id3": {Config: &dockerclient.Config{Tty: true}},
+				"id4": {Config: &dockerclient.Config{}},
+			},
+		}
+	}
+
+	tbl := []struct {
+		name             string
+		include, exclude bool
+		want             []string
+	}{
+		{name: "both by default", want: []string{"shell", "web", "shell2", "web2", "unknown"}},
+		{name: "include tty", include: true, want: []string{"shell", "shell2", "unknown"}},
+		{name: "exclude tty", exclude: true, want: []string{"web", "web2", "unknown"}},
+	}
+
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newClient()
+			events, err := NewEventNotif(client, nil, nil, "", "", WithTTYFilter(tt.include, tt.exclude))
+			require.NoError(t, err)
+			require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, 5*time.Millisecond)
+			go func() {
+				client.add("id3", "shell2")
+				client.add("id4", "web2")
+				client.add("id5", "unknown") // inspect fails, allowed
+			}()
+
+			var names []string
+			for range tt.want {
+				select {
+				case ev := <-events.Channel():
+					names = append(names, ev.ContainerName)
+				case <-time.After(time.Second):
+					t.Fatalf("got %v only", names)
+				}
+			}
+			assert.Equal(t, tt.want, names)
+
+			calls := client.inspectCalls()
+			if !tt.include && !tt.exclude {
+				assert.Empty(t, calls, "no inspect if disabled")
+				return
+			}
+			assert.Equal(t, 1, calls["id1"], "inspected once")
+			go client.send(&dockerclient.APIEvents{Type: "container", Status: "die",
+				Actor: dockerclient.APIActor{ID: "id1", Attributes: map[string]string{"name": "shell"}}})
+			go client.send(&dockerclient.APIEvents{Type: "container", Status: "die",
+				Actor: dockerclient.APIActor{ID: "id2", Attributes: map[string]string{"name": "web"}}})
+			select {
+			case ev := <-events.Channel():
+				assert.False(t, ev.Status)
+				assert.Equal(t, tt.want[0], ev.ContainerName, "stop filtered the same way")
+			case <-time.After(time.Second):
+				t.Fatal("no stop event")
+			}
+			assert.Equal(t, 1, client.inspectCalls()["id1"], "cached")
+		})
+	}
+}
+
+func TestEventsConfigForgetFiltered(t *testing.T) {
+	events := &EventNotif{eventsCh: make(chan Event, 1), selfID: "id1", excludeTTY: true}
+	events.enableConfigs()
+	events.configs.items["id1"] = containerConfig{tty: true}
+	events.processEvent(&dockerclient.APIEvents{Type: "container", Status: "destroy", Time: time.Now().Unix(),
+		Actor: dockerclient.APIActor{ID: "id1", Attributes: map[string]string{"name": "self", "image": "img"}}})
+	assert.Empty(t, events.eventsCh)
+	assert.Empty(t, events.configs.items, "destroyed container forgotten, even if filtered out before config check")
+}
@@ -0,0 +1,77 @@
+package discovery
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// WithStrictFilters makes NewEventNotif fail on contradicting filters instead of logging a warning
+func WithStrictFilters() Option {
+	return func(e *EventNotif) {
+		e.strictFilters = true
+	}
+}
+
+// filterConflicts returns descriptions of contradicting or ignored filters.
+// With PrecedenceFirst isAllowed applies the first defined of includesPattern, excludesPattern, includes and excludes,
+// so any other defined filter is ignored silently. Explicit precedence applies all filters and resolves conflicts.
+func (e *EventNotif) filterConflicts() []string {
+	if e.precedence != PrecedenceFirst {
+		return nil
+	}
+	var res []string
+	for _, name := range e.includes {
+		if contains(name, e.excludes) {
+			res = append(res, fmt.Sprintf("container %q both included and excluded", name))
+		}
+		if e.excludesRegexp != nil && e.excludesRegexp.MatchString(name) {
+			res = append(res, fmt.Sprintf("included container %q matches exclude pattern %q", name, e.excludesRegexp))
+		}
+	}
+	for _, name := range e.excludes {
+		if e.includesRegexp != nil && e.includesRegexp.MatchString(name) {
+			res = append(res, fmt.Sprintf("excluded container %q matches include pattern %q", name, e.includesRegexp))
+		}
+	}
+
+	active := ""
+	switch {
+	case e.includesRegexp != nil:
+		active = "include pattern"
+	case e.excludesRegexp != nil:
+		active = "exclude pattern"
+	case len(e.includes) > 0:
+		active = "includes"
+	}
+	ignored := []string{}
+	if e.excludesRegexp != nil && e.includesRegexp != nil {
+		ignored = append(ignored, "exclude pattern")
+	}
+	if len(e.includes) > 0 && (e.includesRegexp != nil || e.excludesRegexp != nil) {
+		ignored = append(ignored, "includes")
+	}
+	if len(e.excludes) > 0 && active != "" {
+		ignored = append(ignored, "excludes")
+	}
+	if len(ignored) > 0 {
+		res = append(res, fmt.Sprintf("%s ignored, as %s defined", strings.Join(ignored, ", "), active))
+	}
+	return res
+}
+
+// validateFilters logs filter conflicts, or returns error for strict mode
+func (e *EventNotif) validateFilters() error {
+	conflicts := e.filterConflicts()
+	if len(conflicts) == 0 {
+		return nil
+	}
+	if e.strictFilters {
+		return errors.Errorf("conflicting filters: %s", strings.Join(conflicts, "; "))
+	}
+	for _, c := range conflicts {
+		e.log().Logf("[WARN] conflicting filters, %s", c)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package discovery
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterConflicts(t *testing.T) {
+	tbl := []struct {
+		excludes, includes               []string
+		includesPattern, excludesPattern string
+		res                              []string
+	}{
+		{nil, nil, "", "", nil},
+		{[]string{"c1"}, nil, "", "", nil},
+		{nil, []string{"c1"}, "", "", nil},
+		{[]string{"c1", "c2"}, []string{"c2", "c3"}, "", "",
+			[]string{`container "c2" both included and excluded`, "excludes ignored, as includes defined"}},
+		{nil, []string{"web", "api"}, "", "^web",
+			[]string{`included container "web" matches exclude pattern "^web"`, "includes ignored, as exclude pattern defined"}},
+		{[]string{"web"}, nil, "we", "",
+			[]string{`excluded container "web" matches include pattern "we"`, "excludes ignored, as include pattern defined"}},
+		{nil, nil, "web", "api", []string{"exclude pattern ignored, as include pattern defined"}},
+	}
+
+	for i, tt := range tbl {
+		e, err := NewEventNotif(&mockDockerClient{}, tt.excludes, tt.includes, tt.includesPattern, tt.excludesPattern)
+		require.NoError(t, err, "case #%d", i)
+		assert.Equal(t, tt.res, e.filterConflicts(), "case #%d", i)
+	}
+}
+
+func TestNewEventNotifStrictFilters(t *testing.T) {
+	_, err := NewEventNotif(&mockDockerClient{}, []string{"c1"}, []string{"c1"}, "", "", WithStrictFilters())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `container "c1" both included and excluded`)
+
+	_, err = NewEventNotif(&mockDockerClient{}, []string{"c1"}, nil, "", "", WithStrictFilters())
+	require.NoError(t, err)
+}
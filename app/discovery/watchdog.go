@@ -0,0 +1,125 @@
+package discovery
+
+import (
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// listenerRemover is implemented by docker clients able to remove events listener, i.e. *docker.Client
+type listenerRemover interface {
+	RemoveEventListener(listener chan *docker.APIEvents) error
+}
+
+// WithWatchdog sets interval for events listener watchdog. If no docker events received within the interval
+// listener re-subscribed and containers resynced to catch changes missed by quiet listener. Zero disables watchdog.
+func WithWatchdog(interval time.Duration) Option {
+	return func(e *EventNotif) {
+		e.watchdog = interval
+	}
+}
+
+// watchdogTimer fires once watchdog interval passed since the last docker event, a single timer of listener
+type watchdogTimer struct {
+	timer    *time.Timer
+	interval time.Duration
+}
+
+// newWatchdogTimer makes started watchdogTimer, disabled one without watchdog
+func (e *EventNotif) newWatchdogTimer() *watchdogTimer {
+	if e.watchdog <= 0 {
+		return &watchdogTimer{}
+	}
+	return &watchdogTimer{timer: time.NewTimer(e.watchdog), interval: e.watchdog}
+}
+
+// C returns channel of the timer, nil if disabled
+func (t *watchdogTimer) C() <-chan time.Time {
+	if t.timer == nil {
+		return nil
+	}
+	return t.timer.C
+}
+
+// reset restarts the interval, on docker event received
+func (t *watchdogTimer) reset() {
+	if t.timer == nil {
+		return
+	}
+	if !t.timer.Stop() {
+		select {
+		case <-t.timer.C:
+		default:
+		}
+	}
+	t.timer.Reset(t.interval)
+}
+
+// stop stops the timer
+func (t *watchdogTimer) stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+}
+
+// unsubscribe removes listener if client supports it. Listener channel drained while removing,
+// as docker client may block sending to it.
+func (e *EventNotif) unsubscribe(client DockerClient, listener chan *docker.APIEvents) {
+	remover, ok := client.(listenerRemover)
+	if !ok {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-listener:
+			case <-done:
+				return
+			}
+		}
+	}()
+	if err := remover.RemoveEventListener(listener); err != nil {
+		e.log().Logf("[WARN] can't remove event listener, %v", err)
+	}
+	close(done)
+}
+
+// Resync requests re-scan of running containers, reconciled with tracked ones. Start events emitted for containers
+// not tracked yet, i.e. started while events missed or allowed by updated filters, and stop events for tracked ones
+// gone or not allowed anymore. Already tracked containers not emitted again. Resync done by listener between docker
+// events, once connected if reconnecting, and requests made meanwhile coalesced. Never blocks.
+func (e *EventNotif) Resync() {
+	select {
+	case e.resyncCh <- struct{}{}:
+	default: // already requested
+	}
+}
+
+// resync compares running containers with tracked and emits start events for new and stop events for gone ones
+func (e *EventNotif) resync() error {
+	running, err := e.runningContainers()
+	if err != nil {
+		return err
+	}
+
+	e.pruneWaiting(running)
+	added, removed := e.tracked.diff(running)
+	added = e.dropWaiting(added)
+	for i, ev := range removed {
+		removed[i].Status, removed[i].TS, removed[i].Raw, removed[i].Network = false, time.Now(), nil, nil
+		removed[i].FromScan = false // tracked up event may come from the initial scan
+		e.forgetNetwork(ev.ContainerID)
+	}
+
+	for _, ev := range removed {
+		e.log().Logf("[INFO] resync, container %s gone", ev.ContainerName)
+		e.emit(ev)
+	}
+	for _, ev := range added {
+		e.log().Logf("[INFO] resync, container %s added", ev.ContainerName)
+		e.emit(ev)
+	}
+	e.log().Logf("[DEBUG] resync completed, added %d, removed %d", len(added), len(removed))
+	return nil
+}
@@ -0,0 +1,124 @@
+package discovery
+
+import (
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchdogResync(t *testing.T) {
+	client := &mockDockerClient{}
+	client.add("id1", "name1")
+	events, err := NewEventNotif(client, nil, nil, "", "", WithWatchdog(50*time.Millisecond))
+	require.NoError(t, err)
+	ev := <-events.Channel()
+	assert.Equal(t, "name1", ev.ContainerName)
+
+	// change containers silently, no events delivered
+	client.Lock()
+	client.containers = []dockerclient.APIContainers{{ID: "id2", Names: []string{"/name2"}}}
+	client.Unlock()
+
+	ev = <-events.Channel()
+	assert.Equal(t, "id1", ev.ContainerID)
+	assert.False(t, ev.Status, "gone container stopped")
+	ev = <-events.Channel()
+	assert.Equal(t, "name2", ev.ContainerName)
+	assert.True(t, ev.Status, "new container started")
+	assert.True(t, client.subscriptions() >= 2, "re-subscribed")
+
+	select {
+	case ev = <-events.Channel():
+		t.Fatalf("unexpected event %+v", ev)
+	case <-time.After(120 * time.Millisecond): // a few more watchdog cycles, nothing changed
+	}
+}
+
+func TestResync(t *testing.T) {
+	client := &mockDockerClient{}
+	client.add("id1", "name1")
+	client.add("id2", "name2")
+	events, err := NewEventNotif(client, nil, nil, "", "")
+	require.NoError(t, err)
+	require.Equal(t, "id1", (<-events.Channel()).ContainerID)
+	require.Equal(t, "id2", (<-events.Channel()).ContainerID)
+	require.Eventually(t, func() bool { return client.subscriptions() == 1 }, time.Second, 5*time.Millisecond)
+
+	client.Lock()
+	client.containers = []dockerclient.APIContainers{{ID: "id1", Names: []string{"/name1"}}, {ID: "id3", Names: []string{"/name3"}}}
+	client.Unlock()
+	events.Resync()
+	events.Resync() // coalesced with pending one
+
+	ev := <-events.Channel()
+	assert.Equal(t, "id2", ev.ContainerID)
+	assert.False(t, ev.Status, "gone container stopped")
+	ev = <-events.Channel()
+	assert.Equal(t, "id3", ev.ContainerID)
+	assert.True(t, ev.Status, "new container started")
+
+	require.NoError(t, events.UpdateFilters([]string{"name1"}, nil, "", ""))
+	events.Resync()
+	ev = <-events.Channel()
+	assert.Equal(t, "id1", ev.ContainerID)
+	assert.False(t, ev.Status, "stopped as excluded by updated filters")
+
+	events.Resync()
+	select {
+	case ev = <-events.Channel():
+		t.Fatalf("tracked container emitted again, %+v", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.Equal(t, 1, events.Stats().Tracked)
+}
+
+func TestWatchdogKeepalive(t *testing.T) {
+	client := &mockDockerClient{}
+	client.add("id1", "name1")
+	events, err := NewEventNotif(client, nil, nil, "", "", WithWatchdog(100*time.Millisecond),
+		WithKeepalive(10*time.Millisecond))
+	require.NoError(t, err)
+	require.Equal(t, "id1", (<-events.Channel()).ContainerID)
+	go func() {
+		for range events.Channel() { // keepalives
+		}
+	}()
+	require.Eventually(t, func() bool { return client.subscriptions() >= 2 }, time.Second, 5*time.Millisecond,
+		"re-subscribed on silent events, keepalives don't postpone watchdog")
+}
+
+func TestWatchdogDisabled(t *testing.T) {
+	client := &mockDockerClient{}
+	_, err := NewEventNotif(client, nil, nil, "", "")
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 1, client.subscriptions())
+}
+
+type mockRemoverClient struct {
+	mockDockerClient
+	removed int
+}
+
+func (m *mockRemoverClient) RemoveEventListener(chan *dockerclient.APIEvents) error {
+	m.Lock()
+	defer m.Unlock()
+	m.removed++
+	m.events = nil
+	return nil
+}
+
+func TestWatchdogUnsubscribe(t *testing.T) {
+	client := &mockRemoverClient{}
+	_, err := NewEventNotif(client, nil, nil, "", "", WithWatchdog(20*time.Millisecond))
+	require.NoError(t, err)
+	time.Sleep(70 * time.Millisecond)
+	client.Lock()
+	removed := client.removed
+	client.Unlock()
+	assert.True(t, removed >= 2, "removed %d", removed)
+	assert.True(t, client.subscriptions() > removed)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/docker-logger/app/discovery"
+)
+
+// filterSpec defines container name filters, from cli options or filter file
+type filterSpec struct {
+	Excludes        []string
+	Includes        []string
+	IncludesPattern string
+	ExcludesPattern string
+}
+
+// filterReloadDelay debounces rapid edits of filter file, reload happens once file stays unchanged for this delay
+const filterReloadDelay = 500 * time.Millisecond
+
+// validate checks filters for mutually exclusive options and bad patterns. With exclude-wins or include-wins
+// precedence include and exclude filters combine, so only Includes and IncludesPattern exclusive.
+func (f filterSpec) validate(precedence string) error {
+	if f.Includes != nil && f.IncludesPattern != "" {
+		return errors.New("only single option Includes/IncludesPattern are allowed")
+	}
+
+	if f.IncludesPattern != "" {
+		_, err := regexp.Compile(f.IncludesPattern)
+		if err != nil {
+			return errors.New("could not parse Includes Pattern")
+		}
+	}
+
+	combined := precedence == "exclude-wins" || precedence == "include-wins"
+	if !combined && f.Includes != nil && f.Excludes != nil {
+		return errors.New("only single option Excludes/Includes are allowed")
+	}
+
+	if !combined && f.Excludes != nil && f.ExcludesPattern != "" {
+		return errors.New("only single option Excludes/ExcludesPattern are allowed")
+	}
+
+	if f.ExcludesPattern != "" {
+		_, err := regexp.Compile(f.ExcludesPattern)
+		if err != nil {
+			return errors.New("could not parse Excludes Pattern")
+		}
+	}
+	return nil
+}
+
+// loadFilterFile reads filters from env-style file with INCLUDE, EXCLUDE, INCLUDE_PATTERN and EXCLUDE_PATTERN keys,
+// the same as environment variables. Lists are comma separated, empty lines and lines started with # ignored.
+// Filters validated with precedence of filters.
+func loadFilterFile(path, precedence string) (filterSpec, error) {
+	fh, err := os.Open(path) //nolint:gosec // path set by user
+	if err != nil {
+		return filterSpec{}, errors.Wrap(err, "can't open filter file")
+	}
+	defer func() { _ = fh.Close() }()
+
+	res := filterSpec{}
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, val, ok := strings.Cut(line, "=")
+		if !ok {
+			return filterSpec{}, errors.Errorf("invalid filter file line %q, expected KEY=value", line)
+		}
+		key, val = strings.TrimSpace(key), strings.TrimSpace(val)
+		switch key {
+		case "INCLUDE":
+			res.Includes = splitList(val)
+		case "EXCLUDE":
+			res.Excludes = splitList(val)
+		case "INCLUDE_PATTERN":
+			res.IncludesPattern = val
+		case "EXCLUDE_PATTERN":
+			res.ExcludesPattern = val
+		default:
+			return filterSpec{}, errors.Errorf("unknown filter file key %s", key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return filterSpec{}, errors.Wrap(err, "can't read filter file")
+	}
+	return res, res.validate(precedence)
+}
+
+// updateFilters makes func applying filters to all notifiers. Notifiers share options, so filters rejected
+// by the first one rejected by all, leaving filters unchanged.
+func updateFilters(notifs []*discovery.EventNotif) func(filterSpec) error {
+	return func(f filterSpec) error {
+		for _, n := range notifs {
+			if err := n.UpdateFilters(f.Excludes, f.Includes, f.IncludesPattern, f.ExcludesPattern); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// splitList splits comma separated list, nil for empty value
+func splitList(val string) []string {
+	var res []string
+	for _, v := range strings.Split(val, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// watchFilterFile reloads filter file on change and applies it until ctx canceled.
+// The directory watched, not the file, to catch editors and config maps replacing the file by rename.
+// Invalid file logged and ignored, current filters kept. Returns func reloading the file right away,
+// returning once reloaded, i.e. on SIGHUP.
+func watchFilterFile(ctx context.Context, path, precedence string, current filterSpec,
+	apply func(filterSpec) error) (func(), error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, errors.Wrap(err, "can't make filter file watcher")
+	}
+	if err = watcher.Add(filepath.Dir(path)); err != nil {
+		_ = watcher.Close()
+		return nil, errors.Wrapf(err, "can't watch filter file %s", path)
+	}
+
+	requests := make(chan chan struct{})
+	go func() {
+		defer func() { _ = watcher.Close() }()
+		reload := time.NewTimer(filterReloadDelay)
+		reload.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev := <-watcher.Events:
+				if filepath.Clean(ev.Name) == filepath.Clean(path) {
+					reload.Reset(filterReloadDelay) // debounce, reload once edits stopped
+				}
+			case err := <-watcher.Errors:
+				log.Printf("[WARN] filter file watcher error, %v", err)
+			case <-reload.C:
+				current = reloadFilters(path, precedence, current, apply)
+			case done := <-requests:
+				current = reloadFilters(path, precedence, current, apply)
+				close(done)
+			}
+		}
+	}()
+
+	reloadNow := func() {
+		done := make(chan struct{})
+		select {
+		case requests <- done:
+			<-done
+		case <-ctx.Done():
+		}
+	}
+	return reloadNow, nil
+}
+
+// reloadFilters loads filter file and applies it if changed, returns filters in effect
+func reloadFilters(path, precedence string, current filterSpec, apply func(filterSpec) error) filterSpec {
+	spec, err := loadFilterFile(path, precedence)
+	if err != nil {
+		log.Printf("[WARN] filter file %s ignored, keep current filters, %v", path, err)
+		return current
+	}
+	if reflect.DeepEqual(spec, current) {
+		return current
+	}
+	if err := apply(spec); err != nil {
+		log.Printf("[WARN] filter file %s rejected, keep current filters, %v", path, err)
+		return current
+	}
+	log.Printf("[INFO] filters reloaded from %s, %s", path, filtersDiff(current, spec))
+	return spec
+}
+
+// filtersDiff describes changed filters, i.e. "excludes: [c1] -> [c1 c2]"
+func filtersDiff(old, upd filterSpec) string {
+	var res []string
+	if !reflect.DeepEqual(old.Excludes, upd.Excludes) {
+		res = append(res, fmt.Sprintf("excludes: %v -> %v", old.Excludes, upd.Excludes))
+	}
+	if !reflect.DeepEqual(old.Includes, upd.Includes) {
+		res = append(res, fmt.Sprintf("includes: %v -> %v", old.Includes, upd.Includes))
+	}
+	if old.IncludesPattern != upd.IncludesPattern {
+		res = append(res, fmt.Sprintf("include pattern: %q -> %q", old.IncludesPattern, upd.IncludesPattern))
+	}
+	if old.ExcludesPattern != upd.ExcludesPattern {
+		res = append(res, fmt.Sprintf("exclude pattern: %q -> %q", old.ExcludesPattern, upd.ExcludesPattern))
+	}
+	return strings.Join(res, ", ")
+}
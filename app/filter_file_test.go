@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_loadFilterFile(t *testing.T) {
+	tbl := []struct {
+		content string
+		res     filterSpec
+		err     string
+	}{
+		{"", filterSpec{}, ""},
+		{"# comment\n\nEXCLUDE=c1, c2\nEXCLUDE_PATTERN=^tmp\n", filterSpec{}, "only single option Excludes/ExcludesPattern"},
+		{"# comment\n\nEXCLUDE=c1, c2\n", filterSpec{Excludes: []string{"c1", "c2"}}, ""},
+		{"INCLUDE=c1\n", filterSpec{Includes: []string{"c1"}}, ""},
+		{"INCLUDE_PATTERN = ^web\nEXCLUDE_PATTERN=api=1", filterSpec{IncludesPattern: "^web", ExcludesPattern: "api=1"}, ""},
+		{"INCLUDE=\n", filterSpec{}, ""},
+		{"INCLUDE_PATTERN=[", filterSpec{}, "could not parse Includes Pattern"},
+		{"INCLUDE", filterSpec{}, "invalid filter file line"},
+		{"OTHER=1", filterSpec{}, "unknown filter file key OTHER"},
+	}
+	for i, tt := range tbl {
+		path := filepath.Join(t.TempDir(), "filters.env")
+		require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o600))
+		res, err := loadFilterFile(path, "first")
+		if tt.err != "" {
+			assert.ErrorContains(t, err, tt.err, "case #%d", i)
+			continue
+		}
+		require.NoError(t, err, "case #%d", i)
+		assert.Equal(t, tt.res, res, "case #%d", i)
+	}
+
+	path := filepath.Join(t.TempDir(), "filters.env")
+	require.NoError(t, os.WriteFile(path, []byte("INCLUDE=web\nEXCLUDE=web-debug\nEXCLUDE_PATTERN=^tmp\n"), 0o600))
+	res, err := loadFilterFile(path, "exclude-wins")
+	require.NoError(t, err, "filters combined with explicit precedence")
+	assert.Equal(t, filterSpec{Includes: []string{"web"}, Excludes: []string{"web-debug"}, ExcludesPattern: "^tmp"}, res)
+
+	_, err = loadFilterFile("/no/such/file", "first")
+	assert.Error(t, err)
+}
+
+func Test_filtersDiff(t *testing.T) {
+	assert.Equal(t, "", filtersDiff(filterSpec{}, filterSpec{}))
+	assert.Equal(t, `excludes: [c1] -> [c1 c2], include pattern: "" -> "^web"`,
+		filtersDiff(filterSpec{Excludes: []string{"c1"}}, filterSpec{Excludes: []string{"c1", "c2"}, IncludesPattern: "^web"}))
+}
+
+func Test_reloadFilters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filters.env")
+	current := filterSpec{Excludes: []string{"c1"}}
+	var applied []filterSpec
+	apply := func(f filterSpec) error {
+		applied = append(applied, f)
+		if f.IncludesPattern == "reject" {
+			return errors.New("rejected")
+		}
+		return nil
+	}
+
+	assert.Equal(t, current, reloadFilters(path, "first", current, apply), "no file, keep current")
+
+	require.NoError(t, os.WriteFile(path, []byte("EXCLUDE=c1"), 0o600))
+	assert.Equal(t, current, reloadFilters(path, "first", current, apply), "unchanged")
+	assert.Empty(t, applied)
+
+	require.NoError(t, os.WriteFile(path, []byte("INCLUDE_PATTERN=reject"), 0o600))
+	assert.Equal(t, current, reloadFilters(path, "first", current, apply), "rejected, keep current")
+
+	require.NoError(t, os.WriteFile(path, []byte("EXCLUDE=c2"), 0o600))
+	assert.Equal(t, filterSpec{Excludes: []string{"c2"}}, reloadFilters(path, "first", current, apply))
+	assert.Len(t, applied, 2)
+}
+
+func Test_watchFilterFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filters.env")
+	require.NoError(t, os.WriteFile(path, []byte("EXCLUDE=c1"), 0o600))
+
+	var lock sync.Mutex
+	var applied []filterSpec
+	apply := func(f filterSpec) error {
+		lock.Lock()
+		defer lock.Unlock()
+		applied = append(applied, f)
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reloadNow, err := watchFilterFile(ctx, path, "first", filterSpec{Excludes: []string{"c1"}}, apply)
+	require.NoError(t, err)
+	appliedSpecs := func() []filterSpec {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]filterSpec(nil), applied...)
+	}
+
+	for _, content := range []string{"EXCLUDE=c2", "EXCLUDE=c2,c3", "EXCLUDE=c2,c3,c4"} {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		time.Sleep(10 * time.Millisecond)
+	}
+	// replaced by rename, like editors and config maps do
+	tmp := filepath.Join(filepath.Dir(path), "filters.tmp")
+	require.NoError(t, os.WriteFile(tmp, []byte("EXCLUDE=c5"), 0o600))
+	require.NoError(t, os.Rename(tmp, path))
+
+	require.Eventually(t, func() bool { return len(appliedSpecs()) > 0 }, 2*time.Second, 10*time.Millisecond)
+	time.Sleep(2 * filterReloadDelay)
+	assert.Equal(t, []filterSpec{{Excludes: []string{"c5"}}}, appliedSpecs(), "rapid edits debounced")
+
+	require.NoError(t, os.WriteFile(tmp, []byte("EXCLUDE=c6"), 0o600))
+	require.NoError(t, os.Rename(tmp, path))
+	reloadNow()
+	assert.Equal(t, []filterSpec{{Excludes: []string{"c5"}}, {Excludes: []string{"c6"}}}, appliedSpecs(), "reloaded right away")
+	reloadNow()
+	assert.Len(t, appliedSpecs(), 2, "unchanged file not applied")
+
+	_, err = watchFilterFile(ctx, "/no/such/dir/filters.env", "first", filterSpec{}, apply)
+	assert.Error(t, err)
+}
@@ -0,0 +1,345 @@
+// Package gelf sends container logs to Graylog and other GELF receivers, each line as GELF 1.1 message over
+// UDP, chunked and optionally compressed, or TCP.
+package gelf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+)
+
+// DefaultChunkSize is the max size of UDP datagram, used unless Params.ChunkSize set.
+// Fits ethernet MTU along with IP and UDP headers, the same as docker's gelf logging driver.
+const DefaultChunkSize = 1420
+
+// GELF syslog severity levels of messages for stdout and stderr lines
+const (
+	LevelError = 3
+	LevelInfo  = 6
+)
+
+const (
+	maxChunks      = 128 // chunks limit of GELF, larger messages dropped by receivers
+	chunkHeaderLen = 12  // magic bytes, message id, sequence number and count
+	dialTimeout    = 5 * time.Second
+	writeTimeout   = 5 * time.Second
+	closeTimeout   = 5 * time.Second // wait for queued tcp messages on close
+	redialInterval = time.Second     // min interval between tcp connects, messages dropped meanwhile
+	queueSize      = 1000            // default size of tcp messages queue
+)
+
+// Params defines GELF receiver and message options for NewWriter
+type Params struct {
+	Address   string // host:port of GELF input, i.e. 127.0.0.1:12201
+	Protocol  string // udp or tcp, udp if empty
+	Compress  bool   // gzip messages, udp only as GELF TCP doesn't support compression
+	ChunkSize int    // max UDP datagram size, larger messages chunked, DefaultChunkSize if 0
+	ShortLen  int    // max length of short_message, longer lines sent whole in full_message, unlimited if 0
+	Host      string // host field of messages, source of logs
+	QueueSize int    // max tcp messages queued while receiver slow or down, newer ones dropped, 1000 if 0
+}
+
+// Writer sends each write, a log line, as GELF message with container's fields. Writer of stdout made by
+// NewWriter and writer of stderr by its Stderr share the connection, closed by Close of any of them.
+// TCP messages queued and sent by a background goroutine, so slow or unreachable receiver never blocks
+// container's log stream, messages dropped with a warning once the queue is full.
+type Writer struct {
+	*sender
+	level  int
+	fields map[string]string
+}
+
+// sender delivers encoded messages to GELF receiver, shared by writers of the container
+type sender struct {
+	params Params
+	lock   sync.Mutex
+	conn   net.Conn // owned by run for tcp
+	closed bool
+	now    func() time.Time
+
+	// tcp only
+	frames  chan []byte   // null terminated messages, sent by run
+	done    chan struct{} // closed once run completed
+	abort   atomic.Bool   // set on close timeout, run drops the rest of queue
+	dropped atomic.Int64
+	warned  atomic.Bool // set once drop logged, reset by delivery
+	redial  time.Duration
+	dialer  func(network, address string, timeout time.Duration) (net.Conn, error)
+}
+
+// message is GELF 1.1 payload, additional fields merged on marshaling
+type message struct {
+	Version      string  `json:"version"`
+	Host         string  `json:"host"`
+	ShortMessage string  `json:"short_message"`
+	FullMessage  string  `json:"full_message,omitempty"`
+	Timestamp    float64 `json:"timestamp"`
+	Level        int     `json:"level"`
+}
+
+// NewWriter makes writer of container's stdout lines, with LevelInfo. Fields are additional fields of
+// messages, i.e. container_name, sent with underscore prefix. UDP receiver dialed right away, so invalid address
+// fails here. TCP receiver connected on the first message and reconnected on later ones if down, so receiver
+// unreachable at container's start doesn't lose the container.
+func NewWriter(params Params, fields map[string]string) (*Writer, error) {
+	if params.Protocol == "" {
+		params.Protocol = "udp"
+	}
+	if params.Protocol != "udp" && params.Protocol != "tcp" {
+		return nil, errors.Errorf("unsupported gelf protocol %q", params.Protocol)
+	}
+	if params.Compress && params.Protocol == "tcp" {
+		return nil, errors.New("gelf compression not supported with tcp")
+	}
+	if params.ChunkSize == 0 {
+		params.ChunkSize = DefaultChunkSize
+	}
+	if params.ChunkSize <= chunkHeaderLen {
+		return nil, errors.Errorf("gelf chunk size %d too small", params.ChunkSize)
+	}
+	if params.QueueSize <= 0 {
+		params.QueueSize = queueSize
+	}
+	s := &sender{params: params, now: time.Now, redial: redialInterval, dialer: net.DialTimeout}
+	if params.Protocol == "tcp" {
+		s.frames, s.done = make(chan []byte, params.QueueSize), make(chan struct{})
+		go s.run()
+		return &Writer{sender: s, level: LevelInfo, fields: withStream(fields, "stdout")}, nil
+	}
+	if err := s.dial(); err != nil {
+		return nil, err
+	}
+	return &Writer{sender: s, level: LevelInfo, fields: withStream(fields, "stdout")}, nil
+}
+
+// Stderr returns writer of container's stderr lines, with LevelError, sharing the connection
+func (w *Writer) Stderr() *Writer {
+	return &Writer{sender: w.sender, level: LevelError, fields: withStream(w.fields, "stderr")}
+}
+
+// errTooLarge is error of message not fitting max number of chunks
+var errTooLarge = errors.New("gelf message too large")
+
+// Write sends p, trailing new line trimmed, as GELF message. Message too large for UDP dropped with warning,
+// without failing the write, so a single huge line doesn't break container's log stream.
+func (w *Writer) Write(p []byte) (int, error) {
+	data, err := w.encode(strings.TrimRight(string(p), "\r\n"))
+	if err != nil {
+		return 0, err
+	}
+	if err := w.send(data); err != nil {
+		if errors.Is(err, errTooLarge) {
+			log.Printf("[WARN] gelf message of %s dropped, %v", w.fields["container_name"], err)
+			return len(p), nil
+		}
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// encode makes GELF message of the line, with additional fields of the writer
+func (w *Writer) encode(line string) ([]byte, error) {
+	msg := message{Version: "1.1", Host: w.params.Host, ShortMessage: line, Level: w.level,
+		Timestamp: float64(w.now().UnixMilli()) / 1000}
+	if msg.Host == "" {
+		msg.Host = "unknown"
+	}
+	if runes := []rune(line); w.params.ShortLen > 0 && len(runes) > w.params.ShortLen {
+		msg.ShortMessage, msg.FullMessage = string(runes[:w.params.ShortLen]), line
+	}
+	base, err := json.Marshal(msg)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't marshal gelf message")
+	}
+	if len(w.fields) == 0 {
+		return base, nil
+	}
+	extra := make(map[string]string, len(w.fields))
+	for k, v := range w.fields {
+		extra["_"+k] = v
+	}
+	fields, err := json.Marshal(extra)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't marshal gelf fields")
+	}
+	// both are json objects, join them as {base,fields}
+	return append(append(base[:len(base)-1], ','), fields[1:]...), nil
+}
+
+// Close closes connection to receiver, shared by stdout and stderr writers, so the second call is no-op.
+// Queued TCP messages sent first, the rest dropped if not sent in time.
+func (s *sender) Close() error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return nil
+	}
+	s.closed = true
+	if s.frames == nil {
+		defer s.lock.Unlock()
+		return s.conn.Close()
+	}
+	close(s.frames)
+	s.lock.Unlock()
+
+	select {
+	case <-s.done:
+	case <-time.After(closeTimeout):
+		log.Printf("[WARN] gelf %s closed with %d queued messages", s.params.Address, len(s.frames))
+		s.abort.Store(true)
+		<-s.done
+	}
+	if dropped := s.dropped.Load(); dropped > 0 {
+		log.Printf("[WARN] gelf %s dropped %d messages", s.params.Address, dropped)
+	}
+	return nil
+}
+
+// dial connects to receiver, should be called with lock held after construction, or by run for tcp
+func (s *sender) dial() error {
+	conn, err := s.dialer(s.params.Protocol, s.params.Address, dialTimeout)
+	if err != nil {
+		return errors.Wrapf(err, "can't connect to gelf %s", s.params.Address)
+	}
+	s.conn = conn
+	return nil
+}
+
+// send delivers encoded message. UDP messages compressed and chunked as needed, TCP ones null terminated
+// and queued for run, dropped if the queue is full.
+func (s *sender) send(data []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return errors.New("gelf writer closed")
+	}
+	if s.frames != nil {
+		select {
+		case s.frames <- append(data, 0):
+		default:
+			s.drop("queue is full")
+		}
+		return nil
+	}
+
+	if s.params.Compress {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(data); err != nil {
+			return errors.Wrap(err, "can't compress gelf message")
+		}
+		if err := gz.Close(); err != nil {
+			return errors.Wrap(err, "can't compress gelf message")
+		}
+		data = buf.Bytes()
+	}
+	if len(data) <= s.params.ChunkSize {
+		return s.write(data)
+	}
+	return s.writeChunks(data)
+}
+
+// run sends queued TCP messages until queue closed, and closes connection. Connects on demand, with
+// a single reconnect on failed write, i.e. receiver restarted. Failed connect retried on later messages, not
+// more often than redial interval, messages dropped meanwhile.
+func (s *sender) run() {
+	defer close(s.done)
+	var failed time.Time // time of the last failed connect, zero if connected
+	for frame := range s.frames {
+		if s.abort.Load() {
+			s.dropped.Add(1)
+			continue
+		}
+		if err := s.deliver(frame, &failed); err != nil {
+			s.drop(err.Error())
+			continue
+		}
+		if s.warned.Swap(false) {
+			log.Printf("[INFO] gelf %s delivers again, %d messages dropped so far", s.params.Address, s.dropped.Load())
+		}
+	}
+	if s.conn != nil {
+		_ = s.conn.Close()
+	}
+}
+
+// deliver writes TCP message, connecting or reconnecting as needed. Used by run only.
+func (s *sender) deliver(frame []byte, failed *time.Time) error {
+	if s.conn != nil {
+		if err := s.write(frame); err == nil {
+			return nil
+		}
+		_ = s.conn.Close()
+		s.conn = nil
+	}
+	if !failed.IsZero() && time.Since(*failed) < s.redial {
+		return errors.Errorf("gelf %s unreachable", s.params.Address)
+	}
+	if err := s.dial(); err != nil {
+		*failed = time.Now()
+		return err
+	}
+	*failed = time.Time{}
+	return s.write(frame)
+}
+
+// drop counts dropped TCP message, logs the first one dropped since messages delivered
+func (s *sender) drop(reason string) {
+	s.dropped.Add(1)
+	if !s.warned.Swap(true) {
+		log.Printf("[WARN] gelf messages to %s dropped, %s", s.params.Address, reason)
+	}
+}
+
+// writeChunks sends message as GELF chunks, each with magic bytes, message id, sequence number and count
+func (s *sender) writeChunks(data []byte) error {
+	size := s.params.ChunkSize - chunkHeaderLen
+	count := (len(data) + size - 1) / size
+	if count > maxChunks {
+		return errors.Wrapf(errTooLarge, "%d bytes in %d chunks", len(data), count)
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return errors.Wrap(err, "can't make gelf message id")
+	}
+	chunk := make([]byte, 0, s.params.ChunkSize)
+	for i := 0; i < count; i++ {
+		end := min((i+1)*size, len(data))
+		chunk = append(append(append(chunk[:0], 0x1e, 0x0f), id...), byte(i), byte(count))
+		chunk = append(chunk, data[i*size:end]...)
+		if err := s.write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write sends data to connection with write timeout
+func (s *sender) write(data []byte) error {
+	if err := s.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return errors.Wrap(err, "can't set gelf write deadline")
+	}
+	if _, err := s.conn.Write(data); err != nil {
+		return errors.Wrapf(err, "can't send to gelf %s", s.params.Address)
+	}
+	return nil
+}
+
+// withStream returns copy of fields with stream field set
+func withStream(fields map[string]string, stream string) map[string]string {
+	res := make(map[string]string, len(fields)+1)
+	for k, v := range fields {
+		res[k] = v
+	}
+	res["stream"] = stream
+	return res
+}
@@ -0,0 +1,272 @@
+package gelf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterUDP(t *testing.T) {
+	conn := udpReceiver(t)
+	wr, err := NewWriter(Params{Address: conn.LocalAddr().String(), Host: "h1"},
+		map[string]string{"container_name": "web", "group": "shop", "image_name": "nginx:1.25"})
+	require.NoError(t, err)
+	wr.now = func() time.Time { return time.Date(2024, 5, 1, 10, 0, 0, 123456789, time.UTC) }
+
+	n, err := wr.Write([]byte("line 1\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 7, n)
+	msg := readMessage(t, readDatagram(t, conn))
+	assert.Equal(t, map[string]interface{}{"version": "1.1", "host": "h1", "short_message": "line 1", "timestamp": 1714557600.123,
+		"level": float64(LevelInfo), "_container_name": "web", "_group": "shop", "_image_name": "nginx:1.25", "_stream": "stdout"}, msg)
+
+	_, err = wr.Stderr().Write([]byte("error 1\n"))
+	require.NoError(t, err)
+	msg = readMessage(t, readDatagram(t, conn))
+	assert.Equal(t, "error 1", msg["short_message"])
+	assert.Equal(t, float64(LevelError), msg["level"])
+	assert.Equal(t, "stderr", msg["_stream"])
+	assert.Equal(t, "web", msg["_container_name"])
+
+	require.NoError(t, wr.Close())
+	require.NoError(t, wr.Stderr().Close(), "shared connection closed once")
+	_, err = wr.Write([]byte("line 2\n"))
+	require.EqualError(t, err, "gelf writer closed")
+}
+
+func TestWriterShortMessage(t *testing.T) {
+	conn := udpReceiver(t)
+	wr, err := NewWriter(Params{Address: conn.LocalAddr().String(), ShortLen: 5}, nil)
+	require.NoError(t, err)
+	defer wr.Close()
+
+	_, err = wr.Write([]byte("short"))
+	require.NoError(t, err)
+	msg := readMessage(t, readDatagram(t, conn))
+	assert.Equal(t, "short", msg["short_message"])
+	assert.NotContains(t, msg, "full_message")
+	assert.Equal(t, "unknown", msg["host"])
+
+	_, err = wr.Write([]byte("привет мир\n"))
+	require.NoError(t, err)
+	msg = readMessage(t, readDatagram(t, conn))
+	assert.Equal(t, "приве", msg["short_message"], "cut by runes")
+	assert.Equal(t, "привет мир", msg["full_message"])
+}
+
+func TestWriterChunked(t *testing.T) {
+	conn := udpReceiver(t)
+	line := strings.Repeat("0123456789", 50)
+	for _, compress := range []bool{false, true} {
+		wr, err := NewWriter(Params{Address: conn.LocalAddr().String(), ChunkSize: 100, Compress: compress}, nil)
+		require.NoError(t, err)
+		if compress {
+			line = randomText(t, 2000) // incompressible enough to be chunked
+		}
+		_, err = wr.Write([]byte(line))
+		require.NoError(t, err)
+
+		var data []byte
+		var id []byte
+		for i := 0; ; i++ {
+			chunk := readDatagram(t, conn)
+			require.LessOrEqual(t, len(chunk), 100)
+			require.Equal(t, []byte{0x1e, 0x0f}, chunk[:2], "magic bytes")
+			if id == nil {
+				id = chunk[2:10]
+			}
+			assert.Equal(t, id, chunk[2:10], "same message id")
+			assert.Equal(t, byte(i), chunk[10], "sequence number")
+			data = append(data, chunk[12:]...)
+			if int(chunk[11]) == i+1 {
+				break
+			}
+		}
+		if compress {
+			zr, err := gzip.NewReader(bytes.NewReader(data))
+			require.NoError(t, err)
+			data, err = io.ReadAll(zr)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, line, readMessage(t, data)["short_message"], "compress %v", compress)
+		require.NoError(t, wr.Close())
+	}
+}
+
+func TestWriterTooManyChunks(t *testing.T) {
+	conn := udpReceiver(t)
+	wr, err := NewWriter(Params{Address: conn.LocalAddr().String(), ChunkSize: 20}, nil)
+	require.NoError(t, err)
+	defer wr.Close()
+	n, err := wr.Write([]byte(strings.Repeat("x", 8*129)))
+	require.NoError(t, err, "dropped without failing the stream")
+	assert.Equal(t, 8*129, n)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+	_, err = conn.Read(make([]byte, 100))
+	require.Error(t, err, "nothing sent")
+
+	err = wr.send(make([]byte, 8*129))
+	require.ErrorIs(t, err, errTooLarge)
+	assert.Equal(t, "1032 bytes in 129 chunks: gelf message too large", err.Error())
+}
+
+func TestWriterTCP(t *testing.T) {
+	lst, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lst.Close()
+	frames := make(chan string, 10)
+	go func() {
+		for i := 0; i < 2; i++ {
+			conn, err := lst.Accept()
+			if err != nil {
+				return
+			}
+			frame, err := bufio.NewReader(conn).ReadString(0)
+			if err == nil {
+				frames <- strings.TrimSuffix(frame, "\x00")
+			}
+			conn.Close() // drop connection after the first message, writer should reconnect
+		}
+	}()
+
+	wr, err := NewWriter(Params{Address: lst.Addr().String(), Protocol: "tcp", Host: "h1"}, map[string]string{"group": "g1"})
+	require.NoError(t, err)
+	defer wr.Close()
+	_, err = wr.Write([]byte("line 1\n"))
+	require.NoError(t, err)
+	msg := readMessage(t, []byte(<-frames))
+	assert.Equal(t, "line 1", msg["short_message"])
+	assert.Equal(t, "g1", msg["_group"])
+
+	// write to the dropped connection may succeed till peer's reset noticed, so keep writing to get reconnected
+	require.Eventually(t, func() bool {
+		_, err = wr.Stderr().Write([]byte("line 2\n"))
+		return err == nil && len(frames) > 0
+	}, time.Second, 10*time.Millisecond)
+	msg = readMessage(t, []byte(<-frames))
+	assert.Equal(t, "line 2", msg["short_message"])
+	assert.Equal(t, float64(LevelError), msg["level"])
+}
+
+func TestNewWriterErrors(t *testing.T) {
+	tbl := []struct {
+		params Params
+		err    string
+	}{
+		{Params{Address: "127.0.0.1:12201", Protocol: "http"}, `unsupported gelf protocol "http"`},
+		{Params{Address: "127.0.0.1:12201", Protocol: "tcp", Compress: true}, "gelf compression not supported with tcp"},
+		{Params{Address: "127.0.0.1:12201", ChunkSize: 12}, "gelf chunk size 12 too small"},
+		{Params{Address: "bad address"}, "can't connect to gelf bad address"},
+	}
+	for _, tt := range tbl {
+		_, err := NewWriter(tt.params, nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), tt.err)
+	}
+}
+
+func TestWriterTCPDownOnStart(t *testing.T) {
+	lst, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := lst.Addr().String()
+	require.NoError(t, lst.Close()) // receiver down
+
+	wr, err := NewWriter(Params{Address: addr, Protocol: "tcp"}, nil)
+	require.NoError(t, err, "connected on demand")
+	defer wr.Close()
+	wr.redial = 10 * time.Millisecond
+	_, err = wr.Write([]byte("line 1\n"))
+	require.NoError(t, err, "dropped without failing the stream")
+	require.Eventually(t, func() bool { return wr.dropped.Load() == 1 }, time.Second, time.Millisecond)
+
+	lst, err = net.Listen("tcp", addr)
+	require.NoError(t, err)
+	defer lst.Close()
+	frames := make(chan string, 10)
+	go func() {
+		conn, err := lst.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rd := bufio.NewReader(conn)
+		for {
+			frame, err := rd.ReadString(0)
+			if err != nil {
+				return
+			}
+			frames <- strings.TrimSuffix(frame, "\x00")
+		}
+	}()
+	require.Eventually(t, func() bool {
+		_, err = wr.Write([]byte("line 2\n"))
+		return err == nil && len(frames) > 0
+	}, time.Second, 20*time.Millisecond, "reconnected once receiver up")
+	assert.Equal(t, "line 2", readMessage(t, []byte(<-frames))["short_message"])
+}
+
+func TestWriterTCPNotBlocking(t *testing.T) {
+	client, server := net.Pipe() // writes block till read
+	defer server.Close()
+	wr, err := NewWriter(Params{Address: "receiver:12201", Protocol: "tcp", QueueSize: 2}, nil)
+	require.NoError(t, err)
+	wr.dialer = func(string, string, time.Duration) (net.Conn, error) { return client, nil }
+
+	st := time.Now()
+	for i := 0; i < 10; i++ {
+		_, err = wr.Write([]byte(fmt.Sprintf("line %d\n", i)))
+		require.NoError(t, err)
+	}
+	assert.Less(t, time.Since(st), time.Second, "not blocked by receiver")
+	assert.GreaterOrEqual(t, wr.dropped.Load(), int64(7), "queue and the message being sent kept only")
+
+	frame, err := bufio.NewReader(server).ReadString(0)
+	require.NoError(t, err)
+	assert.Equal(t, "line 0", readMessage(t, []byte(strings.TrimSuffix(frame, "\x00")))["short_message"])
+	go func() { _, _ = io.Copy(io.Discard, server) }()
+	require.NoError(t, wr.Close())
+}
+
+// udpReceiver makes mock GELF UDP input, closed on test cleanup
+func udpReceiver(t *testing.T) *net.UDPConn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readDatagram(t *testing.T, conn *net.UDPConn) []byte {
+	buf := make([]byte, 65536)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	return buf[:n]
+}
+
+func readMessage(t *testing.T, data []byte) map[string]interface{} {
+	var res map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &res), string(data))
+	return res
+}
+
+// randomText makes text of random letters, hardly compressible
+func randomText(t *testing.T, size int) string {
+	buf := make([]byte, size)
+	_, err := rand.Read(buf)
+	require.NoError(t, err)
+	for i := range buf {
+		buf[i] = 'a' + buf[i]%26
+	}
+	return string(buf)
+}
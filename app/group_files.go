@@ -0,0 +1,219 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+	"gopkg.in/natefinch/lumberjack.v2"
+
+	"github.com/umputun/docker-logger/app/logger"
+)
+
+// fileParams defines location and retention of log files, global or per-group
+type fileParams struct {
+	Location   string
+	MaxSize    int // megabytes
+	MaxBackups int
+	MaxAge     int // in days
+	Shared     bool
+}
+
+// parseGroupFiles parses per-group file overrides in "group:key=value;key=value" format.
+// Supported keys are loc, max-size, max-files, max-age and per, missing keys inherit global values.
+// The per key defines files granularity, "container" (default) or "group" for a single file of all containers.
+func parseGroupFiles(specs []string, global fileParams) (map[string]fileParams, error) {
+	res := map[string]fileParams{}
+	for _, spec := range specs {
+		group, kvs, ok := strings.Cut(spec, ":")
+		if !ok || group == "" {
+			return nil, errors.Errorf("invalid group files spec %q, expected group:key=value;key=value", spec)
+		}
+		params := global
+		for _, kv := range strings.Split(kvs, ";") {
+			key, val, ok := strings.Cut(kv, "=")
+			if !ok {
+				return nil, errors.Errorf("invalid key=value %q for group %s", kv, group)
+			}
+			if key == "loc" {
+				params.Location = val
+				continue
+			}
+			if key == "per" {
+				if val != "container" && val != "group" {
+					return nil, errors.Errorf("invalid per value %q for group %s, expected container or group", val, group)
+				}
+				params.Shared = val == "group"
+				continue
+			}
+			num, err := strconv.Atoi(val)
+			if err != nil || num < 0 {
+				return nil, errors.Errorf("invalid %s value %q for group %s", key, val, group)
+			}
+			switch key {
+			case "max-size":
+				params.MaxSize = num
+			case "max-files":
+				params.MaxBackups = num
+			case "max-age":
+				params.MaxAge = num
+			default:
+				return nil, errors.Errorf("unknown key %s for group %s", key, group)
+			}
+		}
+		res[group] = params
+	}
+	return res, nil
+}
+
+// checkWritable makes sure directory exists or can be created and writable
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return errors.Wrapf(err, "can't make directory %s", dir)
+	}
+	f, err := os.CreateTemp(dir, ".docker-logger-check-*")
+	if err != nil {
+		return errors.Wrapf(err, "directory %s is not writable", dir)
+	}
+	_ = f.Close()
+	return os.Remove(f.Name())
+}
+
+// filesFor returns file params for the group, falls back to global options if group has no overrides
+func (o *cliOpts) filesFor(group string) fileParams {
+	if p, ok := o.groupFiles[group]; ok {
+		return p
+	}
+	return fileParams{Location: o.FilesLocation, MaxSize: o.MaxFileSize, MaxBackups: o.MaxFilesCount, MaxAge: o.MaxFilesAge}
+}
+
+// fileLocations returns sorted unique log files locations, global and per-group
+func fileLocations(opts *cliOpts) []string {
+	locs := map[string]bool{opts.FilesLocation: true}
+	for _, fp := range opts.groupFiles {
+		locs[fp.Location] = true
+	}
+	res := make([]string, 0, len(locs))
+	for loc := range locs {
+		res = append(res, loc)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// setupDiskBudget makes disk budget of all log files locations with MaxTotalSize. Rotation needs at least
+// the smallest max size written, so a check triggered once that much written through files writers.
+func setupDiskBudget(opts *cliOpts) error {
+	if !opts.EnableFiles || opts.MaxTotalSize <= 0 {
+		return nil
+	}
+	if opts.DiskCheck <= 0 {
+		return errors.Errorf("invalid disk check interval %v", opts.DiskCheck)
+	}
+	checkAfter := opts.MaxFileSize
+	for _, fp := range opts.groupFiles {
+		if fp.MaxSize < checkAfter {
+			checkAfter = fp.MaxSize
+		}
+	}
+	opts.budget = logger.NewDiskBudget(logger.DiskBudgetParams{Dirs: fileLocations(opts), Limit: int64(opts.MaxTotalSize) << 20,
+		Interval: opts.DiskCheck, CheckAfter: int64(checkAfter) << 20})
+	return nil
+}
+
+// setupManifest makes manifest of rotated log files with Manifest, directory of the manifest made if missing
+func setupManifest(opts *cliOpts) (err error) {
+	if !opts.EnableFiles || opts.Manifest == "" {
+		return nil
+	}
+	if err = os.MkdirAll(filepath.Dir(opts.Manifest), 0o750); err != nil {
+		return errors.Wrapf(err, "can't make directory of manifest %s", opts.Manifest)
+	}
+	opts.manifest, err = logger.NewManifest(opts.Manifest)
+	return err
+}
+
+// manifested wraps log file writer to list rotated files in manifest, if enabled. Rotation and compression made
+// by the wrapper then, so rotated files listed once compressed.
+func manifested(opts *cliOpts, wr *lumberjack.Logger, containerName, group string) io.WriteCloser {
+	if opts.manifest == nil {
+		return wr
+	}
+	maxSize := wr.MaxSize
+	if maxSize == 0 {
+		maxSize = 100 // lumberjack's default
+	}
+	file := logger.ManifestFile{File: wr.Filename, MaxSize: int64(maxSize) << 20, Compress: wr.Compress,
+		Container: containerName, Group: group}
+	wr.Compress = false
+	return opts.manifest.Writer(wr, file)
+}
+
+// sharedFileWriters makes container's writers of group's shared out and err files, i.e. logs/group.log.
+// With prefixed set lines prefixed with container name, as json and logfmt lines have container field already.
+func sharedFileWriters(opts *cliOpts, fp fileParams, containerName, group string, prefixed bool) (logWriter, errWriter io.WriteCloser) {
+	prefix := ""
+	if prefixed {
+		prefix = containerName + " "
+	}
+	open := func(name string) func() io.WriteCloser {
+		return func() io.WriteCloser {
+			log.Printf("[INFO] shared logger created for %s, max.size=%dM, max.files=%d, max.days=%d",
+				name, fp.MaxSize, fp.MaxBackups, fp.MaxAge)
+			return buffered(opts, budgeted(opts, manifested(opts, &lumberjack.Logger{Filename: name, MaxSize: fp.MaxSize,
+				MaxBackups: fp.MaxBackups, MaxAge: fp.MaxAge, Compress: true}, "", group)))
+		}
+	}
+
+	logName, errName := containerLogFiles(opts, containerName, group)
+	if err := os.MkdirAll(filepath.Dir(logName), 0o750); err != nil {
+		log.Fatalf("[ERROR] can't make directory %s, %v", filepath.Dir(logName), err)
+	}
+	log.Printf("[INFO] %s writes to shared %s and %s", containerName, logName, errName)
+	return opts.shared.handle(logName, prefix, open(logName)), opts.shared.handle(errName, prefix, open(errName))
+}
+
+// sharedFiles keeps shared files of groups with per=group, each open while any container writes to it
+type sharedFiles struct {
+	lock  sync.Mutex
+	files map[string]*logger.SharedWriter
+}
+
+func newSharedFiles() *sharedFiles {
+	return &sharedFiles{files: map[string]*logger.SharedWriter{}}
+}
+
+// handle returns container's writer of shared file, with prefix added to each line.
+// The file opened by open if not opened yet, or closed already as all its writers closed.
+func (s *sharedFiles) handle(path, prefix string, open func() io.WriteCloser) io.WriteCloser {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if w, ok := s.files[path]; ok {
+		if h, ok := w.Handle(prefix); ok {
+			return h
+		}
+	}
+	w := logger.NewSharedWriter(open(), func(w *logger.SharedWriter) {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		if s.files[path] == w {
+			delete(s.files, path)
+		}
+	})
+	s.files[path] = w
+	h, _ := w.Handle(prefix) // new writer is not closed
+	return h
+}
+
+// len returns number of open shared files
+func (s *sharedFiles) len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.files)
+}
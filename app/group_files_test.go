@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/docker-logger/app/discovery"
+	"github.com/umputun/docker-logger/app/logger"
+)
+
+func Test_parseGroupFiles(t *testing.T) {
+	global := fileParams{Location: "logs", MaxSize: 10, MaxBackups: 5, MaxAge: 30}
+
+	res, err := parseGroupFiles([]string{"prod:loc=/srv/prod;max-age=30;max-files=10", "dev:max-age=1;max-size=1",
+		"batch:per=group", "web:per=container"}, global)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]fileParams{
+		"prod":  {Location: "/srv/prod", MaxSize: 10, MaxBackups: 10, MaxAge: 30},
+		"dev":   {Location: "logs", MaxSize: 1, MaxBackups: 5, MaxAge: 1},
+		"batch": {Location: "logs", MaxSize: 10, MaxBackups: 5, MaxAge: 30, Shared: true},
+		"web":   {Location: "logs", MaxSize: 10, MaxBackups: 5, MaxAge: 30},
+	}, res)
+
+	for _, spec := range []string{"prod", ":max-age=1", "prod:max-age", "prod:max-age=x", "prod:max-age=-1", "prod:blah=1",
+		"prod:per=host"} {
+		_, err = parseGroupFiles([]string{spec}, global)
+		assert.Error(t, err, spec)
+	}
+}
+
+func Test_checkWritable(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, checkWritable(filepath.Join(dir, "sub", "dir")))
+	entries, err := os.ReadDir(filepath.Join(dir, "sub", "dir"))
+	require.NoError(t, err)
+	assert.Empty(t, entries, "check file removed")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file"), []byte("x"), 0o600))
+	assert.Error(t, checkWritable(filepath.Join(dir, "file", "dir")))
+}
+
+func Test_makeLogWritersGroupFiles(t *testing.T) {
+	dir := t.TempDir()
+	opts := cliOpts{FilesLocation: filepath.Join(dir, "default"), EnableFiles: true, MaxFileSize: 1, MaxFilesCount: 10,
+		groupFiles: map[string]fileParams{"prod": {Location: filepath.Join(dir, "prod"), MaxSize: 1, MaxBackups: 1, MaxAge: 1}}}
+
+	stdWr, errWr, err := makeLogWriters(&opts, "container1", "prod")
+	require.NoError(t, err)
+	_, err = stdWr.Write([]byte("prod line\n"))
+	require.NoError(t, err)
+	assert.NoError(t, stdWr.Close())
+	assert.NoError(t, errWr.Close())
+
+	stdWr, errWr, err = makeLogWriters(&opts, "container2", "dev")
+	require.NoError(t, err)
+	_, err = stdWr.Write([]byte("dev line\n"))
+	require.NoError(t, err)
+	assert.NoError(t, stdWr.Close())
+	assert.NoError(t, errWr.Close())
+
+	r, err := os.ReadFile(filepath.Join(dir, "prod", "prod", "container1.log"))
+	require.NoError(t, err)
+	assert.Equal(t, "prod line\n", string(r))
+
+	r, err = os.ReadFile(filepath.Join(dir, "default", "dev", "container2.log"))
+	require.NoError(t, err)
+	assert.Equal(t, "dev line\n", string(r))
+}
+
+func Test_makeLogWritersSharedFiles(t *testing.T) {
+	dir := t.TempDir()
+	opts := cliOpts{FilesLocation: dir, EnableFiles: true, MaxFileSize: 1, MaxFilesCount: 10, shared: newSharedFiles(),
+		groupFiles: map[string]fileParams{"batch": {Location: dir, MaxSize: 1, MaxBackups: 1, Shared: true}}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		stdWr, errWr, err := makeLogWriters(&opts, fmt.Sprintf("job%d", i), "batch")
+		require.NoError(t, err)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				_, err := stdWr.Write([]byte("out line\n"))
+				assert.NoError(t, err)
+			}
+			_, err := errWr.Write([]byte("err line\n"))
+			assert.NoError(t, err)
+			assert.NoError(t, stdWr.Close())
+			assert.NoError(t, errWr.Close())
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 0, opts.shared.len(), "closed with the last container")
+
+	r, err := os.ReadFile(filepath.Join(dir, "batch.log")) //nolint:gosec // test file
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(r), "\n"), "\n")
+	assert.Len(t, lines, 100, "single file for all containers")
+	for _, line := range lines {
+		assert.Regexp(t, `^job\d out line$`, line)
+	}
+	r, err = os.ReadFile(filepath.Join(dir, "batch.err")) //nolint:gosec // test file
+	require.NoError(t, err)
+	assert.Equal(t, 5, strings.Count(string(r), " err line\n"))
+	_, err = os.Stat(filepath.Join(dir, "batch"))
+	assert.True(t, os.IsNotExist(err), "no per-container files")
+
+	// reopened after all closed, appended to existing file
+	stdWr, errWr, err := makeLogWriters(&opts, "job9", "batch")
+	require.NoError(t, err)
+	_, err = stdWr.Write([]byte("later line\n"))
+	require.NoError(t, err)
+	require.NoError(t, stdWr.Close())
+	require.NoError(t, errWr.Close())
+	r, err = os.ReadFile(filepath.Join(dir, "batch.log")) //nolint:gosec // test file
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(string(r), "out line\njob9 later line\n"))
+
+	// json lines keep container in envelope, no prefix
+	opts.ExtJSON, opts.MixErr = true, true
+	stdWr, errWr, err = makeLogWriters(&opts, "job10", "batch")
+	require.NoError(t, err)
+	_, err = stdWr.Write([]byte("json line\n"))
+	require.NoError(t, err)
+	_, err = errWr.Write([]byte("json err\n"))
+	require.NoError(t, err)
+	closeWriters(discovery.Event{ContainerName: "job10"}, stdWr, errWr) // as closed on container's stop
+	assert.Equal(t, 0, opts.shared.len(), "mixed file closed with the container")
+	r, err = os.ReadFile(filepath.Join(dir, "batch.log")) //nolint:gosec // test file
+	require.NoError(t, err)
+	lines = strings.Split(strings.TrimSuffix(string(r), "\n"), "\n")
+	assert.True(t, strings.HasPrefix(lines[len(lines)-2], `{"msg":"json line`), lines[len(lines)-2])
+	assert.Contains(t, lines[len(lines)-1], `"container":"job10"`, "mixed err in the same file")
+}
+
+func Test_setupDiskBudget(t *testing.T) {
+	dir := t.TempDir()
+	opts := cliOpts{FilesLocation: filepath.Join(dir, "default"), EnableFiles: true, MaxFileSize: 10, MaxTotalSize: 1,
+		DiskCheck: time.Minute, groupFiles: map[string]fileParams{"prod": {Location: filepath.Join(dir, "prod"), MaxSize: 1}}}
+	require.NoError(t, setupDiskBudget(&opts))
+	require.NotNil(t, opts.budget)
+
+	for _, loc := range []string{"default", "prod"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, loc), 0o750))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, loc, "c-2024-05-01T10-00-00.000.log.gz"),
+			[]byte(strings.Repeat("x", 1<<20)), 0o600))
+	}
+	require.NoError(t, opts.budget.Check())
+	assert.Equal(t, int64(1<<20), opts.budget.Stats().Usage, "both locations budgeted")
+	assert.Equal(t, 1, opts.budget.Stats().Removed)
+
+	wr := budgeted(&opts, &wrMock{})
+	_, ok := wr.(*wrMock)
+	assert.False(t, ok, "wrapped to trigger checks")
+
+	opts = cliOpts{EnableFiles: true, MaxTotalSize: 1}
+	assert.Error(t, setupDiskBudget(&opts), "invalid interval")
+	opts = cliOpts{EnableFiles: true, DiskCheck: time.Minute}
+	require.NoError(t, setupDiskBudget(&opts))
+	assert.Nil(t, opts.budget, "disabled by default")
+	wr = budgeted(&opts, &wrMock{})
+	_, ok = wr.(*wrMock)
+	assert.True(t, ok)
+}
+
+func Test_setupManifest(t *testing.T) {
+	dir := t.TempDir()
+	opts := cliOpts{FilesLocation: dir, EnableFiles: true, MaxFileSize: 1, MaxFilesCount: 10,
+		Manifest: filepath.Join(dir, "archive", "manifest.json")}
+	require.NoError(t, setupManifest(&opts))
+	require.NotNil(t, opts.manifest)
+
+	stdWr, errWr, err := makeLogWriters(&opts, "web", "shop")
+	require.NoError(t, err)
+	line := strings.Repeat("x", 600<<10) + "\n"
+	for i := 0; i < 3; i++ { // rotated on the second and third writes
+		_, err := stdWr.Write([]byte(line))
+		require.NoError(t, err)
+		time.Sleep(2 * time.Millisecond)
+	}
+	require.NoError(t, stdWr.Close())
+	require.NoError(t, errWr.Close())
+
+	data, err := os.ReadFile(opts.Manifest)
+	require.NoError(t, err)
+	var manifest struct {
+		Files []logger.ManifestEntry `json:"files"`
+	}
+	require.NoError(t, json.Unmarshal(data, &manifest))
+	require.Len(t, manifest.Files, 2)
+	for _, f := range manifest.Files {
+		assert.Equal(t, "web", f.Container)
+		assert.Equal(t, "shop", f.Group)
+		assert.Equal(t, filepath.Join(dir, "shop", "web.log"), f.LogFile)
+		assert.True(t, strings.HasSuffix(f.File, ".log.gz"), f.File)
+		assert.Less(t, f.Size, int64(len(line)), "compressed")
+	}
+
+	opts = cliOpts{EnableFiles: true}
+	require.NoError(t, setupManifest(&opts))
+	assert.Nil(t, opts.manifest, "disabled by default")
+	opts.Manifest = filepath.Join(dir, "bad.json")
+	require.NoError(t, os.WriteFile(opts.Manifest, []byte("bad"), 0o600))
+	assert.Error(t, setupManifest(&opts))
+}
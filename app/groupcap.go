@@ -0,0 +1,101 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/docker-logger/app/discovery"
+)
+
+// groupCap limits number of concurrently streamed containers of a group, keeping streams of the most recently
+// started ones. Start of a container in a group at its limit evicts stream of the group's oldest container,
+// or skips the started one if it's the oldest. Once a slot of the group freed, the most recent running container
+// of the group not streamed, skipped or evicted, streamed instead. Keeps no state of containers: streamed ones
+// are open streams of the event loop and running ones taken from the registry of tracked containers, so a slot
+// is taken by opened stream only. Not safe for concurrent use, called by the event loop only.
+type groupCap struct {
+	limits  map[string]int           // max streams by group, groups without limit not capped
+	tracked func() []discovery.Event // up events of running containers, from registry of all docker hosts
+}
+
+// newGroupCap makes groupCap with per-group limits, disabled if limits empty. Tracked can be nil, with nothing
+// streamed in freed slots then.
+func newGroupCap(limits map[string]int, tracked func() []discovery.Event) *groupCap {
+	return &groupCap{limits: limits, tracked: tracked}
+}
+
+// admit checks if started container can be streamed along with streams of its group, returns false if container
+// skipped as over its group's limit, and up event of the container to evict to fit the started one, if any
+func (c *groupCap) admit(event discovery.Event, streams []discovery.Event) (evicted *discovery.Event, ok bool) {
+	limit, found := c.limits[event.Group]
+	if !found || len(streams) < limit {
+		return nil, true
+	}
+
+	var oldest *discovery.Event
+	for i := range streams {
+		if oldest == nil || startTime(streams[i]).Before(startTime(*oldest)) {
+			oldest = &streams[i]
+		}
+	}
+	if oldest == nil || !startTime(*oldest).Before(startTime(event)) {
+		log.Printf("[WARN] group %s streams limit %d reached, container %s skipped", event.Group, limit, event.ContainerName)
+		return nil, false
+	}
+	log.Printf("[WARN] group %s streams limit %d reached, container %s skipped for recently started %s",
+		event.Group, limit, oldest.ContainerName, event.ContainerName)
+	return oldest, true
+}
+
+// resume returns up event of the most recently started running container of group to be streamed in a free slot
+// of the group, if any. Containers accepted by skip, i.e. streamed already, not considered.
+func (c *groupCap) resume(group string, streams []discovery.Event, skip func(containerID string) bool) *discovery.Event {
+	limit, found := c.limits[group]
+	if !found || len(streams) >= limit || c.tracked == nil {
+		return nil
+	}
+	var latest *discovery.Event
+	for _, ev := range c.tracked() {
+		if ev.Group != group || skip(ev.ContainerID) {
+			continue
+		}
+		if latest == nil || startTime(ev).After(startTime(*latest)) {
+			ev := ev
+			latest = &ev
+		}
+	}
+	if latest != nil {
+		log.Printf("[INFO] container %s of group %s streamed in freed slot", latest.ContainerName, group)
+	}
+	return latest
+}
+
+// startTime returns container's start time, event time of live start, creation time of containers
+// found on startup, as the later of both
+func startTime(event discovery.Event) time.Time {
+	if event.Created.After(event.TS) {
+		return event.Created
+	}
+	return event.TS
+}
+
+// parseGroupStreams parses per-group streams limits in "group:N" format
+func parseGroupStreams(specs []string) (map[string]int, error) {
+	res := map[string]int{}
+	for _, spec := range specs {
+		group, val, ok := strings.Cut(spec, ":")
+		if !ok {
+			return nil, errors.Errorf("invalid group streams spec %q, expected group:N", spec)
+		}
+		limit, err := strconv.Atoi(val)
+		if err != nil || limit < 1 {
+			return nil, errors.Errorf("invalid streams limit %q for group %s", val, group)
+		}
+		res[group] = limit
+	}
+	return res, nil
+}
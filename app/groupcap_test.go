@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/docker-logger/app/discovery"
+)
+
+func Test_groupCap(t *testing.T) {
+	t0 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	up := func(id string, started time.Duration) discovery.Event {
+		return discovery.Event{ContainerID: id, ContainerName: "web-" + id, Group: "web", Status: true, TS: t0.Add(started)}
+	}
+	c := newGroupCap(map[string]int{"web": 2}, nil)
+
+	evicted, ok := c.admit(up("id1", 0), nil)
+	assert.True(t, ok)
+	assert.Nil(t, evicted)
+	evicted, ok = c.admit(up("id2", time.Second), []discovery.Event{up("id1", 0)})
+	assert.True(t, ok, "below limit")
+	assert.Nil(t, evicted)
+
+	streams := []discovery.Event{up("id1", 0), up("id2", time.Second)}
+	evicted, ok = c.admit(up("id0", -time.Second), streams)
+	assert.False(t, ok, "older than streamed ones, skipped")
+	assert.Nil(t, evicted)
+	evicted, ok = c.admit(up("id3", 2*time.Second), streams)
+	assert.True(t, ok, "the most recent streamed")
+	require.NotNil(t, evicted)
+	assert.Equal(t, up("id1", 0), *evicted, "the oldest evicted")
+	assert.Len(t, streams, 2, "nothing recorded")
+
+	evicted, ok = c.admit(discovery.Event{ContainerID: "other", Group: "db", Status: true}, streams)
+	assert.True(t, ok, "group without limit not affected")
+	assert.Nil(t, evicted)
+}
+
+func Test_groupCapResume(t *testing.T) {
+	t0 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	up := func(id string, started time.Duration) discovery.Event {
+		return discovery.Event{ContainerID: id, ContainerName: "web-" + id, Group: "web", Status: true, TS: t0.Add(started)}
+	}
+	tracked := []discovery.Event{up("id1", 0), up("id2", time.Second), up("id3", 2*time.Second),
+		{ContainerID: "db1", Group: "db", Status: true, TS: t0.Add(time.Hour)}}
+	c := newGroupCap(map[string]int{"web": 2, "db": 1}, func() []discovery.Event { return tracked })
+	streamedOnly := func(ids ...string) func(string) bool {
+		return func(id string) bool {
+			for _, s := range ids {
+				if s == id {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	res := c.resume("web", []discovery.Event{up("id3", 2*time.Second)}, streamedOnly("id3"))
+	require.NotNil(t, res)
+	assert.Equal(t, up("id2", time.Second), *res, "the most recent not streamed")
+	res = c.resume("web", []discovery.Event{up("id3", 2*time.Second)}, streamedOnly("id3", "id2"))
+	require.NotNil(t, res)
+	assert.Equal(t, "id1", res.ContainerID, "skipped by caller not considered")
+
+	assert.Nil(t, c.resume("web", []discovery.Event{up("id2", time.Second), up("id3", 2*time.Second)},
+		streamedOnly("id2", "id3")), "no free slot")
+	assert.Nil(t, c.resume("web", nil, streamedOnly("id1", "id2", "id3")), "all streamed")
+	assert.Nil(t, c.resume("app", nil, streamedOnly()), "group without limit")
+	assert.Nil(t, newGroupCap(map[string]int{"web": 2}, nil).resume("web", nil, streamedOnly()), "no registry")
+}
+
+func Test_groupCapScan(t *testing.T) {
+	// containers found on startup have creation time only
+	t0 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	c := newGroupCap(map[string]int{"web": 1}, nil)
+	streams := []discovery.Event{{ContainerID: "id1", Group: "web", Status: true, TS: time.Unix(1, 0), Created: t0}}
+	evicted, ok := c.admit(discovery.Event{ContainerID: "id2", Group: "web", Status: true, TS: time.Unix(1, 0),
+		Created: t0.Add(time.Minute)}, streams)
+	assert.True(t, ok, "created later")
+	require.NotNil(t, evicted)
+	assert.Equal(t, "id1", evicted.ContainerID)
+}
+
+func Test_parseGroupStreams(t *testing.T) {
+	res, err := parseGroupStreams([]string{"web:3", "db:1"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"web": 3, "db": 1}, res)
+
+	_, err = parseGroupStreams([]string{"web"})
+	assert.EqualError(t, err, `invalid group streams spec "web", expected group:N`)
+	_, err = parseGroupStreams([]string{"web:0"})
+	assert.EqualError(t, err, `invalid streams limit "0" for group web`)
+	_, err = parseGroupStreams([]string{"web:x"})
+	assert.Error(t, err)
+}
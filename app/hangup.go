@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/docker-logger/app/discovery"
+)
+
+// watchHangup handles SIGHUP until ctx canceled. Filter file reloaded first, if any, then notifiers resynced,
+// so changed filters applied to running containers too, not only to upcoming events.
+func watchHangup(ctx context.Context, sigs <-chan os.Signal, reload func(), notifs []*discovery.EventNotif) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigs:
+			log.Printf("[INFO] hangup signal, resync containers")
+			if reload != nil {
+				reload()
+			}
+			for _, n := range notifs {
+				n.Resync()
+			}
+		}
+	}
+}
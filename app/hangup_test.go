@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/docker-logger/app/discovery"
+)
+
+func Test_watchHangup(t *testing.T) {
+	client := &listClient{containers: []docker.APIContainers{{ID: "id1", Names: []string{"/c1"}}}}
+	notif, err := discovery.NewEventNotif(client, nil, nil, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "id1", (<-notif.Channel()).ContainerID)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigs := make(chan os.Signal, 1)
+	var reloads int
+	go watchHangup(ctx, sigs, func() { reloads++ }, []*discovery.EventNotif{notif})
+
+	client.set([]docker.APIContainers{{ID: "id1", Names: []string{"/c1"}}, {ID: "id2", Names: []string{"/c2"}}})
+	sigs <- syscall.SIGHUP
+	select {
+	case ev := <-notif.Channel():
+		assert.Equal(t, "id2", ev.ContainerID)
+		assert.True(t, ev.Status)
+	case <-time.After(time.Second):
+		t.Fatal("not resynced")
+	}
+	assert.Equal(t, 1, reloads, "filter file reloaded")
+}
+
+// listClient lists set containers, never sends events
+type listClient struct {
+	sync.Mutex
+	containers []docker.APIContainers
+}
+
+func (c *listClient) set(containers []docker.APIContainers) {
+	c.Lock()
+	defer c.Unlock()
+	c.containers = containers
+}
+
+func (c *listClient) ListContainers(docker.ListContainersOptions) ([]docker.APIContainers, error) {
+	c.Lock()
+	defer c.Unlock()
+	return c.containers, nil
+}
+
+func (c *listClient) AddEventListener(chan<- *docker.APIEvents) error { return nil }
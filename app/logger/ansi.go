@@ -0,0 +1,114 @@
+package logger
+
+import (
+	"io"
+	"sync"
+)
+
+// ANSIStripper is a WriteCloser removing ANSI escape sequences, i.e. colors and cursor movements, from
+// lines written to the underlying writer. Handles CSI (ESC [ ... final), OSC (ESC ] ... BEL or ESC \)
+// and other two-byte escapes. Parser state kept across writes, so a sequence split between writes
+// removed as a whole. Newline always ends unterminated sequence, a broken one can't swallow following lines.
+type ANSIStripper struct {
+	wr io.WriteCloser
+
+	lock  sync.Mutex
+	state ansiState
+	out   []byte
+}
+
+type ansiState int
+
+const (
+	ansiText   ansiState = iota // plain text
+	ansiEsc                     // ESC seen
+	ansiCSI                     // inside ESC [ sequence
+	ansiOSC                     // inside ESC ] sequence
+	ansiOSCEsc                  // ESC seen inside OSC, might be ST terminator
+	ansiInter                   // ESC followed by intermediate bytes, i.e. charset selection
+)
+
+const escByte = 0x1b
+
+// NewANSIStripper makes ANSIStripper for the writer
+func NewANSIStripper(wr io.WriteCloser) *ANSIStripper {
+	return &ANSIStripper{wr: wr}
+}
+
+// Write removes escape sequences from p and writes the rest
+func (s *ANSIStripper) Write(p []byte) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.out = s.out[:0]
+	for _, b := range p {
+		if b == '\n' {
+			s.state = ansiText
+			s.out = append(s.out, b)
+			continue
+		}
+		switch s.state {
+		case ansiText:
+			if b == escByte {
+				s.state = ansiEsc
+				continue
+			}
+			s.out = append(s.out, b)
+		case ansiEsc:
+			switch {
+			case b == '[':
+				s.state = ansiCSI
+			case b == ']':
+				s.state = ansiOSC
+			case b == escByte:
+				// repeated ESC, stay
+			case b >= 0x20 && b <= 0x2f:
+				s.state = ansiInter
+			default:
+				s.state = ansiText // two-byte escape done, or invalid one dropped
+			}
+		case ansiCSI:
+			switch {
+			case b == escByte:
+				s.state = ansiEsc // broken sequence followed by a new one
+			case b < 0x20 || b > 0x3f: // parameter and intermediate bytes continue the sequence
+				s.state = ansiText // final byte, or invalid one ending the sequence
+			}
+		case ansiOSC:
+			switch b {
+			case 0x07:
+				s.state = ansiText
+			case escByte:
+				s.state = ansiOSCEsc
+			}
+		case ansiOSCEsc:
+			if b == '\\' {
+				s.state = ansiText
+				continue
+			}
+			if b != escByte {
+				s.state = ansiOSC
+			}
+		case ansiInter:
+			switch {
+			case b == escByte:
+				s.state = ansiEsc
+			case b < 0x20 || b > 0x2f:
+				s.state = ansiText
+			}
+		}
+	}
+
+	if len(s.out) == 0 {
+		return len(p), nil
+	}
+	if _, err := s.wr.Write(s.out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the underlying writer
+func (s *ANSIStripper) Close() error {
+	return s.wr.Close()
+}
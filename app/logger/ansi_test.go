@@ -0,0 +1,61 @@
+package logger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestANSIStripper_Write(t *testing.T) {
+	tbl := []struct {
+		name, inp, out string
+	}{
+		{"plain", "just a line\n", "just a line\n"},
+		{"colors", "\x1b[32mINFO\x1b[0m server started\n", "INFO server started\n"},
+		{"bold and 256 colors", "\x1b[1;38;5;196mERROR\x1b[m failed\n", "ERROR failed\n"},
+		{"true color", "\x1b[38;2;255;100;0mwarn\x1b[39m\n", "warn\n"},
+		{"cursor and erase", "\x1b[2K\x1b[1Gprogress 50%\n", "progress 50%\n"},
+		{"osc title with bel", "\x1b]0;my title\x07text\n", "text\n"},
+		{"osc hyperlink with st", "\x1b]8;;http://example.com\x1b\\link\x1b]8;;\x1b\\ end\n", "link end\n"},
+		{"charset selection", "\x1b(Bascii\n", "ascii\n"},
+		{"two-byte escape", "\x1bMup\n", "up\n"},
+		{"unterminated ends on newline", "\x1b[31broken\nnext\n", "roken\nnext\n"},
+		{"unterminated osc ends on newline", "\x1b]0;title\nnext\n", "\nnext\n"},
+		{"utf8 kept", "\x1b[36mпривет\x1b[0m 世界\n", "привет 世界\n"},
+		{"multiple lines", "\x1b[31ma\x1b[0m\n\x1b[32mb\x1b[0m\n", "a\nb\n"},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			wr := &wrMock{}
+			s := NewANSIStripper(wr)
+			n, err := s.Write([]byte(tt.inp))
+			require.NoError(t, err)
+			assert.Equal(t, len(tt.inp), n)
+			assert.Equal(t, tt.out, wr.String())
+		})
+	}
+}
+
+func TestANSIStripper_SplitWrites(t *testing.T) {
+	inp := "\x1b[1;31mERROR\x1b[0m db \x1b]8;;http://x\x1b\\down\x1b]8;;\x1b\\\n\x1b[32mok\x1b[0m\n"
+	for size := 1; size <= 5; size++ {
+		wr := &wrMock{}
+		s := NewANSIStripper(wr)
+		for i := 0; i < len(inp); i += size {
+			_, err := s.Write([]byte(inp[i:min(i+size, len(inp))]))
+			require.NoError(t, err)
+		}
+		assert.Equal(t, "ERROR db down\nok\n", wr.String(), "written by %d bytes", size)
+	}
+}
+
+func TestANSIStripper_OnlyEscapes(t *testing.T) {
+	wr := &writesMock{}
+	s := NewANSIStripper(wr)
+	_, err := s.Write([]byte("\x1b[0m"))
+	require.NoError(t, err)
+	assert.Empty(t, wr.writes, "nothing to write")
+	require.NoError(t, s.Close())
+	assert.True(t, wr.closed)
+}
@@ -0,0 +1,231 @@
+package logger
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+)
+
+// DiskBudget bounds total size of log files in directories, removing the oldest rotated files of all containers
+// once the sum exceeded the limit. Active files never removed, so usage may stay above the limit if they alone
+// exceed it. Checked every interval and once writes made through Writer reached CheckAfter bytes, i.e. a rotation
+// may have happened. Usage reported to log every hour while running. Safe for concurrent use.
+type DiskBudget struct {
+	params  DiskBudgetParams
+	written atomic.Int64
+	trigger chan struct{}
+	report  time.Duration // interval of usage reports
+
+	lock  sync.Mutex // protects stats and serializes checks
+	stats DiskStats
+}
+
+// DiskBudgetParams defines directories and limits for NewDiskBudget
+type DiskBudgetParams struct {
+	Dirs       []string      // directories of log files, walked recursively
+	Limit      int64         // max total size of files in bytes
+	Interval   time.Duration // interval of periodic checks
+	CheckAfter int64         // bytes written through Writer triggering a check, disabled if 0
+}
+
+// DiskStats is a disk usage reported by DiskBudget.Stats, as of the last check
+type DiskStats struct {
+	Usage     int64     `json:"usage"`      // total size of files in bytes
+	Limit     int64     `json:"limit"`      // max total size in bytes
+	Files     int       `json:"files"`      // number of files
+	Removed   int       `json:"removed"`    // rotated files removed since start
+	Freed     int64     `json:"freed"`      // bytes freed since start
+	LastCheck time.Time `json:"last_check"` // time of the last check, zero if not checked yet
+}
+
+// budgetReportInterval is interval of disk usage reports logged by Run
+const budgetReportInterval = time.Hour
+
+// rotatedFile matches names of files rotated by lumberjack, i.e. web-2024-05-01T10-00-00.000.log.gz
+var rotatedFile = regexp.MustCompile(`-\d{4}-\d{2}-\d{2}T\d{2}-\d{2}-\d{2}\.\d{3}(\.[^.]+)?(\.gz)?$`)
+
+// NewDiskBudget makes DiskBudget for params, checks not started until Run called
+func NewDiskBudget(params DiskBudgetParams) *DiskBudget {
+	return &DiskBudget{params: params, trigger: make(chan struct{}, 1), report: budgetReportInterval,
+		stats: DiskStats{Limit: params.Limit}}
+}
+
+// Run checks usage on start, every interval and on triggers from Writer, till ctx canceled.
+// Stats of the last check logged every report interval.
+func (b *DiskBudget) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.params.Interval)
+	defer ticker.Stop()
+	report := time.NewTicker(b.report)
+	defer report.Stop()
+	for {
+		if err := b.Check(); err != nil {
+			log.Printf("[WARN] disk budget check failed, %v", err)
+		}
+		if !b.wait(ctx, ticker.C, report.C) {
+			return
+		}
+	}
+}
+
+// wait blocks till the next check due, logging stats on each report tick. Returns false once ctx canceled.
+func (b *DiskBudget) wait(ctx context.Context, checks, reports <-chan time.Time) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-checks:
+			return true
+		case <-b.trigger:
+			return true
+		case <-reports:
+			st := b.Stats()
+			log.Printf("[INFO] disk usage %d of %d in %d files, %d rotated files removed, %d bytes freed since start",
+				st.Usage, st.Limit, st.Files, st.Removed, st.Freed)
+		}
+	}
+}
+
+// Check sums size of files in directories and removes the oldest rotated files until the total within the limit
+func (b *DiskBudget) Check() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	files, usage, err := b.scan()
+	if err != nil {
+		return err
+	}
+	total := len(files)
+	var removed int
+	var freed int64
+	var errs error
+	for _, f := range files {
+		if usage <= b.params.Limit {
+			break
+		}
+		if !f.rotated {
+			continue
+		}
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			errs = multierror.Append(errs, errors.Wrapf(err, "can't remove %s", f.path))
+			continue
+		}
+		usage -= f.size
+		freed += f.size
+		removed++
+		total--
+	}
+
+	b.stats.Usage, b.stats.Files, b.stats.LastCheck = usage, total, time.Now()
+	b.stats.Removed += removed
+	b.stats.Freed += freed
+	if removed > 0 {
+		log.Printf("[INFO] disk budget removed %d rotated files, %d bytes, usage %d of %d", removed, freed,
+			usage, b.params.Limit)
+	}
+	if usage > b.params.Limit {
+		log.Printf("[WARN] disk usage %d above limit %d, no rotated files left to remove", usage, b.params.Limit)
+	}
+	return errs
+}
+
+// Stats returns disk usage as of the last check
+func (b *DiskBudget) Stats() DiskStats {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.stats
+}
+
+// Writer wraps log file writer, counting written bytes to trigger a check once CheckAfter reached
+func (b *DiskBudget) Writer(wr io.WriteCloser) io.WriteCloser {
+	if b.params.CheckAfter <= 0 {
+		return wr
+	}
+	return &budgetWriter{WriteCloser: wr, budget: b}
+}
+
+// wrote counts n bytes written, triggering a pending check if CheckAfter reached
+func (b *DiskBudget) wrote(n int) {
+	if b.written.Add(int64(n)) < b.params.CheckAfter {
+		return
+	}
+	b.written.Store(0)
+	select {
+	case b.trigger <- struct{}{}:
+	default: // check pending already
+	}
+}
+
+// diskFile is a file found by scan
+type diskFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+	rotated bool
+}
+
+// scan returns files of all directories, oldest first, and their total size. Nested or repeated directories
+// counted once. Directories not made yet skipped.
+func (b *DiskBudget) scan() (files []diskFile, usage int64, err error) {
+	seen := map[string]bool{}
+	for _, dir := range b.params.Dirs {
+		walkErr := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if d.IsDir() || !d.Type().IsRegular() {
+				return nil
+			}
+			abs, err := filepath.Abs(path)
+			if err != nil {
+				return err
+			}
+			if seen[abs] {
+				return nil
+			}
+			seen[abs] = true
+			info, err := d.Info()
+			if err != nil {
+				if os.IsNotExist(err) { // removed by rotation meanwhile
+					return nil
+				}
+				return err
+			}
+			files = append(files, diskFile{path: path, size: info.Size(), modTime: info.ModTime(),
+				rotated: rotatedFile.MatchString(d.Name())})
+			usage += info.Size()
+			return nil
+		})
+		if walkErr != nil {
+			return nil, 0, errors.Wrapf(walkErr, "can't scan %s", dir)
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	return files, usage, nil
+}
+
+// budgetWriter passes writes to the underlying writer, counting written bytes for DiskBudget
+type budgetWriter struct {
+	io.WriteCloser
+	budget *DiskBudget
+}
+
+// Write writes p and counts bytes written
+func (w *budgetWriter) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	w.budget.wrote(n)
+	return n, err
+}
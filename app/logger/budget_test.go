@@ -0,0 +1,137 @@
+package logger
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskBudgetCheck(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	files := []struct {
+		name string
+		size int
+		age  time.Duration
+	}{
+		{name: "web.log", size: 300, age: 0},
+		{name: "web-2024-05-01T10-00-00.000.log.gz", size: 200, age: 3 * time.Hour},
+		{name: "web-2024-05-01T11-00-00.000.log.gz", size: 200, age: time.Hour},
+		{name: "host1/db.err", size: 100, age: 4 * time.Hour},
+		{name: "host1/db-2024-05-01T09-00-00.000.err", size: 200, age: 2 * time.Hour},
+	}
+	for _, f := range files {
+		path := filepath.Join(dir, f.name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o750))
+		require.NoError(t, os.WriteFile(path, []byte(strings.Repeat("x", f.size)), 0o600))
+		require.NoError(t, os.Chtimes(path, now.Add(-f.age), now.Add(-f.age)))
+	}
+
+	b := NewDiskBudget(DiskBudgetParams{Dirs: []string{dir, dir}, Limit: 700, Interval: time.Minute})
+	assert.Equal(t, DiskStats{Limit: 700}, b.Stats(), "not checked yet")
+	require.NoError(t, b.Check())
+
+	// oldest rotated removed, active db.err kept despite being the oldest
+	assert.NoFileExists(t, filepath.Join(dir, "web-2024-05-01T10-00-00.000.log.gz"))
+	assert.NoFileExists(t, filepath.Join(dir, "host1/db-2024-05-01T09-00-00.000.err"))
+	assert.FileExists(t, filepath.Join(dir, "web-2024-05-01T11-00-00.000.log.gz"))
+	assert.FileExists(t, filepath.Join(dir, "host1/db.err"))
+	assert.FileExists(t, filepath.Join(dir, "web.log"))
+
+	st := b.Stats()
+	assert.Equal(t, int64(600), st.Usage, "repeated dir counted once")
+	assert.Equal(t, 3, st.Files)
+	assert.Equal(t, 2, st.Removed)
+	assert.Equal(t, int64(400), st.Freed)
+	assert.WithinDuration(t, time.Now(), st.LastCheck, time.Second)
+
+	// active files alone above limit, rotated removed and usage left over
+	b = NewDiskBudget(DiskBudgetParams{Dirs: []string{dir}, Limit: 100, Interval: time.Minute})
+	require.NoError(t, b.Check())
+	st = b.Stats()
+	assert.Equal(t, int64(400), st.Usage)
+	assert.Equal(t, 1, st.Removed)
+	assert.NoFileExists(t, filepath.Join(dir, "web-2024-05-01T11-00-00.000.log.gz"))
+	assert.FileExists(t, filepath.Join(dir, "host1/db.err"))
+	assert.FileExists(t, filepath.Join(dir, "web.log"))
+}
+
+func TestDiskBudgetMissingDir(t *testing.T) {
+	b := NewDiskBudget(DiskBudgetParams{Dirs: []string{filepath.Join(t.TempDir(), "missing")}, Limit: 10,
+		Interval: time.Minute})
+	require.NoError(t, b.Check())
+	assert.Equal(t, int64(0), b.Stats().Usage)
+}
+
+func TestDiskBudgetWriterTriggers(t *testing.T) {
+	dir := t.TempDir()
+	rotated := filepath.Join(dir, "web-2024-05-01T10-00-00.000.log.gz")
+	b := NewDiskBudget(DiskBudgetParams{Dirs: []string{dir}, Limit: 50, Interval: time.Hour, CheckAfter: 100})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		b.Run(ctx)
+		close(done)
+	}()
+	require.Eventually(t, func() bool { return !b.Stats().LastCheck.IsZero() }, time.Second, 5*time.Millisecond,
+		"checked on start")
+
+	require.NoError(t, os.WriteFile(rotated, []byte(strings.Repeat("x", 60)), 0o600))
+	wr := b.Writer(&nopWriteCloser{})
+	_, err := wr.Write([]byte(strings.Repeat("x", 60)))
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	assert.FileExists(t, rotated, "no check before CheckAfter written")
+
+	_, err = wr.Write([]byte(strings.Repeat("x", 60)))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return b.Stats().Removed == 1 }, time.Second, 5*time.Millisecond)
+	assert.NoFileExists(t, rotated)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("not stopped")
+	}
+}
+
+func TestDiskBudgetReport(t *testing.T) {
+	out := &lockedBuffer{}
+	log.Setup(log.Out(out))
+	t.Cleanup(func() { log.Setup(log.Out(os.Stdout)) })
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "web.log"), []byte(strings.Repeat("x", 30)), 0o600))
+	b := NewDiskBudget(DiskBudgetParams{Dirs: []string{dir}, Limit: 50, Interval: time.Hour})
+	b.report = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Run(ctx)
+	require.Eventually(t, func() bool {
+		return strings.Contains(out.String(), "disk usage 30 of 50 in 1 files, 0 rotated files removed, 0 bytes freed")
+	}, time.Second, 5*time.Millisecond, "stats of the last check reported")
+	checked := b.Stats().LastCheck
+	require.Eventually(t, func() bool { return strings.Count(out.String(), "disk usage 30 of 50") >= 3 },
+		time.Second, 5*time.Millisecond)
+	assert.Equal(t, checked, b.Stats().LastCheck, "reports don't trigger checks")
+}
+
+func TestDiskBudgetWriterDisabled(t *testing.T) {
+	wr := &nopWriteCloser{}
+	b := NewDiskBudget(DiskBudgetParams{Limit: 10, Interval: time.Minute})
+	assert.Same(t, wr, b.Writer(wr), "no wrapper without CheckAfter")
+}
+
+type nopWriteCloser struct{}
+
+func (nopWriteCloser) Write(p []byte) (int, error) { return len(p), nil }
+func (nopWriteCloser) Close() error                { return nil }
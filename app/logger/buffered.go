@@ -0,0 +1,111 @@
+package logger
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// BufferedWriter is a WriteCloser collecting writes in memory up to Size bytes before passing them to the underlying
+// writer, to reduce number of small writes. Buffer also flushed every flush interval, so lines written downstream
+// in a bounded time even for low-volume containers. Writes never split between flushes, so a rotating writer
+// gets whole lines. Flush and writes serialized, safe for concurrent use.
+type BufferedWriter struct {
+	wr   io.WriteCloser
+	size int
+
+	lock   sync.Mutex
+	buf    bytes.Buffer
+	err    error // last error of background flush, returned by the next write
+	done   chan struct{}
+	closed bool
+}
+
+// NewBufferedWriter makes BufferedWriter for the writer, flushed every interval. Zero interval disables
+// periodic flush, buffer flushed when full and on close only.
+func NewBufferedWriter(wr io.WriteCloser, size int, interval time.Duration) *BufferedWriter {
+	res := &BufferedWriter{wr: wr, size: size, done: make(chan struct{})}
+	if interval > 0 {
+		go res.flushEvery(interval)
+	}
+	return res
+}
+
+// Write buffers p, flushing pending data first if p doesn't fit. Writes larger than the buffer passed as is.
+func (b *BufferedWriter) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.err != nil {
+		err := b.err
+		b.err = nil
+		return 0, err
+	}
+	if b.buf.Len()+len(p) > b.size {
+		if err := b.flush(); err != nil {
+			return 0, err
+		}
+	}
+	if len(p) >= b.size {
+		return b.wr.Write(p)
+	}
+	return b.buf.Write(p)
+}
+
+// Flush writes buffered data to the underlying writer
+func (b *BufferedWriter) Flush() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.flush()
+}
+
+// Close flushes buffered data, stops periodic flush and closes the underlying writer
+func (b *BufferedWriter) Close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	close(b.done)
+
+	errs := new(multierror.Error)
+	if err := b.flush(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	if err := b.wr.Close(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	return errs.ErrorOrNil()
+}
+
+// flush writes buffer to the underlying writer, should be called with lock held
+func (b *BufferedWriter) flush() error {
+	if b.buf.Len() == 0 {
+		return nil
+	}
+	_, err := b.wr.Write(b.buf.Bytes())
+	b.buf.Reset()
+	return err
+}
+
+// flushEvery flushes buffer on each interval until closed
+func (b *BufferedWriter) flushEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+			b.lock.Lock()
+			if err := b.flush(); err != nil {
+				b.err = err
+			}
+			b.lock.Unlock()
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package logger
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBufferedWriter(t *testing.T) {
+	wr := &lockedWritesMock{}
+	b := NewBufferedWriter(wr, 16, 0)
+
+	_, err := b.Write([]byte("line 1\n"))
+	require.NoError(t, err)
+	_, err = b.Write([]byte("line 2\n"))
+	require.NoError(t, err)
+	assert.Empty(t, wr.get(), "buffered")
+
+	_, err = b.Write([]byte("line 3\n")) // doesn't fit, pending flushed first
+	require.NoError(t, err)
+	assert.Equal(t, []string{"line 1\nline 2\n"}, wr.get())
+
+	_, err = b.Write([]byte("long line, over the buffer\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"line 1\nline 2\n", "line 3\n", "long line, over the buffer\n"}, wr.get(), "passed as is")
+
+	_, err = b.Write([]byte("line 4\n"))
+	require.NoError(t, err)
+	require.NoError(t, b.Flush())
+	assert.Equal(t, "line 4\n", wr.get()[3])
+
+	_, err = b.Write([]byte("line 5\n"))
+	require.NoError(t, err)
+	require.NoError(t, b.Close())
+	assert.Equal(t, "line 5\n", wr.get()[4], "flushed on close")
+	assert.True(t, wr.isClosed())
+	assert.NoError(t, b.Close(), "second close ignored")
+}
+
+func TestBufferedWriterInterval(t *testing.T) {
+	wr := &lockedWritesMock{}
+	b := NewBufferedWriter(wr, 1024, 20*time.Millisecond)
+	_, err := b.Write([]byte("line 1\n"))
+	require.NoError(t, err)
+	assert.Empty(t, wr.get())
+	assert.Eventually(t, func() bool { return len(wr.get()) == 1 }, time.Second, 5*time.Millisecond, "flushed by interval")
+	assert.Equal(t, []string{"line 1\n"}, wr.get())
+	require.NoError(t, b.Close())
+}
+
+func TestBufferedWriterErrors(t *testing.T) {
+	wr := &lockedWritesMock{}
+	b := NewBufferedWriter(wr, 8, 10*time.Millisecond)
+	wr.setErr(errors.New("write failed"))
+	_, err := b.Write([]byte("line\n"))
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	_, err = b.Write([]byte("line\n"))
+	assert.EqualError(t, err, "write failed", "background flush error reported")
+
+	wr.setErr(nil)
+	_, err = b.Write([]byte("line\n"))
+	assert.NoError(t, err)
+	require.NoError(t, b.Close())
+	assert.Equal(t, []string{"line\n"}, wr.get())
+}
+
+// lockedWritesMock is writesMock safe for background flushes
+type lockedWritesMock struct {
+	lock sync.Mutex
+	m    writesMock
+}
+
+func (l *lockedWritesMock) Write(p []byte) (int, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.m.Write(p)
+}
+
+func (l *lockedWritesMock) Close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.m.Close()
+}
+
+func (l *lockedWritesMock) get() []string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return append([]string{}, l.m.writes...)
+}
+
+func (l *lockedWritesMock) isClosed() bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.m.closed
+}
+
+func (l *lockedWritesMock) setErr(err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.m.err = err
+}
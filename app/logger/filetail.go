@@ -0,0 +1,138 @@
+package logger
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	log "github.com/go-pkgz/lgr"
+)
+
+// ContainerInspector inspects container, implemented by *docker.Client
+type ContainerInspector interface {
+	InspectContainerWithOptions(opts docker.InspectContainerOptions) (*docker.Container, error)
+}
+
+// jsonFileRecord is a single line of json-file logging driver
+type jsonFileRecord struct {
+	Log    string    `json:"log"`
+	Stream string    `json:"stream"`
+	Time   time.Time `json:"time"`
+}
+
+// tailPollInterval is how often log file checked for new records
+const tailPollInterval = 250 * time.Millisecond
+
+// jsonLogPath returns container's log file path if container uses json-file logging driver, empty string otherwise
+func (l *LogStreamer) jsonLogPath() string {
+	inspector, ok := l.DockerClient.(ContainerInspector)
+	if !ok {
+		log.Printf("[WARN] docker client can't inspect containers, use api streaming for %s", l.ContainerName)
+		return ""
+	}
+	c, err := inspector.InspectContainerWithOptions(docker.InspectContainerOptions{ID: l.ContainerID, Context: l.ctx})
+	if err != nil {
+		log.Printf("[WARN] can't inspect %s, use api streaming, %v", l.ContainerName, err)
+		return ""
+	}
+	if c.HostConfig == nil || c.HostConfig.LogConfig.Type != "json-file" || c.LogPath == "" {
+		log.Printf("[DEBUG] no json-file log for %s, use api streaming", l.ContainerName)
+		return ""
+	}
+	return c.LogPath
+}
+
+// tailFile follows json-file log from its current end until streamer closed. Reopens the file if rotated by docker.
+func (l *LogStreamer) tailFile(logPath string) {
+	log.Printf("[INFO] tail log file %s for %s", logPath, l.ContainerName)
+	fh, err := os.Open(logPath) //nolint:gosec // path from docker inspect
+	if err != nil {
+		log.Printf("[WARN] can't open log file %s, %v", logPath, err)
+		return
+	}
+	defer func() { _ = fh.Close() }()
+	if _, err = fh.Seek(0, io.SeekEnd); err != nil {
+		log.Printf("[WARN] can't seek log file %s, %v", logPath, err)
+		return
+	}
+
+	rd := bufio.NewReader(fh)
+	var partial []byte
+	ticker := time.NewTicker(tailPollInterval)
+	defer ticker.Stop()
+	for {
+		partial = l.readRecords(rd, partial)
+
+		select {
+		case <-l.ctx.Done():
+			l.readRecords(rd, partial) // drain whatever written before close
+			log.Printf("[INFO] tail of %s terminated", logPath)
+			return
+		case <-ticker.C:
+		}
+
+		if rotated(fh, logPath) {
+			l.readRecords(rd, partial) // finish the old file
+			partial = nil
+			nfh, err := os.Open(logPath) //nolint:gosec // path from docker inspect
+			if err != nil {
+				continue // not created yet, retry on next tick
+			}
+			_ = fh.Close()
+			fh = nfh
+			rd.Reset(fh)
+			log.Printf("[DEBUG] log file %s rotated, reopened", logPath)
+		}
+	}
+}
+
+// readRecords reads all complete lines available, writes them to stream's writers and returns incomplete tail
+func (l *LogStreamer) readRecords(rd *bufio.Reader, partial []byte) []byte {
+	for {
+		line, err := rd.ReadBytes('\n')
+		partial = append(partial, line...)
+		if err != nil {
+			return partial // io.EOF, the rest not written yet
+		}
+		l.writeRecord(partial)
+		partial = nil
+	}
+}
+
+// writeRecord parses json-file record and writes its log to stdout or stderr writer, if its stream selected
+func (l *LogStreamer) writeRecord(line []byte) {
+	rec := jsonFileRecord{}
+	if err := json.Unmarshal(line, &rec); err != nil {
+		log.Printf("[WARN] can't parse log record of %s, %v", l.ContainerName, err)
+		return
+	}
+	wr, selected, lt := l.LogWriter, l.Streams.stdout(), l.LineTime
+	if rec.Stream == "stderr" {
+		wr, selected, lt = l.ErrWriter, l.Streams.stderr(), l.ErrLineTime
+	}
+	if !selected {
+		return
+	}
+	if lt != nil {
+		lt.set(rec.Time)
+	}
+	if _, err := wr.Write([]byte(rec.Log)); err != nil {
+		log.Printf("[WARN] can't write log of %s, %v", l.ContainerName, err)
+	}
+}
+
+// rotated checks if file at logPath is not the one opened as fh anymore
+func rotated(fh *os.File, logPath string) bool {
+	opened, err := fh.Stat()
+	if err != nil {
+		return true
+	}
+	current, err := os.Stat(logPath)
+	if err != nil {
+		return true
+	}
+	return !os.SameFile(opened, current)
+}
@@ -0,0 +1,84 @@
+package logger
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockInspectLogClient struct {
+	driver  string
+	logPath string
+	logs    int
+}
+
+func (m *mockInspectLogClient) Logs(opts docker.LogsOptions) error {
+	m.logs++
+	<-opts.Context.Done()
+	return nil
+}
+
+func (m *mockInspectLogClient) InspectContainerWithOptions(docker.InspectContainerOptions) (*docker.Container, error) {
+	return &docker.Container{LogPath: m.logPath, HostConfig: &docker.HostConfig{LogConfig: docker.LogConfig{Type: m.driver}}}, nil
+}
+
+func TestLogger_TailFiles(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "c1-json.log")
+	require.NoError(t, os.WriteFile(logPath, []byte(`{"log":"old line\n","stream":"stdout","time":"2024-05-01T10:00:00Z"}`+"\n"), 0o600))
+
+	mock := &mockInspectLogClient{driver: "json-file", logPath: logPath}
+	lw, ew := &wrMock{}, &wrMock{}
+	l := &LogStreamer{ContainerID: "test_id", ContainerName: "test_name", DockerClient: mock,
+		LogWriter: lw, ErrWriter: ew, TailFiles: true, FinalFetch: true}
+	l = l.Go(context.Background())
+	time.Sleep(50 * time.Millisecond)
+
+	fh, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0o600) //nolint:gosec // test file
+	require.NoError(t, err)
+	_, err = fh.WriteString(`{"log":"line 1\n","stream":"stdout","time":"2024-05-01T10:00:01Z"}` + "\n")
+	require.NoError(t, err)
+	_, err = fh.WriteString(`{"log":"err 1\n","stream":"stderr","time":"2024-05-01T10:00:02Z"}` + "\n" + `{"log":"line`)
+	require.NoError(t, err)
+	time.Sleep(2 * tailPollInterval)
+	_, err = fh.WriteString(` 2\n","stream":"stdout","time":"2024-05-01T10:00:03Z"}` + "\n")
+	require.NoError(t, err)
+	require.NoError(t, fh.Close())
+	time.Sleep(2 * tailPollInterval)
+
+	// rotate the way docker does, rename and start a new file
+	require.NoError(t, os.Rename(logPath, logPath+".1"))
+	require.NoError(t, os.WriteFile(logPath, []byte(`{"log":"line 3\n","stream":"stdout","time":"2024-05-01T10:00:04Z"}`+"\n"), 0o600))
+	time.Sleep(3 * tailPollInterval)
+	l.Close()
+
+	assert.Equal(t, "line 1\nline 2\nline 3\n", lw.String())
+	assert.Equal(t, "err 1\n", ew.String())
+	assert.Equal(t, 0, mock.logs, "api streaming not used")
+}
+
+func TestLogger_writeRecordLineTime(t *testing.T) {
+	lt, elt := &LineTime{}, &LineTime{}
+	l := &LogStreamer{ContainerName: "test_name", LogWriter: &wrMock{}, ErrWriter: &wrMock{}, LineTime: lt, ErrLineTime: elt}
+	l.writeRecord([]byte(`{"log":"line 1\n","stream":"stdout","time":"2024-05-01T10:00:01.5Z"}`))
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 0, 1, 500000000, time.UTC), lt.Get(), "record's time")
+	assert.True(t, elt.Get().IsZero(), "stderr line time not touched")
+	l.writeRecord([]byte(`{"log":"err 1\n","stream":"stderr","time":"2024-05-01T10:00:02Z"}`))
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 0, 2, 0, time.UTC), elt.Get())
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 0, 1, 500000000, time.UTC), lt.Get(), "stdout line time kept")
+}
+
+func TestLogger_TailFilesFallback(t *testing.T) {
+	mock := &mockInspectLogClient{driver: "journald"}
+	l := &LogStreamer{ContainerID: "test_id", ContainerName: "test_name", DockerClient: mock,
+		LogWriter: &wrMock{}, ErrWriter: &wrMock{}, TailFiles: true}
+	l = l.Go(context.Background())
+	time.Sleep(50 * time.Millisecond)
+	l.Close()
+	assert.Equal(t, 1, mock.logs, "api streaming used")
+}
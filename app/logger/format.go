@@ -0,0 +1,81 @@
+package logger
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format is an output format of log lines
+type Format int
+
+// enum of all formats
+const (
+	FormatUnknown Format = iota // format not set
+	FormatRaw                   // lines as is
+	FormatJSON                  // json envelope with container, group, ts and host
+	FormatLogfmt                // logfmt record with the same fields as json envelope
+)
+
+// String returns format name
+func (f Format) String() string {
+	switch f {
+	case FormatRaw:
+		return "raw"
+	case FormatJSON:
+		return "json"
+	case FormatLogfmt:
+		return "logfmt"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseFormat makes format from its name, case-insensitive. Returns FormatUnknown for unknown names.
+func ParseFormat(name string) Format {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "raw":
+		return FormatRaw
+	case "json":
+		return FormatJSON
+	case "logfmt":
+		return FormatLogfmt
+	default:
+		return FormatUnknown
+	}
+}
+
+// logfmt makes logfmt record of the line, with trailing newline
+func (w *MultiWriter) logfmt(p []byte) []byte {
+	res := make([]byte, 0, len(p)+128)
+	ts, dockerTime, ingestTime := w.times()
+	res = append(res, "ts="...)
+	res = ts.AppendFormat(res, time.RFC3339Nano)
+	for _, kv := range [][2]string{{"host", w.hostname}, {"container", w.container}, {"group", w.group}} {
+		res = append(append(append(res, ' '), kv[0]...), '=')
+		res = appendLogfmtValue(res, kv[1])
+	}
+	if id := w.lineTraceID(p); id != "" {
+		res = appendLogfmtValue(append(res, " trace_id="...), id)
+	}
+	for _, kv := range []struct {
+		key string
+		ts  *time.Time
+	}{{"docker_time", dockerTime}, {"ingest_time", ingestTime}} {
+		if kv.ts != nil {
+			res = kv.ts.AppendFormat(append(res, " "+kv.key+"="...), time.RFC3339Nano)
+		}
+	}
+	res = appendLogfmtValue(append(res, " msg="...), strings.TrimRight(string(p), "\r\n"))
+	return append(res, '\n')
+}
+
+// appendLogfmtValue appends value, quoted if empty or has spaces, quotes, '=' or non-printable characters
+func appendLogfmtValue(dst []byte, val string) []byte {
+	if val != "" && !strings.ContainsFunc(val, func(r rune) bool {
+		return r <= ' ' || r == '=' || r == '"' || r == '\\' || !strconv.IsPrint(r)
+	}) {
+		return append(dst, val...)
+	}
+	return strconv.AppendQuote(dst, val)
+}
@@ -0,0 +1,64 @@
+package logger
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFormat(t *testing.T) {
+	tbl := []struct {
+		name string
+		res  Format
+	}{
+		{"raw", FormatRaw}, {"json", FormatJSON}, {"logfmt", FormatLogfmt}, {" JSON ", FormatJSON},
+		{"", FormatUnknown}, {"yaml", FormatUnknown},
+	}
+	for _, tt := range tbl {
+		assert.Equal(t, tt.res, ParseFormat(tt.name), tt.name)
+	}
+	for _, f := range []Format{FormatRaw, FormatJSON, FormatLogfmt} {
+		assert.Equal(t, f, ParseFormat(f.String()))
+	}
+	assert.Equal(t, "unknown", FormatUnknown.String())
+}
+
+func TestMultiWriter_WithFormat(t *testing.T) {
+	wr := wrMock{}
+	writer := NewMultiWriterIgnoreErrors(&wr).WithFormat(FormatLogfmt, "c1", "g1").WithHostname("src1")
+	n, err := writer.Write([]byte("started at :8080\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 17, n)
+	assert.Regexp(t, regexp.MustCompile(`^ts=\S+ host=src1 container=c1 group=g1 msg="started at :8080"\n$`), wr.String())
+
+	wr.Reset()
+	writer = NewMultiWriterIgnoreErrors(&wr).WithFormat(FormatRaw, "c1", "g1")
+	_, err = writer.Write([]byte("line\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "line\n", wr.String())
+
+	wr.Reset()
+	writer = NewMultiWriterIgnoreErrors(&wr).WithFormat(FormatJSON, "c1", "g1")
+	_, err = writer.Write([]byte("line"))
+	require.NoError(t, err)
+	assert.Contains(t, wr.String(), `{"msg":"line","container":"c1","group":"g1"`)
+}
+
+func TestAppendLogfmtValue(t *testing.T) {
+	tbl := []struct {
+		inp, out string
+	}{
+		{"plain", "plain"},
+		{"", `""`},
+		{"with space", `"with space"`},
+		{"k=v", `"k=v"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{"tab\there", `"tab\there"`},
+		{"юникод", "юникод"},
+	}
+	for _, tt := range tbl {
+		assert.Equal(t, tt.out, string(appendLogfmtValue(nil, tt.inp)), tt.inp)
+	}
+}
@@ -0,0 +1,61 @@
+package logger
+
+import (
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	log "github.com/go-pkgz/lgr"
+)
+
+// waitHealthy waits for container with healthcheck to become healthy, up to WaitHealthy.
+// Sets since to the passed check if waited. Returns false if container should be skipped.
+func (l *LogStreamer) waitHealthy() bool {
+	inspector, ok := l.DockerClient.(ContainerInspector)
+	if !ok {
+		log.Printf("[WARN] docker client can't inspect containers, no health wait for %s", l.ContainerName)
+		return true
+	}
+	poll := l.healthPoll
+	if poll <= 0 {
+		poll = time.Second
+	}
+	deadline := time.After(l.WaitHealthy)
+	for waited := false; ; waited = true {
+		c, err := inspector.InspectContainerWithOptions(docker.InspectContainerOptions{ID: l.ContainerID, Context: l.ctx})
+		if err != nil {
+			log.Printf("[WARN] can't inspect %s, no health wait, %v", l.ContainerName, err)
+			return true
+		}
+		switch health := c.State.Health; health.Status {
+		case "", "none":
+			return true // no healthcheck
+		case "healthy":
+			if waited {
+				l.since = passedAt(health)
+				log.Printf("[INFO] container %s healthy, start streaming", l.ContainerName)
+			}
+			return true
+		}
+
+		select {
+		case <-l.ctx.Done():
+			return false
+		case <-deadline:
+			if l.SkipUnhealthy {
+				log.Printf("[WARN] container %s not healthy in %v, skipped", l.ContainerName, l.WaitHealthy)
+				return false
+			}
+			log.Printf("[WARN] container %s not healthy in %v, start streaming anyway", l.ContainerName, l.WaitHealthy)
+			return true
+		case <-time.After(poll):
+		}
+	}
+}
+
+// passedAt returns time of the last health check, as it made container healthy. Current time if unknown.
+func passedAt(health docker.Health) time.Time {
+	if n := len(health.Log); n > 0 && !health.Log[n-1].End.IsZero() {
+		return health.Log[n-1].End
+	}
+	return time.Now()
+}
@@ -0,0 +1,135 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockHealthClient reports health statuses in order, the last one repeated
+type mockHealthClient struct {
+	statuses   []string
+	passed     time.Time
+	inspectErr error
+
+	sync.Mutex
+	inspects int
+	logs     []docker.LogsOptions
+}
+
+func (m *mockHealthClient) Logs(opts docker.LogsOptions) error {
+	m.Lock()
+	m.logs = append(m.logs, opts)
+	m.Unlock()
+	if opts.Follow {
+		<-opts.Context.Done()
+	}
+	return nil
+}
+
+func (m *mockHealthClient) InspectContainerWithOptions(docker.InspectContainerOptions) (*docker.Container, error) {
+	m.Lock()
+	defer m.Unlock()
+	if m.inspectErr != nil {
+		return nil, m.inspectErr
+	}
+	status := m.statuses[min(m.inspects, len(m.statuses)-1)]
+	m.inspects++
+	c := &docker.Container{State: docker.State{Health: docker.Health{Status: status}}}
+	if status == "healthy" && !m.passed.IsZero() {
+		c.State.Health.Log = []docker.HealthCheck{{Start: m.passed.Add(-time.Second), End: m.passed}}
+	}
+	return c, nil
+}
+
+func (m *mockHealthClient) calls() (inspects int, logs []docker.LogsOptions) {
+	m.Lock()
+	defer m.Unlock()
+	return m.inspects, append([]docker.LogsOptions{}, m.logs...)
+}
+
+func TestLogger_WaitHealthy(t *testing.T) {
+	passed := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	mock := &mockHealthClient{statuses: []string{"starting", "starting", "healthy"}, passed: passed}
+	l := &LogStreamer{ContainerID: "test_id", ContainerName: "test_name", DockerClient: mock,
+		LogWriter: &wrMock{}, ErrWriter: &wrMock{}, WaitHealthy: time.Second, healthPoll: 10 * time.Millisecond}
+	l = l.Go(context.Background())
+
+	time.Sleep(5 * time.Millisecond)
+	_, logs := mock.calls()
+	assert.Empty(t, logs, "not streamed before healthy")
+
+	require.Eventually(t, func() bool { _, logs := mock.calls(); return len(logs) == 1 }, time.Second, 5*time.Millisecond)
+	l.Close()
+	inspects, logs := mock.calls()
+	assert.Equal(t, 3, inspects)
+	assert.Equal(t, passed.Unix(), logs[0].Since, "streamed from the passed check")
+	assert.Equal(t, "all", logs[0].Tail)
+}
+
+func TestLogger_WaitHealthyAlready(t *testing.T) {
+	mock := &mockHealthClient{statuses: []string{"healthy"}, passed: time.Now()}
+	l := &LogStreamer{ContainerID: "test_id", ContainerName: "test_name", DockerClient: mock,
+		LogWriter: &wrMock{}, ErrWriter: &wrMock{}, WaitHealthy: time.Second, Tail: "5"}
+	l = l.Go(context.Background())
+	require.Eventually(t, func() bool { _, logs := mock.calls(); return len(logs) == 1 }, time.Second, 5*time.Millisecond)
+	l.Close()
+	_, logs := mock.calls()
+	assert.Equal(t, int64(0), logs[0].Since)
+	assert.Equal(t, "5", logs[0].Tail, "healthy on start, regular tail")
+}
+
+func TestLogger_WaitHealthyNoHealthcheck(t *testing.T) {
+	for _, mock := range []*mockHealthClient{
+		{statuses: []string{""}},
+		{statuses: []string{"none"}},
+		{inspectErr: errors.New("inspect failed")},
+	} {
+		l := &LogStreamer{ContainerID: "test_id", ContainerName: "test_name", DockerClient: mock,
+			LogWriter: &wrMock{}, ErrWriter: &wrMock{}, WaitHealthy: time.Minute}
+		l = l.Go(context.Background())
+		require.Eventually(t, func() bool { _, logs := mock.calls(); return len(logs) == 1 }, time.Second, 5*time.Millisecond)
+		l.Close()
+		_, logs := mock.calls()
+		assert.Equal(t, "10", logs[0].Tail, "streamed right away")
+	}
+}
+
+func TestLogger_WaitHealthyTimeout(t *testing.T) {
+	mock := &mockHealthClient{statuses: []string{"unhealthy"}}
+	l := &LogStreamer{ContainerID: "test_id", ContainerName: "test_name", DockerClient: mock,
+		LogWriter: &wrMock{}, ErrWriter: &wrMock{}, WaitHealthy: 50 * time.Millisecond, healthPoll: 10 * time.Millisecond}
+	l = l.Go(context.Background())
+	require.Eventually(t, func() bool { _, logs := mock.calls(); return len(logs) == 1 }, time.Second, 5*time.Millisecond)
+	l.Close()
+	_, logs := mock.calls()
+	assert.Equal(t, "10", logs[0].Tail, "streamed anyway after timeout")
+
+	mock = &mockHealthClient{statuses: []string{"unhealthy"}}
+	l = &LogStreamer{ContainerID: "test_id", ContainerName: "test_name", DockerClient: mock, FinalFetch: true,
+		LogWriter: &wrMock{}, ErrWriter: &wrMock{}, WaitHealthy: 50 * time.Millisecond, healthPoll: 10 * time.Millisecond,
+		SkipUnhealthy: true, OnCollect: func(bool) { t.Error("no collection of skipped container") }}
+	l = l.Go(context.Background())
+	time.Sleep(100 * time.Millisecond)
+	l.Close()
+	inspects, logs := mock.calls()
+	assert.Greater(t, inspects, 1)
+	assert.Empty(t, logs, "skipped, no stream and no final fetch")
+}
+
+func TestLogger_WaitHealthyClosed(t *testing.T) {
+	mock := &mockHealthClient{statuses: []string{"starting"}}
+	l := &LogStreamer{ContainerID: "test_id", ContainerName: "test_name", DockerClient: mock, FinalFetch: true,
+		LogWriter: &wrMock{}, ErrWriter: &wrMock{}, WaitHealthy: time.Minute, healthPoll: 10 * time.Millisecond}
+	l = l.Go(context.Background())
+	time.Sleep(20 * time.Millisecond)
+	l.Close()
+	_, logs := mock.calls()
+	assert.Empty(t, logs, "closed while waiting")
+}
@@ -0,0 +1,76 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// JSONLines defines how FormatJSON handles lines being json objects themselves
+type JSONLines int
+
+// enum of all json lines modes
+const (
+	JSONLinesOff   JSONLines = iota // json lines wrapped as msg string, as any other line
+	JSONLinesNest                   // line's object nested as "fields", msg taken from its msg, message or log field
+	JSONLinesMerge                  // line's fields merged into the envelope, container metadata wins on conflicts
+)
+
+// ParseJSONLines makes json lines mode from its name, "off", "nest" or "merge", case-insensitive.
+// Returns JSONLinesOff for unknown names.
+func ParseJSONLines(name string) JSONLines {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "nest":
+		return JSONLinesNest
+	case "merge":
+		return JSONLinesMerge
+	default:
+		return JSONLinesOff
+	}
+}
+
+// jsonObject returns line trimmed of whitespace if it's a valid json object, nil otherwise
+func jsonObject(p []byte) []byte {
+	line := bytes.TrimSpace(p)
+	if len(line) == 0 || line[0] != '{' || !json.Valid(line) {
+		return nil
+	}
+	return line
+}
+
+// lineMessage returns the first string field of msg, message or log of json object, empty if none
+func lineMessage(obj []byte) string {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(obj, &fields); err != nil {
+		return ""
+	}
+	for _, key := range []string{"msg", "message", "log"} {
+		var msg string
+		if v, ok := fields[key]; ok && json.Unmarshal(v, &msg) == nil {
+			return msg
+		}
+	}
+	return ""
+}
+
+// mergeJSON makes envelope of json object's fields and envelope's metadata, the latter replacing fields with
+// the same names. Envelope's msg dropped, as the object is the message.
+func mergeJSON(obj []byte, envelope jMsg) ([]byte, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(obj, &fields); err != nil {
+		return nil, err
+	}
+	meta, err := json.Marshal(envelope)
+	if err != nil {
+		return nil, err
+	}
+	metaFields := map[string]json.RawMessage{}
+	if err = json.Unmarshal(meta, &metaFields); err != nil {
+		return nil, err
+	}
+	delete(metaFields, "msg")
+	for k, v := range metaFields {
+		fields[k] = v
+	}
+	return json.Marshal(fields)
+}
@@ -0,0 +1,70 @@
+package logger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseJSONLines(t *testing.T) {
+	assert.Equal(t, JSONLinesNest, ParseJSONLines("nest"))
+	assert.Equal(t, JSONLinesMerge, ParseJSONLines(" Merge "))
+	assert.Equal(t, JSONLinesOff, ParseJSONLines("off"))
+	assert.Equal(t, JSONLinesOff, ParseJSONLines("bad"))
+}
+
+func TestMultiWriter_WithJSONLines(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	tbl := []struct {
+		name string
+		mode JSONLines
+		line string
+		res  string
+	}{
+		{"off", JSONLinesOff, `{"level":"info","msg":"started"}` + "\n",
+			`{"msg":"{\"level\":\"info\",\"msg\":\"started\"}\n","container":"c1","group":"g1","ts":"2024-05-01T10:00:00Z","host":"h1"}`},
+		{"nest", JSONLinesNest, `{"level":"info", "msg":"started"}` + "\n",
+			`{"msg":"started","container":"c1","group":"g1","ts":"2024-05-01T10:00:00Z","host":"h1",
+			"fields":{"level":"info","msg":"started"}}`},
+		{"nest with message", JSONLinesNest, `{"message":"started","n":1}`,
+			`{"msg":"started","container":"c1","group":"g1","ts":"2024-05-01T10:00:00Z","host":"h1","fields":{"message":"started","n":1}}`},
+		{"nest without message", JSONLinesNest, `{"msg":1}`,
+			`{"msg":"","container":"c1","group":"g1","ts":"2024-05-01T10:00:00Z","host":"h1","fields":{"msg":1}}`},
+		{"merge", JSONLinesMerge, `{"level":"info","msg":"started","nested":{"k":"v"}}` + "\n",
+			`{"level":"info","msg":"started","nested":{"k":"v"},"container":"c1","group":"g1","ts":"2024-05-01T10:00:00Z","host":"h1"}`},
+		{"merge conflicts", JSONLinesMerge, `{"ts":"yesterday","host":"other","user":"bob"}`,
+			`{"user":"bob","container":"c1","group":"g1","ts":"2024-05-01T10:00:00Z","host":"h1"}`},
+		{"not json", JSONLinesMerge, "plain line\n",
+			`{"msg":"plain line\n","container":"c1","group":"g1","ts":"2024-05-01T10:00:00Z","host":"h1"}`},
+		{"broken json", JSONLinesNest, `{"msg":"started"` + "\n",
+			`{"msg":"{\"msg\":\"started\"\n","container":"c1","group":"g1","ts":"2024-05-01T10:00:00Z","host":"h1"}`},
+		{"json array", JSONLinesMerge, `[1,2]`,
+			`{"msg":"[1,2]","container":"c1","group":"g1","ts":"2024-05-01T10:00:00Z","host":"h1"}`},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			wr := wrMock{}
+			writer := NewMultiWriterIgnoreErrors(&wr).WithFormat(FormatJSON, "c1", "g1").WithHostname("h1").
+				WithClock(func() time.Time { return ts }).WithJSONLines(tt.mode)
+			n, err := writer.Write([]byte(tt.line))
+			require.NoError(t, err)
+			assert.Equal(t, len(tt.line), n)
+			assert.JSONEq(t, tt.res, wr.String())
+		})
+	}
+}
+
+func TestMultiWriter_WithJSONLinesDockerTime(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	lt := &LineTime{}
+	lt.set(ts.Add(-time.Second))
+	wr := wrMock{}
+	writer := NewMultiWriterIgnoreErrors(&wr).WithFormat(FormatJSON, "c1", "g1").WithHostname("h1").
+		WithClock(func() time.Time { return ts }).WithDockerTime(lt, false).WithJSONLines(JSONLinesMerge)
+	_, err := writer.Write([]byte(`{"msg":"started"}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"msg":"started","container":"c1","group":"g1","ts":"2024-05-01T10:00:00Z","host":"h1",
+		"docker_time":"2024-05-01T09:59:59Z","ingest_time":"2024-05-01T10:00:00Z"}`, wr.String())
+}
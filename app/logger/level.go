@@ -0,0 +1,161 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// Level is a severity of log line
+type Level int
+
+// enum of all levels, in ascending severity
+const (
+	LevelUnknown Level = iota // level not detected
+	LevelTrace
+	LevelDebug
+	LevelInfo
+	LevelWarn
+	LevelError
+	LevelFatal
+)
+
+// String returns level name
+func (l Level) String() string {
+	switch l {
+	case LevelTrace:
+		return "trace"
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	case LevelFatal:
+		return "fatal"
+	default:
+		return "unknown"
+	}
+}
+
+// DefaultLevelPattern matches level in common text formats, i.e. "[WARN] ...", "level=warn ...", "2024-05-01 ERROR ...".
+// The first capture group is the level.
+const DefaultLevelPattern = `(?i)(?:^|\[|\s|level=|lvl=)(trace|debug|info|warn|warning|error|err|fatal|panic|critical)(?:$|\]|\s|:)`
+
+// ParseLevel makes level from its name, case-insensitive. Common aliases, like "warning" or "panic", supported.
+// Returns LevelUnknown for unknown names.
+func ParseLevel(name string) Level {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "trace":
+		return LevelTrace
+	case "debug", "dbg":
+		return LevelDebug
+	case "info", "information", "notice":
+		return LevelInfo
+	case "warn", "warning":
+		return LevelWarn
+	case "error", "err":
+		return LevelError
+	case "fatal", "panic", "dpanic", "critical", "crit":
+		return LevelFatal
+	default:
+		return LevelUnknown
+	}
+}
+
+// LevelDetector extracts level from log line. JSON lines, like logrus and zap make, checked for
+// level, lvl and severity fields, other lines matched against pattern.
+type LevelDetector struct {
+	pattern *regexp.Regexp
+}
+
+// NewLevelDetector makes LevelDetector with pattern, its first capture group (or the whole match if no groups)
+// is the level. nil pattern makes DefaultLevelPattern used.
+func NewLevelDetector(pattern *regexp.Regexp) *LevelDetector {
+	if pattern == nil {
+		pattern = regexp.MustCompile(DefaultLevelPattern)
+	}
+	return &LevelDetector{pattern: pattern}
+}
+
+// Detect returns level of the line, LevelUnknown if not detected
+func (d *LevelDetector) Detect(line []byte) Level {
+	if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 && trimmed[0] == '{' {
+		rec := struct {
+			Level    string `json:"level"`
+			Lvl      string `json:"lvl"`
+			Severity string `json:"severity"`
+		}{}
+		if err := json.Unmarshal(trimmed, &rec); err == nil {
+			for _, v := range []string{rec.Level, rec.Lvl, rec.Severity} {
+				if v != "" {
+					return ParseLevel(v)
+				}
+			}
+		}
+	}
+
+	m := d.pattern.FindSubmatch(line)
+	switch {
+	case m == nil:
+		return LevelUnknown
+	case len(m) > 1:
+		return ParseLevel(string(m[1]))
+	default:
+		return ParseLevel(string(m[0]))
+	}
+}
+
+// LevelFilter is a WriteCloser passing through lines with level at or above the minimum.
+// Lines with undetected level always passed.
+type LevelFilter struct {
+	wr       io.WriteCloser
+	name     string
+	minLevel Level
+	detector *LevelDetector
+
+	lock    sync.Mutex
+	dropped int
+}
+
+// NewLevelFilter makes LevelFilter for the writer
+func NewLevelFilter(wr io.WriteCloser, name string, minLevel Level, detector *LevelDetector) *LevelFilter {
+	return &LevelFilter{wr: wr, name: name, minLevel: minLevel, detector: detector}
+}
+
+// Write passes lines of p with allowed levels
+func (f *LevelFilter) Write(p []byte) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, line := range bytes.SplitAfter(p, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		if lvl := f.detector.Detect(line); lvl != LevelUnknown && lvl < f.minLevel {
+			f.dropped++
+			continue
+		}
+		if _, err := f.wr.Write(line); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Close reports dropped lines and closes the underlying writer
+func (f *LevelFilter) Close() error {
+	f.lock.Lock()
+	if f.dropped > 0 {
+		log.Printf("[INFO] %s dropped %d lines below min level", f.name, f.dropped)
+	}
+	f.lock.Unlock()
+	return f.wr.Close()
+}
@@ -0,0 +1,66 @@
+package logger
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLevel(t *testing.T) {
+	tbl := []struct {
+		name string
+		res  Level
+	}{
+		{"trace", LevelTrace}, {"DEBUG", LevelDebug}, {" Info ", LevelInfo}, {"warning", LevelWarn}, {"WARN", LevelWarn},
+		{"err", LevelError}, {"error", LevelError}, {"panic", LevelFatal}, {"dpanic", LevelFatal}, {"fatal", LevelFatal},
+		{"", LevelUnknown}, {"blah", LevelUnknown},
+	}
+	for i, tt := range tbl {
+		assert.Equal(t, tt.res, ParseLevel(tt.name), "case #%d", i)
+	}
+}
+
+func TestLevelDetector_Detect(t *testing.T) {
+	d := NewLevelDetector(nil)
+	tbl := []struct {
+		line string
+		res  Level
+	}{
+		{"2024/05/01 10:00:00 [DEBUG] some message\n", LevelDebug},
+		{"2024/05/01 10:00:00.123 [WARN]  {pkg/file.go:12 pkg.fn} some message\n", LevelWarn},
+		{`time="2024-05-01T10:00:00Z" level=info msg="started"` + "\n", LevelInfo},
+		{"2024-05-01 10:00:00 ERROR failed to connect\n", LevelError},
+		{"INFO: listening on :8080", LevelInfo},
+		{`{"level":"warn","ts":1714557600,"msg":"slow request"}` + "\n", LevelWarn},
+		{`{"lvl":"eror","msg":"bad level"}`, LevelUnknown},
+		{`{"severity":"ERROR","message":"failed"}`, LevelError},
+		{`{"msg":"no level but [DEBUG] in text"}`, LevelDebug},
+		{"plain message without level\n", LevelUnknown},
+		{"information about errors\n", LevelUnknown},
+		{"", LevelUnknown},
+	}
+	for i, tt := range tbl {
+		assert.Equal(t, tt.res, d.Detect([]byte(tt.line)), "case #%d, %s", i, tt.line)
+	}
+
+	d = NewLevelDetector(regexp.MustCompile(`^<(\w+)>`))
+	assert.Equal(t, LevelError, d.Detect([]byte("<error> message")))
+	assert.Equal(t, LevelUnknown, d.Detect([]byte("[ERROR] message")))
+	d = NewLevelDetector(regexp.MustCompile(`(?i)warn`))
+	assert.Equal(t, LevelWarn, d.Detect([]byte("some WARN message")), "no capture group, the whole match used")
+}
+
+func TestLevelFilter_Write(t *testing.T) {
+	wr := &wrMock{}
+	f := NewLevelFilter(wr, "c1", LevelWarn, NewLevelDetector(nil))
+	n, err := f.Write([]byte("[DEBUG] d1\n[INFO] i1\n[WARN] w1\nno level\n[ERROR] e1\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 51, n)
+	_, err = f.Write([]byte(`{"level":"info","msg":"i2"}` + "\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "[WARN] w1\nno level\n[ERROR] e1\n", wr.String())
+	assert.Equal(t, 3, f.dropped)
+	require.NoError(t, f.Close())
+}
@@ -4,10 +4,12 @@ import (
 	"context"
 	"io"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	docker "github.com/fsouza/go-dockerclient"
 	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
 )
 
 // LogClient wraps DockerClient with the minimal interface
@@ -15,6 +17,9 @@ type LogClient interface {
 	Logs(docker.LogsOptions) error
 }
 
+// finalFetchTimeout limits the final fetch of stopped container
+const finalFetchTimeout = 10 * time.Second
+
 // LogStreamer connects and activates container's log stream with io.Writer
 type LogStreamer struct {
 	DockerClient  LogClient
@@ -24,31 +29,146 @@ type LogStreamer struct {
 	LogWriter io.WriteCloser
 	ErrWriter io.WriteCloser
 
-	ctx    context.Context // nolint:containedctx
-	cancel context.CancelFunc
+	// Tail is a number of existing lines streamed on start, "all" for the whole history, "0" for new lines only.
+	// TailStart streams lines since container's start, with seconds granularity of docker's since, so a line
+	// of the previous run in the same second included. DockerClient should implement ContainerInspector for it.
+	// Default is 10. Ignored by file tailing, which always starts from the end.
+	Tail string
+
+	// Streams selects container's output streams read, stdout, stderr or both by default. Applies to all api calls
+	// and to file tailing, lines of the other stream never read.
+	Streams Streams
+
+	// FinalFetch makes Close to fetch logs written since the last seen line, after the follow stream terminated.
+	// Catches trailing lines of stopped container missed by follow at the cost of extra api call. Skipped once
+	// context of Go canceled, on shutdown, as containers still running.
+	FinalFetch bool
+
+	// TailFiles makes streamer read json-file logs directly from container's LogPath instead of api streaming,
+	// for lower daemon load. Falls back to api streaming if container uses other logging driver or LogPath unavailable.
+	// DockerClient should implement ContainerInspector to resolve LogPath.
+	TailFiles bool
+
+	// WaitHealthy defers streaming of container with healthcheck until it reports healthy, for up to WaitHealthy.
+	// Streaming started from the passed check, skipping startup logs. Containers without healthcheck streamed
+	// right away. Zero disables waiting. DockerClient should implement ContainerInspector to get health status.
+	WaitHealthy time.Duration
+
+	// SkipUnhealthy makes streamer skip container not healthy within WaitHealthy, instead of streaming it anyway.
+	SkipUnhealthy bool
+
+	// LineTime and ErrLineTime, if set, get docker timestamp of each stdout and stderr line before it written,
+	// for MultiWriter.WithDockerTime of LogWriter and ErrWriter. Separate ones, as streams written concurrently.
+	// Makes api stream request timestamps, stripped from lines. File tailing uses json-file record's time.
+	LineTime    *LineTime
+	ErrLineTime *LineTime
+
+	// ReadTimeout detects stuck follow stream, i.e. hanging due to daemon bug, delivering nothing without error.
+	// Once nothing read within ReadTimeout, container checked for lines written after the last seen one, and if it
+	// has some the stream reconnected from the last seen line. Container logging nothing is idle, not stuck, and
+	// its stream kept. Zero disables. Makes api stream request timestamps, file tailing not affected.
+	ReadTimeout time.Duration
+
+	// OnCollect, if set, called with true when streamer started following container's logs, and with false when
+	// following ended, before Close returns. Start can be later than the container's, i.e. with WaitHealthy.
+	// Not called for container skipped as not healthy.
+	OnCollect func(started bool)
+
+	// OnSkip, if set, called once container skipped as not healthy with SkipUnhealthy, from streamer's goroutine
+	// after the streamer is done, so it may block without blocking Close.
+	OnSkip func()
+
+	ctx        context.Context // nolint:containedctx
+	parent     context.Context // nolint:containedctx // context of Go, canceled on shutdown
+	cancel     context.CancelFunc
+	done       chan struct{}
+	seen       *lastSeen
+	tailed     bool          // set if logs read from file
+	skipped    atomic.Bool   // set if container never became healthy and skipped
+	since      time.Time     // start of logs if waited for healthy, zero otherwise
+	healthPoll time.Duration // health status check interval, default 1s
 }
 
 // Go activates streamer
 func (l *LogStreamer) Go(ctx context.Context) *LogStreamer {
 	log.Printf("[INFO] start log streamer for %s", l.ContainerName)
+	l.parent = ctx
 	l.ctx, l.cancel = context.WithCancel(ctx)
+	l.done = make(chan struct{})
+	l.seen = &lastSeen{}
+
+	if l.WaitHealthy > 0 {
+		go func() {
+			if !l.waitHealthy() {
+				l.skipped.Store(true)
+				close(l.done)
+				if l.OnSkip != nil && l.ctx.Err() == nil {
+					l.OnSkip()
+				}
+				return
+			}
+			l.start()
+		}()
+		return l
+	}
+	l.start()
+	return l
+}
 
+// start activates file tail or api stream, done closed on completion
+func (l *LogStreamer) start() {
+	if l.TailFiles {
+		if logPath := l.jsonLogPath(); logPath != "" {
+			l.tailed = true
+			go func() {
+				defer close(l.done)
+				l.collecting(true)
+				defer l.collecting(false)
+				l.tailFile(logPath)
+			}()
+			return
+		}
+	}
+
+	if l.tail() == TailStart && l.since.IsZero() {
+		// resolved before streaming, so the final fetch has it even if nothing streamed yet. The passed health
+		// check is later than the start, if waited.
+		l.since = l.startedAt()
+	}
 	go func() {
+		defer close(l.done)
+		l.collecting(true)
+		defer l.collecting(false)
 		logOpts := docker.LogsOptions{
 			Container:         l.ContainerID,
 			OutputStream:      l.LogWriter, // logs writer for stdout
 			ErrorStream:       l.ErrWriter, // err writer for stderr
-			Tail:              "10",
+			Tail:              l.tail(),
 			Follow:            true,
-			Stdout:            true,
-			Stderr:            true,
+			Stdout:            l.Streams.stdout(),
+			Stderr:            l.Streams.stderr(),
 			InactivityTimeout: time.Hour * 10000,
 			Context:           l.ctx,
 		}
+		if !l.since.IsZero() {
+			logOpts.Since, logOpts.Tail = l.since.Unix(), "all" // everything since container started or became healthy
+		}
+		if l.FinalFetch || l.LineTime != nil || l.ErrLineTime != nil || l.ReadTimeout > 0 {
+			// timestamps needed to know where the final fetch or resumed stream should start and for line times,
+			// stripped by tsWriter
+			logOpts.Timestamps = true
+			logOpts.OutputStream = &tsWriter{wr: l.LogWriter, seen: l.seen, lineTime: l.LineTime}
+			logOpts.ErrorStream = &tsWriter{wr: l.ErrWriter, seen: l.seen, lineTime: l.ErrLineTime}
+		}
 
 		var err error
 		for {
-			err = l.DockerClient.Logs(logOpts) // this is blocking call. Will run until container up and will publish to streams
+			err = l.followLogs(logOpts) // this is blocking call. Will run until container up and will publish to streams
+			if errors.Is(err, errStalled) && l.ctx.Err() == nil {
+				log.Printf("[WARN] stream from %s stalled, nothing read in %v, reconnect", l.ContainerID, l.ReadTimeout)
+				logOpts = l.resumeOpts(logOpts)
+				continue
+			}
 			// workaround https://github.com/moby/moby/issues/35370 with empty log, try read log as empty
 			if err != nil && strings.HasPrefix(err.Error(), "error from daemon in stream: Error grabbing logs: EOF") {
 				logOpts.Tail = ""
@@ -65,18 +185,74 @@ func (l *LogStreamer) Go(ctx context.Context) *LogStreamer {
 		}
 		log.Printf("[INFO] stream from %s terminated", l.ContainerID)
 	}()
+}
 
-	return l
+// collecting reports collection started or stopped to OnCollect, if set
+func (l *LogStreamer) collecting(started bool) {
+	if l.OnCollect != nil {
+		l.OnCollect(started)
+	}
+}
+
+// tail returns Tail or the default
+func (l *LogStreamer) tail() string {
+	if l.Tail == "" {
+		return "10"
+	}
+	return l.Tail
 }
 
 // Close kills streamer
 func (l *LogStreamer) Close() {
 	l.cancel()
 	l.Wait()
+	if l.done != nil {
+		<-l.done // wait for stream goroutine, no writes allowed after close
+	}
+	if l.FinalFetch && !l.tailed && !l.skipped.Load() && l.parent.Err() == nil { // file tail drains the file on close
+		l.fetchFinal()
+	}
 	log.Printf("[DEBUG] close %s", l.ContainerID)
 }
 
+// Skipped returns true if container skipped as not healthy, or closed while waiting for it to become healthy
+func (l *LogStreamer) Skipped() bool {
+	return l.skipped.Load()
+}
+
 // Wait for stream completion
 func (l *LogStreamer) Wait() {
 	<-l.ctx.Done()
 }
+
+// fetchFinal gets logs since the last seen line without follow, skipping lines written already.
+// Interrupted by shutdown, as context of Go canceled.
+func (l *LogStreamer) fetchFinal() {
+	floor := l.seen.get()
+	ctx, cancel := context.WithTimeout(l.parent, finalFetchTimeout)
+	defer cancel()
+
+	logOpts := docker.LogsOptions{
+		Container:    l.ContainerID,
+		OutputStream: &tsWriter{wr: l.LogWriter, seen: l.seen, floor: floor, lineTime: l.LineTime},
+		ErrorStream:  &tsWriter{wr: l.ErrWriter, seen: l.seen, floor: floor, lineTime: l.ErrLineTime},
+		Stdout:       l.Streams.stdout(),
+		Stderr:       l.Streams.stderr(),
+		Timestamps:   true,
+		Context:      ctx,
+	}
+	switch {
+	case floor.IsZero() && !l.since.IsZero():
+		// nothing seen, get everything since container started or became healthy
+		logOpts.Since, logOpts.Tail = l.since.Unix(), "all"
+	case floor.IsZero() && l.tail() == TailStart:
+		logOpts.Since, logOpts.Tail = l.startedAt().Unix(), "all" // docker knows nothing of TailStart
+	case floor.IsZero():
+		logOpts.Tail = l.tail() // nothing seen, get the same tail as follow would
+	default:
+		logOpts.Since = floor.Unix() // since has seconds granularity, sub-second dups dropped by tsWriter
+	}
+	if err := l.DockerClient.Logs(logOpts); err != nil {
+		log.Printf("[WARN] final fetch for %s failed, %v", l.ContainerID, err)
+	}
+}
@@ -2,12 +2,14 @@ package logger
 
 import (
 	"context"
+	"sync"
 	"testing"
 	"time"
 
 	docker "github.com/fsouza/go-dockerclient"
 	log "github.com/go-pkgz/lgr"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type mockLogClient struct {
@@ -56,3 +58,87 @@ func TestLogger_Cancel(t *testing.T) {
 	l.Wait()
 	assert.True(t, time.Since(st) >= time.Second*2, "completed")
 }
+
+func TestLogger_OnCollect(t *testing.T) {
+	var lock sync.Mutex
+	var collected []bool
+	l := &LogStreamer{ContainerID: "test_id", ContainerName: "test_name", DockerClient: &mockFinalLogClient{},
+		LogWriter: &wrMock{}, ErrWriter: &wrMock{}, OnCollect: func(started bool) {
+			lock.Lock()
+			collected = append(collected, started)
+			lock.Unlock()
+		}}
+	l = l.Go(context.Background())
+	require.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(collected) == 1
+	}, time.Second, 5*time.Millisecond)
+	l.Close()
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, []bool{true, false}, collected, "stopped reported before close returned")
+}
+
+type mockFinalLogClient struct {
+	calls []docker.LogsOptions
+}
+
+func (m *mockFinalLogClient) Logs(opts docker.LogsOptions) error {
+	m.calls = append(m.calls, opts)
+	if opts.Follow {
+		_, _ = opts.OutputStream.Write([]byte("2024-05-01T10:00:01.1Z line 1\n"))
+		_, _ = opts.ErrorStream.Write([]byte("2024-05-01T10:00:01.2Z err 1\n"))
+		<-opts.Context.Done()
+		return nil
+	}
+	// final fetch returns everything since the second of the last seen line
+	_, _ = opts.OutputStream.Write([]byte("2024-05-01T10:00:01.1Z line 1\n"))
+	_, _ = opts.ErrorStream.Write([]byte("2024-05-01T10:00:01.2Z err 1\n"))
+	_, _ = opts.OutputStream.Write([]byte("2024-05-01T10:00:01.3Z line 2\n"))
+	_, _ = opts.ErrorStream.Write([]byte("2024-05-01T10:00:01.4Z err 2\n"))
+	return nil
+}
+
+func TestLogger_FinalFetch(t *testing.T) {
+	mock := &mockFinalLogClient{}
+	lw, ew := &wrMock{}, &wrMock{}
+	l := &LogStreamer{ContainerID: "test_id", ContainerName: "test_name", DockerClient: mock,
+		LogWriter: lw, ErrWriter: ew, FinalFetch: true}
+	l = l.Go(context.Background())
+	time.Sleep(50 * time.Millisecond)
+	l.Close()
+
+	assert.Equal(t, "line 1\nline 2\n", lw.String())
+	assert.Equal(t, "err 1\nerr 2\n", ew.String())
+	require.Equal(t, 2, len(mock.calls))
+	assert.True(t, mock.calls[0].Timestamps)
+	assert.False(t, mock.calls[1].Follow)
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 0, 1, 0, time.UTC).Unix(), mock.calls[1].Since)
+}
+
+func TestLogger_FinalFetchShutdown(t *testing.T) {
+	mock := &mockFinalLogClient{}
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &LogStreamer{ContainerID: "test_id", ContainerName: "test_name", DockerClient: mock,
+		LogWriter: &wrMock{}, ErrWriter: &wrMock{}, FinalFetch: true}
+	l = l.Go(ctx)
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	l.Close()
+	require.Equal(t, 1, len(mock.calls), "no final fetch on shutdown")
+	assert.True(t, mock.calls[0].Follow)
+}
+
+func TestLogger_Tail(t *testing.T) {
+	for _, tt := range []struct{ tail, res string }{{"", "10"}, {"all", "all"}, {"0", "0"}} {
+		mock := &mockFinalLogClient{}
+		l := &LogStreamer{ContainerID: "test_id", ContainerName: "test_name", DockerClient: mock,
+			LogWriter: &wrMock{}, ErrWriter: &wrMock{}, Tail: tt.tail}
+		l = l.Go(context.Background())
+		time.Sleep(10 * time.Millisecond)
+		l.Close()
+		require.Equal(t, 1, len(mock.calls))
+		assert.Equal(t, tt.res, mock.calls[0].Tail)
+	}
+}
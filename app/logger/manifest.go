@@ -0,0 +1,303 @@
+package logger
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+)
+
+// Manifest keeps json list of rotated log files, for external archival processes uploading and pruning them.
+// Each rotated segment listed with its container, group, time range and size once rotated and compressed.
+// Segments removed from disk, by retention, disk budget or the external process, dropped on the next update.
+// The file replaced atomically on each update, so readers never see a partial one. Safe for concurrent use.
+type Manifest struct {
+	path  string
+	lock  sync.Mutex
+	files []ManifestEntry
+}
+
+// ManifestEntry is a rotated segment of log file
+type ManifestEntry struct {
+	File      string    `json:"file"`                // absolute path of rotated, and compressed if enabled, segment
+	LogFile   string    `json:"log_file"`            // absolute path of active log file the segment rotated from
+	Container string    `json:"container,omitempty"` // container name, empty for files shared by group
+	Group     string    `json:"group,omitempty"`
+	Start     time.Time `json:"start"` // time of the first write, or the previous rotation
+	End       time.Time `json:"end"`   // time of rotation
+	Size      int64     `json:"size"`  // size of the segment file in bytes
+}
+
+// ManifestFile defines rotated log file for Manifest.Writer
+type ManifestFile struct {
+	File      string // path of active log file
+	MaxSize   int64  // size in bytes triggering rotation
+	Compress  bool   // compress rotated segments, rotating writer should not compress them itself
+	Container string
+	Group     string
+}
+
+// Rotator is a writer of rotated log file, i.e. lumberjack.Logger
+type Rotator interface {
+	io.WriteCloser
+	Rotate() error
+}
+
+// manifestData is json content of manifest file
+type manifestData struct {
+	Updated time.Time       `json:"updated"`
+	Files   []ManifestEntry `json:"files"`
+}
+
+// backupTimeFormat is time format of rotated file names made by lumberjack
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// NewManifest makes Manifest of path, with entries of existing manifest file kept
+func NewManifest(path string) (*Manifest, error) {
+	res := &Manifest{path: path}
+	data, err := os.ReadFile(path) //nolint:gosec // manifest path set by user
+	if os.IsNotExist(err) {
+		return res, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't read manifest %s", path)
+	}
+	var md manifestData
+	if err := json.Unmarshal(data, &md); err != nil {
+		return nil, errors.Wrapf(err, "can't parse manifest %s", path)
+	}
+	res.files = md.Files
+	return res, nil
+}
+
+// Files returns entries of the manifest, oldest first
+func (m *Manifest) Files() []ManifestEntry {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]ManifestEntry(nil), m.files...)
+}
+
+// Writer wraps rotating writer of file, rotating it once MaxSize reached and listing rotated segments in
+// the manifest. Rotation made by the wrapper, so the segment and its time range known, rotating writer's
+// own size limit should be the same or larger.
+func (m *Manifest) Writer(wr Rotator, file ManifestFile) io.WriteCloser {
+	return &manifestWriter{wr: wr, manifest: m, file: file}
+}
+
+// add lists rotated segment, compressing it first if needed, and updates the manifest file
+func (m *Manifest) add(entry ManifestEntry, compress bool) {
+	if compress {
+		gz, err := compressFile(entry.File)
+		if err != nil {
+			log.Printf("[WARN] can't compress rotated %s, %v", entry.File, err)
+		} else {
+			entry.File = gz
+		}
+	}
+	if info, err := os.Stat(entry.File); err == nil {
+		entry.Size = info.Size()
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.files = append(m.files, entry)
+	if err := m.save(); err != nil {
+		log.Printf("[WARN] can't update manifest, %v", err)
+	}
+}
+
+// lastEnd returns rotation time of the latest segment of log file, zero if none listed
+func (m *Manifest) lastEnd(logFile string) (res time.Time) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, f := range m.files {
+		if f.LogFile == logFile && f.End.After(res) {
+			res = f.End
+		}
+	}
+	return res
+}
+
+// save drops entries of removed segments and writes the manifest to temp file renamed to the manifest,
+// should be called with lock held
+func (m *Manifest) save() error {
+	files := m.files[:0]
+	for _, f := range m.files {
+		if _, err := os.Stat(f.File); err == nil {
+			files = append(files, f)
+		}
+	}
+	m.files = files
+	sort.SliceStable(m.files, func(i, j int) bool { return m.files[i].End.Before(m.files[j].End) })
+
+	data, err := json.MarshalIndent(manifestData{Updated: time.Now(), Files: m.files}, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "can't marshal manifest")
+	}
+	fh, err := os.CreateTemp(filepath.Dir(m.path), "."+filepath.Base(m.path)+"-*.tmp")
+	if err != nil {
+		return errors.Wrapf(err, "can't make manifest %s", m.path)
+	}
+	if _, err = fh.Write(append(data, '\n')); err == nil {
+		err = fh.Close()
+	} else {
+		_ = fh.Close()
+	}
+	if err == nil {
+		err = os.Rename(fh.Name(), m.path)
+	}
+	if err != nil {
+		_ = os.Remove(fh.Name())
+		return errors.Wrapf(err, "can't write manifest %s", m.path)
+	}
+	return nil
+}
+
+// manifestWriter rotates log file by size and reports rotated segments to the manifest
+type manifestWriter struct {
+	wr       Rotator
+	manifest *Manifest
+	file     ManifestFile
+
+	lock    sync.Mutex
+	opened  bool
+	size    int64
+	start   time.Time
+	pending sync.WaitGroup // segments being compressed and listed
+}
+
+// Write rotates the file if p doesn't fit MaxSize and writes p. Failed rotation logged, leaving it to
+// the rotating writer.
+func (w *manifestWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if !w.opened {
+		w.opened = true
+		if info, err := os.Stat(w.file.File); err == nil {
+			w.size = info.Size()
+		}
+		w.start = w.manifest.lastEnd(w.logFile())
+	}
+	if w.start.IsZero() {
+		w.start = time.Now().UTC()
+	}
+	if w.size > 0 && w.size+int64(len(p)) >= w.file.MaxSize {
+		if err := w.rotate(); err != nil {
+			log.Printf("[WARN] can't list rotated segment of %s, %v", w.file.File, err)
+		}
+	}
+	n, err := w.wr.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Close waits for rotated segments to be listed and closes the rotating writer
+func (w *manifestWriter) Close() error {
+	w.pending.Wait()
+	return w.wr.Close()
+}
+
+// rotate rotates the file and lists rotated segment in background, as compression may take a while
+func (w *manifestWriter) rotate() error {
+	since := time.Now().UTC().Truncate(time.Millisecond)
+	if err := w.wr.Rotate(); err != nil {
+		return errors.Wrapf(err, "can't rotate %s", w.file.File)
+	}
+	w.size = 0
+	rotated, end, err := rotatedSegment(w.file.File, since)
+	if err != nil {
+		w.start = time.Now().UTC()
+		return err
+	}
+	entry := ManifestEntry{File: rotated, LogFile: w.logFile(), Container: w.file.Container, Group: w.file.Group,
+		Start: w.start, End: end}
+	w.start = end
+	w.pending.Add(1)
+	go func() {
+		defer w.pending.Done()
+		w.manifest.add(entry, w.file.Compress)
+	}()
+	return nil
+}
+
+// logFile returns absolute path of the active log file
+func (w *manifestWriter) logFile() string {
+	if abs, err := filepath.Abs(w.file.File); err == nil {
+		return abs
+	}
+	return w.file.File
+}
+
+// rotatedSegment returns absolute path and rotation time of the latest segment of file rotated since the time.
+// Segments named by lumberjack as name-time.ext, i.e. web-2024-05-01T10-00-00.000.log for web.log.
+func rotatedSegment(file string, since time.Time) (path string, end time.Time, err error) {
+	dir, name := filepath.Split(file)
+	ext := filepath.Ext(name)
+	prefix := strings.TrimSuffix(name, ext) + "-"
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "can't read directory of %s", file)
+	}
+	for _, e := range entries {
+		n := e.Name()
+		if !strings.HasPrefix(n, prefix) || !strings.HasSuffix(n, ext) || len(n) != len(prefix)+len(backupTimeFormat)+len(ext) {
+			continue
+		}
+		ts, err := time.Parse(backupTimeFormat, n[len(prefix):len(n)-len(ext)])
+		if err != nil || ts.Before(since) || !ts.After(end) {
+			continue
+		}
+		path, end = filepath.Join(dir, n), ts
+	}
+	if path == "" {
+		return "", time.Time{}, errors.Errorf("rotated segment of %s not found", file)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "can't get absolute path of %s", path)
+	}
+	return abs, end, nil
+}
+
+// compressFile gzips file to file.gz, made by rename of temp file, and removes the file
+func compressFile(path string) (string, error) {
+	src, err := os.Open(path) //nolint:gosec // rotated log file
+	if err != nil {
+		return "", errors.Wrapf(err, "can't open %s", path)
+	}
+	defer src.Close() //nolint:errcheck // read only
+	fh, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*.tmp")
+	if err != nil {
+		return "", errors.Wrapf(err, "can't make compressed %s", path)
+	}
+	gz := gzip.NewWriter(fh)
+	if _, err = io.Copy(gz, src); err == nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		err = fh.Close()
+	} else {
+		_ = fh.Close()
+	}
+	dst := path + ".gz"
+	if err == nil {
+		err = os.Rename(fh.Name(), dst)
+	}
+	if err != nil {
+		_ = os.Remove(fh.Name())
+		return "", errors.Wrapf(err, "can't compress %s", path)
+	}
+	if err := os.Remove(path); err != nil {
+		return "", errors.Wrapf(err, "can't remove compressed %s", path)
+	}
+	return dst, nil
+}
@@ -0,0 +1,144 @@
+package logger
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+func TestManifest_Rotations(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "manifest.json")
+	m, err := NewManifest(path)
+	require.NoError(t, err)
+	file := filepath.Join(dir, "web.log")
+	wr := m.Writer(&lumberjack.Logger{Filename: file, MaxSize: 1},
+		ManifestFile{File: file, MaxSize: 150, Compress: true, Container: "web", Group: "shop"})
+
+	start := time.Now()
+	lines := writeLines(t, wr, 7) // 60 bytes lines, rotated on every third one
+	require.NoError(t, wr.Close())
+
+	md := readManifest(t, path)
+	assert.WithinDuration(t, time.Now(), md.Updated, time.Minute)
+	require.Len(t, md.Files, 3)
+	for i, f := range md.Files {
+		assert.True(t, strings.HasPrefix(f.File, filepath.Join(dir, "web-")), f.File)
+		assert.True(t, strings.HasSuffix(f.File, ".log.gz"), f.File)
+		assert.Equal(t, file, f.LogFile)
+		assert.Equal(t, "web", f.Container)
+		assert.Equal(t, "shop", f.Group)
+		info, err := os.Stat(f.File)
+		require.NoError(t, err)
+		assert.Equal(t, info.Size(), f.Size)
+		assert.Equal(t, lines[2*i]+lines[2*i+1], gunzip(t, f.File), "segment %d", i)
+		assert.False(t, f.End.Before(f.Start), "time range of segment %d", i)
+		if i == 0 {
+			assert.WithinDuration(t, start, f.Start, time.Second)
+			continue
+		}
+		assert.Equal(t, md.Files[i-1].End, f.Start, "segment %d starts at the previous rotation", i)
+	}
+	_, err = os.Stat(strings.TrimSuffix(md.Files[0].File, ".gz"))
+	assert.True(t, os.IsNotExist(err), "uncompressed segment removed")
+	active, err := os.ReadFile(file) //nolint:gosec // test file
+	require.NoError(t, err)
+	assert.Equal(t, lines[6], string(active))
+	require.Len(t, m.Files(), 3)
+	assert.Equal(t, md.Files[2].File, m.Files()[2].File)
+}
+
+func TestManifest_Restart(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "manifest.json")
+	file := filepath.Join(dir, "web.log")
+	params := ManifestFile{File: file, MaxSize: 150, Container: "web"}
+
+	m, err := NewManifest(path)
+	require.NoError(t, err)
+	wr := m.Writer(&lumberjack.Logger{Filename: file, MaxSize: 1}, params)
+	writeLines(t, wr, 5)
+	require.NoError(t, wr.Close())
+	first := readManifest(t, path).Files
+	require.Len(t, first, 2)
+	assert.True(t, strings.HasSuffix(first[0].File, ".log"), "not compressed")
+
+	m, err = NewManifest(path)
+	require.NoError(t, err)
+	assert.Equal(t, first, m.Files(), "entries kept on restart")
+	require.NoError(t, os.Remove(first[0].File)) // pruned by external process
+
+	wr = m.Writer(&lumberjack.Logger{Filename: file, MaxSize: 1}, params)
+	writeLines(t, wr, 4) // the active file has a line already, rotated on the second one
+	require.NoError(t, wr.Close())
+	files := readManifest(t, path).Files
+	require.Len(t, files, 3, "removed segment dropped")
+	assert.Equal(t, first[1], files[0])
+	assert.Equal(t, first[1].End, files[1].Start, "continued from the last rotation")
+}
+
+func TestNewManifestInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	require.NoError(t, os.WriteFile(path, []byte("{bad"), 0o600))
+	_, err := NewManifest(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't parse manifest")
+}
+
+func TestRotatedSegment(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"web-2024-05-01T10-00-00.000.log", "web-2024-05-01T11-00-00.000.log",
+		"web-2024-05-01T12-00-00.000.log.gz", "web-app-2024-05-01T13-00-00.000.log", "web-bad.log", "web.log"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o600))
+	}
+	path, end, err := rotatedSegment(filepath.Join(dir, "web.log"), time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "web-2024-05-01T11-00-00.000.log"), path)
+	assert.Equal(t, time.Date(2024, 5, 1, 11, 0, 0, 0, time.UTC), end)
+
+	_, _, err = rotatedSegment(filepath.Join(dir, "web.log"), time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "rotated segment of")
+}
+
+// writeLines writes count 60 bytes lines, with a pause between them for different rotation times
+func writeLines(t *testing.T, wr io.Writer, count int) []string {
+	res := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		line := fmt.Sprintf("line %02d %s\n", i, strings.Repeat("x", 51))
+		_, err := wr.Write([]byte(line))
+		require.NoError(t, err)
+		res = append(res, line)
+		time.Sleep(2 * time.Millisecond)
+	}
+	return res
+}
+
+func readManifest(t *testing.T, path string) manifestData {
+	data, err := os.ReadFile(path) //nolint:gosec // test file
+	require.NoError(t, err)
+	var res manifestData
+	require.NoError(t, json.Unmarshal(data, &res))
+	return res
+}
+
+func gunzip(t *testing.T, path string) string {
+	fh, err := os.Open(path) //nolint:gosec // test file
+	require.NoError(t, err)
+	defer fh.Close()
+	zr, err := gzip.NewReader(fh)
+	require.NoError(t, err)
+	data, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	return string(data)
+}
@@ -17,16 +17,27 @@ type MultiWriter struct {
 	hostname  string
 	container string
 	group     string
-	isJSON    bool
+	format    Format
+	now       func() time.Time
+	lineTime  *LineTime
+	dockerTS  bool
+	jsonLines JSONLines
+	traceID   *TraceExtractor
 }
 
-// jMsg is envelope for ExtJSON mode
+// jMsg is envelope for JSON format
 type jMsg struct {
 	Msg       string    `json:"msg"`
 	Container string    `json:"container"`
 	Group     string    `json:"group"`
 	TS        time.Time `json:"ts"`
 	Host      string    `json:"host"`
+	TraceID   string    `json:"trace_id,omitempty"`
+
+	DockerTime *time.Time `json:"docker_time,omitempty"` // docker's timestamp of the line, with WithDockerTime only
+	IngestTime *time.Time `json:"ingest_time,omitempty"` // time the line received, with WithDockerTime only
+
+	Fields json.RawMessage `json:"fields,omitempty"` // line's json object, with JSONLinesNest only
 }
 
 // NewMultiWriterIgnoreErrors create WriteCloser for multiple destinations
@@ -39,9 +50,15 @@ func NewMultiWriterIgnoreErrors(writers ...io.WriteCloser) *MultiWriter {
 
 // WithExtJSON turn JSON output mode on
 func (w *MultiWriter) WithExtJSON(containerName, group string) *MultiWriter {
+	return w.WithFormat(FormatJSON, containerName, group)
+}
+
+// WithFormat sets output format, FormatJSON and FormatLogfmt wrap lines with container, group, ts and host.
+// FormatRaw and FormatUnknown write lines as is.
+func (w *MultiWriter) WithFormat(format Format, containerName, group string) *MultiWriter {
 	w.container = containerName
 	w.group = group
-	w.isJSON = true
+	w.format = format
 
 	hostname := "unknown"
 	if h, err := os.Hostname(); err == nil {
@@ -51,13 +68,53 @@ func (w *MultiWriter) WithExtJSON(containerName, group string) *MultiWriter {
 	return w
 }
 
+// WithHostname overrides hostname used in JSON output mode, empty hostname ignored
+func (w *MultiWriter) WithHostname(hostname string) *MultiWriter {
+	if hostname != "" {
+		w.hostname = hostname
+	}
+	return w
+}
+
+// WithClock overrides clock of receive time stamped on formatted lines, time.Now by default
+func (w *MultiWriter) WithClock(now func() time.Time) *MultiWriter {
+	w.now = now
+	return w
+}
+
+// WithDockerTime adds docker's timestamp of each line, from lineTime, and receive time to formatted lines as
+// docker_time and ingest_time. With dockerTS set, ts is docker's timestamp instead of receive time, if known.
+// LogStreamer should share the same lineTime to pass timestamps.
+func (w *MultiWriter) WithDockerTime(lineTime *LineTime, dockerTS bool) *MultiWriter {
+	w.lineTime = lineTime
+	w.dockerTS = dockerTS
+	return w
+}
+
+// WithJSONLines sets handling of lines being json objects by FormatJSON, JSONLinesOff by default.
+// Lines of other kinds always wrapped as msg string.
+func (w *MultiWriter) WithJSONLines(mode JSONLines) *MultiWriter {
+	w.jsonLines = mode
+	return w
+}
+
+// WithTraceID adds correlation id found by extractor to formatted lines as trace_id, omitted for lines without it.
+// Line itself written as is.
+func (w *MultiWriter) WithTraceID(extractor *TraceExtractor) *MultiWriter {
+	w.traceID = extractor
+	return w
+}
+
 // Write to all writers and ignore errors unless they all have errors
 func (w *MultiWriter) Write(p []byte) (n int, err error) {
 	pp := p
-	if w.isJSON {
+	switch w.format {
+	case FormatJSON:
 		if pp, err = w.extJSON(p); err != nil {
 			return 0, errors.Wrap(err, "can't convert message to json")
 		}
+	case FormatLogfmt:
+		pp = w.logfmt(p)
 	}
 
 	numErrors := 0
@@ -85,5 +142,48 @@ func (w *MultiWriter) Close() error {
 }
 
 func (w *MultiWriter) extJSON(p []byte) (res []byte, err error) {
-	return json.Marshal(jMsg{Msg: string(p), TS: time.Now(), Host: w.hostname, Group: w.group, Container: w.container})
+	ts, dockerTime, ingestTime := w.times()
+	msg := jMsg{Msg: string(p), TS: ts, Host: w.hostname, Group: w.group, Container: w.container,
+		TraceID: w.lineTraceID(p), DockerTime: dockerTime, IngestTime: ingestTime}
+	if w.jsonLines == JSONLinesOff {
+		return json.Marshal(msg)
+	}
+	obj := jsonObject(p)
+	switch {
+	case obj == nil:
+		return json.Marshal(msg)
+	case w.jsonLines == JSONLinesNest:
+		msg.Msg, msg.Fields = lineMessage(obj), obj
+		return json.Marshal(msg)
+	default:
+		return mergeJSON(obj, msg)
+	}
+}
+
+// lineTraceID returns correlation id of the line, empty if none or WithTraceID not set
+func (w *MultiWriter) lineTraceID(p []byte) string {
+	if w.traceID == nil {
+		return ""
+	}
+	return w.traceID.Extract(p)
+}
+
+// times returns authoritative timestamp of the line, with docker's and receive time if WithDockerTime set.
+// Docker's time is nil if unknown.
+func (w *MultiWriter) times() (ts time.Time, dockerTime, ingestTime *time.Time) {
+	now := time.Now()
+	if w.now != nil {
+		now = w.now()
+	}
+	if w.lineTime == nil {
+		return now, nil, nil
+	}
+	ts, ingestTime = now, &now
+	if dt := w.lineTime.Get(); !dt.IsZero() {
+		dockerTime = &dt
+		if w.dockerTS {
+			ts = dt
+		}
+	}
+	return ts, dockerTime, ingestTime
 }
@@ -53,6 +53,65 @@ func TestMultiWriter_extJSON(t *testing.T) {
 	assert.True(t, time.Since(j.TS).Seconds() < 1)
 }
 
+func TestMultiWriter_WithHostname(t *testing.T) {
+	writer := NewMultiWriterIgnoreErrors().WithExtJSON("c1", "g1").WithHostname("src1")
+	res, err := writer.extJSON([]byte("test msg"))
+	assert.NoError(t, err)
+	j := jMsg{}
+	assert.NoError(t, json.Unmarshal(res, &j))
+	assert.Equal(t, "src1", j.Host)
+
+	hname, err := os.Hostname()
+	assert.NoError(t, err)
+	writer = NewMultiWriterIgnoreErrors().WithExtJSON("c1", "g1").WithHostname("")
+	assert.Equal(t, hname, writer.hostname, "empty hostname ignored")
+}
+
+func TestMultiWriter_WithDockerTime(t *testing.T) {
+	ingest := time.Date(2024, 5, 1, 10, 0, 5, 0, time.UTC)
+	docker := time.Date(2024, 5, 1, 10, 0, 1, 0, time.UTC)
+	lt := &LineTime{}
+
+	writer := NewMultiWriterIgnoreErrors().WithExtJSON("c1", "g1").WithClock(func() time.Time { return ingest })
+	res, err := writer.extJSON([]byte("msg"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(res), "ingest_time", "no extra times by default")
+	assert.Contains(t, string(res), `"ts":"2024-05-01T10:00:05Z"`, "receive time from clock")
+
+	writer.WithDockerTime(lt, false)
+	res, err = writer.extJSON([]byte("msg"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(res), `"ts":"2024-05-01T10:00:05Z","host"`)
+	assert.Contains(t, string(res), `"ingest_time":"2024-05-01T10:00:05Z"`)
+	assert.NotContains(t, string(res), "docker_time", "docker time unknown")
+
+	lt.set(docker)
+	res, err = writer.extJSON([]byte("msg"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(res), `"ts":"2024-05-01T10:00:05Z","host"`, "receive time authoritative")
+	assert.Contains(t, string(res), `"docker_time":"2024-05-01T10:00:01Z","ingest_time":"2024-05-01T10:00:05Z"`)
+
+	writer.WithDockerTime(lt, true)
+	res, err = writer.extJSON([]byte("msg"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(res), `"ts":"2024-05-01T10:00:01Z","host"`, "docker time authoritative")
+	assert.Contains(t, string(res), `"docker_time":"2024-05-01T10:00:01Z","ingest_time":"2024-05-01T10:00:05Z"`)
+
+	lt.set(time.Time{})
+	res, err = writer.extJSON([]byte("msg"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(res), `"ts":"2024-05-01T10:00:05Z","host"`, "receive time if docker time unknown")
+
+	wr := wrMock{}
+	lt.set(docker)
+	writer = NewMultiWriterIgnoreErrors(&wr).WithFormat(FormatLogfmt, "c1", "g1").WithHostname("src1").
+		WithClock(func() time.Time { return ingest }).WithDockerTime(lt, true)
+	_, err = writer.Write([]byte("line\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "ts=2024-05-01T10:00:01Z host=src1 container=c1 group=g1 docker_time=2024-05-01T10:00:01Z "+
+		"ingest_time=2024-05-01T10:00:05Z msg=line\n", wr.String())
+}
+
 type wrMock struct {
 	bytes.Buffer
 }
@@ -0,0 +1,86 @@
+package logger
+
+import (
+	"bytes"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// LinePrefix is a compiled template of prefix added to each line, i.e. "[{{.Group}}/{{.Name}}] "
+type LinePrefix struct {
+	tmpl *template.Template
+}
+
+// PrefixData is a data of prefix template, TS set to current time for each line
+type PrefixData struct {
+	ID     string
+	Name   string
+	Group  string
+	Host   string
+	Image  string
+	Stream string // stdout or stderr
+	TS     time.Time
+}
+
+// ParseLinePrefix compiles prefix template and checks it renders with PrefixData
+func ParseLinePrefix(text string) (*LinePrefix, error) {
+	tmpl, err := template.New("prefix").Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid prefix template")
+	}
+	res := &LinePrefix{tmpl: tmpl}
+	if _, err := res.render(PrefixData{TS: time.Now()}); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Prefix makes transform func prepending rendered prefix to each line, for use with Transformer.
+// Template not depending on TS rendered once, otherwise on every line. Returned line reuses internal
+// buffer, valid till the next call only, as Transformer writes it right away.
+func (p *LinePrefix) Prefix(data PrefixData) func(line []byte) []byte {
+	buf := &bytes.Buffer{}
+	if static, ok := p.static(data); ok {
+		return func(line []byte) []byte {
+			buf.Reset()
+			buf.Write(static)
+			buf.Write(line)
+			return buf.Bytes()
+		}
+	}
+	return func(line []byte) []byte {
+		buf.Reset()
+		data.TS = time.Now()
+		if err := p.tmpl.Execute(buf, data); err != nil {
+			buf.Reset() // checked by ParseLinePrefix, shouldn't happen; line kept as is
+		}
+		buf.Write(line)
+		return buf.Bytes()
+	}
+}
+
+// static renders prefix with two different TS, ok if results the same, i.e. template doesn't use TS
+func (p *LinePrefix) static(data PrefixData) (prefix []byte, ok bool) {
+	data.TS = time.Unix(0, 0)
+	first, err := p.render(data)
+	if err != nil {
+		return nil, false
+	}
+	data.TS = time.Unix(86400+3600+61, 1)
+	second, err := p.render(data)
+	if err != nil || !bytes.Equal(first, second) {
+		return nil, false
+	}
+	return first, true
+}
+
+// render executes template with data
+func (p *LinePrefix) render(data PrefixData) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := p.tmpl.Execute(buf, data); err != nil {
+		return nil, errors.Wrap(err, "can't render prefix template")
+	}
+	return buf.Bytes(), nil
+}
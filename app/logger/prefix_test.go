@@ -0,0 +1,76 @@
+package logger
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinePrefix(t *testing.T) {
+	data := PrefixData{ID: "id1", Name: "web", Group: "system", Host: "h1", Image: "nginx:latest", Stream: "stderr"}
+	tbl := []struct {
+		name, tmpl, in, out string
+	}{
+		{"group and name", "[{{.Group}}/{{.Name}}] ", "line 1\n", "[system/web] line 1\n"},
+		{"all fields", "{{.Host}} {{.ID}} {{.Image}} {{.Stream}}: ", "line\n", "h1 id1 nginx:latest stderr: line\n"},
+		{"conditional", "{{if .Group}}{{.Group}}/{{end}}{{.Name}} | ", "line", "system/web | line"},
+		{"empty line", "{{.Name}}: ", "\n", "web: \n"},
+		{"empty template", "", "line\n", "line\n"},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParseLinePrefix(tt.tmpl)
+			require.NoError(t, err)
+			assert.Equal(t, tt.out, string(p.Prefix(data)([]byte(tt.in))))
+		})
+	}
+}
+
+func TestLinePrefixTime(t *testing.T) {
+	p, err := ParseLinePrefix(`{{.TS.Format "2006-01-02T15:04:05.000"}} {{.Name}} `)
+	require.NoError(t, err)
+	_, ok := p.static(PrefixData{Name: "web"})
+	assert.False(t, ok, "rendered per line")
+	res := p.Prefix(PrefixData{Name: "web"})([]byte("line\n"))
+	assert.Regexp(t, regexp.MustCompile(`^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{3} web line\n$`), string(res))
+
+	p, err = ParseLinePrefix("{{.Name}} ")
+	require.NoError(t, err)
+	prefix, ok := p.static(PrefixData{Name: "web"})
+	assert.True(t, ok, "rendered once")
+	assert.Equal(t, "web ", string(prefix))
+}
+
+func TestLinePrefixInvalid(t *testing.T) {
+	_, err := ParseLinePrefix("{{.Name")
+	assert.ErrorContains(t, err, "invalid prefix template")
+	_, err = ParseLinePrefix("{{.Unknown}}")
+	assert.ErrorContains(t, err, "can't render prefix template")
+}
+
+func TestLinePrefixTransformer(t *testing.T) {
+	p, err := ParseLinePrefix("[{{.Stream}}] ")
+	require.NoError(t, err)
+	buf := &lockedBuffer{}
+	tr := NewTransformer(buf, p.Prefix(PrefixData{Stream: "stdout"}))
+	_, err = tr.Write([]byte("line 1\nline 2\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "[stdout] line 1\n[stdout] line 2\n", buf.String(), "buffer reused between lines")
+}
+
+func BenchmarkLinePrefix(b *testing.B) {
+	line := []byte("some log line of the container\n")
+	for _, tmpl := range []string{"[{{.Group}}/{{.Name}}] ", `{{.TS.Format "15:04:05"}} {{.Name}} `} {
+		p, err := ParseLinePrefix(tmpl)
+		require.NoError(b, err)
+		prefix := p.Prefix(PrefixData{Name: "web", Group: "system"})
+		b.Run(tmpl, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				prefix(line)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package logger
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// Sampler is a WriteCloser passing through 1 of every Rate lines to the underlying writer.
+// Lines accepted by Keep predicate always passed and not counted against the rate.
+// Every ReportInterval, and on close, logs how many lines sampled.
+type Sampler struct {
+	wr             io.WriteCloser
+	name           string
+	rate           int
+	keep           func(line []byte) bool
+	reportInterval time.Duration
+	ages           []AgeRate // rates by container's age, ascending, with NewAgeSampler only
+	started        time.Time // container's start, age counted from
+	now            func() time.Time
+
+	lock       sync.Mutex
+	seq        int // lines subject to sampling, for picking each rate's one
+	total      int // all lines since last report
+	written    int // written lines since last report
+	lastReport time.Time
+}
+
+// NewSampler makes Sampler for the writer. Rate <= 1 passes all lines. keep can be nil.
+func NewSampler(wr io.WriteCloser, name string, rate int, keep func(line []byte) bool) *Sampler {
+	return &Sampler{wr: wr, name: name, rate: rate, keep: keep, reportInterval: time.Minute, lastReport: time.Now(),
+		now: time.Now}
+}
+
+// AgeRate is sampling rate of containers running for at least Age
+type AgeRate struct {
+	Age  time.Duration
+	Rate int
+}
+
+// NewAgeSampler makes Sampler with rate picked by container's running time, counted from started. Rate of the
+// oldest age reached applies, so containers younger than all ages passed whole, and rate changes as container
+// gets older. Ages should be sorted in ascending order. keep can be nil.
+func NewAgeSampler(wr io.WriteCloser, name string, started time.Time, ages []AgeRate, keep func(line []byte) bool) *Sampler {
+	res := NewSampler(wr, name, 1, keep)
+	res.ages, res.started = ages, started
+	res.updateRate()
+	return res
+}
+
+// Write samples lines of p and writes picked ones
+func (s *Sampler) Write(p []byte) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.updateRate()
+	for _, line := range bytes.SplitAfter(p, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		s.total++
+		if s.rate > 1 && (s.keep == nil || !s.keep(line)) {
+			s.seq++
+			if (s.seq-1)%s.rate != 0 {
+				continue
+			}
+		}
+		s.written++
+		if _, err := s.wr.Write(line); err != nil {
+			return 0, err
+		}
+	}
+
+	if time.Since(s.lastReport) >= s.reportInterval {
+		s.report()
+	}
+	return len(p), nil
+}
+
+// Close reports sampling stats and closes the underlying writer
+func (s *Sampler) Close() error {
+	s.lock.Lock()
+	s.report()
+	s.lock.Unlock()
+	return s.wr.Close()
+}
+
+// updateRate sets rate by container's age with NewAgeSampler, should be called with lock held
+func (s *Sampler) updateRate() {
+	if len(s.ages) == 0 {
+		return
+	}
+	age, rate := s.now().Sub(s.started), 1
+	for _, a := range s.ages {
+		if age >= a.Age {
+			rate = a.Rate
+		}
+	}
+	if rate == s.rate {
+		return
+	}
+	log.Printf("[INFO] %s running for %v, sample 1 of %d lines", s.name, age.Round(time.Second), rate)
+	s.rate, s.seq = rate, 0
+}
+
+// report logs and resets accounting, should be called with lock held
+func (s *Sampler) report() {
+	if s.total > 0 && s.written < s.total {
+		log.Printf("[INFO] %s sampled %d of %d lines", s.name, s.written, s.total)
+	}
+	s.total, s.written, s.lastReport = 0, 0, time.Now()
+}
@@ -0,0 +1,87 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSampler_Write(t *testing.T) {
+	wr := &wrMock{}
+	s := NewSampler(wr, "c1", 3, func(line []byte) bool { return bytes.Contains(line, []byte("ERROR")) })
+	for i := 0; i < 10; i++ {
+		_, err := s.Write([]byte(fmt.Sprintf("line %d\n", i)))
+		require.NoError(t, err)
+	}
+	n, err := s.Write([]byte("ERROR 1\nline 10\nERROR 2\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 24, n)
+	assert.Equal(t, "line 0\nline 3\nline 6\nline 9\nERROR 1\nERROR 2\n", wr.String())
+	assert.Equal(t, 13, s.total)
+	assert.Equal(t, 6, s.written)
+	require.NoError(t, s.Close())
+	assert.Equal(t, 0, s.total, "reset on close")
+}
+
+func TestSampler_WriteNoSampling(t *testing.T) {
+	wr := &wrMock{}
+	s := NewSampler(wr, "c1", 1, nil)
+	for i := 0; i < 5; i++ {
+		_, err := s.Write([]byte(fmt.Sprintf("line %d\n", i)))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 5, strings.Count(wr.String(), "\n"))
+}
+
+func TestSampler_Report(t *testing.T) {
+	wr := &wrMock{}
+	s := NewSampler(wr, "c1", 2, nil)
+	s.reportInterval = 10 * time.Millisecond
+	_, err := s.Write([]byte("line 1\nline 2\nline 3\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, s.total)
+	time.Sleep(20 * time.Millisecond)
+	_, err = s.Write([]byte("line 4\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, s.total, "reported and reset")
+}
+
+func TestSampler_AgeRates(t *testing.T) {
+	started := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	ages := []AgeRate{{Age: time.Hour, Rate: 2}, {Age: 24 * time.Hour, Rate: 4}}
+	tbl := []struct {
+		age  time.Duration
+		rate int
+	}{
+		{0, 1}, {59 * time.Minute, 1}, {time.Hour, 2}, {23 * time.Hour, 2}, {24 * time.Hour, 4}, {30 * 24 * time.Hour, 4},
+	}
+	for _, tt := range tbl {
+		s := NewAgeSampler(&wrMock{}, "c1", started, ages, nil)
+		s.now = func() time.Time { return started.Add(tt.age) }
+		s.updateRate()
+		assert.Equal(t, tt.rate, s.rate, "age %v", tt.age)
+	}
+}
+
+func TestSampler_AgeTransition(t *testing.T) {
+	wr := &wrMock{}
+	s := NewAgeSampler(wr, "c1", time.Now(), []AgeRate{{Age: time.Hour, Rate: 3}},
+		func(line []byte) bool { return bytes.Contains(line, []byte("ERROR")) })
+	assert.Equal(t, 1, s.rate, "young container not sampled")
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	_, err := s.Write([]byte("line 1\nline 2\nline 3\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "line 1\nline 2\nline 3\n", wr.String())
+
+	now = now.Add(2 * time.Hour)
+	_, err = s.Write([]byte("line 4\nline 5\nERROR 1\nline 6\nline 7\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, s.rate)
+	assert.Equal(t, "line 1\nline 2\nline 3\nline 4\nERROR 1\nline 7\n", wr.String(), "sampled from the first line once old")
+}
@@ -0,0 +1,111 @@
+package logger
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// SharedWriter is a WriteCloser shared by multiple containers, i.e. a single rotating file of the group.
+// Each container writes through its own handle made by Handle. Handles pass whole lines only, each line with
+// handle's prefix, in a single write, so lines of different containers interleave but never mix.
+// Writes serialized, so rotation of the underlying writer never sees concurrent writes.
+// The underlying writer closed with the last handle, onClose called after that.
+type SharedWriter struct {
+	wr      io.WriteCloser
+	onClose func(s *SharedWriter)
+
+	lock   sync.Mutex
+	refs   int
+	closed bool
+}
+
+// NewSharedWriter makes SharedWriter for the writer, onClose can be nil
+func NewSharedWriter(wr io.WriteCloser, onClose func(s *SharedWriter)) *SharedWriter {
+	return &SharedWriter{wr: wr, onClose: onClose}
+}
+
+// Handle makes container's writer with prefix added to each line, i.e. container name.
+// Returns false if the shared writer closed already, as all its handles closed.
+func (s *SharedWriter) Handle(prefix string) (io.WriteCloser, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return nil, false
+	}
+	s.refs++
+	return &sharedHandle{shared: s, prefix: []byte(prefix)}, true
+}
+
+// writeLine writes prefixed line to the underlying writer
+func (s *SharedWriter) writeLine(prefix, line []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	msg := make([]byte, 0, len(prefix)+len(line))
+	_, err := s.wr.Write(append(append(msg, prefix...), line...))
+	return err
+}
+
+// release drops handle, closes the underlying writer with the last one
+func (s *SharedWriter) release() error {
+	s.lock.Lock()
+	s.refs--
+	if s.refs > 0 {
+		s.lock.Unlock()
+		return nil
+	}
+	s.closed = true
+	err := s.wr.Close()
+	s.lock.Unlock()
+	if s.onClose != nil {
+		s.onClose(s)
+	}
+	return err
+}
+
+// sharedHandle is container's writer of SharedWriter, buffers partial lines across writes
+type sharedHandle struct {
+	shared *SharedWriter
+	prefix []byte
+
+	lock   sync.Mutex
+	buf    []byte
+	closed bool
+}
+
+// Write buffers p and writes all complete lines
+func (h *sharedHandle) Write(p []byte) (int, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.buf = append(h.buf, p...)
+	start := 0
+	for {
+		i := bytes.IndexByte(h.buf[start:], '\n')
+		if i < 0 {
+			break
+		}
+		if err := h.shared.writeLine(h.prefix, h.buf[start:start+i+1]); err != nil {
+			h.buf = h.buf[:copy(h.buf, h.buf[start+i+1:])]
+			return 0, err
+		}
+		start += i + 1
+	}
+	h.buf = h.buf[:copy(h.buf, h.buf[start:])]
+	return len(p), nil
+}
+
+// Close writes buffered partial line, ended with newline, and releases the shared writer. Safe to call multiple times.
+func (h *sharedHandle) Close() error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.closed {
+		return nil
+	}
+	h.closed = true
+	if len(h.buf) > 0 {
+		_ = h.shared.writeLine(h.prefix, append(h.buf, '\n'))
+		h.buf = nil
+	}
+	return h.shared.release()
+}
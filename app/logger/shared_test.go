@@ -0,0 +1,114 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSharedWriter(t *testing.T) {
+	wr := &lockedBuffer{}
+	var closed []*SharedWriter
+	s := NewSharedWriter(wr, func(s *SharedWriter) { closed = append(closed, s) })
+
+	h1, ok := s.Handle("c1 ")
+	require.True(t, ok)
+	h2, ok := s.Handle("c2 ")
+	require.True(t, ok)
+
+	_, err := h1.Write([]byte("line1\npart"))
+	require.NoError(t, err)
+	_, err = h2.Write([]byte("line2\n"))
+	require.NoError(t, err)
+	_, err = h1.Write([]byte("ial\nunterminated"))
+	require.NoError(t, err)
+	assert.Equal(t, "c1 line1\nc2 line2\nc1 partial\n", wr.String(), "partial lines kept until complete")
+
+	require.NoError(t, h1.Close())
+	require.NoError(t, h1.Close(), "second close ignored")
+	assert.Equal(t, "c1 line1\nc2 line2\nc1 partial\nc1 unterminated\n", wr.String())
+	assert.False(t, wr.closed, "still used by h2")
+	assert.Empty(t, closed)
+
+	require.NoError(t, h2.Close())
+	assert.True(t, wr.closed, "closed with the last handle")
+	assert.Equal(t, []*SharedWriter{s}, closed)
+
+	_, ok = s.Handle("c3 ")
+	assert.False(t, ok, "closed shared writer can't make handles")
+}
+
+func TestSharedWriter_Concurrent(t *testing.T) {
+	wr := &lockedBuffer{}
+	s := NewSharedWriter(wr, nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		h, ok := s.Handle(fmt.Sprintf("c%d ", i))
+		require.True(t, ok)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := h.Write([]byte("some "))
+				assert.NoError(t, err)
+				_, err = h.Write([]byte("line\n"))
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, h.Close())
+		}()
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSuffix(wr.String(), "\n"), "\n")
+	assert.Len(t, lines, 1000)
+	for _, line := range lines {
+		assert.Regexp(t, `^c\d some line$`, line, "lines never mixed")
+	}
+	assert.True(t, wr.closed)
+}
+
+func TestSharedWriter_WriteError(t *testing.T) {
+	s := NewSharedWriter(&errWriter{}, nil)
+	h, ok := s.Handle("c1 ")
+	require.True(t, ok)
+	_, err := h.Write([]byte("line\n"))
+	assert.EqualError(t, err, "write failed")
+	assert.NoError(t, h.Close())
+}
+
+// lockedBuffer is a WriteCloser collecting writes, safe for concurrent use
+type lockedBuffer struct {
+	lock   sync.Mutex
+	buf    bytes.Buffer
+	closed bool
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.closed = true
+	return nil
+}
+
+func (b *lockedBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
+type errWriter struct{}
+
+func (errWriter) Write([]byte) (int, error) { return 0, errors.New("write failed") }
+func (errWriter) Close() error              { return nil }
@@ -0,0 +1,75 @@
+package logger
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// TruncationMarker ends parts of overlong line force-split by LineSplitter
+const TruncationMarker = " [...]"
+
+// LineSplitter is a WriteCloser passing complete lines to the underlying writer, a single line per write.
+// Docker log frames don't align to lines, so partial lines buffered across writes. Lines longer than
+// max length force-split, each part but the last ends with TruncationMarker.
+type LineSplitter struct {
+	wr     io.WriteCloser
+	maxLen int
+
+	lock sync.Mutex
+	buf  []byte
+}
+
+// NewLineSplitter makes LineSplitter for the writer, maxLen <= 0 means no limit
+func NewLineSplitter(wr io.WriteCloser, maxLen int) *LineSplitter {
+	return &LineSplitter{wr: wr, maxLen: maxLen}
+}
+
+// Write buffers p and writes all complete lines
+func (s *LineSplitter) Write(p []byte) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.buf = append(s.buf, p...)
+	start := 0
+	for start < len(s.buf) {
+		rest := s.buf[start:]
+		i := bytes.IndexByte(rest, '\n')
+		if i >= 0 && (s.maxLen <= 0 || i <= s.maxLen) {
+			if _, err := s.wr.Write(rest[:i+1]); err != nil {
+				s.compact(start + i + 1)
+				return 0, err
+			}
+			start += i + 1
+			continue
+		}
+		if s.maxLen <= 0 || len(rest) <= s.maxLen {
+			break // partial line, wait for the rest
+		}
+		part := make([]byte, 0, s.maxLen+len(TruncationMarker)+1)
+		part = append(append(append(part, rest[:s.maxLen]...), TruncationMarker...), '\n')
+		if _, err := s.wr.Write(part); err != nil {
+			s.compact(start + s.maxLen)
+			return 0, err
+		}
+		start += s.maxLen
+	}
+	s.compact(start)
+	return len(p), nil
+}
+
+// Close writes buffered partial line and closes the underlying writer
+func (s *LineSplitter) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.buf) > 0 {
+		_, _ = s.wr.Write(s.buf)
+		s.buf = nil
+	}
+	return s.wr.Close()
+}
+
+// compact drops written n bytes from the buffer, reusing its memory
+func (s *LineSplitter) compact(n int) {
+	s.buf = s.buf[:copy(s.buf, s.buf[n:])]
+}
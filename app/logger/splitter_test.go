@@ -0,0 +1,79 @@
+package logger
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLineSplitter_Write(t *testing.T) {
+	stream := "line 1\nline 2\n\nlong line of 24 symbols\nshort\nend"
+	expected := []string{"line 1\n", "line 2\n", "\n", "long line of" + TruncationMarker + "\n", " 24 symbols\n", "short\n", "end"}
+
+	for chunk := 1; chunk <= len(stream); chunk++ { // stream chopped at any boundary makes the same lines
+		wr := &writesMock{}
+		s := NewLineSplitter(wr, 12)
+		for i := 0; i < len(stream); i += chunk {
+			n, err := s.Write([]byte(stream[i:min(i+chunk, len(stream))]))
+			require.NoError(t, err)
+			assert.Equal(t, min(chunk, len(stream)-i), n)
+		}
+		require.NoError(t, s.Close())
+		assert.Equal(t, expected, wr.writes, "chunk %d", chunk)
+		assert.True(t, wr.closed)
+	}
+}
+
+func TestLineSplitter_NoLimit(t *testing.T) {
+	wr := &writesMock{}
+	s := NewLineSplitter(wr, 0)
+	long := strings.Repeat("x", 100000)
+	_, err := s.Write([]byte("l1\nl2\n" + long[:50000]))
+	require.NoError(t, err)
+	_, err = s.Write([]byte(long[50000:] + "\nl3"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"l1\n", "l2\n", long + "\n"}, wr.writes)
+	require.NoError(t, s.Close())
+	assert.Equal(t, []string{"l1\n", "l2\n", long + "\n", "l3"}, wr.writes)
+}
+
+func TestLineSplitter_ExactLimit(t *testing.T) {
+	wr := &writesMock{}
+	s := NewLineSplitter(wr, 5)
+	_, err := s.Write([]byte("12345\n123456\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"12345\n", "12345" + TruncationMarker + "\n", "6\n"}, wr.writes)
+}
+
+func TestLineSplitter_WriteError(t *testing.T) {
+	wr := &writesMock{err: errors.New("failed")}
+	s := NewLineSplitter(wr, 0)
+	_, err := s.Write([]byte("l1\nl2\n"))
+	require.Error(t, err)
+	wr.err = nil
+	_, err = s.Write([]byte("l3\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"l2\n", "l3\n"}, wr.writes, "failed line dropped, the rest kept")
+}
+
+type writesMock struct {
+	writes []string
+	err    error
+	closed bool
+}
+
+func (m *writesMock) Write(p []byte) (int, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+	m.writes = append(m.writes, string(p))
+	return len(p), nil
+}
+
+func (m *writesMock) Close() error {
+	m.closed = true
+	return nil
+}
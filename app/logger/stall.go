@@ -0,0 +1,146 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync/atomic"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+)
+
+// errStalled returned by followLogs for follow stream torn down as stalled
+var errStalled = errors.New("log stream stalled")
+
+// errUnread aborts stall probe once the first unread line found
+var errUnread = errors.New("unread line found")
+
+// followLogs runs blocking follow call of logs api. With ReadTimeout the stream watched, and torn down with
+// errStalled if nothing read within the timeout while container has lines written after the last seen one.
+func (l *LogStreamer) followLogs(opts docker.LogsOptions) error {
+	if l.ReadTimeout <= 0 {
+		return l.DockerClient.Logs(opts)
+	}
+	ctx, cancel := context.WithCancel(opts.Context)
+	defer cancel()
+	reads := &readActivity{}
+	reads.touch()
+	opts.Context = ctx
+	opts.OutputStream = &activityWriter{wr: opts.OutputStream, reads: reads}
+	opts.ErrorStream = &activityWriter{wr: opts.ErrorStream, reads: reads}
+
+	stalled := make(chan struct{})
+	go func() {
+		if l.watchReads(ctx, reads, time.Now()) {
+			close(stalled)
+			cancel()
+		}
+	}()
+	err := l.DockerClient.Logs(opts)
+	select {
+	case <-stalled:
+		return errStalled
+	default:
+		return err
+	}
+}
+
+// watchReads waits for ReadTimeout without reads and probes container for unread lines, returns true if found.
+// Container without new lines is idle, not stuck, watched for another timeout. Returns false once ctx canceled.
+func (l *LogStreamer) watchReads(ctx context.Context, reads *readActivity, started time.Time) bool {
+	for {
+		wait := l.ReadTimeout - time.Since(reads.last())
+		if wait > 0 {
+			select {
+			case <-ctx.Done():
+				return false
+			case <-time.After(wait):
+			}
+			continue
+		}
+		if l.hasUnread(ctx, started) {
+			return true
+		}
+		reads.touch() // idle, check again after another timeout
+	}
+}
+
+// hasUnread checks if container has lines after the last seen one, or after started if none seen,
+// by non-follow logs call aborted on the first such line
+func (l *LogStreamer) hasUnread(ctx context.Context, started time.Time) bool {
+	floor := l.seen.get()
+	if floor.IsZero() {
+		floor = started
+	}
+	ctx, cancel := context.WithTimeout(ctx, l.ReadTimeout)
+	defer cancel()
+	probe := &unreadWriter{floor: floor}
+	err := l.DockerClient.Logs(docker.LogsOptions{Container: l.ContainerID, OutputStream: probe, ErrorStream: probe,
+		Stdout: l.Streams.stdout(), Stderr: l.Streams.stderr(), Timestamps: true, Since: floor.Unix(), Context: ctx})
+	if err != nil && !probe.found && ctx.Err() == nil {
+		log.Printf("[WARN] can't check stream of %s for unread lines, %v", l.ContainerName, err)
+	}
+	return probe.found
+}
+
+// resumeOpts makes follow options continuing from the last seen line after stalled stream,
+// lines seen already dropped. Options kept as is if nothing seen, so the stream restarted with the same tail.
+func (l *LogStreamer) resumeOpts(opts docker.LogsOptions) docker.LogsOptions {
+	floor := l.seen.get()
+	if floor.IsZero() {
+		return opts
+	}
+	opts.Since, opts.Tail = floor.Unix(), "all"
+	opts.OutputStream = &tsWriter{wr: l.LogWriter, seen: l.seen, floor: floor, lineTime: l.LineTime}
+	opts.ErrorStream = &tsWriter{wr: l.ErrWriter, seen: l.seen, floor: floor, lineTime: l.ErrLineTime}
+	return opts
+}
+
+// readActivity keeps time of the last read of a stream, safe for concurrent use
+type readActivity struct {
+	ts atomic.Int64
+}
+
+func (r *readActivity) touch() {
+	r.ts.Store(time.Now().UnixNano())
+}
+
+func (r *readActivity) last() time.Time {
+	return time.Unix(0, r.ts.Load())
+}
+
+// activityWriter passes writes to the underlying writer, recording time of each one
+type activityWriter struct {
+	wr    io.Writer
+	reads *readActivity
+}
+
+// Write records the read and writes p
+func (w *activityWriter) Write(p []byte) (int, error) {
+	w.reads.touch()
+	return w.wr.Write(p)
+}
+
+// unreadWriter checks timestamped lines for the one after floor, failing write once found
+type unreadWriter struct {
+	floor time.Time
+	found bool
+}
+
+// Write sets found and returns errUnread for line with timestamp after floor
+func (w *unreadWriter) Write(p []byte) (int, error) {
+	for _, line := range bytes.SplitAfter(p, []byte("\n")) {
+		idx := bytes.IndexByte(line, ' ')
+		if idx <= 0 {
+			continue
+		}
+		if ts, err := time.Parse(time.RFC3339Nano, string(line[:idx])); err == nil && ts.After(w.floor) {
+			w.found = true
+			return 0, errUnread
+		}
+	}
+	return len(p), nil
+}
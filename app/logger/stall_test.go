@@ -0,0 +1,121 @@
+package logger
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockStallLogClient makes the first follow stall after a line, while container keeps logging,
+// visible to non-follow calls only. Follows after reconnect deliver all lines.
+type mockStallLogClient struct {
+	lock    sync.Mutex
+	follows []docker.LogsOptions
+	probes  int
+	idle    bool // container logs nothing after the first line
+}
+
+func (m *mockStallLogClient) Logs(opts docker.LogsOptions) error {
+	m.lock.Lock()
+	lines := []string{"2024-05-01T10:00:01.1Z line 1\n", "2024-05-01T10:00:02.1Z line 2\n"}
+	if m.idle {
+		lines = lines[:1]
+	}
+	if !opts.Follow {
+		m.probes++
+		m.lock.Unlock()
+		for _, line := range lines {
+			if _, err := opts.OutputStream.Write([]byte(line)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	m.follows = append(m.follows, opts)
+	first := len(m.follows) == 1
+	m.lock.Unlock()
+
+	if first {
+		lines = lines[:1] // stalled after the first line
+	}
+	for _, line := range lines {
+		_, _ = opts.OutputStream.Write([]byte(line))
+	}
+	<-opts.Context.Done()
+	return nil
+}
+
+func (m *mockStallLogClient) calls() (follows []docker.LogsOptions, probes int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]docker.LogsOptions{}, m.follows...), m.probes
+}
+
+func TestLogger_ReadTimeoutStalled(t *testing.T) {
+	mock := &mockStallLogClient{}
+	lw := &wrMock{}
+	l := &LogStreamer{ContainerID: "test_id", ContainerName: "test_name", DockerClient: mock,
+		LogWriter: lw, ErrWriter: &wrMock{}, ReadTimeout: 50 * time.Millisecond}
+	l = l.Go(context.Background())
+	require.Eventually(t, func() bool {
+		follows, _ := mock.calls()
+		return len(follows) == 2
+	}, time.Second, 5*time.Millisecond, "reconnected")
+	time.Sleep(20 * time.Millisecond)
+	l.Close()
+
+	follows, probes := mock.calls()
+	assert.Equal(t, 1, probes)
+	assert.Equal(t, "10", follows[0].Tail)
+	assert.True(t, follows[0].Timestamps)
+	assert.Equal(t, "all", follows[1].Tail, "resumed from the last seen line")
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 0, 1, 0, time.UTC).Unix(), follows[1].Since)
+	assert.Equal(t, "line 1\nline 2\n", lw.String(), "seen line not duplicated")
+}
+
+func TestLogger_ReadTimeoutIdle(t *testing.T) {
+	mock := &mockStallLogClient{idle: true}
+	lw := &wrMock{}
+	l := &LogStreamer{ContainerID: "test_id", ContainerName: "test_name", DockerClient: mock,
+		LogWriter: lw, ErrWriter: &wrMock{}, ReadTimeout: 30 * time.Millisecond}
+	l = l.Go(context.Background())
+	require.Eventually(t, func() bool {
+		_, probes := mock.calls()
+		return probes >= 2
+	}, time.Second, 5*time.Millisecond, "checked every timeout")
+	l.Close()
+
+	follows, _ := mock.calls()
+	assert.Len(t, follows, 1, "idle stream kept")
+	assert.Equal(t, "line 1\n", lw.String())
+}
+
+func TestLogger_ReadTimeoutDisabled(t *testing.T) {
+	mock := &mockStallLogClient{}
+	l := &LogStreamer{ContainerID: "test_id", ContainerName: "test_name", DockerClient: mock,
+		LogWriter: &wrMock{}, ErrWriter: &wrMock{}}
+	l = l.Go(context.Background())
+	time.Sleep(50 * time.Millisecond)
+	l.Close()
+	follows, probes := mock.calls()
+	assert.Len(t, follows, 1)
+	assert.Zero(t, probes)
+	assert.False(t, follows[0].Timestamps)
+}
+
+func TestUnreadWriter(t *testing.T) {
+	w := &unreadWriter{floor: time.Date(2024, 5, 1, 10, 0, 1, 100, time.UTC)}
+	data := []byte("2024-05-01T10:00:01.0000001Z seen\nno timestamp\n")
+	n, err := w.Write(data)
+	require.NoError(t, err)
+	assert.Equal(t, len(data), n)
+	assert.False(t, w.found)
+	_, err = w.Write([]byte("2024-05-01T10:00:01.2Z new\n"))
+	assert.ErrorIs(t, err, errUnread)
+	assert.True(t, w.found)
+}
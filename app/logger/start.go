@@ -0,0 +1,41 @@
+package logger
+
+import (
+	"context"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+)
+
+// TailStart is Tail value streaming lines since container's start, from State.StartedAt of inspect
+const TailStart = "start"
+
+// ContainerStart returns container's start time, State.StartedAt of inspect. Client should implement
+// ContainerInspector.
+func ContainerStart(ctx context.Context, client LogClient, containerID string) (time.Time, error) {
+	inspector, ok := client.(ContainerInspector)
+	if !ok {
+		return time.Time{}, errors.New("docker client can't inspect containers")
+	}
+	c, err := inspector.InspectContainerWithOptions(docker.InspectContainerOptions{ID: containerID, Context: ctx})
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "can't inspect %s", containerID)
+	}
+	if c.State.StartedAt.IsZero() {
+		return time.Time{}, errors.Errorf("start time of %s unknown", containerID)
+	}
+	return c.State.StartedAt, nil
+}
+
+// startedAt returns container's start time for TailStart. Current time if the start unknown, so only new lines
+// streamed. DockerClient should implement ContainerInspector.
+func (l *LogStreamer) startedAt() time.Time {
+	res, err := ContainerStart(l.ctx, l.DockerClient, l.ContainerID)
+	if err != nil {
+		log.Printf("[WARN] start of %s unknown, stream new lines, %v", l.ContainerName, err)
+		return time.Now()
+	}
+	return res
+}
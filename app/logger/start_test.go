@@ -0,0 +1,131 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockStartClient reports container started at started, or fails inspect with inspectErr
+type mockStartClient struct {
+	started    time.Time
+	inspectErr error
+
+	sync.Mutex
+	logs []docker.LogsOptions
+}
+
+func (m *mockStartClient) Logs(opts docker.LogsOptions) error {
+	m.Lock()
+	m.logs = append(m.logs, opts)
+	m.Unlock()
+	if opts.Follow {
+		<-opts.Context.Done()
+	}
+	return nil
+}
+
+func (m *mockStartClient) InspectContainerWithOptions(docker.InspectContainerOptions) (*docker.Container, error) {
+	if m.inspectErr != nil {
+		return nil, m.inspectErr
+	}
+	return &docker.Container{State: docker.State{StartedAt: m.started}}, nil
+}
+
+func (m *mockStartClient) calls() []docker.LogsOptions {
+	m.Lock()
+	defer m.Unlock()
+	return append([]docker.LogsOptions{}, m.logs...)
+}
+
+func TestLogger_TailStart(t *testing.T) {
+	started := time.Date(2024, 5, 1, 10, 0, 0, 500_000_000, time.UTC)
+	mock := &mockStartClient{started: started}
+	l := &LogStreamer{ContainerID: "test_id", ContainerName: "test_name", DockerClient: mock,
+		LogWriter: &wrMock{}, ErrWriter: &wrMock{}, Tail: TailStart, FinalFetch: true}
+	l = l.Go(context.Background())
+	require.Eventually(t, func() bool { return len(mock.calls()) == 1 }, time.Second, 5*time.Millisecond)
+	l.Close()
+
+	logs := mock.calls()
+	require.Len(t, logs, 2)
+	assert.True(t, logs[0].Follow)
+	assert.Equal(t, started.Unix(), logs[0].Since, "streamed from the start")
+	assert.Equal(t, "all", logs[0].Tail)
+	assert.False(t, logs[1].Follow)
+	assert.Equal(t, started.Unix(), logs[1].Since, "nothing seen, final fetch from the start")
+	assert.Equal(t, "all", logs[1].Tail)
+}
+
+func TestLogger_TailStartFinalFetch(t *testing.T) {
+	started := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	mock := &mockStartClient{started: started}
+	l := &LogStreamer{ContainerID: "test_id", ContainerName: "test_name", DockerClient: mock,
+		LogWriter: &wrMock{}, ErrWriter: &wrMock{}, Tail: TailStart, FinalFetch: true}
+	l = l.Go(context.Background())
+	assert.Equal(t, started, l.since, "resolved before streaming")
+	l.Close()
+	logs := mock.calls()
+	require.NotEmpty(t, logs)
+	final := logs[len(logs)-1]
+	assert.False(t, final.Follow)
+	assert.Equal(t, started.Unix(), final.Since)
+	assert.Equal(t, "all", final.Tail, "closed before anything streamed")
+
+	// since unresolved, i.e. streamer never started
+	l = &LogStreamer{ContainerID: "test_id", ContainerName: "test_name", DockerClient: mock, Tail: TailStart,
+		LogWriter: &wrMock{}, ErrWriter: &wrMock{}, seen: &lastSeen{}, parent: context.Background()}
+	l.fetchFinal()
+	logs = mock.calls()
+	final = logs[len(logs)-1]
+	assert.Equal(t, started.Unix(), final.Since)
+	assert.Equal(t, "all", final.Tail, "never passed to docker as is")
+}
+
+func TestLogger_TailStartUnknown(t *testing.T) {
+	tbl := []struct {
+		name   string
+		client LogClient
+	}{
+		{"no start time", &mockStartClient{}},
+		{"inspect failed", &mockStartClient{inspectErr: errors.New("inspect failed")}},
+		{"no inspector", &mockFinalLogClient{}},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &LogStreamer{ContainerID: "test_id", ContainerName: "test_name", DockerClient: tt.client, Tail: TailStart}
+			l.ctx = context.Background()
+			before := time.Now()
+			assert.WithinDuration(t, before, l.startedAt(), time.Second, "new lines only")
+		})
+	}
+
+	mock := &mockStartClient{}
+	l := &LogStreamer{ContainerID: "test_id", ContainerName: "test_name", DockerClient: mock,
+		LogWriter: &wrMock{}, ErrWriter: &wrMock{}, Tail: TailStart}
+	l = l.Go(context.Background())
+	require.Eventually(t, func() bool { return len(mock.calls()) == 1 }, time.Second, 5*time.Millisecond)
+	l.Close()
+	logs := mock.calls()
+	assert.InDelta(t, time.Now().Unix(), logs[0].Since, 1, "streamed since now")
+	assert.Equal(t, "all", logs[0].Tail)
+}
+
+func TestLogger_TailStartWaitHealthy(t *testing.T) {
+	passed := time.Date(2024, 5, 1, 10, 0, 5, 0, time.UTC)
+	mock := &mockHealthClient{statuses: []string{"starting", "healthy"}, passed: passed}
+	l := &LogStreamer{ContainerID: "test_id", ContainerName: "test_name", DockerClient: mock,
+		LogWriter: &wrMock{}, ErrWriter: &wrMock{}, Tail: TailStart, WaitHealthy: time.Second, healthPoll: 10 * time.Millisecond}
+	l = l.Go(context.Background())
+	require.Eventually(t, func() bool { _, logs := mock.calls(); return len(logs) == 1 }, time.Second, 5*time.Millisecond)
+	l.Close()
+	inspects, logs := mock.calls()
+	assert.Equal(t, 2, inspects, "start not inspected once waited")
+	assert.Equal(t, passed.Unix(), logs[0].Since, "the passed check is later than the start")
+}
@@ -0,0 +1,52 @@
+package logger
+
+import (
+	"strings"
+)
+
+// Streams selects output streams of container collected by LogStreamer
+type Streams int
+
+// enum of all stream selections
+const (
+	StreamsBoth   Streams = iota // stdout and stderr, default
+	StreamsStdout                // stdout only
+	StreamsStderr                // stderr only
+)
+
+// String returns selection name
+func (s Streams) String() string {
+	switch s {
+	case StreamsStdout:
+		return "stdout"
+	case StreamsStderr:
+		return "stderr"
+	default:
+		return "both"
+	}
+}
+
+// ParseStreams makes selection from its name, stdout, stderr or both, case-insensitive.
+// Returns false for unknown names.
+func ParseStreams(name string) (Streams, bool) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "both":
+		return StreamsBoth, true
+	case "stdout":
+		return StreamsStdout, true
+	case "stderr":
+		return StreamsStderr, true
+	default:
+		return StreamsBoth, false
+	}
+}
+
+// stdout checks if stdout selected
+func (s Streams) stdout() bool {
+	return s != StreamsStderr
+}
+
+// stderr checks if stderr selected
+func (s Streams) stderr() bool {
+	return s != StreamsStdout
+}
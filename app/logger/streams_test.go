@@ -0,0 +1,90 @@
+package logger
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStreams(t *testing.T) {
+	tbl := []struct {
+		name string
+		res  Streams
+		ok   bool
+	}{
+		{"stdout", StreamsStdout, true}, {"STDERR", StreamsStderr, true}, {" both ", StreamsBoth, true},
+		{"", StreamsBoth, false}, {"stdin", StreamsBoth, false},
+	}
+	for _, tt := range tbl {
+		res, ok := ParseStreams(tt.name)
+		assert.Equal(t, tt.res, res, tt.name)
+		assert.Equal(t, tt.ok, ok, tt.name)
+	}
+	assert.Equal(t, "stdout", StreamsStdout.String())
+	assert.Equal(t, "stderr", StreamsStderr.String())
+	assert.Equal(t, "both", StreamsBoth.String())
+}
+
+func TestLogger_Streams(t *testing.T) {
+	tbl := []struct {
+		streams        Streams
+		stdout, stderr bool
+	}{
+		{StreamsBoth, true, true}, {StreamsStdout, true, false}, {StreamsStderr, false, true},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.streams.String(), func(t *testing.T) {
+			mock := &mockFinalLogClient{}
+			l := &LogStreamer{ContainerID: "test_id", ContainerName: "test_name", DockerClient: mock,
+				LogWriter: &wrMock{}, ErrWriter: &wrMock{}, FinalFetch: true, Streams: tt.streams}
+			l = l.Go(context.Background())
+			time.Sleep(50 * time.Millisecond)
+			l.Close()
+
+			require.Len(t, mock.calls, 2)
+			for _, call := range mock.calls {
+				assert.Equal(t, tt.stdout, call.Stdout, "follow and final fetch")
+				assert.Equal(t, tt.stderr, call.Stderr, "follow and final fetch")
+			}
+		})
+	}
+}
+
+func TestLogger_StreamsTailFiles(t *testing.T) {
+	records := `{"log":"line 1\n","stream":"stdout","time":"2024-05-01T10:00:01Z"}` + "\n" +
+		`{"log":"err 1\n","stream":"stderr","time":"2024-05-01T10:00:02Z"}` + "\n"
+	tbl := []struct {
+		streams     Streams
+		lines, errs string
+	}{
+		{StreamsBoth, "line 1\n", "err 1\n"},
+		{StreamsStdout, "line 1\n", ""},
+		{StreamsStderr, "", "err 1\n"},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.streams.String(), func(t *testing.T) {
+			logPath := filepath.Join(t.TempDir(), "c1-json.log")
+			require.NoError(t, os.WriteFile(logPath, nil, 0o600))
+			lw, ew := &wrMock{}, &wrMock{}
+			l := &LogStreamer{ContainerID: "test_id", ContainerName: "test_name", LogWriter: lw, ErrWriter: ew,
+				DockerClient: &mockInspectLogClient{driver: "json-file", logPath: logPath}, TailFiles: true, Streams: tt.streams}
+			l = l.Go(context.Background())
+			time.Sleep(50 * time.Millisecond)
+			fh, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0o600) //nolint:gosec // test file
+			require.NoError(t, err)
+			_, err = fh.WriteString(records)
+			require.NoError(t, err)
+			require.NoError(t, fh.Close())
+			time.Sleep(3 * tailPollInterval)
+			l.Close()
+
+			assert.Equal(t, tt.lines, lw.String())
+			assert.Equal(t, tt.errs, ew.String())
+		})
+	}
+}
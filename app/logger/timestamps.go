@@ -0,0 +1,84 @@
+package logger
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+)
+
+// lastSeen keeps timestamp of the last written log line, shared by stdout and stderr writers of a stream
+type lastSeen struct {
+	sync.Mutex
+	ts time.Time
+}
+
+func (l *lastSeen) get() time.Time {
+	l.Lock()
+	defer l.Unlock()
+	return l.ts
+}
+
+func (l *lastSeen) update(ts time.Time) {
+	l.Lock()
+	defer l.Unlock()
+	if ts.After(l.ts) {
+		l.ts = ts
+	}
+}
+
+// LineTime keeps docker timestamp of the line being written, passed from LogStreamer to MultiWriter of the same
+// container's stream. Works as the pipeline between them writes each line synchronously. Safe for concurrent use.
+type LineTime struct {
+	sync.Mutex
+	ts time.Time
+}
+
+// Get returns docker timestamp of the current line, zero if unknown
+func (l *LineTime) Get() time.Time {
+	l.Lock()
+	defer l.Unlock()
+	return l.ts
+}
+
+func (l *LineTime) set(ts time.Time) {
+	l.Lock()
+	defer l.Unlock()
+	l.ts = ts
+}
+
+// tsWriter strips docker timestamps (enabled by LogsOptions.Timestamps) from each line and records the last one to seen.
+// Lines with timestamp not after floor are dropped, used to deduplicate lines written already.
+// Timestamp of each written line passed to lineTime, if set.
+type tsWriter struct {
+	wr       io.Writer
+	seen     *lastSeen
+	floor    time.Time
+	lineTime *LineTime
+}
+
+// Write splits p to lines and writes each line without timestamp prefix
+func (w *tsWriter) Write(p []byte) (int, error) {
+	for _, line := range bytes.SplitAfter(p, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var lineTS time.Time
+		if idx := bytes.IndexByte(line, ' '); idx > 0 {
+			if ts, err := time.Parse(time.RFC3339Nano, string(line[:idx])); err == nil {
+				if !w.floor.IsZero() && !ts.After(w.floor) {
+					continue // written already
+				}
+				w.seen.update(ts)
+				line, lineTS = line[idx+1:], ts
+			}
+		}
+		if w.lineTime != nil {
+			w.lineTime.set(lineTS)
+		}
+		if _, err := w.wr.Write(line); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
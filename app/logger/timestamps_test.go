@@ -0,0 +1,55 @@
+package logger
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTsWriter_Write(t *testing.T) {
+	buf := bytes.Buffer{}
+	seen := lastSeen{}
+	w := tsWriter{wr: &buf, seen: &seen}
+
+	n, err := w.Write([]byte("2024-05-01T10:00:00.000000001Z line 1\n2024-05-01T10:00:00.5Z line 2\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 68, n)
+	_, err = w.Write([]byte("no timestamp line\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "line 1\nline 2\nno timestamp line\n", buf.String())
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 0, 0, 500000000, time.UTC), seen.get())
+}
+
+func TestTsWriter_WriteWithFloor(t *testing.T) {
+	buf := bytes.Buffer{}
+	seen := lastSeen{}
+	w := tsWriter{wr: &buf, seen: &seen, floor: time.Date(2024, 5, 1, 10, 0, 0, 500000000, time.UTC)}
+
+	_, err := w.Write([]byte("2024-05-01T10:00:00.000000001Z line 1\n2024-05-01T10:00:00.5Z line 2\n"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("2024-05-01T10:00:00.6Z line 3\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "line 3\n", buf.String(), "lines not after floor dropped")
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 0, 0, 600000000, time.UTC), seen.get())
+}
+
+func TestTsWriter_WriteLineTime(t *testing.T) {
+	lt := &LineTime{}
+	var times []time.Time
+	wr := writerFunc(func(p []byte) (int, error) {
+		times = append(times, lt.Get())
+		return len(p), nil
+	})
+	w := tsWriter{wr: wr, seen: &lastSeen{}, lineTime: lt}
+	_, err := w.Write([]byte("2024-05-01T10:00:00.1Z line 1\nno timestamp\n2024-05-01T10:00:00.2Z line 3\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []time.Time{time.Date(2024, 5, 1, 10, 0, 0, 100000000, time.UTC), {},
+		time.Date(2024, 5, 1, 10, 0, 0, 200000000, time.UTC)}, times, "line time set before each write")
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
@@ -0,0 +1,78 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// TraceExtractor finds correlation id, i.e. trace id of distributed tracing, in log lines. Id taken from a field
+// of json lines or matched by regex in any line, the line itself not changed.
+type TraceExtractor struct {
+	field   []string       // path of the field in json lines, nil for regex extractor
+	pattern *regexp.Regexp // the first group, or the whole match if no groups, is the id
+}
+
+// ParseTraceExtractor makes extractor from spec, "json:field" for a field of json lines, with dots for nested
+// fields, i.e. "json:span.trace_id", or "re:regex" for id matched by regex, the first group if any,
+// i.e. `re:trace[-_]id=(\w+)`.
+func ParseTraceExtractor(spec string) (*TraceExtractor, error) {
+	kind, val, _ := strings.Cut(spec, ":")
+	switch {
+	case kind == "json" && val != "":
+		return &TraceExtractor{field: strings.Split(val, ".")}, nil
+	case kind == "re" && val != "":
+		re, err := regexp.Compile(val)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid trace id regex %q", val)
+		}
+		return &TraceExtractor{pattern: re}, nil
+	default:
+		return nil, errors.Errorf("invalid trace id spec %q, expected json:field or re:regex", spec)
+	}
+}
+
+// Extract returns correlation id of the line, empty if line has none, i.e. not a json object or has no such field.
+// String and number fields of json lines supported, other values ignored.
+func (t *TraceExtractor) Extract(line []byte) string {
+	if t.pattern != nil {
+		m := t.pattern.FindSubmatch(line)
+		switch {
+		case m == nil:
+			return ""
+		case len(m) > 1:
+			return string(m[1])
+		default:
+			return string(m[0])
+		}
+	}
+
+	obj := jsonObject(line)
+	if obj == nil {
+		return ""
+	}
+	val := json.RawMessage(obj)
+	for _, key := range t.field {
+		fields := map[string]json.RawMessage{}
+		if err := json.Unmarshal(val, &fields); err != nil {
+			return ""
+		}
+		if val = fields[key]; val == nil {
+			return ""
+		}
+	}
+	var id string
+	if err := json.Unmarshal(val, &id); err == nil {
+		return id
+	}
+	var num json.Number
+	dec := json.NewDecoder(bytes.NewReader(val))
+	dec.UseNumber()
+	if err := dec.Decode(&num); err == nil {
+		return num.String()
+	}
+	return ""
+}
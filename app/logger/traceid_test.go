@@ -0,0 +1,108 @@
+package logger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTraceExtractor(t *testing.T) {
+	ex, err := ParseTraceExtractor("json:span.trace_id")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"span", "trace_id"}, ex.field)
+
+	ex, err = ParseTraceExtractor(`re:trace=(\w+)`)
+	require.NoError(t, err)
+	assert.Equal(t, `trace=(\w+)`, ex.pattern.String())
+
+	for _, spec := range []string{"", "trace_id", "json:", "re:", "xml:id"} {
+		_, err = ParseTraceExtractor(spec)
+		require.Error(t, err, spec)
+		assert.Contains(t, err.Error(), "expected json:field or re:regex", spec)
+	}
+	_, err = ParseTraceExtractor("re:(")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid trace id regex "("`)
+}
+
+func TestTraceExtractorJSON(t *testing.T) {
+	ex, err := ParseTraceExtractor("json:trace_id")
+	require.NoError(t, err)
+	nested, err := ParseTraceExtractor("json:span.trace_id")
+	require.NoError(t, err)
+
+	tbl := []struct {
+		line       string
+		id, nested string
+	}{
+		{`{"msg":"started","trace_id":"4bf92f3577b34da6"}` + "\n", "4bf92f3577b34da6", ""},
+		{` {"trace_id":12345678901234567890} `, "12345678901234567890", ""},
+		{`{"span":{"trace_id":"abc"}}`, "", "abc"},
+		{`{"span":"abc"}`, "", ""},
+		{`{"trace_id":null,"span":{"trace_id":true}}`, "", ""},
+		{`{"trace_id":{"id":1}}`, "", ""},
+		{`{"msg":"no id"}`, "", ""},
+		{`{"trace_id":"abc"`, "", ""},
+		{`plain trace_id=abc`, "", ""},
+		{``, "", ""},
+	}
+	for _, tt := range tbl {
+		assert.Equal(t, tt.id, ex.Extract([]byte(tt.line)), tt.line)
+		assert.Equal(t, tt.nested, nested.Extract([]byte(tt.line)), tt.line)
+	}
+}
+
+func TestTraceExtractorRegex(t *testing.T) {
+	group, err := ParseTraceExtractor(`re:trace[-_]id=(\w+)`)
+	require.NoError(t, err)
+	whole, err := ParseTraceExtractor(`re:[0-9a-f]{32}`)
+	require.NoError(t, err)
+
+	assert.Equal(t, "abc123", group.Extract([]byte("GET /api 200 trace-id=abc123 took 5ms\n")))
+	assert.Equal(t, "x", group.Extract([]byte(`{"msg":"trace_id=x"}`)), "any line matched")
+	assert.Equal(t, "", group.Extract([]byte("GET /api 200\n")))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736",
+		whole.Extract([]byte("traceparent: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")))
+}
+
+func TestMultiWriter_WithTraceID(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	ex, err := ParseTraceExtractor("json:trace_id")
+	require.NoError(t, err)
+	line := `{"msg":"started","trace_id":"t1"}` + "\n"
+
+	wr := wrMock{}
+	writer := NewMultiWriterIgnoreErrors(&wr).WithFormat(FormatJSON, "c1", "g1").WithHostname("h1").
+		WithClock(func() time.Time { return ts }).WithTraceID(ex)
+	_, err = writer.Write([]byte(line))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"msg":"{\"msg\":\"started\",\"trace_id\":\"t1\"}\n","container":"c1","group":"g1",
+		"ts":"2024-05-01T10:00:00Z","host":"h1","trace_id":"t1"}`, wr.String(), "line kept intact")
+
+	wr = wrMock{}
+	writer.WithJSONLines(JSONLinesNest)
+	_, err = writer.Write([]byte(line))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"msg":"started","container":"c1","group":"g1","ts":"2024-05-01T10:00:00Z","host":"h1",
+		"trace_id":"t1","fields":{"msg":"started","trace_id":"t1"}}`, wr.String())
+
+	wr = wrMock{}
+	_, err = writer.Write([]byte("no id\n"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"msg":"no id\n","container":"c1","group":"g1","ts":"2024-05-01T10:00:00Z","host":"h1"}`,
+		wr.String(), "trace_id omitted")
+
+	wr = wrMock{}
+	writer = NewMultiWriterIgnoreErrors(&wr).WithFormat(FormatLogfmt, "c1", "g1").WithHostname("h1").
+		WithClock(func() time.Time { return ts }).WithTraceID(ex)
+	_, err = writer.Write([]byte(line))
+	require.NoError(t, err)
+	assert.Equal(t, `ts=2024-05-01T10:00:00Z host=h1 container=c1 group=g1 trace_id=t1 msg="{\"msg\":\"started\",\"trace_id\":\"t1\"}"`+"\n",
+		wr.String())
+	wr = wrMock{}
+	_, err = writer.Write([]byte("no id\n"))
+	require.NoError(t, err)
+	assert.Equal(t, `ts=2024-05-01T10:00:00Z host=h1 container=c1 group=g1 msg="no id"`+"\n", wr.String())
+}
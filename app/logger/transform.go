@@ -0,0 +1,86 @@
+package logger
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"sync"
+)
+
+// Transformer is a WriteCloser rewriting each line with transform func before writing, i.e. to redact secrets.
+// Expects whole lines, as LineSplitter makes, partial line transformed on its own. Line dropped if
+// transform returns empty result.
+type Transformer struct {
+	wr        io.WriteCloser
+	transform func(line []byte) []byte
+
+	lock sync.Mutex
+}
+
+// NewTransformer makes Transformer for the writer
+func NewTransformer(wr io.WriteCloser, transform func(line []byte) []byte) *Transformer {
+	return &Transformer{wr: wr, transform: transform}
+}
+
+// Write transforms lines of p and writes results
+func (t *Transformer) Write(p []byte) (int, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, line := range bytes.SplitAfter(p, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		res := t.transform(line)
+		if len(res) == 0 {
+			continue
+		}
+		if _, err := t.wr.Write(res); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Close closes the underlying writer
+func (t *Transformer) Close() error {
+	return t.wr.Close()
+}
+
+// Redact makes transform func replacing matches of patterns with mask. For patterns with capture groups
+// the first group masked only, i.e. `password=(\S+)` keeps "password=" and masks the value.
+// Patterns applied in order to the line without trailing newline, so "$" matches end of line.
+func Redact(patterns []*regexp.Regexp, mask string) func(line []byte) []byte {
+	return func(line []byte) []byte {
+		body, nl := line, []byte(nil)
+		if bytes.HasSuffix(body, []byte("\n")) {
+			body, nl = body[:len(body)-1], []byte("\n")
+		}
+		for _, re := range patterns {
+			body = redactMatches(re, body, mask)
+		}
+		return append(body, nl...)
+	}
+}
+
+// redactMatches replaces all matches of re in line, or their first group, with mask
+func redactMatches(re *regexp.Regexp, line []byte, mask string) []byte {
+	matches := re.FindAllSubmatchIndex(line, -1)
+	if len(matches) == 0 {
+		return line
+	}
+	res := make([]byte, 0, len(line))
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if len(m) > 2 && m[2] >= 0 {
+			start, end = m[2], m[3]
+		}
+		if start < last || start == end {
+			continue // empty match, nothing to mask
+		}
+		res = append(append(res, line[last:start]...), mask...)
+		last = end
+	}
+	return append(res, line[last:]...)
+}
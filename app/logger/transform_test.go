@@ -0,0 +1,65 @@
+package logger
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransformer(t *testing.T) {
+	buf := &lockedBuffer{}
+	tr := NewTransformer(buf, func(line []byte) []byte {
+		if bytes.HasPrefix(line, []byte("drop")) {
+			return nil
+		}
+		return bytes.ToUpper(line)
+	})
+	_, err := tr.Write([]byte("line 1\ndrop me\nline 2\n"))
+	require.NoError(t, err)
+	_, err = tr.Write([]byte("partial"))
+	require.NoError(t, err)
+	assert.Equal(t, "LINE 1\nLINE 2\nPARTIAL", buf.String())
+	require.NoError(t, tr.Close())
+	assert.True(t, buf.closed)
+}
+
+func TestRedact(t *testing.T) {
+	tbl := []struct {
+		name     string
+		patterns []string
+		in, out  string
+	}{
+		{"no match", []string{`secret`}, "plain line\n", "plain line\n"},
+		{"whole match", []string{`tkn_[a-z0-9]+`}, "auth tkn_abc123 ok, tkn_x\n", "auth *** ok, ***\n"},
+		{"first group", []string{`password=(\S+)`}, "user=bob password=p@ss dir=/tmp\n", "user=bob password=*** dir=/tmp\n"},
+		{"end of line", []string{`token: (.*)$`}, "token: abc def\n", "token: ***\n"},
+		{"no newline", []string{`token: (.*)$`}, "token: abc", "token: ***"},
+		{"multiple patterns", []string{`(?i)bearer (\S+)`, `\d{4}-\d{4}-\d{4}-\d{4}`},
+			"Authorization: Bearer xyz card 1234-5678-9012-3456\n", "Authorization: Bearer *** card ***\n"},
+		{"optional group not matched", []string{`key(=\w+)?`}, "key and key=val\n", "*** and key***\n"},
+		{"empty match ignored", []string{`x*`}, "abc\n", "abc\n"},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			var patterns []*regexp.Regexp
+			for _, p := range tt.patterns {
+				patterns = append(patterns, regexp.MustCompile(p))
+			}
+			assert.Equal(t, tt.out, string(Redact(patterns, "***")([]byte(tt.in))))
+		})
+	}
+}
+
+func TestRedactWithLineSplitter(t *testing.T) {
+	buf := &lockedBuffer{}
+	wr := NewLineSplitter(NewTransformer(buf, Redact([]*regexp.Regexp{regexp.MustCompile(`secret=(\w+)`)}, "[redacted]")), 0)
+	for _, part := range []string{"first secret=ab", "cd end\nsecond secret=", "xyz\n"} {
+		_, err := wr.Write([]byte(part))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, "first secret=[redacted] end\nsecond secret=[redacted]\n", buf.String(), "secrets split across writes")
+	require.NoError(t, wr.Close())
+}
@@ -4,11 +4,15 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	docker "github.com/fsouza/go-dockerclient"
 	log "github.com/go-pkgz/lgr"
@@ -17,42 +21,224 @@ import (
 	"gopkg.in/natefinch/lumberjack.v2"
 
 	"github.com/umputun/docker-logger/app/discovery"
+	"github.com/umputun/docker-logger/app/gelf"
 	"github.com/umputun/docker-logger/app/logger"
+	"github.com/umputun/docker-logger/app/sink"
 	"github.com/umputun/docker-logger/app/syslog"
 )
 
 type cliOpts struct {
-	DockerHost string `short:"d" long:"docker" env:"DOCKER_HOST" default:"unix:///var/run/docker.sock" description:"docker host"`
+	DockerHosts []string `short:"d" long:"docker" env:"DOCKER_HOST" env-delim:"," default:"unix:///var/run/docker.sock" description:"docker host(s)"` //nolint:lll
+	Contexts    []string `long:"docker-context" env:"DOCKER_CONTEXT" env-delim:"," description:"docker cli context(s), used instead of docker hosts"` //nolint:lll
+
+	DockerTimeout   time.Duration `long:"docker-timeout" env:"DOCKER_TIMEOUT" description:"timeout of docker api calls, except streaming ones"`
+	DockerMaxConns  int           `long:"docker-max-conns" env:"DOCKER_MAX_CONNS" description:"connections limit per docker host"`
+	DockerIdleConns int           `long:"docker-idle-conns" env:"DOCKER_IDLE_CONNS" description:"idle connections kept per docker host"`
 
 	EnableSyslog bool   `long:"syslog" env:"LOG_SYSLOG" description:"enable logging to syslog"`
 	SyslogHost   string `long:"syslog-host" env:"SYSLOG_HOST" default:"127.0.0.1:514" description:"syslog host"`
 	SyslogPrefix string `long:"syslog-prefix" env:"SYSLOG_PREFIX" default:"docker/" description:"syslog prefix"`
 
-	EnableFiles   bool   `long:"files" env:"LOG_FILES" description:"enable logging to files"`
-	MaxFileSize   int    `long:"max-size" env:"MAX_SIZE" default:"10" description:"size of log triggering rotation (MB)"`
-	MaxFilesCount int    `long:"max-files" env:"MAX_FILES" default:"5" description:"number of rotated files to retain"`
-	MaxFilesAge   int    `long:"max-age" env:"MAX_AGE" default:"30" description:"maximum number of days to retain"`
-	MixErr        bool   `long:"mix-err" env:"MIX_ERR" description:"send error to std output log file"`
-	FilesLocation string `long:"loc" env:"LOG_FILES_LOC" default:"logs" description:"log files locations"`
+	EnableGELF   bool   `long:"gelf" env:"LOG_GELF" description:"enable logging to gelf input, i.e. graylog"`
+	GELFHost     string `long:"gelf-host" env:"GELF_HOST" default:"127.0.0.1:12201" description:"gelf host"`
+	GELFProtocol string `long:"gelf-protocol" env:"GELF_PROTOCOL" choice:"udp" choice:"tcp" default:"udp" description:"gelf protocol"`
+	GELFCompress bool   `long:"gelf-compress" env:"GELF_COMPRESS" description:"gzip gelf messages, udp only"`
+	GELFChunk    int    `long:"gelf-chunk-size" env:"GELF_CHUNK_SIZE" default:"1420" description:"max size of gelf udp datagram"`
+	GELFShortLen int    `long:"gelf-short-len" env:"GELF_SHORT_LEN" description:"max length of gelf short_message, unlimited if 0"`
+
+	EnableFiles   bool     `long:"files" env:"LOG_FILES" description:"enable logging to files"`
+	MaxFileSize   int      `long:"max-size" env:"MAX_SIZE" default:"10" description:"size of log triggering rotation (MB)"`
+	MaxFilesCount int      `long:"max-files" env:"MAX_FILES" default:"5" description:"number of rotated files to retain"`
+	MaxFilesAge   int      `long:"max-age" env:"MAX_AGE" default:"30" description:"maximum number of days to retain"`
+	MixErr        bool     `long:"mix-err" env:"MIX_ERR" description:"send error to std output log file"`
+	FileNaming    string   `long:"file-naming" env:"FILE_NAMING" choice:"name" choice:"created" default:"name" description:"log file names"`
+	FilesLocation string   `long:"loc" env:"LOG_FILES_LOC" default:"logs" description:"log files locations"`
+	GroupFiles    []string `long:"group-files" env:"GROUP_FILES" env-delim:"," description:"per-group files overrides, group:loc=dir;max-size=N;max-files=N;max-age=N;per=group"` //nolint:lll
+	Sample        []string `long:"sample" env:"SAMPLE" env-delim:"," description:"per-group sampling, keep 1 of N lines, group:N"`
+	SampleAge     []string `long:"sample-age" env:"SAMPLE_AGE" env-delim:"," description:"sampling by running time, keep 1 of N lines, age:N"`
+	SampleKeep    string   `long:"sample-keep" env:"SAMPLE_KEEP" default:"(?i)(error|warn|fatal|panic)" description:"lines never sampled out, regex"` //nolint:lll
+	MinLevel      []string `long:"min-level" env:"MIN_LEVEL" env-delim:"," description:"per-group min level of lines, group:level"`
+	LevelPattern  string   `long:"level-pattern" env:"LEVEL_PATTERN" description:"regex detecting level of text lines, level in the first group"` //nolint:lll
+	Tail          string   `long:"tail" env:"TAIL" default:"10" description:"existing lines streamed on container start, N, all or start"`
+	MaxLine       int      `long:"max-line" env:"MAX_LINE" description:"max log line length, longer lines split, unlimited by default"`
+	StripANSI     bool     `long:"strip-ansi" env:"STRIP_ANSI" description:"remove ANSI escape sequences, i.e. colors, from lines"`
+	Redact        []string `long:"redact" env:"REDACT" env-delim:";" description:"regex of masked line parts, the first group if any"`
+	RedactMask    string   `long:"redact-mask" env:"REDACT_MASK" default:"***" description:"replacement of redacted parts"`
+	GroupRedact   []string `long:"group-redact" env:"GROUP_REDACT" env-delim:";" description:"per-group redaction regex, group:regex"`
+	TraceID       []string `long:"trace-id" env:"TRACE_ID" env-delim:";" description:"correlation id of lines, [group:]json:field or [group:]re:regex"` //nolint:lll
+	LinePrefix    string   `long:"line-prefix" env:"LINE_PREFIX" description:"template of prefix added to each line, i.e. \"[{{.Group}}/{{.Name}}] \""` //nolint:lll
+	TailFiles     bool     `long:"tail-files" env:"TAIL_FILES" description:"read json-file logs directly from disk"`
+	FinalFetch    bool     `long:"final-fetch" env:"FINAL_FETCH" description:"fetch trailing logs of stopped containers"`
+	DockerTime    bool     `long:"docker-time" env:"DOCKER_TIME" description:"add docker's and receive time to json and logfmt lines"`
+	ParseJSON     string   `long:"parse-json" env:"PARSE_JSON" choice:"off" choice:"nest" choice:"merge" default:"off" description:"parse json lines in json format"`  //nolint:lll
+	TSSource      string   `long:"ts-source" env:"TS_SOURCE" choice:"ingest" choice:"docker" default:"ingest" description:"authoritative ts of json and logfmt lines"` //nolint:lll
+
+	WaitHealthy time.Duration `long:"wait-healthy" env:"WAIT_HEALTHY" description:"defer streaming until container healthy, up to duration"`
+	Unhealthy   string        `long:"unhealthy" env:"UNHEALTHY" choice:"collect" choice:"skip" default:"collect" description:"policy for container not healthy in time"` //nolint:lll
+
+	CrashStarts   int           `long:"crash-loop-starts" env:"CRASH_LOOP_STARTS" description:"max starts within window, unlimited by default"`
+	CrashWindow   time.Duration `long:"crash-loop-window" env:"CRASH_LOOP_WINDOW" default:"1m" description:"window counting starts"`
+	CrashCooldown time.Duration `long:"crash-loop-cooldown" env:"CRASH_LOOP_COOLDOWN" default:"5m" description:"uptime resuming collection"`
+
+	OpenLimit   int           `long:"open-limit" env:"OPEN_LIMIT" description:"max log streams opening at once, unlimited by default"`
+	OpenTimeout time.Duration `long:"open-timeout" env:"OPEN_TIMEOUT" default:"10s" description:"max wait of opening stream's first line"`
+	ReadTimeout time.Duration `long:"read-timeout" env:"READ_TIMEOUT" description:"reconnect stream reading nothing while container logs"`
+
+	GroupStreams []string `long:"group-streams" env:"GROUP_STREAMS" env-delim:"," description:"per-group max streamed containers, group:N"`
+
+	BufferSize int           `long:"buffer-size" env:"BUFFER_SIZE" description:"buffer of log files writes in bytes, disabled by default"`
+	FlushEvery time.Duration `long:"flush-interval" env:"FLUSH_INTERVAL" default:"1s" description:"max delay of buffered lines"`
+
+	MaxTotalSize int           `long:"max-total-size" env:"MAX_TOTAL_SIZE" description:"max total size of log files (MB), unlimited by default"` //nolint:lll
+	DiskCheck    time.Duration `long:"disk-check-interval" env:"DISK_CHECK_INTERVAL" default:"1m" description:"interval of total size checks"`
+	Manifest     string        `long:"rotation-manifest" env:"ROTATION_MANIFEST" description:"path of json list of rotated log files"`
 
 	Excludes        []string `short:"x" long:"exclude" env:"EXCLUDE" env-delim:"," description:"excluded container names"`
 	Includes        []string `short:"i" long:"include" env:"INCLUDE" env-delim:"," description:"included container names"`
-	IncludesPattern string   `short:"p" long:"include-pattern" env:"INCLUDE_PATTERN" env-delim:"," description:"included container names regex pattern"` //nolint:lll
-	ExcludesPattern string   `short:"e" long:"exclude-pattern" env:"EXCLUDE_PATTERN" env-delim:"," description:"excluded container names regex pattern"` //nolint:lll
-	ExtJSON         bool     `short:"j" long:"json" env:"JSON" description:"wrap message with JSON envelope"`
-	Dbg             bool     `long:"dbg" env:"DEBUG" description:"debug mode"`
+	IncludesPattern string   `short:"p" long:"include-pattern" env:"INCLUDE_PATTERN" env-delim:"," description:"included container names regex pattern"`              //nolint:lll
+	ExcludesPattern string   `short:"e" long:"exclude-pattern" env:"EXCLUDE_PATTERN" env-delim:"," description:"excluded container names regex pattern"`              //nolint:lll
+	GroupLabels     []string `long:"group-label" env:"GROUP_LABELS" env-delim:"," default:"logger.group.name" description:"labels for group name, in priority order"` //nolint:lll
+	StripRegistry   bool     `long:"strip-registry" env:"STRIP_REGISTRY" description:"group by image repository, ignoring registry host"`
+	NormalizeGroups bool     `long:"normalize-groups" env:"NORMALIZE_GROUPS" description:"lowercase and trim group names"`
+	InspectFallback bool     `long:"inspect-fallback" env:"INSPECT_FALLBACK" description:"inspect containers of events missing name or image"`
+	ImageEvents     bool     `long:"image-events" env:"IMAGE_EVENTS" description:"report image updates of running containers"`
+	DaemonEvents    []string `long:"daemon-events" env:"DAEMON_EVENTS" env-delim:"," description:"non-container event types to report"`
+	ScanMarker      bool     `long:"scan-marker" env:"SCAN_MARKER" description:"send initial scan completion marker to sinks"`
+	EventSeq        bool     `long:"event-seq" env:"EVENT_SEQ" description:"stamp events with sequence number, for gap detection"`
+	ScanRetries     int      `long:"scan-retries" env:"SCAN_RETRIES" default:"3" description:"retries of failed initial scan of containers"`
+	ScanProceed     bool     `long:"scan-proceed" env:"SCAN_PROCEED" description:"start with live events only if initial scan failed"`
+	SplitRestart    bool     `long:"split-restart" env:"SPLIT_RESTART" description:"treat restart as down followed by up"`
+	Pause           string   `long:"pause" env:"PAUSE" choice:"down" choice:"mark" default:"down" description:"paused containers handling"` //nolint:lll
+	K8sMeta         bool     `long:"k8s-meta" env:"K8S_META" description:"add kubernetes pod metadata to events"`
+	NetworkInfo     bool     `long:"network-info" env:"NETWORK_INFO" description:"add container's addresses and ports to events"`
+	EnvAllowlist    []string `long:"env-allowlist" env:"ENV_ALLOWLIST" env-delim:"," description:"container's env vars to add to events, KEY or PREFIX*"` //nolint:lll
+	MaxContainers   int      `long:"max-containers" env:"MAX_CONTAINERS" description:"max number of tracked containers, unlimited by default"`
+	PriorityGroups  []string `long:"priority-group" env:"PRIORITY_GROUPS" env-delim:"," description:"groups collected first with max-containers"` //nolint:lll
+	MinReplica      int      `long:"min-replica" env:"MIN_REPLICA" description:"min replica number of swarm tasks, unlimited by default"`
+	MaxReplica      int      `long:"max-replica" env:"MAX_REPLICA" description:"max replica number of swarm tasks, unlimited by default"`
+	ShardCount      int      `long:"shard-count" env:"SHARD_COUNT" description:"number of instances sharing containers, disabled by default"`
+	ShardIndex      int      `long:"shard-index" env:"SHARD_INDEX" description:"shard of this instance, from 0 to shard-count - 1"`
+	DecisionCache   int      `long:"decision-cache" env:"DECISION_CACHE" description:"size of filter decisions cache, disabled by default"`
+	StrictFilters   bool     `long:"strict-filters" env:"STRICT_FILTERS" description:"fail on conflicting filters instead of warning"`
+	Precedence      string   `long:"precedence" env:"PRECEDENCE" choice:"first" choice:"exclude-wins" choice:"include-wins" default:"first" description:"include and exclude filters precedence"` //nolint:lll
+	AnchorPatterns  bool     `long:"anchor-patterns" env:"ANCHOR_PATTERNS" description:"match name patterns against whole names"`
+	IncludeCommand  string   `long:"include-command" env:"INCLUDE_COMMAND" description:"included container command regex pattern"`
+	ExcludeCommand  string   `long:"exclude-command" env:"EXCLUDE_COMMAND" description:"excluded container command regex pattern"`
+	IncludeTTY      bool     `long:"include-tty" env:"INCLUDE_TTY" description:"only include containers with tty"`
+	ExcludeTTY      bool     `long:"exclude-tty" env:"EXCLUDE_TTY" description:"exclude containers with tty"`
+	IncludeRuntime  []string `long:"include-runtime" env:"INCLUDE_RUNTIME" env-delim:"," description:"included container runtimes"`
+	ExcludeRuntime  []string `long:"exclude-runtime" env:"EXCLUDE_RUNTIME" env-delim:"," description:"excluded container runtimes"`
+	IncludePlatform []string `long:"include-platform" env:"INCLUDE_PLATFORM" env-delim:"," description:"included image platforms, os/arch or arch"` //nolint:lll
+	ExcludePlatform []string `long:"exclude-platform" env:"EXCLUDE_PLATFORM" env-delim:"," description:"excluded image platforms, os/arch or arch"` //nolint:lll
+	SelfLogs        bool     `long:"self-logs" env:"SELF_LOGS" description:"log docker-logger's own container"`
+	SkipLabels      []string `long:"skip-label" env:"SKIP_LABELS" env-delim:"," description:"excluded container labels, key or key=value"`
+	ExcludeInfra    bool     `long:"exclude-infra" env:"EXCLUDE_INFRA" description:"exclude infrastructure containers by built-in patterns"`
+	InfraPatterns   []string `long:"infra-pattern" env:"INFRA_PATTERNS" env-delim:"," description:"additional infrastructure containers patterns"` //nolint:lll
+	FilterExpr      string   `long:"filter-expr" env:"FILTER_EXPR" description:"expression selecting collected containers"`
+	SelfLabel       string   `long:"self-label" env:"SELF_LABEL" default:"logger.self" description:"label marking own container"`
+	FilterFile      string   `long:"filter-file" env:"FILTER_FILE" description:"file with filters, reloaded on change"`
+
+	RecordEvents  string `long:"record-events" env:"RECORD_EVENTS" description:"file recording raw docker events, for replay"`
+	RecordMaxSize int    `long:"record-max-size" env:"RECORD_MAX_SIZE" default:"10" description:"size of events record triggering rotation (MB)"` //nolint:lll
+	Replay        string `long:"replay" description:"replay recorded docker events file through filters and exit"`
+	Diagnose      bool   `long:"diagnose" description:"check docker, filters, log destinations and sinks, print report and exit"` //nolint:lll
+	DiscoveryOnly bool   `long:"discovery-only" env:"DISCOVERY_ONLY" description:"print container events as json to stdout, no logs"`
+
+	ReconnectMin    time.Duration `long:"reconnect-min" env:"RECONNECT_MIN" default:"1s" description:"initial delay between docker reconnects"`
+	ReconnectMax    time.Duration `long:"reconnect-max" env:"RECONNECT_MAX" default:"1m" description:"max delay between docker reconnects"`
+	ReconnectLimit  int           `long:"reconnect-limit" env:"RECONNECT_LIMIT" description:"failed reconnects before exit, unlimited if 0"`
+	ReconnectLog    time.Duration `long:"reconnect-log-interval" env:"RECONNECT_LOG_INTERVAL" default:"1m" description:"interval of failed reconnects summary logs"` //nolint:lll
+	ConnectMax      time.Duration `long:"connect-max" env:"CONNECT_MAX" default:"5s" description:"max delay between initial connects"`
+	Watchdog        time.Duration `long:"watchdog" env:"WATCHDOG" description:"re-subscribe and resync if no docker events within interval"`
+	StallTimeout    time.Duration `long:"stall-timeout" env:"STALL_TIMEOUT" description:"report events consumer stalled for this long"`
+	StallAction     string        `long:"stall-action" env:"STALL_ACTION" choice:"log" choice:"exit" default:"log" description:"stalled consumer handling"` //nolint:lll
+	MaxEventAge     time.Duration `long:"max-event-age" env:"MAX_EVENT_AGE" description:"drop replayed events older than this"`
+	MaxEventAgeLive bool          `long:"max-event-age-live" env:"MAX_EVENT_AGE_LIVE" description:"apply max-event-age to live events too"`
+	CoalesceUp      time.Duration `long:"coalesce-up" env:"COALESCE_UP" description:"window coalescing bursts of container's up events"`
+	CoalesceDown    time.Duration `long:"coalesce-down" env:"COALESCE_DOWN" description:"window coalescing bursts of container's down events"`
+	DeployWindow    time.Duration `long:"deploy-window" env:"DEPLOY_WINDOW" description:"window grouping compose project starts"`
+	Keepalive       time.Duration `long:"keepalive" env:"KEEPALIVE" description:"interval of keepalive events of running containers"`
+	ReconnectJitter string        `long:"reconnect-jitter" env:"RECONNECT_JITTER" choice:"none" choice:"full" choice:"decorrelated" default:"full" description:"jitter mode for reconnect delays"` //nolint:lll
+
+	OTelEndpoint string `long:"otel-endpoint" env:"OTEL_ENDPOINT" description:"OTLP/HTTP endpoint for container events, i.e. http://localhost:4318"` //nolint:lll
+	OTelSpans    bool   `long:"otel-spans" env:"OTEL_SPANS" description:"emit otel spans for container lifetime"`
+
+	WebhookURL     string        `long:"webhook-url" env:"WEBHOOK_URL" description:"url to post container events batches as json"`
+	WebhookBatch   int           `long:"webhook-batch" env:"WEBHOOK_BATCH" default:"100" description:"max events in a single webhook post"`
+	WebhookFlush   time.Duration `long:"webhook-flush" env:"WEBHOOK_FLUSH" default:"1s" description:"max delay of pending webhook events"`
+	WebhookRetries int           `long:"webhook-retries" env:"WEBHOOK_RETRIES" default:"3" description:"webhook post retries before batch dropped"` //nolint:lll
+	WebhookHeaders []string      `long:"webhook-header" env:"WEBHOOK_HEADERS" env-delim:"," description:"extra webhook header, name:value"`
+	WebhookLines   bool          `long:"webhook-lines" env:"WEBHOOK_LINES" description:"post container log lines with webhook events"`
+
+	CloudEventsURL     string `long:"cloudevents-url" env:"CLOUDEVENTS_URL" description:"url to post container events as CloudEvents"`
+	CloudEventsBatch   int    `long:"cloudevents-batch" env:"CLOUDEVENTS_BATCH" default:"1" description:"max CloudEvents in a single post"`
+	CloudEventsRetries int    `long:"cloudevents-retries" env:"CLOUDEVENTS_RETRIES" default:"3" description:"CloudEvents post retries"`
+
+	GRPCAddress   string        `long:"grpc-address" env:"GRPC_ADDRESS" description:"grpc collector host:port to stream container events batches"` //nolint:lll
+	GRPCBatch     int           `long:"grpc-batch" env:"GRPC_BATCH" default:"100" description:"max events in a single grpc batch"`
+	GRPCFlush     time.Duration `long:"grpc-flush" env:"GRPC_FLUSH" default:"1s" description:"max delay of pending grpc events"`
+	GRPCUnacked   int           `long:"grpc-unacked" env:"GRPC_UNACKED" default:"100" description:"max grpc batches waiting for ack"`
+	GRPCPlaintext bool          `long:"grpc-plaintext" env:"GRPC_PLAINTEXT" description:"connect to grpc collector without TLS"`
+	GRPCLines     bool          `long:"grpc-lines" env:"GRPC_LINES" description:"stream container log lines to grpc collector"`
+
+	SocketPath   string `long:"socket-path" env:"SOCKET_PATH" description:"unix socket streaming container events as json lines"`
+	SocketBuffer int    `long:"socket-buffer" env:"SOCKET_BUFFER" default:"1000" description:"events buffer of each socket client"`
+	SocketLines  bool   `long:"socket-lines" env:"SOCKET_LINES" description:"stream container log lines to socket clients"`
+
+	StateDir string `long:"state-dir" env:"STATE_DIR" description:"directory of json state files of containers, for external tools"`
+
+	SinkQueue     int    `long:"sink-queue" env:"SINK_QUEUE" default:"1000" description:"events queue size of each sink"`
+	SinkOverflow  string `long:"sink-overflow" env:"SINK_OVERFLOW" choice:"drop" choice:"block" default:"drop" description:"full sink queue policy"` //nolint:lll
+	SinkCAFile    string `long:"sink-ca-file" env:"SINK_CA_FILE" description:"CA certificates file verifying http sinks"`
+	SinkCertFile  string `long:"sink-cert-file" env:"SINK_CERT_FILE" description:"client certificate file for http sinks"`
+	SinkKeyFile   string `long:"sink-key-file" env:"SINK_KEY_FILE" description:"client key file for http sinks"`
+	SinkInsecure  bool   `long:"sink-insecure" env:"SINK_INSECURE" description:"skip certificate verification of http sinks"`
+	SinkToken     string `long:"sink-token" env:"SINK_TOKEN" description:"bearer token for http sinks"`
+	SinkBasicAuth string `long:"sink-basic-auth" env:"SINK_BASIC_AUTH" description:"basic auth for http sinks, user:password"`
+	CollectEvents bool   `long:"collect-events" env:"COLLECT_EVENTS" description:"send logs collection start and stop events to sinks"`
+
+	Source  string `long:"source" env:"SOURCE" description:"source identifier stamped on events and json logs, os hostname by default"`
+	ExtJSON bool   `short:"j" long:"json" env:"JSON" description:"wrap message with JSON envelope"`
+	Format  string `long:"format" env:"FORMAT" choice:"raw" choice:"json" choice:"logfmt" description:"output format of lines, raw by default"` //nolint:lll
+	Dbg     bool   `long:"dbg" env:"DEBUG" description:"debug mode"`
+
+	groupFiles  map[string]fileParams   // parsed GroupFiles
+	shared      *sharedFiles            // open shared files of groups with per=group
+	sampleRates map[string]int          // parsed Sample
+	groupCaps   map[string]int          // parsed GroupStreams
+	sampleKeep  *regexp.Regexp          // compiled SampleKeep
+	sampleAges  []logger.AgeRate        // parsed SampleAge, ascending by age
+	minLevels   map[string]logger.Level // parsed MinLevel
+	detector    *logger.LevelDetector   // level detector made from LevelPattern
+	redaction   *redactRules            // compiled Redact and GroupRedact
+	linePrefix  *logger.LinePrefix      // compiled LinePrefix
+	traceIDs    *traceRules             // parsed TraceID
+	budget      *logger.DiskBudget      // disk budget of log files with MaxTotalSize
+	manifest    *logger.Manifest        // manifest of rotated log files with Manifest
+	hostDir     string                  // subdirectory for multi-host setups, set per event
+	format      logger.Format           // container's output format, set per event, global one if unknown
+	created     time.Time               // container's creation time for file names, set per event
+	started     time.Time               // inspected start of container found on startup, for sampling by running time
+	container   discovery.Event         // container writers made for, fields of gelf messages, set per event
+	lineTime    *logger.LineTime        // docker's time of the current stdout line, set per event with DockerTime or TSSource
+	errLineTime *logger.LineTime        // docker's time of the current stderr line, set along with lineTime
+	now         func() time.Time        // clock of lines receive time, time.Now if not set
+	lineSinks   []sink.LineSink         // sinks streaming log lines, made by makeEventSinks
 }
 
 var revision = "unknown" //nolint:gochecknoglobals
 
 func main() {
-	fmt.Printf("docker-logger %s\n", revision)
-
 	var opts cliOpts
 	if _, err := flags.Parse(&opts); err != nil {
 		os.Exit(1)
 	}
-	setupLog(opts.Dbg)
+	out := io.Writer(os.Stdout)
+	if opts.DiscoveryOnly {
+		out = os.Stderr // stdout is for events only
+	}
+	fmt.Fprintf(out, "docker-logger %s\n", revision)
+	setupLog(opts.Dbg, log.Out(out))
 
 	ctx, cancel := context.WithCancel(context.Background())
 	go func() { // catch signal and invoke graceful termination
@@ -70,98 +256,558 @@ func main() {
 }
 
 func do(ctx context.Context, opts *cliOpts) error {
-	if opts.Includes != nil && opts.IncludesPattern != "" {
-		return errors.New("only single option Includes/IncludesPattern are allowed")
+	filters := filterSpec{Excludes: opts.Excludes, Includes: opts.Includes, IncludesPattern: opts.IncludesPattern,
+		ExcludesPattern: opts.ExcludesPattern}
+	if opts.FilterFile != "" {
+		spec, err := loadFilterFile(opts.FilterFile, opts.Precedence)
+		if err != nil {
+			return errors.Wrapf(err, "bad filter file %s", opts.FilterFile)
+		}
+		filters = spec // file overrides filters from options
+	}
+	if err := filters.validate(opts.Precedence); err != nil {
+		return err
+	}
+	if opts.Replay != "" {
+		return replayEvents(opts, filters)
+	}
+	if opts.Diagnose {
+		return diagnose(ctx, opts, filters, os.Stdout)
 	}
 
-	if opts.IncludesPattern != "" {
-		_, err := regexp.Compile(opts.IncludesPattern)
-		if err != nil {
-			return errors.New("could not parse Includes Pattern")
+	if !opts.DiscoveryOnly {
+		if err := setupCollection(opts); err != nil {
+			return err
 		}
 	}
+	if opts.budget != nil {
+		go opts.budget.Run(ctx)
+	}
 
-	if opts.Includes != nil && opts.Excludes != nil {
-		return errors.New("only single option Excludes/Includes are allowed")
+	recorder, recordWriter := makeRecorder(opts)
+	if recordWriter != nil {
+		defer func() { _ = recordWriter.Close() }()
 	}
 
-	if opts.Excludes != nil && opts.ExcludesPattern != "" {
-		return errors.New("only single option Excludes/ExcludesPattern are allowed")
+	clients, notifsByHost := map[string]logger.LogClient{}, map[string]*discovery.EventNotif{}
+	targets, fromContext := opts.DockerHosts, len(opts.Contexts) > 0
+	if fromContext {
+		targets = opts.Contexts
 	}
+	notifs := make([]*discovery.EventNotif, 0, len(targets))
+	for _, dockerHost := range targets {
+		client, host, err := dockerClient(dockerHost, fromContext, len(targets) > 1, clientParams(opts))
+		if err != nil {
+			return errors.Wrapf(err, "failed to make docker client %s", dockerHost)
+		}
 
-	if opts.ExcludesPattern != "" {
-		_, err := regexp.Compile(opts.ExcludesPattern)
+		if _, found := clients[host]; found {
+			return errors.Errorf("duplicate docker host %s", dockerHost)
+		}
+		clients[host] = client
+
+		notifOpts, err := notifOptions(opts, host)
+		if err != nil {
+			return err
+		}
+		if recorder != nil {
+			notifOpts = append(notifOpts, discovery.WithRecorder(recorder))
+		}
+		events, err := discovery.NewEventNotif(client, filters.Excludes, filters.Includes, filters.IncludesPattern,
+			filters.ExcludesPattern, notifOpts...)
 		if err != nil {
-			return errors.New("could not parse Excludes Pattern")
+			return errors.Wrapf(err, "failed to make event notifier for %s", dockerHost)
 		}
+		notifs = append(notifs, events)
+		notifsByHost[host] = events
 	}
 
-	if opts.EnableSyslog && !syslog.IsSupported() {
-		return errors.New("syslog is not supported on this OS")
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	failed := watchReconnects(ctx, cancel, notifs, targets)
+
+	var reloadFilterFile func()
+	if opts.FilterFile != "" {
+		reload, err := watchFilterFile(ctx, opts.FilterFile, opts.Precedence, filters, updateFilters(notifs))
+		if err != nil {
+			return err
+		}
+		reloadFilterFile = reload
+	}
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	go watchHangup(ctx, hangup, reloadFilterFile, notifs)
+
+	if opts.DiscoveryOnly {
+		if err := printEvents(ctx, os.Stdout, discovery.Multiplex(ctx, notifs...)); err != nil {
+			return err
+		}
+		return failed()
 	}
 
-	client, err := docker.NewClient(opts.DockerHost)
+	sources := make([]sink.Subscriber, 0, len(notifs))
+	for _, n := range notifs {
+		sources = append(sources, n)
+	}
+	sinks, err := makeEventSinks(ctx, opts, sources...)
 	if err != nil {
-		return errors.Wrapf(err, "failed to make docker client %s", err)
+		return err
+	}
+	defer closeSinks(sinks)
+
+	runEventLoop(ctx, opts, discovery.Multiplex(ctx, notifs...), clients, notifsByHost, sinks)
+	return failed()
+}
+
+// watchReconnects cancels ctx once any of notifs gave up reconnecting to docker, with --reconnect-limit, or on
+// stalled events consumer, with --stall-action=exit. Returns func reporting the failure, nil if none failed.
+func watchReconnects(ctx context.Context, cancel context.CancelFunc, notifs []*discovery.EventNotif,
+	targets []string) func() error {
+	var lock sync.Mutex
+	var failedErr error
+	for i, n := range notifs {
+		go func(n *discovery.EventNotif, target string) {
+			select {
+			case <-n.Failed():
+				lock.Lock()
+				failedErr = errors.Wrapf(n.Err(), "docker %s failed", target)
+				lock.Unlock()
+				cancel()
+			case <-ctx.Done():
+			}
+		}(n, targets[i])
 	}
+	return func() error {
+		lock.Lock()
+		defer lock.Unlock()
+		return failedErr
+	}
+}
 
-	events, err := discovery.NewEventNotif(client, opts.Excludes, opts.Includes, opts.IncludesPattern, opts.ExcludesPattern)
+// setupCollection checks and parses log collection options, not used in discovery-only mode
+func setupCollection(opts *cliOpts) error {
+	if len(opts.GroupFiles) > 0 {
+		groupFiles, err := parseGroupFiles(opts.GroupFiles, opts.filesFor(""))
+		if err != nil {
+			return errors.Wrap(err, "could not parse group files")
+		}
+		for group, params := range groupFiles {
+			if err := checkWritable(params.Location); err != nil {
+				return errors.Wrapf(err, "bad location for group %s", group)
+			}
+		}
+		opts.groupFiles = groupFiles
+		opts.shared = newSharedFiles()
+	}
+
+	if err := setupSampling(opts); err != nil {
+		return err
+	}
+	groupCaps, err := parseGroupStreams(opts.GroupStreams)
 	if err != nil {
-		return errors.Wrap(err, "failed to make event notifier")
+		return err
+	}
+	opts.groupCaps = groupCaps
+	if err := setupLevels(opts); err != nil {
+		return err
+	}
+	if err := setupRedaction(opts); err != nil {
+		return err
+	}
+	if err := setupLinePrefix(opts); err != nil {
+		return err
+	}
+	if err := setupTraceIDs(opts); err != nil {
+		return err
+	}
+	if err := setupDiskBudget(opts); err != nil {
+		return err
+	}
+	if err := setupManifest(opts); err != nil {
+		return err
+	}
+	if !validTail(opts.Tail) {
+		return errors.Errorf("invalid tail %q, expected number, all or start", opts.Tail)
 	}
 
-	runEventLoop(ctx, opts, events, client)
+	if opts.EnableSyslog && !syslog.IsSupported() {
+		return errors.New("syslog is not supported on this OS")
+	}
+	if opts.EnableGELF && opts.GELFCompress && opts.GELFProtocol == "tcp" {
+		return errors.New("gelf compression is not supported with tcp")
+	}
 	return nil
 }
 
-//nolint:funlen
-func runEventLoop(ctx context.Context, opts *cliOpts, events *discovery.EventNotif, client *docker.Client) {
-	logStreams := map[string]logger.LogStreamer{}
+// notifOptions makes EventNotif options from cli options
+func notifOptions(opts *cliOpts, host string) ([]discovery.Option, error) {
+	jitter := map[string]discovery.Jitter{"none": discovery.NoJitter, "full": discovery.FullJitter,
+		"decorrelated": discovery.DecorrelatedJitter}
+	stallActions := map[string]discovery.StallAction{"log": discovery.StallLog, "exit": discovery.StallFail}
+	res := []discovery.Option{
+		discovery.WithHost(host),
+		discovery.WithSource(opts.Source),
+		discovery.WithBackoff(discovery.Backoff{Min: opts.ReconnectMin, Max: opts.ReconnectMax, Jitter: jitter[opts.ReconnectJitter]}),
+		discovery.WithConnectBackoff(discovery.Backoff{Min: opts.ReconnectMin, Max: opts.ConnectMax, Jitter: jitter[opts.ReconnectJitter]}),
+		discovery.WithReconnectLimit(opts.ReconnectLimit),
+		discovery.WithReconnectLogInterval(opts.ReconnectLog),
+		discovery.WithWatchdog(opts.Watchdog),
+		discovery.WithStallDetector(opts.StallTimeout, stallActions[opts.StallAction]),
+		discovery.WithMaxEventAge(opts.MaxEventAge, opts.MaxEventAgeLive),
+		discovery.WithCoalesce(opts.CoalesceUp, opts.CoalesceDown),
+		discovery.WithGroupLabels(opts.GroupLabels...),
+		discovery.WithSelfLabel(opts.SelfLabel),
+	}
+	if opts.SelfLogs {
+		res = append(res, discovery.WithSelfLogs())
+	}
+	if opts.StrictFilters {
+		res = append(res, discovery.WithStrictFilters())
+	}
+	if opts.AnchorPatterns {
+		res = append(res, discovery.WithAnchorPatterns())
+	}
+	switch opts.Precedence {
+	case "exclude-wins":
+		res = append(res, discovery.WithPrecedence(discovery.PrecedenceExcludeWins))
+	case "include-wins":
+		res = append(res, discovery.WithPrecedence(discovery.PrecedenceIncludeWins))
+	}
+	if opts.K8sMeta {
+		res = append(res, discovery.WithK8sMeta())
+	}
+	if opts.NetworkInfo {
+		res = append(res, discovery.WithNetwork())
+	}
+	if len(opts.EnvAllowlist) > 0 {
+		res = append(res, discovery.WithEnvAllowlist(opts.EnvAllowlist...))
+	}
+	if opts.SplitRestart {
+		res = append(res, discovery.WithSplitRestart())
+	}
+	if opts.Pause == "mark" {
+		res = append(res, discovery.WithPauseBehavior(discovery.PauseMarkPaused))
+	}
+	if opts.ImageEvents {
+		res = append(res, discovery.WithImageEvents())
+	}
+	if len(opts.DaemonEvents) > 0 {
+		res = append(res, discovery.WithDaemonEvents(opts.DaemonEvents...))
+	}
+	if opts.ScanMarker {
+		res = append(res, discovery.WithScanMarker())
+	}
+	if opts.EventSeq {
+		res = append(res, discovery.WithSequence())
+	}
+	if opts.DeployWindow > 0 {
+		res = append(res, discovery.WithDeployments(opts.DeployWindow))
+	}
+	if opts.Keepalive > 0 {
+		res = append(res, discovery.WithKeepalive(opts.Keepalive))
+	}
+	if opts.ScanRetries > 0 {
+		res = append(res, discovery.WithScanRetries(opts.ScanRetries))
+	}
+	if opts.ScanProceed {
+		res = append(res, discovery.WithScanProceed())
+	}
+	if opts.InspectFallback {
+		res = append(res, discovery.WithInspectFallback())
+	}
+	if len(opts.SkipLabels) > 0 {
+		res = append(res, discovery.WithSkipLabels(opts.SkipLabels...))
+	}
+	if opts.StripRegistry {
+		res = append(res, discovery.WithStripRegistry())
+	}
+	if opts.NormalizeGroups {
+		res = append(res, discovery.WithNormalizeGroups())
+	}
+	if opts.DecisionCache > 0 {
+		res = append(res, discovery.WithDecisionCache(opts.DecisionCache))
+	}
+	if opts.MaxContainers > 0 {
+		res = append(res, discovery.WithMaxContainers(opts.MaxContainers, opts.PriorityGroups...))
+	}
+	if opts.MinReplica > 0 || opts.MaxReplica > 0 {
+		res = append(res, discovery.WithReplicaRange(opts.MinReplica, opts.MaxReplica))
+	}
+	if opts.ShardCount != 0 {
+		res = append(res, discovery.WithShard(opts.ShardCount, opts.ShardIndex))
+	}
+	if opts.IncludeTTY && opts.ExcludeTTY {
+		return nil, errors.New("include-tty and exclude-tty can't be used together")
+	}
+	if opts.IncludeTTY || opts.ExcludeTTY {
+		res = append(res, discovery.WithTTYFilter(opts.IncludeTTY, opts.ExcludeTTY))
+	}
+	if len(opts.IncludeRuntime) > 0 || len(opts.ExcludeRuntime) > 0 {
+		res = append(res, discovery.WithRuntimeFilter(opts.IncludeRuntime, opts.ExcludeRuntime))
+	}
+	if len(opts.IncludePlatform) > 0 || len(opts.ExcludePlatform) > 0 {
+		res = append(res, discovery.WithPlatformFilter(opts.IncludePlatform, opts.ExcludePlatform))
+	}
 
-	procEvent := func(event discovery.Event) {
-		if event.Status {
-			// new/started container detected
+	if opts.IncludeCommand != "" || opts.ExcludeCommand != "" {
+		includeCmd, err := compileOptional(opts.IncludeCommand)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not parse include command pattern")
+		}
+		excludeCmd, err := compileOptional(opts.ExcludeCommand)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not parse exclude command pattern")
+		}
+		res = append(res, discovery.WithCommandFilter(includeCmd, excludeCmd))
+	}
 
-			if _, found := logStreams[event.ContainerID]; found {
-				log.Printf("[WARN] ignore dbl-start %+v", event)
-				return
-			}
+	if opts.ExcludeInfra || len(opts.InfraPatterns) > 0 {
+		infra, err := infraPatterns(opts)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, discovery.WithInfraExcludes(infra...))
+	}
+	if opts.FilterExpr != "" {
+		res = append(res, discovery.WithFilterExpr(opts.FilterExpr))
+	}
+	return res, nil
+}
+
+// infraPatterns compiles infrastructure containers patterns, built-in ones with ExcludeInfra and additional ones
+func infraPatterns(opts *cliOpts) ([]*regexp.Regexp, error) {
+	var patterns []string
+	if opts.ExcludeInfra {
+		patterns = append(patterns, discovery.DefaultInfraPatterns...)
+	}
+	res := make([]*regexp.Regexp, 0, len(patterns)+len(opts.InfraPatterns))
+	for _, p := range append(patterns, opts.InfraPatterns...) {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not parse infra pattern %q", p)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// compileOptional compiles regexp, returns nil for empty pattern
+func compileOptional(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile(pattern)
+}
+
+// hostID makes host identifier from docker host url, used as directory name. Host and port of tcp url, i.e.
+// 10.0.0.1_2375, socket path of unix url, i.e. var_run_docker.sock, so daemons of the same machine kept apart.
+// Single host setups use empty id to keep files layout unchanged.
+func hostID(dockerHost string, multi bool) string {
+	if !multi {
+		return ""
+	}
+	u, err := url.Parse(dockerHost)
+	if err != nil {
+		return "local"
+	}
+	id := u.Hostname()
+	if u.Port() != "" {
+		id += "_" + u.Port()
+	}
+	if u.Scheme == "unix" || u.Scheme == "npipe" || id == "" {
+		id = u.Path
+	}
+	id = strings.Trim(hostIDUnsafe.ReplaceAllString(id, "_"), "_.")
+	if id == "" {
+		return "local"
+	}
+	return id
+}
+
+// hostIDUnsafe matches characters of host id unsafe for directory names
+var hostIDUnsafe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// dockerClient makes client and host id of docker host or, with fromContext, of docker cli context name.
+// Host id of context is its name.
+func dockerClient(target string, fromContext, multi bool, params discovery.ClientParams) (*docker.Client, string, error) {
+	if !fromContext {
+		client, err := discovery.NewDockerClient(target, params)
+		return client, hostID(target, multi), err
+	}
+	client, err := discovery.NewDockerClientFromContext(target, params)
+	if !multi {
+		return client, "", err
+	}
+	return client, target, err
+}
 
-			logWriter, errWriter := makeLogWriters(opts, event.ContainerName, event.Group)
-			ls := logger.LogStreamer{
-				DockerClient:  client,
-				ContainerID:   event.ContainerID,
-				ContainerName: event.ContainerName,
-				LogWriter:     logWriter,
-				ErrWriter:     errWriter,
+// clientParams returns docker api client params of options
+func clientParams(opts *cliOpts) discovery.ClientParams {
+	return discovery.ClientParams{Timeout: opts.DockerTimeout, MaxConns: opts.DockerMaxConns, IdleConns: opts.DockerIdleConns}
+}
+
+//nolint:funlen
+func runEventLoop(ctx context.Context, opts *cliOpts, events <-chan discovery.Event, clients map[string]logger.LogClient,
+	notifs map[string]*discovery.EventNotif, sinks []sink.EventSink) {
+	logStreams := map[string]*logger.LogStreamer{}
+	streamed := map[string]discovery.Event{} // up events of streamed containers, with log files reported on stop
+	breaker := newCrashBreaker(opts.CrashStarts, opts.CrashWindow, opts.CrashCooldown, ctx.Done())
+	opening := newOpenPool(opts.OpenLimit, opts.OpenTimeout)
+	caps := newGroupCap(opts.groupCaps, func() []discovery.Event {
+		var res []discovery.Event
+		for _, n := range notifs {
+			res = append(res, n.ListCurrent()...)
+		}
+		return res
+	})
+	declined := make(chan discovery.Event) // containers skipped as not healthy, their slots of group freed
+
+	// groupStreams returns up events of group's containers streamed, skipped ones excluded
+	groupStreams := func(group string) []discovery.Event {
+		var res []discovery.Event
+		for id, ev := range streamed {
+			if ev.Group == group && !logStreams[id].Skipped() {
+				res = append(res, ev)
 			}
-			ls = *ls.Go(ctx)
-			logStreams[event.ContainerID] = ls
-			log.Printf("[DEBUG] streaming for %d containers", len(logStreams))
-			return
 		}
+		return res
+	}
 
-		// removed/stopped container detected
+	// closeStream stops log streaming of event's container, returns event with container's log files
+	closeStream := func(event discovery.Event) discovery.Event {
 		ls, ok := logStreams[event.ContainerID]
 		if !ok {
 			log.Printf("[DEBUG] close loggers event %+v for non-mapped container ignored", event)
-			return
+			return event
 		}
+		event.LogFilePath, event.ErrFilePath = streamed[event.ContainerID].LogFilePath, streamed[event.ContainerID].ErrFilePath
+		delete(streamed, event.ContainerID)
 
 		log.Printf("[DEBUG] close loggers for %+v", event)
 		ls.Close()
+		closeWriters(event, ls.LogWriter, ls.ErrWriter)
+		delete(logStreams, event.ContainerID)
+		log.Printf("[DEBUG] streaming for %d containers", len(logStreams))
+		return event
+	}
 
-		if e := ls.LogWriter.Close(); e != nil {
-			log.Printf("[WARN] failed to close log writer for %+v, %s", event, e)
+	// openStream starts log streaming of up event's container, if fits its group's limit. Returns event with
+	// container's log files. Nothing recorded for container not streamed, so slots of group taken by streams only.
+	var openStream func(event discovery.Event) discovery.Event
+	openStream = func(event discovery.Event) discovery.Event {
+		evicted, ok := caps.admit(event, groupStreams(event.Group))
+		if !ok {
+			return event
+		}
+		release, ok := opening.acquire(ctx) // waits if too many streams opening, pacing discovery
+		if !ok {
+			return event
+		}
+		if evicted != nil {
+			closeStream(*evicted) // the oldest container of the group skipped for the started one
 		}
 
-		if !opts.MixErr { // don't close err writer in mixed mode, closed already by LogWriter.Close()
-			if e := ls.ErrWriter.Close(); e != nil {
-				log.Printf("[WARN] failed to close err writer for %+v, %s", event, e)
+		writerOpts := *opts
+		writerOpts.hostDir = event.Host // multi-host setups keep each host in own dir
+		writerOpts.format = formatFor(opts, event)
+		writerOpts.created = event.Created
+		writerOpts.container = event
+		if writerOpts.created.IsZero() {
+			writerOpts.created = event.TS // create event not seen, the start makes the run
+		}
+		if (opts.DockerTime || opts.TSSource == "docker") && writerOpts.format != logger.FormatRaw {
+			// shared by streamer and formatting writers, one per stream
+			writerOpts.lineTime, writerOpts.errLineTime = &logger.LineTime{}, &logger.LineTime{}
+		}
+		logWriter, errWriter, err := makeLogWriters(&writerOpts, event.ContainerName, event.Group)
+		if err != nil {
+			log.Printf("[ERROR] container %s not streamed, %v", event.ContainerName, err)
+			release()
+			return event
+		}
+		event.LogFilePath, event.ErrFilePath = containerLogFiles(&writerOpts, event.ContainerName, event.Group)
+		if n, ok := notifs[event.Host]; ok && event.LogFilePath != "" {
+			n.SetLogFiles(event.ContainerID, event.LogFilePath, event.ErrFilePath)
+		}
+		if event.FromScan && len(opts.sampleAges) > 0 {
+			writerOpts.started = scannedStart(ctx, clients[event.Host], event)
+		}
+		logWriter, errWriter = wrapWriters(&writerOpts, event, logWriter, errWriter)
+		logWriter, errWriter = openedWriter{logWriter, release}, openedWriter{errWriter, release}
+		ls := &logger.LogStreamer{
+			DockerClient:  clients[event.Host],
+			ContainerID:   event.ContainerID,
+			ContainerName: event.ContainerName,
+			LogWriter:     logWriter,
+			ErrWriter:     errWriter,
+			Tail:          tailFor(opts, event),
+			Streams:       streamsFor(event),
+			FinalFetch:    opts.FinalFetch,
+			TailFiles:     opts.TailFiles,
+			WaitHealthy:   waitHealthyFor(opts, event),
+			SkipUnhealthy: opts.Unhealthy == "skip",
+			LineTime:      writerOpts.lineTime,
+			ErrLineTime:   writerOpts.errLineTime,
+			ReadTimeout:   opts.ReadTimeout,
+		}
+		if opts.CollectEvents {
+			ls.OnCollect = func(started bool) { publishEvent(ctx, sinks, discovery.CollectionEvent(event, started)) }
+		}
+		if _, capped := opts.groupCaps[event.Group]; capped {
+			ls.OnSkip = func() {
+				select {
+				case declined <- event:
+				case <-ctx.Done():
+				}
 			}
 		}
-		delete(logStreams, event.ContainerID)
+		logStreams[event.ContainerID] = ls.Go(ctx)
+		streamed[event.ContainerID] = event
 		log.Printf("[DEBUG] streaming for %d containers", len(logStreams))
+		return event
+	}
+
+	// resumeGroup streams container of group in its free slot, if any. Streamed, suppressed and stopped
+	// containers not considered.
+	resumeGroup := func(group, stoppedID string) {
+		up := caps.resume(group, groupStreams(group), func(id string) bool {
+			_, found := logStreams[id]
+			return found || id == stoppedID || breaker.suppressing(id)
+		})
+		if up != nil {
+			openStream(*up) // not a start of container, so not counted by crash loop breaker
+		}
+	}
+
+	// procEvent starts or stops log streaming of event's container, returns event with container's log files.
+	// Suppression of crash looping container set to notice, sent after the event.
+	var notice *discovery.Event
+	procEvent := func(event discovery.Event) discovery.Event {
+		if event.Status {
+			// new/started container detected
+			if _, found := logStreams[event.ContainerID]; found {
+				log.Printf("[WARN] ignore dbl-start %+v", event)
+				return event
+			}
+			if collect, suppressed := breaker.started(event); !collect {
+				if suppressed {
+					ev := discovery.SuppressionEvent(event, true)
+					notice = &ev
+				}
+				return event
+			}
+			return openStream(event)
+		}
+
+		// removed/stopped container detected
+		breaker.stopped(event)
+		_, found := logStreams[event.ContainerID]
+		event = closeStream(event)
+		if found {
+			resumeGroup(event.Group, event.ContainerID) // skipped container of the group streamed instead
+		}
+		return event
 	}
 
 	for {
@@ -173,62 +819,108 @@ func runEventLoop(ctx context.Context, opts *cliOpts, events *discovery.EventNot
 				log.Printf("[INFO] close logger stream for %s", v.ContainerName)
 			}
 			return
-		case event := <-events.Channel():
+		case event, ok := <-events:
+			if !ok {
+				events = nil // closed on termination, wait for ctx.Done to close streams
+				continue
+			}
 			log.Printf("[DEBUG] received event %+v", event)
-			procEvent(event)
+			if event.Type == discovery.EventImage {
+				log.Printf("[INFO] image %s updated for container %s", event.Image, event.ContainerName)
+				continue
+			}
+			switch event.Type {
+			case discovery.EventDaemon, discovery.EventScanDone, discovery.EventDeploy, discovery.EventKeepalive:
+				publishEvent(ctx, sinks, event) // context only, log streams not affected
+				continue
+			}
+			publishEvent(ctx, sinks, procEvent(event))
+			if notice != nil {
+				publishEvent(ctx, sinks, *notice)
+				notice = nil
+			}
+		case t := <-breaker.timers:
+			if up, ok := breaker.resume(t); ok {
+				publishEvent(ctx, sinks, discovery.SuppressionEvent(up, false))
+				if _, found := logStreams[up.ContainerID]; !found {
+					openStream(up) // stable now, not a new start
+				}
+			}
+		case ev := <-declined:
+			resumeGroup(ev.Group, ev.ContainerID)
 		}
 	}
 }
 
-// makeLogWriters creates io.Writer with rotated out and separate err files. Also adds writer for remote syslog
+// closeWriters closes container's log and err writers. Both closed in mixed mode too, as each has own processing
+// stages and may hold own handle of the file, i.e. shared by group, while the file closed once.
+func closeWriters(event discovery.Event, logWriter, errWriter io.WriteCloser) {
+	if e := logWriter.Close(); e != nil {
+		log.Printf("[WARN] failed to close log writer for %+v, %s", event, e)
+	}
+	if e := errWriter.Close(); e != nil {
+		log.Printf("[WARN] failed to close err writer for %+v, %s", event, e)
+	}
+}
+
+// makeLogWriters creates io.Writer with rotated out and separate err files. Also adds writers for remote syslog
+// and gelf, the latter with own message format and not affected by the output format. Returns error if gelf
+// is the only destination and can't be connected.
 //
 //nolint:funlen
-func makeLogWriters(opts *cliOpts, containerName, group string) (logWriter, errWriter io.WriteCloser) {
+func makeLogWriters(opts *cliOpts, containerName, group string) (logWriter, errWriter io.WriteCloser, err error) {
 	log.Printf("[DEBUG] create log writer for %s", strings.TrimPrefix(group+"/"+containerName, "/"))
-	if !opts.EnableFiles && !opts.EnableSyslog {
-		log.Fatalf("[ERROR] either files or syslog has to be enabled")
+	if !opts.EnableFiles && !opts.EnableSyslog && !opts.EnableGELF {
+		log.Fatalf("[ERROR] either files, syslog or gelf has to be enabled")
 	}
 
 	var logWriters []io.WriteCloser // collect log writers here, for MultiWriter use
 	var errWriters []io.WriteCloser // collect err writers here, for MultiWriter use
 
-	if opts.EnableFiles {
-		logDir := opts.FilesLocation
-		if group != "" {
-			logDir = fmt.Sprintf("%s/%s", opts.FilesLocation, group)
-		}
-		if err := os.MkdirAll(logDir, 0o750); err != nil {
-			log.Fatalf("[ERROR] can't make directory %s, %v", logDir, err)
+	format := opts.format
+	if format == logger.FormatUnknown {
+		format = defaultFormat(opts)
+	}
+
+	fp := opts.filesFor(group)
+	if opts.EnableFiles && fp.Shared {
+		logFileWriter, errFileWriter := sharedFileWriters(opts, fp, containerName, group,
+			format == logger.FormatRaw && opts.linePrefix == nil)
+		logWriters = append(logWriters, logFileWriter)
+		errWriters = append(errWriters, errFileWriter)
+	}
+
+	if opts.EnableFiles && !fp.Shared {
+		logName, errFname := containerLogFiles(opts, containerName, group)
+		if err := os.MkdirAll(filepath.Dir(logName), 0o750); err != nil {
+			log.Fatalf("[ERROR] can't make directory %s, %v", filepath.Dir(logName), err)
 		}
 
-		logName := fmt.Sprintf("%s/%s.log", logDir, containerName)
-		logFileWriter := &lumberjack.Logger{
+		logFileWriter := buffered(opts, budgeted(opts, manifested(opts, &lumberjack.Logger{
 			Filename:   logName,
-			MaxSize:    opts.MaxFileSize, // megabytes
-			MaxBackups: opts.MaxFilesCount,
-			MaxAge:     opts.MaxFilesAge, // in days
+			MaxSize:    fp.MaxSize, // megabytes
+			MaxBackups: fp.MaxBackups,
+			MaxAge:     fp.MaxAge, // in days
 			Compress:   true,
-		}
+		}, containerName, group)))
 
 		// use std writer for errors by default
 		errFileWriter := logFileWriter
-		errFname := logName
 
 		if !opts.MixErr { // if writers not mixed make error writer
-			errFname = fmt.Sprintf("%s/%s.err", logDir, containerName)
-			errFileWriter = &lumberjack.Logger{
+			errFileWriter = buffered(opts, budgeted(opts, manifested(opts, &lumberjack.Logger{
 				Filename:   errFname,
-				MaxSize:    opts.MaxFileSize, // megabytes
-				MaxBackups: opts.MaxFilesCount,
-				MaxAge:     opts.MaxFilesAge, // in days
+				MaxSize:    fp.MaxSize, // megabytes
+				MaxBackups: fp.MaxBackups,
+				MaxAge:     fp.MaxAge, // in days
 				Compress:   true,
-			}
+			}, containerName, group)))
 		}
 
 		logWriters = append(logWriters, logFileWriter)
 		errWriters = append(errWriters, errFileWriter)
 		log.Printf("[INFO] loggers created for %s and %s, max.size=%dM, max.files=%d, max.days=%d",
-			logName, errFname, opts.MaxFileSize, opts.MaxFilesCount, opts.MaxFilesAge)
+			logName, errFname, fp.MaxSize, fp.MaxBackups, fp.MaxAge)
 	}
 
 	if opts.EnableSyslog && syslog.IsSupported() {
@@ -244,18 +936,66 @@ func makeLogWriters(opts *cliOpts, containerName, group string) (logWriter, errW
 
 	lw := logger.NewMultiWriterIgnoreErrors(logWriters...)
 	ew := logger.NewMultiWriterIgnoreErrors(errWriters...)
-	if opts.ExtJSON {
-		lw = lw.WithExtJSON(containerName, group)
-		ew = ew.WithExtJSON(containerName, group)
+	if format != logger.FormatRaw {
+		lw = lw.WithFormat(format, containerName, group).WithHostname(opts.Source)
+		ew = ew.WithFormat(format, containerName, group).WithHostname(opts.Source)
+	}
+	if format == logger.FormatJSON && opts.ParseJSON != "" {
+		lw = lw.WithJSONLines(logger.ParseJSONLines(opts.ParseJSON))
+		ew = ew.WithJSONLines(logger.ParseJSONLines(opts.ParseJSON))
+	}
+	if format != logger.FormatRaw && opts.now != nil {
+		lw, ew = lw.WithClock(opts.now), ew.WithClock(opts.now)
 	}
+	if format != logger.FormatRaw && opts.lineTime != nil {
+		lw = lw.WithDockerTime(opts.lineTime, opts.TSSource == "docker")
+		ew = ew.WithDockerTime(opts.errLineTime, opts.TSSource == "docker")
+	}
+	if ex := traceFor(opts, group); ex != nil && format != logger.FormatRaw {
+		lw = lw.WithTraceID(ex)
+		ew = ew.WithTraceID(ex)
+	}
+
+	if opts.EnableGELF {
+		return withGELF(opts, containerName, group, lw, ew, len(logWriters) > 0)
+	}
+	return lw, ew, nil
+}
 
-	return lw, ew
+// withGELF adds gelf writers to formatted log writers, used as is if gelf can't be connected. Gelf writers get
+// whole lines, as each write is a message and docker frames don't align to lines. Formatted writers dropped
+// if have no destinations, as MultiWriter fails writes with no writers, and error returned if gelf failed then.
+func withGELF(opts *cliOpts, containerName, group string, lw, ew io.WriteCloser,
+	formatted bool) (logWriter, errWriter io.WriteCloser, err error) {
+	fields := map[string]string{"container_id": opts.container.ContainerID, "container_name": containerName,
+		"image_name": opts.container.Image, "group": group}
+	if opts.container.Host != "" {
+		fields["docker_host"] = opts.container.Host
+	}
+	if !opts.container.Created.IsZero() {
+		fields["created"] = opts.container.Created.UTC().Format(time.RFC3339Nano)
+	}
+	gelfWriter, err := gelf.NewWriter(gelf.Params{Address: opts.GELFHost, Protocol: opts.GELFProtocol, Compress: opts.GELFCompress,
+		ChunkSize: opts.GELFChunk, ShortLen: opts.GELFShortLen, Host: opts.container.Source}, fields)
+	if err != nil {
+		if !formatted {
+			return nil, nil, errors.Wrap(err, "can't connect to gelf, the only log destination")
+		}
+		log.Printf("[WARN] can't connect to gelf, %v", err)
+		return lw, ew, nil
+	}
+	gelfOut := logger.NewLineSplitter(gelfWriter, opts.MaxLine)
+	gelfErr := logger.NewLineSplitter(gelfWriter.Stderr(), opts.MaxLine)
+	if !formatted {
+		return gelfOut, gelfErr, nil
+	}
+	return logger.NewMultiWriterIgnoreErrors(lw, gelfOut), logger.NewMultiWriterIgnoreErrors(ew, gelfErr), nil
 }
 
-func setupLog(dbg bool) {
+func setupLog(dbg bool, opts ...log.Option) {
 	if dbg {
-		log.Setup(log.Debug, log.CallerFile, log.CallerFunc, log.Msec, log.LevelBraces)
+		log.Setup(append([]log.Option{log.Debug, log.CallerFile, log.CallerFunc, log.Msec, log.LevelBraces}, opts...)...)
 		return
 	}
-	log.Setup(log.Msec, log.LevelBraces, log.CallerPkg)
+	log.Setup(append([]log.Option{log.Msec, log.LevelBraces, log.CallerPkg}, opts...)...)
 }
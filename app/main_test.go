@@ -2,12 +2,23 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
+	docker "github.com/fsouza/go-dockerclient"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/docker-logger/app/discovery"
+	"github.com/umputun/docker-logger/app/logger"
+	"github.com/umputun/docker-logger/app/sink"
 )
 
 func Test_Do(t *testing.T) {
@@ -17,7 +28,7 @@ func Test_Do(t *testing.T) {
 
 	defer os.RemoveAll("/tmp/logger.test") // nolint
 	opts := cliOpts{
-		DockerHost:    "unix:///var/run/docker.sock",
+		DockerHosts:   []string{"unix:///var/run/docker.sock"},
 		FilesLocation: "/tmp/logger.test",
 		EnableFiles:   true,
 		MaxFileSize:   1,
@@ -31,16 +42,53 @@ func Test_Do(t *testing.T) {
 	time.Sleep(200 * time.Millisecond) // let it start
 }
 
+func Test_doFiltersPrecedence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "events.jsonl")
+	require.NoError(t, os.WriteFile(file, nil, 0o600))
+	opts := cliOpts{Replay: file, Includes: []string{"web"}, Excludes: []string{"web-debug"}, ReconnectJitter: "full"}
+	for _, precedence := range []string{"exclude-wins", "include-wins"} {
+		opts.Precedence = precedence
+		assert.NoError(t, do(context.Background(), &opts), "filters combined with %s", precedence)
+	}
+	opts.Precedence = "first"
+	assert.ErrorContains(t, do(context.Background(), &opts), "only single option Excludes/Includes are allowed")
+}
+
+func Test_filterSpecValidate(t *testing.T) {
+	tbl := []struct {
+		spec       filterSpec
+		precedence string
+		err        string
+	}{
+		{filterSpec{Includes: []string{"web"}, Excludes: []string{"web-debug"}}, "first", "Excludes/Includes"},
+		{filterSpec{Includes: []string{"web"}, Excludes: []string{"web-debug"}}, "exclude-wins", ""},
+		{filterSpec{Includes: []string{"web"}, Excludes: []string{"web-debug"}}, "include-wins", ""},
+		{filterSpec{Excludes: []string{"web-debug"}, ExcludesPattern: "^tmp"}, "first", "Excludes/ExcludesPattern"},
+		{filterSpec{Excludes: []string{"web-debug"}, ExcludesPattern: "^tmp"}, "exclude-wins", ""},
+		{filterSpec{Includes: []string{"web"}, IncludesPattern: "^web"}, "include-wins", "Includes/IncludesPattern"},
+		{filterSpec{Excludes: []string{"c1"}, ExcludesPattern: "["}, "exclude-wins", "could not parse Excludes Pattern"},
+	}
+	for i, tt := range tbl {
+		err := tt.spec.validate(tt.precedence)
+		if tt.err != "" {
+			assert.ErrorContains(t, err, tt.err, "case #%d", i)
+			continue
+		}
+		assert.NoError(t, err, "case #%d", i)
+	}
+}
+
 func Test_makeLogWriters(t *testing.T) {
 	defer os.RemoveAll("/tmp/logger.test") // nolint
 	setupLog(true)
 
 	opts := cliOpts{FilesLocation: "/tmp/logger.test", EnableFiles: true, MaxFileSize: 1, MaxFilesCount: 10}
-	stdWr, errWr := makeLogWriters(&opts, "container1", "gr1")
+	stdWr, errWr, err := makeLogWriters(&opts, "container1", "gr1")
+	require.NoError(t, err)
 	assert.NotEqual(t, stdWr, errWr, "different writers for out and err")
 
 	// write to out writer
-	_, err := stdWr.Write([]byte("abc line 1\n"))
+	_, err = stdWr.Write([]byte("abc line 1\n"))
 	assert.NoError(t, err)
 	_, err = stdWr.Write([]byte("xxx123 line 2\n"))
 	assert.NoError(t, err)
@@ -68,11 +116,12 @@ func Test_makeLogWritersMixed(t *testing.T) {
 	setupLog(false)
 
 	opts := cliOpts{FilesLocation: "/tmp/logger.test", EnableFiles: true, MaxFileSize: 1, MaxFilesCount: 10, MixErr: true}
-	stdWr, errWr := makeLogWriters(&opts, "container1", "gr1")
+	stdWr, errWr, err := makeLogWriters(&opts, "container1", "gr1")
+	require.NoError(t, err)
 	assert.Equal(t, stdWr, errWr, "same writer for out and err in mixed mode")
 
 	// write to out writer
-	_, err := stdWr.Write([]byte("abc line 1\n"))
+	_, err = stdWr.Write([]byte("abc line 1\n"))
 	assert.NoError(t, err)
 	_, err = stdWr.Write([]byte("xxx123 line 2\n"))
 	assert.NoError(t, err)
@@ -91,13 +140,43 @@ func Test_makeLogWritersMixed(t *testing.T) {
 	assert.NoError(t, errWr.Close())
 }
 
+func Test_makeLogWritersBuffered(t *testing.T) {
+	defer os.RemoveAll("/tmp/logger.test") // nolint
+	setupLog(false)
+
+	opts := cliOpts{FilesLocation: "/tmp/logger.test", EnableFiles: true, MaxFileSize: 1, MaxFilesCount: 10, MixErr: true,
+		BufferSize: 1024, FlushEvery: 50 * time.Millisecond}
+	stdWr, errWr, err := makeLogWriters(&opts, "container1", "gr1")
+	require.NoError(t, err)
+	_, err = stdWr.Write([]byte("abc line 1\n"))
+	assert.NoError(t, err)
+	_, err = errWr.Write([]byte("err line 1\n"))
+	assert.NoError(t, err)
+
+	r, err := os.ReadFile("/tmp/logger.test/gr1/container1.log")
+	assert.True(t, os.IsNotExist(err) || len(r) == 0, "nothing written before flush")
+
+	assert.Eventually(t, func() bool {
+		r, err = os.ReadFile("/tmp/logger.test/gr1/container1.log")
+		return err == nil && string(r) == "abc line 1\nerr line 1\n"
+	}, time.Second, 10*time.Millisecond, "flushed by interval, shared buffer in mixed mode")
+
+	_, err = stdWr.Write([]byte("abc line 2\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, stdWr.Close())
+	r, err = os.ReadFile("/tmp/logger.test/gr1/container1.log")
+	assert.NoError(t, err)
+	assert.Equal(t, "abc line 1\nerr line 1\nabc line 2\n", string(r), "flushed on close")
+}
+
 func Test_makeLogWritersWithJSON(t *testing.T) {
 	defer os.RemoveAll("/tmp/logger.test") // nolint
 	opts := cliOpts{FilesLocation: "/tmp/logger.test", EnableFiles: true, MaxFileSize: 1, MaxFilesCount: 10, ExtJSON: true}
-	stdWr, errWr := makeLogWriters(&opts, "container1", "gr1")
+	stdWr, errWr, err := makeLogWriters(&opts, "container1", "gr1")
+	require.NoError(t, err)
 
 	// write to out writer
-	_, err := stdWr.Write([]byte("abc line 1"))
+	_, err = stdWr.Write([]byte("abc line 1"))
 	assert.NoError(t, err)
 
 	r, err := os.ReadFile("/tmp/logger.test/gr1/container1.log")
@@ -111,12 +190,108 @@ func Test_makeLogWritersWithJSON(t *testing.T) {
 	assert.NoError(t, errWr.Close())
 }
 
+func Test_makeLogWritersContainerFormat(t *testing.T) {
+	defer os.RemoveAll("/tmp/logger.test") // nolint
+	opts := cliOpts{FilesLocation: "/tmp/logger.test", EnableFiles: true, MaxFileSize: 1, MaxFilesCount: 10, ExtJSON: true,
+		Source: "src1", format: logger.FormatLogfmt}
+	stdWr, errWr, err := makeLogWriters(&opts, "container1", "gr1")
+	require.NoError(t, err)
+
+	_, err = stdWr.Write([]byte("abc line 1\n"))
+	assert.NoError(t, err)
+
+	r, err := os.ReadFile("/tmp/logger.test/gr1/container1.log")
+	assert.NoError(t, err)
+	assert.Contains(t, string(r), ` host=src1 container=container1 group=gr1 msg="abc line 1"`+"\n", "container's format wins")
+
+	assert.NoError(t, stdWr.Close())
+	assert.NoError(t, errWr.Close())
+}
+
+func Test_makeLogWritersDockerTime(t *testing.T) {
+	defer os.RemoveAll("/tmp/logger.test") // nolint
+	opts := cliOpts{FilesLocation: "/tmp/logger.test", EnableFiles: true, MaxFileSize: 1, MaxFilesCount: 10, ExtJSON: true,
+		TSSource: "docker", lineTime: &logger.LineTime{}, errLineTime: &logger.LineTime{},
+		now: func() time.Time { return time.Date(2024, 5, 1, 10, 0, 5, 0, time.UTC) }}
+	stdWr, errWr, err := makeLogWriters(&opts, "container1", "gr1")
+	require.NoError(t, err)
+
+	_, err = stdWr.Write([]byte("abc line 1"))
+	assert.NoError(t, err)
+	_, err = errWr.Write([]byte("abc err 1"))
+	assert.NoError(t, err)
+
+	for _, file := range []string{"/tmp/logger.test/gr1/container1.log", "/tmp/logger.test/gr1/container1.err"} {
+		r, err := os.ReadFile(file) //nolint:gosec // test file
+		assert.NoError(t, err)
+		assert.Contains(t, string(r), `"ts":"2024-05-01T10:00:05Z"`, "receive time from clock, docker time unknown")
+		assert.Contains(t, string(r), `"ingest_time":"2024-05-01T10:00:05Z"`)
+		assert.NotContains(t, string(r), `"docker_time":`, "docker time unknown")
+	}
+
+	assert.NoError(t, stdWr.Close())
+	assert.NoError(t, errWr.Close())
+}
+
+func Test_makeLogWritersParseJSON(t *testing.T) {
+	defer os.RemoveAll("/tmp/logger.test") // nolint
+	opts := cliOpts{FilesLocation: "/tmp/logger.test", EnableFiles: true, MaxFileSize: 1, MaxFilesCount: 10, ExtJSON: true,
+		ParseJSON: "merge"}
+	stdWr, errWr, err := makeLogWriters(&opts, "container1", "gr1")
+	require.NoError(t, err)
+
+	_, err = stdWr.Write([]byte(`{"level":"info","msg":"abc line 1"}` + "\n"))
+	assert.NoError(t, err)
+
+	r, err := os.ReadFile("/tmp/logger.test/gr1/container1.log")
+	assert.NoError(t, err)
+	assert.Contains(t, string(r), `"group":"gr1","host":`)
+	assert.Contains(t, string(r), `"level":"info","msg":"abc line 1"`)
+
+	assert.NoError(t, stdWr.Close())
+	assert.NoError(t, errWr.Close())
+}
+
+func Test_makeLogWritersFileNaming(t *testing.T) {
+	dir := t.TempDir()
+	runs := []time.Time{time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), time.Date(2024, 5, 1, 12, 30, 5, 0, time.UTC)}
+	for i, created := range runs {
+		opts := cliOpts{FilesLocation: dir, EnableFiles: true, MaxFileSize: 1, MaxFilesCount: 10, FileNaming: "created",
+			created: created}
+		stdWr, errWr, err := makeLogWriters(&opts, "web", "gr1")
+		require.NoError(t, err)
+		_, err = stdWr.Write([]byte(fmt.Sprintf("run %d\n", i+1)))
+		require.NoError(t, err)
+		require.NoError(t, stdWr.Close())
+		require.NoError(t, errWr.Close())
+	}
+
+	r, err := os.ReadFile(filepath.Join(dir, "gr1", "web_20240501-100000.log"))
+	require.NoError(t, err)
+	assert.Equal(t, "run 1\n", string(r))
+	r, err = os.ReadFile(filepath.Join(dir, "gr1", "web_20240501-123005.log"))
+	require.NoError(t, err)
+	assert.Equal(t, "run 2\n", string(r), "distinct file for the next run")
+
+	opts := cliOpts{FilesLocation: dir, EnableFiles: true, MaxFileSize: 1, MaxFilesCount: 10, FileNaming: "name", created: runs[0]}
+	stdWr, errWr, err := makeLogWriters(&opts, "web", "gr1")
+	require.NoError(t, err)
+	_, err = stdWr.Write([]byte("stable\n"))
+	require.NoError(t, err)
+	require.NoError(t, stdWr.Close())
+	require.NoError(t, errWr.Close())
+	r, err = os.ReadFile(filepath.Join(dir, "gr1", "web.log"))
+	require.NoError(t, err)
+	assert.Equal(t, "stable\n", string(r), "stable names by default")
+}
+
 func Test_makeLogWritersSyslogFailed(t *testing.T) {
 	opts := cliOpts{EnableSyslog: true}
-	stdWr, errWr := makeLogWriters(&opts, "container1", "gr1")
+	stdWr, errWr, err := makeLogWriters(&opts, "container1", "gr1")
+	require.NoError(t, err)
 	assert.Equal(t, stdWr, errWr, "same writer for out and err in syslog")
 	// write to out writer
-	_, err := stdWr.Write([]byte("abc line 1\n"))
+	_, err = stdWr.Write([]byte("abc line 1\n"))
 	assert.NoError(t, err)
 	_, err = stdWr.Write([]byte("xxx123 line 2\n"))
 	assert.NoError(t, err)
@@ -130,11 +305,12 @@ func Test_makeLogWritersSyslogFailed(t *testing.T) {
 
 func Test_makeLogWritersSyslogPassed(t *testing.T) {
 	opts := cliOpts{EnableSyslog: true, SyslogHost: "127.0.0.1:514", SyslogPrefix: "docker/"}
-	stdWr, errWr := makeLogWriters(&opts, "container1", "gr1")
+	stdWr, errWr, err := makeLogWriters(&opts, "container1", "gr1")
+	require.NoError(t, err)
 	assert.Equal(t, stdWr, errWr, "same writer for out and err in syslog")
 
 	// write to out writer
-	_, err := stdWr.Write([]byte("abc line 1\n"))
+	_, err = stdWr.Write([]byte("abc line 1\n"))
 	assert.NoError(t, err)
 	_, err = stdWr.Write([]byte("xxx123 line 2\n"))
 	assert.NoError(t, err)
@@ -145,3 +321,335 @@ func Test_makeLogWritersSyslogPassed(t *testing.T) {
 	_, err = errWr.Write([]byte("xxx123 line 2\n"))
 	assert.NoError(t, err)
 }
+
+func Test_makeLogWritersTraceID(t *testing.T) {
+	dir := t.TempDir()
+	opts := cliOpts{FilesLocation: dir, EnableFiles: true, MaxFileSize: 1, MaxFilesCount: 1, Format: "logfmt",
+		TraceID: []string{"gr1:json:trace_id"}}
+	require.NoError(t, setupTraceIDs(&opts))
+	stdWr, errWr, err := makeLogWriters(&opts, "web", "gr1")
+	require.NoError(t, err)
+	_, err = stdWr.Write([]byte(`{"trace_id":"t1"}` + "\n"))
+	require.NoError(t, err)
+	require.NoError(t, stdWr.Close())
+	require.NoError(t, errWr.Close())
+	r, err := os.ReadFile(filepath.Join(dir, "gr1", "web.log"))
+	require.NoError(t, err)
+	assert.Contains(t, string(r), ` trace_id=t1 msg="{\"trace_id\":\"t1\"}"`)
+}
+
+func Test_makeLogWritersGELF(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer conn.Close()
+	read := func() map[string]interface{} {
+		buf := make([]byte, 65536)
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		n, err := conn.Read(buf)
+		require.NoError(t, err)
+		var res map[string]interface{}
+		require.NoError(t, json.Unmarshal(buf[:n], &res))
+		return res
+	}
+	container := discovery.Event{ContainerID: "id1", Image: "nginx:1.25", Host: "h1", Source: "src1"}
+
+	t.Run("gelf only", func(t *testing.T) {
+		opts := cliOpts{EnableGELF: true, GELFHost: conn.LocalAddr().String(), GELFProtocol: "udp", container: container}
+		stdWr, errWr, err := makeLogWriters(&opts, "web", "gr1")
+		require.NoError(t, err)
+		_, err = stdWr.Write([]byte("line 1\n"))
+		require.NoError(t, err)
+		msg := read()
+		assert.NotZero(t, msg["timestamp"])
+		delete(msg, "timestamp")
+		assert.Equal(t, map[string]interface{}{"version": "1.1", "host": "src1", "short_message": "line 1", "level": 6.0,
+			"_container_id": "id1", "_container_name": "web", "_image_name": "nginx:1.25", "_group": "gr1", "_docker_host": "h1",
+			"_stream": "stdout"}, msg)
+		_, err = errWr.Write([]byte("err 1\n"))
+		require.NoError(t, err)
+		msg = read()
+		assert.Equal(t, "err 1", msg["short_message"])
+		assert.Equal(t, "stderr", msg["_stream"])
+		assert.Equal(t, 3.0, msg["level"])
+
+		_, err = stdWr.Write([]byte("line 2 sta"))
+		require.NoError(t, err)
+		_, err = stdWr.Write([]byte("rted\nline 3\n"))
+		require.NoError(t, err)
+		assert.Equal(t, "line 2 started", read()["short_message"], "docker frames joined to lines")
+		assert.Equal(t, "line 3", read()["short_message"])
+		assert.NoError(t, stdWr.Close())
+		assert.NoError(t, errWr.Close())
+	})
+
+	t.Run("gelf with json files", func(t *testing.T) {
+		dir := t.TempDir()
+		opts := cliOpts{FilesLocation: dir, EnableFiles: true, MaxFileSize: 1, MaxFilesCount: 1, ExtJSON: true,
+			EnableGELF: true, GELFHost: conn.LocalAddr().String(), GELFProtocol: "udp", container: container}
+		stdWr, errWr, err := makeLogWriters(&opts, "web", "gr1")
+		require.NoError(t, err)
+		_, err = stdWr.Write([]byte("line 2\n"))
+		require.NoError(t, err)
+		assert.Equal(t, "line 2", read()["short_message"], "gelf not affected by format")
+		require.NoError(t, stdWr.Close())
+		require.NoError(t, errWr.Close())
+		r, err := os.ReadFile(filepath.Join(dir, "gr1", "web.log"))
+		require.NoError(t, err)
+		assert.Contains(t, string(r), `"msg":"line 2\n"`)
+	})
+
+	t.Run("gelf only failed", func(t *testing.T) {
+		opts := cliOpts{EnableGELF: true, GELFHost: conn.LocalAddr().String(), GELFProtocol: "bad", container: container}
+		_, _, err := makeLogWriters(&opts, "web", "gr1")
+		require.EqualError(t, err, `can't connect to gelf, the only log destination: unsupported gelf protocol "bad"`)
+	})
+
+	t.Run("gelf failed with files", func(t *testing.T) {
+		dir := t.TempDir()
+		opts := cliOpts{FilesLocation: dir, EnableFiles: true, MaxFileSize: 1, MaxFilesCount: 1,
+			EnableGELF: true, GELFHost: conn.LocalAddr().String(), GELFProtocol: "bad", container: container}
+		stdWr, errWr, err := makeLogWriters(&opts, "web", "gr1")
+		require.NoError(t, err, "files used as is")
+		_, err = stdWr.Write([]byte("line 3\n"))
+		require.NoError(t, err)
+		require.NoError(t, stdWr.Close())
+		require.NoError(t, errWr.Close())
+		r, err := os.ReadFile(filepath.Join(dir, "gr1", "web.log"))
+		require.NoError(t, err)
+		assert.Equal(t, "line 3\n", string(r))
+	})
+}
+
+func Test_hostID(t *testing.T) {
+	assert.Equal(t, "", hostID("tcp://10.0.0.1:2375", false), "single host")
+	tbl := []struct {
+		host, id string
+	}{
+		{"tcp://10.0.0.1:2375", "10.0.0.1_2375"},
+		{"tcp://10.0.0.1:2376", "10.0.0.1_2376"},
+		{"tcp://docker.example.com:2376", "docker.example.com_2376"},
+		{"tcp://docker.example.com", "docker.example.com"},
+		{"tcp://[::1]:2375", "1_2375"},
+		{"unix:///var/run/docker.sock", "var_run_docker.sock"},
+		{"unix:///run/user/1000/docker.sock", "run_user_1000_docker.sock"},
+		{"npipe:////./pipe/docker_engine", "pipe_docker_engine"},
+		{"unix://", "local"},
+		{"://bad", "local"},
+	}
+	for _, tt := range tbl {
+		assert.Equal(t, tt.id, hostID(tt.host, true), tt.host)
+	}
+}
+
+func Test_dockerClient(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", dir)
+	metaDir := filepath.Join(dir, "contexts", "meta", fmt.Sprintf("%x", sha256.Sum256([]byte("remote"))))
+	require.NoError(t, os.MkdirAll(metaDir, 0o750))
+	meta := `{"Name":"remote","Endpoints":{"docker":{"Host":"tcp://10.0.0.1:2375"}}}`
+	require.NoError(t, os.WriteFile(filepath.Join(metaDir, "meta.json"), []byte(meta), 0o600))
+
+	client, host, err := dockerClient("tcp://10.0.0.2:2375", false, true, discovery.ClientParams{})
+	require.NoError(t, err)
+	assert.Equal(t, "tcp://10.0.0.2:2375", client.Endpoint())
+	assert.Equal(t, "10.0.0.2_2375", host)
+
+	client, host, err = dockerClient("remote", true, true, discovery.ClientParams{})
+	require.NoError(t, err)
+	assert.Equal(t, "tcp://10.0.0.1:2375", client.Endpoint())
+	assert.Equal(t, "remote", host, "context name as host id")
+
+	_, host, err = dockerClient("remote", true, false, discovery.ClientParams{})
+	require.NoError(t, err)
+	assert.Equal(t, "", host)
+
+	_, _, err = dockerClient("missing", true, false, discovery.ClientParams{})
+	assert.EqualError(t, err, "docker context missing not found")
+
+	_, _, err = dockerClient("tcp://10.0.0.2:2375", false, false, clientParams(&cliOpts{DockerMaxConns: 2, DockerIdleConns: 5}))
+	assert.EqualError(t, err, "docker client idle connections 5 above max connections 2")
+}
+
+func Test_infraPatterns(t *testing.T) {
+	res, err := infraPatterns(&cliOpts{ExcludeInfra: true, InfraPatterns: []string{"^traefik"}})
+	require.NoError(t, err)
+	require.Len(t, res, len(discovery.DefaultInfraPatterns)+1)
+	assert.Equal(t, discovery.DefaultInfraPatterns[0], res[0].String())
+	assert.Equal(t, "^traefik", res[len(res)-1].String(), "built-in patterns extended")
+
+	res, err = infraPatterns(&cliOpts{InfraPatterns: []string{"^traefik"}})
+	require.NoError(t, err)
+	require.Len(t, res, 1, "own patterns only")
+
+	_, err = infraPatterns(&cliOpts{InfraPatterns: []string{"["}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `could not parse infra pattern "["`)
+
+	notifOpts, err := notifOptions(&cliOpts{ExcludeInfra: true, Precedence: "first"}, "")
+	require.NoError(t, err)
+	client := &listClient{containers: []docker.APIContainers{
+		{ID: "id1", Names: []string{"/web"}}, {ID: "id2", Names: []string{"/k8s_POD_web"}},
+	}}
+	events, err := discovery.NewEventNotif(client, nil, nil, "", "", notifOpts...)
+	require.NoError(t, err)
+	ev := <-events.Channel()
+	assert.Equal(t, "web", ev.ContainerName)
+	assert.Equal(t, 1, events.Stats().Tracked, "infra container excluded")
+}
+
+func Test_notifOptionsFilterExpr(t *testing.T) {
+	notifOpts, err := notifOptions(&cliOpts{FilterExpr: `label.env == "prod"`, Precedence: "first"}, "")
+	require.NoError(t, err)
+	client := &listClient{containers: []docker.APIContainers{
+		{ID: "id1", Names: []string{"/web"}, Labels: map[string]string{"env": "prod"}}, {ID: "id2", Names: []string{"/db"}},
+	}}
+	diag, err := discovery.Diagnose(client, nil, nil, "", "", notifOpts...)
+	require.NoError(t, err)
+	assert.Equal(t, 1, diag.Included())
+
+	notifOpts, err = notifOptions(&cliOpts{FilterExpr: `label.env ==`, Precedence: "first"}, "")
+	require.NoError(t, err)
+	_, err = discovery.Diagnose(client, nil, nil, "", "", notifOpts...)
+	assert.ErrorContains(t, err, `invalid filter expression "label.env =="`)
+}
+
+func Test_runEventLoopSkipUnhealthy(t *testing.T) {
+	client := &streamClient{health: map[string]string{"id1": "starting"}}
+	opts := cliOpts{EnableFiles: true, FilesLocation: t.TempDir(), MaxFileSize: 1, MaxFilesCount: 1, FinalFetch: true,
+		Unhealthy: "skip"}
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan discovery.Event)
+	done := make(chan struct{})
+	go func() {
+		runEventLoop(ctx, &opts, events, map[string]logger.LogClient{"": client}, nil, nil)
+		close(done)
+	}()
+
+	events <- discovery.Event{ContainerID: "id1", ContainerName: "c1", Status: true,
+		Labels: map[string]string{"logger.wait-healthy": "10ms"}}
+	time.Sleep(50 * time.Millisecond) // not healthy in time, skipped
+	events <- discovery.Event{ContainerID: "id1", ContainerName: "c1", Status: false}
+	events <- discovery.Event{ContainerID: "id2", ContainerName: "c2", Status: true}
+	require.Eventually(t, func() bool { return len(client.calls("id2")) == 1 }, time.Second, time.Millisecond)
+	events <- discovery.Event{ContainerID: "id2", ContainerName: "c2", Status: false}
+	require.Eventually(t, func() bool { return len(client.calls("id2")) == 2 }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+
+	assert.Empty(t, client.calls("id1"), "skipped container neither streamed nor fetched on stop")
+	calls := client.calls("id2")
+	assert.True(t, calls[0].Follow)
+	assert.False(t, calls[1].Follow, "final fetch of streamed container")
+}
+
+func Test_runEventLoopGroupCapSkipped(t *testing.T) {
+	client := &streamClient{health: map[string]string{"id1": "starting"}}
+	opts := cliOpts{EnableFiles: true, FilesLocation: t.TempDir(), MaxFileSize: 1, MaxFilesCount: 1,
+		Unhealthy: "skip", groupCaps: map[string]int{"web": 1}}
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan discovery.Event)
+	done := make(chan struct{})
+	go func() {
+		runEventLoop(ctx, &opts, events, map[string]logger.LogClient{"": client}, nil, nil)
+		close(done)
+	}()
+
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	events <- discovery.Event{ContainerID: "id1", ContainerName: "web-1", Group: "web", Status: true, TS: ts,
+		Labels: map[string]string{"logger.wait-healthy": "10ms"}}
+	time.Sleep(50 * time.Millisecond) // not healthy in time, skipped
+	events <- discovery.Event{ContainerID: "id2", ContainerName: "web-2", Group: "web", Status: true, TS: ts.Add(-time.Minute)}
+	require.Eventually(t, func() bool { return len(client.calls("id2")) == 1 }, time.Second, time.Millisecond,
+		"slot of skipped container free, older container streamed")
+	cancel()
+	<-done
+	assert.Empty(t, client.calls("id1"))
+}
+
+func Test_runEventLoopCrashLoopNotice(t *testing.T) {
+	client := &streamClient{}
+	opts := cliOpts{EnableFiles: true, FilesLocation: t.TempDir(), MaxFileSize: 1, MaxFilesCount: 1, CrashStarts: 1,
+		CrashWindow: time.Minute, CrashCooldown: 30 * time.Millisecond}
+	rec := &eventsRecorder{}
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan discovery.Event)
+	done := make(chan struct{})
+	go func() {
+		runEventLoop(ctx, &opts, events, map[string]logger.LogClient{"": client}, nil, []sink.EventSink{rec})
+		close(done)
+	}()
+
+	up := discovery.Event{ContainerID: "id1", ContainerName: "c1", Status: true}
+	down := discovery.Event{ContainerID: "id1", ContainerName: "c1", Reason: discovery.ReasonCrashed}
+	events <- up
+	events <- down
+	events <- up // suppressed
+	require.Eventually(t, func() bool { return len(client.calls("id1")) == 2 }, time.Second, time.Millisecond,
+		"resumed after cooldown")
+	cancel()
+	<-done
+
+	got := rec.list()
+	require.Len(t, got, 5)
+	assert.Equal(t, discovery.EventLifecycle, got[2].Type, "up event of suppressed container")
+	assert.Equal(t, discovery.EventSuppress, got[3].Type, "suppression after up event")
+	assert.True(t, got[3].Status)
+	assert.Equal(t, discovery.EventSuppress, got[4].Type)
+	assert.False(t, got[4].Status, "resumed")
+}
+
+// eventsRecorder is events sink recording published events
+type eventsRecorder struct {
+	lock   sync.Mutex
+	events []discovery.Event
+}
+
+func (r *eventsRecorder) Publish(_ context.Context, event discovery.Event) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, event)
+	return nil
+}
+
+func (r *eventsRecorder) Close(context.Context) error { return nil }
+
+func (r *eventsRecorder) list() []discovery.Event {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]discovery.Event(nil), r.events...)
+}
+
+// streamClient is a docker client streaming no logs, follow requests blocked till canceled. Inspect returns
+// container's health status from health, no healthcheck if not set.
+type streamClient struct {
+	lock   sync.Mutex
+	logs   []docker.LogsOptions
+	health map[string]string
+}
+
+func (c *streamClient) Logs(opts docker.LogsOptions) error {
+	c.lock.Lock()
+	c.logs = append(c.logs, opts)
+	c.lock.Unlock()
+	if opts.Follow {
+		<-opts.Context.Done()
+	}
+	return nil
+}
+
+func (c *streamClient) InspectContainerWithOptions(opts docker.InspectContainerOptions) (*docker.Container, error) {
+	return &docker.Container{ID: opts.ID, State: docker.State{Health: docker.Health{Status: c.health[opts.ID]}}}, nil
+}
+
+// calls returns logs requests of container
+func (c *streamClient) calls(id string) []docker.LogsOptions {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var res []docker.LogsOptions
+	for _, opts := range c.logs {
+		if opts.Container == id {
+			res = append(res, opts)
+		}
+	}
+	return res
+}
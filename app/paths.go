@@ -0,0 +1,84 @@
+package main
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// reservedWindowsNames can't be used as file names on windows, with any extension
+var reservedWindowsNames = map[string]bool{ //nolint:gochecknoglobals
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// logFilePath makes path of container's log file with ext, i.e. logs/host/group/container.log.
+// Uses os specific separators, group can be nested with either "/" or "\" separators.
+func logFilePath(location, hostDir, group, containerName, ext string) string {
+	return logFilePathOS(location, hostDir, group, containerName, ext, runtime.GOOS == "windows")
+}
+
+func logFilePathOS(location, hostDir, group, containerName, ext string, windows bool) string {
+	parts := []string{location}
+	if hostDir != "" {
+		parts = append(parts, fileName(hostDir, windows))
+	}
+	for _, g := range strings.FieldsFunc(group, func(r rune) bool { return r == '/' || r == '\\' }) {
+		parts = append(parts, fileName(g, windows))
+	}
+	parts = append(parts, fileName(containerName, windows)+ext)
+	return filepath.Join(parts...)
+}
+
+// containerLogFiles returns paths of container's log and err files, the same for both with MixErr,
+// shared files of the group for per=group. Empty if files disabled. Paths stay the same on rotation,
+// as rotated files renamed to backups.
+func containerLogFiles(opts *cliOpts, containerName, group string) (logName, errName string) {
+	if !opts.EnableFiles {
+		return "", ""
+	}
+	fp := opts.filesFor(group)
+	dir, base := group, fileBaseName(opts, containerName)
+	if fp.Shared {
+		dir, base = "", group
+	}
+	logName = logFilePath(fp.Location, opts.hostDir, dir, base, ".log")
+	if opts.MixErr {
+		return logName, logName
+	}
+	return logName, logFilePath(fp.Location, opts.hostDir, dir, base, ".err")
+}
+
+// fileBaseName returns base name of container's log files, container name with creation time for FileNaming "created",
+// i.e. web_20240501-100000, so each run of the same name gets own files. Container name if creation time unknown.
+func fileBaseName(opts *cliOpts, containerName string) string {
+	if opts.FileNaming != "created" || opts.created.IsZero() {
+		return containerName
+	}
+	return containerName + "_" + opts.created.UTC().Format("20060102-150405")
+}
+
+// fileName makes name safe to use as a single path element. Separators, characters invalid on windows
+// and control characters replaced by "_". With windows set, also protects reserved device names
+// and drops trailing dots and spaces, ignored by windows.
+func fileName(name string, windows bool) string {
+	res := strings.Map(func(r rune) rune {
+		if r < 32 || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if res == "." || res == ".." {
+		return strings.Repeat("_", len(res))
+	}
+	if !windows {
+		return res
+	}
+	res = strings.TrimRight(res, ". ")
+	base, _, _ := strings.Cut(res, ".")
+	if res == "" || reservedWindowsNames[strings.ToUpper(base)] {
+		res = "_" + res
+	}
+	return res
+}
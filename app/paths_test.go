@@ -0,0 +1,86 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_fileName(t *testing.T) {
+	tbl := []struct {
+		name    string
+		windows bool
+		res     string
+	}{
+		{"container1", false, "container1"},
+		{"my.app-1", false, "my.app-1"},
+		{`a/b\c:d*e?f"g<h>i|j`, false, "a_b_c_d_e_f_g_h_i_j"},
+		{"bad\x00\tname", false, "bad__name"},
+		{"..", false, "__"},
+		{"con", false, "con"},
+		{"con", true, "_con"},
+		{"COM1.log", true, "_COM1.log"},
+		{"console", true, "console"},
+		{"name. ", false, "name. "},
+		{"name. ", true, "name"},
+		{"...", true, "_"},
+		{`C:\app`, true, "C__app"},
+	}
+	for i, tt := range tbl {
+		assert.Equal(t, tt.res, fileName(tt.name, tt.windows), "case #%d", i)
+	}
+}
+
+func Test_logFilePathOS(t *testing.T) {
+	tbl := []struct {
+		location, hostDir, group, name string
+		windows                        bool
+		res                            string
+	}{
+		{"logs", "", "", "c1", false, "logs/c1.log"},
+		{"logs", "", "gr1", "c1", false, "logs/gr1/c1.log"},
+		{"logs", "10.0.0.1", "gr1", "c1", false, "logs/10.0.0.1/gr1/c1.log"},
+		{"logs", "::1", "gr1", "c1", false, "logs/__1/gr1/c1.log"},
+		{"logs", "", "team/app", "c1", false, "logs/team/app/c1.log"},
+		{"logs", "", `team\app`, "c1", false, "logs/team/app/c1.log"},
+		{"logs", "", "/team//", "c1", false, "logs/team/c1.log"},
+		{"logs", "", "gr1", "../c1", false, "logs/gr1/.._c1.log"},
+		{"logs", "", "gr1", "nul", true, "logs/gr1/_nul.log"},
+	}
+	for i, tt := range tbl {
+		assert.Equal(t, filepath.FromSlash(tt.res), logFilePathOS(tt.location, tt.hostDir, tt.group, tt.name, ".log", tt.windows),
+			"case #%d", i)
+	}
+}
+
+func Test_fileBaseName(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 30, 5, 0, time.FixedZone("plus2", 2*3600))
+	assert.Equal(t, "web", fileBaseName(&cliOpts{created: created}, "web"), "name by default")
+	assert.Equal(t, "web", fileBaseName(&cliOpts{FileNaming: "name", created: created}, "web"))
+	assert.Equal(t, "web_20240501-103005", fileBaseName(&cliOpts{FileNaming: "created", created: created}, "web"), "utc")
+	assert.Equal(t, "web", fileBaseName(&cliOpts{FileNaming: "created"}, "web"), "creation time unknown")
+}
+
+func Test_containerLogFiles(t *testing.T) {
+	opts := &cliOpts{EnableFiles: true, FilesLocation: "logs", hostDir: "h1"}
+	logName, errName := containerLogFiles(opts, "web", "grp")
+	assert.Equal(t, filepath.Join("logs", "h1", "grp", "web.log"), logName)
+	assert.Equal(t, filepath.Join("logs", "h1", "grp", "web.err"), errName)
+
+	opts.MixErr = true
+	logName, errName = containerLogFiles(opts, "web", "grp")
+	assert.Equal(t, filepath.Join("logs", "h1", "grp", "web.log"), logName)
+	assert.Equal(t, logName, errName, "mixed")
+
+	opts.MixErr = false
+	opts.groupFiles = map[string]fileParams{"grp": {Location: "shared", Shared: true}}
+	logName, errName = containerLogFiles(opts, "web", "grp")
+	assert.Equal(t, filepath.Join("shared", "h1", "grp.log"), logName, "group file")
+	assert.Equal(t, filepath.Join("shared", "h1", "grp.err"), errName)
+
+	logName, errName = containerLogFiles(&cliOpts{EnableSyslog: true}, "web", "grp")
+	assert.Empty(t, logName, "files disabled")
+	assert.Empty(t, errName)
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/docker-logger/app/discovery"
+	"github.com/umputun/docker-logger/app/logger"
+	"github.com/umputun/docker-logger/app/sink"
+)
+
+// wrapWriters adds per-container processing stages on top of log and err writers.
+// Lines split first, then stripped of ANSI codes, filtered by level, sampled, redacted and prefixed.
+func wrapWriters(opts *cliOpts, event discovery.Event, logWriter, errWriter io.WriteCloser) (lw, ew io.WriteCloser) {
+	lw, ew = logWriter, errWriter
+	if len(opts.lineSinks) > 0 {
+		// teed as written to log files, after all stages
+		lw = logger.NewMultiWriterIgnoreErrors(lw, sink.NewLineWriter(event, "stdout", opts.lineSinks...))
+		ew = logger.NewMultiWriterIgnoreErrors(ew, sink.NewLineWriter(event, "stderr", opts.lineSinks...))
+	}
+	if opts.linePrefix != nil {
+		data := logger.PrefixData{ID: event.ContainerID, Name: event.ContainerName, Group: event.Group,
+			Host: event.Host, Image: event.Image, Stream: "stdout"}
+		lw = logger.NewTransformer(lw, opts.linePrefix.Prefix(data))
+		data.Stream = "stderr"
+		ew = logger.NewTransformer(ew, opts.linePrefix.Prefix(data))
+	}
+	if patterns := redactFor(opts, event); len(patterns) > 0 {
+		redact := logger.Redact(patterns, opts.RedactMask)
+		lw = logger.NewTransformer(lw, redact)
+		ew = logger.NewTransformer(ew, redact)
+	}
+	var keep func(line []byte) bool
+	if opts.sampleKeep != nil {
+		keep = opts.sampleKeep.Match
+	}
+	switch rate := sampleRate(opts, event); {
+	case rate > 1:
+		log.Printf("[INFO] sample 1 of %d lines for %s", rate, event.ContainerName)
+		lw = logger.NewSampler(lw, event.ContainerName, rate, keep)
+		ew = logger.NewSampler(ew, event.ContainerName, rate, keep)
+	case rate == 0 && len(opts.sampleAges) > 0:
+		started := opts.started
+		if started.IsZero() {
+			started = startTime(event)
+		}
+		lw = logger.NewAgeSampler(lw, event.ContainerName, started, opts.sampleAges, keep)
+		ew = logger.NewAgeSampler(ew, event.ContainerName, started, opts.sampleAges, keep)
+	}
+	if lvl := minLevel(opts, event); lvl != logger.LevelUnknown {
+		log.Printf("[INFO] min level %s for %s", lvl, event.ContainerName)
+		lw = logger.NewLevelFilter(lw, event.ContainerName, lvl, opts.detector)
+		ew = logger.NewLevelFilter(ew, event.ContainerName, lvl, opts.detector)
+	}
+	if stripANSI(opts, event) {
+		lw = logger.NewANSIStripper(lw)
+		ew = logger.NewANSIStripper(ew)
+	}
+	if opts.MaxLine > 0 || lw != logWriter {
+		// line based stages need whole lines, docker frames don't align to them
+		lw = logger.NewLineSplitter(lw, opts.MaxLine)
+		ew = logger.NewLineSplitter(ew, opts.MaxLine)
+	}
+	return lw, ew
+}
+
+// minLevel returns min level of container's lines, from logger.min-level label or per-group setting
+func minLevel(opts *cliOpts, event discovery.Event) logger.Level {
+	if v, ok := event.Labels["logger.min-level"]; ok {
+		if lvl := logger.ParseLevel(v); lvl != logger.LevelUnknown {
+			return lvl
+		}
+		log.Printf("[WARN] invalid logger.min-level label %q for %s, ignored", v, event.ContainerName)
+	}
+	return opts.minLevels[event.Group]
+}
+
+// setupLevels parses level filtering options
+func setupLevels(opts *cliOpts) (err error) {
+	if opts.minLevels, err = parseMinLevels(opts.MinLevel); err != nil {
+		return err
+	}
+	pattern, err := compileOptional(opts.LevelPattern)
+	if err != nil {
+		return errors.Wrap(err, "could not parse level pattern")
+	}
+	opts.detector = logger.NewLevelDetector(pattern)
+	return nil
+}
+
+// parseMinLevels parses per-group min levels in "group:level" format
+func parseMinLevels(specs []string) (map[string]logger.Level, error) {
+	res := map[string]logger.Level{}
+	for _, spec := range specs {
+		group, val, ok := strings.Cut(spec, ":")
+		if !ok {
+			return nil, errors.Errorf("invalid min level spec %q, expected group:level", spec)
+		}
+		lvl := logger.ParseLevel(val)
+		if lvl == logger.LevelUnknown {
+			return nil, errors.Errorf("invalid min level %q for group %s", val, group)
+		}
+		res[group] = lvl
+	}
+	return res, nil
+}
+
+// scannedStart returns start of container found on startup by inspect, as its creation time misses restarts.
+// Zero if inspect failed, creation time used then.
+func scannedStart(ctx context.Context, client logger.LogClient, event discovery.Event) time.Time {
+	res, err := logger.ContainerStart(ctx, client, event.ContainerID)
+	if err != nil {
+		log.Printf("[WARN] start of %s unknown, running time counted from creation, %v", event.ContainerName, err)
+		return time.Time{}
+	}
+	return res
+}
+
+// sampleRate returns sampling rate for container, from logger.sample label or per-group setting,
+// 0 if neither set and age based sampling applies
+func sampleRate(opts *cliOpts, event discovery.Event) int {
+	if v, ok := event.Labels["logger.sample"]; ok {
+		rate, err := strconv.Atoi(v)
+		if err == nil && rate > 0 {
+			return rate
+		}
+		log.Printf("[WARN] invalid logger.sample label %q for %s, ignored", v, event.ContainerName)
+	}
+	return opts.sampleRates[event.Group]
+}
+
+// stripANSI checks if ANSI codes removed from container's lines, from logger.strip-ansi label or global setting
+func stripANSI(opts *cliOpts, event discovery.Event) bool {
+	if v, ok := event.Labels["logger.strip-ansi"]; ok {
+		if strip, err := strconv.ParseBool(v); err == nil {
+			return strip
+		}
+		log.Printf("[WARN] invalid logger.strip-ansi label %q for %s, ignored", v, event.ContainerName)
+	}
+	return opts.StripANSI
+}
+
+// formatFor returns output format of container's lines, from logger.format label or global setting
+func formatFor(opts *cliOpts, event discovery.Event) logger.Format {
+	if v, ok := event.Labels["logger.format"]; ok {
+		if format := logger.ParseFormat(v); format != logger.FormatUnknown {
+			return format
+		}
+		log.Printf("[WARN] invalid logger.format label %q for %s, ignored", v, event.ContainerName)
+	}
+	return defaultFormat(opts)
+}
+
+// defaultFormat returns global output format, --format wins over --json
+func defaultFormat(opts *cliOpts) logger.Format {
+	if format := logger.ParseFormat(opts.Format); format != logger.FormatUnknown {
+		return format
+	}
+	if opts.ExtJSON {
+		return logger.FormatJSON
+	}
+	return logger.FormatRaw
+}
+
+// buffered wraps log file writer with BufferedWriter if buffering enabled
+func buffered(opts *cliOpts, wr io.WriteCloser) io.WriteCloser {
+	if opts.BufferSize <= 0 {
+		return wr
+	}
+	return logger.NewBufferedWriter(wr, opts.BufferSize, opts.FlushEvery)
+}
+
+// budgeted wraps log file writer with disk budget's counting writer if budget enabled
+func budgeted(opts *cliOpts, wr io.WriteCloser) io.WriteCloser {
+	if opts.budget == nil {
+		return wr
+	}
+	return opts.budget.Writer(wr)
+}
+
+// tailFor returns number of existing lines streamed on start, from logger.tail label or global setting
+func tailFor(opts *cliOpts, event discovery.Event) string {
+	if v, ok := event.Labels["logger.tail"]; ok {
+		if validTail(v) {
+			return v
+		}
+		log.Printf("[WARN] invalid logger.tail label %q for %s, ignored", v, event.ContainerName)
+	}
+	return opts.Tail
+}
+
+// waitHealthyFor returns max wait for container to become healthy, from logger.wait-healthy label or global setting
+func waitHealthyFor(opts *cliOpts, event discovery.Event) time.Duration {
+	if v, ok := event.Labels["logger.wait-healthy"]; ok {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			return d
+		}
+		log.Printf("[WARN] invalid logger.wait-healthy label %q for %s, ignored", v, event.ContainerName)
+	}
+	return opts.WaitHealthy
+}
+
+// streamsFor returns output streams of container read, from logger.stream label, both by default
+func streamsFor(event discovery.Event) logger.Streams {
+	if v, ok := event.Labels["logger.stream"]; ok {
+		if streams, ok := logger.ParseStreams(v); ok {
+			return streams
+		}
+		log.Printf("[WARN] invalid logger.stream label %q for %s, ignored", v, event.ContainerName)
+	}
+	return logger.StreamsBoth
+}
+
+// validTail checks tail is "all", "start" or non-negative number
+func validTail(tail string) bool {
+	if tail == "all" || tail == logger.TailStart {
+		return true
+	}
+	n, err := strconv.Atoi(tail)
+	return err == nil && n >= 0
+}
+
+// setupSampling parses sampling options
+func setupSampling(opts *cliOpts) (err error) {
+	if opts.sampleRates, err = parseSampleRates(opts.Sample); err != nil {
+		return err
+	}
+	if opts.sampleAges, err = parseSampleAges(opts.SampleAge); err != nil {
+		return err
+	}
+	opts.sampleKeep, err = compileOptional(opts.SampleKeep)
+	return errors.Wrap(err, "could not parse sample keep pattern")
+}
+
+// parseSampleRates parses per-group sampling rates in "group:N" format
+func parseSampleRates(specs []string) (map[string]int, error) {
+	res := map[string]int{}
+	for _, spec := range specs {
+		group, val, ok := strings.Cut(spec, ":")
+		if !ok {
+			return nil, errors.Errorf("invalid sample spec %q, expected group:N", spec)
+		}
+		rate, err := strconv.Atoi(val)
+		if err != nil || rate < 1 {
+			return nil, errors.Errorf("invalid sample rate %q for group %s", val, group)
+		}
+		res[group] = rate
+	}
+	return res, nil
+}
+
+// parseSampleAges parses sampling rates by container's running time in "age:N" format, i.e. "1h:10",
+// sorted by age
+func parseSampleAges(specs []string) ([]logger.AgeRate, error) {
+	res := make([]logger.AgeRate, 0, len(specs))
+	for _, spec := range specs {
+		val, rateVal, ok := strings.Cut(spec, ":")
+		if !ok {
+			return nil, errors.Errorf("invalid sample age spec %q, expected age:N", spec)
+		}
+		age, err := time.ParseDuration(val)
+		if err != nil || age < 0 {
+			return nil, errors.Errorf("invalid sample age %q", val)
+		}
+		rate, err := strconv.Atoi(rateVal)
+		if err != nil || rate < 1 {
+			return nil, errors.Errorf("invalid sample rate %q for age %s", rateVal, val)
+		}
+		res = append(res, logger.AgeRate{Age: age, Rate: rate})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Age < res[j].Age })
+	return res, nil
+}
+
+// redactRules keeps compiled redaction patterns, global and per-group
+type redactRules struct {
+	global []*regexp.Regexp
+	groups map[string][]*regexp.Regexp
+}
+
+// redactFor returns redaction patterns of container, global and group ones with logger.redact label pattern added
+func redactFor(opts *cliOpts, event discovery.Event) []*regexp.Regexp {
+	var res []*regexp.Regexp
+	if opts.redaction != nil {
+		res = append(append(res, opts.redaction.global...), opts.redaction.groups[event.Group]...)
+	}
+	if v, ok := event.Labels["logger.redact"]; ok {
+		re, err := regexp.Compile(v)
+		if err == nil && v != "" {
+			return append(res, re)
+		}
+		log.Printf("[WARN] invalid logger.redact label %q for %s, ignored", v, event.ContainerName)
+	}
+	return res
+}
+
+// setupLinePrefix compiles line prefix template, no prefix if empty
+func setupLinePrefix(opts *cliOpts) (err error) {
+	if opts.LinePrefix == "" {
+		return nil
+	}
+	opts.linePrefix, err = logger.ParseLinePrefix(opts.LinePrefix)
+	return errors.Wrap(err, "could not parse line prefix")
+}
+
+// setupRedaction compiles global and per-group redaction patterns
+func setupRedaction(opts *cliOpts) error {
+	res := &redactRules{groups: map[string][]*regexp.Regexp{}}
+	for _, pattern := range opts.Redact {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return errors.Wrapf(err, "could not parse redact pattern %q", pattern)
+		}
+		res.global = append(res.global, re)
+	}
+	for _, spec := range opts.GroupRedact {
+		group, pattern, ok := strings.Cut(spec, ":")
+		if !ok || pattern == "" {
+			return errors.Errorf("invalid group redact spec %q, expected group:regex", spec)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return errors.Wrapf(err, "could not parse redact pattern of group %s", group)
+		}
+		res.groups[group] = append(res.groups[group], re)
+	}
+	opts.redaction = res
+	return nil
+}
+
+// traceRules keeps correlation id extractors, global and per-group ones replacing it
+type traceRules struct {
+	global *logger.TraceExtractor
+	groups map[string]*logger.TraceExtractor
+}
+
+// setupTraceIDs parses correlation id extractors in "[group:]json:field" or "[group:]re:regex" format
+func setupTraceIDs(opts *cliOpts) error {
+	if len(opts.TraceID) == 0 {
+		return nil
+	}
+	res := &traceRules{groups: map[string]*logger.TraceExtractor{}}
+	for _, spec := range opts.TraceID {
+		group, extractor := "", spec
+		if !strings.HasPrefix(spec, "json:") && !strings.HasPrefix(spec, "re:") {
+			group, extractor, _ = strings.Cut(spec, ":")
+		}
+		ex, err := logger.ParseTraceExtractor(extractor)
+		if err != nil {
+			return errors.Wrapf(err, "could not parse trace id spec %q", spec)
+		}
+		if group == "" {
+			res.global = ex
+			continue
+		}
+		res.groups[group] = ex
+	}
+	opts.traceIDs = res
+	return nil
+}
+
+// traceFor returns correlation id extractor of group, nil if none
+func traceFor(opts *cliOpts, group string) *logger.TraceExtractor {
+	if opts.traceIDs == nil {
+		return nil
+	}
+	if ex, ok := opts.traceIDs.groups[group]; ok {
+		return ex
+	}
+	return opts.traceIDs.global
+}
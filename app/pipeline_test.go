@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/docker-logger/app/discovery"
+	"github.com/umputun/docker-logger/app/logger"
+	"github.com/umputun/docker-logger/app/sink"
+)
+
+func Test_wrapWritersSampling(t *testing.T) {
+	opts := cliOpts{Sample: []string{"noisy:10"}, SampleKeep: "ERROR"}
+	require.NoError(t, setupSampling(&opts))
+
+	lw, ew := &wrMock{}, &wrMock{}
+	l, e := wrapWriters(&opts, discovery.Event{ContainerName: "c1", Group: "quiet"}, lw, ew)
+	assert.Equal(t, lw, l, "no sampling for group")
+	assert.Equal(t, ew, e)
+
+	l, e = wrapWriters(&opts, discovery.Event{ContainerName: "c1", Group: "noisy"}, lw, ew)
+	assert.IsType(t, &logger.LineSplitter{}, l)
+	assert.IsType(t, &logger.LineSplitter{}, e)
+	for i := 0; i < 20; i++ {
+		_, err := l.Write([]byte(fmt.Sprintf("line %d\n", i)))
+		require.NoError(t, err)
+	}
+	_, err := l.Write([]byte("ERROR line\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "line 0\nline 10\nERROR line\n", lw.String())
+}
+
+func Test_sampleRate(t *testing.T) {
+	opts := cliOpts{sampleRates: map[string]int{"g1": 5}}
+	assert.Equal(t, 5, sampleRate(&opts, discovery.Event{Group: "g1"}))
+	assert.Equal(t, 0, sampleRate(&opts, discovery.Event{Group: "g2"}))
+	assert.Equal(t, 100, sampleRate(&opts, discovery.Event{Group: "g1", Labels: map[string]string{"logger.sample": "100"}}))
+	assert.Equal(t, 5, sampleRate(&opts, discovery.Event{Group: "g1", Labels: map[string]string{"logger.sample": "bad"}}))
+}
+
+func Test_parseSampleRates(t *testing.T) {
+	res, err := parseSampleRates([]string{"g1:10", "g2:1"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"g1": 10, "g2": 1}, res)
+
+	for _, spec := range []string{"g1", "g1:0", "g1:x"} {
+		_, err = parseSampleRates([]string{spec})
+		assert.Error(t, err, spec)
+	}
+}
+
+func Test_wrapWritersSampleAge(t *testing.T) {
+	opts := cliOpts{Sample: []string{"noisy:10"}, SampleAge: []string{"24h:4", "1h:2"}, SampleKeep: "ERROR"}
+	require.NoError(t, setupSampling(&opts))
+	assert.Equal(t, []logger.AgeRate{{Age: time.Hour, Rate: 2}, {Age: 24 * time.Hour, Rate: 4}}, opts.sampleAges)
+
+	write := func(started time.Time, group string, labels map[string]string) string {
+		lw, ew := &wrMock{}, &wrMock{}
+		l, _ := wrapWriters(&opts, discovery.Event{ContainerName: "c1", Group: group, Labels: labels,
+			TS: started, Created: started}, lw, ew)
+		for i := 0; i < 10; i++ {
+			_, err := l.Write([]byte(fmt.Sprintf("line %d\n", i)))
+			require.NoError(t, err)
+		}
+		_, err := l.Write([]byte("ERROR line\n"))
+		require.NoError(t, err)
+		return lw.String()
+	}
+
+	assert.Equal(t, 11, strings.Count(write(time.Now(), "g1", nil), "\n"), "young container in full")
+	assert.Equal(t, "line 0\nline 2\nline 4\nline 6\nline 8\nERROR line\n", write(time.Now().Add(-2*time.Hour), "g1", nil))
+	assert.Equal(t, "line 0\nline 4\nline 8\nERROR line\n", write(time.Now().Add(-48*time.Hour), "g1", nil))
+	assert.Equal(t, "line 0\nERROR line\n", write(time.Now(), "noisy", nil), "group rate wins")
+	assert.Equal(t, 11, strings.Count(write(time.Now().Add(-48*time.Hour), "g1", map[string]string{"logger.sample": "1"}), "\n"),
+		"label wins")
+
+	opts.started = time.Now() // inspected start of container found on startup, restarted since created
+	assert.Equal(t, 11, strings.Count(write(time.Now().Add(-48*time.Hour), "g1", nil), "\n"), "running time from inspected start")
+}
+
+func Test_scannedStart(t *testing.T) {
+	started := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	client := &startClient{started: started}
+	event := discovery.Event{ContainerID: "id1", ContainerName: "c1", FromScan: true}
+	assert.Equal(t, started, scannedStart(context.Background(), client, event))
+	client.started = time.Time{}
+	assert.True(t, scannedStart(context.Background(), client, event).IsZero(), "start unknown")
+	assert.True(t, scannedStart(context.Background(), &inspectlessClient{}, event).IsZero(), "can't inspect")
+}
+
+// startClient is a docker client inspecting containers as started at started
+type startClient struct {
+	inspectlessClient
+	started time.Time
+}
+
+func (c *startClient) InspectContainerWithOptions(opts docker.InspectContainerOptions) (*docker.Container, error) {
+	return &docker.Container{ID: opts.ID, State: docker.State{StartedAt: c.started}}, nil
+}
+
+// inspectlessClient is a docker client without inspect, streaming nothing
+type inspectlessClient struct{}
+
+func (c *inspectlessClient) Logs(docker.LogsOptions) error { return nil }
+
+func Test_parseSampleAges(t *testing.T) {
+	res, err := parseSampleAges([]string{"24h:100", "30m:10"})
+	require.NoError(t, err)
+	assert.Equal(t, []logger.AgeRate{{Age: 30 * time.Minute, Rate: 10}, {Age: 24 * time.Hour, Rate: 100}}, res)
+
+	for _, spec := range []string{"1h", "x:10", "-1h:10", "1h:0", "1h:x"} {
+		_, err = parseSampleAges([]string{spec})
+		assert.Error(t, err, spec)
+	}
+}
+
+func Test_wrapWritersLevels(t *testing.T) {
+	opts := cliOpts{MinLevel: []string{"prod:warn"}}
+	require.NoError(t, setupLevels(&opts))
+
+	lw, ew := &wrMock{}, &wrMock{}
+	l, _ := wrapWriters(&opts, discovery.Event{ContainerName: "c1", Group: "dev"}, lw, ew)
+	assert.Equal(t, lw, l, "no level filter for group")
+
+	l, e := wrapWriters(&opts, discovery.Event{ContainerName: "c1", Group: "prod"}, lw, ew)
+	assert.IsType(t, &logger.LineSplitter{}, l)
+	assert.IsType(t, &logger.LineSplitter{}, e)
+	_, err := l.Write([]byte("[INFO] i1\n[WA"))
+	require.NoError(t, err)
+	_, err = l.Write([]byte("RN] w1\nplain\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "[WARN] w1\nplain\n", lw.String())
+
+	opts = cliOpts{LevelPattern: `^<(\w+)>`}
+	require.NoError(t, setupLevels(&opts))
+	lw.Reset()
+	l, _ = wrapWriters(&opts, discovery.Event{ContainerName: "c1", Labels: map[string]string{"logger.min-level": "error"}}, lw, ew)
+	_, err = l.Write([]byte("<info> i1\n<error> e1\n[INFO] not matched\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "<error> e1\n[INFO] not matched\n", lw.String())
+
+	assert.Error(t, setupLevels(&cliOpts{LevelPattern: "["}))
+}
+
+func Test_minLevel(t *testing.T) {
+	opts := cliOpts{minLevels: map[string]logger.Level{"g1": logger.LevelWarn}}
+	assert.Equal(t, logger.LevelWarn, minLevel(&opts, discovery.Event{Group: "g1"}))
+	assert.Equal(t, logger.LevelUnknown, minLevel(&opts, discovery.Event{Group: "g2"}))
+	assert.Equal(t, logger.LevelError, minLevel(&opts, discovery.Event{Group: "g1", Labels: map[string]string{"logger.min-level": "ERROR"}}))
+	assert.Equal(t, logger.LevelWarn, minLevel(&opts, discovery.Event{Group: "g1", Labels: map[string]string{"logger.min-level": "bad"}}))
+}
+
+func Test_parseMinLevels(t *testing.T) {
+	res, err := parseMinLevels([]string{"g1:warn", "g2:DEBUG"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]logger.Level{"g1": logger.LevelWarn, "g2": logger.LevelDebug}, res)
+
+	for _, spec := range []string{"g1", "g1:blah"} {
+		_, err = parseMinLevels([]string{spec})
+		assert.Error(t, err, spec)
+	}
+}
+
+func Test_tailFor(t *testing.T) {
+	opts := cliOpts{Tail: "10"}
+	assert.Equal(t, "10", tailFor(&opts, discovery.Event{}))
+	assert.Equal(t, "all", tailFor(&opts, discovery.Event{Labels: map[string]string{"logger.tail": "all"}}))
+	assert.Equal(t, "0", tailFor(&opts, discovery.Event{Labels: map[string]string{"logger.tail": "0"}}))
+	assert.Equal(t, "500", tailFor(&opts, discovery.Event{Labels: map[string]string{"logger.tail": "500"}}))
+	assert.Equal(t, "start", tailFor(&opts, discovery.Event{Labels: map[string]string{"logger.tail": "start"}}))
+	assert.Equal(t, "10", tailFor(&opts, discovery.Event{Labels: map[string]string{"logger.tail": "-1"}}), "invalid")
+	assert.Equal(t, "10", tailFor(&opts, discovery.Event{Labels: map[string]string{"logger.tail": "bad"}}), "invalid")
+}
+
+func Test_streamsFor(t *testing.T) {
+	lbl := func(v string) discovery.Event {
+		return discovery.Event{Labels: map[string]string{"logger.stream": v}}
+	}
+	assert.Equal(t, logger.StreamsBoth, streamsFor(discovery.Event{}))
+	assert.Equal(t, logger.StreamsStdout, streamsFor(lbl("stdout")))
+	assert.Equal(t, logger.StreamsStderr, streamsFor(lbl("stderr")))
+	assert.Equal(t, logger.StreamsBoth, streamsFor(lbl("both")))
+	assert.Equal(t, logger.StreamsBoth, streamsFor(lbl("stdin")), "invalid")
+	assert.Equal(t, logger.StreamsBoth, streamsFor(lbl("")), "invalid")
+}
+
+func Test_waitHealthyFor(t *testing.T) {
+	opts := cliOpts{WaitHealthy: time.Minute}
+	lbl := func(v string) discovery.Event {
+		return discovery.Event{Labels: map[string]string{"logger.wait-healthy": v}}
+	}
+	assert.Equal(t, time.Minute, waitHealthyFor(&opts, discovery.Event{}))
+	assert.Equal(t, 30*time.Second, waitHealthyFor(&opts, lbl("30s")))
+	assert.Equal(t, time.Duration(0), waitHealthyFor(&opts, lbl("0")), "disabled by label")
+	assert.Equal(t, time.Minute, waitHealthyFor(&opts, lbl("-1s")), "invalid")
+	assert.Equal(t, time.Minute, waitHealthyFor(&opts, lbl("bad")), "invalid")
+	assert.Equal(t, time.Duration(0), waitHealthyFor(&cliOpts{}, discovery.Event{}), "disabled by default")
+}
+
+func Test_wrapWritersMaxLine(t *testing.T) {
+	lw, ew := &wrMock{}, &wrMock{}
+	l, _ := wrapWriters(&cliOpts{}, discovery.Event{ContainerName: "c1"}, lw, ew)
+	assert.Equal(t, lw, l, "no stages")
+
+	l, e := wrapWriters(&cliOpts{MaxLine: 5}, discovery.Event{ContainerName: "c1"}, lw, ew)
+	assert.IsType(t, &logger.LineSplitter{}, l)
+	assert.IsType(t, &logger.LineSplitter{}, e)
+	_, err := l.Write([]byte("1234567\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "12345"+logger.TruncationMarker+"\n67\n", lw.String())
+}
+
+func Test_wrapWritersStripANSI(t *testing.T) {
+	opts := cliOpts{StripANSI: true, MinLevel: []string{"prod:warn"}}
+	require.NoError(t, setupLevels(&opts))
+
+	lw, ew := &wrMock{}, &wrMock{}
+	l, e := wrapWriters(&opts, discovery.Event{ContainerName: "c1", Group: "prod"}, lw, ew)
+	assert.IsType(t, &logger.LineSplitter{}, l)
+	assert.IsType(t, &logger.LineSplitter{}, e)
+	_, err := l.Write([]byte("\x1b[32m[INFO]\x1b[0m started\n\x1b[33m[WA"))
+	require.NoError(t, err)
+	_, err = l.Write([]byte("RN]\x1b[0m slow\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "[WARN] slow\n", lw.String(), "stripped before level filter")
+
+	lw.Reset()
+	l, _ = wrapWriters(&opts, discovery.Event{ContainerName: "c1", Labels: map[string]string{"logger.strip-ansi": "false"}}, lw, ew)
+	assert.Equal(t, lw, l, "disabled by label")
+}
+
+func Test_stripANSI(t *testing.T) {
+	lbl := func(v string) discovery.Event {
+		return discovery.Event{ContainerName: "c1", Labels: map[string]string{"logger.strip-ansi": v}}
+	}
+	assert.False(t, stripANSI(&cliOpts{}, discovery.Event{}), "disabled by default")
+	assert.True(t, stripANSI(&cliOpts{StripANSI: true}, discovery.Event{}))
+	assert.True(t, stripANSI(&cliOpts{}, lbl("true")), "enabled by label")
+	assert.False(t, stripANSI(&cliOpts{StripANSI: true}, lbl("false")), "disabled by label")
+	assert.True(t, stripANSI(&cliOpts{StripANSI: true}, lbl("bad")), "invalid label ignored")
+}
+
+func Test_formatFor(t *testing.T) {
+	lbl := func(v string) discovery.Event {
+		return discovery.Event{ContainerName: "c1", Labels: map[string]string{"logger.format": v}}
+	}
+	assert.Equal(t, logger.FormatRaw, formatFor(&cliOpts{}, discovery.Event{}), "raw by default")
+	assert.Equal(t, logger.FormatJSON, formatFor(&cliOpts{ExtJSON: true}, discovery.Event{}))
+	assert.Equal(t, logger.FormatLogfmt, formatFor(&cliOpts{Format: "logfmt"}, discovery.Event{}))
+	assert.Equal(t, logger.FormatRaw, formatFor(&cliOpts{Format: "raw", ExtJSON: true}, discovery.Event{}), "format wins over json")
+	assert.Equal(t, logger.FormatJSON, formatFor(&cliOpts{}, lbl("json")), "set by label")
+	assert.Equal(t, logger.FormatRaw, formatFor(&cliOpts{ExtJSON: true}, lbl("raw")), "label wins")
+	assert.Equal(t, logger.FormatLogfmt, formatFor(&cliOpts{Format: "logfmt"}, lbl("bad")), "invalid label ignored")
+}
+
+type wrMock struct {
+	bytes.Buffer
+}
+
+func (m *wrMock) Close() error { return nil }
+
+func Test_wrapWritersRedact(t *testing.T) {
+	opts := cliOpts{Redact: []string{`password=(\S+)`}, GroupRedact: []string{"pay:\\d{4}-\\d{4}-\\d{4}-\\d{4}"}, RedactMask: "***",
+		StripANSI: true}
+	require.NoError(t, setupRedaction(&opts))
+
+	lw, ew := &wrMock{}, &wrMock{}
+	l, e := wrapWriters(&opts, discovery.Event{ContainerName: "c1", Group: "pay"}, lw, ew)
+	assert.IsType(t, &logger.LineSplitter{}, l)
+	assert.IsType(t, &logger.LineSplitter{}, e)
+	_, err := l.Write([]byte("login password=\x1b[1msec"))
+	require.NoError(t, err)
+	_, err = l.Write([]byte("ret\x1b[0m ok\ncard 1234-5678-9012-3456\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "login password=*** ok\ncard ***\n", lw.String(), "redacted after split and strip")
+
+	lw.Reset()
+	event := discovery.Event{ContainerName: "c1", Group: "web", Labels: map[string]string{"logger.redact": `tkn_\w+`}}
+	l, _ = wrapWriters(&opts, event, lw, ew)
+	_, err = l.Write([]byte("password=x tkn_abc card 1234-5678-9012-3456\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "password=*** *** card 1234-5678-9012-3456\n", lw.String(), "global and label patterns, no group ones")
+
+	l, _ = wrapWriters(&cliOpts{}, discovery.Event{ContainerName: "c1"}, lw, ew)
+	assert.Equal(t, lw, l, "no redaction without setup")
+}
+
+func Test_redactFor(t *testing.T) {
+	opts := cliOpts{Redact: []string{"g"}, GroupRedact: []string{"g1:a", "g1:b:c", "g2:d"}}
+	require.NoError(t, setupRedaction(&opts))
+	patterns := func(event discovery.Event) (res []string) {
+		for _, re := range redactFor(&opts, event) {
+			res = append(res, re.String())
+		}
+		return res
+	}
+	assert.Equal(t, []string{"g", "a", "b:c"}, patterns(discovery.Event{Group: "g1"}))
+	assert.Equal(t, []string{"g"}, patterns(discovery.Event{Group: "g3"}))
+	assert.Equal(t, []string{"g", "d", "x"}, patterns(discovery.Event{Group: "g2", Labels: map[string]string{"logger.redact": "x"}}))
+	assert.Equal(t, []string{"g"}, patterns(discovery.Event{Labels: map[string]string{"logger.redact": "["}}), "invalid label")
+
+	bad := []cliOpts{{Redact: []string{"["}}, {GroupRedact: []string{"g1"}}, {GroupRedact: []string{"g1:"}}, {GroupRedact: []string{"g1:["}}}
+	for _, o := range bad {
+		assert.Error(t, setupRedaction(&o), "%+v", o)
+	}
+}
+
+func Test_wrapWritersLinePrefix(t *testing.T) {
+	opts := cliOpts{LinePrefix: "[{{.Group}}/{{.Name}} {{.Stream}}] ", Redact: []string{`c1`}, RedactMask: "***"}
+	require.NoError(t, setupRedaction(&opts))
+	require.NoError(t, setupLinePrefix(&opts))
+
+	lw, ew := &wrMock{}, &wrMock{}
+	l, e := wrapWriters(&opts, discovery.Event{ContainerName: "c1", Group: "g1"}, lw, ew)
+	assert.IsType(t, &logger.LineSplitter{}, l)
+	_, err := l.Write([]byte("line c1\nsecond "))
+	require.NoError(t, err)
+	_, err = l.Write([]byte("line\n"))
+	require.NoError(t, err)
+	_, err = e.Write([]byte("err line\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "[g1/c1 stdout] line ***\n[g1/c1 stdout] second line\n", lw.String(), "prefix not redacted")
+	assert.Equal(t, "[g1/c1 stderr] err line\n", ew.String())
+
+	require.NoError(t, setupLinePrefix(&cliOpts{}))
+	assert.Error(t, setupLinePrefix(&cliOpts{LinePrefix: "{{.Name"}))
+	assert.Error(t, setupLinePrefix(&cliOpts{LinePrefix: "{{.Bad}}"}))
+}
+
+func Test_traceFor(t *testing.T) {
+	opts := cliOpts{TraceID: []string{"json:trace_id", `web:re:trace=(\w+)`, "api:json:span.id"}}
+	require.NoError(t, setupTraceIDs(&opts))
+	line := []byte(`{"trace_id":"t1","span":{"id":"s1"},"msg":"trace=r1"}`)
+	assert.Equal(t, "t1", traceFor(&opts, "db").Extract(line), "global")
+	assert.Equal(t, "r1", traceFor(&opts, "web").Extract(line))
+	assert.Equal(t, "s1", traceFor(&opts, "api").Extract(line))
+
+	opts = cliOpts{TraceID: []string{"web:json:trace_id"}}
+	require.NoError(t, setupTraceIDs(&opts))
+	assert.NotNil(t, traceFor(&opts, "web"))
+	assert.Nil(t, traceFor(&opts, "db"), "no global extractor")
+	assert.Nil(t, traceFor(&cliOpts{}, "web"), "disabled")
+
+	for _, spec := range []string{"trace_id", "web:trace_id", "web:re:[", "re:"} {
+		err := setupTraceIDs(&cliOpts{TraceID: []string{spec}})
+		require.Error(t, err, spec)
+		assert.Contains(t, err.Error(), "could not parse trace id spec", spec)
+	}
+}
+
+func Test_wrapWritersLineSinks(t *testing.T) {
+	lines := &lineSinkMock{}
+	opts := cliOpts{Redact: []string{`secret=\w+`}, RedactMask: "***", lineSinks: []sink.LineSink{lines}}
+	require.NoError(t, setupRedaction(&opts))
+
+	lw, ew := &wrMock{}, &wrMock{}
+	l, e := wrapWriters(&opts, discovery.Event{ContainerID: "id1", ContainerName: "c1"}, lw, ew)
+	_, err := l.Write([]byte("line 1 secret=abc\nli"))
+	require.NoError(t, err)
+	_, err = l.Write([]byte("ne 2\n"))
+	require.NoError(t, err)
+	_, err = e.Write([]byte("err 1\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "line 1 ***\nline 2\n", lw.String())
+	assert.Equal(t, []string{"stdout:line 1 ***", "stdout:line 2", "stderr:err 1"}, lines.lines, "whole lines as written")
+}
+
+type lineSinkMock struct {
+	lines []string
+}
+
+func (m *lineSinkMock) PublishLine(line sink.LogLine) {
+	m.lines = append(m.lines, line.Stream+":"+line.Line)
+}
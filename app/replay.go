@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+	"gopkg.in/natefinch/lumberjack.v2"
+
+	"github.com/umputun/docker-logger/app/discovery"
+)
+
+// makeRecorder makes raw docker events recorder writing to RecordEvents file, rotated with one backup kept.
+// Returns nil writer if recording disabled.
+func makeRecorder(opts *cliOpts) (*discovery.RawEventRecorder, io.WriteCloser) {
+	if opts.RecordEvents == "" {
+		return nil, nil
+	}
+	wr := &lumberjack.Logger{Filename: opts.RecordEvents, MaxSize: opts.RecordMaxSize, MaxBackups: 1}
+	log.Printf("[INFO] record docker events to %s, max.size=%dM", opts.RecordEvents, opts.RecordMaxSize)
+	return discovery.NewRawEventRecorder(wr), wr
+}
+
+// replayEvents feeds events recorded to Replay file through filters and logs the outcome, no docker needed
+func replayEvents(opts *cliOpts, filters filterSpec) error {
+	fh, err := os.Open(opts.Replay)
+	if err != nil {
+		return errors.Wrap(err, "can't open replay file")
+	}
+	defer func() { _ = fh.Close() }()
+
+	notifOpts, err := notifOptions(opts, "")
+	if err != nil {
+		return err
+	}
+	events, err := discovery.Replay(fh, filters.Excludes, filters.Includes, filters.IncludesPattern,
+		filters.ExcludesPattern, notifOpts...)
+	if err != nil {
+		return errors.Wrap(err, "failed to make replay")
+	}
+	for event := range events.Channel() {
+		status := "down"
+		switch {
+		case event.Type == discovery.EventImage:
+			status = "image"
+		case event.Type == discovery.EventDaemon:
+			status = event.Daemon.Type + " " + event.Daemon.Action
+		case event.Type == discovery.EventDeploy:
+			log.Printf("[INFO] replayed deployment of %s, %d containers", event.Deployment.Project, len(event.Deployment.Containers))
+			continue
+		case event.Status:
+			status = "up"
+		}
+		log.Printf("[INFO] replayed %s %s, id %s, group %q", status, event.ContainerName, event.ContainerID, event.Group)
+	}
+	st := events.Stats()
+	log.Printf("[INFO] replay of %s completed, up %d, down %d, filtered %d, stale %d, coalesced %d", opts.Replay, st.Up,
+		st.Down, st.Filtered, st.Stale, st.Coalesced)
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_makeRecorder(t *testing.T) {
+	rec, wr := makeRecorder(&cliOpts{})
+	assert.Nil(t, rec, "disabled by default")
+	assert.Nil(t, wr)
+
+	file := filepath.Join(t.TempDir(), "events.jsonl")
+	rec, wr = makeRecorder(&cliOpts{RecordEvents: file, RecordMaxSize: 1})
+	require.NotNil(t, rec)
+	require.NoError(t, rec.Record(&docker.APIEvents{Type: "container", Status: "start",
+		Actor: docker.APIActor{ID: "id1", Attributes: map[string]string{"name": "name1"}}}))
+	require.NoError(t, wr.Close())
+
+	data, err := os.ReadFile(file) //nolint:gosec // test file
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(data), "\n"))
+	assert.Contains(t, string(data), `"status":"start"`)
+}
+
+func Test_replayEvents(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "events.jsonl")
+	rec, wr := makeRecorder(&cliOpts{RecordEvents: file, RecordMaxSize: 1})
+	for _, ev := range []*docker.APIEvents{
+		{Type: "container", Status: "start", Actor: docker.APIActor{ID: "id1", Attributes: map[string]string{"name": "name1"}}},
+		{Type: "container", Status: "start", Actor: docker.APIActor{ID: "id2", Attributes: map[string]string{"name": "skip"}}},
+		{Type: "container", Status: "die", Actor: docker.APIActor{ID: "id1", Attributes: map[string]string{"name": "name1"}}},
+	} {
+		require.NoError(t, rec.Record(ev))
+	}
+	require.NoError(t, wr.Close())
+
+	opts := cliOpts{Replay: file, Excludes: []string{"skip"}, ReconnectJitter: "full"}
+	assert.NoError(t, do(context.Background(), &opts), "replay doesn't need docker")
+
+	opts.Replay = filepath.Join(t.TempDir(), "missing.jsonl")
+	assert.ErrorContains(t, do(context.Background(), &opts), "can't open replay file")
+
+	opts = cliOpts{Replay: file, IncludesPattern: "["}
+	assert.Error(t, do(context.Background(), &opts), "bad filters")
+}
@@ -0,0 +1,100 @@
+package sink
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// batcher collects items and passes them to send in batches of up to size items, when the batch is full
+// or every interval, whichever comes first. Shared by batching sinks, send called from a single goroutine.
+type batcher[T any] struct {
+	size     int
+	interval time.Duration
+	send     func(ctx context.Context, batch []T)
+
+	lock    sync.Mutex
+	pending []T
+	flushCh chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// newBatcher makes batcher and starts its flushing loop
+func newBatcher[T any](size int, interval time.Duration, send func(ctx context.Context, batch []T)) *batcher[T] {
+	res := &batcher[T]{size: size, interval: interval, send: send, flushCh: make(chan struct{}, 1),
+		stop: make(chan struct{}), done: make(chan struct{})}
+	go res.run()
+	return res
+}
+
+// add appends item to pending batch, triggers flush if batch is full
+func (b *batcher[T]) add(item T) {
+	b.addLimited(item, 0)
+}
+
+// addLimited appends item to pending batch unless limit items pending already, no limit if 0.
+// Triggers flush if batch is full, returns false if item dropped.
+func (b *batcher[T]) addLimited(item T, limit int) bool {
+	b.lock.Lock()
+	if limit > 0 && len(b.pending) >= limit {
+		b.lock.Unlock()
+		return false
+	}
+	b.pending = append(b.pending, item)
+	full := len(b.pending) >= b.size
+	b.lock.Unlock()
+
+	if full {
+		select {
+		case b.flushCh <- struct{}{}:
+		default: // flush requested already
+		}
+	}
+	return true
+}
+
+// close stops flushing loop and sends pending items
+func (b *batcher[T]) close(ctx context.Context) error {
+	close(b.stop)
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "flush interrupted")
+	}
+	b.flush(ctx)
+	return nil
+}
+
+// run flushes pending items by interval or on request until stopped
+func (b *batcher[T]) run() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		case <-b.flushCh:
+		}
+		b.flush(context.Background())
+	}
+}
+
+// flush sends pending items in batches
+func (b *batcher[T]) flush(ctx context.Context) {
+	for {
+		b.lock.Lock()
+		n := min(len(b.pending), b.size)
+		batch := b.pending[:n:n]
+		b.pending = b.pending[n:]
+		b.lock.Unlock()
+		if n == 0 {
+			return
+		}
+		b.send(ctx, batch)
+	}
+}
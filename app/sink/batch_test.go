@@ -0,0 +1,63 @@
+package sink
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatcher(t *testing.T) {
+	var lock sync.Mutex
+	var batches [][]int
+	b := newBatcher(2, time.Hour, func(_ context.Context, batch []int) {
+		lock.Lock()
+		batches = append(batches, batch)
+		lock.Unlock()
+	})
+	b.add(1)
+	b.add(2)
+	require.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(batches) == 1
+	}, time.Second, 5*time.Millisecond, "full batch sent")
+
+	for i := 3; i <= 5; i++ {
+		b.add(i)
+	}
+	require.NoError(t, b.close(context.Background()))
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, [][]int{{1, 2}, {3, 4}, {5}}, batches, "pending sent on close")
+}
+
+func TestBatcher_Interval(t *testing.T) {
+	sent := make(chan []string, 1)
+	b := newBatcher(100, 10*time.Millisecond, func(_ context.Context, batch []string) { sent <- batch })
+	b.add("a")
+	select {
+	case batch := <-sent:
+		assert.Equal(t, []string{"a"}, batch)
+	case <-time.After(time.Second):
+		t.Fatal("batch not sent by interval")
+	}
+	require.NoError(t, b.close(context.Background()))
+}
+
+func TestBatcher_CloseInterrupted(t *testing.T) {
+	unblock := make(chan struct{})
+	b := newBatcher(1, time.Hour, func(context.Context, []int) { <-unblock })
+	b.add(1)
+	time.Sleep(10 * time.Millisecond) // let the flush loop block in send
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := b.close(ctx)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	close(unblock)
+}
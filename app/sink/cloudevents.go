@@ -0,0 +1,195 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/docker-logger/app/discovery"
+)
+
+// CloudEvents content types, of a single event in structured mode and of batched events
+const (
+	cloudEventContentType = "application/cloudevents+json"
+	cloudBatchContentType = "application/cloudevents-batch+json"
+)
+
+// CloudEvents posts container events in CloudEvents 1.0 json format to the url, i.e. of knative broker or argo events
+// webhook source. With BatchSize 1, default, each event posted on its own in structured content mode, otherwise
+// events posted in batched content mode, when BatchSize collected or every FlushInterval. Events failed after all
+// retries dropped and counted.
+type CloudEvents struct {
+	params  CloudEventsParams
+	retry   retrier
+	headers map[string]string
+	batches *batcher[CloudEvent]
+	dropped atomic.Int64
+}
+
+// CloudEventsParams defines url and options for NewCloudEvents
+type CloudEventsParams struct {
+	URL           string
+	BatchSize     int           // max events in a single post, 1 by default, i.e. structured mode
+	FlushInterval time.Duration // max delay of pending events, 1s by default
+	MaxRetries    int           // retries of failed post before events dropped
+	RetryDelay    time.Duration // initial delay between retries, doubled on each retry, 1s by default
+	HTTP          HTTPParams
+}
+
+// CloudEvent is container event in CloudEvents 1.0 json format, with the same record as webhook in data
+type CloudEvent struct {
+	SpecVersion     string        `json:"specversion"`
+	ID              string        `json:"id"`
+	Source          string        `json:"source"` // docker://host, of docker host or docker-logger's source if single host
+	Type            string        `json:"type"`   // i.e. com.docker.container.started
+	Time            time.Time     `json:"time"`
+	Subject         string        `json:"subject,omitempty"` // container name
+	DataContentType string        `json:"datacontenttype"`
+	Sequence        string        `json:"sequence,omitempty"` // sequence extension, event's Seq with --event-seq
+	Data            WebhookRecord `json:"data"`
+}
+
+// NewCloudEvents makes CloudEvents sink and starts its flushing loop. TLS and auth params checked here.
+func NewCloudEvents(params CloudEventsParams) (*CloudEvents, error) {
+	if params.URL == "" {
+		return nil, errors.New("cloudevents url required")
+	}
+	if params.BatchSize <= 0 {
+		params.BatchSize = 1
+	}
+	if params.FlushInterval <= 0 {
+		params.FlushInterval = time.Second
+	}
+	if params.RetryDelay <= 0 {
+		params.RetryDelay = time.Second
+	}
+
+	client, err := params.HTTP.Client(30 * time.Second)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid cloudevents tls params")
+	}
+	headers, err := params.HTTP.Headers()
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid cloudevents auth params")
+	}
+	headers["Content-Type"] = cloudEventContentType
+	if params.BatchSize > 1 {
+		headers["Content-Type"] = cloudBatchContentType
+	}
+
+	res := &CloudEvents{
+		params:  params,
+		retry:   retrier{client: client, maxRetries: params.MaxRetries, delay: params.RetryDelay, maxDelay: time.Minute},
+		headers: headers,
+	}
+	res.batches = newBatcher(params.BatchSize, params.FlushInterval, res.send)
+	return res, nil
+}
+
+// Publish adds event to pending batch, triggers post if batch is full
+func (c *CloudEvents) Publish(_ context.Context, event discovery.Event) error {
+	c.batches.add(MakeCloudEvent(event))
+	return nil
+}
+
+// Close stops flushing loop and sends pending events
+func (c *CloudEvents) Close(ctx context.Context) error {
+	if err := c.batches.close(ctx); err != nil {
+		return errors.Wrap(err, "cloudevents")
+	}
+	if dropped := c.Dropped(); dropped > 0 {
+		log.Printf("[WARN] cloudevents dropped %d events", dropped)
+	}
+	return nil
+}
+
+// Dropped returns number of events dropped after failed retries
+func (c *CloudEvents) Dropped() int64 {
+	return c.dropped.Load()
+}
+
+// send posts events, a single one in structured mode or array in batched mode, failed events dropped
+func (c *CloudEvents) send(ctx context.Context, batch []CloudEvent) {
+	var body []byte
+	var err error
+	if c.params.BatchSize > 1 {
+		body, err = json.Marshal(batch)
+	} else {
+		body, err = json.Marshal(batch[0]) // batch of one in structured mode
+	}
+	if err == nil {
+		err = c.retry.post(ctx, c.params.URL, c.headers, body)
+	}
+	if err != nil {
+		c.dropped.Add(int64(len(batch)))
+		log.Printf("[WARN] cloudevents dropped %d events, %v", len(batch), err)
+	}
+}
+
+// MakeCloudEvent converts event to CloudEvent with random id, type by event's type and status,
+// and source of event's docker host
+func MakeCloudEvent(event discovery.Event) CloudEvent {
+	ts := event.TS
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	res := CloudEvent{SpecVersion: "1.0", ID: uuid.NewString(), Source: cloudEventSource(event), Type: cloudEventType(event),
+		Time: ts.UTC(), Subject: event.ContainerName, DataContentType: "application/json", Data: makeRecord(event)}
+	if event.Seq > 0 {
+		res.Sequence = strconv.FormatUint(event.Seq, 10)
+	}
+	return res
+}
+
+// cloudEventType returns type of event, i.e. com.docker.container.started for up event
+func cloudEventType(event discovery.Event) string {
+	switch event.Type {
+	case discovery.EventImage:
+		return "com.docker.container.image"
+	case discovery.EventCollect:
+		if event.Status {
+			return "com.docker.logger.collection.started"
+		}
+		return "com.docker.logger.collection.stopped"
+	case discovery.EventSuppress:
+		if event.Status {
+			return "com.docker.logger.collection.suppressed"
+		}
+		return "com.docker.logger.collection.resumed"
+	case discovery.EventDaemon:
+		if event.Daemon != nil {
+			return "com.docker." + strings.ToLower(event.Daemon.Type) + "." + strings.ToLower(event.Daemon.Action)
+		}
+		return "com.docker.daemon"
+	case discovery.EventScanDone:
+		return "com.docker.logger.scan.done"
+	case discovery.EventDeploy:
+		return "com.docker.compose.deployment"
+	case discovery.EventKeepalive:
+		return "com.docker.container.keepalive"
+	}
+	if event.Status {
+		return "com.docker.container.started"
+	}
+	return "com.docker.container.stopped"
+}
+
+// cloudEventSource returns source of event, docker://host of docker host, docker-logger's source for single host
+func cloudEventSource(event discovery.Event) string {
+	host := event.Host
+	if host == "" {
+		host = event.Source
+	}
+	if host == "" {
+		host = "local"
+	}
+	return (&url.URL{Scheme: "docker", Host: host}).String()
+}
@@ -0,0 +1,151 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/docker-logger/app/discovery"
+)
+
+func TestCloudEvents_Publish(t *testing.T) {
+	var lock sync.Mutex
+	var events []map[string]any
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/cloudevents+json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "Bearer tkn", r.Header.Get("Authorization"))
+		ev := map[string]any{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&ev))
+		lock.Lock()
+		events = append(events, ev)
+		lock.Unlock()
+	}))
+	defer ts.Close()
+
+	ce, err := NewCloudEvents(CloudEventsParams{URL: ts.URL, FlushInterval: time.Hour, HTTP: HTTPParams{Token: "tkn"}})
+	require.NoError(t, err)
+	evTS := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	require.NoError(t, ce.Publish(ctx, discovery.Event{ContainerID: "id1", ContainerName: "c1", Status: true, TS: evTS,
+		Host: "h1", Seq: 5}))
+	require.NoError(t, ce.Publish(ctx, discovery.Event{ContainerID: "id1", ContainerName: "c1", TS: evTS, Host: "h1",
+		Reason: discovery.ReasonCrashed}))
+	require.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(events) == 2
+	}, time.Second, 10*time.Millisecond, "each event posted on its own")
+	require.NoError(t, ce.Close(ctx))
+
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, "1.0", events[0]["specversion"])
+	assert.Equal(t, "com.docker.container.started", events[0]["type"])
+	assert.Equal(t, "docker://h1", events[0]["source"])
+	assert.Equal(t, "2024-05-01T10:00:00Z", events[0]["time"])
+	assert.Equal(t, "c1", events[0]["subject"])
+	assert.Equal(t, "application/json", events[0]["datacontenttype"])
+	assert.Equal(t, "5", events[0]["sequence"])
+	assert.NotEmpty(t, events[0]["id"])
+	assert.Equal(t, map[string]any{"container_id": "id1", "container_name": "c1", "status": "up", "host": "h1", "seq": 5.0,
+		"ts": "2024-05-01T10:00:00Z"}, events[0]["data"])
+
+	assert.Equal(t, "com.docker.container.stopped", events[1]["type"])
+	assert.NotContains(t, events[1], "sequence")
+	assert.NotEqual(t, events[0]["id"], events[1]["id"], "unique ids")
+	assert.Equal(t, "crashed", events[1]["data"].(map[string]any)["reason"])
+	assert.Equal(t, int64(0), ce.Dropped())
+}
+
+func TestCloudEvents_PublishBatch(t *testing.T) {
+	var lock sync.Mutex
+	var batches [][]CloudEvent
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/cloudevents-batch+json", r.Header.Get("Content-Type"))
+		var batch []CloudEvent
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+		lock.Lock()
+		batches = append(batches, batch)
+		lock.Unlock()
+	}))
+	defer ts.Close()
+
+	ce, err := NewCloudEvents(CloudEventsParams{URL: ts.URL, BatchSize: 2, FlushInterval: time.Hour})
+	require.NoError(t, err)
+	ctx := context.Background()
+	for _, name := range []string{"c1", "c2", "c3"} {
+		require.NoError(t, ce.Publish(ctx, discovery.Event{ContainerName: name, Status: true}))
+	}
+	require.NoError(t, ce.Close(ctx))
+
+	lock.Lock()
+	defer lock.Unlock()
+	require.Len(t, batches, 2, "pending flushed on close")
+	require.Len(t, batches[0], 2)
+	assert.Equal(t, "c1", batches[0][0].Subject)
+	assert.Equal(t, "c2", batches[0][1].Subject)
+	assert.Equal(t, "docker://local", batches[0][0].Source)
+	assert.False(t, batches[0][0].Time.IsZero(), "time of event without ts set to now")
+	require.Len(t, batches[1], 1)
+	assert.Equal(t, "c3", batches[1][0].Subject)
+}
+
+func TestCloudEvents_Dropped(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	ce, err := NewCloudEvents(CloudEventsParams{URL: ts.URL, FlushInterval: time.Hour, RetryDelay: time.Millisecond})
+	require.NoError(t, err)
+	require.NoError(t, ce.Publish(context.Background(), discovery.Event{ContainerName: "c1"}))
+	require.NoError(t, ce.Close(context.Background()))
+	assert.Equal(t, int64(1), ce.Dropped())
+}
+
+func TestNewCloudEvents_Errors(t *testing.T) {
+	_, err := NewCloudEvents(CloudEventsParams{})
+	assert.ErrorContains(t, err, "cloudevents url required")
+	_, err = NewCloudEvents(CloudEventsParams{URL: "http://localhost", HTTP: HTTPParams{CAFile: "/no/such/file"}})
+	assert.ErrorContains(t, err, "invalid cloudevents tls params")
+}
+
+func TestMakeCloudEvent(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	tbl := []struct {
+		event discovery.Event
+		typ   string
+	}{
+		{discovery.Event{Status: true}, "com.docker.container.started"},
+		{discovery.Event{Reason: discovery.ReasonCrashed}, "com.docker.container.stopped"},
+		{discovery.Event{Type: discovery.EventCollect, Status: true}, "com.docker.logger.collection.started"},
+		{discovery.Event{Type: discovery.EventCollect}, "com.docker.logger.collection.stopped"},
+		{discovery.Event{Type: discovery.EventSuppress, Status: true}, "com.docker.logger.collection.suppressed"},
+		{discovery.Event{Type: discovery.EventSuppress}, "com.docker.logger.collection.resumed"},
+		{discovery.Event{Type: discovery.EventImage, Status: true}, "com.docker.container.image"},
+		{discovery.Event{Type: discovery.EventDaemon, Daemon: &discovery.DaemonEvent{Type: "network", Action: "disconnect"}},
+			"com.docker.network.disconnect"},
+		{discovery.Event{Type: discovery.EventDaemon}, "com.docker.daemon"},
+		{discovery.Event{Type: discovery.EventScanDone, Status: true}, "com.docker.logger.scan.done"},
+		{discovery.Event{Type: discovery.EventDeploy, Deployment: &discovery.Deployment{Project: "shop"}},
+			"com.docker.compose.deployment"},
+		{discovery.Event{Type: discovery.EventKeepalive, Status: true}, "com.docker.container.keepalive"},
+	}
+	for _, tt := range tbl {
+		tt.event.TS = ts
+		ev := MakeCloudEvent(tt.event)
+		assert.Equal(t, tt.typ, ev.Type)
+		assert.Equal(t, ts, ev.Time)
+		assert.Equal(t, makeRecord(tt.event), ev.Data)
+	}
+
+	assert.Equal(t, "docker://src1", MakeCloudEvent(discovery.Event{Source: "src1"}).Source, "source if no host")
+	assert.Equal(t, "docker://h1", MakeCloudEvent(discovery.Event{Host: "h1", Source: "src1"}).Source)
+}
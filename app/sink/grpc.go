@@ -0,0 +1,354 @@
+package sink
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/umputun/docker-logger/app/discovery"
+)
+
+// GRPCStreamMethod is the bidi streaming method of collector service. Client sends GRPCBatch messages,
+// collector replies with GRPCAck for each batch received. Messages are json, with "json" content-subtype,
+// and gzip compressed. Collector implemented with grpc-go should use GRPCCodec, i.e. grpc.ForceServerCodec.
+const GRPCStreamMethod = "/dockerlogger.v1.Collector/Stream"
+
+// GRPC streams batches of container events to collector over grpc bidi stream. Batch sent when BatchSize
+// events collected or every FlushInterval, whichever comes first. Batches kept until acknowledged by collector
+// and resent after reconnect, so delivery is at-least-once and collector should tolerate duplicates.
+// Up to MaxUnacked batches kept, the oldest dropped and counted beyond that. With Lines set container log lines
+// sent in the same batches, as "log" typed records.
+type GRPC struct {
+	params  GRPCParams
+	conn    *grpc.ClientConn
+	md      metadata.MD
+	batches *batcher[WebhookRecord]
+
+	sendLock sync.Mutex // serializes stream writes
+	lock     sync.Mutex // protects stream state and unacked
+	stream   grpc.ClientStream
+	cancel   context.CancelFunc // cancels current stream
+	seq      uint64
+	unacked  []unackedBatch
+	acked    chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	dropped  atomic.Int64
+	lines    atomic.Int64 // log lines dropped on full buffer
+}
+
+// GRPCParams defines collector address and options for NewGRPC
+type GRPCParams struct {
+	Address       string        // host:port of collector
+	BatchSize     int           // max events in a single batch, 100 by default
+	FlushInterval time.Duration // max delay of pending events, 1s by default
+	MaxUnacked    int           // max batches waiting for ack, 100 by default
+	RetryDelay    time.Duration // delay between reconnects, 1s by default
+	Plaintext     bool          // no TLS, for collectors on trusted networks
+	Lines         bool          // send log lines published by PublishLine
+	LineBuffer    int           // max pending records a log line added to, 10 batches by default
+	HTTP          HTTPParams    // TLS and auth, auth sent as authorization metadata
+}
+
+// GRPCBatch is a batch of events sent to collector. Seq is increasing within the stream's client,
+// the same batch resent after reconnect has the same Seq.
+type GRPCBatch struct {
+	Seq    uint64          `json:"seq"`
+	Events []WebhookRecord `json:"events"`
+}
+
+// GRPCAck acknowledges batches up to and including Seq
+type GRPCAck struct {
+	Seq uint64 `json:"seq"`
+}
+
+// GRPCCodec is json codec of collector stream messages
+type GRPCCodec struct{}
+
+// Marshal returns json of v
+func (GRPCCodec) Marshal(v any) ([]byte, error) { return json.Marshal(v) }
+
+// Unmarshal parses json data to v
+func (GRPCCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+// Name returns codec name, used as content-subtype
+func (GRPCCodec) Name() string { return "json" }
+
+type unackedBatch struct {
+	batch GRPCBatch
+	sent  bool // sent on the current stream
+}
+
+// NewGRPC makes GRPC sink, connection established lazily on the first batch
+func NewGRPC(params GRPCParams) (*GRPC, error) {
+	if params.Address == "" {
+		return nil, errors.New("grpc address required")
+	}
+	if params.BatchSize <= 0 {
+		params.BatchSize = 100
+	}
+	if params.FlushInterval <= 0 {
+		params.FlushInterval = time.Second
+	}
+	if params.MaxUnacked <= 0 {
+		params.MaxUnacked = 100
+	}
+	if params.RetryDelay <= 0 {
+		params.RetryDelay = time.Second
+	}
+	if params.LineBuffer <= 0 {
+		params.LineBuffer = 10 * params.BatchSize
+	}
+
+	creds := insecure.NewCredentials()
+	if !params.Plaintext {
+		tlsConf, err := params.HTTP.TLSConfig()
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid grpc tls params")
+		}
+		if tlsConf == nil {
+			tlsConf = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		creds = credentials.NewTLS(tlsConf)
+	}
+	headers, err := params.HTTP.Headers()
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid grpc auth params")
+	}
+	md := metadata.MD{}
+	for k, v := range headers {
+		md.Set(k, v)
+	}
+
+	conn, err := grpc.NewClient(params.Address, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't make grpc client for %s", params.Address)
+	}
+	res := &GRPC{params: params, conn: conn, md: md, acked: make(chan struct{}, 1), stop: make(chan struct{}),
+		done: make(chan struct{})}
+	res.batches = newBatcher(params.BatchSize, params.FlushInterval, res.send)
+	go res.retry()
+	return res, nil
+}
+
+// Publish adds event to pending batch, triggers flush if batch is full
+func (g *GRPC) Publish(_ context.Context, event discovery.Event) error {
+	g.batches.add(makeRecord(event))
+	return nil
+}
+
+// PublishLine adds log line to pending batch with Lines set, line dropped if LineBuffer records pending already
+func (g *GRPC) PublishLine(line LogLine) {
+	if !g.params.Lines {
+		return
+	}
+	if !g.batches.addLimited(makeLineRecord(line), g.params.LineBuffer) {
+		g.lines.Add(1)
+	}
+}
+
+// Close sends pending events, waits for their acks and closes connection. Batches not acknowledged
+// by the time ctx done are counted as dropped.
+func (g *GRPC) Close(ctx context.Context) error {
+	err := g.batches.close(ctx)
+	for err == nil && g.pending() > 0 {
+		select {
+		case <-g.acked:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	g.lock.Lock()
+	if g.cancel != nil {
+		g.cancel() // unblocks stream writes, if any
+	}
+	g.lock.Unlock()
+	close(g.stop)
+	<-g.done
+
+	g.lock.Lock()
+	for _, b := range g.unacked {
+		g.dropped.Add(int64(len(b.batch.Events)))
+	}
+	g.unacked = nil
+	g.lock.Unlock()
+
+	if dropped := g.Dropped(); dropped > 0 {
+		log.Printf("[WARN] grpc sink dropped %d events", dropped)
+	}
+	if dropped := g.lines.Load(); dropped > 0 {
+		log.Printf("[WARN] grpc sink dropped %d log lines on full buffer", dropped)
+	}
+	if cerr := g.conn.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	return errors.Wrap(err, "grpc sink close")
+}
+
+// Dropped returns number of events dropped, due to MaxUnacked overflow or not acknowledged on close
+func (g *GRPC) Dropped() int64 {
+	return g.dropped.Load()
+}
+
+// send adds batch to unacked and delivers it, batch resent later if delivery failed
+func (g *GRPC) send(_ context.Context, batch []WebhookRecord) {
+	g.lock.Lock()
+	g.seq++
+	g.unacked = append(g.unacked, unackedBatch{batch: GRPCBatch{Seq: g.seq, Events: batch}})
+	if over := len(g.unacked) - g.params.MaxUnacked; over > 0 {
+		for _, b := range g.unacked[:over] {
+			g.dropped.Add(int64(len(b.batch.Events)))
+			log.Printf("[WARN] grpc sink dropped batch %d of %d events, too many unacknowledged", b.batch.Seq,
+				len(b.batch.Events))
+		}
+		g.unacked = g.unacked[over:]
+	}
+	g.lock.Unlock()
+	g.deliver()
+}
+
+// deliver sends all batches not sent on the current stream, connects if needed
+func (g *GRPC) deliver() {
+	g.sendLock.Lock()
+	defer g.sendLock.Unlock()
+
+	stream, err := g.connect()
+	if err != nil {
+		log.Printf("[WARN] can't connect to grpc collector %s, %v", g.params.Address, err)
+		return
+	}
+	for {
+		g.lock.Lock()
+		var next GRPCBatch
+		for i := range g.unacked {
+			if !g.unacked[i].sent {
+				g.unacked[i].sent = true
+				next = g.unacked[i].batch
+				break
+			}
+		}
+		g.lock.Unlock()
+		if next.Seq == 0 {
+			return // all sent
+		}
+		if err := stream.SendMsg(&next); err != nil {
+			log.Printf("[WARN] can't send batch %d to grpc collector, %v", next.Seq, err)
+			g.reset(stream)
+			return
+		}
+	}
+}
+
+// connect returns current stream or opens a new one, with unacked batches marked to be resent.
+// Should be called with sendLock held.
+func (g *GRPC) connect() (grpc.ClientStream, error) {
+	g.lock.Lock()
+	current := g.stream
+	g.lock.Unlock()
+	if current != nil {
+		return current, nil
+	}
+
+	ctx, cancel := context.WithCancel(metadata.NewOutgoingContext(context.Background(), g.md))
+	desc := &grpc.StreamDesc{StreamName: "Stream", ServerStreams: true, ClientStreams: true}
+	stream, err := g.conn.NewStream(ctx, desc, GRPCStreamMethod, grpc.ForceCodec(GRPCCodec{}),
+		grpc.CallContentSubtype(GRPCCodec{}.Name()), grpc.UseCompressor(gzip.Name))
+	if err != nil {
+		cancel()
+		return nil, errors.Wrap(err, "can't open stream")
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.stream, g.cancel = stream, cancel
+	for i := range g.unacked {
+		g.unacked[i].sent = false
+	}
+	go g.receive(stream)
+	log.Printf("[DEBUG] grpc stream to %s opened, %d batches to resend", g.params.Address, len(g.unacked))
+	return stream, nil
+}
+
+// receive reads acks until stream fails, acknowledged batches removed from unacked
+func (g *GRPC) receive(stream grpc.ClientStream) {
+	for {
+		ack := GRPCAck{}
+		if err := stream.RecvMsg(&ack); err != nil {
+			log.Printf("[DEBUG] grpc stream to %s closed, %v", g.params.Address, err)
+			g.reset(stream)
+			return
+		}
+		g.lock.Lock()
+		n := 0
+		for n < len(g.unacked) && g.unacked[n].batch.Seq <= ack.Seq {
+			n++
+		}
+		g.unacked = g.unacked[n:]
+		g.lock.Unlock()
+		select {
+		case g.acked <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// reset drops failed stream, next delivery reconnects
+func (g *GRPC) reset(stream grpc.ClientStream) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.stream != stream {
+		return // replaced already
+	}
+	g.cancel()
+	g.stream, g.cancel = nil, nil
+	select {
+	case g.acked <- struct{}{}: // wake up Close waiting for acks, to check state
+	default:
+	}
+}
+
+// retry resends unacked batches every RetryDelay, until stopped
+func (g *GRPC) retry() {
+	defer close(g.done)
+	ticker := time.NewTicker(g.params.RetryDelay)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-g.stop:
+			return
+		case <-ticker.C:
+		}
+		if g.needsRetry() {
+			g.deliver()
+		}
+	}
+}
+
+// needsRetry checks if there are batches not sent on the current stream
+func (g *GRPC) needsRetry() bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	for _, b := range g.unacked {
+		if !b.sent || g.stream == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// pending returns number of unacknowledged batches
+func (g *GRPC) pending() int {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return len(g.unacked)
+}
@@ -0,0 +1,213 @@
+package sink
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	_ "google.golang.org/grpc/encoding/gzip" // registers gzip decompressor for test collector
+	"google.golang.org/grpc/metadata"
+
+	"github.com/umputun/docker-logger/app/discovery"
+)
+
+func TestGRPC_Publish(t *testing.T) {
+	col := startCollector(t)
+	g, err := NewGRPC(GRPCParams{Address: col.addr, Plaintext: true, BatchSize: 2, FlushInterval: time.Hour,
+		HTTP: HTTPParams{Token: "tkn"}})
+	require.NoError(t, err)
+
+	evTS := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	require.NoError(t, g.Publish(ctx, discovery.Event{ContainerID: "id1", ContainerName: "c1", Group: "g1", Status: true, TS: evTS}))
+	require.NoError(t, g.Publish(ctx, discovery.Event{ContainerID: "id1", ContainerName: "c1", Group: "g1", TS: evTS,
+		Reason: discovery.ReasonCrashed}))
+	require.Eventually(t, func() bool { return len(col.received()) == 1 }, time.Second, 10*time.Millisecond, "full batch sent")
+
+	require.NoError(t, g.Publish(ctx, discovery.Event{ContainerID: "id2", ContainerName: "c2", Status: true, TS: evTS}))
+	require.NoError(t, g.Close(ctx))
+
+	batches := col.received()
+	require.Len(t, batches, 2, "pending sent on close")
+	assert.Equal(t, GRPCBatch{Seq: 1, Events: []WebhookRecord{
+		{ContainerID: "id1", ContainerName: "c1", Group: "g1", Status: "up", TS: evTS},
+		{ContainerID: "id1", ContainerName: "c1", Group: "g1", Status: "down", Reason: "crashed", TS: evTS},
+	}}, batches[0])
+	assert.Equal(t, GRPCBatch{Seq: 2, Events: []WebhookRecord{{ContainerID: "id2", ContainerName: "c2", Status: "up", TS: evTS}}},
+		batches[1])
+	assert.Equal(t, []string{"Bearer tkn"}, col.md().Get("authorization"))
+	assert.Equal(t, int64(0), g.Dropped())
+}
+
+func TestGRPC_Resend(t *testing.T) {
+	col := startCollector(t)
+	col.dropAfter.Store(1) // the first batch received but not acked, stream dropped
+	g, err := NewGRPC(GRPCParams{Address: col.addr, Plaintext: true, BatchSize: 1, FlushInterval: time.Hour,
+		RetryDelay: 10 * time.Millisecond})
+	require.NoError(t, err)
+
+	require.NoError(t, g.Publish(context.Background(), discovery.Event{ContainerID: "id1", Status: true}))
+	require.Eventually(t, func() bool { return col.streams.Load() == 2 }, time.Second, 10*time.Millisecond, "reconnected")
+	require.NoError(t, g.Publish(context.Background(), discovery.Event{ContainerID: "id2", Status: true}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, g.Close(ctx))
+
+	batches := col.received()
+	require.Len(t, batches, 3)
+	assert.Equal(t, uint64(1), batches[0].Seq)
+	assert.Equal(t, uint64(1), batches[1].Seq, "unacked batch resent after reconnect")
+	assert.Equal(t, "id1", batches[1].Events[0].ContainerID)
+	assert.Equal(t, uint64(2), batches[2].Seq)
+	assert.Equal(t, int64(0), g.Dropped())
+}
+
+func TestGRPC_MaxUnacked(t *testing.T) {
+	col := startCollector(t)
+	col.noAck.Store(true)
+	g, err := NewGRPC(GRPCParams{Address: col.addr, Plaintext: true, BatchSize: 1, FlushInterval: time.Hour, MaxUnacked: 2})
+	require.NoError(t, err)
+
+	for _, id := range []string{"id1", "id2", "id3"} {
+		require.NoError(t, g.Publish(context.Background(), discovery.Event{ContainerID: id, Status: true}))
+	}
+	require.Eventually(t, func() bool { return g.Dropped() == 1 }, time.Second, 10*time.Millisecond, "the oldest dropped")
+	assert.Equal(t, 2, g.pending())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = g.Close(ctx)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, int64(3), g.Dropped(), "unacked counted as dropped on close")
+	assert.Len(t, col.received(), 3)
+}
+
+func TestGRPC_Lines(t *testing.T) {
+	col := startCollector(t)
+	g, err := NewGRPC(GRPCParams{Address: col.addr, Plaintext: true, BatchSize: 10, FlushInterval: time.Hour,
+		Lines: true, LineBuffer: 2})
+	require.NoError(t, err)
+
+	container := discovery.Event{ContainerID: "id1", ContainerName: "c1", Status: true}
+	lineTS := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, g.Publish(context.Background(), container))
+	g.PublishLine(LogLine{Container: container, Stream: "stderr", Line: "line 1", TS: lineTS})
+	g.PublishLine(LogLine{Container: container, Stream: "stderr", Line: "line 2", TS: lineTS})
+	require.NoError(t, g.Close(context.Background()))
+
+	batches := col.received()
+	require.Len(t, batches, 1)
+	assert.Equal(t, []WebhookRecord{{ContainerID: "id1", ContainerName: "c1", Status: "up"},
+		{ContainerID: "id1", ContainerName: "c1", Type: "log", Status: "up", Stream: "stderr", Line: "line 1", TS: lineTS}},
+		batches[0].Events, "the second line dropped, buffer full")
+	assert.Equal(t, int64(1), g.lines.Load())
+	assert.Equal(t, int64(0), g.Dropped())
+}
+
+func TestGRPC_NoCollector(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := lis.Addr().String()
+	require.NoError(t, lis.Close())
+
+	g, err := NewGRPC(GRPCParams{Address: addr, Plaintext: true, BatchSize: 1, RetryDelay: 10 * time.Millisecond})
+	require.NoError(t, err)
+	require.NoError(t, g.Publish(context.Background(), discovery.Event{ContainerID: "id1", Status: true}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.Error(t, g.Close(ctx))
+	assert.Equal(t, int64(1), g.Dropped())
+}
+
+func TestNewGRPC_Errors(t *testing.T) {
+	_, err := NewGRPC(GRPCParams{})
+	require.EqualError(t, err, "grpc address required")
+
+	_, err = NewGRPC(GRPCParams{Address: "localhost:1", HTTP: HTTPParams{CAFile: "/no/such/ca.pem"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid grpc tls params")
+
+	_, err = NewGRPC(GRPCParams{Address: "localhost:1", Plaintext: true, HTTP: HTTPParams{Token: "tkn", BasicAuth: "user:pass"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid grpc auth params")
+}
+
+// testCollector is a grpc collector receiving batches, acks every batch unless noAck set.
+// With dropAfter set, the stream is dropped with no ack after that many batches received on the first stream.
+type testCollector struct {
+	addr      string
+	streams   atomic.Int32
+	noAck     atomic.Bool
+	dropAfter atomic.Int32
+
+	lock    sync.Mutex
+	batches []GRPCBatch
+	meta    metadata.MD
+}
+
+func startCollector(t *testing.T) *testCollector {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	res := &testCollector{addr: lis.Addr().String()}
+
+	srv := grpc.NewServer(grpc.ForceServerCodec(GRPCCodec{}))
+	srv.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "dockerlogger.v1.Collector",
+		Streams: []grpc.StreamDesc{{StreamName: "Stream", ServerStreams: true, ClientStreams: true,
+			Handler: func(_ any, stream grpc.ServerStream) error { return res.stream(stream) }}},
+	}, nil)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+	return res
+}
+
+func (c *testCollector) stream(stream grpc.ServerStream) error {
+	num := c.streams.Add(1)
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	c.lock.Lock()
+	c.meta = md
+	c.lock.Unlock()
+
+	var count int32
+	for {
+		batch := GRPCBatch{}
+		if err := stream.RecvMsg(&batch); err != nil {
+			return nil
+		}
+		c.lock.Lock()
+		c.batches = append(c.batches, batch)
+		c.lock.Unlock()
+		count++
+		if num == 1 && count == c.dropAfter.Load() {
+			return errors.New("stream dropped")
+		}
+		if c.noAck.Load() {
+			continue
+		}
+		if err := stream.SendMsg(&GRPCAck{Seq: batch.Seq}); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *testCollector) received() []GRPCBatch {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]GRPCBatch(nil), c.batches...)
+}
+
+func (c *testCollector) md() metadata.MD {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.meta
+}
@@ -0,0 +1,84 @@
+package sink
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// HTTPParams defines TLS and authentication of http based sinks, all fields optional
+type HTTPParams struct {
+	CAFile             string // PEM file with CA certificates to verify server, system pool used if empty
+	CertFile           string // PEM client certificate for mutual TLS, requires KeyFile
+	KeyFile            string // PEM client key for mutual TLS, requires CertFile
+	InsecureSkipVerify bool   // don't verify server certificate
+	Token              string // bearer token, can't be used with BasicAuth
+	BasicAuth          string // basic auth credentials in user:password format
+}
+
+// TLSConfig makes tls config from params, nil if TLS options not set. Errors on unreadable or invalid files.
+func (p HTTPParams) TLSConfig() (*tls.Config, error) {
+	if p.CAFile == "" && p.CertFile == "" && p.KeyFile == "" && !p.InsecureSkipVerify {
+		return nil, nil
+	}
+	res := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: p.InsecureSkipVerify} //nolint:gosec // user's choice
+
+	if p.CAFile != "" {
+		pem, err := os.ReadFile(p.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't read CA file")
+		}
+		res.RootCAs = x509.NewCertPool()
+		if !res.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificates found in CA file %s", p.CAFile)
+		}
+	}
+
+	if (p.CertFile == "") != (p.KeyFile == "") {
+		return nil, errors.New("both client cert and key files required for mutual TLS")
+	}
+	if p.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(p.CertFile, p.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't load client cert")
+		}
+		res.Certificates = []tls.Certificate{cert}
+	}
+	return res, nil
+}
+
+// Headers makes authorization headers from params, empty if no auth set
+func (p HTTPParams) Headers() (map[string]string, error) {
+	if p.Token != "" && p.BasicAuth != "" {
+		return nil, errors.New("bearer token and basic auth are mutually exclusive")
+	}
+	if p.Token != "" {
+		return map[string]string{"Authorization": "Bearer " + p.Token}, nil
+	}
+	if p.BasicAuth != "" {
+		if user, _, ok := strings.Cut(p.BasicAuth, ":"); !ok || user == "" {
+			return nil, errors.New("invalid basic auth, expected user:password")
+		}
+		return map[string]string{"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte(p.BasicAuth))}, nil
+	}
+	return map[string]string{}, nil
+}
+
+// Client makes http client with TLS config from params
+func (p HTTPParams) Client(timeout time.Duration) (*http.Client, error) {
+	tlsConf, err := p.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if tlsConf != nil {
+		transport.TLSClientConfig = tlsConf
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
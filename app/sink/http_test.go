@@ -0,0 +1,83 @@
+package sink
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPParams_TLSConfig(t *testing.T) {
+	certFile, keyFile := makeCert(t)
+	badFile := filepath.Join(t.TempDir(), "bad.pem")
+	require.NoError(t, os.WriteFile(badFile, []byte("not a pem"), 0o600))
+
+	conf, err := HTTPParams{}.TLSConfig()
+	require.NoError(t, err)
+	assert.Nil(t, conf, "no tls options")
+
+	conf, err = HTTPParams{InsecureSkipVerify: true}.TLSConfig()
+	require.NoError(t, err)
+	assert.True(t, conf.InsecureSkipVerify)
+
+	conf, err = HTTPParams{CAFile: certFile, CertFile: certFile, KeyFile: keyFile}.TLSConfig()
+	require.NoError(t, err)
+	assert.NotNil(t, conf.RootCAs)
+	assert.Len(t, conf.Certificates, 1)
+
+	_, err = HTTPParams{CAFile: "/no/such/file"}.TLSConfig()
+	assert.ErrorContains(t, err, "can't read CA file")
+	_, err = HTTPParams{CAFile: badFile}.TLSConfig()
+	assert.ErrorContains(t, err, "no certificates found in CA file")
+	_, err = HTTPParams{CertFile: certFile}.TLSConfig()
+	assert.ErrorContains(t, err, "both client cert and key files required")
+	_, err = HTTPParams{CertFile: certFile, KeyFile: badFile}.TLSConfig()
+	assert.ErrorContains(t, err, "can't load client cert")
+}
+
+func TestHTTPParams_Headers(t *testing.T) {
+	h, err := HTTPParams{}.Headers()
+	require.NoError(t, err)
+	assert.Empty(t, h)
+
+	h, err = HTTPParams{Token: "tkn"}.Headers()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"Authorization": "Bearer tkn"}, h)
+
+	h, err = HTTPParams{BasicAuth: "user:passwd"}.Headers()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"Authorization": "Basic dXNlcjpwYXNzd2Q="}, h)
+
+	_, err = HTTPParams{BasicAuth: "user"}.Headers()
+	assert.ErrorContains(t, err, "invalid basic auth")
+	_, err = HTTPParams{Token: "tkn", BasicAuth: "user:passwd"}.Headers()
+	assert.ErrorContains(t, err, "mutually exclusive")
+}
+
+// makeCert writes self-signed certificate and its key to temp dir
+func makeCert(t *testing.T) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "test"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour), IsCA: true, BasicConstraintsValid: true}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600))
+	return certFile, keyFile
+}
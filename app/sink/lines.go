@@ -0,0 +1,58 @@
+package sink
+
+import (
+	"strings"
+	"time"
+
+	"github.com/umputun/docker-logger/app/discovery"
+)
+
+// LogLine is a line of container's log, published to sinks streaming log lines along with events
+type LogLine struct {
+	Container discovery.Event // up event of container
+	Stream    string          // stdout or stderr
+	Line      string          // line without trailing new line
+	TS        time.Time       // time line collected
+}
+
+// LineSink publishes container log lines. PublishLine should never block, as called by container's log stream.
+type LineSink interface {
+	PublishLine(line LogLine)
+}
+
+// LineWriter is a WriteCloser publishing each write, a log line, to line sinks. Expects whole lines,
+// i.e. written by logger.LineSplitter. Never fails.
+type LineWriter struct {
+	sinks     []LineSink
+	container discovery.Event
+	stream    string
+	now       func() time.Time
+}
+
+// NewLineWriter makes LineWriter of container's stream, stdout or stderr
+func NewLineWriter(container discovery.Event, stream string, sinks ...LineSink) *LineWriter {
+	return &LineWriter{sinks: sinks, container: container, stream: stream, now: time.Now}
+}
+
+// Write publishes p, trailing new line trimmed, to all sinks
+func (w *LineWriter) Write(p []byte) (int, error) {
+	line := LogLine{Container: w.container, Stream: w.stream, Line: strings.TrimRight(string(p), "\r\n"), TS: w.now()}
+	for _, s := range w.sinks {
+		s.PublishLine(line)
+	}
+	return len(p), nil
+}
+
+// Close does nothing, sinks closed on their own
+func (w *LineWriter) Close() error {
+	return nil
+}
+
+// makeLineRecord converts log line to record with "log" type. Network and environment of container
+// left out, as sent with its events already.
+func makeLineRecord(line LogLine) WebhookRecord {
+	rec := makeRecord(line.Container)
+	rec.Type, rec.Status, rec.Stream, rec.Line, rec.TS = "log", "up", line.Stream, line.Line, line.TS
+	rec.Network, rec.Env, rec.Seq, rec.FromScan = nil, nil, 0, false
+	return rec
+}
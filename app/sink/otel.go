@@ -0,0 +1,315 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/umputun/docker-logger/app/discovery"
+)
+
+const otelScope = "github.com/umputun/docker-logger"
+
+// OTel publishes container events as OpenTelemetry log records and, optionally, as spans covering
+// container's lifetime. Span started by up event and ended by the matching down event of the same container.
+type OTel struct {
+	logger   otellog.Logger
+	tracer   trace.Tracer // nil if spans disabled
+	shutdown []func(ctx context.Context) error
+
+	lock  sync.Mutex
+	spans map[string]trace.Span // active spans by container id
+}
+
+// OTelParams defines OTLP endpoint and options for NewOTel
+type OTelParams struct {
+	Endpoint string // OTLP/HTTP endpoint url, i.e. http://localhost:4318
+	Spans    bool   // emit spans for container lifetime in addition to log records
+	Host     string // host.name resource attribute, os hostname if empty
+	HTTP     HTTPParams
+}
+
+// NewOTel makes OTel sink exporting to OTLP/HTTP endpoint
+func NewOTel(ctx context.Context, params OTelParams) (*OTel, error) {
+	res := otelResource(params.Host)
+
+	// exporters don't connect on creation, so check tls and auth params here to fail on start and not on first push
+	tlsConf, err := params.HTTP.TLSConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid otel tls params")
+	}
+	headers, err := params.HTTP.Headers()
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid otel auth params")
+	}
+
+	logOpts := []otlploghttp.Option{otlploghttp.WithEndpointURL(params.Endpoint + "/v1/logs"), otlploghttp.WithHeaders(headers)}
+	if tlsConf != nil {
+		logOpts = append(logOpts, otlploghttp.WithTLSClientConfig(tlsConf))
+	}
+	logExp, err := otlploghttp.New(ctx, logOpts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't make otlp log exporter")
+	}
+	lp := sdklog.NewLoggerProvider(sdklog.WithProcessor(sdklog.NewBatchProcessor(logExp)), sdklog.WithResource(res))
+
+	if !params.Spans {
+		return NewOTelWithProviders(lp, nil, lp.Shutdown), nil
+	}
+
+	traceOpts := []otlptracehttp.Option{otlptracehttp.WithEndpointURL(params.Endpoint + "/v1/traces"), otlptracehttp.WithHeaders(headers)}
+	if tlsConf != nil {
+		traceOpts = append(traceOpts, otlptracehttp.WithTLSClientConfig(tlsConf))
+	}
+	traceExp, err := otlptracehttp.New(ctx, traceOpts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't make otlp trace exporter")
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(traceExp), sdktrace.WithResource(res))
+	return NewOTelWithProviders(lp, tp, lp.Shutdown, tp.Shutdown), nil
+}
+
+// otelResource makes resource of docker-logger running on the host, os hostname used if host is empty
+func otelResource(host string) *resource.Resource {
+	if host == "" {
+		host = "unknown"
+		if h, err := os.Hostname(); err == nil {
+			host = h
+		}
+	}
+	return resource.NewSchemaless(attribute.String("service.name", "docker-logger"), attribute.String("host.name", host))
+}
+
+// NewOTelWithProviders makes OTel sink with given providers. tp can be nil to disable spans.
+// shutdown funcs called on Close.
+func NewOTelWithProviders(lp otellog.LoggerProvider, tp trace.TracerProvider, shutdown ...func(ctx context.Context) error) *OTel {
+	res := &OTel{logger: lp.Logger(otelScope), shutdown: shutdown, spans: map[string]trace.Span{}}
+	if tp != nil {
+		res.tracer = tp.Tracer(otelScope)
+	}
+	return res
+}
+
+// Publish emits log record for the event and starts or ends container's span
+func (o *OTel) Publish(ctx context.Context, event discovery.Event) error {
+	if event.Type == discovery.EventCollect || event.Type == discovery.EventSuppress {
+		o.publishCollect(ctx, event)
+		return nil
+	}
+	if event.Type == discovery.EventDaemon {
+		o.publishDaemon(ctx, event)
+		return nil
+	}
+	if event.Type == discovery.EventScanDone {
+		o.publishScanDone(ctx, event)
+		return nil
+	}
+	if event.Type == discovery.EventDeploy {
+		o.publishDeployment(ctx, event)
+		return nil
+	}
+	status := "down"
+	if event.Status {
+		status = "up"
+	}
+	attrs := []attribute.KeyValue{
+		attribute.String("container.id", event.ContainerID),
+		attribute.String("container.name", event.ContainerName),
+		attribute.String("container.group", event.Group),
+		attribute.String("container.image.name", event.Image),
+		attribute.String("container.status", status),
+	}
+	if event.Reason != discovery.ReasonNone {
+		attrs = append(attrs, attribute.String("container.reason", event.Reason.String()))
+	}
+	if event.K8s != nil {
+		attrs = append(attrs, attribute.String("k8s.pod.name", event.K8s.Pod), attribute.String("k8s.namespace.name", event.K8s.Namespace))
+	}
+	if event.NodeID != "" {
+		attrs = append(attrs, attribute.String("docker.swarm.node.id", event.NodeID))
+	}
+	if event.FromScan {
+		attrs = append(attrs, attribute.String("docker.event.from_scan", "true"))
+	}
+	if event.Seq > 0 {
+		attrs = append(attrs, attribute.String("docker.event.seq", strconv.FormatUint(event.Seq, 10)))
+	}
+	if event.RawName != "" && event.RawName != event.ContainerName {
+		attrs = append(attrs, attribute.String("docker.container.name", event.RawName))
+	}
+	if event.LogFilePath != "" {
+		attrs = append(attrs, attribute.String("log.file.path", event.LogFilePath))
+	}
+	if event.ErrFilePath != "" && event.ErrFilePath != event.LogFilePath {
+		attrs = append(attrs, attribute.String("docker.err.file.path", event.ErrFilePath))
+	}
+	body := "container " + event.ContainerName + " " + status
+	if event.Type == discovery.EventKeepalive {
+		attrs = append(attrs, attribute.String("docker.event.keepalive", "true"))
+		body = "container " + event.ContainerName + " keepalive"
+	}
+
+	rec := otellog.Record{}
+	rec.SetTimestamp(event.TS)
+	rec.SetSeverity(otellog.SeverityInfo)
+	rec.SetBody(otellog.StringValue(body))
+	for _, a := range attrs {
+		rec.AddAttributes(otellog.String(string(a.Key), a.Value.AsString()))
+	}
+	o.logger.Emit(ctx, rec)
+
+	if o.tracer == nil {
+		return nil
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	span, found := o.spans[event.ContainerID]
+	if event.Status {
+		if found {
+			return nil // already up, keep the original span
+		}
+		start := event.TS
+		if event.FromScan && !event.Created.IsZero() {
+			start = event.Created // running before discovery, its start event never seen
+		}
+		_, span = o.tracer.Start(ctx, "container "+event.ContainerName, trace.WithTimestamp(start),
+			trace.WithAttributes(spanAttrs(attrs)...))
+		o.spans[event.ContainerID] = span
+		return nil
+	}
+	if !found {
+		log.Printf("[DEBUG] no span for down event of %s", event.ContainerName)
+		return nil
+	}
+	if event.Reason != discovery.ReasonNone {
+		span.SetAttributes(attribute.String("container.reason", event.Reason.String()))
+	}
+	span.End(trace.WithTimestamp(event.TS))
+	delete(o.spans, event.ContainerID)
+	return nil
+}
+
+// publishCollect emits log record of logs collection started, stopped, suppressed or resumed, with container.collection attribute.
+// Spans follow container lifecycle only and not affected.
+func (o *OTel) publishCollect(ctx context.Context, event discovery.Event) {
+	state := "stopped"
+	switch {
+	case event.Type == discovery.EventSuppress && event.Status:
+		state = "suppressed"
+	case event.Type == discovery.EventSuppress:
+		state = "resumed"
+	case event.Status:
+		state = "started"
+	}
+	rec := otellog.Record{}
+	rec.SetTimestamp(event.TS)
+	rec.SetSeverity(otellog.SeverityInfo)
+	rec.SetBody(otellog.StringValue("logs collection of container " + event.ContainerName + " " + state))
+	rec.AddAttributes(
+		otellog.String("container.id", event.ContainerID),
+		otellog.String("container.name", event.ContainerName),
+		otellog.String("container.group", event.Group),
+		otellog.String("container.image.name", event.Image),
+		otellog.String("container.collection", state),
+	)
+	o.logger.Emit(ctx, rec)
+}
+
+// publishDaemon emits log record of non-container docker event, with docker.event.* attributes
+func (o *OTel) publishDaemon(ctx context.Context, event discovery.Event) {
+	if event.Daemon == nil {
+		return
+	}
+	rec := otellog.Record{}
+	rec.SetTimestamp(event.TS)
+	rec.SetSeverity(otellog.SeverityInfo)
+	rec.SetBody(otellog.StringValue("docker " + event.Daemon.Type + " " + event.Daemon.Action))
+	rec.AddAttributes(
+		otellog.String("docker.event.type", event.Daemon.Type),
+		otellog.String("docker.event.action", event.Daemon.Action),
+		otellog.String("docker.event.actor.id", event.Daemon.ActorID),
+	)
+	if event.ContainerID != "" {
+		rec.AddAttributes(otellog.String("container.id", event.ContainerID), otellog.String("container.name", event.ContainerName))
+	}
+	o.logger.Emit(ctx, rec)
+}
+
+// publishScanDone emits log record marking the end of initial scan of running containers
+func (o *OTel) publishScanDone(ctx context.Context, event discovery.Event) {
+	rec := otellog.Record{}
+	rec.SetTimestamp(event.TS)
+	rec.SetSeverity(otellog.SeverityInfo)
+	rec.SetBody(otellog.StringValue("initial scan of containers completed"))
+	rec.AddAttributes(otellog.String("docker.scan", "done"))
+	if event.Host != "" {
+		rec.AddAttributes(otellog.String("docker.host", event.Host))
+	}
+	o.logger.Emit(ctx, rec)
+}
+
+// publishDeployment emits log record of compose deployment, with project and names of started containers
+func (o *OTel) publishDeployment(ctx context.Context, event discovery.Event) {
+	if event.Deployment == nil {
+		return
+	}
+	names := make([]string, 0, len(event.Deployment.Containers))
+	for _, c := range event.Deployment.Containers {
+		names = append(names, c.Name)
+	}
+	rec := otellog.Record{}
+	rec.SetTimestamp(event.TS)
+	rec.SetSeverity(otellog.SeverityInfo)
+	rec.SetBody(otellog.StringValue(fmt.Sprintf("deployment of %s, %d containers", event.Deployment.Project, len(names))))
+	rec.AddAttributes(otellog.String("docker.compose.project", event.Deployment.Project),
+		otellog.String("docker.deployment.containers", strings.Join(names, ",")))
+	if event.Host != "" {
+		rec.AddAttributes(otellog.String("docker.host", event.Host))
+	}
+	o.logger.Emit(ctx, rec)
+}
+
+// Close ends all active spans and shuts down providers, flushing pending data
+func (o *OTel) Close(ctx context.Context) error {
+	o.lock.Lock()
+	for id, span := range o.spans {
+		span.End()
+		delete(o.spans, id)
+	}
+	o.lock.Unlock()
+
+	errs := new(multierror.Error)
+	for _, fn := range o.shutdown {
+		if err := fn(ctx); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+// spanAttrs returns attributes for span, all but status as span covers both up and down
+func spanAttrs(attrs []attribute.KeyValue) []attribute.KeyValue {
+	res := make([]attribute.KeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		if a.Key != "container.status" {
+			res = append(res, a)
+		}
+	}
+	return res
+}
@@ -0,0 +1,319 @@
+package sink
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/umputun/docker-logger/app/discovery"
+)
+
+func TestOTel_Publish(t *testing.T) {
+	logExp := &logExporterMock{}
+	lp := sdklog.NewLoggerProvider(sdklog.WithProcessor(sdklog.NewSimpleProcessor(logExp)))
+	spanExp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(spanExp))
+	o := NewOTelWithProviders(lp, tp, lp.Shutdown) // no tp shutdown, in-memory exporter clears spans on it
+
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	require.NoError(t, o.Publish(ctx, discovery.Event{ContainerID: "id1", ContainerName: "c1", Group: "g1", Image: "img1",
+		Status: true, TS: ts}))
+	require.NoError(t, o.Publish(ctx, discovery.Event{ContainerID: "id2", ContainerName: "c2", Status: false, TS: ts}),
+		"unmatched down")
+	assert.Empty(t, spanExp.GetSpans(), "span not ended yet")
+	require.NoError(t, o.Publish(ctx, discovery.Event{ContainerID: "id1", ContainerName: "c1", Group: "g1", Image: "img1",
+		Status: false, TS: ts.Add(time.Minute), Reason: discovery.ReasonCrashed}))
+
+	spans := spanExp.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "container c1", spans[0].Name)
+	assert.Equal(t, ts, spans[0].StartTime)
+	assert.Equal(t, ts.Add(time.Minute), spans[0].EndTime)
+	assert.Contains(t, spans[0].Attributes, attribute.String("container.reason", "crashed"))
+
+	recs := logExp.get()
+	require.Len(t, recs, 3)
+	assert.Equal(t, "container c1 up", recs[0].Body().AsString())
+	assert.Equal(t, ts, recs[0].Timestamp())
+	attrs := map[string]string{}
+	recs[0].WalkAttributes(func(kv otellog.KeyValue) bool {
+		attrs[kv.Key] = kv.Value.AsString()
+		return true
+	})
+	assert.Equal(t, map[string]string{"container.id": "id1", "container.name": "c1", "container.group": "g1",
+		"container.image.name": "img1", "container.status": "up"}, attrs)
+	assert.Equal(t, "container c2 down", recs[1].Body().AsString())
+	assert.Equal(t, "container c1 down", recs[2].Body().AsString())
+	reason := ""
+	recs[2].WalkAttributes(func(kv otellog.KeyValue) bool {
+		if kv.Key == "container.reason" {
+			reason = kv.Value.AsString()
+		}
+		return true
+	})
+	assert.Equal(t, "crashed", reason)
+
+	require.NoError(t, o.Publish(ctx, discovery.Event{ContainerID: "id3", ContainerName: "c3", Status: true, TS: ts}))
+	require.NoError(t, o.Close(ctx))
+	assert.Len(t, spanExp.GetSpans(), 2, "active span ended on close")
+}
+
+func TestOTel_PublishScanned(t *testing.T) {
+	lp := sdklog.NewLoggerProvider(sdklog.WithProcessor(sdklog.NewSimpleProcessor(&logExporterMock{})))
+	spanExp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(spanExp))
+	o := NewOTelWithProviders(lp, tp, lp.Shutdown)
+
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	ts := created.Add(time.Hour)
+	ctx := context.Background()
+	require.NoError(t, o.Publish(ctx, discovery.Event{ContainerID: "id1", ContainerName: "c1", Status: true,
+		TS: time.Unix(created.Unix()/1000, 0), Created: created, FromScan: true}))
+	require.NoError(t, o.Publish(ctx, discovery.Event{ContainerID: "id2", ContainerName: "c2", Status: true, TS: ts,
+		Created: created}))
+	require.NoError(t, o.Publish(ctx, discovery.Event{ContainerID: "id1", ContainerName: "c1", TS: ts}))
+	require.NoError(t, o.Publish(ctx, discovery.Event{ContainerID: "id2", ContainerName: "c2", TS: ts.Add(time.Minute)}))
+
+	spans := spanExp.GetSpans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, created, spans[0].StartTime.UTC(), "scanned container started by its creation")
+	assert.Equal(t, ts, spans[0].EndTime.UTC())
+	assert.Equal(t, ts, spans[1].StartTime.UTC(), "start event time for started container")
+}
+
+func TestOTel_PublishNoSpans(t *testing.T) {
+	logExp := &logExporterMock{}
+	lp := sdklog.NewLoggerProvider(sdklog.WithProcessor(sdklog.NewSimpleProcessor(logExp)))
+	o := NewOTelWithProviders(lp, nil, lp.Shutdown)
+	require.NoError(t, o.Publish(context.Background(), discovery.Event{ContainerID: "id1", ContainerName: "c1", RawName: "raw1",
+		Status: true, K8s: &discovery.K8sMeta{Pod: "web-1", Namespace: "ns1"}, NodeID: "node1", Seq: 3, FromScan: true}))
+	require.Len(t, logExp.get(), 1)
+	attrs := map[string]string{}
+	logExp.get()[0].WalkAttributes(func(kv otellog.KeyValue) bool {
+		attrs[kv.Key] = kv.Value.AsString()
+		return true
+	})
+	assert.Equal(t, "3", attrs["docker.event.seq"])
+	assert.Equal(t, "true", attrs["docker.event.from_scan"])
+	assert.Equal(t, "web-1", attrs["k8s.pod.name"])
+	assert.Equal(t, "ns1", attrs["k8s.namespace.name"])
+	assert.Equal(t, "node1", attrs["docker.swarm.node.id"])
+	assert.Equal(t, "raw1", attrs["docker.container.name"])
+	assert.Empty(t, o.spans)
+	require.NoError(t, o.Close(context.Background()))
+}
+
+func TestOTel_PublishCollect(t *testing.T) {
+	logExp := &logExporterMock{}
+	lp := sdklog.NewLoggerProvider(sdklog.WithProcessor(sdklog.NewSimpleProcessor(logExp)))
+	spanExp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(spanExp))
+	o := NewOTelWithProviders(lp, tp, lp.Shutdown)
+
+	ctx := context.Background()
+	require.NoError(t, o.Publish(ctx, discovery.Event{ContainerID: "id1", ContainerName: "c1", Status: true,
+		Type: discovery.EventCollect}))
+	require.NoError(t, o.Publish(ctx, discovery.Event{ContainerID: "id1", ContainerName: "c1", Type: discovery.EventCollect}))
+	require.NoError(t, o.Publish(ctx, discovery.Event{ContainerID: "id1", ContainerName: "c1", Status: true,
+		Type: discovery.EventSuppress}))
+	o.lock.Lock()
+	assert.Empty(t, o.spans, "no spans for collection events")
+	o.lock.Unlock()
+
+	recs := logExp.get()
+	require.Len(t, recs, 3)
+	assert.Equal(t, "logs collection of container c1 suppressed", recs[2].Body().AsString())
+	assert.Equal(t, "logs collection of container c1 started", recs[0].Body().AsString())
+	assert.Equal(t, "logs collection of container c1 stopped", recs[1].Body().AsString())
+	attrs := map[string]string{}
+	recs[1].WalkAttributes(func(kv otellog.KeyValue) bool {
+		attrs[kv.Key] = kv.Value.AsString()
+		return true
+	})
+	assert.Equal(t, "stopped", attrs["container.collection"])
+	assert.Equal(t, "id1", attrs["container.id"])
+	require.NoError(t, o.Close(ctx))
+	assert.Empty(t, spanExp.GetSpans())
+}
+
+func TestOTel_PublishDaemon(t *testing.T) {
+	logExp := &logExporterMock{}
+	lp := sdklog.NewLoggerProvider(sdklog.WithProcessor(sdklog.NewSimpleProcessor(logExp)))
+	spanExp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(spanExp))
+	o := NewOTelWithProviders(lp, tp, lp.Shutdown)
+
+	ctx := context.Background()
+	require.NoError(t, o.Publish(ctx, discovery.Event{ContainerID: "id1", ContainerName: "c1", Type: discovery.EventDaemon,
+		Daemon: &discovery.DaemonEvent{Type: "network", Action: "disconnect", ActorID: "net1"}}))
+	require.NoError(t, o.Publish(ctx, discovery.Event{Type: discovery.EventDaemon,
+		Daemon: &discovery.DaemonEvent{Type: "volume", Action: "unmount", ActorID: "vol1"}}))
+
+	recs := logExp.get()
+	require.Len(t, recs, 2)
+	assert.Equal(t, "docker network disconnect", recs[0].Body().AsString())
+	attrs := map[string]string{}
+	recs[0].WalkAttributes(func(kv otellog.KeyValue) bool {
+		attrs[kv.Key] = kv.Value.AsString()
+		return true
+	})
+	assert.Equal(t, map[string]string{"docker.event.type": "network", "docker.event.action": "disconnect",
+		"docker.event.actor.id": "net1", "container.id": "id1", "container.name": "c1"}, attrs)
+	assert.Equal(t, 3, recs[1].AttributesLen(), "no container attributes")
+	require.NoError(t, o.Close(ctx))
+	assert.Empty(t, spanExp.GetSpans(), "no spans for daemon events")
+}
+
+func TestOTel_PublishScanDone(t *testing.T) {
+	logExp := &logExporterMock{}
+	lp := sdklog.NewLoggerProvider(sdklog.WithProcessor(sdklog.NewSimpleProcessor(logExp)))
+	spanExp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(spanExp))
+	o := NewOTelWithProviders(lp, tp, lp.Shutdown)
+
+	ctx := context.Background()
+	require.NoError(t, o.Publish(ctx, discovery.Event{Host: "h1", Type: discovery.EventScanDone}))
+	require.NoError(t, o.Publish(ctx, discovery.Event{Type: discovery.EventScanDone}))
+
+	recs := logExp.get()
+	require.Len(t, recs, 2)
+	assert.Equal(t, "initial scan of containers completed", recs[0].Body().AsString())
+	attrs := map[string]string{}
+	recs[0].WalkAttributes(func(kv otellog.KeyValue) bool {
+		attrs[kv.Key] = kv.Value.AsString()
+		return true
+	})
+	assert.Equal(t, map[string]string{"docker.scan": "done", "docker.host": "h1"}, attrs)
+	assert.Equal(t, 1, recs[1].AttributesLen(), "no host attribute")
+	require.NoError(t, o.Close(ctx))
+	assert.Empty(t, spanExp.GetSpans(), "no spans for scan marker")
+}
+
+func TestOTel_PublishKeepalive(t *testing.T) {
+	logExp := &logExporterMock{}
+	lp := sdklog.NewLoggerProvider(sdklog.WithProcessor(sdklog.NewSimpleProcessor(logExp)))
+	spanExp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(spanExp))
+	o := NewOTelWithProviders(lp, tp, lp.Shutdown)
+
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	up := discovery.Event{ContainerID: "id1", ContainerName: "c1", Status: true, TS: ts}
+	require.NoError(t, o.Publish(ctx, up))
+	keepalive := up
+	keepalive.Type, keepalive.TS = discovery.EventKeepalive, ts.Add(time.Minute)
+	require.NoError(t, o.Publish(ctx, keepalive))
+	require.NoError(t, o.Publish(ctx, discovery.Event{ContainerID: "id1", ContainerName: "c1", TS: ts.Add(2 * time.Minute)}))
+
+	recs := logExp.get()
+	require.Len(t, recs, 3)
+	assert.Equal(t, "container c1 keepalive", recs[1].Body().AsString())
+	attrs := map[string]string{}
+	recs[1].WalkAttributes(func(kv otellog.KeyValue) bool {
+		attrs[kv.Key] = kv.Value.AsString()
+		return true
+	})
+	assert.Equal(t, "true", attrs["docker.event.keepalive"])
+	assert.Equal(t, "up", attrs["container.status"])
+
+	spans := spanExp.GetSpans()
+	require.Len(t, spans, 1, "keepalive keeps the original span")
+	assert.Equal(t, ts, spans[0].StartTime)
+	require.NoError(t, o.Close(ctx))
+}
+
+func TestOTel_PublishDeployment(t *testing.T) {
+	logExp := &logExporterMock{}
+	lp := sdklog.NewLoggerProvider(sdklog.WithProcessor(sdklog.NewSimpleProcessor(logExp)))
+	spanExp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(spanExp))
+	o := NewOTelWithProviders(lp, tp, lp.Shutdown)
+
+	ctx := context.Background()
+	require.NoError(t, o.Publish(ctx, discovery.Event{Host: "h1", Type: discovery.EventDeploy,
+		Deployment: &discovery.Deployment{Project: "shop", Containers: []discovery.DeploymentContainer{
+			{ID: "id1", Name: "shop-web-1"}, {ID: "id2", Name: "shop-db-1"}}}}))
+
+	recs := logExp.get()
+	require.Len(t, recs, 1)
+	assert.Equal(t, "deployment of shop, 2 containers", recs[0].Body().AsString())
+	attrs := map[string]string{}
+	recs[0].WalkAttributes(func(kv otellog.KeyValue) bool {
+		attrs[kv.Key] = kv.Value.AsString()
+		return true
+	})
+	assert.Equal(t, map[string]string{"docker.compose.project": "shop", "docker.deployment.containers": "shop-web-1,shop-db-1",
+		"docker.host": "h1"}, attrs)
+	require.NoError(t, o.Close(ctx))
+	assert.Empty(t, spanExp.GetSpans(), "no spans for deployment")
+}
+
+func TestNewOTel(t *testing.T) {
+	o, err := NewOTel(context.Background(), OTelParams{Endpoint: "http://127.0.0.1:4318", Spans: true, Host: "h1"})
+	require.NoError(t, err)
+	assert.NotNil(t, o.tracer)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_ = o.Close(ctx) // nothing listening, only make sure it doesn't hang
+}
+
+func TestOTelResource(t *testing.T) {
+	host, ok := otelResource("h1").Set().Value("host.name")
+	require.True(t, ok)
+	assert.Equal(t, "h1", host.AsString())
+
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+	host, ok = otelResource("").Set().Value("host.name")
+	require.True(t, ok)
+	assert.Equal(t, hostname, host.AsString(), "os hostname by default")
+}
+
+func TestNewOTelHTTPParams(t *testing.T) {
+	certFile, keyFile := makeCert(t)
+	o, err := NewOTel(context.Background(), OTelParams{Endpoint: "https://127.0.0.1:4318", Spans: true,
+		HTTP: HTTPParams{CAFile: certFile, CertFile: certFile, KeyFile: keyFile, Token: "tkn"}})
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_ = o.Close(ctx)
+
+	_, err = NewOTel(context.Background(), OTelParams{Endpoint: "https://127.0.0.1:4318", HTTP: HTTPParams{CAFile: "/no/such/file"}})
+	assert.ErrorContains(t, err, "invalid otel tls params")
+	_, err = NewOTel(context.Background(), OTelParams{Endpoint: "https://127.0.0.1:4318", HTTP: HTTPParams{BasicAuth: "user"}})
+	assert.ErrorContains(t, err, "invalid otel auth params")
+}
+
+type logExporterMock struct {
+	sync.Mutex
+	recs []sdklog.Record
+}
+
+func (m *logExporterMock) Export(_ context.Context, records []sdklog.Record) error {
+	m.Lock()
+	defer m.Unlock()
+	for _, r := range records {
+		m.recs = append(m.recs, r.Clone())
+	}
+	return nil
+}
+
+func (m *logExporterMock) Shutdown(context.Context) error   { return nil }
+func (m *logExporterMock) ForceFlush(context.Context) error { return nil }
+
+func (m *logExporterMock) get() []sdklog.Record {
+	m.Lock()
+	defer m.Unlock()
+	return m.recs
+}
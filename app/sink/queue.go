@@ -0,0 +1,152 @@
+package sink
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/docker-logger/app/discovery"
+)
+
+// Overflow defines what Queue does with an event if its queue is full
+type Overflow int
+
+// enum of all overflow policies
+const (
+	// OverflowDrop drops the event, so slow sink never stalls publisher and other sinks.
+	// At-most-once delivery, events lost while sink is slow or down.
+	OverflowDrop Overflow = iota
+	// OverflowBlock waits for room in the queue, stalling publisher and, with it, all other sinks.
+	// No events dropped by the queue, but delivery is still at-most-once, as sink may fail to publish itself.
+	OverflowBlock
+)
+
+// queue reporting and closing defaults
+const (
+	queueReportInterval = time.Minute     // how often backlog and drops of the queue logged, if any
+	queueAbortTimeout   = 5 * time.Second // wait for publishing canceled on close timeout
+)
+
+// Queue isolates EventSink from publisher and other sinks. Events put to bounded queue and published
+// by a dedicated goroutine, so slow or failing sink affects its own queue only. Queue more than half full
+// and events dropped since the last report logged every minute.
+type Queue struct {
+	sink     EventSink
+	name     string
+	overflow Overflow
+	ch       chan discovery.Event
+	ctx      context.Context // nolint:containedctx // publishing context, canceled on close timeout
+	cancel   context.CancelFunc
+	done     chan struct{}
+	dropped  atomic.Int64
+	lost     atomic.Int64 // queued events not published as canceled on close
+	report   time.Duration
+}
+
+// NewQueue makes Queue for the sink with size events buffer, 1000 by default, and starts publishing goroutine
+func NewQueue(s EventSink, name string, size int, overflow Overflow) *Queue {
+	return newQueue(s, name, size, overflow, queueReportInterval)
+}
+
+// newQueue makes Queue with its backlog and drops logged every report interval
+func newQueue(s EventSink, name string, size int, overflow Overflow, report time.Duration) *Queue {
+	if size <= 0 {
+		size = 1000
+	}
+	res := &Queue{sink: s, name: name, overflow: overflow, ch: make(chan discovery.Event, size), done: make(chan struct{}),
+		report: report}
+	res.ctx, res.cancel = context.WithCancel(context.Background())
+	go res.run()
+	go res.monitor()
+	return res
+}
+
+// Publish puts event to the queue, applies overflow policy if queue is full. Never fails.
+func (q *Queue) Publish(ctx context.Context, event discovery.Event) error {
+	if q.overflow == OverflowBlock {
+		select {
+		case q.ch <- event:
+		case <-ctx.Done():
+			q.dropped.Add(1)
+		}
+		return nil
+	}
+
+	select {
+	case q.ch <- event:
+	default:
+		if q.dropped.Add(1) == 1 {
+			log.Printf("[WARN] %s sink queue is full, events dropped", q.name)
+		}
+	}
+	return nil
+}
+
+// Close publishes queued events and closes the sink. On ctx done publishing canceled, queued events are lost,
+// and the sink closed once the event in flight returned. Should not be called concurrently with Publish.
+func (q *Queue) Close(ctx context.Context) error {
+	close(q.ch)
+	select {
+	case <-q.done:
+	case <-ctx.Done():
+		q.cancel()
+		select {
+		case <-q.done:
+		case <-time.After(queueAbortTimeout):
+			log.Printf("[WARN] %s sink publish not finished in %v after cancel", q.name, queueAbortTimeout)
+		}
+		log.Printf("[WARN] %s sink closed with %d queued events not published", q.name, q.lost.Load())
+	}
+	q.cancel()
+	if dropped := q.Dropped(); dropped > 0 {
+		log.Printf("[WARN] %s sink dropped %d events on full queue", q.name, dropped)
+	}
+	return errors.Wrapf(q.sink.Close(ctx), "can't close %s sink", q.name)
+}
+
+// Depth returns number of queued events
+func (q *Queue) Depth() int {
+	return len(q.ch)
+}
+
+// Dropped returns number of events dropped due to full queue
+func (q *Queue) Dropped() int64 {
+	return q.dropped.Load()
+}
+
+// run publishes queued events until queue closed, events left after cancel counted as lost
+func (q *Queue) run() {
+	defer close(q.done)
+	for event := range q.ch {
+		if q.ctx.Err() != nil {
+			q.lost.Add(1)
+			continue
+		}
+		if err := q.sink.Publish(q.ctx, event); err != nil {
+			log.Printf("[WARN] can't publish event %+v to %s sink, %v", event, q.name, err)
+		}
+	}
+}
+
+// monitor logs queue backlog and drops every report interval, until publishing finished
+func (q *Queue) monitor() {
+	ticker := time.NewTicker(q.report)
+	defer ticker.Stop()
+	var reported int64
+	for {
+		select {
+		case <-q.done:
+			return
+		case <-ticker.C:
+		}
+		dropped := q.Dropped()
+		if depth := q.Depth(); dropped > reported || depth > cap(q.ch)/2 {
+			log.Printf("[WARN] %s sink queue depth %d of %d, %d events dropped since last report", q.name, depth,
+				cap(q.ch), dropped-reported)
+		}
+		reported = dropped
+	}
+}
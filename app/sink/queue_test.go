@@ -0,0 +1,170 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/docker-logger/app/discovery"
+)
+
+func TestQueue_Drop(t *testing.T) {
+	s := &sinkMock{release: make(chan struct{})}
+	q := NewQueue(s, "mock", 2, OverflowDrop)
+	ctx := context.Background()
+
+	require.NoError(t, q.Publish(ctx, discovery.Event{ContainerID: "id1"}))
+	require.Eventually(t, func() bool { return s.inFlight() }, time.Second, time.Millisecond, "first event taken by sink")
+	for _, id := range []string{"id2", "id3", "id4", "id5"} {
+		require.NoError(t, q.Publish(ctx, discovery.Event{ContainerID: id}), "publish never blocks")
+	}
+	assert.Equal(t, 2, q.Depth())
+	assert.Equal(t, int64(2), q.Dropped())
+
+	close(s.release)
+	require.NoError(t, q.Close(ctx))
+	assert.Equal(t, []string{"id1", "id2", "id3"}, s.ids())
+	assert.True(t, s.closed)
+}
+
+func TestQueue_Block(t *testing.T) {
+	s := &sinkMock{release: make(chan struct{})}
+	q := NewQueue(s, "mock", 1, OverflowBlock)
+
+	require.NoError(t, q.Publish(context.Background(), discovery.Event{ContainerID: "id1"}))
+	require.Eventually(t, func() bool { return s.inFlight() }, time.Second, time.Millisecond)
+	require.NoError(t, q.Publish(context.Background(), discovery.Event{ContainerID: "id2"}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	st := time.Now()
+	require.NoError(t, q.Publish(ctx, discovery.Event{ContainerID: "id3"}))
+	assert.GreaterOrEqual(t, time.Since(st), 50*time.Millisecond, "blocked till ctx done")
+	assert.Equal(t, int64(1), q.Dropped())
+
+	close(s.release)
+	require.NoError(t, q.Close(context.Background()))
+	assert.Equal(t, []string{"id1", "id2"}, s.ids())
+}
+
+func TestQueue_Close(t *testing.T) {
+	s := &sinkMock{release: make(chan struct{}), closeErr: errors.New("failed")}
+	q := NewQueue(s, "mock", 10, OverflowDrop)
+	require.NoError(t, q.Publish(context.Background(), discovery.Event{ContainerID: "id1"}))
+	require.NoError(t, q.Publish(context.Background(), discovery.Event{ContainerID: "id2"}))
+	require.Eventually(t, func() bool { return s.inFlight() }, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := q.Close(ctx) // sink stuck, close gives up on ctx
+	assert.ErrorContains(t, err, "can't close mock sink: failed")
+	assert.False(t, s.closedInFlight, "closed after publishing canceled and finished")
+	assert.Empty(t, s.ids(), "in flight event canceled")
+	assert.Equal(t, int64(1), q.lost.Load(), "queued event lost")
+	close(s.release)
+}
+
+func TestQueue_Report(t *testing.T) {
+	out := &syncBuffer{}
+	log.Setup(log.Out(out))
+	t.Cleanup(func() { log.Setup(log.Out(os.Stdout)) })
+
+	s := &sinkMock{release: make(chan struct{})}
+	q := newQueue(s, "mock", 2, OverflowDrop, 10*time.Millisecond)
+	ctx := context.Background()
+	require.NoError(t, q.Publish(ctx, discovery.Event{ContainerID: "id1"}))
+	require.Eventually(t, func() bool { return s.inFlight() }, time.Second, time.Millisecond)
+	for _, id := range []string{"id2", "id3", "id4"} {
+		require.NoError(t, q.Publish(ctx, discovery.Event{ContainerID: id}))
+	}
+	require.Eventually(t, func() bool {
+		return strings.Contains(out.String(), "mock sink queue depth 2 of 2, 1 events dropped since last report")
+	}, time.Second, 5*time.Millisecond, "backlog and drops reported while running")
+	require.Eventually(t, func() bool {
+		return strings.Contains(out.String(), "mock sink queue depth 2 of 2, 0 events dropped since last report")
+	}, time.Second, 5*time.Millisecond, "still full, drops counted since last report")
+
+	close(s.release)
+	require.NoError(t, q.Close(ctx))
+}
+
+type sinkMock struct {
+	lock           sync.Mutex
+	events         []discovery.Event
+	busy           bool
+	publishing     bool
+	release        chan struct{}
+	closed         bool
+	closedInFlight bool
+	closeErr       error
+}
+
+func (m *sinkMock) Publish(ctx context.Context, event discovery.Event) error {
+	m.lock.Lock()
+	m.busy, m.publishing = true, true
+	m.lock.Unlock()
+	defer func() {
+		m.lock.Lock()
+		m.publishing = false
+		m.lock.Unlock()
+	}()
+	select {
+	case <-m.release:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.events = append(m.events, event)
+	return nil
+}
+
+func (m *sinkMock) Close(context.Context) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.closed, m.closedInFlight = true, m.publishing
+	return m.closeErr
+}
+
+func (m *sinkMock) inFlight() bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.busy
+}
+
+func (m *sinkMock) ids() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	res := make([]string, 0, len(m.events))
+	for _, e := range m.events {
+		res = append(res, e.ContainerID)
+	}
+	return res
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent writes by logger and reads by test
+type syncBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,83 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+)
+
+// retrier posts payloads with retries and exponential backoff, shared by http based sinks.
+// Network errors, 429 and 5xx responses retried, other non-2xx responses fail immediately.
+type retrier struct {
+	client     *http.Client
+	maxRetries int
+	delay      time.Duration // initial delay, doubled on each retry
+	maxDelay   time.Duration
+}
+
+// post sends body to url with headers, returns error if all attempts failed or response is not retryable
+func (r retrier) post(ctx context.Context, url string, headers map[string]string, body []byte) error {
+	delay := r.delay
+	var err error
+	for attempt := 0; attempt <= r.maxRetries; attempt++ {
+		if attempt > 0 {
+			log.Printf("[DEBUG] retry post to %s in %v, attempt %d, %v", url, delay, attempt, err)
+			select {
+			case <-ctx.Done():
+				return errors.Wrapf(ctx.Err(), "post to %s interrupted, last error %v", url, err)
+			case <-time.After(delay):
+			}
+			delay = min(delay*2, r.maxDelay)
+		}
+
+		var retryAfter time.Duration
+		var retryable bool
+		retryAfter, retryable, err = r.send(ctx, url, headers, body)
+		if err == nil {
+			return nil
+		}
+		if !retryable {
+			return err
+		}
+		if retryAfter > delay {
+			delay = min(retryAfter, r.maxDelay)
+		}
+	}
+	return errors.Wrapf(err, "post to %s failed after %d retries", url, r.maxRetries)
+}
+
+// send makes a single post, reports if failure is retryable and delay requested by server with Retry-After
+func (r retrier) send(ctx context.Context, url string, headers map[string]string, body []byte) (retryAfter time.Duration,
+	retryable bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, errors.Wrap(err, "can't make request")
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return 0, true, errors.Wrap(err, "request failed")
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, resp.Body) // drain to reuse connection
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return 0, false, nil
+	}
+	err = errors.Errorf("unexpected status %s", resp.Status)
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		if secs, e := strconv.Atoi(resp.Header.Get("Retry-After")); e == nil && secs > 0 {
+			retryAfter = time.Duration(secs) * time.Second
+		}
+		return retryAfter, true, err
+	}
+	return 0, false, err
+}
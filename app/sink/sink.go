@@ -0,0 +1,14 @@
+// Package sink provides destinations for container lifecycle events
+package sink
+
+import (
+	"context"
+
+	"github.com/umputun/docker-logger/app/discovery"
+)
+
+// EventSink publishes container lifecycle events to external system
+type EventSink interface {
+	Publish(ctx context.Context, event discovery.Event) error
+	Close(ctx context.Context) error
+}
@@ -0,0 +1,313 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/docker-logger/app/discovery"
+)
+
+// Socket streams container events to local consumers, i.e. a sidecar, connected to unix socket. Each event sent
+// as a json line with the same record as webhook. Every client subscribed to discovery of each docker host, with own
+// buffer, events not fitting it dropped and counted by the subscription, so a slow client never blocks discovery or
+// other clients. Events made by collector, not discovery, published to clients by Publish, and log lines by
+// PublishLine if enabled, with own buffer of the client. Client may send SocketFilter as a json line any time,
+// applied to events published from now on.
+type Socket struct {
+	params   SocketParams
+	sources  []Subscriber
+	listener net.Listener
+	dropped  atomic.Int64
+	wg       sync.WaitGroup
+
+	lock    sync.Mutex // protects clients
+	clients map[*socketClient]struct{}
+}
+
+// Subscriber is a source of events with own subscriptions, i.e. discovery.EventNotif
+type Subscriber interface {
+	Subscribe(name string, buffer int) *discovery.Subscription
+}
+
+// SocketParams defines socket path and options for NewSocket
+type SocketParams struct {
+	Path   string // unix socket path, stale socket file removed
+	Buffer int    // events buffer of each client, 1000 by default
+	Lines  bool   // stream container log lines as "log" typed records
+}
+
+// SocketFilter selects events sent to socket client, empty fields match all events
+type SocketFilter struct {
+	Containers []string `json:"containers,omitempty"` // regular expressions of container name
+	Groups     []string `json:"groups,omitempty"`
+	Hosts      []string `json:"hosts,omitempty"`
+	Types      []string `json:"types,omitempty"` // record types, "lifecycle" for container up and down events, "log" for lines
+}
+
+// socketClient is a connected client with its subscriptions, buffer of collector's records and filter
+type socketClient struct {
+	conn   net.Conn
+	subs   []*discovery.Subscription
+	ch     chan WebhookRecord
+	filter atomic.Pointer[socketMatcher]
+
+	wrLock sync.Mutex // serializes writes of subscriptions and buffer
+	enc    *json.Encoder
+	failed atomic.Bool
+}
+
+// socketMatcher is compiled SocketFilter
+type socketMatcher struct {
+	containers []*regexp.Regexp
+	groups     map[string]bool
+	hosts      map[string]bool
+	types      map[string]bool
+}
+
+// socketDialTimeout limits check of existing socket for running instance
+const socketDialTimeout = time.Second
+
+// NewSocket listens on unix socket and starts accepting clients, subscribing them to sources.
+// Existing socket file removed if stale, nothing accepts connections on it, and refused otherwise.
+func NewSocket(params SocketParams, sources ...Subscriber) (*Socket, error) {
+	if params.Path == "" {
+		return nil, errors.New("socket path required")
+	}
+	if params.Buffer <= 0 {
+		params.Buffer = 1000
+	}
+	if st, err := os.Stat(params.Path); err == nil && st.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.DialTimeout("unix", params.Path, socketDialTimeout); err == nil {
+			_ = conn.Close()
+			return nil, errors.Errorf("socket %s in use by another process", params.Path)
+		}
+		if err := os.Remove(params.Path); err != nil {
+			return nil, errors.Wrapf(err, "can't remove stale socket %s", params.Path)
+		}
+	}
+	listener, err := net.Listen("unix", params.Path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't listen on %s", params.Path)
+	}
+	res := &Socket{params: params, sources: sources, listener: listener, clients: map[*socketClient]struct{}{}}
+	res.wg.Add(1)
+	go res.accept()
+	return res, nil
+}
+
+// Publish queues event made by collector, collection or suppression one, to all clients with matching filter.
+// Events of discovery ignored, as clients get them from own subscriptions. Never blocks.
+func (s *Socket) Publish(_ context.Context, event discovery.Event) error {
+	if event.Type != discovery.EventCollect && event.Type != discovery.EventSuppress {
+		return nil
+	}
+	s.queue(makeRecord(event))
+	return nil
+}
+
+// PublishLine queues log line to all clients with matching filter if lines enabled. Never blocks.
+func (s *Socket) PublishLine(line LogLine) {
+	if s.params.Lines {
+		s.queue(makeLineRecord(line))
+	}
+}
+
+// Close stops accepting clients, disconnects connected ones and removes socket file.
+// Events queued to clients not delivered.
+func (s *Socket) Close(ctx context.Context) error {
+	err := s.listener.Close()
+	s.lock.Lock()
+	for c := range s.clients {
+		_ = c.conn.Close()
+	}
+	s.lock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "socket clients not disconnected")
+	}
+	if dropped := s.Dropped(); dropped > 0 {
+		log.Printf("[WARN] socket dropped %d collector's records", dropped)
+	}
+	return errors.Wrap(err, "can't close socket")
+}
+
+// Dropped returns number of collector's records, collection events and log lines, dropped as clients' buffers
+// full. Events of discovery dropped counted by subscriptions.
+func (s *Socket) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// queue puts record to buffers of clients with matching filter
+func (s *Socket) queue(rec WebhookRecord) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for c := range s.clients {
+		if !c.filter.Load().match(rec) {
+			continue
+		}
+		select {
+		case c.ch <- rec:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// accept adds connecting clients until listener closed
+func (s *Socket) accept() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("[WARN] socket %s stopped accepting clients, %v", s.params.Path, err)
+			}
+			return
+		}
+		c := &socketClient{conn: conn, ch: make(chan WebhookRecord, s.params.Buffer), enc: json.NewEncoder(conn)}
+		c.filter.Store(&socketMatcher{})
+		for _, src := range s.sources {
+			c.subs = append(c.subs, src.Subscribe("socket", s.params.Buffer))
+		}
+		s.lock.Lock()
+		s.clients[c] = struct{}{}
+		s.lock.Unlock()
+		log.Printf("[DEBUG] socket client connected, %d clients", s.count())
+		s.wg.Add(2 + len(c.subs))
+		go s.read(c)
+		go func() {
+			defer s.wg.Done()
+			for rec := range c.ch {
+				c.send(rec)
+			}
+		}()
+		for _, sub := range c.subs {
+			go func(sub *discovery.Subscription) {
+				defer s.wg.Done()
+				for event := range sub.Events() {
+					if rec := makeRecord(event); c.filter.Load().match(rec) {
+						c.send(rec)
+					}
+				}
+			}(sub)
+		}
+	}
+}
+
+// read updates client's filter from json lines it sends. On disconnect removes client, closes its subscriptions
+// and buffer.
+func (s *Socket) read(c *socketClient) {
+	defer s.wg.Done()
+	scanner := bufio.NewScanner(c.conn)
+	for scanner.Scan() {
+		var filter SocketFilter
+		if err := json.Unmarshal(scanner.Bytes(), &filter); err != nil {
+			log.Printf("[WARN] invalid socket filter %q, %v", scanner.Text(), err)
+			continue
+		}
+		m, err := filter.compile()
+		if err != nil {
+			log.Printf("[WARN] invalid socket filter %q, %v", scanner.Text(), err)
+			continue
+		}
+		c.filter.Store(m)
+	}
+
+	for _, sub := range c.subs {
+		sub.Close()
+	}
+	s.lock.Lock()
+	delete(s.clients, c)
+	close(c.ch)
+	s.lock.Unlock()
+	_ = c.conn.Close()
+	log.Printf("[DEBUG] socket client disconnected, %d clients", s.count())
+}
+
+// send writes record as json line. Failed write disconnects the client, later records discarded till
+// its subscriptions and buffer closed.
+func (c *socketClient) send(rec WebhookRecord) {
+	if c.failed.Load() {
+		return
+	}
+	c.wrLock.Lock()
+	defer c.wrLock.Unlock()
+	if err := c.enc.Encode(rec); err != nil {
+		c.failed.Store(true)
+		_ = c.conn.Close() // read fails and removes client
+	}
+}
+
+// count returns number of connected clients
+func (s *Socket) count() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.clients)
+}
+
+// compile makes matcher of filter, checking container expressions
+func (f SocketFilter) compile() (*socketMatcher, error) {
+	res := &socketMatcher{}
+	for _, c := range f.Containers {
+		re, err := regexp.Compile(c)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid container expression %q", c)
+		}
+		res.containers = append(res.containers, re)
+	}
+	set := func(values []string) map[string]bool {
+		if len(values) == 0 {
+			return nil
+		}
+		res := map[string]bool{}
+		for _, v := range values {
+			res[v] = true
+		}
+		return res
+	}
+	res.groups, res.hosts, res.types = set(f.Groups), set(f.Hosts), set(f.Types)
+	return res, nil
+}
+
+// match checks if record passes all set criteria
+func (m *socketMatcher) match(rec WebhookRecord) bool {
+	if m.groups != nil && !m.groups[rec.Group] {
+		return false
+	}
+	if m.hosts != nil && !m.hosts[rec.Host] {
+		return false
+	}
+	recType := rec.Type
+	if recType == "" {
+		recType = "lifecycle"
+	}
+	if m.types != nil && !m.types[recType] {
+		return false
+	}
+	if len(m.containers) == 0 {
+		return true
+	}
+	for _, re := range m.containers {
+		if re.MatchString(rec.ContainerName) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,237 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/docker-logger/app/discovery"
+)
+
+func TestSocket_Publish(t *testing.T) {
+	notif, docker := newTestNotif(t)
+	path := filepath.Join(t.TempDir(), "events.sock")
+	s, err := NewSocket(SocketParams{Path: path}, notif)
+	require.NoError(t, err)
+
+	all := dialSocket(t, path)
+	filtered := dialSocket(t, path)
+	_, err = filtered.conn.Write([]byte(`{"containers":["^web"],"types":["lifecycle","collection"]}` + "\n"))
+	require.NoError(t, err)
+	waitFilter(t, s, func(m *socketMatcher) bool { return len(m.containers) == 1 }, 2)
+	assert.Len(t, notif.Subscribers(), 2, "subscribed by each client")
+
+	docker.send("id1", "db", "start")
+	docker.send("id2", "web", "start")
+	rec := all.next(t)
+	assert.Equal(t, "id1", rec.ContainerID)
+	assert.Equal(t, "up", rec.Status)
+	rec = all.next(t)
+	assert.Equal(t, "id2", rec.ContainerID)
+	assert.Equal(t, "web", rec.ContainerName)
+	assert.Equal(t, "up", rec.Status)
+	assert.Equal(t, "id2", filtered.next(t).ContainerID, "filtered by container")
+
+	evTS := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	require.NoError(t, s.Publish(ctx, discovery.Event{ContainerID: "id2", ContainerName: "web", Status: false, TS: evTS}),
+		"discovery's event ignored, delivered by subscription")
+	require.NoError(t, s.Publish(ctx, discovery.Event{ContainerID: "id2", ContainerName: "web", Type: discovery.EventCollect,
+		Status: true, TS: evTS}))
+	s.PublishLine(LogLine{Container: discovery.Event{ContainerID: "id2", ContainerName: "web"}, Stream: "stdout", Line: "l1"})
+	assert.Equal(t, WebhookRecord{ContainerID: "id2", ContainerName: "web", Type: "collection", Status: "started", TS: evTS},
+		all.next(t), "lines disabled")
+	assert.Equal(t, "collection", filtered.next(t).Type)
+
+	require.NoError(t, all.conn.Close())
+	require.Eventually(t, func() bool { return s.count() == 1 && len(notif.Subscribers()) == 1 }, time.Second,
+		5*time.Millisecond, "disconnected client removed and unsubscribed")
+	docker.send("id3", "web2", "start")
+	assert.Equal(t, "id3", filtered.next(t).ContainerID)
+
+	require.NoError(t, s.Close(ctx))
+	assert.Equal(t, 0, s.count())
+	assert.Empty(t, notif.Subscribers())
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "socket file removed")
+	assert.Equal(t, int64(0), s.Dropped())
+}
+
+func TestSocket_Lines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.sock")
+	s, err := NewSocket(SocketParams{Path: path, Lines: true})
+	require.NoError(t, err)
+	defer s.Close(context.Background())
+
+	all := dialSocket(t, path)
+	events := dialSocket(t, path)
+	_, err = events.conn.Write([]byte(`{"types":["collection"]}` + "\n"))
+	require.NoError(t, err)
+	waitFilter(t, s, func(m *socketMatcher) bool { return m.types != nil }, 2)
+
+	container := discovery.Event{ContainerID: "id1", ContainerName: "web", Group: "g1", Status: true,
+		EnvVars: map[string]string{"k": "v"}}
+	wr := NewLineWriter(container, "stderr", s)
+	wr.now = func() time.Time { return time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC) }
+	n, err := wr.Write([]byte("line 1\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 7, n)
+	assert.Equal(t, WebhookRecord{ContainerID: "id1", ContainerName: "web", Group: "g1", Type: "log", Status: "up",
+		Stream: "stderr", Line: "line 1", TS: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}, all.next(t))
+
+	require.NoError(t, s.Publish(context.Background(), discovery.Event{ContainerID: "id1", Type: discovery.EventCollect}))
+	assert.Equal(t, "collection", events.next(t).Type, "lines filtered out by type")
+	require.NoError(t, wr.Close())
+}
+
+func TestSocket_SlowClient(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.sock")
+	s, err := NewSocket(SocketParams{Path: path, Buffer: 1})
+	require.NoError(t, err)
+	defer s.Close(context.Background())
+
+	dialSocket(t, path) // never reads
+	require.Eventually(t, func() bool { return s.count() == 1 }, time.Second, 5*time.Millisecond)
+	st := time.Now()
+	for i := 0; i < 10000; i++ {
+		require.NoError(t, s.Publish(context.Background(), discovery.Event{ContainerID: "id1", ContainerName: "c1",
+			Type: discovery.EventCollect}))
+	}
+	assert.Less(t, time.Since(st), 5*time.Second, "publish not blocked")
+	assert.Positive(t, s.Dropped())
+}
+
+func TestSocket_InvalidFilter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.sock")
+	s, err := NewSocket(SocketParams{Path: path})
+	require.NoError(t, err)
+	defer s.Close(context.Background())
+
+	c := dialSocket(t, path)
+	_, err = c.conn.Write([]byte("{bad json\n" + `{"containers":["[bad"]}` + "\n" + `{"hosts":["h1"]}` + "\n"))
+	require.NoError(t, err)
+	waitFilter(t, s, func(m *socketMatcher) bool { return m.hosts != nil }, 1)
+	require.NoError(t, s.Publish(context.Background(), discovery.Event{ContainerID: "id1", Host: "h2", Type: discovery.EventCollect}))
+	require.NoError(t, s.Publish(context.Background(), discovery.Event{ContainerID: "id2", Host: "h1", Type: discovery.EventCollect}))
+	assert.Equal(t, "id2", c.next(t).ContainerID, "invalid filters skipped, client kept")
+}
+
+func TestSocket_StalePath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.sock")
+	l, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, l.Close())
+
+	s, err := NewSocket(SocketParams{Path: path})
+	require.NoError(t, err, "stale socket replaced")
+
+	_, err = NewSocket(SocketParams{Path: path})
+	require.Error(t, err, "socket of running instance kept")
+	assert.Contains(t, err.Error(), "in use by another process")
+	dialSocket(t, path) // still served
+	require.NoError(t, s.Close(context.Background()))
+
+	regular := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(regular, []byte("data"), 0o600))
+	_, err = NewSocket(SocketParams{Path: regular})
+	assert.Error(t, err, "regular file not removed")
+
+	_, err = NewSocket(SocketParams{})
+	assert.EqualError(t, err, "socket path required")
+}
+
+// waitFilter waits for count clients connected, one of them with filter matching check
+func waitFilter(t *testing.T, s *Socket, check func(m *socketMatcher) bool, count int) {
+	require.Eventually(t, func() bool {
+		if s.count() != count {
+			return false
+		}
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		for c := range s.clients {
+			if check(c.filter.Load()) {
+				return true
+			}
+		}
+		return false
+	}, time.Second, 5*time.Millisecond, "filter applied")
+}
+
+// testDocker is docker client of newTestNotif, sending container events to the listener
+type testDocker struct {
+	lock     sync.Mutex
+	listener chan<- *dockerclient.APIEvents
+}
+
+func (d *testDocker) ListContainers(dockerclient.ListContainersOptions) ([]dockerclient.APIContainers, error) {
+	return nil, nil
+}
+
+func (d *testDocker) AddEventListener(listener chan<- *dockerclient.APIEvents) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.listener = listener
+	return nil
+}
+
+func (d *testDocker) send(id, name, status string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.listener <- &dockerclient.APIEvents{Type: "container", Status: status,
+		Actor: dockerclient.APIActor{ID: id, Attributes: map[string]string{"name": name}}}
+}
+
+// newTestNotif makes discovery of testDocker, its channel drained till test end
+func newTestNotif(t *testing.T) (*discovery.EventNotif, *testDocker) {
+	d := &testDocker{}
+	notif, err := discovery.NewEventNotif(d, nil, nil, "", "")
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		d.lock.Lock()
+		defer d.lock.Unlock()
+		return d.listener != nil
+	}, time.Second, time.Millisecond)
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	go func() {
+		for {
+			select {
+			case <-notif.Channel():
+			case <-done:
+				return
+			}
+		}
+	}()
+	return notif, d
+}
+
+type socketReader struct {
+	conn    net.Conn
+	scanner *bufio.Scanner
+}
+
+func dialSocket(t *testing.T, path string) socketReader {
+	conn, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return socketReader{conn: conn, scanner: bufio.NewScanner(conn)}
+}
+
+func (r socketReader) next(t *testing.T) WebhookRecord {
+	require.NoError(t, r.conn.SetReadDeadline(time.Now().Add(time.Second)))
+	require.True(t, r.scanner.Scan(), "no event, %v", r.scanner.Err())
+	var rec WebhookRecord
+	require.NoError(t, json.Unmarshal(r.scanner.Bytes(), &rec))
+	return rec
+}
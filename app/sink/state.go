@@ -0,0 +1,171 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/docker-logger/app/discovery"
+)
+
+// StateFileWriter keeps a json state file per container in a directory, named by container id, so external tools
+// discover collected containers and their log files by filesystem. File made on container's up event, updated on
+// each event and removed once container destroyed. Files updated atomically, written to temp file and renamed,
+// so readers never see a partial one. Files left from previous run removed on start, as the initial scan makes
+// files of running containers again.
+type StateFileWriter struct {
+	params StateFileParams
+
+	lock   sync.Mutex // protects states and serializes writes
+	states map[string]ContainerState
+}
+
+// StateFileParams defines directory and options for NewStateFileWriter
+type StateFileParams struct {
+	Dir string // directory of state files, made if missing
+}
+
+// ContainerState is a content of container's state file
+type ContainerState struct {
+	ContainerID   string     `json:"container_id"`
+	ContainerName string     `json:"container_name"`
+	Group         string     `json:"group,omitempty"`
+	Image         string     `json:"image,omitempty"`
+	Host          string     `json:"host,omitempty"`
+	Status        string     `json:"status"`           // up or down
+	Reason        string     `json:"reason,omitempty"` // why container went down
+	StartedAt     time.Time  `json:"started_at"`
+	StoppedAt     *time.Time `json:"stopped_at,omitempty"` // nil for up container
+	UpdatedAt     time.Time  `json:"updated_at"`
+	LogFile       string     `json:"log_file,omitempty"`
+	ErrFile       string     `json:"err_file,omitempty"`
+}
+
+const stateFileExt = ".json"
+
+// NewStateFileWriter makes dir if missing and removes state files left in it
+func NewStateFileWriter(params StateFileParams) (*StateFileWriter, error) {
+	if params.Dir == "" {
+		return nil, errors.New("state files directory required")
+	}
+	if err := os.MkdirAll(params.Dir, 0o750); err != nil {
+		return nil, errors.Wrapf(err, "can't make state files directory %s", params.Dir)
+	}
+	res := &StateFileWriter{params: params, states: map[string]ContainerState{}}
+	if err := res.cleanup(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Publish updates state file of event's container, removes it for destroyed container. Events of other types
+// ignored, except image one updating image of known container.
+func (s *StateFileWriter) Publish(_ context.Context, event discovery.Event) error {
+	if event.Type != discovery.EventLifecycle && event.Type != discovery.EventImage {
+		return nil
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	st, known := s.states[event.ContainerID]
+	if event.Type == discovery.EventImage {
+		if !known {
+			return nil
+		}
+		st.Image, st.UpdatedAt = event.Image, time.Now()
+		s.states[event.ContainerID] = st
+		return s.write(st)
+	}
+
+	if !event.Status && event.Reason == discovery.ReasonRemoved {
+		delete(s.states, event.ContainerID)
+		if err := os.Remove(s.path(event.ContainerID)); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "can't remove state file of %s", event.ContainerName)
+		}
+		return nil
+	}
+
+	st.ContainerID, st.ContainerName, st.Group, st.Host = event.ContainerID, event.ContainerName, event.Group, event.Host
+	if event.Image != "" {
+		st.Image = event.Image
+	}
+	if event.LogFilePath != "" {
+		st.LogFile, st.ErrFile = event.LogFilePath, event.ErrFilePath
+	}
+	st.Status, st.Reason, st.StoppedAt = "up", "", nil
+	if event.Status {
+		st.StartedAt = event.TS
+	} else {
+		stopped := event.TS
+		st.Status, st.Reason, st.StoppedAt = "down", event.Reason.String(), &stopped
+	}
+	st.UpdatedAt = time.Now()
+	s.states[event.ContainerID] = st
+	return s.write(st)
+}
+
+// Close does nothing, state files kept with the last known state till the next start
+func (s *StateFileWriter) Close(context.Context) error {
+	return nil
+}
+
+// write stores state to temp file and renames it to container's state file
+func (s *StateFileWriter) write(st ContainerState) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "can't marshal state of %s", st.ContainerName)
+	}
+	fh, err := os.CreateTemp(s.params.Dir, "."+st.ContainerID+"-*.tmp")
+	if err != nil {
+		return errors.Wrapf(err, "can't make state file of %s", st.ContainerName)
+	}
+	if _, err = fh.Write(append(data, '\n')); err == nil {
+		err = fh.Close()
+	} else {
+		_ = fh.Close()
+	}
+	if err == nil {
+		err = os.Rename(fh.Name(), s.path(st.ContainerID))
+	}
+	if err != nil {
+		_ = os.Remove(fh.Name())
+		return errors.Wrapf(err, "can't write state file of %s", st.ContainerName)
+	}
+	return nil
+}
+
+// cleanup removes state files and temp files of interrupted writes left in the directory, other files kept
+func (s *StateFileWriter) cleanup() error {
+	entries, err := os.ReadDir(s.params.Dir)
+	if err != nil {
+		return errors.Wrapf(err, "can't read state files directory %s", s.params.Dir)
+	}
+	var removed int
+	for _, entry := range entries {
+		name := entry.Name()
+		stale := strings.HasSuffix(name, stateFileExt) || (strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".tmp"))
+		if entry.IsDir() || !stale {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.params.Dir, name)); err != nil {
+			return errors.Wrapf(err, "can't remove stale state file %s", name)
+		}
+		removed++
+	}
+	if removed > 0 {
+		log.Printf("[INFO] removed %d stale state files from %s", removed, s.params.Dir)
+	}
+	return nil
+}
+
+// path returns state file of container
+func (s *StateFileWriter) path(containerID string) string {
+	return filepath.Join(s.params.Dir, containerID+stateFileExt)
+}
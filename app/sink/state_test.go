@@ -0,0 +1,117 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/docker-logger/app/discovery"
+)
+
+func TestStateFileWriter(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+	s, err := NewStateFileWriter(StateFileParams{Dir: dir})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	started := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, s.Publish(ctx, discovery.Event{ContainerID: "id1", ContainerName: "web", Group: "system",
+		Image: "nginx:1", Host: "h1", Status: true, TS: started, LogFilePath: "logs/web.log", ErrFilePath: "logs/web.err"}))
+	st := readState(t, filepath.Join(dir, "id1.json"))
+	assert.Equal(t, "up", st.Status)
+	assert.Equal(t, started, st.StartedAt)
+	assert.Nil(t, st.StoppedAt)
+	assert.Equal(t, "logs/web.log", st.LogFile)
+	assert.Equal(t, "logs/web.err", st.ErrFile)
+	assert.Equal(t, "system", st.Group)
+	assert.False(t, st.UpdatedAt.IsZero())
+
+	require.NoError(t, s.Publish(ctx, discovery.Event{ContainerID: "id1", ContainerName: "web", Type: discovery.EventImage,
+		Image: "nginx:2", TS: started.Add(time.Minute)}))
+	assert.Equal(t, "nginx:2", readState(t, filepath.Join(dir, "id1.json")).Image, "image updated")
+
+	require.NoError(t, s.Publish(ctx, discovery.Event{ContainerID: "id1", ContainerName: "web", Type: discovery.EventCollect,
+		Status: false}))
+	require.NoError(t, s.Publish(ctx, discovery.Event{ContainerID: "id9", ContainerName: "other", Type: discovery.EventImage}))
+	_, err = os.Stat(filepath.Join(dir, "id9.json"))
+	assert.True(t, os.IsNotExist(err), "image event of unknown container ignored")
+
+	stopped := started.Add(time.Hour)
+	require.NoError(t, s.Publish(ctx, discovery.Event{ContainerID: "id1", ContainerName: "web", Group: "system",
+		Reason: discovery.ReasonCrashed, TS: stopped}))
+	st = readState(t, filepath.Join(dir, "id1.json"))
+	assert.Equal(t, "down", st.Status)
+	assert.Equal(t, "crashed", st.Reason)
+	assert.Equal(t, started, st.StartedAt, "start kept")
+	require.NotNil(t, st.StoppedAt)
+	assert.Equal(t, stopped, *st.StoppedAt)
+	assert.Equal(t, "nginx:2", st.Image, "image kept")
+	assert.Equal(t, "logs/web.log", st.LogFile, "log file kept")
+
+	require.NoError(t, s.Publish(ctx, discovery.Event{ContainerID: "id1", ContainerName: "web", Status: true,
+		TS: stopped.Add(time.Second)}))
+	st = readState(t, filepath.Join(dir, "id1.json"))
+	assert.Equal(t, "up", st.Status, "restarted")
+	assert.Empty(t, st.Reason)
+	assert.Nil(t, st.StoppedAt)
+
+	require.NoError(t, s.Publish(ctx, discovery.Event{ContainerID: "id1", ContainerName: "web", Reason: discovery.ReasonRemoved}))
+	_, err = os.Stat(filepath.Join(dir, "id1.json"))
+	assert.True(t, os.IsNotExist(err), "removed on destroy")
+	require.NoError(t, s.Publish(ctx, discovery.Event{ContainerID: "id1", ContainerName: "web", Reason: discovery.ReasonRemoved}),
+		"removal of missing file ignored")
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "no temp files left")
+	require.NoError(t, s.Close(ctx))
+}
+
+func TestStateFileWriter_Cleanup(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"old1.json", "old2.json", ".old3-123.tmp", "notes.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0o600))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub.json"), 0o750))
+
+	_, err := NewStateFileWriter(StateFileParams{Dir: dir})
+	require.NoError(t, err)
+	var names []string
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.Equal(t, []string{"notes.txt", "sub.json"}, names, "stale state and temp files removed")
+
+	_, err = NewStateFileWriter(StateFileParams{})
+	assert.EqualError(t, err, "state files directory required")
+	_, err = NewStateFileWriter(StateFileParams{Dir: filepath.Join(dir, "notes.txt", "state")})
+	assert.Error(t, err)
+}
+
+func TestStateFileWriter_WriteFailed(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewStateFileWriter(StateFileParams{Dir: dir})
+	require.NoError(t, err)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "id1.json"), 0o750)) // rename over directory fails
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "id1.json", "f"), nil, 0o600))
+	err = s.Publish(context.Background(), discovery.Event{ContainerID: "id1", ContainerName: "web", Status: true})
+	assert.ErrorContains(t, err, "can't write state file of web")
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "temp file removed")
+}
+
+func readState(t *testing.T, path string) (res ContainerState) {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &res))
+	return res
+}
@@ -0,0 +1,198 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/docker-logger/app/discovery"
+)
+
+// Webhook posts batches of container events as JSON to the url. Batch sent when BatchSize events collected
+// or every FlushInterval, whichever comes first. Batches failed after all retries dropped and counted.
+// With Lines set container log lines sent in the same batches, as "log" typed records.
+type Webhook struct {
+	params       WebhookParams
+	retry        retrier
+	headers      map[string]string
+	batches      *batcher[WebhookRecord]
+	dropped      atomic.Int64
+	droppedLines atomic.Int64
+}
+
+// WebhookParams defines url and options for NewWebhook
+type WebhookParams struct {
+	URL           string
+	BatchSize     int               // max events in a single post, 100 by default
+	FlushInterval time.Duration     // max delay of pending events, 1s by default
+	MaxRetries    int               // retries of failed post before the batch dropped
+	RetryDelay    time.Duration     // initial delay between retries, doubled on each retry, 1s by default
+	Headers       map[string]string // extra headers of each post
+	Lines         bool              // send log lines published by PublishLine
+	LineBuffer    int               // max pending records a log line added to, 10 batches by default
+	HTTP          HTTPParams
+}
+
+// WebhookRecord is a single event in webhook payload, and in grpc batch
+type WebhookRecord struct {
+	ContainerID   string             `json:"container_id"`
+	ContainerName string             `json:"container_name"`
+	RawName       string             `json:"raw_name,omitempty"` // docker's name, if differs from resolved one
+	Group         string             `json:"group,omitempty"`
+	Image         string             `json:"image,omitempty"`
+	Type          string             `json:"type,omitempty"` // "collection", "daemon" or "log" for such records, empty for lifecycle
+	Status        string             `json:"status"`         // up/down, started/stopped/suppressed/resumed for collection, type.action
+	Reason        string             `json:"reason,omitempty"`
+	Host          string             `json:"host,omitempty"`
+	Source        string             `json:"source,omitempty"`
+	NodeID        string             `json:"node_id,omitempty"` // swarm node of the task
+	Seq           uint64             `json:"seq,omitempty"`     // position in events stream of docker host, with --event-seq
+	FromScan      bool               `json:"from_scan,omitempty"`
+	TS            time.Time          `json:"ts"`
+	K8s           *discovery.K8sMeta `json:"k8s,omitempty"`
+	Network       *discovery.Network `json:"network,omitempty"`
+	Env           map[string]string  `json:"env,omitempty"`
+	LogFile       string             `json:"log_file,omitempty"` // file container's stdout written to
+	ErrFile       string             `json:"err_file,omitempty"` // file container's stderr written to
+	Stream        string             `json:"stream,omitempty"`   // stdout or stderr, for "log" typed records only
+	Line          string             `json:"line,omitempty"`     // log line, for "log" typed records only
+
+	// Deployment lists containers of compose deployment, for "deployment" typed records only
+	Deployment *discovery.Deployment `json:"deployment,omitempty"`
+}
+
+// webhookPayload is a body of webhook post
+type webhookPayload struct {
+	Events []WebhookRecord `json:"events"`
+}
+
+// NewWebhook makes Webhook sink and starts its flushing loop. TLS and auth params checked here.
+func NewWebhook(params WebhookParams) (*Webhook, error) {
+	if params.URL == "" {
+		return nil, errors.New("webhook url required")
+	}
+	if params.BatchSize <= 0 {
+		params.BatchSize = 100
+	}
+	if params.FlushInterval <= 0 {
+		params.FlushInterval = time.Second
+	}
+	if params.RetryDelay <= 0 {
+		params.RetryDelay = time.Second
+	}
+	if params.LineBuffer <= 0 {
+		params.LineBuffer = 10 * params.BatchSize
+	}
+
+	client, err := params.HTTP.Client(30 * time.Second)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid webhook tls params")
+	}
+	headers, err := params.HTTP.Headers()
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid webhook auth params")
+	}
+	for k, v := range params.Headers {
+		headers[k] = v
+	}
+	headers["Content-Type"] = "application/json"
+
+	res := &Webhook{
+		params:  params,
+		retry:   retrier{client: client, maxRetries: params.MaxRetries, delay: params.RetryDelay, maxDelay: time.Minute},
+		headers: headers,
+	}
+	res.batches = newBatcher(params.BatchSize, params.FlushInterval, res.send)
+	return res, nil
+}
+
+// Publish adds event to pending batch, triggers flush if batch is full
+func (w *Webhook) Publish(_ context.Context, event discovery.Event) error {
+	w.batches.add(makeRecord(event))
+	return nil
+}
+
+// PublishLine adds log line to pending batch with Lines set. Line dropped if LineBuffer records pending already,
+// so lines of chatty containers never pile up in memory while the endpoint is slow or down.
+func (w *Webhook) PublishLine(line LogLine) {
+	if !w.params.Lines {
+		return
+	}
+	if !w.batches.addLimited(makeLineRecord(line), w.params.LineBuffer) {
+		w.droppedLines.Add(1)
+	}
+}
+
+// makeRecord converts event to batch record
+func makeRecord(event discovery.Event) WebhookRecord {
+	rec := WebhookRecord{ContainerID: event.ContainerID, ContainerName: event.ContainerName, Group: event.Group,
+		Image: event.Image, Status: "down", Reason: event.Reason.String(), Host: event.Host, Source: event.Source,
+		TS: event.TS, K8s: event.K8s, Network: event.Network, Env: event.EnvVars, NodeID: event.NodeID, LogFile: event.LogFilePath,
+		ErrFile: event.ErrFilePath, Seq: event.Seq, FromScan: event.FromScan}
+	if event.RawName != event.ContainerName {
+		rec.RawName = event.RawName
+	}
+	if event.Status {
+		rec.Status = "up"
+	}
+	if event.Type == discovery.EventCollect {
+		rec.Type, rec.Status = "collection", "stopped"
+		if event.Status {
+			rec.Status = "started"
+		}
+	}
+	if event.Type == discovery.EventSuppress {
+		rec.Type, rec.Status = "collection", "resumed"
+		if event.Status {
+			rec.Status = "suppressed"
+		}
+	}
+	if event.Type == discovery.EventDaemon && event.Daemon != nil {
+		rec.Type, rec.Status = "daemon", event.Daemon.Type+"."+event.Daemon.Action
+	}
+	if event.Type == discovery.EventScanDone {
+		rec.Type, rec.Status = "scan", "done"
+	}
+	if event.Type == discovery.EventDeploy {
+		rec.Type, rec.Status, rec.Deployment = "deployment", "up", event.Deployment
+	}
+	if event.Type == discovery.EventKeepalive {
+		rec.Type = "keepalive"
+	}
+	return rec
+}
+
+// Close stops flushing loop and sends pending events
+func (w *Webhook) Close(ctx context.Context) error {
+	if err := w.batches.close(ctx); err != nil {
+		return errors.Wrap(err, "webhook")
+	}
+	if dropped := w.Dropped(); dropped > 0 {
+		log.Printf("[WARN] webhook dropped %d events", dropped)
+	}
+	if dropped := w.droppedLines.Load(); dropped > 0 {
+		log.Printf("[WARN] webhook dropped %d log lines on full buffer", dropped)
+	}
+	return nil
+}
+
+// Dropped returns number of events dropped after failed retries
+func (w *Webhook) Dropped() int64 {
+	return w.dropped.Load()
+}
+
+// send posts batch of events, failed batch dropped
+func (w *Webhook) send(ctx context.Context, batch []WebhookRecord) {
+	body, err := json.Marshal(webhookPayload{Events: batch})
+	if err == nil {
+		err = w.retry.post(ctx, w.params.URL, w.headers, body)
+	}
+	if err != nil {
+		w.dropped.Add(int64(len(batch)))
+		log.Printf("[WARN] webhook dropped %d events, %v", len(batch), err)
+	}
+}
@@ -0,0 +1,208 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/docker-logger/app/discovery"
+)
+
+func TestWebhook_Publish(t *testing.T) {
+	var lock sync.Mutex
+	var batches [][]WebhookRecord
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "Bearer tkn", r.Header.Get("Authorization"))
+		assert.Equal(t, "v1", r.Header.Get("X-Custom"))
+		payload := webhookPayload{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		lock.Lock()
+		batches = append(batches, payload.Events)
+		lock.Unlock()
+	}))
+	defer ts.Close()
+
+	wh, err := NewWebhook(WebhookParams{URL: ts.URL, BatchSize: 2, FlushInterval: time.Hour,
+		Headers: map[string]string{"X-Custom": "v1"}, HTTP: HTTPParams{Token: "tkn"}})
+	require.NoError(t, err)
+
+	evTS := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	require.NoError(t, wh.Publish(ctx, discovery.Event{ContainerID: "id1", ContainerName: "c1", Group: "g1", Status: true, TS: evTS}))
+	require.NoError(t, wh.Publish(ctx, discovery.Event{ContainerID: "id1", ContainerName: "c1", Group: "g1", TS: evTS,
+		Reason: discovery.ReasonCrashed}))
+	require.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(batches) == 1
+	}, time.Second, 10*time.Millisecond, "full batch flushed")
+
+	require.NoError(t, wh.Publish(ctx, discovery.Event{ContainerID: "id2", ContainerName: "c2", Status: true, TS: evTS}))
+	require.NoError(t, wh.Close(ctx))
+
+	lock.Lock()
+	defer lock.Unlock()
+	require.Len(t, batches, 2, "pending flushed on close")
+	assert.Equal(t, []WebhookRecord{
+		{ContainerID: "id1", ContainerName: "c1", Group: "g1", Status: "up", TS: evTS},
+		{ContainerID: "id1", ContainerName: "c1", Group: "g1", Status: "down", Reason: "crashed", TS: evTS},
+	}, batches[0])
+	assert.Equal(t, []WebhookRecord{{ContainerID: "id2", ContainerName: "c2", Status: "up", TS: evTS}}, batches[1])
+	assert.Equal(t, int64(0), wh.Dropped())
+}
+
+func Test_makeRecord(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	assert.Equal(t, WebhookRecord{ContainerID: "id1", ContainerName: "c1", Status: "up", TS: ts},
+		makeRecord(discovery.Event{ContainerID: "id1", ContainerName: "c1", Status: true, TS: ts}))
+	assert.Equal(t, WebhookRecord{ContainerID: "id1", ContainerName: "c1", Type: "collection", Status: "started", TS: ts},
+		makeRecord(discovery.Event{ContainerID: "id1", ContainerName: "c1", Status: true, TS: ts, Type: discovery.EventCollect}))
+	assert.Equal(t, WebhookRecord{ContainerID: "id1", ContainerName: "c1", Type: "collection", Status: "stopped", TS: ts},
+		makeRecord(discovery.Event{ContainerID: "id1", ContainerName: "c1", TS: ts, Type: discovery.EventCollect}))
+	assert.Equal(t, WebhookRecord{ContainerID: "id1", Type: "collection", Status: "suppressed", TS: ts},
+		makeRecord(discovery.Event{ContainerID: "id1", Status: true, TS: ts, Type: discovery.EventSuppress}))
+	assert.Equal(t, WebhookRecord{ContainerID: "id1", Type: "collection", Status: "resumed", TS: ts},
+		makeRecord(discovery.Event{ContainerID: "id1", TS: ts, Type: discovery.EventSuppress}))
+	assert.Equal(t, WebhookRecord{ContainerID: "id1", Type: "daemon", Status: "network.disconnect", TS: ts},
+		makeRecord(discovery.Event{ContainerID: "id1", TS: ts, Type: discovery.EventDaemon,
+			Daemon: &discovery.DaemonEvent{Type: "network", Action: "disconnect", ActorID: "net1"}}))
+	assert.Equal(t, WebhookRecord{ContainerID: "id1", Status: "up", NodeID: "node1", TS: ts},
+		makeRecord(discovery.Event{ContainerID: "id1", Status: true, NodeID: "node1", TS: ts}))
+	assert.Equal(t, WebhookRecord{ContainerID: "id1", ContainerName: "web", Type: "keepalive", Status: "up", TS: ts},
+		makeRecord(discovery.Event{Type: discovery.EventKeepalive, ContainerID: "id1", ContainerName: "web", RawName: "web",
+			Status: true, TS: ts}))
+	deployment := &discovery.Deployment{Project: "shop", Containers: []discovery.DeploymentContainer{{ID: "id1", Name: "web"}}}
+	assert.Equal(t, WebhookRecord{Type: "deployment", Status: "up", Deployment: deployment, TS: ts},
+		makeRecord(discovery.Event{Type: discovery.EventDeploy, Deployment: deployment, TS: ts}))
+	assert.Equal(t, WebhookRecord{ContainerID: "id1", Status: "up", Seq: 12, TS: ts},
+		makeRecord(discovery.Event{ContainerID: "id1", Status: true, Seq: 12, TS: ts}))
+	assert.Equal(t, WebhookRecord{ContainerID: "id1", Status: "up", FromScan: true, TS: ts},
+		makeRecord(discovery.Event{ContainerID: "id1", Status: true, FromScan: true, TS: ts}))
+	assert.Equal(t, WebhookRecord{ContainerID: "id1", Status: "up", Env: map[string]string{"APP_VERSION": "1.2"}, TS: ts},
+		makeRecord(discovery.Event{ContainerID: "id1", Status: true, EnvVars: map[string]string{"APP_VERSION": "1.2"}, TS: ts}))
+	assert.Equal(t, WebhookRecord{ContainerID: "id1", Status: "up", LogFile: "logs/c1.log", ErrFile: "logs/c1.err", TS: ts},
+		makeRecord(discovery.Event{ContainerID: "id1", Status: true, LogFilePath: "logs/c1.log", ErrFilePath: "logs/c1.err", TS: ts}))
+	assert.Equal(t, WebhookRecord{ContainerID: "id1", ContainerName: "web-1", RawName: "web.1.abc", Status: "up", TS: ts},
+		makeRecord(discovery.Event{ContainerID: "id1", ContainerName: "web-1", RawName: "web.1.abc", Status: true, TS: ts}))
+	assert.Equal(t, WebhookRecord{ContainerID: "id1", ContainerName: "web", Status: "up", TS: ts},
+		makeRecord(discovery.Event{ContainerID: "id1", ContainerName: "web", RawName: "web", Status: true, TS: ts}),
+		"raw name omitted if the same")
+	assert.Equal(t, WebhookRecord{Type: "scan", Status: "done", Host: "h1", TS: ts},
+		makeRecord(discovery.Event{Host: "h1", TS: ts, Type: discovery.EventScanDone}))
+}
+
+func TestWebhook_FlushInterval(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { calls.Add(1) }))
+	defer ts.Close()
+
+	wh, err := NewWebhook(WebhookParams{URL: ts.URL, FlushInterval: 10 * time.Millisecond})
+	require.NoError(t, err)
+	require.NoError(t, wh.Publish(context.Background(), discovery.Event{ContainerID: "id1", Status: true}))
+	assert.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, 5*time.Millisecond)
+	require.NoError(t, wh.Close(context.Background()))
+}
+
+func TestWebhook_Retry(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer ts.Close()
+
+	wh, err := NewWebhook(WebhookParams{URL: ts.URL, FlushInterval: time.Hour, MaxRetries: 2, RetryDelay: time.Millisecond})
+	require.NoError(t, err)
+	require.NoError(t, wh.Publish(context.Background(), discovery.Event{ContainerID: "id1", Status: true}))
+	require.NoError(t, wh.Close(context.Background()))
+	assert.Equal(t, int32(3), calls.Load())
+	assert.Equal(t, int64(0), wh.Dropped())
+}
+
+func TestWebhook_Drop(t *testing.T) {
+	var calls, status atomic.Int32
+	status.Store(http.StatusInternalServerError)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer ts.Close()
+
+	wh, err := NewWebhook(WebhookParams{URL: ts.URL, FlushInterval: time.Hour, MaxRetries: 2, RetryDelay: time.Millisecond})
+	require.NoError(t, err)
+	require.NoError(t, wh.Publish(context.Background(), discovery.Event{ContainerID: "id1", Status: true}))
+	require.NoError(t, wh.Publish(context.Background(), discovery.Event{ContainerID: "id2", Status: true}))
+	wh.batches.flush(context.Background())
+	assert.Equal(t, int32(3), calls.Load(), "5xx retried")
+	assert.Equal(t, int64(2), wh.Dropped())
+
+	status.Store(http.StatusBadRequest)
+	require.NoError(t, wh.Publish(context.Background(), discovery.Event{ContainerID: "id3", Status: true}))
+	require.NoError(t, wh.Close(context.Background()))
+	assert.Equal(t, int32(4), calls.Load(), "4xx not retried")
+	assert.Equal(t, int64(3), wh.Dropped())
+}
+
+func TestWebhook_Lines(t *testing.T) {
+	var lock sync.Mutex
+	var records []WebhookRecord
+	ts := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		payload := webhookPayload{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		lock.Lock()
+		records = append(records, payload.Events...)
+		lock.Unlock()
+	}))
+	defer ts.Close()
+
+	container := discovery.Event{ContainerID: "id1", ContainerName: "web", Status: true}
+	lineTS := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	wh, err := NewWebhook(WebhookParams{URL: ts.URL, FlushInterval: time.Hour, Lines: true, LineBuffer: 3})
+	require.NoError(t, err)
+	require.NoError(t, wh.Publish(context.Background(), container))
+	for i := 0; i < 3; i++ {
+		wh.PublishLine(LogLine{Container: container, Stream: "stdout", Line: fmt.Sprintf("line %d", i), TS: lineTS})
+	}
+	require.NoError(t, wh.Publish(context.Background(), discovery.Event{ContainerID: "id1", ContainerName: "web"}),
+		"events not limited")
+	require.NoError(t, wh.Close(context.Background()))
+
+	require.Len(t, records, 4, "the third line dropped, buffer full")
+	assert.Equal(t, "up", records[0].Status)
+	assert.Equal(t, WebhookRecord{ContainerID: "id1", ContainerName: "web", Type: "log", Status: "up", Stream: "stdout",
+		Line: "line 0", TS: lineTS}, records[1])
+	assert.Equal(t, "line 1", records[2].Line)
+	assert.Equal(t, "down", records[3].Status)
+	assert.Equal(t, int64(1), wh.droppedLines.Load())
+	assert.Equal(t, int64(0), wh.Dropped())
+
+	records = nil
+	wh, err = NewWebhook(WebhookParams{URL: ts.URL, FlushInterval: time.Hour})
+	require.NoError(t, err)
+	wh.PublishLine(LogLine{Container: container, Stream: "stdout", Line: "line 0"})
+	require.NoError(t, wh.Close(context.Background()))
+	assert.Empty(t, records, "lines disabled")
+}
+
+func TestNewWebhook_Errors(t *testing.T) {
+	_, err := NewWebhook(WebhookParams{})
+	assert.ErrorContains(t, err, "webhook url required")
+	_, err = NewWebhook(WebhookParams{URL: "http://127.0.0.1", HTTP: HTTPParams{CAFile: "/no/such/file"}})
+	assert.ErrorContains(t, err, "invalid webhook tls params")
+	_, err = NewWebhook(WebhookParams{URL: "http://127.0.0.1", HTTP: HTTPParams{BasicAuth: "user"}})
+	assert.ErrorContains(t, err, "invalid webhook auth params")
+}
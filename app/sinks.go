@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/docker-logger/app/discovery"
+	"github.com/umputun/docker-logger/app/sink"
+)
+
+// makeEventSinks creates all enabled sinks for container events, socket clients subscribed to sources.
+// Sinks streaming log lines set to opts.lineSinks.
+func makeEventSinks(ctx context.Context, opts *cliOpts, sources ...sink.Subscriber) ([]sink.EventSink, error) {
+	var res []sink.EventSink
+	if opts.OTelEndpoint != "" {
+		o, err := sink.NewOTel(ctx, sink.OTelParams{Endpoint: opts.OTelEndpoint, Spans: opts.OTelSpans, Host: opts.Source,
+			HTTP: httpParams(opts)})
+		if err != nil {
+			return nil, errors.Wrap(err, "can't make otel sink")
+		}
+		res = append(res, queued(opts, o, "otel"))
+		log.Printf("[INFO] otel sink enabled, endpoint %s, spans %v", opts.OTelEndpoint, opts.OTelSpans)
+	}
+	if opts.WebhookURL != "" {
+		headers, err := parseHeaders(opts.WebhookHeaders)
+		if err != nil {
+			return nil, err
+		}
+		wh, err := sink.NewWebhook(sink.WebhookParams{URL: opts.WebhookURL, BatchSize: opts.WebhookBatch,
+			FlushInterval: opts.WebhookFlush, MaxRetries: opts.WebhookRetries, Headers: headers, Lines: opts.WebhookLines,
+			HTTP: httpParams(opts)})
+		if err != nil {
+			return nil, errors.Wrap(err, "can't make webhook sink")
+		}
+		res = append(res, queued(opts, wh, "webhook"))
+		if opts.WebhookLines {
+			opts.lineSinks = append(opts.lineSinks, wh) // not queued, lines bounded by webhook itself
+		}
+		log.Printf("[INFO] webhook sink enabled, url %s, log lines %v", opts.WebhookURL, opts.WebhookLines)
+	}
+	if opts.CloudEventsURL != "" {
+		ce, err := sink.NewCloudEvents(sink.CloudEventsParams{URL: opts.CloudEventsURL, BatchSize: opts.CloudEventsBatch,
+			MaxRetries: opts.CloudEventsRetries, HTTP: httpParams(opts)})
+		if err != nil {
+			return nil, errors.Wrap(err, "can't make cloudevents sink")
+		}
+		res = append(res, queued(opts, ce, "cloudevents"))
+		log.Printf("[INFO] cloudevents sink enabled, url %s, batch %d", opts.CloudEventsURL, opts.CloudEventsBatch)
+	}
+	if opts.GRPCAddress != "" {
+		g, err := sink.NewGRPC(sink.GRPCParams{Address: opts.GRPCAddress, BatchSize: opts.GRPCBatch, FlushInterval: opts.GRPCFlush,
+			MaxUnacked: opts.GRPCUnacked, Plaintext: opts.GRPCPlaintext, Lines: opts.GRPCLines, HTTP: httpParams(opts)})
+		if err != nil {
+			return nil, errors.Wrap(err, "can't make grpc sink")
+		}
+		res = append(res, queued(opts, g, "grpc"))
+		if opts.GRPCLines {
+			opts.lineSinks = append(opts.lineSinks, g) // not queued, lines bounded by grpc sink itself
+		}
+		log.Printf("[INFO] grpc sink enabled, address %s, log lines %v", opts.GRPCAddress, opts.GRPCLines)
+	}
+	if opts.SocketPath != "" {
+		s, err := sink.NewSocket(sink.SocketParams{Path: opts.SocketPath, Buffer: opts.SocketBuffer, Lines: opts.SocketLines},
+			sources...)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't make socket sink")
+		}
+		res = append(res, s) // not queued, publish never blocks
+		if opts.SocketLines {
+			opts.lineSinks = append(opts.lineSinks, s)
+		}
+		log.Printf("[INFO] socket sink enabled, path %s, log lines %v", opts.SocketPath, opts.SocketLines)
+	}
+	if opts.StateDir != "" {
+		s, err := sink.NewStateFileWriter(sink.StateFileParams{Dir: opts.StateDir})
+		if err != nil {
+			return nil, errors.Wrap(err, "can't make state files sink")
+		}
+		res = append(res, s) // not queued, local writes are fast and no state update dropped
+		log.Printf("[INFO] state files sink enabled, directory %s", opts.StateDir)
+	}
+	return res, nil
+}
+
+// queued wraps sink with its own queue, so slow sink doesn't block others
+func queued(opts *cliOpts, s sink.EventSink, name string) sink.EventSink {
+	overflow := sink.OverflowDrop
+	if opts.SinkOverflow == "block" {
+		overflow = sink.OverflowBlock
+	}
+	return sink.NewQueue(s, name, opts.SinkQueue, overflow)
+}
+
+// parseHeaders parses headers in "name:value" format
+func parseHeaders(specs []string) (map[string]string, error) {
+	res := map[string]string{}
+	for _, spec := range specs {
+		name, value, ok := strings.Cut(spec, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, errors.Errorf("invalid header %q, expected name:value", spec)
+		}
+		res[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return res, nil
+}
+
+// httpParams makes tls and auth params shared by http based sinks
+func httpParams(opts *cliOpts) sink.HTTPParams {
+	return sink.HTTPParams{CAFile: opts.SinkCAFile, CertFile: opts.SinkCertFile, KeyFile: opts.SinkKeyFile,
+		InsecureSkipVerify: opts.SinkInsecure, Token: opts.SinkToken, BasicAuth: opts.SinkBasicAuth}
+}
+
+// publishEvent sends event to all sinks, failures logged and ignored
+func publishEvent(ctx context.Context, sinks []sink.EventSink, event discovery.Event) {
+	for _, s := range sinks {
+		if err := s.Publish(ctx, event); err != nil {
+			log.Printf("[WARN] can't publish event %+v, %v", event, err)
+		}
+	}
+}
+
+// closeSinks closes all sinks, giving them some time to flush
+func closeSinks(sinks []sink.EventSink) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, s := range sinks {
+		if err := s.Close(ctx); err != nil {
+			log.Printf("[WARN] can't close sink, %v", err)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_makeEventSinks(t *testing.T) {
+	sinks, err := makeEventSinks(context.Background(), &cliOpts{})
+	require.NoError(t, err)
+	assert.Empty(t, sinks)
+
+	sinks, err = makeEventSinks(context.Background(), &cliOpts{OTelEndpoint: "http://127.0.0.1:4318", OTelSpans: true})
+	require.NoError(t, err)
+	assert.Len(t, sinks, 1)
+
+	_, err = makeEventSinks(context.Background(), &cliOpts{OTelEndpoint: "http://127.0.0.1:4318", SinkCertFile: "/no/such/file"})
+	assert.Error(t, err, "invalid tls params fail on start")
+
+	opts := cliOpts{WebhookURL: "http://127.0.0.1:8080", WebhookHeaders: []string{"X-Key: v1"}, WebhookLines: true}
+	sinks, err = makeEventSinks(context.Background(), &opts)
+	require.NoError(t, err)
+	assert.Len(t, sinks, 1)
+	assert.Len(t, opts.lineSinks, 1, "webhook posts log lines")
+	closeSinks(sinks)
+
+	_, err = makeEventSinks(context.Background(), &cliOpts{WebhookURL: "http://127.0.0.1:8080", WebhookHeaders: []string{"bad"}})
+	assert.Error(t, err)
+
+	sinks, err = makeEventSinks(context.Background(), &cliOpts{CloudEventsURL: "http://127.0.0.1:8080", CloudEventsBatch: 10})
+	require.NoError(t, err)
+	assert.Len(t, sinks, 1)
+	closeSinks(sinks)
+
+	opts = cliOpts{GRPCAddress: "127.0.0.1:9090", GRPCPlaintext: true, GRPCLines: true}
+	sinks, err = makeEventSinks(context.Background(), &opts)
+	require.NoError(t, err)
+	assert.Len(t, sinks, 1)
+	assert.Len(t, opts.lineSinks, 1, "grpc streams log lines")
+	closeSinks(sinks)
+
+	opts = cliOpts{SocketPath: filepath.Join(t.TempDir(), "events.sock")}
+	sinks, err = makeEventSinks(context.Background(), &opts)
+	require.NoError(t, err)
+	assert.Len(t, sinks, 1)
+	assert.Empty(t, opts.lineSinks)
+	closeSinks(sinks)
+
+	opts = cliOpts{SocketPath: filepath.Join(t.TempDir(), "events.sock"), SocketLines: true}
+	sinks, err = makeEventSinks(context.Background(), &opts)
+	require.NoError(t, err)
+	assert.Len(t, sinks, 1)
+	assert.Len(t, opts.lineSinks, 1, "socket streams log lines")
+	closeSinks(sinks)
+
+	sinks, err = makeEventSinks(context.Background(), &cliOpts{StateDir: filepath.Join(t.TempDir(), "state")})
+	require.NoError(t, err)
+	assert.Len(t, sinks, 1)
+	closeSinks(sinks)
+}
+
+func Test_parseHeaders(t *testing.T) {
+	res, err := parseHeaders([]string{"X-Key: v1", "X-Other:a:b"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"X-Key": "v1", "X-Other": "a:b"}, res)
+
+	_, err = parseHeaders([]string{"no-value"})
+	assert.Error(t, err)
+	_, err = parseHeaders([]string{":v1"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"io"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/docker-logger/app/discovery"
+)
+
+// printEvents writes events as json envelopes, one per line, until ctx done or events closed.
+// Used by discovery-only mode, with no logs collected and no sinks.
+func printEvents(ctx context.Context, w io.Writer, events <-chan discovery.Event) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			data, err := discovery.MarshalEvent(event)
+			if err != nil {
+				log.Printf("[WARN] can't marshal event %+v, %v", event, err)
+				continue
+			}
+			if _, err := w.Write(append(data, '\n')); err != nil {
+				return errors.Wrap(err, "can't write event")
+			}
+		}
+	}
+}
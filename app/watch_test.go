@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/docker-logger/app/discovery"
+)
+
+func Test_printEvents(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	events := make(chan discovery.Event, 3)
+	events <- discovery.Event{ContainerID: "id1", ContainerName: "c1", Group: "g1", TS: ts, Status: true}
+	events <- discovery.Event{ContainerID: "id1", ContainerName: "c1", Group: "g1", TS: ts, Reason: discovery.ReasonCrashed}
+	events <- discovery.Event{TS: ts, Type: discovery.EventScanDone}
+	close(events)
+
+	buf := bytes.Buffer{}
+	require.NoError(t, printEvents(context.Background(), &buf, events))
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 3)
+	for i, tp := range []string{"container.up", "container.down", "scan.done"} {
+		ev, err := discovery.UnmarshalEvent([]byte(lines[i]))
+		require.NoError(t, err)
+		assert.Contains(t, lines[i], `"type":"`+tp+`"`)
+		assert.Equal(t, ts, ev.TS)
+	}
+	assert.Contains(t, lines[1], `"reason":"crashed"`)
+}
+
+func Test_printEventsTermination(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.NoError(t, printEvents(ctx, &bytes.Buffer{}, make(chan discovery.Event)), "stopped by ctx")
+
+	events := make(chan discovery.Event, 1)
+	events <- discovery.Event{ContainerID: "id1", Status: true}
+	assert.EqualError(t, printEvents(context.Background(), failWriter{}, events), "can't write event: write failed")
+}
+
+type failWriter struct{}
+
+func (failWriter) Write([]byte) (int, error) { return 0, errors.New("write failed") }
+
+func Test_doDiscoveryOnly(t *testing.T) {
+	opts := cliOpts{DockerHosts: []string{"tcp://127.0.0.1:1"}, Tail: "bad", GroupFiles: []string{"g1:loc=/dev/null/x"}}
+	assert.ErrorContains(t, do(context.Background(), &opts), "bad location for group g1")
+
+	opts.DiscoveryOnly = true
+	err := do(context.Background(), &opts)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to make event notifier", "collection options not checked")
+}